@@ -1,58 +1,240 @@
 package main
 
 import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/marcocsrachid/blockchain-go/internal/analytics"
+	"github.com/marcocsrachid/blockchain-go/internal/api"
 	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
 	"github.com/marcocsrachid/blockchain-go/internal/network"
+	"github.com/marcocsrachid/blockchain-go/pkg/client"
+	"github.com/marcocsrachid/blockchain-go/pkg/monitor"
+	"github.com/marcocsrachid/blockchain-go/pkg/watch"
 )
 
 func printUsage() {
 	fmt.Println("Blockchain Node")
 	fmt.Println("")
 	fmt.Println("Usage:")
-	fmt.Println("  blockchain createwallet              - Creates a new wallet")
-	fmt.Println("  blockchain listaddresses             - Lists all wallet addresses")
-	fmt.Println("  blockchain createblockchain -address ADDRESS  - Creates initial blockchain (internal use)")
+	fmt.Println("  blockchain createwallet [-hd]        - Creates a new wallet (-hd derives it from the wallet seed)")
+	fmt.Println("  blockchain restorewallet -seed HEX [-count N]  - Regenerates HD addresses and change addresses from a seed")
+	fmt.Println("  blockchain listaddresses [-verbose]  - Lists all wallet addresses (-verbose adds labels, notes and creation time)")
+	fmt.Println("  blockchain setlabel -address ADDRESS -label LABEL [-note NOTE]  - Labels a wallet address")
+	fmt.Println("  blockchain convertaddress -address ADDRESS  - Shows an address in Base58 and bech32 formats")
+	fmt.Println("  blockchain signer -address ADDRESS [-dir DIR]  - Reference external signer: answers one request on stdin/stdout")
+	fmt.Println("  blockchain sendmany -from ADDRESS -outputs JSON [-fee N] [-coinselect NAME] [-node URL] [-token CODE]  - Pays several recipients in one transaction through a running node")
+	fmt.Println("  blockchain monitor -nodes URL,URL [-interval 30s] [-stall 10m] [-maxlag 3] [-webhook URL]  - Watches nodes for forks, stalls and lagging tips")
+	fmt.Println("  blockchain watch -address ADDR [-minconf 6] [-node URL] [-interval 10s]  - Prints payments to an address and when they reach minconf confirmations")
+	fmt.Println("  blockchain createblockchain [-genesis FILE]  - Creates the blockchain from the network's fixed genesis block, or a private network's genesis.json (startnode does it when needed)")
+	fmt.Println("  blockchain migratedb [-to N]         - Converts the database to schema N (default: this release's), back up the data directory first")
 	fmt.Println("  blockchain startnode [options]       - Starts the blockchain node")
+	fmt.Println("  blockchain replay -file FILE [-realtime]  - Replays a startnode -record recording into a fresh data directory")
+	fmt.Println("  blockchain exportchain -file FILE    - Writes the main chain to a compressed bootstrap file")
+	fmt.Println("  blockchain importchain -file FILE [-genesis FILE]  - Bootstraps the chain from a trusted bootstrap file (signatures are not checked, run the verifychain job)")
+	fmt.Println("  blockchain backup -out FILE [-node URL] [-token CODE]  - Downloads a consistent backup of the chain database of a running node")
+	fmt.Println("  blockchain restore -in FILE [-genesis FILE]  - Recreates the chain database from a backup (the data directory must hold no chain)")
+	fmt.Println("  blockchain apikey -name NAME [-role read|wallet|admin]  - Generates an API key and its -api-auth entry")
+	fmt.Println("  blockchain apitoken -auth FILE -subject NAME [-role read|wallet|admin] [-ttl 24h]  - Issues a JWT signed with the jwt_secret of an -api-auth file")
 	fmt.Println("")
 	fmt.Println("Start Node Options:")
-	fmt.Println("  -miner ADDRESS    Enable mining and send rewards to ADDRESS")
+	fmt.Println("  -miner ADDRESS    Enable mining and send rewards to ADDRESS, or split them: ADDR1:60,ADDR2:40 (percentages)")
 	fmt.Println("  -port PORT        Port to listen on (default: 3000)")
+	fmt.Println("  -mining-cpu PCT   Percentage of one CPU the miner may use, it rests in between (default: 100)")
+	fmt.Println("  -max-hashrate N   Hashes per second the miner may compute, 0 = uncapped (default: 0)")
+	fmt.Println("  -genesis FILE     Join the private network of a genesis.json (the chain is created from it when missing)")
+	fmt.Println("  -coinbase-msg MSG Message embedded in the coinbase of mined blocks and templates, e.g. a pool name (up to 100 bytes)")
+	fmt.Println("  -mining-nice      Mine on a thread at the lowest scheduling priority, other processes go first (Linux)")
+	fmt.Println("  -maxoutbound N    Maximum number of outbound peers (default: 8)")
+	fmt.Println("  -maxinbound N     Maximum number of inbound peers, the least useful is evicted for a new one, 0 = unlimited (default: 32)")
+	fmt.Println("  -nat METHOD       Forward the P2P port on the router and advertise its external address: upnp, natpmp or any (default: off)")
+	fmt.Println("  -proxy HOST:PORT  Dial peers through a SOCKS5 proxy such as Tor, host names resolved by the proxy; our address is not advertised")
+	fmt.Println("  -discover-lan     Find nodes on the local network by multicast, no SEED_NODE needed (LAN test setups, classrooms)")
+	fmt.Println("  -maxconnperip N   Connections one IP may keep open at once, 0 = unlimited (default: 16)")
+	fmt.Println("  -msgrate N        Messages per second an IP may send on average, the rest is dropped, 0 = unlimited (default: 200)")
+	fmt.Println("  -maxmsgsize MB    Largest P2P message accepted, 0 = unlimited (default: 8)")
+	fmt.Println("  -addpeer HOST:PORT  Pin a trusted peer: dialed first, never rotated out, evicted or banned automatically (repeatable)")
+	fmt.Println("  -connect-only     Talk to the pinned peers only: no seeds nor gossiped peers, inbound connections from their IPs only")
+	fmt.Println("  -banip IP|CIDR    Never accept connections from nor dial an IP or IP range (repeatable)")
+	fmt.Println("  -conf FILE        Read startnode options from FILE, one name=value per line (# comments); command line options win")
+	fmt.Println("  -rotate-interval  Interval between outbound peer rotations, 0 disables (default: 10m)")
+	fmt.Println("  -ban-threshold N  Misbehavior score at which a peer is banned (invalid block 100, malformed message 20, invalid transaction 10), 0 disables (default: 100)")
+	fmt.Println("  -ban-duration DUR Length of automatic peer bans (default: 24h)")
+	fmt.Println("  -maxmemory MB     Memory limit for the mempool and caches, 0 = unlimited (default: 300)")
+	fmt.Println("  -maxmempool MB    Size limit of the pending transactions, lowest fee rates are evicted first, 0 = unlimited (default: 100)")
+	fmt.Println("  -finality-depth N Blocks after which a block is final and never reorganized, 0 disables (default: 100)")
+	fmt.Println("  -addrindex        Maintain the address history index (built on first start, enable it before -prune)")
+	fmt.Println("  -prune N          Keep the full data of the last N blocks only, older ones keep their header and unspent transactions (at least the finality depth)")
+	fmt.Println("  -coinbase-maturity N  Blocks before the wallet spends a mining reward, 0 = at once (Bitcoin uses 100)")
+	fmt.Println("  -fresh-change     Send the change of /api/send to a new wallet address (default: true)")
+	fmt.Println("  -record FILE      Record every P2P message handled, with the blocks mined and transactions submitted locally, for replay")
+	fmt.Println("  -follow HOST:PORT Run as a hot standby replica of a primary node")
+	fmt.Println("  -failover DUR    Promote the replica automatically after the primary is down this long (default: manual)")
+	fmt.Println("  -coinselect NAME  Coin selection: first (chain order), largest, smallest or bnb (least change) (default: first)")
+	fmt.Println("  -signer CMD       External signer command (e.g. \"blockchain signer -address A -dir /keys\") for /api/send")
+	fmt.Println("  -analytics        Enable the address clustering and tagging module")
+	fmt.Println("  -channels         Enable unidirectional payment channels")
+	fmt.Println("  -public           Public API profile: only read-only chain, mempool and network routes (explorer backends)")
+	fmt.Println("  -api-auth FILE    Require API keys or JWTs with read, wallet or admin roles (JSON: keys, jwt_secret, jwt_issuer, public_read)")
+	fmt.Println("  -faucet ADDRESS   Enable the testnet faucet funded by wallet ADDRESS")
+	fmt.Println("  -faucet-amount N  Coins sent per faucet request (default: 10)")
+	fmt.Println("  -faucet-cooldown  Minimum time between faucet requests per IP/address (default: 24h)")
+	fmt.Println("")
+	fmt.Println("Environment:")
+	fmt.Println("  BLOCKCHAIN_NETWORK  Network to run on: mainnet (default), testnet, regtest or a private network created with -genesis")
+	fmt.Println("  BLOCKCHAIN_DATA_DIR Data directory of the node (default: ./tmp/<network>)")
+	fmt.Println("  BLOCKCHAIN_SPEND_PASSPHRASE   Require X-Spend-Passphrase on spending endpoints (sent by sendmany and backup)")
+	fmt.Println("  BLOCKCHAIN_SPEND_TOTP_SECRET  Require an X-Spend-Token TOTP code (base32 secret) on spending endpoints")
+	fmt.Println("  BLOCKCHAIN_API_KEY            API key or token sent by sendmany, monitor, watch and backup")
+	fmt.Println("  BLOCKCHAIN_REPLICA_KEY        Shared key (16+ bytes) streaming UTXO deltas from a primary to -follow replicas")
 	fmt.Println("")
 	fmt.Println("HTTP API will be available on port 4000+ (node port + 1000)")
 	fmt.Println("")
 	fmt.Println("API Endpoints:")
 	fmt.Println("  GET  /api/balance/:address    - Get address balance")
-	fmt.Println("  GET  /api/addresses           - List all addresses")
+	fmt.Println("  GET  /api/address/:address    - Validate an address and convert between Base58 and bech32")
+	fmt.Println("  GET  /api/address/:address/history - Transactions paying or spending from an address, newest first (instant with -addrindex)")
+	fmt.Println("  GET  /api/addresses           - List all addresses (?verbose=true for labels and metadata)")
+	fmt.Println("  POST /api/addresses/:address  - Set the label and note of an address")
 	fmt.Println("  POST /api/createwallet        - Create new wallet")
-	fmt.Println("  POST /api/send                - Send transaction")
+	fmt.Println("  POST /api/send                - Send transaction (\"outputs\": [{address, amount}] pays several recipients)")
+	fmt.Println("  POST /api/anchor              - Publish a document hash on-chain in a data-carrier output")
+	fmt.Println("  POST /api/lockunspent         - Freeze wallet outputs so coin selection never spends them (\"unlock\": true to unfreeze)")
+	fmt.Println("  GET  /api/listlockunspent     - Frozen wallet outputs")
 	fmt.Println("  GET  /api/height              - Get blockchain height")
 	fmt.Println("  GET  /api/difficulty          - Get current difficulty")
 	fmt.Println("  GET  /api/networkinfo         - Get network information")
 	fmt.Println("  GET  /api/lastblock           - Get last block info")
 	fmt.Println("  GET  /api/block/:hash         - Get block by hash")
+	fmt.Println("  GET  /api/block/height/:n     - Get the main chain block at a height")
+	fmt.Println("  POST /api/faucet              - Request test coins (testnet/regtest only)")
+	fmt.Println("  POST /api/cosign/sessions     - Create a co-signing session")
+	fmt.Println("  GET  /api/cosign/sessions/:id - Get co-signing session status")
+	fmt.Println("  POST /api/cosign/sessions/:id/sign - Submit cosigner signatures")
+	fmt.Println("  POST /api/multisig            - Create a shared m-of-n multisig address")
+	fmt.Println("  GET  /api/multisig            - List multisig addresses registered on this node")
+	fmt.Println("  GET  /api/attestation         - Signed chain state attestation")
+	fmt.Println("  GET  /api/tx/:txid            - Transaction with resolved inputs and fee, its block and confirmations, or in_mempool while pending")
+	fmt.Println("  POST /api/tx/testaccept       - Dry-run mempool acceptance of a raw transaction")
+	fmt.Println("  POST /api/tx/create           - Unsigned raw transaction and the signature hash of each input")
+	fmt.Println("  POST /api/tx/sign             - Attach offline signatures to a raw transaction")
+	fmt.Println("  POST /api/tx/broadcast        - Submit a signed raw transaction to the mempool and peers")
+	fmt.Println("  POST /api/tx/raw              - Same, the transaction as {\"hex\": \"...\"} or {\"base64\": \"...\"}")
+	fmt.Println("  GET  /api/mempool             - Pending txids, count, size and fee rate histogram")
+	fmt.Println("  GET  /api/mempool/:txid       - Pending transaction and its position in the mining queue")
+	fmt.Println("  GET  /api/mempool/conflicts/:txid - Mempool transactions spending the same outputs, and which one would be mined")
+	fmt.Println("  POST /api/mempool/conflicts   - Same for a raw transaction ({\"hex\": \"...\"})")
+	fmt.Println("  POST /api/block/submit        - Submit an externally mined block")
+	fmt.Println("  GET  /api/mining/template     - Block template for external miners (?longpollid= to wait for changes)")
+	fmt.Println("  GET  /api/mining/hashps       - Network hashrate from the last N blocks (?blocks=N, default 120) and the local miner's")
+	fmt.Println("  GET  /api/mining/status       - Whether the node mines, reward address, blocks mined and hashrate")
+	fmt.Println("  GET  /api/mining/stats        - Blocks mined, orphaned, reward earned, time per block and hashrate since start")
+	fmt.Println("  GET  /api/deployments         - Soft-fork deployments, their state and version bits signaling in the current window")
+	fmt.Println("  POST /api/mining/start        - Start mining without a restart ({\"address\": \"...\"}, default: the last one)")
+	fmt.Println("  POST /api/mining/stop         - Stop mining, abandoning the block being mined")
+	fmt.Println("  POST /api/mining/submit       - Submit a solved header of a template ({\"template_id\": \"...\", \"timestamp\": 0, \"nonce\": 0})")
+	fmt.Println("  GET  /api/peers               - Known peers with protocol statistics")
+	fmt.Println("  GET  /api/peers/ban           - Banned peers")
+	fmt.Println("  POST /api/peers/ban           - Ban a peer ({\"address\": \"host:port\", \"duration_seconds\": 0, \"reason\": \"...\"})")
+	fmt.Println("  POST /api/peers/unban         - Lift the ban of a peer ({\"address\": \"host:port\"})")
+	fmt.Println("  POST /api/confirmations       - Watch a transaction until it reaches N confirmations")
+	fmt.Println("  GET  /api/confirmations       - Confirmation events (included/confirmed/reverted, ?since=SEQ)")
+	fmt.Println("  GET  /api/confirmations/:txid - Confirmation status of a watched transaction")
+	fmt.Println("  GET  /api/memory              - Memory usage of the mempool and caches")
+	fmt.Println("  GET  /api/status              - Tip health, warns about a possibly stale tip (also as Prometheus /metrics)")
+	fmt.Println("  GET  /api/estimatefee         - Suggested fee per byte to be mined within ?blocks=N")
+	fmt.Println("  POST /api/jobs                - Start a background job (reindex, rescan, verifychain)")
+	fmt.Println("  POST /api/admin/backup        - Stream a consistent backup of the chain database")
+	fmt.Println("  GET  /api/jobs/:id            - Job progress and result (DELETE cancels it)")
+	fmt.Println("  GET  /api/cluster/:address    - Address cluster and tags (-analytics)")
+	fmt.Println("  POST /api/cluster/:address/tags - Tag an address (-analytics)")
+	fmt.Println("  GET  /api/admin/blacklist     - Txids/addresses the local miner will not include")
+	fmt.Println("  POST /api/admin/blacklist     - Blacklist a txid or address (DELETE to remove)")
+	fmt.Println("  GET  /api/replica             - Replica status (-follow)")
+	fmt.Println("  POST /api/replica/promote     - Promote a standby replica to serve wallet/mining duties")
+	fmt.Println("  GET  /api/channels            - Payment channels of this node (-channels)")
+	fmt.Println("  POST /api/channels            - Open a channel as payer, returns the proposal for the payee")
+	fmt.Println("  POST /api/channels/accept     - Accept a proposal as payee, returns the refund signature")
+	fmt.Println("  POST /api/channels/:id/fund   - Add the payee refund signature and broadcast the funding")
+	fmt.Println("  POST /api/channels/:id/pay    - Sign a balance update for the payee")
+	fmt.Println("  POST /api/channels/:id/update - Store a balance update received from the payer")
+	fmt.Println("  POST /api/channels/:id/close  - Close with the latest balance (payee) or the refund after the timeout (payer)")
+	fmt.Println("  GET  /ws                      - WebSocket pushing newblock, newtx and addresstx:ADDRESS events ({\"subscribe\": [...]} or ?subscribe=)")
+	fmt.Println("  POST /graphql                 - GraphQL queries over blocks, transactions, addresses and the mempool (GET without a query: schema)")
+	fmt.Println("  POST /rpc                     - Bitcoin Core JSON-RPC: getblockcount, getblockhash, getblock, getrawtransaction, sendrawtransaction, getbalance")
 }
 
 // createWallet creates a new wallet
-func createWallet() {
+// With hd, the address is derived from the wallet seed (created on first use)
+func createWallet(hd bool) {
 	wallets, err := blockchain.NewWallets()
 	if err != nil {
 		log.Printf("Warning: Could not load existing wallets: %v", err)
 		wallets = &blockchain.Wallets{Wallets: make(map[string]*blockchain.Wallet)}
 	}
 
-	address := wallets.AddWallet()
+	var address string
+	if hd {
+		if !wallets.IsHD() {
+			if err := wallets.InitHD(nil); err != nil {
+				log.Panic(err)
+			}
+			fmt.Printf("New HD seed (back it up, it restores every derived address): %x\n", wallets.HDSeed)
+		}
+
+		address, err = wallets.AddHDWallet()
+		if err != nil {
+			log.Panic(err)
+		}
+	} else {
+		address = wallets.AddWallet()
+	}
 	wallets.SaveFile()
 
 	fmt.Printf("New address is: %s\n", address)
+	if path := wallets.Wallets[address].Path; path != "" {
+		fmt.Printf("Derivation path: %s\n", path)
+	}
+}
+
+// restoreWallet regenerates the first count HD addresses from a seed
+func restoreWallet(seedHex string, count int) {
+	seed, err := hex.DecodeString(seedHex)
+	if err != nil {
+		log.Panic("Seed must be hex encoded")
+	}
+
+	wallets, err := blockchain.NewWallets()
+	if err != nil {
+		wallets = &blockchain.Wallets{Wallets: make(map[string]*blockchain.Wallet)}
+	}
+
+	addresses, err := wallets.RestoreHD(seed, count)
+	if err != nil {
+		log.Panic(err)
+	}
+	wallets.SaveFile()
+
+	for _, address := range addresses {
+		fmt.Printf("%s  %s\n", address, wallets.Wallets[address].Path)
+	}
 }
 
 // listAddresses lists all addresses in the wallets
-func listAddresses() {
+// With verbose, the label, note and creation time of each address are shown
+func listAddresses(verbose bool) {
 	wallets, err := blockchain.NewWallets()
 	if err != nil {
 		log.Printf("Error loading wallets: %v", err)
@@ -66,67 +248,709 @@ func listAddresses() {
 		return
 	}
 
+	sort.Strings(addresses)
 	for _, address := range addresses {
-		fmt.Println(address)
+		wallet := wallets.Wallets[address]
+
+		line := address
+		if wallet.Path != "" {
+			line += "  " + wallet.Path
+		}
+		if wallet.Label != "" {
+			line += fmt.Sprintf("  [%s]", wallet.Label)
+		}
+		fmt.Println(line)
+
+		if verbose {
+			if wallet.CreatedAt != 0 {
+				fmt.Printf("    Created: %s\n", time.Unix(wallet.CreatedAt, 0).Format(time.RFC3339))
+			}
+			if wallet.Note != "" {
+				fmt.Printf("    Note:    %s\n", wallet.Note)
+			}
+		}
 	}
 }
 
-// createBlockchain creates a new blockchain (for initial setup only)
-func createBlockchain(address string) {
-	if !blockchain.ValidateAddress(address) {
-		log.Panic("Address is not valid")
+// setLabel sets the label and note of a wallet address
+func setLabel(address, label, note string) {
+	wallets, err := blockchain.NewWallets()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if err := wallets.SetLabel(address, label, note); err != nil {
+		log.Panic(err)
+	}
+	wallets.SaveFile()
+
+	fmt.Printf("Label of %s set to %q\n", address, label)
+}
+
+// convertAddress prints an address in both encodings
+func convertAddress(address string) {
+	base58, err := blockchain.ToBase58Address(address)
+	if err != nil {
+		log.Panic(err)
+	}
+	bech32, err := blockchain.ToBech32Address(address)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("Base58: %s\n", base58)
+	fmt.Printf("Bech32: %s\n", bech32)
+}
+
+// migrateDB converts the database to another schema version
+func migrateDB(target int) {
+	applied, err := blockchain.MigrateDB(target)
+	for _, step := range applied {
+		fmt.Printf("Applied %s\n", step)
+	}
+	if err != nil {
+		fmt.Printf("Migration failed: %v\n", err)
+		os.Exit(1)
 	}
-	chain := blockchain.InitBlockchain(address)
-	defer chain.Database.Close()
 
-	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
-	UTXOSet.Reindex()
+	fmt.Printf("Database is at schema v%d\n", target)
+}
 
+// serveSigner answers one external signer request on stdin/stdout with a
+// wallet key, the reference implementation of the external signer protocol
+// Run it from a keystore directory that the node itself cannot read
+func serveSigner(address, dir string) {
+	if dir != "" {
+		if err := os.Chdir(dir); err != nil {
+			log.Panic(err)
+		}
+	}
+
+	wallets, err := blockchain.NewWallets()
+	if err != nil {
+		log.Panic(err)
+	}
+	base58, err := blockchain.ToBase58Address(address)
+	if err != nil {
+		log.Panic(err)
+	}
+	wallet, ok := wallets.Wallets[base58]
+	if !ok {
+		log.Panicf("Address %s is not in the wallet", address)
+	}
+
+	if err := blockchain.ServeSigner(wallet.Signer(), os.Stdin, os.Stdout); err != nil {
+		log.Panic(err)
+	}
+}
+
+// sendMany asks the node at nodeURL to pay the recipients listed in
+// outputsJSON ([{"address": "...", "amount": N}, ...], "-" reads stdin)
+// from one of its wallets in a single transaction
+func sendMany(nodeURL, from, outputsJSON string, fee int, coinSelection, token string) {
+	data := []byte(outputsJSON)
+	if outputsJSON == "-" {
+		var err error
+		if data, err = io.ReadAll(os.Stdin); err != nil {
+			log.Panic(err)
+		}
+	}
+
+	var outputs []api.RecipientRequest
+	if err := json.Unmarshal(data, &outputs); err != nil {
+		log.Panicf("Invalid outputs JSON: %v", err)
+	}
+
+	c := client.New(nodeURL)
+	if passphrase := os.Getenv("BLOCKCHAIN_SPEND_PASSPHRASE"); passphrase != "" {
+		c.Header.Set(api.SpendPassphraseHeader, passphrase)
+	}
+	if token != "" {
+		c.Header.Set(api.SpendTokenHeader, token)
+	}
+
+	resp, err := c.Send(api.SendRequest{From: from, Outputs: outputs, Fee: fee, CoinSelection: coinSelection})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("Sent %d outputs in transaction %s\n", len(outputs), resp.TxID)
+}
+
+// runMonitor watches nodes until interrupted, logging alerts
+func runMonitor(cfg monitor.Config) {
+	m, err := monitor.New(cfg)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("Monitoring %d nodes every %s\n", len(cfg.Nodes), cfg.Interval)
+
+	m.Run(nil)
+}
+
+// runWatch follows payments to an address until interrupted
+func runWatch(cfg watch.Config) {
+	w, err := watch.New(cfg)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("Watching %s on %s, confirmed after %d confirmations\n", cfg.Address, cfg.Node, cfg.MinConf)
+
+	w.Run(nil)
+}
+
+// createBlockchain creates a new blockchain from the fixed genesis block of
+// a built-in network or of the private network of a genesis.json
+func createBlockchain(params *blockchain.ChainParams) {
+	chain := blockchain.InitBlockchain(params)
+	defer chain.Database.Close()
+
+	for _, alloc := range chain.Params.Genesis.Alloc {
+		fmt.Printf("  Premine: %d to %s\n", alloc.Value, alloc.Address)
+	}
 	fmt.Println("Blockchain created successfully!")
 }
 
+// loadGenesisFile returns the parameters of the network of a genesis.json and
+// makes it the network of the process, exiting when the file is invalid
+func loadGenesisFile(path string) *blockchain.ChainParams {
+	params, err := blockchain.LoadGenesisFile(path)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	blockchain.UseParams(params) // Selects the data directory of the network
+	return params
+}
+
+// nodeOptions holds the optional startnode settings
+type nodeOptions struct {
+	faucet         *api.Faucet
+	maxOutbound    int
+	maxInbound     int
+	nat            string // Port mapping method, "" = disabled
+	proxy          string // SOCKS5 proxy HOST:PORT, "" = direct
+	discoverLAN    bool   // Multicast discovery on the local network
+	maxConnsPerIP  int    // 0 = unlimited
+	messageRate    float64
+	maxMessageSize int // Bytes, 0 = unlimited
+	policy         network.PeerPolicy
+	rotateInterval time.Duration
+	banThreshold   int           // Ban score at which a peer is banned, 0 = never
+	banDuration    time.Duration // Length of automatic bans
+	maxMemory      int64         // Bytes, 0 = unlimited
+	maxMempool     int64         // Bytes, 0 = unlimited
+	analytics      bool
+	channels       bool
+	public         bool          // Read-only public API profile
+	apiAuth        string        // API keys and JWT file, empty = open API
+	finalityDepth  int           // 0 disables the rolling checkpoint
+	prune          int           // Blocks whose full data is kept, 0 = no pruning
+	addrIndex      bool          // Maintain the address history index
+	maturity       int           // Coinbase maturity of the wallet, 0 = rewards spendable at once
+	freshChange    bool          // Change goes to a new wallet address
+	follow         string        // Primary followed in replica mode
+	failover       time.Duration // 0 = manual promotion only
+	signer         string        // External signer command
+	record         string        // Recording file of the handled P2P messages
+	throttle       blockchain.MiningThrottle
+	coinbaseMsg    string // Embedded in the coinbase of mined blocks
+	coinSelector   blockchain.CoinSelector
+	genesis        *blockchain.ChainParams // Private network (-genesis), nil = BLOCKCHAIN_NETWORK
+}
+
+// stringList is a repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// loadConfigFile sets the flags of fs from a file of name=value lines, a bare
+// name sets a boolean flag; flags set on the command line are kept, list
+// flags get the values of both
+func loadConfigFile(fs *flag.FlagSet, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		name, value, found := strings.Cut(text, "=")
+		name = strings.TrimPrefix(strings.TrimSpace(name), "-")
+		value = strings.TrimSpace(value)
+		if !found {
+			value = "true"
+		}
+
+		f := fs.Lookup(name)
+		if f == nil || name == "conf" {
+			return fmt.Errorf("%s:%d: unknown option %q", path, line, name)
+		}
+		if _, list := f.Value.(*stringList); set[name] && !list {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// peerPolicy builds the peer policy of the -addpeer, -connect-only and -banip
+// options
+func peerPolicy(pinned, denied []string, connectOnly bool) (network.PeerPolicy, error) {
+	policy := network.PeerPolicy{ConnectOnly: connectOnly}
+	for _, addr := range pinned {
+		if err := network.ValidatePinnedPeer(addr); err != nil {
+			return policy, err
+		}
+		if !policy.IsPinned(addr) {
+			policy.Pinned = append(policy.Pinned, addr)
+		}
+	}
+	for _, ip := range denied {
+		ipnet, err := network.ParseIPRange(ip)
+		if err != nil {
+			return policy, err
+		}
+		policy.Denied = append(policy.Denied, ipnet)
+	}
+	if connectOnly && len(policy.Pinned) == 0 {
+		return policy, fmt.Errorf("-connect-only needs at least one -addpeer")
+	}
+	return policy, nil
+}
+
 // startNode starts a network node
-func startNode(minerAddress, nodeAddress string) {
+func startNode(minerAddress, nodeAddress string, opts nodeOptions) {
 	fmt.Printf("Starting node %s\n", nodeAddress)
 
 	if len(minerAddress) > 0 {
-		if blockchain.ValidateAddress(minerAddress) {
-			fmt.Printf("Mining enabled. Rewards will go to %s\n", minerAddress)
-		} else {
-			log.Panic("Wrong miner address!")
+		if _, err := blockchain.ParseRewardSplit(minerAddress); err != nil {
+			log.Panicf("Wrong miner address: %v", err)
 		}
+		fmt.Printf("Mining enabled. Rewards will go to %s\n", minerAddress)
 	}
 
 	// Check if blockchain exists
 	var chain *blockchain.Blockchain
 	if !blockchain.DBexists() {
-		fmt.Println("No blockchain found. Node will sync from network peers.")
-		fmt.Println("For now, create blockchain first using 'createblockchain' command.")
-		os.Exit(1)
+		// Every node shares the fixed genesis block, the rest is synced from peers
+		fmt.Println("No blockchain found. Starting from the genesis block, the node will sync from network peers.")
+		params := blockchain.Params()
+		if opts.genesis != nil {
+			params = opts.genesis
+		}
+		chain = blockchain.InitBlockchain(params)
+	} else {
+		chain = blockchain.ContinueBlockchain(minerAddress)
+		if opts.genesis != nil && chain.Params.Name != opts.genesis.Name {
+			fmt.Printf("❌ The blockchain in %s belongs to network %s, not %s\n", blockchain.DataDir(), chain.Params.Name, opts.genesis.Name)
+			os.Exit(1)
+		}
 	}
-
-	chain = blockchain.ContinueBlockchain(minerAddress)
 	defer chain.Database.Close()
+	chain.FinalityDepth = opts.finalityDepth
+	chain.CoinbaseMaturity = opts.maturity
+
+	// Built from the full blocks, so before pruning them
+	if opts.addrIndex {
+		if err := chain.EnableAddrIndex(); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Address index enabled")
+	}
+
+	// A pruned chain cannot rebuild its UTXO set from the blocks anymore
+	switch {
+	case opts.prune > 0 && opts.follow != "":
+		fmt.Println("❌ -prune cannot be used with -follow: replicas apply the UTXO set changes of their primary")
+		os.Exit(1)
+	case opts.prune > 0:
+		if err := chain.EnablePruning(opts.prune); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Pruning enabled: the full data of the last %d blocks is kept\n", opts.prune)
+	case chain.PrunedHeight() >= 0:
+		fmt.Printf("❌ The blockchain in %s is pruned up to height %d, start the node with -prune\n", blockchain.DataDir(), chain.PrunedHeight())
+		os.Exit(1)
+	}
 
 	// Load wallets for API
 	wallets, err := blockchain.NewWallets()
 	if err != nil {
 		log.Printf("Warning: Could not load wallets: %v", err)
-		wallets = &blockchain.Wallets{Wallets: make(map[string]*blockchain.Wallet)}
+		wallets = &blockchain.Wallets{Wallets: make(map[string]*blockchain.Wallet), Frozen: blockchain.NewFrozenOutputs()}
+	}
+	chain.Frozen = wallets.Frozen // Coin selection skips outputs frozen in the wallet
+	wallets.FreshChange = opts.freshChange
+	chain.CoinSelector = opts.coinSelector
+
+	server := network.NewServer(nodeAddress, network.SeedNodes(), chain, wallets)
+	server.MaxOutbound = opts.maxOutbound
+	server.MaxInbound = opts.maxInbound
+	server.NAT = opts.nat
+	server.Proxy = opts.proxy
+	server.DiscoverLAN = opts.discoverLAN
+	server.Limits.MaxConnsPerIP = opts.maxConnsPerIP
+	server.Limits.MessageRate = opts.messageRate
+	server.MaxMessageSize = opts.maxMessageSize
+	server.Policy = &opts.policy
+	server.RotationInterval = opts.rotateInterval
+	server.Bans.Threshold = opts.banThreshold
+	server.Bans.Duration = opts.banDuration
+	server.Memory.SetLimit(opts.maxMemory)
+	server.MaxMempool = opts.maxMempool
+	server.CoinbaseMessage = opts.coinbaseMsg
+
+	spendAuth, err := api.NewSpendAuthFromEnv()
+	if err != nil {
+		log.Panic(err)
+	}
+	if spendAuth != nil {
+		server.APIServer.EnableSpendAuth(spendAuth)
+	}
+
+	if opts.analytics {
+		server.APIServer.EnableAnalytics(analytics.NewClusterIndex())
 	}
 
-	server := network.NewServer(nodeAddress, chain, wallets)
+	if opts.public {
+		server.APIServer.EnablePublicProfile()
+	}
+
+	if opts.apiAuth != "" {
+		apiAuth, err := api.LoadAPIAuth(opts.apiAuth)
+		if err != nil {
+			log.Panic(err)
+		}
+		server.APIServer.EnableAPIAuth(apiAuth)
+	}
+
+	if opts.channels {
+		server.APIServer.EnableChannels()
+	}
+
+	if opts.signer != "" {
+		signer, err := blockchain.NewExternalSigner(opts.signer)
+		if err != nil {
+			log.Panic(err)
+		}
+		server.APIServer.EnableExternalSigner(signer.Address(), signer)
+	}
+
+	if opts.faucet != nil {
+		if err := server.APIServer.EnableFaucet(opts.faucet); err != nil {
+			log.Panic(err)
+		}
+	}
+
+	if opts.record != "" {
+		if err := server.EnableRecording(opts.record); err != nil {
+			log.Panic(err)
+		}
+	}
+
+	if opts.follow != "" {
+		server.EnableReplica(opts.follow, opts.failover)
+	}
+
+	if key := os.Getenv("BLOCKCHAIN_REPLICA_KEY"); key != "" {
+		if err := server.EnableDeltaFeed([]byte(key)); err != nil {
+			log.Panic(err)
+		}
+	}
 
 	if len(minerAddress) > 0 {
+		if err := blockchain.SetMiningThrottle(opts.throttle); err != nil {
+			log.Panic(err)
+		}
+		if opts.throttle.Throttled() || opts.throttle.LowPriority {
+			fmt.Printf("Mining throttled: %d%% CPU, max %.0f H/s (0 = uncapped), low priority %v\n",
+				opts.throttle.CPUPercent, opts.throttle.MaxHashRate, opts.throttle.LowPriority)
+		}
 		server.StartMining(minerAddress)
 	}
 
+	// Known peers survive restarts
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-shutdown
+		log.Printf("Received %s, shutting down", sig)
+		server.Shutdown()
+		os.Exit(0)
+	}()
+
 	// Start server (blocking)
 	if err := server.Start(); err != nil {
 		log.Panic(err)
 	}
 }
 
+// replay feeds a recording into a fresh node, reproducing the state the
+// recording node reached (e.g. to debug a rejected block or a failed sync)
+func replay(path string, realtime bool) {
+	if blockchain.DBexists() {
+		fmt.Println("A blockchain already exists: replay into an empty data directory (BLOCKCHAIN_DATA_DIR)")
+		os.Exit(1)
+	}
+
+	rec, err := network.OpenRecording(path)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer rec.Close()
+
+	chain, err := rec.InitBlockchain()
+	if err != nil {
+		fmt.Printf("Replay failed: %v\n", err)
+		os.Exit(1)
+	}
+	defer chain.Database.Close()
+
+	wallets := &blockchain.Wallets{Wallets: make(map[string]*blockchain.Wallet), Frozen: blockchain.NewFrozenOutputs()}
+	server := network.NewServer(rec.Header.Node, nil, chain, wallets)
+
+	result, err := server.Replay(rec, realtime)
+	if err != nil {
+		fmt.Printf("Replay stopped: %v\n", err)
+	}
+
+	fmt.Printf("Replayed %d messages recorded by %s\n", result.Messages, rec.Header.Node)
+	commands := make([]string, 0, len(result.Commands))
+	for command := range result.Commands {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	for _, command := range commands {
+		fmt.Printf("  %-10s %d\n", command, result.Commands[command])
+	}
+	fmt.Printf("Height: %d -> %d\n", result.StartHeight, result.Height)
+	fmt.Printf("Tip: %s\n", result.Tip)
+	fmt.Printf("Mempool: %d transactions\n", result.MempoolTxs)
+}
+
+// exportChain writes the main chain to a bootstrap file
+func exportChain(path string) {
+	chain := blockchain.ContinueBlockchain("")
+	defer chain.Database.Close()
+
+	file, err := os.Create(path)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	header, err := chain.ExportSnapshot(file, chainProgress("Exported"))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		fmt.Printf("❌ Export failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Exported %d blocks of %s up to %x to %s\n", header.Height+1, header.Network, header.Tip, path)
+}
+
+// importChain bootstraps the chain from a bootstrap file, creating it from
+// the network genesis block (or a private network's genesis.json) when missing
+func importChain(path string, genesis *blockchain.ChainParams) {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer file.Close()
+
+	snap, err := blockchain.OpenSnapshot(file)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+
+	var chain *blockchain.Blockchain
+	if blockchain.DBexists() {
+		chain = blockchain.ContinueBlockchain("")
+	} else {
+		params := blockchain.Params()
+		if genesis != nil {
+			params = genesis
+		}
+		if snap.Header.Network != params.Name {
+			fmt.Printf("❌ The snapshot belongs to network %s, not %s (set BLOCKCHAIN_NETWORK or -genesis)\n", snap.Header.Network, params.Name)
+			os.Exit(1)
+		}
+		chain = blockchain.InitBlockchain(params)
+	}
+	defer chain.Database.Close()
+
+	result, err := chain.ImportSnapshot(snap, chainProgress("Read"))
+	fmt.Printf("Stored %d blocks, %d already known\n", result.Imported, result.Known)
+	if err != nil {
+		fmt.Printf("❌ Import failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	if result.Switched {
+		fmt.Printf("Chain imported, height %d\n", result.Height)
+	} else {
+		fmt.Printf("The chain already has as much work as the snapshot, height %d\n", result.Height)
+	}
+}
+
+// generateAPIKey prints a new API key and the entry listing it in an
+// -api-auth file, which keeps the SHA-256 of the key only
+func generateAPIKey(name, roleName string) {
+	role, err := api.ParseRole(roleName)
+	if err != nil {
+		log.Panic(err)
+	}
+	key, hash, err := api.GenerateAPIKey()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	entry, err := json.MarshalIndent(api.APIKeyConfig{Name: name, Role: role.String(), KeySHA256: hash}, "    ", "  ")
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("API key: %s\n", key)
+	fmt.Println("Add to the \"keys\" of the -api-auth file:")
+	fmt.Printf("    %s\n", entry)
+}
+
+// issueAPIToken prints a JWT signed with the jwt_secret of an -api-auth file
+func issueAPIToken(authFile, subject, roleName string, ttl time.Duration) {
+	role, err := api.ParseRole(roleName)
+	if err != nil {
+		log.Panic(err)
+	}
+	auth, err := api.LoadAPIAuth(authFile)
+	if err != nil {
+		log.Panic(err)
+	}
+	token, err := auth.IssueToken(subject, role, ttl)
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Println(token)
+}
+
+// backupChain downloads a backup of the chain database of the running node
+// at nodeURL to path, checking it is complete before keeping it
+func backupChain(nodeURL, path, token string) {
+	c := client.New(nodeURL)
+	c.HTTPClient.Timeout = 0 // Large databases take a while
+	if passphrase := os.Getenv("BLOCKCHAIN_SPEND_PASSPHRASE"); passphrase != "" {
+		c.Header.Set(api.SpendPassphraseHeader, passphrase)
+	}
+	if token != "" {
+		c.Header.Set(api.SpendTokenHeader, token)
+	}
+
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		log.Panic(err)
+	}
+	size, err := c.Backup(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	var header blockchain.BackupHeader
+	records := 0
+	if err == nil {
+		header, records, err = verifyBackup(tmpPath)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		fmt.Printf("❌ Backup failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Backed up %d records of %s at height %d (%x) to %s, %d bytes\n", records, header.Network, header.Height, header.Tip, path, size)
+}
+
+// verifyBackup reads a whole backup file
+func verifyBackup(path string) (blockchain.BackupHeader, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return blockchain.BackupHeader{}, 0, err
+	}
+	defer file.Close()
+
+	backup, err := blockchain.OpenBackup(file)
+	if err != nil {
+		return blockchain.BackupHeader{}, 0, err
+	}
+	records, err := backup.Verify()
+	return backup.Header, records, err
+}
+
+// restoreChain creates the chain database of the current network from a
+// backup file
+func restoreChain(path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer file.Close()
+
+	backup, err := blockchain.OpenBackup(file)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	if network := blockchain.Params().Name; backup.Header.Network != network {
+		fmt.Printf("❌ The backup belongs to network %s, not %s (set BLOCKCHAIN_NETWORK or -genesis)\n", backup.Header.Network, network)
+		os.Exit(1)
+	}
+
+	records, err := blockchain.RestoreBackup(backup)
+	if err != nil {
+		fmt.Printf("❌ Restore failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Restored %d records of %s at height %d (%x) to %s\n", records, backup.Header.Network, backup.Header.Height, backup.Header.Tip, blockchain.DataDir())
+}
+
+// chainProgress prints the progress of a chain export or import every 1000 blocks
+func chainProgress(verb string) func(done, total int) {
+	return func(done, total int) {
+		if done%1000 == 0 || done == total {
+			fmt.Printf("  %s %d/%d blocks\n", verb, done, total)
+		}
+	}
+}
+
 func main() {
 	defer os.Exit(0)
 
@@ -137,38 +961,419 @@ func main() {
 
 	switch os.Args[1] {
 	case "createwallet":
-		createWallet()
+		createWalletCmd := flag.NewFlagSet("createwallet", flag.ExitOnError)
+		createWalletHD := createWalletCmd.Bool("hd", false, "Derive the address from the HD wallet seed")
+
+		err := createWalletCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		createWallet(*createWalletHD)
+
+	case "restorewallet":
+		restoreWalletCmd := flag.NewFlagSet("restorewallet", flag.ExitOnError)
+		restoreWalletSeed := restoreWalletCmd.String("seed", "", "Hex encoded HD wallet seed")
+		restoreWalletCount := restoreWalletCmd.Int("count", 20, "Number of addresses to regenerate")
+
+		err := restoreWalletCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+
+		if *restoreWalletSeed == "" {
+			restoreWalletCmd.Usage()
+			os.Exit(1)
+		}
+		restoreWallet(*restoreWalletSeed, *restoreWalletCount)
 
 	case "listaddresses":
-		listAddresses()
+		listAddressesCmd := flag.NewFlagSet("listaddresses", flag.ExitOnError)
+		listAddressesVerbose := listAddressesCmd.Bool("verbose", false, "Show labels, notes and creation time")
+
+		err := listAddressesCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		listAddresses(*listAddressesVerbose)
+
+	case "setlabel":
+		setLabelCmd := flag.NewFlagSet("setlabel", flag.ExitOnError)
+		setLabelAddress := setLabelCmd.String("address", "", "Wallet address to label")
+		setLabelLabel := setLabelCmd.String("label", "", "Label of the address (empty clears it)")
+		setLabelNote := setLabelCmd.String("note", "", "Free-form note about the address")
+
+		err := setLabelCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+
+		if *setLabelAddress == "" {
+			setLabelCmd.Usage()
+			os.Exit(1)
+		}
+		setLabel(*setLabelAddress, *setLabelLabel, *setLabelNote)
+
+	case "convertaddress":
+		convertAddressCmd := flag.NewFlagSet("convertaddress", flag.ExitOnError)
+		convertAddressAddress := convertAddressCmd.String("address", "", "Base58 or bech32 address to convert")
+
+		err := convertAddressCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+
+		if *convertAddressAddress == "" {
+			convertAddressCmd.Usage()
+			os.Exit(1)
+		}
+		convertAddress(*convertAddressAddress)
+
+	case "signer":
+		signerCmd := flag.NewFlagSet("signer", flag.ExitOnError)
+		signerAddress := signerCmd.String("address", "", "Wallet address whose key signs")
+		signerDir := signerCmd.String("dir", "", "Directory holding the tmp/ keystore (default: current directory)")
+
+		err := signerCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+
+		if *signerAddress == "" {
+			signerCmd.Usage()
+			os.Exit(1)
+		}
+		serveSigner(*signerAddress, *signerDir)
+
+	case "sendmany":
+		sendManyCmd := flag.NewFlagSet("sendmany", flag.ExitOnError)
+		sendManyFrom := sendManyCmd.String("from", "", "Wallet address of the node paying")
+		sendManyOutputs := sendManyCmd.String("outputs", "", "JSON list of {\"address\", \"amount\"} recipients, - reads stdin")
+		sendManyFee := sendManyCmd.Int("fee", 0, "Fee left unspent on top of the payments")
+		sendManyNode := sendManyCmd.String("node", "http://localhost:4000", "HTTP API of the node holding the wallet")
+		sendManyToken := sendManyCmd.String("token", "", "TOTP code when the node requires one to spend")
+		sendManyCoinSelect := sendManyCmd.String("coinselect", "", "Coin selection strategy (default: the node setting)")
+
+		err := sendManyCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+
+		if *sendManyFrom == "" || *sendManyOutputs == "" {
+			sendManyCmd.Usage()
+			os.Exit(1)
+		}
+		sendMany(*sendManyNode, *sendManyFrom, *sendManyOutputs, *sendManyFee, *sendManyCoinSelect, *sendManyToken)
+
+	case "monitor":
+		monitorCmd := flag.NewFlagSet("monitor", flag.ExitOnError)
+		monitorNodes := monitorCmd.String("nodes", "", "Comma-separated HTTP API URLs of the nodes to watch")
+		monitorInterval := monitorCmd.Duration("interval", monitor.DefaultInterval, "Interval between checks")
+		monitorStall := monitorCmd.Duration("stall", monitor.DefaultStallAfter, "Alert when a tip has not changed for this long")
+		monitorMaxLag := monitorCmd.Int("maxlag", monitor.DefaultMaxLag, "Alert when a node trails the highest tip by more blocks")
+		monitorWebhook := monitorCmd.String("webhook", "", "URL receiving each alert as a JSON POST")
+
+		err := monitorCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+
+		if *monitorNodes == "" {
+			monitorCmd.Usage()
+			os.Exit(1)
+		}
+		runMonitor(monitor.Config{
+			Nodes:      strings.Split(*monitorNodes, ","),
+			Interval:   *monitorInterval,
+			StallAfter: *monitorStall,
+			MaxLag:     *monitorMaxLag,
+			WebhookURL: *monitorWebhook,
+		})
+
+	case "watch":
+		watchCmd := flag.NewFlagSet("watch", flag.ExitOnError)
+		watchAddress := watchCmd.String("address", "", "The address to watch")
+		watchMinConf := watchCmd.Int("minconf", watch.DefaultMinConf, "Confirmations after which a payment is reported as confirmed")
+		watchNode := watchCmd.String("node", "http://localhost:4000", "HTTP API URL of the node")
+		watchInterval := watchCmd.Duration("interval", watch.DefaultInterval, "Interval between checks")
+
+		err := watchCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+
+		if *watchAddress == "" {
+			watchCmd.Usage()
+			os.Exit(1)
+		}
+		runWatch(watch.Config{
+			Node:     *watchNode,
+			Address:  *watchAddress,
+			MinConf:  *watchMinConf,
+			Interval: *watchInterval,
+		})
 
 	case "createblockchain":
 		createBlockchainCmd := flag.NewFlagSet("createblockchain", flag.ExitOnError)
-		createBlockchainAddress := createBlockchainCmd.String("address", "", "The address to send genesis block reward to")
+		createBlockchainAddress := createBlockchainCmd.String("address", "", "Ignored: the genesis block is fixed per network and its reward unspendable")
+		createBlockchainGenesis := createBlockchainCmd.String("genesis", "", "genesis.json of a private network (premine, difficulty, subsidy schedule)")
 
 		err := createBlockchainCmd.Parse(os.Args[2:])
 		if err != nil {
 			log.Panic(err)
 		}
 
-		if *createBlockchainAddress == "" {
-			createBlockchainCmd.Usage()
+		if *createBlockchainAddress != "" {
+			fmt.Println("Note: -address is ignored, the genesis block is fixed per network")
+		}
+		params := blockchain.Params()
+		if *createBlockchainGenesis != "" {
+			params = loadGenesisFile(*createBlockchainGenesis)
+		}
+		createBlockchain(params)
+
+	case "migratedb":
+		migrateDBCmd := flag.NewFlagSet("migratedb", flag.ExitOnError)
+		migrateDBTo := migrateDBCmd.Int("to", blockchain.DBSchemaVersion, "Target database schema version")
+
+		err := migrateDBCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		migrateDB(*migrateDBTo)
+
+	case "replay":
+		replayCmd := flag.NewFlagSet("replay", flag.ExitOnError)
+		replayFile := replayCmd.String("file", "", "Recording written by startnode -record")
+		replayRealtime := replayCmd.Bool("realtime", false, "Keep the recorded delays between messages")
+
+		err := replayCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if *replayFile == "" {
+			replayCmd.Usage()
 			os.Exit(1)
 		}
-		createBlockchain(*createBlockchainAddress)
+		replay(*replayFile, *replayRealtime)
+
+	case "exportchain":
+		exportChainCmd := flag.NewFlagSet("exportchain", flag.ExitOnError)
+		exportChainFile := exportChainCmd.String("file", "", "Bootstrap file to write")
+
+		err := exportChainCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if *exportChainFile == "" {
+			exportChainCmd.Usage()
+			os.Exit(1)
+		}
+		exportChain(*exportChainFile)
+
+	case "importchain":
+		importChainCmd := flag.NewFlagSet("importchain", flag.ExitOnError)
+		importChainFile := importChainCmd.String("file", "", "Bootstrap file written by exportchain")
+		importChainGenesis := importChainCmd.String("genesis", "", "genesis.json of the private network (used to create the chain)")
+
+		err := importChainCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if *importChainFile == "" {
+			importChainCmd.Usage()
+			os.Exit(1)
+		}
+		var genesis *blockchain.ChainParams
+		if *importChainGenesis != "" {
+			genesis = loadGenesisFile(*importChainGenesis)
+		}
+		importChain(*importChainFile, genesis)
+
+	case "backup":
+		backupCmd := flag.NewFlagSet("backup", flag.ExitOnError)
+		backupOut := backupCmd.String("out", "", "Backup file to write")
+		backupNode := backupCmd.String("node", "http://localhost:4000", "HTTP API of the running node")
+		backupToken := backupCmd.String("token", "", "TOTP code when the node requires one for admin requests")
+
+		err := backupCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if *backupOut == "" {
+			backupCmd.Usage()
+			os.Exit(1)
+		}
+		backupChain(*backupNode, *backupOut, *backupToken)
+
+	case "apikey":
+		apiKeyCmd := flag.NewFlagSet("apikey", flag.ExitOnError)
+		apiKeyName := apiKeyCmd.String("name", "", "Name of the key holder, shown in the node log")
+		apiKeyRole := apiKeyCmd.String("role", "read", "Role of the key: read, wallet or admin")
+
+		err := apiKeyCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if *apiKeyName == "" {
+			apiKeyCmd.Usage()
+			os.Exit(1)
+		}
+		generateAPIKey(*apiKeyName, *apiKeyRole)
+
+	case "apitoken":
+		apiTokenCmd := flag.NewFlagSet("apitoken", flag.ExitOnError)
+		apiTokenAuth := apiTokenCmd.String("auth", "", "-api-auth file holding the jwt_secret")
+		apiTokenSubject := apiTokenCmd.String("subject", "", "Subject (sub claim) of the token, shown in the node log")
+		apiTokenRole := apiTokenCmd.String("role", "read", "Role of the token: read, wallet or admin")
+		apiTokenTTL := apiTokenCmd.Duration("ttl", 24*time.Hour, "Lifetime of the token")
+
+		err := apiTokenCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if *apiTokenAuth == "" || *apiTokenSubject == "" {
+			apiTokenCmd.Usage()
+			os.Exit(1)
+		}
+		issueAPIToken(*apiTokenAuth, *apiTokenSubject, *apiTokenRole, *apiTokenTTL)
+
+	case "restore":
+		restoreCmd := flag.NewFlagSet("restore", flag.ExitOnError)
+		restoreIn := restoreCmd.String("in", "", "Backup file written by backup")
+		restoreGenesis := restoreCmd.String("genesis", "", "genesis.json of the private network the backup belongs to")
+
+		err := restoreCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if *restoreIn == "" {
+			restoreCmd.Usage()
+			os.Exit(1)
+		}
+		if *restoreGenesis != "" {
+			loadGenesisFile(*restoreGenesis)
+		}
+		restoreChain(*restoreIn)
 
 	case "startnode":
 		startNodeCmd := flag.NewFlagSet("startnode", flag.ExitOnError)
-		startNodeMiner := startNodeCmd.String("miner", "", "Enable mining mode and send reward to ADDRESS")
-		startNodePort := startNodeCmd.String("port", "3000", "Port to listen on")
+		startNodeMiner := startNodeCmd.String("miner", "", "Enable mining mode and send reward to ADDRESS (or ADDR1:60,ADDR2:40 to split it)")
+		startNodePort := startNodeCmd.String("port", strconv.Itoa(blockchain.Params().DefaultPort), "Port to listen on")
+		startNodeMaxOutbound := startNodeCmd.Int("maxoutbound", network.DefaultMaxOutbound, "Maximum number of outbound peers")
+		startNodeMaxInbound := startNodeCmd.Int("maxinbound", network.DefaultMaxInbound, "Maximum number of inbound peers, the least useful is evicted for a new one (0 = unlimited)")
+		startNodeNAT := startNodeCmd.String("nat", "", "Forward the P2P port on the router and advertise its external address: "+strings.Join(network.NATMethods(), ", "))
+		startNodeProxy := startNodeCmd.String("proxy", "", "Dial peers through the SOCKS5 proxy HOST:PORT, e.g. Tor, without advertising our address")
+		startNodeDiscoverLAN := startNodeCmd.Bool("discover-lan", false, "Find nodes on the local network by multicast")
+		startNodeMaxConnsPerIP := startNodeCmd.Int("maxconnperip", network.DefaultMaxConnsPerIP, "Connections one IP may keep open at once (0 = unlimited)")
+		startNodeMsgRate := startNodeCmd.Float64("msgrate", network.DefaultMessageRate, "Messages per second an IP may send on average (0 = unlimited)")
+		startNodeMaxMsgSize := startNodeCmd.Int("maxmsgsize", network.DefaultMaxMessageSize>>20, "Largest P2P message accepted in MB (0 = unlimited)")
+		var startNodeAddPeer, startNodeBanIP stringList
+		startNodeCmd.Var(&startNodeAddPeer, "addpeer", "Trusted peer HOST:PORT, dialed first and never rotated out, evicted or banned automatically (repeatable)")
+		startNodeConnectOnly := startNodeCmd.Bool("connect-only", false, "Talk to the -addpeer peers only and accept connections from their IPs only")
+		startNodeCmd.Var(&startNodeBanIP, "banip", "IP or CIDR range never connected to (repeatable)")
+		startNodeConf := startNodeCmd.String("conf", "", "Read startnode options from FILE (name=value lines)")
+		startNodeRotate := startNodeCmd.Duration("rotate-interval", network.DefaultRotationInterval, "Interval between outbound peer rotations (0 disables)")
+		startNodeBanThreshold := startNodeCmd.Int("ban-threshold", network.DefaultBanThreshold, "Misbehavior score at which a peer is banned (0 disables automatic bans)")
+		startNodeBanDuration := startNodeCmd.Duration("ban-duration", network.DefaultBanDuration, "Length of automatic peer bans")
+		startNodeFaucet := startNodeCmd.String("faucet", "", "Enable the testnet faucet funded by wallet ADDRESS")
+		startNodeFaucetAmount := startNodeCmd.Int("faucet-amount", api.DefaultFaucetAmount, "Coins sent per faucet request")
+		startNodeFaucetCooldown := startNodeCmd.Duration("faucet-cooldown", api.DefaultFaucetCooldown, "Minimum time between faucet requests per IP/address")
+		startNodeAnalytics := startNodeCmd.Bool("analytics", false, "Enable the address clustering and tagging module")
+		startNodeChannels := startNodeCmd.Bool("channels", false, "Enable unidirectional payment channels")
+		startNodePublic := startNodeCmd.Bool("public", false, "Serve only read-only, non-sensitive API routes")
+		startNodeAPIAuth := startNodeCmd.String("api-auth", "", "JSON file of the API keys and JWT secret required by the API")
+		startNodeFinality := startNodeCmd.Int("finality-depth", blockchain.Params().DefaultFinalityDepth, "Blocks after which a block is final and never reorganized (0 disables)")
+		startNodeAddrIndex := startNodeCmd.Bool("addrindex", false, "Maintain the address history index (built on first start)")
+		startNodePrune := startNodeCmd.Int("prune", 0, "Keep the full data of the last N blocks only (0 = keep every block, at least the finality depth)")
+		startNodeMaturity := startNodeCmd.Int("coinbase-maturity", 0, "Blocks before the wallet spends a mining reward (0 = at once, Bitcoin uses 100)")
+		startNodeFreshChange := startNodeCmd.Bool("fresh-change", true, "Send the change of /api/send to a new wallet address")
+		startNodeFollow := startNodeCmd.String("follow", "", "Run as a hot standby replica of the primary node at HOST:PORT")
+		startNodeFailover := startNodeCmd.Duration("failover", 0, "Promote the replica after the primary is unreachable this long (0 = manual)")
+		startNodeSigner := startNodeCmd.String("signer", "", "External signer command used to spend from its address via /api/send")
+		startNodeCoinSelect := startNodeCmd.String("coinselect", blockchain.CoinSelectFirstFit, "Coin selection strategy: "+strings.Join(blockchain.CoinSelectorNames(), ", "))
+		startNodeMaxMemory := startNodeCmd.Int("maxmemory", network.DefaultMaxMemory>>20, "Memory limit for the mempool and caches in MB (0 = unlimited)")
+		startNodeRecord := startNodeCmd.String("record", "", "Record every P2P message handled to FILE for replay")
+		startNodeMiningCPU := startNodeCmd.Int("mining-cpu", 100, "Percentage of one CPU the miner may use (1-100)")
+		startNodeMaxHashRate := startNodeCmd.Float64("max-hashrate", 0, "Hashes per second the miner may compute (0 = uncapped)")
+		startNodeMiningNice := startNodeCmd.Bool("mining-nice", false, "Mine at the lowest scheduling priority (Linux)")
+		startNodeCoinbaseMsg := startNodeCmd.String("coinbase-msg", "", "Message embedded in the coinbase of mined blocks, e.g. a pool name")
+		startNodeGenesis := startNodeCmd.String("genesis", "", "genesis.json of the private network to join (used to create the chain)")
+		startNodeMaxMempool := startNodeCmd.Int("maxmempool", network.DefaultMaxMempool>>20, "Size limit of the pending transactions in MB, lowest fee rates are evicted first (0 = unlimited)")
 
 		err := startNodeCmd.Parse(os.Args[2:])
 		if err != nil {
 			log.Panic(err)
 		}
+		if *startNodeConf != "" {
+			if err := loadConfigFile(startNodeCmd, *startNodeConf); err != nil {
+				log.Panic(err)
+			}
+		}
+
+		opts := nodeOptions{
+			maxOutbound:    *startNodeMaxOutbound,
+			maxInbound:     *startNodeMaxInbound,
+			nat:            *startNodeNAT,
+			proxy:          *startNodeProxy,
+			discoverLAN:    *startNodeDiscoverLAN,
+			maxConnsPerIP:  *startNodeMaxConnsPerIP,
+			messageRate:    *startNodeMsgRate,
+			maxMessageSize: *startNodeMaxMsgSize << 20,
+			rotateInterval: *startNodeRotate,
+			banThreshold:   *startNodeBanThreshold,
+			banDuration:    *startNodeBanDuration,
+			maxMemory:      int64(*startNodeMaxMemory) << 20,
+			maxMempool:     int64(*startNodeMaxMempool) << 20,
+			analytics:      *startNodeAnalytics,
+			channels:       *startNodeChannels,
+			public:         *startNodePublic,
+			apiAuth:        *startNodeAPIAuth,
+			finalityDepth:  *startNodeFinality,
+			prune:          *startNodePrune,
+			addrIndex:      *startNodeAddrIndex,
+			maturity:       *startNodeMaturity,
+			freshChange:    *startNodeFreshChange,
+			follow:         *startNodeFollow,
+			failover:       *startNodeFailover,
+			signer:         *startNodeSigner,
+			record:         *startNodeRecord,
+			coinbaseMsg:    *startNodeCoinbaseMsg,
+			throttle: blockchain.MiningThrottle{
+				CPUPercent:  *startNodeMiningCPU,
+				MaxHashRate: *startNodeMaxHashRate,
+				LowPriority: *startNodeMiningNice,
+			},
+		}
+		if err := blockchain.ValidateCoinbaseMessage(opts.coinbaseMsg); err != nil {
+			log.Panic(err)
+		}
+		if opts.coinSelector, err = blockchain.ParseCoinSelector(*startNodeCoinSelect); err != nil {
+			log.Panic(err)
+		}
+		if err := network.ValidateNATMethod(opts.nat); err != nil {
+			log.Panic(err)
+		}
+		if err := network.ValidateProxy(opts.proxy); err != nil {
+			log.Panic(err)
+		}
+		if opts.proxy != "" && opts.nat != "" {
+			log.Panic("-nat would reveal the address -proxy hides, use one or the other")
+		}
+		if opts.discoverLAN && (opts.proxy != "" || *startNodeConnectOnly) {
+			log.Panic("-discover-lan announces the node to its neighbours, it cannot go with -proxy nor -connect-only")
+		}
+		if opts.policy, err = peerPolicy(startNodeAddPeer, startNodeBanIP, *startNodeConnectOnly); err != nil {
+			log.Panic(err)
+		}
+		if *startNodeGenesis != "" {
+			opts.genesis = loadGenesisFile(*startNodeGenesis)
+		}
+		if *startNodeFaucet != "" {
+			opts.faucet = api.NewFaucet(*startNodeFaucet, *startNodeFaucetAmount, *startNodeFaucetCooldown)
+		}
 
 		nodeAddress := fmt.Sprintf("0.0.0.0:%s", *startNodePort)
-		startNode(*startNodeMiner, nodeAddress)
+		startNode(*startNodeMiner, nodeAddress, opts)
 
 	default:
 		fmt.Printf("Unknown command: %s\n\n", os.Args[1])
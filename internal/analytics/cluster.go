@@ -0,0 +1,263 @@
+// Package analytics provides optional chain analysis for node operators
+//
+// Addresses are clustered with the common-input-ownership heuristic: all
+// addresses spent together as inputs of one transaction are assumed to be
+// controlled by the same owner. Operators can attach tags to addresses; the
+// tags of a cluster are the union of the tags of its addresses.
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// MaxTagLength is the maximum length of an address tag
+const MaxTagLength = 64
+
+// Cluster is a set of addresses assumed to have the same owner
+type Cluster struct {
+	ID        string              `json:"id"` // Lexicographically smallest address of the cluster
+	Addresses []string            `json:"addresses"`
+	Tags      map[string][]string `json:"tags"` // address -> tags
+}
+
+// ClusterIndex clusters the addresses of the chain and stores operator tags
+type ClusterIndex struct {
+	parent   map[string]string // union-find forest over addresses
+	tags     map[string][]string
+	tagsPath string
+
+	indexed    [][]byte // Main chain block hashes already indexed (genesis first)
+	indexedSet map[string]bool
+
+	mu sync.Mutex
+}
+
+// getTagsFile returns the path of the persisted address tags
+func getTagsFile() string {
+	return filepath.Join(blockchain.DataDir(), "address_tags.json")
+}
+
+// NewClusterIndex creates an empty index, loading persisted tags
+func NewClusterIndex() *ClusterIndex {
+	idx := &ClusterIndex{
+		parent:     make(map[string]string),
+		tags:       make(map[string][]string),
+		tagsPath:   getTagsFile(),
+		indexedSet: make(map[string]bool),
+	}
+
+	if data, err := ioutil.ReadFile(idx.tagsPath); err == nil {
+		if err := json.Unmarshal(data, &idx.tags); err != nil {
+			log.Printf("⚠️  Ignoring corrupted address tags %s: %v", idx.tagsPath, err)
+			idx.tags = make(map[string][]string)
+		}
+	} else if !os.IsNotExist(err) {
+		log.Printf("⚠️  Could not read address tags %s: %v", idx.tagsPath, err)
+	}
+
+	return idx
+}
+
+// Sync indexes the blocks connected since the last call
+// If the previously indexed tip left the main chain the index is rebuilt
+// Once ctx is done Sync returns ctx.Err(), before indexing any new block
+func (idx *ClusterIndex) Sync(ctx context.Context, chain *blockchain.Blockchain) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for {
+		// Collect unindexed blocks walking back from the tip
+		var pending []*blockchain.Block
+		iter := chain.Iterator()
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			block := iter.Next()
+			if idx.indexedSet[string(block.Hash)] {
+				break
+			}
+			pending = append(pending, block)
+			if len(block.PrevHash) == 0 {
+				break
+			}
+		}
+
+		if len(pending) == 0 {
+			return nil
+		}
+
+		// The new blocks must extend the indexed tip, otherwise the chain was reorganized
+		oldest := pending[len(pending)-1]
+		extendsTip := len(idx.indexed) == 0 && len(oldest.PrevHash) == 0 ||
+			len(idx.indexed) > 0 && bytes.Equal(oldest.PrevHash, idx.indexed[len(idx.indexed)-1])
+
+		if !extendsTip {
+			log.Printf("🔎 Analytics: chain reorganized, rebuilding address clusters")
+			idx.parent = make(map[string]string)
+			idx.indexed = nil
+			idx.indexedSet = make(map[string]bool)
+			continue
+		}
+
+		for i := len(pending) - 1; i >= 0; i-- {
+			idx.indexBlock(pending[i])
+			idx.indexed = append(idx.indexed, pending[i].Hash)
+			idx.indexedSet[string(pending[i].Hash)] = true
+		}
+		return nil
+	}
+}
+
+// indexBlock merges the input addresses of each transaction; the caller must hold idx.mu
+func (idx *ClusterIndex) indexBlock(block *blockchain.Block) {
+	for _, tx := range block.Transactions {
+		for _, out := range tx.Outputs {
+			if out.IsDataCarrier() {
+				continue // No address
+			}
+			idx.find(string(blockchain.PubKeyHashToAddress(out.PubKeyHash)))
+		}
+
+		if tx.IsCoinbase() {
+			continue
+		}
+
+		var first string
+		for _, in := range tx.Inputs {
+			address := string(blockchain.PubKeyHashToAddress(in.LockingHash()))
+			if first == "" {
+				first = address
+				idx.find(first)
+				continue
+			}
+			idx.union(first, address)
+		}
+	}
+}
+
+// find returns the root of an address, adding it as a singleton if unknown
+func (idx *ClusterIndex) find(address string) string {
+	parent, ok := idx.parent[address]
+	if !ok {
+		idx.parent[address] = address
+		return address
+	}
+	if parent == address {
+		return address
+	}
+
+	root := idx.find(parent)
+	idx.parent[address] = root // Path compression
+	return root
+}
+
+func (idx *ClusterIndex) union(a, b string) {
+	rootA, rootB := idx.find(a), idx.find(b)
+	if rootA == rootB {
+		return
+	}
+
+	// Keep the smallest address as root so cluster IDs are stable
+	if rootB < rootA {
+		rootA, rootB = rootB, rootA
+	}
+	idx.parent[rootB] = rootA
+}
+
+// Cluster returns the cluster containing address
+func (idx *ClusterIndex) Cluster(ctx context.Context, chain *blockchain.Blockchain, address string) (*Cluster, error) {
+	if err := idx.Sync(ctx, chain); err != nil {
+		return nil, err
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if _, ok := idx.parent[address]; !ok {
+		return nil, fmt.Errorf("address %s has not appeared on chain", address)
+	}
+
+	root := idx.find(address)
+	cluster := &Cluster{Tags: make(map[string][]string)}
+	for member := range idx.parent {
+		if idx.find(member) != root {
+			continue
+		}
+		cluster.Addresses = append(cluster.Addresses, member)
+		if tags := idx.tags[member]; len(tags) > 0 {
+			cluster.Tags[member] = append([]string{}, tags...)
+		}
+	}
+	sort.Strings(cluster.Addresses)
+	cluster.ID = cluster.Addresses[0]
+
+	return cluster, nil
+}
+
+// AddTag attaches a tag to an address and persists the tags
+func (idx *ClusterIndex) AddTag(address, tag string) error {
+	tag = strings.TrimSpace(tag)
+	if tag == "" || len(tag) > MaxTagLength {
+		return fmt.Errorf("tag must be 1-%d characters", MaxTagLength)
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, existing := range idx.tags[address] {
+		if existing == tag {
+			return nil
+		}
+	}
+	idx.tags[address] = append(idx.tags[address], tag)
+
+	return idx.saveTags()
+}
+
+// RemoveTag detaches a tag from an address and persists the tags
+func (idx *ClusterIndex) RemoveTag(address, tag string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	tags := idx.tags[address][:0]
+	for _, existing := range idx.tags[address] {
+		if existing != tag {
+			tags = append(tags, existing)
+		}
+	}
+
+	if len(tags) == 0 {
+		delete(idx.tags, address)
+	} else {
+		idx.tags[address] = tags
+	}
+
+	return idx.saveTags()
+}
+
+// saveTags writes the tags to disk; the caller must hold idx.mu
+func (idx *ClusterIndex) saveTags() error {
+	data, err := json.MarshalIndent(idx.tags, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(idx.tagsPath), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(idx.tagsPath, data, 0644)
+}
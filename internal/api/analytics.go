@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/marcocsrachid/blockchain-go/internal/analytics"
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+type TagRequest struct {
+	Tag string `json:"tag"`
+}
+
+// EnableAnalytics turns on the address clustering and tagging module
+func (s *Server) EnableAnalytics(index *analytics.ClusterIndex) {
+	s.Analytics = index
+	log.Printf("🔎 Address clustering analytics enabled")
+}
+
+// handleCluster returns the cluster of an address or manages its tags
+// GET    /api/cluster/:address
+// POST   /api/cluster/:address/tags {"tag": "exchange"}
+// DELETE /api/cluster/:address/tags {"tag": "exchange"}
+func (s *Server) handleCluster(w http.ResponseWriter, r *http.Request) {
+	if s.Analytics == nil {
+		s.sendError(w, "Analytics module is disabled (start the node with -analytics)", http.StatusNotFound)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/cluster/")
+	address, tagsPath := strings.CutSuffix(path, "/tags")
+
+	if !blockchain.ValidateAddress(address) {
+		s.sendErrorCode(w, ErrCodeInvalidAddress, "Invalid address format", nil, http.StatusBadRequest)
+		return
+	}
+
+	if !tagsPath {
+		if r.Method != http.MethodGet {
+			s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		cluster, err := s.Analytics.Cluster(r.Context(), s.Blockchain, address)
+		if requestAbandoned(r, err) {
+			return
+		}
+		if err != nil {
+			s.sendError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		s.sendJSON(w, cluster, http.StatusOK)
+		return
+	}
+
+	var req TagRequest
+	if r.Method == http.MethodPost || r.Method == http.MethodDelete {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.sendError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var err error
+	switch r.Method {
+	case http.MethodPost:
+		err = s.Analytics.AddTag(address, req.Tag)
+	case http.MethodDelete:
+		err = s.Analytics.RemoveTag(address, req.Tag)
+	default:
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cluster, err := s.Analytics.Cluster(r.Context(), s.Blockchain, address)
+	if err != nil {
+		// Tags may be attached to addresses not seen on chain yet
+		s.sendJSON(w, map[string]string{"address": address, "status": "ok"}, http.StatusOK)
+		return
+	}
+
+	s.sendJSON(w, cluster, http.StatusOK)
+}
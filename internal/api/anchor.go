@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+type AnchorRequest struct {
+	From string `json:"from"` // Wallet paying the fee
+	Hash string `json:"hash"` // Hex document hash (or any data up to 80 bytes)
+	Fee  int    `json:"fee,omitempty"`
+}
+
+type AnchorResponse struct {
+	Success     bool                `json:"success"`
+	TxID        string              `json:"tx_id"`
+	Output      int                 `json:"output"` // Index of the data-carrier output
+	Hash        string              `json:"hash"`
+	Transaction TransactionResponse `json:"transaction"`
+}
+
+// handleAnchor publishes a document hash on-chain in a data-carrier output,
+// timestamping it with the block that confirms the transaction
+// POST /api/anchor {"from": "...", "hash": "hex", "fee": 0}
+func (s *Server) handleAnchor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req AnchorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !blockchain.ValidateAddress(req.From) {
+		s.sendErrorCode(w, ErrCodeInvalidAddress, "Invalid 'from' address", nil, http.StatusBadRequest)
+		return
+	}
+	req.From, _ = blockchain.ToBase58Address(req.From)
+
+	data, err := hex.DecodeString(req.Hash)
+	if err != nil || len(data) == 0 || len(data) > blockchain.MaxDataCarrierBytes {
+		s.sendError(w, fmt.Sprintf("Hash must be hex, 1 to %d bytes", blockchain.MaxDataCarrierBytes), http.StatusBadRequest)
+		return
+	}
+	if req.Fee < 0 {
+		s.sendError(w, "Fee cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	signer, err := s.localSigner(req.From)
+	if err != nil {
+		s.sendErr(w, "", err, http.StatusNotFound)
+		return
+	}
+
+	// Build under the chain state lock, sign afterwards (signers may be slow)
+	s.Blockchain.RLockState()
+	tx, err := blockchain.NewDataTransaction(
+		blockchain.Funding{Address: req.From, PubKey: signer.PublicKey(), Amount: req.Fee},
+		data,
+		s.Blockchain,
+	)
+	var prevTXs map[string]blockchain.Transaction
+	if err == nil {
+		prevTXs, err = s.Blockchain.PrevTransactions(tx)
+	}
+	s.Blockchain.RUnlockState()
+	if err != nil {
+		s.sendErr(w, "Failed to create transaction: ", err, http.StatusBadRequest)
+		return
+	}
+
+	if err := tx.Sign(signer, prevTXs); err != nil {
+		s.sendError(w, "Failed to sign transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("⚓ API: Anchoring %x in transaction %x", data, tx.ID)
+	if err := s.relayTransaction(tx); err != nil {
+		s.sendRejected(w, err)
+		return
+	}
+
+	s.sendJSON(w, AnchorResponse{
+		Success:     true,
+		TxID:        fmt.Sprintf("%x", tx.ID),
+		Output:      0,
+		Hash:        hex.EncodeToString(data),
+		Transaction: s.newTransactionResponse(tx),
+	}, http.StatusOK)
+}
@@ -0,0 +1,434 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// API authentication
+//
+// With startnode -api-auth FILE every route but /health needs credentials:
+// an API key listed in the file, or a JWT signed (HS256) with the file's
+// jwt_secret. They are sent as "Authorization: Bearer ...", in the
+// X-API-Key header, as the password of HTTP basic auth (rpcpassword of
+// JSON-RPC clients) or, for WebSocket clients that cannot set headers, as
+// ?access_token=. Each key or token has a role:
+//
+//	read    GET on the routes the public profile serves, /metrics, /ws, /graphql
+//	wallet  read plus the wallet, spending and mining routes
+//	admin   wallet plus node operations: peer bans, backups, the miner
+//	        blacklist, replica promotion, starting and stopping the miner
+//
+// Spend authorization (passphrase/TOTP) still applies on top of the role.
+
+// APIKeyHeader carries an API key or token, for clients that cannot set Authorization
+const APIKeyHeader = "X-API-Key"
+
+// Credential requirements
+const (
+	minAPIKeyLength    = 16
+	minJWTSecretLength = 32
+	jwtLeeway          = time.Minute // Clock skew tolerated on exp and nbf
+)
+
+// Role is the scope granted to an API key or token, each role includes the
+// ones below it
+type Role int
+
+const (
+	RoleRead Role = iota + 1
+	RoleWallet
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{
+	RoleRead:   "read",
+	RoleWallet: "wallet",
+	RoleAdmin:  "admin",
+}
+
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return "none"
+}
+
+// ParseRole returns the role called name
+func ParseRole(name string) (Role, error) {
+	for role, roleName := range roleNames {
+		if strings.EqualFold(name, roleName) {
+			return role, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown role %q (read, wallet or admin)", name)
+}
+
+// adminRoutes need the admin role; the routes the public profile serves need
+// the read role for GET and HEAD, every other route the wallet role
+var adminRoutes = map[string]bool{
+	"/api/admin/blacklist": true,
+	"/api/admin/backup":    true,
+	"/api/peers/ban":       true,
+	"/api/peers/unban":     true,
+	"/api/replica/promote": true,
+	"/api/mining/start":    true,
+	"/api/mining/stop":     true,
+}
+
+// APIAuthConfig is the -api-auth file
+type APIAuthConfig struct {
+	Keys       []APIKeyConfig `json:"keys"`
+	JWTSecret  string         `json:"jwt_secret,omitempty"`  // HS256 secret of the accepted tokens (empty = no tokens)
+	JWTIssuer  string         `json:"jwt_issuer,omitempty"`  // Required iss claim (empty = not checked)
+	PublicRead bool           `json:"public_read,omitempty"` // Requests without credentials get the read role
+}
+
+// APIKeyConfig is an API key of the -api-auth file
+// KeySHA256 keeps the key itself out of the file
+type APIKeyConfig struct {
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	Key       string `json:"key,omitempty"`
+	KeySHA256 string `json:"key_sha256,omitempty"` // Hex SHA-256 of the key
+}
+
+// APIAuth checks the API keys and tokens of requests
+type APIAuth struct {
+	keys       map[[sha256.Size]byte]apiPrincipal // By SHA-256 of the key
+	jwtSecret  []byte
+	jwtIssuer  string
+	publicRead bool
+}
+
+// apiPrincipal is the holder of the credentials of a request
+type apiPrincipal struct {
+	name string
+	role Role
+}
+
+type principalKey struct{}
+
+// LoadAPIAuth reads an -api-auth file
+func LoadAPIAuth(path string) (*APIAuth, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config APIAuthConfig
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	auth, err := NewAPIAuth(config)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return auth, nil
+}
+
+// NewAPIAuth creates an authenticator accepting the keys and tokens of config
+func NewAPIAuth(config APIAuthConfig) (*APIAuth, error) {
+	auth := &APIAuth{
+		keys:       make(map[[sha256.Size]byte]apiPrincipal),
+		jwtIssuer:  config.JWTIssuer,
+		publicRead: config.PublicRead,
+	}
+
+	for i, key := range config.Keys {
+		if key.Name == "" {
+			return nil, fmt.Errorf("key %d has no name", i)
+		}
+		role, err := ParseRole(key.Role)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %v", key.Name, err)
+		}
+
+		var hash [sha256.Size]byte
+		switch {
+		case key.Key != "" && key.KeySHA256 != "":
+			return nil, fmt.Errorf("key %s: set key or key_sha256, not both", key.Name)
+		case key.Key != "":
+			if len(key.Key) < minAPIKeyLength {
+				return nil, fmt.Errorf("key %s: shorter than %d characters", key.Name, minAPIKeyLength)
+			}
+			if strings.Count(key.Key, ".") == 2 {
+				return nil, fmt.Errorf("key %s: must not look like a JWT (two dots)", key.Name)
+			}
+			hash = sha256.Sum256([]byte(key.Key))
+		default:
+			decoded, err := hex.DecodeString(key.KeySHA256)
+			if err != nil || len(decoded) != sha256.Size {
+				return nil, fmt.Errorf("key %s: key_sha256 must be %d hex characters", key.Name, 2*sha256.Size)
+			}
+			copy(hash[:], decoded)
+		}
+
+		if other, ok := auth.keys[hash]; ok {
+			return nil, fmt.Errorf("keys %s and %s are the same", other.name, key.Name)
+		}
+		auth.keys[hash] = apiPrincipal{name: key.Name, role: role}
+	}
+
+	if config.JWTSecret != "" {
+		if len(config.JWTSecret) < minJWTSecretLength {
+			return nil, fmt.Errorf("jwt_secret shorter than %d characters", minJWTSecretLength)
+		}
+		auth.jwtSecret = []byte(config.JWTSecret)
+	}
+
+	if len(auth.keys) == 0 && auth.jwtSecret == nil {
+		return nil, errors.New("no keys and no jwt_secret, nobody could use the API")
+	}
+
+	return auth, nil
+}
+
+// EnableAPIAuth requires API keys or tokens on every route but /health
+// Must be called before Start
+func (s *Server) EnableAPIAuth(auth *APIAuth) {
+	s.Auth = auth
+	log.Printf("🔑 API authentication required (%d keys, JWT: %v, anonymous read: %v)",
+		len(auth.keys), auth.jwtSecret != nil, auth.publicRead)
+}
+
+// GenerateAPIKey returns a new random API key and its hex SHA-256, the value
+// of key_sha256 in the -api-auth file
+func GenerateAPIKey() (string, string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	key := base64.RawURLEncoding.EncodeToString(buf)
+	hash := sha256.Sum256([]byte(key))
+	return key, hex.EncodeToString(hash[:]), nil
+}
+
+// jwtHeader and jwtClaims are the parts of the tokens understood here
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+}
+
+type jwtClaims struct {
+	Subject   string `json:"sub,omitempty"`
+	Role      string `json:"role"`
+	Issuer    string `json:"iss,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// IssueToken signs a token granting role to subject for ttl
+func (a *APIAuth) IssueToken(subject string, role Role, ttl time.Duration) (string, error) {
+	if a.jwtSecret == nil {
+		return "", errors.New("no jwt_secret configured")
+	}
+	if ttl <= 0 {
+		return "", errors.New("token lifetime must be positive")
+	}
+
+	now := time.Now()
+	header, err := json.Marshal(jwtHeader{Alg: "HS256", Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(jwtClaims{
+		Subject:   subject,
+		Role:      role.String(),
+		Issuer:    a.jwtIssuer,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(a.sign(signed)), nil
+}
+
+func (a *APIAuth) sign(signed string) []byte {
+	mac := hmac.New(sha256.New, a.jwtSecret)
+	mac.Write([]byte(signed))
+	return mac.Sum(nil)
+}
+
+// verifyToken checks the signature and validity of a JWT
+// Only HS256 is accepted, whatever the header asks for
+func (a *APIAuth) verifyToken(token string) (apiPrincipal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return apiPrincipal{}, errors.New("malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return apiPrincipal{}, err
+	}
+	if header.Alg != "HS256" {
+		return apiPrincipal{}, fmt.Errorf("token algorithm %q not accepted", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, a.sign(parts[0]+"."+parts[1])) {
+		return apiPrincipal{}, errors.New("invalid token signature")
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return apiPrincipal{}, err
+	}
+
+	now := time.Now()
+	switch {
+	case claims.ExpiresAt == 0:
+		return apiPrincipal{}, errors.New("token has no exp claim")
+	case now.After(time.Unix(claims.ExpiresAt, 0).Add(jwtLeeway)):
+		return apiPrincipal{}, errors.New("token expired")
+	case claims.NotBefore != 0 && now.Add(jwtLeeway).Before(time.Unix(claims.NotBefore, 0)):
+		return apiPrincipal{}, errors.New("token not valid yet")
+	case a.jwtIssuer != "" && claims.Issuer != a.jwtIssuer:
+		return apiPrincipal{}, fmt.Errorf("token issuer %q not accepted", claims.Issuer)
+	}
+
+	role, err := ParseRole(claims.Role)
+	if err != nil {
+		return apiPrincipal{}, fmt.Errorf("token role: %v", err)
+	}
+
+	name := claims.Subject
+	if name == "" {
+		name = "token"
+	}
+	return apiPrincipal{name: name, role: role}, nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errors.New("malformed token")
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.New("malformed token")
+	}
+	return nil
+}
+
+// authenticate returns the holder of the credentials of a request
+func (a *APIAuth) authenticate(r *http.Request) (apiPrincipal, error) {
+	credential := requestCredential(r)
+	if credential == "" {
+		if a.publicRead {
+			return apiPrincipal{name: "anonymous", role: RoleRead}, nil
+		}
+		return apiPrincipal{}, errors.New("missing API key or token")
+	}
+
+	if a.jwtSecret != nil && strings.Count(credential, ".") == 2 {
+		return a.verifyToken(credential)
+	}
+
+	principal, ok := a.keys[sha256.Sum256([]byte(credential))]
+	if !ok {
+		return apiPrincipal{}, errors.New("invalid API key")
+	}
+	return principal, nil
+}
+
+// requestCredential returns the API key or token a request carries
+func requestCredential(r *http.Request) string {
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		if scheme, token, ok := strings.Cut(authorization, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		if _, password, ok := r.BasicAuth(); ok {
+			return password
+		}
+	}
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	// Browsers cannot set headers on WebSocket handshakes
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return r.URL.Query().Get("access_token")
+	}
+	return ""
+}
+
+// routeRole returns the role a route needs for the method of a request
+func routeRole(pattern string) func(r *http.Request) Role {
+	return func(r *http.Request) Role {
+		switch {
+		case adminRoutes[pattern]:
+			return RoleAdmin
+		case publicRoutes[pattern] && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+			return RoleRead
+		}
+		return RoleWallet
+	}
+}
+
+// fixedRole is the role of a route whatever the method
+func fixedRole(role Role) func(r *http.Request) Role {
+	return func(*http.Request) Role {
+		return role
+	}
+}
+
+// requireRole refuses the requests whose credentials do not grant the role
+// they need; it serves everything when API authentication is disabled
+func (s *Server) requireRole(role func(r *http.Request) Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.Auth == nil {
+			next(w, r)
+			return
+		}
+
+		principal, err := s.Auth.authenticate(r)
+		if err != nil {
+			log.Printf("🔑 API %s %s from %s refused: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="blockchain-go"`)
+			if r.URL.Path == "/rpc" {
+				w.Header().Add("WWW-Authenticate", `Basic realm="jsonrpc"`)
+			}
+			s.sendErrorCode(w, ErrCodeUnauthorized, err.Error(), nil, http.StatusUnauthorized)
+			return
+		}
+
+		if needed := role(r); principal.role < needed {
+			log.Printf("🔑 API %s %s refused to %s: role %s, needs %s", r.Method, r.URL.Path, principal.name, principal.role, needed)
+			s.sendErrorCode(w, ErrCodeForbidden, fmt.Sprintf("%s has the %s role, this route needs %s", principal.name, principal.role, needed),
+				map[string]interface{}{"role": principal.role.String(), "required_role": needed.String()}, http.StatusForbidden)
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	}
+}
+
+// allowed reports whether the credentials of a request grant role, for
+// handlers whose requests need different roles (JSON-RPC methods)
+func (s *Server) allowed(r *http.Request, role Role) bool {
+	if s.Auth == nil {
+		return true
+	}
+	principal, ok := r.Context().Value(principalKey{}).(apiPrincipal)
+	return ok && principal.role >= role
+}
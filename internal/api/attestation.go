@@ -0,0 +1,40 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// handleGetAttestation returns a signed attestation of the chain state
+// GET /api/attestation
+func (s *Server) handleGetAttestation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	identity, err := s.nodeIdentity()
+	if err != nil {
+		log.Printf("❌ API: Could not load node identity: %v", err)
+		s.sendError(w, "Node identity unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	attestation, err := blockchain.NewAttestation(s.Blockchain, identity)
+	if err != nil {
+		s.sendError(w, "Failed to sign attestation", http.StatusInternalServerError)
+		return
+	}
+
+	s.sendJSON(w, attestation, http.StatusOK)
+}
+
+// nodeIdentity loads the node identity key once
+func (s *Server) nodeIdentity() (*blockchain.Wallet, error) {
+	s.identityOnce.Do(func() {
+		s.identity, s.identityErr = blockchain.LoadNodeIdentity()
+	})
+	return s.identity, s.identityErr
+}
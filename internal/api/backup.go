@@ -0,0 +1,43 @@
+package api
+
+import (
+	"log"
+	"net/http"
+)
+
+// handleBackup streams a consistent backup of the chain database, taken
+// while the node keeps running (see blockchain.Backup)
+// POST /api/admin/backup
+func (s *Server) handleBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="blockchain.backup"`)
+
+	out := &startedWriter{ResponseWriter: w}
+	header, err := s.Blockchain.Backup(out)
+	if err != nil {
+		log.Printf("⚠️  API: Backup for %s failed: %v", r.RemoteAddr, err)
+		// Once streaming started, the truncated gzip stream tells the client
+		if !out.started {
+			s.sendError(w, "Backup failed: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	log.Printf("💾 API: Sent a backup at height %d to %s", header.Height, r.RemoteAddr)
+}
+
+// startedWriter records whether the response body started
+type startedWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (w *startedWriter) Write(p []byte) (int, error) {
+	w.started = true
+	return w.ResponseWriter.Write(p)
+}
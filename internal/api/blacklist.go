@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type MinerBlacklistResponse struct {
+	TxIDs     []string `json:"txids"`
+	Addresses []string `json:"addresses"`
+}
+
+type MinerBlacklistRequest struct {
+	Type  string `json:"type"` // "txid" or "address"
+	Value string `json:"value"`
+}
+
+// MinerBlacklistManager manages the local mining blacklist of the network server
+type MinerBlacklistManager interface {
+	MinerBlacklistInfo() MinerBlacklistResponse
+	AddToMinerBlacklist(kind, value string) error
+	RemoveFromMinerBlacklist(kind, value string) error
+}
+
+// handleMinerBlacklist lists and edits the txids and addresses the local miner
+// will not include in blocks (local policy, not consensus)
+// GET    /api/admin/blacklist
+// POST   /api/admin/blacklist {"type": "txid" | "address", "value": "..."}
+// DELETE /api/admin/blacklist {"type": "txid" | "address", "value": "..."}
+func (s *Server) handleMinerBlacklist(w http.ResponseWriter, r *http.Request) {
+	manager, ok := s.NetworkServer.(MinerBlacklistManager)
+	if !ok {
+		s.sendError(w, "Miner blacklist is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.sendJSON(w, manager.MinerBlacklistInfo(), http.StatusOK)
+
+	case http.MethodPost, http.MethodDelete:
+		var req MinerBlacklistRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.sendError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		var err error
+		if r.Method == http.MethodPost {
+			err = manager.AddToMinerBlacklist(req.Type, req.Value)
+		} else {
+			err = manager.RemoveFromMinerBlacklist(req.Type, req.Value)
+		}
+		if err != nil {
+			s.sendError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.sendJSON(w, manager.MinerBlacklistInfo(), http.StatusOK)
+
+	default:
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,436 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+	"github.com/marcocsrachid/blockchain-go/internal/channel"
+)
+
+type OpenChannelRequest struct {
+	Payer       string `json:"payer"`
+	Payee       string `json:"payee"`
+	PayeePubKey string `json:"payee_pubkey,omitempty"` // Hex public key (optional for wallets on this node)
+	Capacity    int    `json:"capacity"`
+	Timeout     int    `json:"timeout"` // Refund lock-time in blocks
+}
+
+type FundChannelRequest struct {
+	RefundSignature string `json:"refund_signature"` // Hex payee signature of the refund
+}
+
+type PayChannelRequest struct {
+	Amount int `json:"amount"`
+}
+
+type ChannelResponse struct {
+	ID            string            `json:"id"`
+	Role          string            `json:"role"`
+	Status        string            `json:"status"`
+	Payer         string            `json:"payer"`
+	Payee         string            `json:"payee"`
+	Address       string            `json:"address"` // 2-of-2 multisig address holding the funds
+	Capacity      int               `json:"capacity"`
+	Paid          int               `json:"paid"`
+	Sequence      int               `json:"sequence"`
+	Timeout       int               `json:"timeout"`
+	RefundValidAt int               `json:"refund_valid_at,omitempty"` // Height from which the refund is valid, once funding confirmed
+	CloseTxID     string            `json:"close_txid,omitempty"`
+	Proposal      *channel.Proposal `json:"proposal,omitempty"`      // To send to the payee while opening
+	LatestUpdate  *channel.Update   `json:"latest_update,omitempty"` // Last update sent (payer) or received (payee)
+	CreatedAt     int64             `json:"created_at"`
+	UpdatedAt     int64             `json:"updated_at"`
+}
+
+type AcceptChannelResponse struct {
+	Channel         ChannelResponse `json:"channel"`
+	RefundSignature string          `json:"refund_signature"` // To send back to the payer
+}
+
+type ChannelsResponse struct {
+	Channels []ChannelResponse `json:"channels"`
+}
+
+// EnableChannels loads the payment channels of the node and serves the channel API
+func (s *Server) EnableChannels() {
+	s.Channels = channel.NewStore()
+	log.Printf("💸 Payment channels enabled (%d stored)", len(s.Channels.List()))
+}
+
+// handleChannels lists the channels or opens a new one as payer
+// GET/POST /api/channels
+func (s *Server) handleChannels(w http.ResponseWriter, r *http.Request) {
+	if s.Channels == nil {
+		s.sendError(w, "Payment channels are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		response := ChannelsResponse{Channels: []ChannelResponse{}}
+		for _, ch := range s.Channels.List() {
+			response.Channels = append(response.Channels, s.channelResponse(ch))
+		}
+		s.sendJSON(w, response, http.StatusOK)
+	case http.MethodPost:
+		s.handleOpenChannel(w, r)
+	default:
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleOpenChannel creates a channel and its proposal for the payee
+func (s *Server) handleOpenChannel(w http.ResponseWriter, r *http.Request) {
+	var req OpenChannelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !blockchain.ValidateAddress(req.Payer) || !blockchain.ValidateAddress(req.Payee) {
+		s.sendErrorCode(w, ErrCodeInvalidAddress, "Valid payer and payee addresses are required", nil, http.StatusBadRequest)
+		return
+	}
+	if req.Capacity <= 0 {
+		s.sendError(w, "Capacity must be positive", http.StatusBadRequest)
+		return
+	}
+	if req.Timeout < blockchain.MinChannelTimeout || req.Timeout > blockchain.MaxRelativeLockTime {
+		s.sendError(w, fmt.Sprintf("Timeout must be between %d and %d blocks", blockchain.MinChannelTimeout, blockchain.MaxRelativeLockTime), http.StatusBadRequest)
+		return
+	}
+	req.Payer, _ = blockchain.ToBase58Address(req.Payer)
+	req.Payee, _ = blockchain.ToBase58Address(req.Payee)
+
+	payer, err := s.localSigner(req.Payer)
+	if err != nil {
+		s.sendErr(w, "", err, http.StatusNotFound)
+		return
+	}
+	payeePubKey, err := s.cosignerPubKey(req.Payee, req.PayeePubKey)
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ch, err := channel.Open(s.Blockchain, payer, req.Payer, req.Payee, payeePubKey, req.Capacity, req.Timeout)
+	if err != nil {
+		s.sendErr(w, "Failed to open channel: ", err, http.StatusBadRequest)
+		return
+	}
+	if err := s.Channels.Add(ch); err != nil {
+		s.sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("💸 Channel %s proposed: %s -> %s, capacity %d", ch.ID, ch.Payer, ch.Payee, ch.Capacity)
+	s.sendJSON(w, s.channelResponse(*ch), http.StatusCreated)
+}
+
+// handleChannel serves a single channel
+// GET  /api/channels/:id
+// POST /api/channels/accept      (payee, body: proposal)
+// POST /api/channels/:id/fund    (payer, body: refund signature)
+// POST /api/channels/:id/pay     (payer)
+// POST /api/channels/:id/update  (payee, body: update)
+// POST /api/channels/:id/close
+func (s *Server) handleChannel(w http.ResponseWriter, r *http.Request) {
+	if s.Channels == nil {
+		s.sendError(w, "Payment channels are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/channels/"), "/")
+
+	if r.Method == http.MethodGet && action == "" {
+		ch, ok := s.Channels.Get(id)
+		if !ok {
+			s.sendError(w, "Channel not found", http.StatusNotFound)
+			return
+		}
+		s.sendJSON(w, s.channelResponse(ch), http.StatusOK)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch {
+	case id == "accept" && action == "":
+		s.handleAcceptChannel(w, r)
+	case action == "fund":
+		s.handleFundChannel(w, r, id)
+	case action == "pay":
+		s.handlePayChannel(w, r, id)
+	case action == "update":
+		s.handleUpdateChannel(w, r, id)
+	case action == "close":
+		ch, err := s.closeChannel(id)
+		if err != nil {
+			s.sendChannelError(w, err)
+			return
+		}
+		s.sendJSON(w, s.channelResponse(ch), http.StatusOK)
+	default:
+		s.sendError(w, "Unknown channel action", http.StatusNotFound)
+	}
+}
+
+// handleAcceptChannel checks a proposal as payee and signs the refund
+func (s *Server) handleAcceptChannel(w http.ResponseWriter, r *http.Request) {
+	var proposal channel.Proposal
+	if err := json.NewDecoder(r.Body).Decode(&proposal); err != nil {
+		s.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !blockchain.ValidateAddress(proposal.Payer) || !blockchain.ValidateAddress(proposal.Payee) {
+		s.sendErrorCode(w, ErrCodeInvalidAddress, "Valid payer and payee addresses are required", nil, http.StatusBadRequest)
+		return
+	}
+	proposal.Payer, _ = blockchain.ToBase58Address(proposal.Payer)
+	proposal.Payee, _ = blockchain.ToBase58Address(proposal.Payee)
+
+	payee, err := s.localSigner(proposal.Payee)
+	if err != nil {
+		s.sendErr(w, "", err, http.StatusNotFound)
+		return
+	}
+
+	ch, signature, err := channel.Accept(s.Blockchain, payee, &proposal)
+	if err != nil {
+		s.sendError(w, "Channel refused: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.Channels.Add(ch); err != nil {
+		s.sendError(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	log.Printf("💸 Channel %s accepted: %s -> %s, capacity %d", ch.ID, ch.Payer, ch.Payee, ch.Capacity)
+	s.sendJSON(w, AcceptChannelResponse{
+		Channel:         s.channelResponse(*ch),
+		RefundSignature: hex.EncodeToString(signature),
+	}, http.StatusCreated)
+}
+
+// handleFundChannel stores the refund signed by the payee and broadcasts the funding transaction
+func (s *Server) handleFundChannel(w http.ResponseWriter, r *http.Request, id string) {
+	var req FundChannelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	signature, err := hex.DecodeString(req.RefundSignature)
+	if err != nil || len(signature) == 0 {
+		s.sendError(w, "Invalid refund signature", http.StatusBadRequest)
+		return
+	}
+
+	var funding *blockchain.Transaction
+	ch, err := s.Channels.Update(id, func(ch *channel.Channel) error {
+		var err error
+		funding, err = ch.AddRefundSignature(signature)
+		return err
+	})
+	if err != nil {
+		s.sendChannelError(w, err)
+		return
+	}
+
+	if err := s.relayTransaction(funding); err != nil {
+		s.sendRejected(w, err)
+		return
+	}
+	log.Printf("💸 Channel %s funded, funding tx %x broadcast", ch.ID, funding.ID)
+	s.sendJSON(w, s.channelResponse(ch), http.StatusOK)
+}
+
+// handlePayChannel signs a balance update as payer
+func (s *Server) handlePayChannel(w http.ResponseWriter, r *http.Request, id string) {
+	var req PayChannelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	current, ok := s.Channels.Get(id)
+	if !ok {
+		s.sendError(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+	payer, err := s.localSigner(current.Payer)
+	if err != nil {
+		s.sendErr(w, "", err, http.StatusNotFound)
+		return
+	}
+
+	var update *channel.Update
+	ch, err := s.Channels.Update(id, func(ch *channel.Channel) error {
+		var err error
+		update, err = ch.Pay(payer, req.Amount)
+		return err
+	})
+	if err != nil {
+		s.sendChannelError(w, err)
+		return
+	}
+
+	log.Printf("💸 Channel %s: paid %d (update %d, total %d)", ch.ID, req.Amount, ch.Sequence, ch.Paid)
+	s.sendJSON(w, update, http.StatusOK)
+}
+
+// handleUpdateChannel stores a balance update received by the payee
+func (s *Server) handleUpdateChannel(w http.ResponseWriter, r *http.Request, id string) {
+	var update channel.Update
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		s.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if update.Channel != "" && update.Channel != id {
+		s.sendError(w, "Update belongs to another channel", http.StatusBadRequest)
+		return
+	}
+
+	ch, err := s.Channels.Update(id, func(ch *channel.Channel) error {
+		return ch.Receive(&update)
+	})
+	if err != nil {
+		s.sendChannelError(w, err)
+		return
+	}
+
+	log.Printf("💸 Channel %s: received update %d (total %d)", ch.ID, ch.Sequence, ch.Paid)
+	s.sendJSON(w, s.channelResponse(ch), http.StatusOK)
+}
+
+// closeChannel broadcasts the closing transaction of the local side: the
+// latest balance for the payee, the refund for the payer once it is valid
+// The chain state lock is never taken under the channel store lock
+func (s *Server) closeChannel(id string) (channel.Channel, error) {
+	current, ok := s.Channels.Get(id)
+	if !ok {
+		return channel.Channel{}, channel.ErrNotFound
+	}
+
+	var signer blockchain.Signer
+	if current.Role == channel.RolePayee {
+		var err error
+		if signer, err = s.localSigner(current.Payee); err != nil {
+			return current, err
+		}
+	}
+
+	closeTx, err := current.CloseTx(signer)
+	if err != nil {
+		return current, err
+	}
+
+	// Refuse early rather than broadcast a transaction peers reject
+	s.Blockchain.RLockState()
+	_, err = s.Blockchain.CheckTransactionInputs(closeTx)
+	s.Blockchain.RUnlockState()
+	if err != nil {
+		return current, fmt.Errorf("closing transaction not valid yet: %w", err)
+	}
+
+	ch, err := s.Channels.Update(id, func(ch *channel.Channel) error {
+		if ch.Status != channel.StatusOpen {
+			return fmt.Errorf("channel %s is %s", ch.ID, ch.Status)
+		}
+		ch.Closed(closeTx.ID)
+		return nil
+	})
+	if err != nil {
+		return ch, err
+	}
+
+	if err := s.relayTransaction(closeTx); err != nil {
+		return ch, err
+	}
+	log.Printf("💸 Channel %s closed by the %s, tx %x broadcast", ch.ID, ch.Role, closeTx.ID)
+	return ch, nil
+}
+
+// EnforceChannelTimeouts closes the channels whose refund deadline is near
+// Called by the network server whenever the tip changes
+func (s *Server) EnforceChannelTimeouts() {
+	if s.Channels == nil {
+		return
+	}
+
+	s.Blockchain.RLockState()
+	expiring := s.Channels.Expiring(s.Blockchain, s.Blockchain.GetBestHeight()+1)
+	s.Blockchain.RUnlockState()
+
+	for _, ch := range expiring {
+		log.Printf("⏳ Channel %s: refund deadline reached, closing as %s", ch.ID, ch.Role)
+		if _, err := s.closeChannel(ch.ID); err != nil {
+			log.Printf("⚠️  Could not close channel %s: %v", ch.ID, err)
+		}
+	}
+}
+
+// localSigner returns the signer of an address held by this node: an
+// external signer or a wallet key
+func (s *Server) localSigner(address string) (blockchain.Signer, error) {
+	if signer, ok := s.Signers[address]; ok {
+		return signer, nil
+	}
+	if wallet, ok := s.Wallets.Wallets[address]; ok && wallet != nil {
+		return wallet.Signer(), nil
+	}
+
+	return nil, fmt.Errorf("address %s is %w", address, errNotAWallet)
+}
+
+// channelResponse describes a channel, with its refund deadline once funding confirmed
+func (s *Server) channelResponse(ch channel.Channel) ChannelResponse {
+	response := ChannelResponse{
+		ID:           ch.ID,
+		Role:         string(ch.Role),
+		Status:       string(ch.Status),
+		Payer:        ch.Payer,
+		Payee:        ch.Payee,
+		Address:      blockchain.MultisigAddress(ch.Script),
+		Capacity:     ch.Capacity,
+		Paid:         ch.Paid,
+		Sequence:     ch.Sequence,
+		Timeout:      ch.Timeout,
+		CloseTxID:    ch.CloseTxID,
+		LatestUpdate: ch.LatestUpdate(),
+		CreatedAt:    ch.CreatedAt,
+		UpdatedAt:    ch.UpdatedAt,
+	}
+	if ch.Status == channel.StatusOpening {
+		response.Proposal = ch.Proposal()
+	}
+
+	if fundingID, err := hex.DecodeString(ch.ID); err == nil {
+		s.Blockchain.RLockState()
+		if _, confirmedAt, err := s.Blockchain.FindTransactionHeight(fundingID); err == nil {
+			response.RefundValidAt = confirmedAt + ch.Timeout
+		}
+		s.Blockchain.RUnlockState()
+	}
+
+	return response
+}
+
+// sendChannelError maps channel errors to HTTP status codes
+func (s *Server) sendChannelError(w http.ResponseWriter, err error) {
+	if errors.Is(err, channel.ErrNotFound) {
+		s.sendError(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	s.sendError(w, err.Error(), http.StatusConflict)
+}
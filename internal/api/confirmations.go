@@ -0,0 +1,161 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// Confirmation tracking defaults
+const (
+	DefaultRequiredConfirmations = 6
+	maxConfirmationEvents        = 1000 // Events kept for polling clients
+)
+
+// ConfirmationLog keeps recent confirmation events with sequence numbers so
+// clients can poll for included / confirmed / reverted payments
+type ConfirmationLog struct {
+	events []SequencedEvent
+	next   uint64
+	mu     sync.Mutex
+}
+
+// SequencedEvent is a confirmation event with its position in the log
+type SequencedEvent struct {
+	Seq uint64 `json:"seq"`
+	blockchain.ConfirmationEvent
+}
+
+type WatchRequest struct {
+	TxID          string `json:"txid"`
+	Confirmations int    `json:"confirmations"`
+}
+
+type ConfirmationEventsResponse struct {
+	Events []SequencedEvent `json:"events"`
+	Next   uint64           `json:"next"` // Pass as ?since= to get newer events
+}
+
+// newConfirmationLog creates a log subscribed to tracker
+func newConfirmationLog(tracker *blockchain.ConfirmationTracker) *ConfirmationLog {
+	l := &ConfirmationLog{next: 1}
+	tracker.Subscribe(l.record)
+	return l
+}
+
+func (l *ConfirmationLog) record(event blockchain.ConfirmationEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if event.Type == blockchain.EventReverted {
+		log.Printf("↩️  Payment reverted: transaction %s left the main chain", event.Tx.TxID)
+	}
+
+	l.events = append(l.events, SequencedEvent{Seq: l.next, ConfirmationEvent: event})
+	l.next++
+
+	if len(l.events) > maxConfirmationEvents {
+		l.events = l.events[len(l.events)-maxConfirmationEvents:]
+	}
+}
+
+// since returns events with a sequence number >= seq
+func (l *ConfirmationLog) since(seq uint64) ([]SequencedEvent, uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	events := []SequencedEvent{}
+	for _, event := range l.events {
+		if event.Seq >= seq {
+			events = append(events, event)
+		}
+	}
+	return events, l.next
+}
+
+// handleConfirmations watches a transaction or lists confirmation events
+// POST /api/confirmations              {"txid": "...", "confirmations": 6}
+// GET  /api/confirmations?since=SEQ    events (included, confirmed, reverted)
+func (s *Server) handleConfirmations(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		events, next := s.confirmationLog.since(uint64(ParseIntParam(r, "since", 0)))
+		s.sendJSON(w, ConfirmationEventsResponse{Events: events, Next: next}, http.StatusOK)
+
+	case http.MethodPost:
+		var req WatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.sendError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		txID, err := hex.DecodeString(req.TxID)
+		if err != nil || len(txID) == 0 {
+			s.sendError(w, "Invalid transaction ID", http.StatusBadRequest)
+			return
+		}
+
+		if req.Confirmations <= 0 {
+			req.Confirmations = DefaultRequiredConfirmations
+		}
+
+		// Only watch transactions the node knows, in the chain or the mempool
+		_, _, err = s.Blockchain.FindTransactionLocation(txID)
+		if errors.Is(err, blockchain.ErrTxNotFound) {
+			inspector, _ := s.NetworkServer.(MempoolInspector)
+			if inspector == nil {
+				s.sendError(w, "Transaction not found in the chain", http.StatusNotFound)
+				return
+			}
+			if _, found := inspector.MempoolTransaction(hex.EncodeToString(txID)); !found {
+				s.sendError(w, "Transaction not found in the chain nor the mempool", http.StatusNotFound)
+				return
+			}
+		} else if err != nil {
+			s.sendError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		s.Confirmations.Watch(txID, req.Confirmations)
+		s.Confirmations.Update(s.Blockchain)
+
+		watched, _ := s.Confirmations.Status(txID)
+		s.sendJSON(w, watched, http.StatusCreated)
+
+	default:
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleConfirmation returns or removes a watched transaction
+// GET    /api/confirmations/:txid
+// DELETE /api/confirmations/:txid
+func (s *Server) handleConfirmation(w http.ResponseWriter, r *http.Request) {
+	txID, err := hex.DecodeString(strings.TrimPrefix(r.URL.Path, "/api/confirmations/"))
+	if err != nil || len(txID) == 0 {
+		s.sendError(w, "Invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+
+	watched, ok := s.Confirmations.Status(txID)
+	if !ok {
+		s.sendError(w, "Transaction is not watched", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.sendJSON(w, watched, http.StatusOK)
+	case http.MethodDelete:
+		s.Confirmations.Unwatch(txID)
+		s.sendJSON(w, watched, http.StatusOK)
+	default:
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,446 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// DefaultSessionExpiry is how long a co-signing session stays open
+const DefaultSessionExpiry = time.Hour
+
+// Co-signing session states
+const (
+	SessionPending   = "pending"
+	SessionBroadcast = "broadcast"
+	SessionExpired   = "expired"
+)
+
+// SigningSession coordinates several cosigners signing one transaction
+// Each cosigner signs the inputs that spend its own outputs; the transaction
+// is broadcast once every required cosigner has signed
+// Multisig sessions spend from an m-of-n address: cosigners are the key
+// owners, each adds a partial signature and m of them are enough
+type SigningSession struct {
+	ID        string
+	Tx        *blockchain.Transaction
+	PrevTXs   map[string]blockchain.Transaction
+	Cosigners map[string]bool // address -> has signed
+	Threshold int             // Signatures needed (0 = every cosigner)
+	Status    string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// SessionStore keeps co-signing sessions in memory
+type SessionStore struct {
+	sessions map[string]*SigningSession
+	mu       sync.Mutex
+}
+
+// NewSessionStore creates an empty session store
+func NewSessionStore() *SessionStore {
+	return &SessionStore{
+		sessions: make(map[string]*SigningSession),
+	}
+}
+
+type CosignerRequest struct {
+	Address string `json:"address"`
+	PubKey  string `json:"pubkey,omitempty"` // Hex public key (optional for wallets on this node)
+	Amount  int    `json:"amount"`
+}
+
+type RecipientRequest struct {
+	Address string `json:"address"`
+	Amount  int    `json:"amount"`
+}
+
+type CreateSessionRequest struct {
+	Cosigners      []CosignerRequest  `json:"cosigners"`
+	Multisig       string             `json:"multisig,omitempty"` // Spend from this multisig address instead of cosigners
+	Outputs        []RecipientRequest `json:"outputs"`
+	ExpiresSeconds int                `json:"expires_in_seconds,omitempty"`
+	RelativeLock   int                `json:"relative_locktime,omitempty"` // Blocks each spent output must wait after confirming
+}
+
+type SignSessionRequest struct {
+	Address    string            `json:"address"`
+	PubKey     string            `json:"pubkey,omitempty"`
+	Signatures map[string]string `json:"signatures,omitempty"` // input index -> hex signature
+}
+
+type SessionInput struct {
+	Index         int    `json:"index"`
+	Address       string `json:"address"`
+	SignatureHash string `json:"signature_hash"`
+	Signed        bool   `json:"signed"`
+}
+
+type SessionResponse struct {
+	ID        string          `json:"id"`
+	Status    string          `json:"status"`
+	TxID      string          `json:"tx_id"`
+	Threshold int             `json:"threshold"`
+	Signed    int             `json:"signed"`
+	Cosigners map[string]bool `json:"cosigners"`
+	Inputs    []SessionInput  `json:"inputs"`
+	ExpiresAt int64           `json:"expires_at"`
+}
+
+// get returns a session by ID, marking it expired when its time is up
+func (ss *SessionStore) get(id string) (*SigningSession, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	session, ok := ss.sessions[id]
+	if ok && session.Status == SessionPending && time.Now().After(session.ExpiresAt) {
+		session.Status = SessionExpired
+	}
+
+	return session, ok
+}
+
+// add stores a session and drops sessions that expired long ago
+func (ss *SessionStore) add(session *SigningSession) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	for id, old := range ss.sessions {
+		if time.Since(old.ExpiresAt) > DefaultSessionExpiry {
+			delete(ss.sessions, id)
+		}
+	}
+
+	ss.sessions[session.ID] = session
+}
+
+// newSessionID generates a random session identifier
+func newSessionID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		log.Panic(err)
+	}
+	return hex.EncodeToString(id)
+}
+
+// handleCosignSessions creates a co-signing session
+// POST /api/cosign/sessions
+func (s *Server) handleCosignSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CreateSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Cosigners) == 0 && req.Multisig == "" || len(req.Outputs) == 0 {
+		s.sendError(w, "Cosigners (or a multisig address) and outputs are required", http.StatusBadRequest)
+		return
+	}
+
+	if req.RelativeLock < 0 || req.RelativeLock > blockchain.MaxRelativeLockTime {
+		s.sendError(w, fmt.Sprintf("Relative lock-time must be between 0 and %d blocks", blockchain.MaxRelativeLockTime), http.StatusBadRequest)
+		return
+	}
+
+	var funders []blockchain.Funding
+	for _, cosigner := range req.Cosigners {
+		if !blockchain.ValidateAddress(cosigner.Address) || cosigner.Amount <= 0 {
+			s.sendErrorCode(w, ErrCodeInvalidAddress, fmt.Sprintf("Invalid cosigner %s", cosigner.Address), nil, http.StatusBadRequest)
+			return
+		}
+
+		cosigner.Address, _ = blockchain.ToBase58Address(cosigner.Address)
+		pubKey, err := s.cosignerPubKey(cosigner.Address, cosigner.PubKey)
+		if err != nil {
+			s.sendError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		funders = append(funders, blockchain.Funding{Address: cosigner.Address, PubKey: pubKey, Amount: cosigner.Amount})
+	}
+
+	var recipients []blockchain.Recipient
+	for _, output := range req.Outputs {
+		if !blockchain.ValidateAddress(output.Address) || output.Amount <= 0 {
+			s.sendErrorCode(w, ErrCodeInvalidAddress, fmt.Sprintf("Invalid output %s", output.Address), nil, http.StatusBadRequest)
+			return
+		}
+		recipients = append(recipients, blockchain.Recipient{Address: output.Address, Amount: output.Amount})
+	}
+
+	var script []byte
+	if req.Multisig != "" {
+		if len(funders) > 0 {
+			s.sendError(w, "Cosigners cannot be combined with a multisig address", http.StatusBadRequest)
+			return
+		}
+		if script = s.Wallets.Multisig[req.Multisig]; script == nil {
+			s.sendError(w, fmt.Sprintf("Multisig address %s is not registered on this node", req.Multisig), http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.Blockchain.RLockState()
+	var tx *blockchain.Transaction
+	var err error
+	if script != nil {
+		tx, err = blockchain.NewMultisigTransaction(script, recipients, s.Blockchain)
+	} else {
+		tx, err = blockchain.NewUnsignedTransaction(funders, recipients, s.Blockchain)
+	}
+	s.Blockchain.RUnlockState()
+	if err == nil && req.RelativeLock > 0 {
+		err = tx.SetRelativeLockTime(req.RelativeLock)
+	}
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	prevTXs, err := s.Blockchain.PrevTransactions(tx)
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	expiry := DefaultSessionExpiry
+	if req.ExpiresSeconds > 0 {
+		expiry = time.Duration(req.ExpiresSeconds) * time.Second
+	}
+
+	session := &SigningSession{
+		ID:        newSessionID(),
+		Tx:        tx,
+		PrevTXs:   prevTXs,
+		Cosigners: make(map[string]bool),
+		Status:    SessionPending,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(expiry),
+	}
+	for _, funder := range funders {
+		session.Cosigners[funder.Address] = false
+	}
+	if script != nil {
+		m, pubKeys, _ := blockchain.ParseMultisigScript(script)
+		for _, pubKey := range pubKeys {
+			session.Cosigners[string(blockchain.PubKeyHashToAddress(blockchain.HashPubKey(pubKey)))] = false
+		}
+		session.Threshold = m
+	}
+
+	s.Sessions.add(session)
+	log.Printf("✍️  Co-signing session %s created for tx %x (%d cosigners)", session.ID, tx.ID, len(session.Cosigners))
+
+	s.sendJSON(w, s.sessionResponse(session), http.StatusCreated)
+}
+
+// handleCosignSession returns the status of a session or accepts signatures
+// GET  /api/cosign/sessions/:id
+// POST /api/cosign/sessions/:id/sign
+func (s *Server) handleCosignSession(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/cosign/sessions/")
+	id := strings.TrimSuffix(path, "/sign")
+
+	session, ok := s.Sessions.get(id)
+	if !ok {
+		s.sendError(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && id == path:
+		s.Sessions.mu.Lock()
+		response := s.sessionResponse(session)
+		s.Sessions.mu.Unlock()
+
+		s.sendJSON(w, response, http.StatusOK)
+	case r.Method == http.MethodPost && id != path:
+		s.handleCosignSign(w, r, session)
+	default:
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleCosignSign collects the signatures of one cosigner
+func (s *Server) handleCosignSign(w http.ResponseWriter, r *http.Request, session *SigningSession) {
+	var req SignSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	s.Sessions.mu.Lock()
+	defer s.Sessions.mu.Unlock()
+
+	if session.Status != SessionPending {
+		s.sendError(w, fmt.Sprintf("Session is %s", session.Status), http.StatusConflict)
+		return
+	}
+
+	if address, err := blockchain.ToBase58Address(req.Address); err == nil {
+		req.Address = address
+	}
+	if _, ok := session.Cosigners[req.Address]; !ok {
+		s.sendError(w, "Address is not a cosigner of this session", http.StatusForbidden)
+		return
+	}
+
+	pubKey, err := s.cosignerPubKey(req.Address, req.PubKey)
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if string(blockchain.PubKeyHashToAddress(blockchain.HashPubKey(pubKey))) != req.Address {
+		s.sendError(w, "Public key does not match address", http.StatusBadRequest)
+		return
+	}
+
+	// Work on a copy so a bad signature leaves the session untouched
+	signed := *session.Tx
+	signed.Inputs = append([]blockchain.TXInput{}, session.Tx.Inputs...)
+
+	wallet, local := s.Wallets.Wallets[req.Address]
+	for inId, in := range signed.Inputs {
+		if keyIndex := blockchain.MultisigKeyIndex(in.PubKey, pubKey); keyIndex >= 0 {
+			if len(req.Signatures) == 0 && local {
+				err = signed.SignMultisigInput(inId, wallet.Signer(), session.PrevTXs)
+			} else {
+				var signature []byte
+				if signature, err = hex.DecodeString(req.Signatures[strconv.Itoa(inId)]); err == nil {
+					err = signed.AddMultisigSignature(inId, keyIndex, signature, session.PrevTXs)
+				}
+			}
+			if err != nil {
+				s.sendError(w, fmt.Sprintf("Invalid signature for input %d", inId), http.StatusBadRequest)
+				return
+			}
+			continue
+		}
+
+		if !in.UsesKey(blockchain.HashPubKey(pubKey)) {
+			continue
+		}
+
+		if len(req.Signatures) == 0 && local {
+			if err := signed.SignInput(inId, wallet.Signer(), session.PrevTXs); err != nil {
+				s.sendError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			continue
+		}
+
+		signature, err := hex.DecodeString(req.Signatures[strconv.Itoa(inId)])
+		if err != nil || !signed.VerifyInputSignature(inId, signature, pubKey, session.PrevTXs) {
+			s.sendError(w, fmt.Sprintf("Invalid signature for input %d", inId), http.StatusBadRequest)
+			return
+		}
+		signed.Inputs[inId].Signature = signature
+	}
+
+	session.Tx = &signed
+	session.Cosigners[req.Address] = true
+	log.Printf("✍️  Session %s signed by %s", session.ID, req.Address)
+
+	if s.sessionSigned(session) {
+		if !session.Tx.Verify(session.PrevTXs) {
+			s.sendError(w, "Finalized transaction failed verification", http.StatusBadRequest)
+			return
+		}
+
+		if err := s.relayTransaction(session.Tx); err != nil {
+			s.sendRejected(w, err)
+			return
+		}
+		session.Status = SessionBroadcast
+		log.Printf("✅ Session %s finalized, tx %x broadcast", session.ID, session.Tx.ID)
+	}
+
+	s.sendJSON(w, s.sessionResponse(session), http.StatusOK)
+}
+
+// cosignerPubKey resolves the public key of a cosigner, from the request or the local wallets
+func (s *Server) cosignerPubKey(address, pubKeyHex string) ([]byte, error) {
+	if pubKeyHex == "" {
+		wallet, ok := s.Wallets.Wallets[address]
+		if !ok || wallet == nil {
+			return nil, fmt.Errorf("pubkey is required for %s (not a wallet on this node)", address)
+		}
+		return wallet.PublicKey, nil
+	}
+
+	pubKey, err := hex.DecodeString(pubKeyHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pubkey for %s", address)
+	}
+
+	return pubKey, nil
+}
+
+// sessionSigned reports whether every cosigner (or the multisig threshold) has signed
+func (s *Server) sessionSigned(session *SigningSession) bool {
+	signatures := 0
+	for _, signed := range session.Cosigners {
+		if signed {
+			signatures++
+		}
+	}
+
+	if session.Threshold > 0 {
+		return signatures >= session.Threshold
+	}
+	return signatures == len(session.Cosigners)
+}
+
+// sessionResponse builds the API view of a session
+func (s *Server) sessionResponse(session *SigningSession) SessionResponse {
+	response := SessionResponse{
+		ID:        session.ID,
+		Status:    session.Status,
+		TxID:      fmt.Sprintf("%x", session.Tx.ID),
+		Threshold: session.Threshold,
+		Cosigners: session.Cosigners,
+		ExpiresAt: session.ExpiresAt.Unix(),
+	}
+
+	if response.Threshold == 0 {
+		response.Threshold = len(session.Cosigners)
+	}
+
+	for _, signed := range session.Cosigners {
+		if signed {
+			response.Signed++
+		}
+	}
+
+	for inId, in := range session.Tx.Inputs {
+		address := fmt.Sprintf("%s", blockchain.PubKeyHashToAddress(in.LockingHash()))
+		signed := len(in.Signature) > 0
+		if blockchain.IsMultisigScript(in.PubKey) {
+			signed = blockchain.MultisigSignatureCount(in.Signature) >= session.Threshold
+		}
+
+		response.Inputs = append(response.Inputs, SessionInput{
+			Index:         inId,
+			Address:       address,
+			SignatureHash: fmt.Sprintf("%x", session.Tx.SignatureHash(inId, session.PrevTXs)),
+			Signed:        signed,
+		})
+	}
+
+	return response
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// Error codes returned in the "code" field of every error response, so clients
+// can branch on failures without parsing the message
+const (
+	ErrCodeInvalidRequest    = "INVALID_REQUEST"    // Malformed body, missing or out of range parameter
+	ErrCodeInvalidAddress    = "INVALID_ADDRESS"    // Address that does not decode or fails its checksum
+	ErrCodeInsufficientFunds = "INSUFFICIENT_FUNDS" // The spendable outputs do not cover amount + fee
+	ErrCodeWalletNotFound    = "WALLET_NOT_FOUND"   // The address is not in the node wallet
+	ErrCodeUnauthorized      = "UNAUTHORIZED"       // API key or token missing or invalid (see -api-auth)
+	ErrCodeWalletLocked      = "WALLET_LOCKED"      // Spending authorization (passphrase/TOTP) missing or wrong
+	ErrCodeTxRejected        = "TX_REJECTED"        // Refused by the mempool, details.reject_code tells why
+	ErrCodeTxRejectedFee     = "TX_REJECTED_FEE"    // Fee rate too low to enter the full mempool
+	ErrCodeDoubleSpend       = "DOUBLE_SPEND"       // Spends an output a pending transaction already spends
+	ErrCodeNotFound          = "NOT_FOUND"
+	ErrCodeMethodNotAllowed  = "METHOD_NOT_ALLOWED"
+	ErrCodeNotAcceptable     = "NOT_ACCEPTABLE" // Unsupported API version requested
+	ErrCodeConflict          = "CONFLICT"       // The resource is not in a state allowing the request
+	ErrCodeForbidden         = "FORBIDDEN"
+	ErrCodeRateLimited       = "RATE_LIMITED"
+	ErrCodeUnavailable       = "UNAVAILABLE" // The feature is disabled or the node is not ready
+	ErrCodeInternal          = "INTERNAL_ERROR"
+)
+
+// ErrorCodes is the catalog of error codes, published by /api/v1/schema
+var ErrorCodes = []string{
+	ErrCodeInvalidRequest, ErrCodeInvalidAddress, ErrCodeInsufficientFunds, ErrCodeWalletNotFound,
+	ErrCodeUnauthorized, ErrCodeWalletLocked, ErrCodeTxRejected, ErrCodeTxRejectedFee, ErrCodeDoubleSpend, ErrCodeNotFound,
+	ErrCodeMethodNotAllowed, ErrCodeNotAcceptable, ErrCodeConflict, ErrCodeForbidden, ErrCodeRateLimited,
+	ErrCodeUnavailable, ErrCodeInternal,
+}
+
+// errNotAWallet is wrapped by the errors about addresses the node cannot sign for
+var errNotAWallet = errors.New("not a wallet on this node")
+
+// ErrorResponse is the body of every error response
+// Error duplicates Message for the clients written before codes were added
+type ErrorResponse struct {
+	Error   string                 `json:"error"`
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// statusErrorCode returns the generic error code of an HTTP status
+func statusErrorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return ErrCodeInvalidRequest
+	case http.StatusUnauthorized:
+		return ErrCodeWalletLocked
+	case http.StatusForbidden:
+		return ErrCodeForbidden
+	case http.StatusNotFound:
+		return ErrCodeNotFound
+	case http.StatusMethodNotAllowed:
+		return ErrCodeMethodNotAllowed
+	case http.StatusNotAcceptable:
+		return ErrCodeNotAcceptable
+	case http.StatusConflict:
+		return ErrCodeConflict
+	case http.StatusTooManyRequests:
+		return ErrCodeRateLimited
+	case http.StatusServiceUnavailable:
+		return ErrCodeUnavailable
+	default:
+		return ErrCodeInternal
+	}
+}
+
+// errorCode classifies an error returned by the blockchain package, falling
+// back to the generic code of status
+func errorCode(err error, status int) (string, map[string]interface{}) {
+	var rejectErr *blockchain.TxRejectError
+	switch {
+	case errors.Is(err, blockchain.ErrInsufficientFunds):
+		return ErrCodeInsufficientFunds, nil
+	case errors.Is(err, errNotAWallet):
+		return ErrCodeWalletNotFound, nil
+	case errors.As(err, &rejectErr):
+		details := map[string]interface{}{"reject_code": rejectErr.Code}
+		switch rejectErr.Code {
+		case blockchain.RejectMempoolFull:
+			return ErrCodeTxRejectedFee, details
+		case blockchain.RejectMempoolConflict:
+			return ErrCodeDoubleSpend, details
+		}
+		return ErrCodeTxRejected, details
+	default:
+		return statusErrorCode(status), nil
+	}
+}
+
+// sendError sends an error with the generic code of its status
+func (s *Server) sendError(w http.ResponseWriter, message string, status int) {
+	s.sendErrorCode(w, statusErrorCode(status), message, nil, status)
+}
+
+// sendErrorCode sends an error with an explicit code and optional details
+func (s *Server) sendErrorCode(w http.ResponseWriter, code, message string, details map[string]interface{}, status int) {
+	response := ErrorResponse{
+		Error:   message,
+		Code:    code,
+		Message: message,
+		Details: details,
+	}
+	s.sendJSON(w, response, status)
+}
+
+// sendRejected sends a transaction refused by the mempool, with 409 Conflict
+// for a double spend
+func (s *Server) sendRejected(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if code, _ := errorCode(err, status); code == ErrCodeDoubleSpend {
+		status = http.StatusConflict
+	}
+	s.sendErr(w, "Transaction rejected: ", err, status)
+}
+
+// sendErr sends err prefixed by context, coded by errorCode
+func (s *Server) sendErr(w http.ResponseWriter, prefix string, err error, status int) {
+	code, details := errorCode(err, status)
+	s.sendErrorCode(w, code, prefix+err.Error(), details, status)
+}
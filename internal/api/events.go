@@ -0,0 +1,408 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// WebSocket events
+//
+// Clients connected to /ws subscribe to topics and are pushed a JSON message
+// for each event instead of polling: newblock (each new tip, as
+// /api/lastblock returns it), newtx (each transaction entering the mempool,
+// as /api/tx/:txid returns it) and addresstx:ADDRESS (the transactions paying
+// or spending from ADDRESS, when they enter the mempool and when they are
+// mined). A client sends {"subscribe": [topics]} or {"unsubscribe": [topics]},
+// or connects with ?subscribe=topic,topic, and is answered its subscriptions.
+// Every message is {"event": ..., "data": ...}. A client that does not keep
+// up with its events is disconnected.
+
+// Event topics
+const (
+	TopicNewBlock  = "newblock"
+	TopicNewTx     = "newtx"
+	TopicAddressTx = "addresstx:" // Followed by the address
+)
+
+const (
+	maxWSClients   = 256
+	maxWSTopics    = 100  // Per client
+	wsSendBuffer   = 64   // Messages queued per client
+	eventQueueSize = 1024 // Events waiting for the event loop
+	wsPingInterval = 30 * time.Second
+	wsReadTimeout  = 2*wsPingInterval + 10*time.Second // Clients answer pings
+)
+
+type WSRequest struct {
+	Subscribe   []string `json:"subscribe,omitempty"`
+	Unsubscribe []string `json:"unsubscribe,omitempty"`
+}
+
+// WSMessage is a message pushed to a client: an event of a topic it
+// subscribed to, "subscribed" with its topics, or "error"
+type WSMessage struct {
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+}
+
+type AddressTxEvent struct {
+	Address   string `json:"address"`
+	TxID      string `json:"txid"`
+	Confirmed bool   `json:"confirmed"` // Mined, otherwise it entered the mempool
+	BlockHash string `json:"block_hash,omitempty"`
+	Height    int    `json:"height,omitempty"`
+}
+
+// chainEvent is a new tip or a transaction that entered the mempool
+type chainEvent struct {
+	block *blockchain.Block
+	tx    *blockchain.Transaction
+}
+
+// wsClient is a connected subscriber
+type wsClient struct {
+	conn   *wsConn
+	send   chan []byte       // Closed once the client is removed
+	topics map[string]string // Topic -> name the client subscribed it as
+}
+
+// EventHub fans the chain and mempool events out to the WebSocket clients
+type EventHub struct {
+	clients map[*wsClient]struct{}
+	queue   chan chainEvent
+	mu      sync.Mutex
+}
+
+func newEventHub() *EventHub {
+	return &EventHub{
+		clients: make(map[*wsClient]struct{}),
+		queue:   make(chan chainEvent, eventQueueSize),
+	}
+}
+
+// PublishBlock pushes a new tip to the subscribers; it never blocks
+func (s *Server) PublishBlock(block *blockchain.Block) {
+	s.Events.publish(chainEvent{block: block})
+}
+
+// PublishTx pushes a transaction that entered the mempool to the
+// subscribers; it never blocks
+func (s *Server) PublishTx(tx *blockchain.Transaction) {
+	s.Events.publish(chainEvent{tx: tx})
+}
+
+func (h *EventHub) publish(event chainEvent) {
+	if h.count() == 0 {
+		return
+	}
+
+	select {
+	case h.queue <- event:
+	default:
+		log.Printf("⚠️  WebSocket events: queue full, event dropped")
+	}
+}
+
+func (h *EventHub) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.clients)
+}
+
+func (h *EventHub) add(client *wsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.clients[client] = struct{}{}
+}
+
+// remove disconnects a client, once; the caller must hold h.mu
+func (h *EventHub) remove(client *wsClient) {
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+	delete(h.clients, client)
+	close(client.send)
+}
+
+// push queues a message for a client, disconnecting it when it does not keep
+// up; the caller must hold h.mu
+func (h *EventHub) push(client *wsClient, message WSMessage) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("⚠️  WebSocket events: %v", err)
+		return
+	}
+
+	select {
+	case client.send <- data:
+	default:
+		log.Printf("🔌 WebSocket client %s too slow, disconnected", client.conn.conn.RemoteAddr())
+		h.remove(client)
+	}
+}
+
+// reply sends a message to one client
+func (h *EventHub) reply(client *wsClient, message WSMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.clients[client]; ok {
+		h.push(client, message)
+	}
+}
+
+// wants reports whether a client subscribed to topic
+func (h *EventHub) wants(topic string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for client := range h.clients {
+		if _, ok := client.topics[topic]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// broadcast pushes an event to the subscribers of its topic
+func (h *EventHub) broadcast(topic string, data interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for client := range h.clients {
+		if name, ok := client.topics[topic]; ok {
+			h.push(client, WSMessage{Event: name, Data: data})
+		}
+	}
+}
+
+// parseTopic returns the topic a client names, addresses in their base58 form
+func parseTopic(name string) (string, error) {
+	switch name {
+	case TopicNewBlock, TopicNewTx:
+		return name, nil
+	}
+
+	address, ok := strings.CutPrefix(name, TopicAddressTx)
+	if !ok {
+		return "", fmt.Errorf("unknown topic %q (newblock, newtx or addresstx:ADDRESS)", name)
+	}
+	if !blockchain.ValidateAddress(address) {
+		return "", fmt.Errorf("invalid address in topic %q", name)
+	}
+	pubKeyHash, _ := blockchain.AddressToPubKeyHash(address)
+	return TopicAddressTx + string(blockchain.PubKeyHashToAddress(pubKeyHash)), nil
+}
+
+// update subscribes and unsubscribes a client, and answers its topics
+func (h *EventHub) update(client *wsClient, request WSRequest) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+
+	for _, name := range request.Unsubscribe {
+		if topic, err := parseTopic(strings.TrimSpace(name)); err == nil {
+			delete(client.topics, topic)
+		}
+	}
+	for _, name := range request.Subscribe {
+		name = strings.TrimSpace(name)
+		topic, err := parseTopic(name)
+		if err != nil {
+			h.push(client, WSMessage{Event: "error", Data: err.Error()})
+			continue
+		}
+		if _, ok := client.topics[topic]; !ok && len(client.topics) >= maxWSTopics {
+			h.push(client, WSMessage{Event: "error", Data: fmt.Sprintf("at most %d topics per connection", maxWSTopics)})
+			break
+		}
+		client.topics[topic] = name
+	}
+
+	names := []string{}
+	for _, name := range client.topics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h.push(client, WSMessage{Event: "subscribed", Data: names})
+}
+
+// eventLoop builds the messages of the published events for their subscribers
+func (s *Server) eventLoop() {
+	for event := range s.Events.queue {
+		if event.block != nil {
+			s.pushBlock(event.block)
+		} else {
+			s.pushTx(event.tx)
+		}
+	}
+}
+
+// pushBlock pushes a new tip and the address transactions it mines
+func (s *Server) pushBlock(block *blockchain.Block) {
+	if s.Events.wants(TopicNewBlock) {
+		response, err := s.blockSummary(context.Background(), block)
+		if err == nil {
+			s.Events.broadcast(TopicNewBlock, response)
+		}
+	}
+
+	for _, tx := range block.Transactions {
+		s.pushAddressTx(tx, block)
+	}
+}
+
+// pushTx pushes a transaction that entered the mempool
+func (s *Server) pushTx(tx *blockchain.Transaction) {
+	if s.Events.wants(TopicNewTx) {
+		s.Events.broadcast(TopicNewTx, ChainTxResponse{InMempool: true, Timestamp: time.Now().Unix(), Transaction: s.newTransactionResponse(tx)})
+	}
+	s.pushAddressTx(tx, nil)
+}
+
+// pushAddressTx pushes a transaction to the subscribers of the addresses it
+// pays or spends from, mined in block or pending when block is nil
+func (s *Server) pushAddressTx(tx *blockchain.Transaction, block *blockchain.Block) {
+	for _, address := range txAddresses(tx) {
+		topic := TopicAddressTx + address
+		if !s.Events.wants(topic) {
+			continue
+		}
+
+		event := AddressTxEvent{Address: address, TxID: fmt.Sprintf("%x", tx.ID)}
+		if block != nil {
+			event.Confirmed = true
+			event.BlockHash = fmt.Sprintf("%x", block.Hash)
+			event.Height = block.Height
+		}
+		s.Events.broadcast(topic, event)
+	}
+}
+
+// txAddresses returns the addresses a transaction pays or spends from
+func txAddresses(tx *blockchain.Transaction) []string {
+	var addresses []string
+	add := func(pubKeyHash []byte) {
+		address := string(blockchain.PubKeyHashToAddress(pubKeyHash))
+		for _, known := range addresses {
+			if known == address {
+				return
+			}
+		}
+		addresses = append(addresses, address)
+	}
+
+	if !tx.IsCoinbase() {
+		for i := range tx.Inputs {
+			add(tx.Inputs[i].LockingHash())
+		}
+	}
+	for i := range tx.Outputs {
+		if !tx.Outputs[i].IsDataCarrier() {
+			add(tx.Outputs[i].PubKeyHash)
+		}
+	}
+	return addresses
+}
+
+// handleWebSocket upgrades a connection to a WebSocket pushing the events of
+// the topics the client subscribes to
+// GET /ws?subscribe=newblock,newtx,addresstx:ADDRESS
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key, err := checkWebSocketUpgrade(r)
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.Events.count() >= maxWSClients {
+		s.sendError(w, fmt.Sprintf("Too many WebSocket clients (at most %d)", maxWSClients), http.StatusServiceUnavailable)
+		return
+	}
+
+	conn, err := upgradeWebSocket(w, key)
+	if err != nil {
+		log.Printf("⚠️  WebSocket upgrade failed: %v", err)
+		return
+	}
+
+	client := &wsClient{conn: conn, send: make(chan []byte, wsSendBuffer), topics: make(map[string]string)}
+	s.Events.add(client)
+	defer func() {
+		s.Events.mu.Lock()
+		s.Events.remove(client)
+		s.Events.mu.Unlock()
+	}()
+	go client.writeLoop()
+
+	if topics := r.URL.Query().Get("subscribe"); topics != "" {
+		s.Events.update(client, WSRequest{Subscribe: strings.Split(topics, ",")})
+	}
+
+	for {
+		conn.conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+		opcode, message, err := conn.readMessage()
+		if err != nil {
+			var protocolErr *wsProtocolError
+			if errors.As(err, &protocolErr) {
+				conn.close(protocolErr.code)
+			}
+			return
+		}
+		if opcode != wsOpText {
+			conn.close(wsCloseUnsupported)
+			return
+		}
+
+		var request WSRequest
+		if err := json.Unmarshal(message, &request); err != nil {
+			s.Events.reply(client, WSMessage{Event: "error", Data: "invalid request, expected {\"subscribe\": [...]} or {\"unsubscribe\": [...]}"})
+			continue
+		}
+		s.Events.update(client, request)
+	}
+}
+
+// writeLoop sends the queued messages of a client and pings it, until it is
+// removed
+func (c *wsClient) writeLoop() {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case message, ok := <-c.send:
+			if !ok {
+				c.conn.close(wsCloseNormal)
+				return
+			}
+			if err := c.conn.writeFrame(wsOpText, message); err != nil {
+				c.conn.conn.Close()
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.writeFrame(wsOpPing, nil); err != nil {
+				c.conn.conn.Close()
+				return
+			}
+		}
+	}
+}
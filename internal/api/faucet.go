@@ -0,0 +1,194 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// Faucet defaults
+const (
+	DefaultFaucetAmount   = 10
+	DefaultFaucetCooldown = 24 * time.Hour
+)
+
+// CaptchaVerifier checks a captcha token submitted with a faucet request
+// Returning an error rejects the request
+type CaptchaVerifier func(token, remoteIP string) error
+
+// Faucet hands out coins from a node wallet on test networks
+type Faucet struct {
+	Address  string          // Wallet address funding the faucet
+	Amount   int             // Coins sent per request
+	Cooldown time.Duration   // Minimum time between two requests from the same IP or address
+	Captcha  CaptchaVerifier // Optional captcha hook (nil = disabled)
+
+	lastByIP      map[string]time.Time
+	lastByAddress map[string]time.Time
+	mu            sync.Mutex
+}
+
+type FaucetRequest struct {
+	Address      string `json:"address"`
+	CaptchaToken string `json:"captcha_token,omitempty"`
+}
+
+type FaucetResponse struct {
+	Success     bool                `json:"success"`
+	TxID        string              `json:"tx_id"`
+	Amount      int                 `json:"amount"`
+	Transaction TransactionResponse `json:"transaction"`
+}
+
+// NewFaucet creates a faucet paying amount coins from address
+func NewFaucet(address string, amount int, cooldown time.Duration) *Faucet {
+	if amount <= 0 {
+		amount = DefaultFaucetAmount
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultFaucetCooldown
+	}
+
+	return &Faucet{
+		Address:       address,
+		Amount:        amount,
+		Cooldown:      cooldown,
+		lastByIP:      make(map[string]time.Time),
+		lastByAddress: make(map[string]time.Time),
+	}
+}
+
+// EnableFaucet enables the faucet endpoint
+// Only allowed on test networks so mainnet coins can never be given away
+func (s *Server) EnableFaucet(faucet *Faucet) error {
+	if !blockchain.IsTestNetwork() {
+		return fmt.Errorf("faucet is only available on testnet/regtest (current network: %s)", blockchain.GetNetwork())
+	}
+
+	if !blockchain.ValidateAddress(faucet.Address) {
+		return fmt.Errorf("invalid faucet address: %s", faucet.Address)
+	}
+
+	if wallet, ok := s.Wallets.Wallets[faucet.Address]; !ok || wallet == nil {
+		return fmt.Errorf("faucet address %s is not a wallet on this node", faucet.Address)
+	}
+
+	s.Faucet = faucet
+	log.Printf("🚰 Faucet enabled: %d coins per request from %s (cooldown %s)", faucet.Amount, faucet.Address, faucet.Cooldown)
+	return nil
+}
+
+// allow checks the rate limits for an IP and address and records the request
+func (f *Faucet) allow(ip, address string) (time.Duration, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+
+	if last, ok := f.lastByIP[ip]; ok && now.Sub(last) < f.Cooldown {
+		return f.Cooldown - now.Sub(last), false
+	}
+	if last, ok := f.lastByAddress[address]; ok && now.Sub(last) < f.Cooldown {
+		return f.Cooldown - now.Sub(last), false
+	}
+
+	f.lastByIP[ip] = now
+	f.lastByAddress[address] = now
+
+	return 0, true
+}
+
+// release forgets a recorded request (used when sending failed)
+func (f *Faucet) release(ip, address string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.lastByIP, ip)
+	delete(f.lastByAddress, address)
+}
+
+// handleFaucet sends test coins to an address
+// POST /api/faucet
+func (s *Server) handleFaucet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.Faucet == nil {
+		s.sendError(w, "Faucet is not enabled on this node", http.StatusNotFound)
+		return
+	}
+
+	var req FaucetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !blockchain.ValidateAddress(req.Address) {
+		s.sendErrorCode(w, ErrCodeInvalidAddress, "Invalid address format", nil, http.StatusBadRequest)
+		return
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	if s.Faucet.Captcha != nil {
+		if err := s.Faucet.Captcha(req.CaptchaToken, ip); err != nil {
+			s.sendError(w, fmt.Sprintf("Captcha verification failed: %v", err), http.StatusForbidden)
+			return
+		}
+	}
+
+	if wait, ok := s.Faucet.allow(ip, req.Address); !ok {
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", int(wait.Seconds())))
+		s.sendError(w, fmt.Sprintf("Rate limit exceeded, try again in %s", wait.Round(time.Second)), http.StatusTooManyRequests)
+		return
+	}
+
+	// Make sure the faucet can pay before building the transaction
+	faucetWallet := s.Wallets.GetWallet(s.Faucet.Address)
+	pubKeyHash := blockchain.HashPubKey(faucetWallet.PublicKey)
+
+	s.Blockchain.RLockState()
+	if acc, _ := s.Blockchain.FindSpendableOutputs(pubKeyHash, s.Faucet.Amount); acc < s.Faucet.Amount {
+		s.Blockchain.RUnlockState()
+		s.Faucet.release(ip, req.Address)
+		s.sendError(w, "Faucet is empty", http.StatusServiceUnavailable)
+		return
+	}
+	// The faucet address is public, so its change returns to it instead of a fresh change address
+	tx, err := blockchain.NewSignedTransaction(s.Faucet.Address, []blockchain.Recipient{{Address: req.Address, Amount: s.Faucet.Amount}},
+		0, nil, faucetWallet.Signer(), s.Blockchain)
+	s.Blockchain.RUnlockState()
+	if err != nil {
+		s.Faucet.release(ip, req.Address)
+		s.sendErr(w, "Failed to create transaction: ", err, http.StatusInternalServerError)
+		return
+	}
+	if err := s.relayTransaction(tx); err != nil {
+		s.Faucet.release(ip, req.Address)
+		s.sendRejected(w, err)
+		return
+	}
+
+	log.Printf("🚰 Faucet sent %d coins to %s (tx %x)", s.Faucet.Amount, req.Address, tx.ID)
+
+	response := FaucetResponse{
+		Success:     true,
+		TxID:        fmt.Sprintf("%x", tx.ID),
+		Amount:      s.Faucet.Amount,
+		Transaction: s.newTransactionResponse(tx),
+	}
+
+	s.sendJSON(w, response, http.StatusOK)
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Fee estimation targets, in blocks
+const (
+	DefaultFeeEstimateBlocks = 6
+	MaxFeeEstimateBlocks     = 100
+)
+
+type FeeEstimateResponse struct {
+	Blocks       int     `json:"blocks"`
+	FeeRate      float64 `json:"fee_rate"` // Suggested fee per byte (0 = any fee is mined)
+	MempoolTxs   int     `json:"mempool_txs"`
+	MempoolBytes int     `json:"mempool_bytes"`
+	MaxBlockSize int     `json:"max_block_size"` // Transaction bytes per block (mining policy)
+	RecentFill   float64 `json:"recent_fill"`    // Average fill of the recent blocks (0..1)
+	RecentBlocks int     `json:"recent_blocks"`  // Connected blocks the fill is averaged over
+}
+
+// FeeEstimator estimates fee rates from the mempool and recent blocks
+type FeeEstimator interface {
+	EstimateFee(blocks int) FeeEstimateResponse
+}
+
+// handleEstimateFee suggests a fee per byte to be mined within N blocks
+// GET /api/estimatefee?blocks=N
+func (s *Server) handleEstimateFee(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	blocks := ParseIntParam(r, "blocks", DefaultFeeEstimateBlocks)
+	if blocks < 1 || blocks > MaxFeeEstimateBlocks {
+		s.sendError(w, fmt.Sprintf("blocks must be between 1 and %d", MaxFeeEstimateBlocks), http.StatusBadRequest)
+		return
+	}
+
+	estimator, ok := s.NetworkServer.(FeeEstimator)
+	if !ok {
+		s.sendError(w, "Fee estimation is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	s.sendJSON(w, estimator.EstimateFee(blocks), http.StatusOK)
+}
@@ -0,0 +1,1258 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GraphQL (https://spec.graphql.org), the subset explorers use: query
+// operations with variables, aliases, arguments, named and inline fragments
+// and the @include and @skip directives. Mutations, subscriptions and
+// introspection beyond __typename are not served; GET /graphql without a
+// query returns the schema instead. Every field is nullable: a field that
+// fails resolves to null and its error is reported next to the data.
+
+const (
+	maxGraphQLQuerySize = 64 << 10 // Bytes of a request
+	maxGraphQLDepth     = 12       // Nested selection sets
+	maxGraphQLFields    = 20000    // Field values resolved per query
+)
+
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+}
+
+type GraphQLError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"` // Response keys and list indexes of the failed field
+}
+
+// GraphQLResponse carries no data when the query could not be executed
+type GraphQLResponse struct {
+	Data   interface{}    `json:"data,omitempty"`
+	Errors []GraphQLError `json:"errors,omitempty"`
+}
+
+// Document
+
+type gqlDocument struct {
+	operations []*gqlOperation
+	fragments  map[string]*gqlFragment
+}
+
+type gqlOperation struct {
+	kind       string // query, mutation or subscription
+	name       string
+	variables  []gqlVariableDefinition
+	selections []*gqlSelection
+}
+
+type gqlVariableDefinition struct {
+	name         string
+	typ          string // e.g. Int, String!, [String]
+	defaultValue interface{}
+}
+
+type gqlFragment struct {
+	on         string
+	selections []*gqlSelection
+}
+
+// gqlSelection is a field, a fragment spread (spread) or an inline fragment
+// (inline)
+type gqlSelection struct {
+	alias      string
+	name       string
+	args       map[string]interface{}
+	directives []gqlDirective
+	selections []*gqlSelection
+	spread     string
+	inline     bool
+	on         string // Type condition of an inline fragment, optional
+}
+
+type gqlDirective struct {
+	name string
+	args map[string]interface{}
+}
+
+// Values are int, float64, string, bool, nil, []interface{},
+// map[string]interface{}, or the two below
+type gqlVariable string
+type gqlEnum string
+
+// key is the name of a field in the response
+func (sel *gqlSelection) key() string {
+	if sel.alias != "" {
+		return sel.alias
+	}
+	return sel.name
+}
+
+// Lexer and parser
+
+type gqlTokenKind int
+
+const (
+	gqlEOF gqlTokenKind = iota
+	gqlPunct
+	gqlName
+	gqlInt
+	gqlFloat
+	gqlString
+)
+
+type gqlToken struct {
+	kind  gqlTokenKind
+	value string
+	pos   int
+}
+
+type gqlParser struct {
+	src string
+	pos int
+	tok gqlToken
+}
+
+// parseGraphQL parses a query document
+func parseGraphQL(src string) (*gqlDocument, error) {
+	p := &gqlParser{src: src}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	doc := &gqlDocument{fragments: make(map[string]*gqlFragment)}
+	for p.tok.kind != gqlEOF {
+		switch {
+		case p.peek("{"):
+			selections, err := p.parseSelectionSet(1)
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &gqlOperation{kind: "query", selections: selections})
+		case p.keyword("query"), p.keyword("mutation"), p.keyword("subscription"):
+			operation, err := p.parseOperation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, operation)
+		case p.keyword("fragment"):
+			name, fragment, err := p.parseFragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := doc.fragments[name]; ok {
+				return nil, fmt.Errorf("fragment %s is defined twice", name)
+			}
+			doc.fragments[name] = fragment
+		default:
+			return nil, p.unexpected()
+		}
+	}
+
+	if len(doc.operations) == 0 {
+		return nil, fmt.Errorf("the document has no operation")
+	}
+	return doc, nil
+}
+
+func (p *gqlParser) errorf(pos int, format string, args ...interface{}) error {
+	line, column := 1, 1
+	for _, c := range p.src[:pos] {
+		if c == '\n' {
+			line, column = line+1, 1
+		} else {
+			column++
+		}
+	}
+	return fmt.Errorf("syntax error at %d:%d: %s", line, column, fmt.Sprintf(format, args...))
+}
+
+func (p *gqlParser) unexpected() error {
+	if p.tok.kind == gqlEOF {
+		return p.errorf(p.tok.pos, "unexpected end of the document")
+	}
+	return p.errorf(p.tok.pos, "unexpected %q", p.tok.value)
+}
+
+// next reads the following token, skipping whitespace, commas and comments
+func (p *gqlParser) next() error {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' && p.src[p.pos] != '\r' {
+				p.pos++
+			}
+			continue
+		}
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' && c != ',' {
+			break
+		}
+		p.pos++
+	}
+
+	start := p.pos
+	if p.pos >= len(p.src) {
+		p.tok = gqlToken{kind: gqlEOF, pos: start}
+		return nil
+	}
+
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		p.tok = gqlToken{kind: gqlPunct, value: "...", pos: start}
+	case strings.IndexByte("!$&()[]{}:=@|", c) >= 0:
+		p.pos++
+		p.tok = gqlToken{kind: gqlPunct, value: string(c), pos: start}
+	case c == '_' || isGraphQLLetter(c):
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isGraphQLLetter(p.src[p.pos]) || isGraphQLDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		p.tok = gqlToken{kind: gqlName, value: p.src[start:p.pos], pos: start}
+	case c == '-' || isGraphQLDigit(c):
+		return p.lexNumber()
+	case c == '"':
+		return p.lexString()
+	default:
+		return p.errorf(start, "unexpected character %q", c)
+	}
+	return nil
+}
+
+func isGraphQLLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isGraphQLDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (p *gqlParser) lexNumber() error {
+	start := p.pos
+	kind := gqlInt
+	digits := func() int {
+		from := p.pos
+		for p.pos < len(p.src) && isGraphQLDigit(p.src[p.pos]) {
+			p.pos++
+		}
+		return p.pos - from
+	}
+
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	if digits() == 0 {
+		return p.errorf(start, "invalid number")
+	}
+	if p.pos < len(p.src) && p.src[p.pos] == '.' {
+		p.pos++
+		kind = gqlFloat
+		if digits() == 0 {
+			return p.errorf(start, "invalid number")
+		}
+	}
+	if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+		p.pos++
+		kind = gqlFloat
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.pos++
+		}
+		if digits() == 0 {
+			return p.errorf(start, "invalid number")
+		}
+	}
+	if p.pos < len(p.src) && (p.src[p.pos] == '_' || p.src[p.pos] == '.' || isGraphQLLetter(p.src[p.pos])) {
+		return p.errorf(start, "invalid number")
+	}
+
+	p.tok = gqlToken{kind: kind, value: p.src[start:p.pos], pos: start}
+	return nil
+}
+
+// lexString reads a string or a block string; the escapes of strings are
+// those of JSON
+func (p *gqlParser) lexString() error {
+	start := p.pos
+
+	if strings.HasPrefix(p.src[p.pos:], `"""`) {
+		end := strings.Index(p.src[p.pos+3:], `"""`)
+		if end < 0 {
+			return p.errorf(start, "unterminated string")
+		}
+		value := strings.ReplaceAll(p.src[p.pos+3:p.pos+3+end], `\"""`, `"""`)
+		p.pos += 3 + end + 3
+		p.tok = gqlToken{kind: gqlString, value: strings.TrimSpace(value), pos: start}
+		return nil
+	}
+
+	p.pos++
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' || p.src[p.pos] == '\r' {
+			return p.errorf(start, "unterminated string")
+		}
+		if p.src[p.pos] == '\\' {
+			p.pos += 2
+			continue
+		}
+		p.pos++
+		if p.src[p.pos-1] == '"' {
+			break
+		}
+	}
+
+	var value string
+	if err := json.Unmarshal([]byte(p.src[start:p.pos]), &value); err != nil {
+		return p.errorf(start, "invalid string")
+	}
+	p.tok = gqlToken{kind: gqlString, value: value, pos: start}
+	return nil
+}
+
+// peek reports whether the current token is the punctuator punct
+func (p *gqlParser) peek(punct string) bool {
+	return p.tok.kind == gqlPunct && p.tok.value == punct
+}
+
+// keyword reports whether the current token is the name word
+func (p *gqlParser) keyword(word string) bool {
+	return p.tok.kind == gqlName && p.tok.value == word
+}
+
+func (p *gqlParser) expect(punct string) error {
+	if !p.peek(punct) {
+		if p.tok.kind == gqlEOF {
+			return p.errorf(p.tok.pos, "expected %q, got the end of the document", punct)
+		}
+		return p.errorf(p.tok.pos, "expected %q, got %q", punct, p.tok.value)
+	}
+	return p.next()
+}
+
+func (p *gqlParser) expectName() (string, error) {
+	if p.tok.kind != gqlName {
+		return "", p.unexpected()
+	}
+	name := p.tok.value
+	return name, p.next()
+}
+
+func (p *gqlParser) parseOperation() (*gqlOperation, error) {
+	operation := &gqlOperation{kind: p.tok.value}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == gqlName {
+		operation.name = p.tok.value
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.peek("(") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		for !p.peek(")") {
+			definition, err := p.parseVariableDefinition()
+			if err != nil {
+				return nil, err
+			}
+			for _, other := range operation.variables {
+				if other.name == definition.name {
+					return nil, fmt.Errorf("variable $%s is defined twice", definition.name)
+				}
+			}
+			operation.variables = append(operation.variables, definition)
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := p.parseDirectives(); err != nil {
+		return nil, err
+	}
+	selections, err := p.parseSelectionSet(1)
+	if err != nil {
+		return nil, err
+	}
+	operation.selections = selections
+	return operation, nil
+}
+
+func (p *gqlParser) parseVariableDefinition() (gqlVariableDefinition, error) {
+	var definition gqlVariableDefinition
+	if err := p.expect("$"); err != nil {
+		return definition, err
+	}
+	name, err := p.expectName()
+	if err != nil {
+		return definition, err
+	}
+	if err := p.expect(":"); err != nil {
+		return definition, err
+	}
+	typ, err := p.parseType()
+	if err != nil {
+		return definition, err
+	}
+	definition = gqlVariableDefinition{name: name, typ: typ}
+
+	if p.peek("=") {
+		if err := p.next(); err != nil {
+			return definition, err
+		}
+		if definition.defaultValue, err = p.parseValue(true); err != nil {
+			return definition, err
+		}
+	}
+	_, err = p.parseDirectives()
+	return definition, err
+}
+
+// parseType returns a type reference as written, e.g. [String!]!
+func (p *gqlParser) parseType() (string, error) {
+	var typ string
+	if p.peek("[") {
+		if err := p.next(); err != nil {
+			return "", err
+		}
+		elem, err := p.parseType()
+		if err != nil {
+			return "", err
+		}
+		if err := p.expect("]"); err != nil {
+			return "", err
+		}
+		typ = "[" + elem + "]"
+	} else {
+		name, err := p.expectName()
+		if err != nil {
+			return "", err
+		}
+		typ = name
+	}
+
+	if p.peek("!") {
+		typ += "!"
+		return typ, p.next()
+	}
+	return typ, nil
+}
+
+func (p *gqlParser) parseFragment() (string, *gqlFragment, error) {
+	if err := p.next(); err != nil {
+		return "", nil, err
+	}
+	name, err := p.expectName()
+	if err != nil {
+		return "", nil, err
+	}
+	if name == "on" {
+		return "", nil, p.errorf(p.tok.pos, "a fragment cannot be named on")
+	}
+	if !p.keyword("on") {
+		return "", nil, p.errorf(p.tok.pos, "expected a type condition (on Type)")
+	}
+	if err := p.next(); err != nil {
+		return "", nil, err
+	}
+	on, err := p.expectName()
+	if err != nil {
+		return "", nil, err
+	}
+	if _, err := p.parseDirectives(); err != nil {
+		return "", nil, err
+	}
+	selections, err := p.parseSelectionSet(1)
+	if err != nil {
+		return "", nil, err
+	}
+	return name, &gqlFragment{on: on, selections: selections}, nil
+}
+
+func (p *gqlParser) parseSelectionSet(depth int) ([]*gqlSelection, error) {
+	if depth > maxGraphQLDepth {
+		return nil, p.errorf(p.tok.pos, "selections nested deeper than %d levels", maxGraphQLDepth)
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	var selections []*gqlSelection
+	for !p.peek("}") {
+		if p.tok.kind == gqlEOF {
+			return nil, p.unexpected()
+		}
+		selection, err := p.parseSelection(depth)
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, selection)
+	}
+	if len(selections) == 0 {
+		return nil, p.errorf(p.tok.pos, "empty selection set")
+	}
+	return selections, p.next()
+}
+
+func (p *gqlParser) parseSelection(depth int) (*gqlSelection, error) {
+	selection := &gqlSelection{}
+	var err error
+
+	if p.peek("...") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind == gqlName && p.tok.value != "on" {
+			selection.spread = p.tok.value
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			selection.directives, err = p.parseDirectives()
+			return selection, err
+		}
+
+		selection.inline = true
+		if p.keyword("on") {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			if selection.on, err = p.expectName(); err != nil {
+				return nil, err
+			}
+		}
+		if selection.directives, err = p.parseDirectives(); err != nil {
+			return nil, err
+		}
+		selection.selections, err = p.parseSelectionSet(depth + 1)
+		return selection, err
+	}
+
+	if selection.name, err = p.expectName(); err != nil {
+		return nil, err
+	}
+	if p.peek(":") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		selection.alias = selection.name
+		if selection.name, err = p.expectName(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek("(") {
+		if selection.args, err = p.parseArguments(); err != nil {
+			return nil, err
+		}
+	}
+	if selection.directives, err = p.parseDirectives(); err != nil {
+		return nil, err
+	}
+	if p.peek("{") {
+		if selection.selections, err = p.parseSelectionSet(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+	return selection, nil
+}
+
+func (p *gqlParser) parseArguments() (map[string]interface{}, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	args := make(map[string]interface{})
+	for !p.peek(")") {
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if _, ok := args[name]; ok {
+			return nil, fmt.Errorf("argument %s is given twice", name)
+		}
+		if args[name], err = p.parseValue(false); err != nil {
+			return nil, err
+		}
+	}
+	if len(args) == 0 {
+		return nil, p.errorf(p.tok.pos, "empty argument list")
+	}
+	return args, p.next()
+}
+
+func (p *gqlParser) parseDirectives() ([]gqlDirective, error) {
+	var directives []gqlDirective
+	for p.peek("@") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		directive := gqlDirective{name: name}
+		if p.peek("(") {
+			if directive.args, err = p.parseArguments(); err != nil {
+				return nil, err
+			}
+		}
+		directives = append(directives, directive)
+	}
+	return directives, nil
+}
+
+// parseValue parses a literal, or a variable unless constant
+func (p *gqlParser) parseValue(constant bool) (interface{}, error) {
+	tok := p.tok
+	switch tok.kind {
+	case gqlInt:
+		n, err := strconv.ParseInt(tok.value, 10, 64)
+		if err != nil || n > math.MaxInt32 || n < math.MinInt32 {
+			return nil, p.errorf(tok.pos, "integer %s out of range", tok.value)
+		}
+		return int(n), p.next()
+	case gqlFloat:
+		f, err := strconv.ParseFloat(tok.value, 64)
+		if err != nil {
+			return nil, p.errorf(tok.pos, "invalid number %s", tok.value)
+		}
+		return f, p.next()
+	case gqlString:
+		return tok.value, p.next()
+	case gqlName:
+		var value interface{}
+		switch tok.value {
+		case "true":
+			value = true
+		case "false":
+			value = false
+		case "null":
+			value = nil
+		default:
+			value = gqlEnum(tok.value)
+		}
+		return value, p.next()
+	}
+
+	switch {
+	case p.peek("$") && !constant:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		name, err := p.expectName()
+		return gqlVariable(name), err
+	case p.peek("["):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		list := []interface{}{}
+		for !p.peek("]") {
+			if p.tok.kind == gqlEOF {
+				return nil, p.unexpected()
+			}
+			item, err := p.parseValue(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		return list, p.next()
+	case p.peek("{"):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		object := make(map[string]interface{})
+		for !p.peek("}") {
+			name, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if object[name], err = p.parseValue(constant); err != nil {
+				return nil, err
+			}
+		}
+		return object, p.next()
+	}
+	return nil, p.unexpected()
+}
+
+// operation picks the operation a request runs
+func (doc *gqlDocument) operation(name string) (*gqlOperation, error) {
+	if name == "" {
+		if len(doc.operations) > 1 {
+			return nil, fmt.Errorf("operationName is required, the document has %d operations", len(doc.operations))
+		}
+		return doc.operations[0], nil
+	}
+
+	for _, operation := range doc.operations {
+		if operation.name == name {
+			return operation, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %q", name)
+}
+
+// Types
+
+var graphQLScalars = map[string]bool{"Int": true, "Float": true, "String": true, "Boolean": true}
+
+// listElem returns the element type of a list type
+func listElem(typ string) (string, bool) {
+	if strings.HasPrefix(typ, "[") && strings.HasSuffix(typ, "]") {
+		return typ[1 : len(typ)-1], true
+	}
+	return typ, false
+}
+
+// namedType strips the list and non-null wrappers of a type
+func namedType(typ string) string {
+	return strings.Trim(typ, "[]!")
+}
+
+// coerceGraphQL converts an argument or variable value to typ
+func coerceGraphQL(typ string, value interface{}) (interface{}, error) {
+	required := strings.HasSuffix(typ, "!")
+	typ = strings.TrimSuffix(typ, "!")
+	if value == nil {
+		if required {
+			return nil, fmt.Errorf("expected a non-null %s", typ)
+		}
+		return nil, nil
+	}
+
+	if elem, ok := listElem(typ); ok {
+		items, ok := value.([]interface{})
+		if !ok {
+			items = []interface{}{value}
+		}
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			var err error
+			if list[i], err = coerceGraphQL(elem, item); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	}
+
+	switch typ {
+	case "Int":
+		switch v := value.(type) {
+		case int:
+			return v, nil
+		case float64: // From JSON variables
+			if v == math.Trunc(v) && v <= math.MaxInt32 && v >= math.MinInt32 {
+				return int(v), nil
+			}
+		}
+	case "Float":
+		switch v := value.(type) {
+		case int:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		}
+	case "String":
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+	case "Boolean":
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown input type %s", typ)
+	}
+	return nil, fmt.Errorf("expected %s, got %s", typ, graphQLValueString(value))
+}
+
+func graphQLValueString(value interface{}) string {
+	switch v := value.(type) {
+	case gqlEnum:
+		return string(v)
+	case string:
+		return strconv.Quote(v)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// Execution
+
+// gqlObject is a response object, its fields in the order of the query
+type gqlObject []gqlEntry
+
+type gqlEntry struct {
+	key   string
+	value interface{}
+}
+
+func (o gqlObject) MarshalJSON() ([]byte, error) {
+	data := []byte{'{'}
+	for i, entry := range o {
+		if i > 0 {
+			data = append(data, ',')
+		}
+		key, _ := json.Marshal(entry.key)
+		value, err := json.Marshal(entry.value)
+		if err != nil {
+			return nil, err
+		}
+		data = append(append(append(data, key...), ':'), value...)
+	}
+	return append(data, '}'), nil
+}
+
+// gqlFieldGroup is the fields of a selection set sharing a response key,
+// merged into one
+type gqlFieldGroup struct {
+	key    string
+	fields []*gqlSelection
+}
+
+// gqlExecution runs one query; it is not safe for concurrent use
+type gqlExecution struct {
+	s         *Server
+	ctx       context.Context
+	doc       *gqlDocument
+	variables map[string]interface{}
+	errors    []GraphQLError
+	resolved  int  // Fields resolved so far
+	aborted   bool // Over budget or abandoned: nothing more is resolved
+	cache     gqlCache
+}
+
+// executeGraphQL runs a request; the status is that of the HTTP response
+func (s *Server) executeGraphQL(ctx context.Context, request GraphQLRequest) (GraphQLResponse, int) {
+	fail := func(err error) (GraphQLResponse, int) {
+		return GraphQLResponse{Errors: []GraphQLError{{Message: err.Error()}}}, http.StatusBadRequest
+	}
+
+	if strings.TrimSpace(request.Query) == "" {
+		return fail(fmt.Errorf("query is required"))
+	}
+	doc, err := parseGraphQL(request.Query)
+	if err != nil {
+		return fail(err)
+	}
+	operation, err := doc.operation(request.OperationName)
+	if err != nil {
+		return fail(err)
+	}
+	if operation.kind != "query" {
+		return fail(fmt.Errorf("only queries are supported, not %ss", operation.kind))
+	}
+
+	e := &gqlExecution{s: s, ctx: ctx, doc: doc, variables: make(map[string]interface{}), cache: newGraphQLCache()}
+	for _, definition := range operation.variables {
+		if !graphQLScalars[namedType(definition.typ)] {
+			return fail(fmt.Errorf("variable $%s: unknown input type %s", definition.name, namedType(definition.typ)))
+		}
+		value, ok := request.Variables[definition.name]
+		if !ok {
+			value = definition.defaultValue
+		}
+		if e.variables[definition.name], err = coerceGraphQL(definition.typ, value); err != nil {
+			return fail(fmt.Errorf("variable $%s: %v", definition.name, err))
+		}
+	}
+	if err := e.validate("Query", operation.selections, 1, make(map[string]bool)); err != nil {
+		return fail(err)
+	}
+
+	data := e.executeObject("Query", gqlQuery{}, operation.selections, nil)
+	return GraphQLResponse{Data: data, Errors: e.errors}, http.StatusOK
+}
+
+// validate checks selections against the schema before anything is resolved
+func (e *gqlExecution) validate(typeName string, selections []*gqlSelection, depth int, spreading map[string]bool) error {
+	if depth > maxGraphQLDepth {
+		return fmt.Errorf("selections nested deeper than %d levels", maxGraphQLDepth)
+	}
+
+	fields := graphQLSchema[typeName]
+	for _, selection := range selections {
+		for _, directive := range selection.directives {
+			if _, err := e.directiveCondition(directive); err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case selection.spread != "":
+			fragment, ok := e.doc.fragments[selection.spread]
+			if !ok {
+				return fmt.Errorf("unknown fragment %s", selection.spread)
+			}
+			if fragment.on != typeName {
+				return fmt.Errorf("fragment %s on %s cannot be spread within %s", selection.spread, fragment.on, typeName)
+			}
+			if spreading[selection.spread] {
+				return fmt.Errorf("fragment %s spreads itself", selection.spread)
+			}
+			spreading[selection.spread] = true
+			if err := e.validate(typeName, fragment.selections, depth, spreading); err != nil {
+				return err
+			}
+			delete(spreading, selection.spread)
+
+		case selection.inline:
+			if selection.on != "" && selection.on != typeName {
+				return fmt.Errorf("fragment on %s cannot be spread within %s", selection.on, typeName)
+			}
+			if err := e.validate(typeName, selection.selections, depth, spreading); err != nil {
+				return err
+			}
+
+		case selection.name == "__typename":
+			if selection.selections != nil {
+				return fmt.Errorf("field __typename of type String has no subfields")
+			}
+
+		default:
+			field, ok := fields[selection.name]
+			if !ok {
+				return fmt.Errorf("cannot query field %s on type %s", selection.name, typeName)
+			}
+			if _, err := e.arguments(field, selection); err != nil {
+				return fmt.Errorf("field %s: %v", selection.name, err)
+			}
+
+			elem := namedType(field.typ)
+			if graphQLScalars[elem] {
+				if selection.selections != nil {
+					return fmt.Errorf("field %s of type %s has no subfields", selection.name, field.typ)
+				}
+				continue
+			}
+			if selection.selections == nil {
+				return fmt.Errorf("field %s of type %s needs a selection of subfields", selection.name, field.typ)
+			}
+			if err := e.validate(elem, selection.selections, depth+1, spreading); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// value substitutes the variables of an argument value
+func (e *gqlExecution) value(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case gqlVariable:
+		resolved, ok := e.variables[string(v)]
+		if !ok {
+			return nil, fmt.Errorf("variable $%s is not defined", v)
+		}
+		return resolved, nil
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			var err error
+			if list[i], err = e.value(item); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	}
+	return value, nil
+}
+
+// arguments returns the arguments of a field, coerced to their types with
+// their defaults filled in
+func (e *gqlExecution) arguments(field *gqlField, selection *gqlSelection) (map[string]interface{}, error) {
+	for name := range selection.args {
+		known := false
+		for _, arg := range field.args {
+			known = known || arg.name == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown argument %s", name)
+		}
+	}
+
+	args := make(map[string]interface{}, len(field.args))
+	for _, arg := range field.args {
+		value, ok := selection.args[arg.name]
+		if !ok {
+			value = arg.defaultValue
+		}
+		value, err := e.value(value)
+		if err != nil {
+			return nil, err
+		}
+		if args[arg.name], err = coerceGraphQL(arg.typ, value); err != nil {
+			return nil, fmt.Errorf("argument %s: %v", arg.name, err)
+		}
+	}
+	return args, nil
+}
+
+// directiveCondition evaluates @include(if:) and @skip(if:): whether the
+// selection stays
+func (e *gqlExecution) directiveCondition(directive gqlDirective) (bool, error) {
+	if directive.name != "include" && directive.name != "skip" {
+		return false, fmt.Errorf("unknown directive @%s", directive.name)
+	}
+	if len(directive.args) != 1 || directive.args["if"] == nil {
+		return false, fmt.Errorf("directive @%s takes one argument, if", directive.name)
+	}
+	value, err := e.value(directive.args["if"])
+	if err == nil {
+		value, err = coerceGraphQL("Boolean!", value)
+	}
+	if err != nil {
+		return false, fmt.Errorf("directive @%s: %v", directive.name, err)
+	}
+	return value.(bool) == (directive.name == "include"), nil
+}
+
+func (e *gqlExecution) included(selection *gqlSelection) bool {
+	for _, directive := range selection.directives {
+		if keep, _ := e.directiveCondition(directive); !keep {
+			return false
+		}
+	}
+	return true
+}
+
+// collectFields flattens the fragments of a selection set and groups its
+// fields by response key
+func (e *gqlExecution) collectFields(selections []*gqlSelection, groups []*gqlFieldGroup, spread map[string]bool) []*gqlFieldGroup {
+	for _, selection := range selections {
+		if !e.included(selection) {
+			continue
+		}
+
+		switch {
+		case selection.spread != "":
+			if spread[selection.spread] {
+				continue
+			}
+			spread[selection.spread] = true
+			groups = e.collectFields(e.doc.fragments[selection.spread].selections, groups, spread)
+		case selection.inline:
+			groups = e.collectFields(selection.selections, groups, spread)
+		default:
+			merged := false
+			for _, group := range groups {
+				if group.key == selection.key() {
+					group.fields = append(group.fields, selection)
+					merged = true
+					break
+				}
+			}
+			if !merged {
+				groups = append(groups, &gqlFieldGroup{key: selection.key(), fields: []*gqlSelection{selection}})
+			}
+		}
+	}
+	return groups
+}
+
+func (e *gqlExecution) fail(path []interface{}, err error) {
+	e.errors = append(e.errors, GraphQLError{Message: err.Error(), Path: path})
+}
+
+// proceed counts a field about to be resolved; false once the query went
+// over budget or the client went away
+func (e *gqlExecution) proceed(path []interface{}) bool {
+	if e.aborted {
+		return false
+	}
+	if e.ctx.Err() != nil {
+		e.aborted = true
+		return false
+	}
+
+	e.resolved++
+	if e.resolved > maxGraphQLFields {
+		e.fail(path, fmt.Errorf("the query resolves more than %d fields, narrow it down", maxGraphQLFields))
+		e.aborted = true
+		return false
+	}
+	return true
+}
+
+// appendPath returns a copy of path with one more element
+func appendPath(path []interface{}, element interface{}) []interface{} {
+	return append(path[:len(path):len(path)], element)
+}
+
+func (e *gqlExecution) executeObject(typeName string, source gqlResolver, selections []*gqlSelection, path []interface{}) gqlObject {
+	object := gqlObject{}
+	for _, group := range e.collectFields(selections, nil, make(map[string]bool)) {
+		if group.fields[0].name == "__typename" {
+			object = append(object, gqlEntry{group.key, typeName})
+			continue
+		}
+		object = append(object, gqlEntry{group.key, e.executeField(typeName, source, group, appendPath(path, group.key))})
+	}
+	return object
+}
+
+func (e *gqlExecution) executeField(typeName string, source gqlResolver, group *gqlFieldGroup, path []interface{}) interface{} {
+	if !e.proceed(path) {
+		return nil
+	}
+
+	selection := group.fields[0]
+	field := graphQLSchema[typeName][selection.name]
+	args, err := e.arguments(field, selection)
+	if err != nil {
+		e.fail(path, err)
+		return nil
+	}
+
+	value, err := source.resolve(e, selection.name, args)
+	if err != nil {
+		e.fail(path, err)
+		return nil
+	}
+	return e.complete(field.typ, value, group, path)
+}
+
+// complete builds the response value of a resolved field, resolving the
+// subfields of objects
+func (e *gqlExecution) complete(typ string, value interface{}, group *gqlFieldGroup, path []interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	if elem, ok := listElem(typ); ok {
+		items := value.([]interface{})
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			list[i] = e.complete(elem, item, group, appendPath(path, i))
+		}
+		return list
+	}
+	if graphQLScalars[typ] {
+		return value
+	}
+
+	var selections []*gqlSelection
+	for _, field := range group.fields {
+		selections = append(selections, field.selections...)
+	}
+	return e.executeObject(typ, value.(gqlResolver), selections, path)
+}
+
+// graphQLSchemaSDL describes the schema in the GraphQL schema language
+func graphQLSchemaSDL() string {
+	names := make([]string, 0, len(graphQLSchema))
+	for name := range graphQLSchema {
+		if name != "Query" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var sdl strings.Builder
+	for _, name := range append([]string{"Query"}, names...) {
+		fmt.Fprintf(&sdl, "type %s {\n", name)
+		fields := make([]string, 0, len(graphQLSchema[name]))
+		for field := range graphQLSchema[name] {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		for _, fieldName := range fields {
+			field := graphQLSchema[name][fieldName]
+			fmt.Fprintf(&sdl, "  %s", fieldName)
+			if len(field.args) > 0 {
+				args := make([]string, len(field.args))
+				for i, arg := range field.args {
+					args[i] = arg.name + ": " + arg.typ
+					if arg.defaultValue != nil {
+						args[i] += " = " + graphQLValueString(arg.defaultValue)
+					}
+				}
+				fmt.Fprintf(&sdl, "(%s)", strings.Join(args, ", "))
+			}
+			fmt.Fprintf(&sdl, ": %s", field.typ)
+			if field.doc != "" {
+				fmt.Fprintf(&sdl, " # %s", field.doc)
+			}
+			sdl.WriteString("\n")
+		}
+		sdl.WriteString("}\n\n")
+	}
+	return sdl.String()
+}
+
+// handleGraphQL answers GraphQL queries over blocks, transactions, addresses
+// and the mempool; without a query it returns the schema
+// GET /graphql?query=...&variables=...&operationName=...
+// POST /graphql {"query": ..., "variables": {...}, "operationName": ...}
+func (s *Server) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var request GraphQLRequest
+
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		request.Query = query.Get("query")
+		request.OperationName = query.Get("operationName")
+		if request.Query == "" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			io.WriteString(w, graphQLSchemaSDL())
+			return
+		}
+		if variables := query.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+				s.sendJSON(w, GraphQLResponse{Errors: []GraphQLError{{Message: "variables must be a JSON object"}}}, http.StatusBadRequest)
+				return
+			}
+		}
+	case http.MethodPost:
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxGraphQLQuerySize+1))
+		if err != nil {
+			return
+		}
+		if len(body) > maxGraphQLQuerySize {
+			s.sendJSON(w, GraphQLResponse{Errors: []GraphQLError{{Message: fmt.Sprintf("request over %d bytes", maxGraphQLQuerySize)}}}, http.StatusRequestEntityTooLarge)
+			return
+		}
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/graphql") {
+			request.Query = string(body)
+		} else if err := json.Unmarshal(body, &request); err != nil {
+			s.sendJSON(w, GraphQLResponse{Errors: []GraphQLError{{Message: "invalid request body, expected {\"query\": ..., \"variables\": {...}}"}}}, http.StatusBadRequest)
+			return
+		}
+	default:
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if len(request.Query) > maxGraphQLQuerySize {
+		s.sendJSON(w, GraphQLResponse{Errors: []GraphQLError{{Message: fmt.Sprintf("query over %d bytes", maxGraphQLQuerySize)}}}, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	response, status := s.executeGraphQL(r.Context(), request)
+	if requestAbandoned(r, r.Context().Err()) {
+		return
+	}
+	s.sendJSON(w, response, status)
+}
@@ -0,0 +1,717 @@
+package api
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// GraphQL schema
+//
+// Explorers query blocks, transactions, addresses and the mempool, and follow
+// the links between them in one round trip, e.g.
+//
+//	{ block(height: 10) { hash transactions { txid outputs { value address { address balance } } } } }
+//
+// Lists are paged with offset and limit (at most 100 items). Amounts are in
+// the smallest unit, hashes and raw data in hex. A lookup that finds nothing
+// resolves to null.
+
+const maxGraphQLPageSize = 100
+
+type gqlField struct {
+	typ  string // Scalar or object type, [Type] for lists
+	args []gqlArg
+	doc  string
+}
+
+type gqlArg struct {
+	name         string
+	typ          string // Int, String or Boolean, ! when required
+	defaultValue interface{}
+}
+
+// gqlResolver is an object of the schema, resolving its fields by name
+type gqlResolver interface {
+	resolve(e *gqlExecution, field string, args map[string]interface{}) (interface{}, error)
+}
+
+var gqlPageArgs = []gqlArg{{"offset", "Int", 0}, {"limit", "Int", maxGraphQLPageSize}}
+
+var graphQLSchema = map[string]map[string]*gqlField{
+	"Query": {
+		"height":      {typ: "Int", doc: "Height of the main chain tip"},
+		"tip":         {typ: "Block", doc: "Main chain tip"},
+		"block":       {typ: "Block", args: []gqlArg{{"hash", "String", nil}, {"height", "Int", nil}}, doc: "By hash, or the main chain block at a height"},
+		"blocks":      {typ: "[Block]", args: []gqlArg{{"from", "Int", nil}, {"limit", "Int", 10}}, doc: "Main chain blocks from a height (the tip by default) down"},
+		"transaction": {typ: "Transaction", args: []gqlArg{{"txid", "String!", nil}}, doc: "In the main chain or the mempool"},
+		"address":     {typ: "Address", args: []gqlArg{{"address", "String!", nil}}},
+		"mempool":     {typ: "Mempool"},
+	},
+	"Block": {
+		"hash":             {typ: "String"},
+		"prevHash":         {typ: "String"},
+		"height":           {typ: "Int"},
+		"timestamp":        {typ: "Int"},
+		"nonce":            {typ: "Int"},
+		"version":          {typ: "Int", doc: "0 = legacy block without version bits"},
+		"utxoRoot":         {typ: "String"},
+		"size":             {typ: "Int"},
+		"coinbaseMessage":  {typ: "String"},
+		"mainChain":        {typ: "Boolean"},
+		"confirmations":    {typ: "Int", doc: "0 = not in the main chain"},
+		"finalized":        {typ: "Boolean"},
+		"pruned":           {typ: "Boolean", doc: "Only the transactions with unspent outputs are left"},
+		"transactionCount": {typ: "Int"},
+		"totalFees":        {typ: "Int"},
+		"transactions":     {typ: "[Transaction]", args: gqlPageArgs},
+		"previous":         {typ: "Block"},
+		"next":             {typ: "Block", doc: "Main chain successor"},
+	},
+	"Transaction": {
+		"txid":            {typ: "String"},
+		"hex":             {typ: "String", doc: "Raw transaction"},
+		"coinbase":        {typ: "Boolean"},
+		"coinbaseMessage": {typ: "String"},
+		"replaceable":     {typ: "Boolean", doc: "Signals opt-in replacement"},
+		"size":            {typ: "Int"},
+		"fee":             {typ: "Int"},
+		"feeRate":         {typ: "Float", doc: "Fee per byte"},
+		"inMempool":       {typ: "Boolean"},
+		"block":           {typ: "Block", doc: "null while in the mempool"},
+		"height":          {typ: "Int"},
+		"timestamp":       {typ: "Int", doc: "Of the block, or when it entered the mempool"},
+		"confirmations":   {typ: "Int"},
+		"inputs":          {typ: "[Input]"},
+		"outputs":         {typ: "[Output]"},
+	},
+	"Input": {
+		"txid":        {typ: "String", doc: "Transaction of the spent output"},
+		"out":         {typ: "Int"},
+		"sequence":    {typ: "Int"},
+		"value":       {typ: "Int", doc: "Value of the spent output"},
+		"address":     {typ: "Address", doc: "Owner of the spent output"},
+		"spentOutput": {typ: "Output"},
+	},
+	"Output": {
+		"index":       {typ: "Int"},
+		"value":       {typ: "Int"},
+		"address":     {typ: "Address", doc: "null for data-carrier outputs"},
+		"data":        {typ: "String", doc: "Data of a data-carrier output"},
+		"transaction": {typ: "Transaction"},
+	},
+	"Address": {
+		"address":          {typ: "String", doc: "Base58"},
+		"bech32":           {typ: "String"},
+		"balance":          {typ: "Int"},
+		"spendable":        {typ: "Int"},
+		"immature":         {typ: "Int", doc: "Mining rewards younger than the coinbase maturity"},
+		"transactionCount": {typ: "Int"},
+		"transactions":     {typ: "[AddressTransaction]", args: gqlPageArgs, doc: "Main chain, newest first"},
+	},
+	"AddressTransaction": {
+		"txid":        {typ: "String"},
+		"height":      {typ: "Int"},
+		"received":    {typ: "Int", doc: "Value of the outputs paying the address"},
+		"sent":        {typ: "Int", doc: "Value of the address outputs spent"},
+		"net":         {typ: "Int"},
+		"transaction": {typ: "Transaction"},
+	},
+	"Mempool": {
+		"count":        {typ: "Int"},
+		"size":         {typ: "Int"},
+		"totalFee":     {typ: "Int"},
+		"transactions": {typ: "[Transaction]", args: gqlPageArgs, doc: "In the order block selection takes them"},
+	},
+}
+
+// gqlCache shares what a query looks up more than once
+type gqlCache struct {
+	blocks    map[string]*gqlBlock
+	txs       map[string]*gqlTx
+	balances  map[string]blockchain.Balance
+	histories map[string][]blockchain.AddressTx
+	mempool   []MempoolEntry // nil until listed
+}
+
+func newGraphQLCache() gqlCache {
+	return gqlCache{
+		blocks:    make(map[string]*gqlBlock),
+		txs:       make(map[string]*gqlTx),
+		balances:  make(map[string]blockchain.Balance),
+		histories: make(map[string][]blockchain.AddressTx),
+	}
+}
+
+type gqlQuery struct{}
+
+type gqlBlock struct {
+	block     *blockchain.Block
+	mainChain bool
+	txs       []interface{} // *gqlTx, built on first use
+}
+
+type gqlTx struct {
+	tx      *blockchain.Transaction
+	block   *gqlBlock // nil while in the mempool
+	time    int64     // When it entered the mempool
+	prevTXs map[string]blockchain.Transaction
+	prevErr error
+	looked  bool // prevTXs looked up
+}
+
+type gqlInput struct {
+	tx    *gqlTx
+	index int
+}
+
+type gqlOutput struct {
+	tx    *gqlTx
+	index int
+}
+
+type gqlAddress struct {
+	pubKeyHash []byte
+}
+
+type gqlAddressTx struct {
+	entry blockchain.AddressTx
+}
+
+type gqlMempool struct {
+	entries []MempoolEntry
+}
+
+func unknownGraphQLField(typeName, field string) error {
+	return fmt.Errorf("no resolver for %s.%s", typeName, field)
+}
+
+// Lookups return nil pointers for what does not exist; blockValue and
+// txValue turn them into untyped nils so that their fields resolve to null
+func blockValue(block *gqlBlock, err error) (interface{}, error) {
+	if block == nil {
+		return nil, err
+	}
+	return block, err
+}
+
+func txValue(tx *gqlTx, err error) (interface{}, error) {
+	if tx == nil {
+		return nil, err
+	}
+	return tx, err
+}
+
+// page returns the bounds of the items an offset and limit select out of n
+func page(n int, args map[string]interface{}) (int, int, error) {
+	offset, _ := args["offset"].(int)
+	limit, ok := args["limit"].(int)
+	if !ok {
+		limit = maxGraphQLPageSize
+	}
+	if offset < 0 || limit < 0 {
+		return 0, 0, fmt.Errorf("offset and limit cannot be negative")
+	}
+	if limit > maxGraphQLPageSize {
+		return 0, 0, fmt.Errorf("limit is at most %d", maxGraphQLPageSize)
+	}
+
+	from := min(offset, n)
+	return from, min(from+limit, n), nil
+}
+
+func (e *gqlExecution) block(hash []byte) (*gqlBlock, error) {
+	key := hex.EncodeToString(hash)
+	if block, ok := e.cache.blocks[key]; ok {
+		return block, nil
+	}
+
+	stored, err := e.s.Blockchain.GetBlock(hash)
+	if err != nil {
+		return nil, nil
+	}
+	mainHash, err := e.s.Blockchain.MainChainHashAt(stored.Height)
+	block := &gqlBlock{block: &stored, mainChain: err == nil && bytes.Equal(mainHash, stored.Hash)}
+	e.cache.blocks[key] = block
+	return block, nil
+}
+
+func (e *gqlExecution) blockAtHeight(height int) (*gqlBlock, error) {
+	if height < 0 || height > e.s.Blockchain.GetBestHeight() {
+		return nil, nil
+	}
+	hash, err := e.s.Blockchain.MainChainHashAt(height)
+	if err != nil {
+		return nil, err
+	}
+	return e.block(hash)
+}
+
+// transaction looks a transaction up in the main chain, then in the mempool
+func (e *gqlExecution) transaction(txID []byte) (*gqlTx, error) {
+	key := hex.EncodeToString(txID)
+	if tx, ok := e.cache.txs[key]; ok {
+		return tx, nil
+	}
+
+	found, location, err := e.s.Blockchain.FindTransactionLocation(txID)
+	if errors.Is(err, blockchain.ErrTxNotFound) {
+		tx := e.pendingTransaction(key)
+		e.cache.txs[key] = tx
+		return tx, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := e.block(location.BlockHash)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block %x of transaction %s not found", location.BlockHash, key)
+	}
+	tx := &gqlTx{tx: &found, block: block}
+	e.cache.txs[key] = tx
+	return tx, nil
+}
+
+// pendingTransaction returns a mempool transaction, nil when it is not there
+func (e *gqlExecution) pendingTransaction(txID string) *gqlTx {
+	inspector, ok := e.s.NetworkServer.(MempoolInspector)
+	if !ok {
+		return nil
+	}
+	tx, found := inspector.MempoolTransaction(txID)
+	if !found {
+		return nil
+	}
+
+	pending := &gqlTx{tx: tx}
+	if entries, err := e.mempoolEntries(); err == nil {
+		for _, entry := range entries {
+			if entry.TxID == txID {
+				pending.time = entry.Time
+				break
+			}
+		}
+	}
+	return pending
+}
+
+func (e *gqlExecution) mempoolEntries() ([]MempoolEntry, error) {
+	if e.cache.mempool != nil {
+		return e.cache.mempool, nil
+	}
+	lister, ok := e.s.NetworkServer.(MempoolLister)
+	if !ok {
+		return nil, fmt.Errorf("the mempool is not available")
+	}
+	e.cache.mempool = append([]MempoolEntry{}, lister.MempoolEntries()...)
+	return e.cache.mempool, nil
+}
+
+func (e *gqlExecution) balance(pubKeyHash []byte) (blockchain.Balance, error) {
+	key := hex.EncodeToString(pubKeyHash)
+	if balance, ok := e.cache.balances[key]; ok {
+		return balance, nil
+	}
+	balance, err := e.s.Blockchain.BalanceContext(e.ctx, pubKeyHash)
+	if err != nil {
+		return balance, err
+	}
+	e.cache.balances[key] = balance
+	return balance, nil
+}
+
+func (e *gqlExecution) history(pubKeyHash []byte) ([]blockchain.AddressTx, error) {
+	key := hex.EncodeToString(pubKeyHash)
+	if history, ok := e.cache.histories[key]; ok {
+		return history, nil
+	}
+	history, err := e.s.Blockchain.AddressHistory(e.ctx, pubKeyHash)
+	if err != nil {
+		return nil, err
+	}
+	e.cache.histories[key] = history
+	return history, nil
+}
+
+func (gqlQuery) resolve(e *gqlExecution, field string, args map[string]interface{}) (interface{}, error) {
+	switch field {
+	case "height":
+		return e.s.Blockchain.GetBestHeight(), nil
+	case "tip":
+		return blockValue(e.block(e.s.Blockchain.GetLastBlock().Hash))
+	case "block":
+		hash, height := args["hash"], args["height"]
+		switch {
+		case hash != nil && height != nil:
+			return nil, fmt.Errorf("pass either hash or height, not both")
+		case hash != nil:
+			decoded, err := hex.DecodeString(hash.(string))
+			if err != nil || len(decoded) == 0 {
+				return nil, fmt.Errorf("invalid block hash format")
+			}
+			return blockValue(e.block(decoded))
+		case height != nil:
+			return blockValue(e.blockAtHeight(height.(int)))
+		}
+		return nil, fmt.Errorf("pass hash or height")
+	case "blocks":
+		from := e.s.Blockchain.GetBestHeight()
+		if height, ok := args["from"].(int); ok {
+			from = min(height, from)
+		}
+		limit, _ := args["limit"].(int)
+		if limit < 0 || limit > maxGraphQLPageSize {
+			return nil, fmt.Errorf("limit is between 0 and %d", maxGraphQLPageSize)
+		}
+		blocks := []interface{}{}
+		for height := from; height > from-limit; height-- {
+			block, err := e.blockAtHeight(height)
+			if err != nil {
+				return nil, err
+			}
+			if block != nil {
+				blocks = append(blocks, block)
+			}
+		}
+		return blocks, nil
+	case "transaction":
+		txID, err := hex.DecodeString(args["txid"].(string))
+		if err != nil || len(txID) == 0 {
+			return nil, fmt.Errorf("invalid transaction ID format")
+		}
+		return txValue(e.transaction(txID))
+	case "address":
+		pubKeyHash, err := blockchain.AddressToPubKeyHash(args["address"].(string))
+		if err != nil {
+			return nil, fmt.Errorf("invalid address: %v", err)
+		}
+		return &gqlAddress{pubKeyHash: pubKeyHash}, nil
+	case "mempool":
+		entries, err := e.mempoolEntries()
+		if err != nil {
+			return nil, err
+		}
+		return &gqlMempool{entries: entries}, nil
+	}
+	return nil, unknownGraphQLField("Query", field)
+}
+
+func (b *gqlBlock) transactions() []interface{} {
+	if b.txs == nil {
+		b.txs = make([]interface{}, len(b.block.Transactions))
+		for i, tx := range b.block.Transactions {
+			b.txs[i] = &gqlTx{tx: tx, block: b}
+		}
+	}
+	return b.txs
+}
+
+func (b *gqlBlock) resolve(e *gqlExecution, field string, args map[string]interface{}) (interface{}, error) {
+	block := b.block
+	switch field {
+	case "hash":
+		return fmt.Sprintf("%x", block.Hash), nil
+	case "prevHash":
+		return fmt.Sprintf("%x", block.PrevHash), nil
+	case "height":
+		return block.Height, nil
+	case "timestamp":
+		return block.Timestamp, nil
+	case "nonce":
+		return block.Nonce, nil
+	case "version":
+		return int(block.Version), nil
+	case "utxoRoot":
+		if len(block.UTXORoot) == 0 {
+			return nil, nil
+		}
+		return fmt.Sprintf("%x", block.UTXORoot), nil
+	case "size":
+		return block.Size(), nil
+	case "coinbaseMessage":
+		if message := block.CoinbaseMessage(); message != "" {
+			return message, nil
+		}
+		return nil, nil
+	case "mainChain":
+		return b.mainChain, nil
+	case "confirmations":
+		if !b.mainChain {
+			return 0, nil
+		}
+		return e.s.Blockchain.GetBestHeight() - block.Height + 1, nil
+	case "finalized":
+		return b.mainChain && e.s.Blockchain.IsFinalized(block.Height), nil
+	case "pruned":
+		return b.mainChain && e.s.Blockchain.IsPruned(block.Height), nil
+	case "transactionCount":
+		return len(block.Transactions), nil
+	case "totalFees":
+		total := 0
+		for _, tx := range b.transactions() {
+			fee, err := tx.(*gqlTx).fee(e)
+			if err != nil {
+				return nil, err
+			}
+			total += fee
+		}
+		return total, nil
+	case "transactions":
+		txs := b.transactions()
+		from, to, err := page(len(txs), args)
+		if err != nil {
+			return nil, err
+		}
+		return txs[from:to], nil
+	case "previous":
+		if block.Height == 0 {
+			return nil, nil
+		}
+		return blockValue(e.block(block.PrevHash))
+	case "next":
+		if !b.mainChain {
+			return nil, nil
+		}
+		return blockValue(e.blockAtHeight(block.Height + 1))
+	}
+	return nil, unknownGraphQLField("Block", field)
+}
+
+// prev returns the transactions whose outputs t spends
+func (t *gqlTx) prev(e *gqlExecution) (map[string]blockchain.Transaction, error) {
+	if !t.looked {
+		t.looked = true
+		t.prevTXs, t.prevErr = e.s.Blockchain.PrevTransactionsContext(e.ctx, t.tx)
+	}
+	return t.prevTXs, t.prevErr
+}
+
+func (t *gqlTx) fee(e *gqlExecution) (int, error) {
+	if t.tx.IsCoinbase() {
+		return 0, nil
+	}
+	prevTXs, err := t.prev(e)
+	if err != nil {
+		return 0, err
+	}
+	return t.tx.Fee(prevTXs), nil
+}
+
+func (t *gqlTx) resolve(e *gqlExecution, field string, args map[string]interface{}) (interface{}, error) {
+	tx := t.tx
+	switch field {
+	case "txid":
+		return fmt.Sprintf("%x", tx.ID), nil
+	case "hex":
+		return tx.Hex(), nil
+	case "coinbase":
+		return tx.IsCoinbase(), nil
+	case "coinbaseMessage":
+		if message := tx.CoinbaseMessage(); message != "" {
+			return message, nil
+		}
+		return nil, nil
+	case "replaceable":
+		return tx.SignalsReplacement(), nil
+	case "size":
+		return tx.Size(), nil
+	case "fee":
+		return t.fee(e)
+	case "feeRate":
+		fee, err := t.fee(e)
+		if err != nil {
+			return nil, err
+		}
+		return float64(fee) / float64(tx.Size()), nil
+	case "inMempool":
+		return t.block == nil, nil
+	case "block":
+		if t.block == nil {
+			return nil, nil
+		}
+		return t.block, nil
+	case "height":
+		if t.block == nil {
+			return nil, nil
+		}
+		return t.block.block.Height, nil
+	case "timestamp":
+		if t.block == nil {
+			return t.time, nil
+		}
+		return t.block.block.Timestamp, nil
+	case "confirmations":
+		if t.block == nil || !t.block.mainChain {
+			return 0, nil
+		}
+		return e.s.Blockchain.GetBestHeight() - t.block.block.Height + 1, nil
+	case "inputs":
+		inputs := []interface{}{}
+		if !tx.IsCoinbase() {
+			for i := range tx.Inputs {
+				inputs = append(inputs, &gqlInput{tx: t, index: i})
+			}
+		}
+		return inputs, nil
+	case "outputs":
+		outputs := make([]interface{}, len(tx.Outputs))
+		for i := range tx.Outputs {
+			outputs[i] = &gqlOutput{tx: t, index: i}
+		}
+		return outputs, nil
+	}
+	return nil, unknownGraphQLField("Transaction", field)
+}
+
+func (i *gqlInput) resolve(e *gqlExecution, field string, args map[string]interface{}) (interface{}, error) {
+	in := &i.tx.tx.Inputs[i.index]
+	switch field {
+	case "txid":
+		return fmt.Sprintf("%x", in.ID), nil
+	case "out":
+		return in.Out, nil
+	case "sequence":
+		return int(in.Sequence), nil
+	case "value":
+		prevTXs, err := i.tx.prev(e)
+		if err != nil {
+			return nil, err
+		}
+		prevTX, ok := prevTXs[hex.EncodeToString(in.ID)]
+		if !ok || in.Out < 0 || in.Out >= len(prevTX.Outputs) {
+			return nil, nil
+		}
+		return prevTX.Outputs[in.Out].Value, nil
+	case "address":
+		return &gqlAddress{pubKeyHash: in.LockingHash()}, nil
+	case "spentOutput":
+		tx, err := e.transaction(in.ID)
+		if tx == nil || in.Out < 0 || in.Out >= len(tx.tx.Outputs) {
+			return nil, err
+		}
+		return &gqlOutput{tx: tx, index: in.Out}, nil
+	}
+	return nil, unknownGraphQLField("Input", field)
+}
+
+func (o *gqlOutput) resolve(e *gqlExecution, field string, args map[string]interface{}) (interface{}, error) {
+	out := &o.tx.tx.Outputs[o.index]
+	switch field {
+	case "index":
+		return o.index, nil
+	case "value":
+		return out.Value, nil
+	case "address":
+		if out.IsDataCarrier() {
+			return nil, nil
+		}
+		return &gqlAddress{pubKeyHash: out.PubKeyHash}, nil
+	case "data":
+		if !out.IsDataCarrier() {
+			return nil, nil
+		}
+		return hex.EncodeToString(out.Data()), nil
+	case "transaction":
+		return o.tx, nil
+	}
+	return nil, unknownGraphQLField("Output", field)
+}
+
+func (a *gqlAddress) resolve(e *gqlExecution, field string, args map[string]interface{}) (interface{}, error) {
+	switch field {
+	case "address":
+		return string(blockchain.PubKeyHashToAddress(a.pubKeyHash)), nil
+	case "bech32":
+		return blockchain.PubKeyHashToBech32Address(a.pubKeyHash), nil
+	case "balance", "spendable", "immature":
+		balance, err := e.balance(a.pubKeyHash)
+		if err != nil {
+			return nil, err
+		}
+		switch field {
+		case "spendable":
+			return balance.Spendable, nil
+		case "immature":
+			return balance.Immature, nil
+		}
+		return balance.Total, nil
+	case "transactionCount", "transactions":
+		history, err := e.history(a.pubKeyHash)
+		if err != nil {
+			return nil, err
+		}
+		if field == "transactionCount" {
+			return len(history), nil
+		}
+		from, to, err := page(len(history), args)
+		if err != nil {
+			return nil, err
+		}
+		txs := make([]interface{}, 0, to-from)
+		for _, entry := range history[from:to] {
+			txs = append(txs, &gqlAddressTx{entry: entry})
+		}
+		return txs, nil
+	}
+	return nil, unknownGraphQLField("Address", field)
+}
+
+func (a *gqlAddressTx) resolve(e *gqlExecution, field string, args map[string]interface{}) (interface{}, error) {
+	switch field {
+	case "txid":
+		return fmt.Sprintf("%x", a.entry.TxID), nil
+	case "height":
+		return a.entry.Height, nil
+	case "received":
+		return a.entry.Received, nil
+	case "sent":
+		return a.entry.Sent, nil
+	case "net":
+		return a.entry.Net(), nil
+	case "transaction":
+		return txValue(e.transaction(a.entry.TxID))
+	}
+	return nil, unknownGraphQLField("AddressTransaction", field)
+}
+
+func (m *gqlMempool) resolve(e *gqlExecution, field string, args map[string]interface{}) (interface{}, error) {
+	switch field {
+	case "count":
+		return len(m.entries), nil
+	case "size", "totalFee":
+		size, fees := 0, 0
+		for _, entry := range m.entries {
+			size += entry.Size
+			fees += entry.Fee
+		}
+		if field == "size" {
+			return size, nil
+		}
+		return fees, nil
+	case "transactions":
+		from, to, err := page(len(m.entries), args)
+		if err != nil {
+			return nil, err
+		}
+		txs := make([]interface{}, 0, to-from)
+		for _, entry := range m.entries[from:to] {
+			txID, _ := hex.DecodeString(entry.TxID)
+			tx, err := e.transaction(txID)
+			if err != nil {
+				return nil, err
+			}
+			if tx != nil {
+				txs = append(txs, tx)
+			}
+		}
+		return txs, nil
+	}
+	return nil, unknownGraphQLField("Mempool", field)
+}
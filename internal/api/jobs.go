@@ -0,0 +1,371 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// Job states
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Job types
+const (
+	JobReindex     = "reindex"     // Rebuild the UTXO set
+	JobRescan      = "rescan"      // Recompute the balances of all wallet addresses
+	JobVerifyChain = "verifychain" // Fully re-validate the stored chain
+)
+
+var errJobNotFound = errors.New("job not found")
+
+// Job queue limits
+const (
+	jobQueueSize = 16
+	jobRetention = 24 * time.Hour // Finished jobs are kept this long for result retrieval
+	jobIDBytes   = 8
+)
+
+// JobFunc runs a job, reporting progress as (done, total)
+// It should return early once ctx is done (the job was cancelled)
+type JobFunc func(ctx context.Context, progress func(done, total int)) (interface{}, error)
+
+// Job is a long-running operation executed in the background
+// Jobs are independent of the HTTP request that started them, so clients
+// can disconnect and poll for the result later; a job nobody waits for
+// anymore is cancelled explicitly
+type Job struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	Status     string      `json:"status"`
+	Progress   float64     `json:"progress"` // Percentage 0-100
+	Result     interface{} `json:"result,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	CreatedAt  int64       `json:"created_at"`
+	StartedAt  int64       `json:"started_at,omitempty"`
+	FinishedAt int64       `json:"finished_at,omitempty"`
+
+	run    JobFunc
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// JobQueue runs jobs one at a time in submission order
+type JobQueue struct {
+	jobs  map[string]*Job
+	queue chan *Job
+	mu    sync.Mutex
+}
+
+// NewJobQueue creates a job queue and starts its worker
+func NewJobQueue() *JobQueue {
+	q := &JobQueue{
+		jobs:  make(map[string]*Job),
+		queue: make(chan *Job, jobQueueSize),
+	}
+	go q.worker()
+	return q
+}
+
+// Submit queues a job and returns a snapshot of it
+func (q *JobQueue) Submit(jobType string, run JobFunc) (Job, error) {
+	id := make([]byte, jobIDBytes)
+	if _, err := rand.Read(id); err != nil {
+		return Job{}, err
+	}
+
+	job := &Job{
+		ID:        hex.EncodeToString(id),
+		Type:      jobType,
+		Status:    JobQueued,
+		CreatedAt: time.Now().Unix(),
+		run:       run,
+	}
+	job.ctx, job.cancel = context.WithCancel(context.Background())
+
+	q.mu.Lock()
+	q.prune()
+	q.jobs[job.ID] = job
+	snapshot := *job
+	q.mu.Unlock()
+
+	select {
+	case q.queue <- job:
+	default:
+		q.mu.Lock()
+		delete(q.jobs, job.ID)
+		q.mu.Unlock()
+		job.cancel()
+		return Job{}, fmt.Errorf("job queue is full")
+	}
+
+	log.Printf("🗂️  Job %s (%s) queued", job.ID, job.Type)
+	return snapshot, nil
+}
+
+// Get returns a snapshot of a job
+func (q *JobQueue) Get(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// Cancel stops a queued or running job and returns a snapshot of it
+// A running job stops at its next cancellation check
+func (q *JobQueue) Cancel(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, errJobNotFound
+	}
+	if job.FinishedAt != 0 {
+		return *job, fmt.Errorf("job is already %s", job.Status)
+	}
+
+	job.cancel()
+	if job.Status == JobQueued {
+		job.Status = JobCancelled
+		job.FinishedAt = time.Now().Unix()
+	}
+
+	log.Printf("🗂️  Job %s (%s) cancelled", job.ID, job.Type)
+	return *job, nil
+}
+
+// List returns snapshots of all jobs, newest first
+func (q *JobQueue) List() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.prune()
+	jobs := make([]Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt > jobs[j].CreatedAt
+	})
+	return jobs
+}
+
+// prune drops finished jobs past the retention period; the caller must hold q.mu
+func (q *JobQueue) prune() {
+	cutoff := time.Now().Add(-jobRetention).Unix()
+	for id, job := range q.jobs {
+		if job.FinishedAt != 0 && job.FinishedAt < cutoff {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+func (q *JobQueue) worker() {
+	for job := range q.queue {
+		q.mu.Lock()
+		if job.Status == JobCancelled {
+			q.mu.Unlock()
+			continue
+		}
+		job.Status = JobRunning
+		job.StartedAt = time.Now().Unix()
+		q.mu.Unlock()
+
+		log.Printf("🗂️  Job %s (%s) started", job.ID, job.Type)
+
+		result, err := job.run(job.ctx, func(done, total int) {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+
+			if total > 0 {
+				job.Progress = float64(done) * 100 / float64(total)
+			}
+		})
+
+		job.cancel()
+
+		q.mu.Lock()
+		job.FinishedAt = time.Now().Unix()
+		if err != nil && job.ctx.Err() != nil {
+			job.Status = JobCancelled
+		} else if err != nil {
+			job.Status = JobFailed
+			job.Error = err.Error()
+		} else {
+			job.Status = JobCompleted
+			job.Progress = 100
+			job.Result = result
+		}
+		q.mu.Unlock()
+
+		log.Printf("🗂️  Job %s (%s) %s", job.ID, job.Type, job.Status)
+	}
+}
+
+type JobRequest struct {
+	Type string `json:"type"`
+}
+
+type JobsResponse struct {
+	Jobs []Job `json:"jobs"`
+}
+
+type RescanResult struct {
+	Balances map[string]int `json:"balances"`
+	Total    int            `json:"total"`
+}
+
+type VerifyChainResult struct {
+	Blocks int `json:"blocks"`
+}
+
+// jobFunc returns the implementation of a job type
+func (s *Server) jobFunc(jobType string) (JobFunc, bool) {
+	switch jobType {
+	case JobReindex:
+		return func(ctx context.Context, progress func(done, total int)) (interface{}, error) {
+			// Not interruptible: a half rebuilt UTXO set would be inconsistent
+			if err := s.Blockchain.ReindexUTXO(); err != nil {
+				return nil, err
+			}
+
+			s.Blockchain.RLockState()
+			defer s.Blockchain.RUnlockState()
+
+			UTXOSet := blockchain.UTXOSet{Blockchain: s.Blockchain}
+			return map[string]int{"transactions": UTXOSet.CountTransactions()}, nil
+		}, true
+
+	case JobRescan:
+		return func(ctx context.Context, progress func(done, total int)) (interface{}, error) {
+			s.Blockchain.RLockState()
+			defer s.Blockchain.RUnlockState()
+
+			UTXOSet := blockchain.UTXOSet{Blockchain: s.Blockchain}
+			addresses := s.Wallets.GetAllAddresses()
+			result := RescanResult{Balances: make(map[string]int)}
+
+			for i, address := range addresses {
+				pubKeyHash, _ := blockchain.AddressToPubKeyHash(address)
+
+				UTXOs, err := UTXOSet.FindUTXOContext(ctx, pubKeyHash)
+				if err != nil {
+					return nil, err
+				}
+
+				balance := 0
+				for _, out := range UTXOs {
+					balance += out.Value
+				}
+				result.Balances[address] = balance
+				result.Total += balance
+				progress(i+1, len(addresses))
+			}
+
+			return result, nil
+		}, true
+
+	case JobVerifyChain:
+		return func(ctx context.Context, progress func(done, total int)) (interface{}, error) {
+			var blocks int
+			err := s.Blockchain.VerifyChainContext(ctx, func(done, total int) {
+				blocks = done
+				progress(done, total)
+			})
+			if err != nil {
+				return nil, err
+			}
+			return VerifyChainResult{Blocks: blocks}, nil
+		}, true
+	}
+
+	return nil, false
+}
+
+// handleJobs starts a background job or lists jobs
+// POST /api/jobs {"type": "reindex" | "rescan" | "verifychain"}
+// GET  /api/jobs
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.sendJSON(w, JobsResponse{Jobs: s.Jobs.List()}, http.StatusOK)
+
+	case http.MethodPost:
+		var req JobRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.sendError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		run, ok := s.jobFunc(req.Type)
+		if !ok {
+			s.sendError(w, fmt.Sprintf("Unknown job type %q (expected %s, %s or %s)",
+				req.Type, JobReindex, JobRescan, JobVerifyChain), http.StatusBadRequest)
+			return
+		}
+
+		job, err := s.Jobs.Submit(req.Type, run)
+		if err != nil {
+			s.sendError(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		s.sendJSON(w, job, http.StatusAccepted)
+
+	default:
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleJob reports the progress and result of a job, or cancels it
+// GET    /api/jobs/:id
+// DELETE /api/jobs/:id
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/jobs/")
+
+	switch r.Method {
+	case http.MethodGet:
+		job, ok := s.Jobs.Get(id)
+		if !ok {
+			s.sendError(w, "Job not found", http.StatusNotFound)
+			return
+		}
+
+		s.sendJSON(w, job, http.StatusOK)
+
+	case http.MethodDelete:
+		job, err := s.Jobs.Cancel(id)
+		switch {
+		case err == errJobNotFound:
+			s.sendError(w, "Job not found", http.StatusNotFound)
+		case err != nil:
+			s.sendError(w, err.Error(), http.StatusConflict)
+		default:
+			s.sendJSON(w, job, http.StatusOK)
+		}
+
+	default:
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
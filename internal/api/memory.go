@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+)
+
+type MemoryResponse struct {
+	Limit        int64            `json:"limit_bytes"` // 0 = unlimited
+	Total        int64            `json:"total_bytes"`
+	Pools        map[string]int64 `json:"pools"`
+	MempoolTxs   int              `json:"mempool_txs"`
+	MempoolBytes int64            `json:"mempool_bytes"`       // Serialized size of the pending transactions
+	MempoolLimit int64            `json:"mempool_limit_bytes"` // 0 = unlimited
+}
+
+// MemoryReporter exposes the memory accounting of the network server
+type MemoryReporter interface {
+	MemoryInfo() MemoryResponse
+}
+
+// handleGetMemory returns the accounted memory usage per pool
+// GET /api/memory
+func (s *Server) handleGetMemory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	reporter, ok := s.NetworkServer.(MemoryReporter)
+	if !ok {
+		s.sendError(w, "Memory accounting is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	s.sendJSON(w, reporter.MemoryInfo(), http.StatusOK)
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// mempoolFeeBuckets are the lower bounds of the fee rate histogram buckets, in
+// coins per byte; the last bucket has no upper bound
+var mempoolFeeBuckets = []float64{0, 0.001, 0.002, 0.005, 0.01, 0.02, 0.05, 0.1, 0.2, 0.5, 1, 2, 5, 10}
+
+type MempoolEntry struct {
+	TxID    string  `json:"txid"`
+	Fee     int     `json:"fee"`
+	Size    int     `json:"size"`
+	FeeRate float64 `json:"fee_rate"`
+	Time    int64   `json:"time"` // Unix time the transaction entered the mempool
+}
+
+type MempoolFeeBucket struct {
+	MinFeeRate float64 `json:"min_fee_rate"`
+	MaxFeeRate float64 `json:"max_fee_rate,omitempty"` // Exclusive, omitted for the last bucket
+	Count      int     `json:"count"`
+	Size       int     `json:"size"`
+}
+
+type MempoolResponse struct {
+	Count        int                `json:"count"`
+	Size         int                `json:"size"` // Serialized bytes of the pending transactions
+	TotalFee     int                `json:"total_fee"`
+	TxIDs        []string           `json:"txids"`         // In the order block selection takes them
+	FeeHistogram []MempoolFeeBucket `json:"fee_histogram"` // Non-empty buckets, lowest fee rate first
+}
+
+type MempoolTxResponse struct {
+	MempoolEntry
+	Position    int                 `json:"position"`    // 1 = first taken by block selection
+	AheadBytes  int                 `json:"ahead_bytes"` // Pending bytes taken before it
+	Transaction TransactionResponse `json:"transaction"`
+}
+
+// MempoolLister lists the pending transactions of the network server
+type MempoolLister interface {
+	MempoolEntries() []MempoolEntry // In the order block selection takes them
+}
+
+// mempoolFeeHistogram counts the entries and their bytes per fee rate bucket
+func mempoolFeeHistogram(entries []MempoolEntry) []MempoolFeeBucket {
+	buckets := make([]MempoolFeeBucket, len(mempoolFeeBuckets))
+	for i, min := range mempoolFeeBuckets {
+		buckets[i].MinFeeRate = min
+		if i+1 < len(mempoolFeeBuckets) {
+			buckets[i].MaxFeeRate = mempoolFeeBuckets[i+1]
+		}
+	}
+
+	for _, entry := range entries {
+		i := sort.SearchFloat64s(mempoolFeeBuckets, entry.FeeRate)
+		if i == len(mempoolFeeBuckets) || mempoolFeeBuckets[i] > entry.FeeRate {
+			i-- // SearchFloat64s returns the first bound >= the rate
+		}
+		buckets[i].Count++
+		buckets[i].Size += entry.Size
+	}
+
+	histogram := []MempoolFeeBucket{}
+	for _, bucket := range buckets {
+		if bucket.Count > 0 {
+			histogram = append(histogram, bucket)
+		}
+	}
+	return histogram
+}
+
+// handleMempool summarizes the pending transactions
+// GET /api/mempool
+func (s *Server) handleMempool(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	lister, ok := s.NetworkServer.(MempoolLister)
+	if !ok {
+		s.sendError(w, "Mempool is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	entries := lister.MempoolEntries()
+	response := MempoolResponse{
+		Count:        len(entries),
+		TxIDs:        make([]string, len(entries)),
+		FeeHistogram: mempoolFeeHistogram(entries),
+	}
+	for i, entry := range entries {
+		response.TxIDs[i] = entry.TxID
+		response.Size += entry.Size
+		response.TotalFee += entry.Fee
+	}
+
+	s.sendJSON(w, response, http.StatusOK)
+}
+
+// handleMempoolTransaction returns a pending transaction and its place in the
+// queue of block selection
+// GET /api/mempool/:txid
+func (s *Server) handleMempoolTransaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	lister, ok := s.NetworkServer.(MempoolLister)
+	inspector, _ := s.NetworkServer.(MempoolInspector)
+	if !ok || inspector == nil {
+		s.sendError(w, "Mempool is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	txID := strings.ToLower(strings.TrimPrefix(r.URL.Path, "/api/mempool/"))
+	tx, found := inspector.MempoolTransaction(txID)
+	if !found {
+		s.sendError(w, "Transaction not found in the mempool", http.StatusNotFound)
+		return
+	}
+
+	response := MempoolTxResponse{Transaction: s.newTransactionResponse(tx)}
+	for i, entry := range lister.MempoolEntries() {
+		if entry.TxID == txID {
+			response.MempoolEntry = entry
+			response.Position = i + 1
+			break
+		}
+		response.AheadBytes += entry.Size
+	}
+	if response.Position == 0 {
+		// Mined or evicted in between
+		s.sendError(w, "Transaction not found in the mempool", http.StatusNotFound)
+		return
+	}
+
+	s.sendJSON(w, response, http.StatusOK)
+}
+
+type MempoolConflict struct {
+	TxID        string   `json:"txid"`
+	Fee         int      `json:"fee"`
+	Size        int      `json:"size"`
+	FeeRate     float64  `json:"fee_rate"`
+	Replaceable bool     `json:"replaceable"`
+	Shared      []string `json:"shared_inputs"` // Outputs both transactions spend (txid:out)
+}
+
+type MempoolConflictsResponse struct {
+	TxID        string            `json:"txid"`
+	InMempool   bool              `json:"in_mempool"`
+	Fee         int               `json:"fee"`
+	Size        int               `json:"size"`
+	FeeRate     float64           `json:"fee_rate"`
+	Replaceable bool              `json:"replaceable"`
+	Conflicts   []MempoolConflict `json:"conflicts"`
+	Winner      string            `json:"winner"` // Transaction block selection would take: highest fee rate, then lowest txid
+}
+
+// MempoolInspector exposes the pending transactions of the network server
+type MempoolInspector interface {
+	MempoolTransaction(txID string) (*blockchain.Transaction, bool)
+	MempoolConflicts(tx *blockchain.Transaction) (MempoolConflictsResponse, error)
+}
+
+// handleMempoolConflicts lists the mempool transactions spending the same
+// outputs as a pending transaction, and which one would be mined
+// GET /api/mempool/conflicts/:txid
+func (s *Server) handleMempoolConflicts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	inspector, ok := s.NetworkServer.(MempoolInspector)
+	if !ok {
+		s.sendError(w, "Mempool is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	txID := strings.ToLower(strings.TrimPrefix(r.URL.Path, "/api/mempool/conflicts/"))
+	tx, ok := inspector.MempoolTransaction(txID)
+	if !ok {
+		s.sendError(w, "Transaction not found in the mempool", http.StatusNotFound)
+		return
+	}
+
+	s.sendMempoolConflicts(w, inspector, tx)
+}
+
+// handleCheckMempoolConflicts lists the mempool transactions a raw
+// transaction conflicts with, and which one would be mined
+// POST /api/mempool/conflicts {"hex": "..."}
+func (s *Server) handleCheckMempoolConflicts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RawTransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.empty() {
+		s.sendError(w, "Invalid request body, expected {\"hex\": \"...\"} or {\"base64\": \"...\"}", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := req.transaction()
+	if err != nil {
+		s.sendError(w, "Invalid transaction: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	inspector, ok := s.NetworkServer.(MempoolInspector)
+	if !ok {
+		s.sendError(w, "Mempool is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	s.sendMempoolConflicts(w, inspector, tx)
+}
+
+func (s *Server) sendMempoolConflicts(w http.ResponseWriter, inspector MempoolInspector, tx *blockchain.Transaction) {
+	response, err := inspector.MempoolConflicts(tx)
+	if err != nil {
+		if rejectErr, ok := err.(*blockchain.TxRejectError); ok {
+			code, details := errorCode(rejectErr, http.StatusBadRequest)
+			s.sendErrorCode(w, code, "Transaction rejected: "+rejectErr.Reason, details, http.StatusBadRequest)
+			return
+		}
+		s.sendErrorCode(w, ErrCodeTxRejected, "Transaction rejected: "+err.Error(), nil, http.StatusBadRequest)
+		return
+	}
+
+	s.sendJSON(w, response, http.StatusOK)
+}
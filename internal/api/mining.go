@@ -0,0 +1,467 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// Long-poll limits for block template requests
+const (
+	DefaultLongPollTimeout = 60 * time.Second
+	MaxLongPollTimeout     = 5 * time.Minute
+)
+
+// Blocks the network hashrate is estimated over
+const (
+	DefaultHashRateBlocks = 120
+	MaxHashRateBlocks     = 2016
+)
+
+// TemplateProvider builds block templates for external miners
+type TemplateProvider interface {
+	GetBlockTemplate(address string) (*blockchain.BlockTemplate, error)
+	LongPollID() string
+	WaitForTemplateChange(longPollID string, timeout time.Duration) string
+}
+
+// BlockSubmitter validates, connects and broadcasts externally mined blocks
+type BlockSubmitter interface {
+	SubmitBlock(block *blockchain.Block) error
+}
+
+// HeaderSubmitter rebuilds a block from a template it handed out and a solved header
+type HeaderSubmitter interface {
+	SubmitHeader(templateID string, timestamp int64, nonce int) (*blockchain.Block, error)
+}
+
+type SubmitHeaderRequest struct {
+	TemplateID string `json:"template_id"` // template_id of GET /api/mining/template
+	Timestamp  int64  `json:"timestamp"`   // Timestamp of the solved header
+	Nonce      int    `json:"nonce"`
+}
+
+type SubmitBlockRequest struct {
+	Hex string `json:"hex"` // Hex encoded serialized block
+}
+
+type SubmitBlockResponse struct {
+	Accepted bool   `json:"accepted"`
+	Hash     string `json:"hash,omitempty"`
+	Height   int    `json:"height"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+type TemplateTransaction struct {
+	TxID     string `json:"txid"`
+	Data     string `json:"data"` // Hex encoded serialized transaction
+	Coinbase bool   `json:"coinbase"`
+}
+
+type BlockTemplateResponse struct {
+	Height        int                   `json:"height"`
+	PrevHash      string                `json:"prev_hash"`
+	Difficulty    int                   `json:"difficulty"`
+	Target        string                `json:"target"`
+	CoinbaseValue int                   `json:"coinbase_value"`
+	MerkleRoot    string                `json:"merkle_root"`
+	UTXORoot      string                `json:"utxo_root"`
+	CurTime       int64                 `json:"curtime"`
+	MinTime       int64                 `json:"mintime"` // Earliest valid timestamp; over 2 hours ahead of the node clock is refused
+	Version       uint32                `json:"version"` // Signals the deployments in progress
+	Transactions  []TemplateTransaction `json:"transactions"`
+	LongPollID    string                `json:"longpollid"`
+	PowPreimage   string                `json:"pow_preimage"`
+	TemplateID    string                `json:"template_id"` // Submit the solved header with it to /api/mining/submit
+}
+
+type HashRateResponse struct {
+	Blocks        int     `json:"blocks"`      // Blocks whose work is counted
+	FromHeight    int     `json:"from_height"` // Block the time span starts at
+	ToHeight      int     `json:"to_height"`
+	TimeSpan      int64   `json:"time_span"`      // Seconds
+	AvgBlockTime  float64 `json:"avg_block_time"` // Seconds (0 = unknown)
+	Difficulty    int     `json:"difficulty"`     // Of the tip
+	NetworkHashPS float64 `json:"network_hashps"` // Work of the blocks over the time span (0 = unknown)
+	LocalHashPS   float64 `json:"local_hashps"`   // Measured by the local miner
+	LocalMining   bool    `json:"local_mining"`   // The local miner hashed within local_window
+	LocalWindow   int     `json:"local_window"`   // Seconds the local hashrate is measured over
+	LocalShare    float64 `json:"local_share"`    // local_hashps / network_hashps (0..1, 0 = unknown)
+}
+
+type DeploymentResponse struct {
+	Name        string `json:"name"`
+	Bit         uint   `json:"bit"`
+	State       string `json:"state"` // defined, started, locked_in or active
+	StartHeight int    `json:"start_height"`
+	Window      int    `json:"window"`    // Blocks per signaling window
+	Threshold   int    `json:"threshold"` // Percent of a window that must signal
+	WindowStart int    `json:"window_start"`
+	Signals     int    `json:"signals"` // Blocks of the current window that signaled so far
+}
+
+type DeploymentsResponse struct {
+	Height      int                  `json:"height"`
+	Deployments []DeploymentResponse `json:"deployments"`
+}
+
+// handleDeployments lists the soft-fork deployments and their version bits
+// signaling for the next block
+// GET /api/deployments
+func (s *Server) handleDeployments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	statuses, err := s.Blockchain.DeploymentStatuses()
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := DeploymentsResponse{
+		Height:      s.Blockchain.GetBestHeight(),
+		Deployments: []DeploymentResponse{},
+	}
+	for _, status := range statuses {
+		response.Deployments = append(response.Deployments, DeploymentResponse{
+			Name:        status.Name,
+			Bit:         status.Bit,
+			State:       string(status.State),
+			StartHeight: status.StartHeight,
+			Window:      status.Window,
+			Threshold:   status.Threshold,
+			WindowStart: status.WindowStart,
+			Signals:     status.Signals,
+		})
+	}
+
+	s.sendJSON(w, response, http.StatusOK)
+}
+
+// handleHashRate estimates the network hashrate from the difficulty and the
+// intervals of the last N blocks, next to the measured local hashrate
+// GET /api/mining/hashps?blocks=N
+func (s *Server) handleHashRate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	blocks := ParseIntParam(r, "blocks", DefaultHashRateBlocks)
+	if blocks < 1 || blocks > MaxHashRateBlocks {
+		s.sendError(w, fmt.Sprintf("blocks must be between 1 and %d", MaxHashRateBlocks), http.StatusBadRequest)
+		return
+	}
+
+	estimate := s.Blockchain.EstimateNetworkHashRate(blocks)
+	response := HashRateResponse{
+		Blocks:        estimate.Blocks,
+		FromHeight:    estimate.FromHeight,
+		ToHeight:      estimate.ToHeight,
+		TimeSpan:      estimate.TimeSpan,
+		Difficulty:    s.Blockchain.GetLastBlock().Difficulty,
+		NetworkHashPS: estimate.HashesPerSecond,
+		LocalWindow:   int(blockchain.HashRateWindow.Seconds()),
+	}
+	if estimate.Blocks > 0 && estimate.TimeSpan > 0 {
+		response.AvgBlockTime = float64(estimate.TimeSpan) / float64(estimate.Blocks)
+	}
+
+	response.LocalHashPS, response.LocalMining = blockchain.MinerHashRate()
+	if response.NetworkHashPS > 0 {
+		response.LocalShare = min(response.LocalHashPS/response.NetworkHashPS, 1)
+	}
+
+	s.sendJSON(w, response, http.StatusOK)
+}
+
+// handleGetBlockTemplate returns a candidate block for external miners
+// With ?longpollid=ID the request blocks until the template changes
+// address may split the coinbase: ADDR1:60,ADDR2:40
+// GET /api/mining/template?address=ADDR&longpollid=ID&timeout=SECONDS
+func (s *Server) handleGetBlockTemplate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	provider, ok := s.NetworkServer.(TemplateProvider)
+	if !ok {
+		s.sendError(w, "Block templates are not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	if longPollID := r.URL.Query().Get("longpollid"); longPollID != "" {
+		timeout := time.Duration(ParseIntParam(r, "timeout", int(DefaultLongPollTimeout.Seconds()))) * time.Second
+		if timeout <= 0 || timeout > MaxLongPollTimeout {
+			timeout = MaxLongPollTimeout
+		}
+		provider.WaitForTemplateChange(longPollID, timeout)
+	}
+
+	template, err := provider.GetBlockTemplate(r.URL.Query().Get("address"))
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	target := big.NewInt(1)
+	target.Lsh(target, uint(256-template.Difficulty))
+
+	response := BlockTemplateResponse{
+		Height:        template.Height,
+		PrevHash:      fmt.Sprintf("%x", template.PrevHash),
+		Difficulty:    template.Difficulty,
+		Target:        fmt.Sprintf("%064x", target),
+		CoinbaseValue: template.CoinbaseValue,
+		MerkleRoot:    fmt.Sprintf("%x", template.MerkleRoot),
+		TemplateID:    fmt.Sprintf("%x", template.MerkleRoot),
+		UTXORoot:      fmt.Sprintf("%x", template.UTXORoot),
+		CurTime:       max(time.Now().UTC().Unix(), template.MinTime),
+		MinTime:       template.MinTime,
+		Version:       template.Version,
+		LongPollID:    provider.LongPollID(),
+		PowPreimage:   "version (int64 BE) || prev_hash || merkle_root || utxo_root || nonce (int64 BE) || difficulty (int64 BE) || timestamp (int64 BE)",
+	}
+
+	for _, tx := range template.Transactions {
+		response.Transactions = append(response.Transactions, TemplateTransaction{
+			TxID:     fmt.Sprintf("%x", tx.ID),
+			Data:     fmt.Sprintf("%x", tx.Serialize()),
+			Coinbase: tx.IsCoinbase(),
+		})
+	}
+
+	s.sendJSON(w, response, http.StatusOK)
+}
+
+// handleSubmitBlock accepts a serialized block mined outside the node
+// POST /api/block/submit
+func (s *Server) handleSubmitBlock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req SubmitBlockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Hex == "" {
+		s.sendError(w, "Invalid request body, expected {\"hex\": \"...\"}", http.StatusBadRequest)
+		return
+	}
+
+	data, err := hex.DecodeString(strings.TrimSpace(req.Hex))
+	if err != nil {
+		s.sendError(w, "Invalid block hex", http.StatusBadRequest)
+		return
+	}
+
+	block, err := blockchain.DecodeBlock(data)
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Malformed block: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	submitter, ok := s.NetworkServer.(BlockSubmitter)
+	if !ok {
+		s.sendError(w, "Block submission is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	if err := submitter.SubmitBlock(block); err != nil {
+		s.sendJSON(w, SubmitBlockResponse{
+			Accepted: false,
+			Height:   block.Height,
+			Reason:   err.Error(),
+		}, http.StatusUnprocessableEntity)
+		return
+	}
+
+	s.sendJSON(w, SubmitBlockResponse{
+		Accepted: true,
+		Hash:     fmt.Sprintf("%x", block.Hash),
+		Height:   block.Height,
+	}, http.StatusOK)
+}
+
+// handleSubmitHeader accepts a solved header of a template handed out by
+// GET /api/mining/template, so external miners need not serialize blocks
+// POST /api/mining/submit {"template_id": "...", "timestamp": 0, "nonce": 0}
+func (s *Server) handleSubmitHeader(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req SubmitHeaderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TemplateID == "" || req.Timestamp <= 0 {
+		s.sendError(w, "Invalid request body, expected {\"template_id\": \"...\", \"timestamp\": 0, \"nonce\": 0}", http.StatusBadRequest)
+		return
+	}
+
+	submitter, ok := s.NetworkServer.(HeaderSubmitter)
+	if !ok {
+		s.sendError(w, "Block submission is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	block, err := submitter.SubmitHeader(strings.ToLower(strings.TrimSpace(req.TemplateID)), req.Timestamp, req.Nonce)
+	if err != nil {
+		response := SubmitBlockResponse{Accepted: false, Reason: err.Error()}
+		if block != nil {
+			response.Hash = fmt.Sprintf("%x", block.Hash)
+			response.Height = block.Height
+		}
+		s.sendJSON(w, response, http.StatusUnprocessableEntity)
+		return
+	}
+
+	s.sendJSON(w, SubmitBlockResponse{
+		Accepted: true,
+		Hash:     fmt.Sprintf("%x", block.Hash),
+		Height:   block.Height,
+	}, http.StatusOK)
+}
+
+type MiningStatusResponse struct {
+	Mining          bool                     `json:"mining"`
+	Address         string                   `json:"address,omitempty"`  // Rewards go there (last address while stopped)
+	Shares          []blockchain.RewardShare `json:"shares,omitempty"`   // Split of the rewards among addresses
+	Deferred        bool                     `json:"deferred,omitempty"` // Standby replica: mining starts on promotion
+	Since           int64                    `json:"since,omitempty"`    // Unix time mining started
+	BlocksMined     int                      `json:"blocks_mined"`       // Since the node started
+	LocalHashPS     float64                  `json:"local_hashps"`
+	CPUPercent      int                      `json:"cpu_percent"`  // -mining-cpu
+	MaxHashRate     float64                  `json:"max_hashrate"` // -max-hashrate, 0 = uncapped
+	LowPriority     bool                     `json:"low_priority"` // -mining-nice
+	CoinbaseMessage string                   `json:"coinbase_message,omitempty"`
+}
+
+type MiningStartRequest struct {
+	Address string `json:"address,omitempty"` // ADDR or ADDR1:60,ADDR2:40 shares, default: the last one
+}
+
+// MiningController toggles the miner of the network server at runtime
+type MiningController interface {
+	StartMining(address string)
+	StopMining() bool
+	MiningStatus() MiningStatusResponse
+}
+
+// handleMiningStatus reports whether the node mines
+// GET /api/mining/status
+func (s *Server) handleMiningStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	controller, ok := s.NetworkServer.(MiningController)
+	if !ok {
+		s.sendError(w, "Mining control is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	s.sendJSON(w, controller.MiningStatus(), http.StatusOK)
+}
+
+// handleMiningStart starts mining, or changes where the rewards go
+// POST /api/mining/start {"address": "..."}
+func (s *Server) handleMiningStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req MiningStartRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.sendError(w, "Invalid request body, expected {\"address\": \"...\"}", http.StatusBadRequest)
+			return
+		}
+	}
+
+	controller, ok := s.NetworkServer.(MiningController)
+	if !ok {
+		s.sendError(w, "Mining control is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	address := strings.TrimSpace(req.Address)
+	if address == "" {
+		address = controller.MiningStatus().Address
+	}
+	if address == "" {
+		s.sendError(w, "The node never mined, an address is required", http.StatusBadRequest)
+		return
+	}
+	split, err := blockchain.ParseRewardSplit(address)
+	if err != nil {
+		s.sendErrorCode(w, ErrCodeInvalidAddress, err.Error(), nil, http.StatusBadRequest)
+		return
+	}
+
+	controller.StartMining(split.String())
+	s.sendJSON(w, controller.MiningStatus(), http.StatusOK)
+}
+
+// handleMiningStop stops mining, abandoning the block being mined
+// POST /api/mining/stop
+func (s *Server) handleMiningStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	controller, ok := s.NetworkServer.(MiningController)
+	if !ok {
+		s.sendError(w, "Mining control is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	if controller.StopMining() {
+		log.Printf("⏸️  Mining stopped through the API")
+	}
+	s.sendJSON(w, controller.MiningStatus(), http.StatusOK)
+}
+
+type MiningStatsResponse struct {
+	BlocksMined     int     `json:"blocks_mined"`      // Since the node started, orphaned ones included
+	Orphaned        int     `json:"orphaned"`          // Mined blocks no longer in the main chain
+	Interrupted     int     `json:"interrupted"`       // Rounds abandoned for a block from a peer
+	RewardEarned    int     `json:"reward_earned"`     // Coinbase outputs of the mined main chain blocks
+	MiningSeconds   float64 `json:"mining_seconds"`    // Time spent mining
+	AvgTimeToBlock  float64 `json:"avg_time_to_block"` // mining_seconds / blocks_mined (0 = no block yet)
+	HashPS          float64 `json:"hashps"`            // Measured over the last minute
+	LastBlockHeight int     `json:"last_block_height,omitempty"`
+}
+
+// MiningStatsProvider exposes the statistics of the local miner
+type MiningStatsProvider interface {
+	MiningStats() MiningStatsResponse
+}
+
+// handleMiningStats returns what the local miner achieved since the node started
+// GET /api/mining/stats
+func (s *Server) handleMiningStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	provider, ok := s.NetworkServer.(MiningStatsProvider)
+	if !ok {
+		s.sendError(w, "Mining statistics are not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	s.sendJSON(w, provider.MiningStats(), http.StatusOK)
+}
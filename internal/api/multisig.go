@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+type CreateMultisigRequest struct {
+	Required  int      `json:"required"`            // m signatures needed
+	PubKeys   []string `json:"pubkeys,omitempty"`   // Hex public keys of the participants
+	Addresses []string `json:"addresses,omitempty"` // Wallets on this node (public key resolved locally)
+}
+
+type MultisigResponse struct {
+	Address  string   `json:"address"`
+	Script   string   `json:"script"` // Hex redeem script, share it with the other participants
+	Required int      `json:"required"`
+	PubKeys  []string `json:"pubkeys"`
+}
+
+type MultisigListResponse struct {
+	Multisig []MultisigResponse `json:"multisig"`
+}
+
+// handleMultisig creates a shared m-of-n address or lists the registered ones
+// Spending from a multisig address goes through a co-signing session with
+// {"multisig": address}, where any m of the key owners sign
+// GET  /api/multisig
+// POST /api/multisig {"required": m, "pubkeys": [...], "addresses": [...]}
+func (s *Server) handleMultisig(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		response := MultisigListResponse{Multisig: []MultisigResponse{}}
+		for _, script := range s.Wallets.Multisig {
+			response.Multisig = append(response.Multisig, multisigResponse(script))
+		}
+		s.sendJSON(w, response, http.StatusOK)
+
+	case http.MethodPost:
+		var req CreateMultisigRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.sendError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		var pubKeys [][]byte
+		for _, pubKeyHex := range req.PubKeys {
+			pubKey, err := hex.DecodeString(pubKeyHex)
+			if err != nil || len(pubKey) == 0 {
+				s.sendError(w, fmt.Sprintf("Invalid pubkey %q", pubKeyHex), http.StatusBadRequest)
+				return
+			}
+			pubKeys = append(pubKeys, pubKey)
+		}
+		for _, address := range req.Addresses {
+			pubKey, err := s.cosignerPubKey(address, "")
+			if err != nil {
+				s.sendError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			pubKeys = append(pubKeys, pubKey)
+		}
+
+		script, err := blockchain.NewMultisigScript(req.Required, pubKeys)
+		if err != nil {
+			s.sendError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		address, err := s.Wallets.AddMultisig(script)
+		if err != nil {
+			s.sendError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.Wallets.SaveFile()
+
+		log.Printf("✅ Multisig address created: %s (%d of %d)", address, req.Required, len(pubKeys))
+		s.sendJSON(w, multisigResponse(script), http.StatusCreated)
+
+	default:
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// multisigResponse builds the API view of a redeem script
+func multisigResponse(script []byte) MultisigResponse {
+	m, pubKeys, _ := blockchain.ParseMultisigScript(script)
+
+	response := MultisigResponse{
+		Address:  blockchain.MultisigAddress(script),
+		Script:   hex.EncodeToString(script),
+		Required: m,
+	}
+	for _, pubKey := range pubKeys {
+		response.PubKeys = append(response.PubKeys, hex.EncodeToString(pubKey))
+	}
+
+	return response
+}
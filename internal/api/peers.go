@@ -0,0 +1,169 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// PeerInfo describes a known peer and the protocol statistics collected for it
+type PeerInfo struct {
+	Address           string            `json:"address"`
+	Known             bool              `json:"known"`
+	Outbound          bool              `json:"outbound"`
+	Inbound           bool              `json:"inbound"`     // Sent us its version, relayed to
+	Unreachable       bool              `json:"unreachable"` // Backing off after failed dials
+	Banned            bool              `json:"banned"`
+	BanScore          int               `json:"ban_score"` // Misbehavior points of the peer's IP, banned at the threshold
+	BytesSent         uint64            `json:"bytes_sent"`
+	BytesReceived     uint64            `json:"bytes_received"`
+	MessagesSent      map[string]uint64 `json:"messages_sent"`
+	MessagesReceived  map[string]uint64 `json:"messages_received"`
+	BlocksContributed uint64            `json:"blocks_contributed"`
+	TxsContributed    uint64            `json:"txs_contributed"`
+	InvalidBlocks     uint64            `json:"invalid_blocks"`
+	InvalidTxs        uint64            `json:"invalid_txs"`
+	MalformedMessages uint64            `json:"malformed_messages"`
+	RateLimited       uint64            `json:"rate_limited"` // Messages dropped over the peer's rate
+	FirstSeen         int64             `json:"first_seen,omitempty"`
+	LastSeen          int64             `json:"last_seen,omitempty"`
+	AddrLastSeen      int64             `json:"addr_last_seen,omitempty"` // Last seen alive according to address gossip
+	Services          []string          `json:"services,omitempty"`       // "network" (every block) or "network_limited" (pruned)
+}
+
+// UnreachablePeer is a peer that failed to dial and is retried with backoff
+// It stays a known peer until it fails too many times in a row
+type UnreachablePeer struct {
+	Address     string `json:"address"`
+	Failures    int    `json:"failures"`
+	FirstFailed int64  `json:"first_failed"`
+	NextAttempt int64  `json:"next_attempt"`
+	LastError   string `json:"last_error"`
+}
+
+// BannedPeer is a peer whose messages are dropped until its ban expires
+type BannedPeer struct {
+	Address string `json:"address"`
+	Reason  string `json:"reason"`
+	Created int64  `json:"created"`
+	Until   int64  `json:"until"`
+}
+
+type PeersResponse struct {
+	Count       int               `json:"count"`
+	Peers       []PeerInfo        `json:"peers"`
+	Unreachable []UnreachablePeer `json:"unreachable"` // Temporarily unreachable, retrying
+	Banned      []BannedPeer      `json:"banned"`
+}
+
+// PeersProvider exposes the peers of the network server
+type PeersProvider interface {
+	PeersInfo() []PeerInfo
+	UnreachablePeers() []UnreachablePeer
+	BannedPeers() []BannedPeer
+}
+
+type PeerBanRequest struct {
+	Address         string `json:"address"`
+	DurationSeconds int64  `json:"duration_seconds,omitempty"` // 0 = the automatic ban duration
+	Reason          string `json:"reason,omitempty"`
+}
+
+type PeerBansResponse struct {
+	Count  int          `json:"count"`
+	Banned []BannedPeer `json:"banned"`
+}
+
+// PeerBanManager bans and unbans peers of the network server
+type PeerBanManager interface {
+	BannedPeers() []BannedPeer
+	BanPeer(addr string, duration time.Duration, reason string) error
+	UnbanPeer(addr string) error
+}
+
+// handleGetPeers returns all known peers with their protocol statistics
+// GET /api/peers
+func (s *Server) handleGetPeers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	provider, ok := s.NetworkServer.(PeersProvider)
+	if !ok {
+		s.sendError(w, "Peer information is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	peers := provider.PeersInfo()
+	s.sendJSON(w, PeersResponse{
+		Count:       len(peers),
+		Peers:       peers,
+		Unreachable: provider.UnreachablePeers(),
+		Banned:      provider.BannedPeers(),
+	}, http.StatusOK)
+}
+
+// handlePeerBan lists the banned peers or bans one
+// GET  /api/peers/ban
+// POST /api/peers/ban {"address": "host:port", "duration_seconds": 0, "reason": "..."}
+func (s *Server) handlePeerBan(w http.ResponseWriter, r *http.Request) {
+	manager, ok := s.NetworkServer.(PeerBanManager)
+	if !ok {
+		s.sendError(w, "Peer bans are not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.sendPeerBans(w, manager)
+
+	case http.MethodPost:
+		var req PeerBanRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.sendError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		duration := time.Duration(req.DurationSeconds) * time.Second
+		if err := manager.BanPeer(req.Address, duration, req.Reason); err != nil {
+			s.sendError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.sendPeerBans(w, manager)
+
+	default:
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handlePeerUnban lifts the ban of a peer
+// POST /api/peers/unban {"address": "host:port"}
+func (s *Server) handlePeerUnban(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	manager, ok := s.NetworkServer.(PeerBanManager)
+	if !ok {
+		s.sendError(w, "Peer bans are not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req PeerBanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := manager.UnbanPeer(req.Address); err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.sendPeerBans(w, manager)
+}
+
+func (s *Server) sendPeerBans(w http.ResponseWriter, manager PeerBanManager) {
+	banned := manager.BannedPeers()
+	s.sendJSON(w, PeerBansResponse{Count: len(banned), Banned: banned}, http.StatusOK)
+}
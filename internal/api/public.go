@@ -0,0 +1,72 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strings"
+)
+
+// publicRoutes are the routes served by the public profile: read-only chain,
+// mempool and network statistics, without wallet, mining or admin routes
+var publicRoutes = map[string]bool{
+	"/api/balance/":           true,
+	"/api/height":             true,
+	"/api/difficulty":         true,
+	"/api/networkinfo":        true,
+	"/api/lastblock":          true,
+	"/api/block/":             true,
+	"/api/block/height/":      true,
+	"/api/tx/":                true,
+	"/api/attestation":        true,
+	"/api/memory":             true,
+	"/api/status":             true,
+	"/api/mempool":            true,
+	"/api/mempool/":           true,
+	"/api/mempool/conflicts/": true,
+	"/api/estimatefee":        true,
+	"/api/deployments":        true,
+	"/api/cluster/":           true,
+	"/api/schema":             true,
+}
+
+// EnablePublicProfile restricts the API to read-only, non-sensitive routes so
+// the node can back a public explorer; every other route is not registered
+// Must be called before Start
+func (s *Server) EnablePublicProfile() {
+	s.Public = true
+	log.Printf("🌐 Public API profile: serving read-only routes only")
+}
+
+// publicRoute reports whether a route is served by the current profile and
+// wraps its handler accordingly
+func (s *Server) publicRoute(pattern string, handler http.HandlerFunc) (http.HandlerFunc, bool) {
+	if !s.Public {
+		return handler, true
+	}
+	if !publicRoutes[pattern] {
+		return nil, false
+	}
+	return s.readOnly(handler), true
+}
+
+// readOnly refuses every method but GET
+func (s *Server) readOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// servesEndpoint reports whether a documented endpoint is served by the current profile
+func (s *Server) servesEndpoint(endpoint documentedEndpoint) bool {
+	if !s.Public {
+		return true
+	}
+
+	pattern := "/api" + strings.SplitN(endpoint.path, ":", 2)[0]
+	return endpoint.method == http.MethodGet && publicRoutes[pattern]
+}
@@ -0,0 +1,237 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// Raw transactions let external wallets spend without the node holding their
+// keys: the node builds an unsigned transaction, the wallet signs the
+// signature hash of each input offline, and the node attaches the signatures
+// and broadcasts the result. Transactions travel as their canonical hex
+// serialization (see blockchain.Transaction.Hex).
+
+type CreateRawTransactionRequest struct {
+	SendRequest
+	PubKey string `json:"pubkey,omitempty"` // Hex public key of from (optional for wallets on this node)
+}
+
+type SignRawTransactionRequest struct {
+	Hex        string            `json:"hex"`
+	Signatures map[string]string `json:"signatures"` // input index -> hex signature
+}
+
+type RawTransactionResponse struct {
+	TxID        string              `json:"txid"`
+	Hex         string              `json:"hex"`
+	Complete    bool                `json:"complete"` // Every input is signed
+	Inputs      []SessionInput      `json:"inputs"`
+	Transaction TransactionResponse `json:"transaction"`
+}
+
+// handleCreateRawTransaction builds an unsigned transaction paying the
+// recipients from an address; whatever the funding exceeds them by, fee
+// included, returns to the address as change
+// POST /api/tx/create
+func (s *Server) handleCreateRawTransaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CreateRawTransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.From == "" {
+		s.sendError(w, "From, To, and Amount (or Outputs) are required", http.StatusBadRequest)
+		return
+	}
+	if req.Fee < 0 {
+		s.sendError(w, "Fee cannot be negative", http.StatusBadRequest)
+		return
+	}
+	if !blockchain.ValidateAddress(req.From) {
+		s.sendErrorCode(w, ErrCodeInvalidAddress, "Invalid 'from' address", nil, http.StatusBadRequest)
+		return
+	}
+	req.From, _ = blockchain.ToBase58Address(req.From)
+
+	recipients, err := sendRecipients(req.SendRequest)
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	funder := blockchain.Funding{Address: req.From, Amount: totalAmount(recipients) + req.Fee}
+	if funder.PubKey, err = s.cosignerPubKey(req.From, req.PubKey); err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.CoinSelection != "" {
+		if funder.Selector, err = blockchain.ParseCoinSelector(req.CoinSelection); err != nil {
+			s.sendError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.Blockchain.RLockState()
+	defer s.Blockchain.RUnlockState()
+
+	tx, err := blockchain.NewUnsignedTransaction([]blockchain.Funding{funder}, recipients, s.Blockchain)
+	if err != nil {
+		s.sendErr(w, "Failed to create transaction: ", err, http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("📝 API: Created raw transaction %x from %s (%d inputs)", tx.ID, req.From, len(tx.Inputs))
+	s.sendRawTransaction(w, tx, http.StatusCreated)
+}
+
+// handleSignRawTransaction attaches signatures made offline to the inputs of
+// a raw transaction; each signature is checked against the input public key
+// POST /api/tx/sign
+func (s *Server) handleSignRawTransaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req SignRawTransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Hex == "" {
+		s.sendError(w, "Invalid request body, expected {\"hex\": \"...\", \"signatures\": {...}}", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := decodeRawTransaction(req.Hex)
+	if err != nil {
+		s.sendError(w, "Invalid transaction: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if tx.IsCoinbase() {
+		s.sendError(w, "Coinbase transactions cannot be signed", http.StatusBadRequest)
+		return
+	}
+
+	prevTXs, err := s.Blockchain.PrevTransactions(tx)
+	if err != nil {
+		s.sendError(w, "Unknown input: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for key, signatureHex := range req.Signatures {
+		inId, err := strconv.Atoi(key)
+		if err != nil || inId < 0 || inId >= len(tx.Inputs) {
+			s.sendError(w, fmt.Sprintf("Invalid input index %q", key), http.StatusBadRequest)
+			return
+		}
+
+		in := tx.Inputs[inId]
+		if blockchain.IsMultisigScript(in.PubKey) {
+			s.sendError(w, fmt.Sprintf("Input %d spends a multisig output, use a co-signing session", inId), http.StatusBadRequest)
+			return
+		}
+
+		signature, err := hex.DecodeString(signatureHex)
+		if err != nil || !tx.VerifyInputSignature(inId, signature, in.PubKey, prevTXs) {
+			s.sendError(w, fmt.Sprintf("Invalid signature for input %d", inId), http.StatusBadRequest)
+			return
+		}
+		tx.Inputs[inId].Signature = signature
+	}
+
+	s.sendRawTransaction(w, tx, http.StatusOK)
+}
+
+// handleBroadcastRawTransaction submits a signed raw transaction to the
+// mempool and relays it to peers
+// POST /api/tx/broadcast
+// POST /api/tx/raw
+func (s *Server) handleBroadcastRawTransaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RawTransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.empty() {
+		s.sendError(w, "Invalid request body, expected {\"hex\": \"...\"} or {\"base64\": \"...\"}", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := req.transaction()
+	if err != nil {
+		s.sendError(w, "Invalid transaction: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tester, ok := s.NetworkServer.(MempoolTester)
+	if !ok {
+		s.sendError(w, "Mempool is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	s.Blockchain.RLockState()
+	_, err = tester.CheckMempoolAcceptance(tx)
+	s.Blockchain.RUnlockState()
+	if err != nil {
+		if rejectErr, ok := err.(*blockchain.TxRejectError); ok {
+			code, details := errorCode(rejectErr, http.StatusBadRequest)
+			s.sendErrorCode(w, code, fmt.Sprintf("Transaction rejected (%s): %s", rejectErr.Code, rejectErr.Reason), details, http.StatusBadRequest)
+			return
+		}
+		s.sendErrorCode(w, ErrCodeTxRejected, "Transaction rejected: "+err.Error(), nil, http.StatusBadRequest)
+		return
+	}
+
+	if err := s.relayTransaction(tx); err != nil {
+		s.sendRejected(w, err)
+		return
+	}
+
+	txResponse := s.newTransactionResponse(tx)
+	s.sendJSON(w, SendResponse{
+		Success:     true,
+		TxID:        fmt.Sprintf("%x", tx.ID),
+		Transaction: &txResponse,
+	}, http.StatusOK)
+}
+
+// sendRawTransaction writes a raw transaction with the signing state of its inputs
+// The caller must be able to resolve the spent outputs
+func (s *Server) sendRawTransaction(w http.ResponseWriter, tx *blockchain.Transaction, status int) {
+	prevTXs, err := s.Blockchain.PrevTransactions(tx)
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := RawTransactionResponse{
+		TxID:        fmt.Sprintf("%x", tx.ID),
+		Hex:         tx.Hex(),
+		Complete:    true,
+		Inputs:      []SessionInput{},
+		Transaction: s.newTransactionResponse(tx),
+	}
+	for inId, in := range tx.Inputs {
+		signed := len(in.Signature) > 0
+		response.Complete = response.Complete && signed
+
+		response.Inputs = append(response.Inputs, SessionInput{
+			Index:         inId,
+			Address:       fmt.Sprintf("%s", blockchain.PubKeyHashToAddress(in.LockingHash())),
+			SignatureHash: fmt.Sprintf("%x", tx.SignatureHash(inId, prevTXs)),
+			Signed:        signed,
+		})
+	}
+
+	s.sendJSON(w, response, status)
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"log"
+	"net/http"
+)
+
+type ReplicaResponse struct {
+	Primary         string `json:"primary"`
+	Promoted        bool   `json:"promoted"`
+	PromotedAt      int64  `json:"promoted_at,omitempty"`
+	LastContact     int64  `json:"last_contact"`     // Last successful ping of the primary
+	FailoverSeconds int    `json:"failover_seconds"` // 0 = manual promotion only
+	Height          int    `json:"height"`
+	DeltaSync       bool   `json:"delta_sync"`     // Applies UTXO deltas streamed by the primary
+	DeltasApplied   int    `json:"deltas_applied"` // Blocks connected from UTXO deltas
+}
+
+// ReplicaController exposes the hot standby mode of the network server
+type ReplicaController interface {
+	Standby() bool
+	ReplicaInfo() *ReplicaResponse
+	Promote(reason string) error
+}
+
+// standby reports whether the node is a replica waiting to be promoted
+func (s *Server) standby() bool {
+	replica, ok := s.NetworkServer.(ReplicaController)
+	return ok && replica.Standby()
+}
+
+// requireActive refuses wallet and mining requests while the node is a standby replica
+func (s *Server) requireActive(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.standby() {
+			s.sendError(w, "Node is a standby replica, promote it to serve this request", http.StatusServiceUnavailable)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// handleReplica reports the hot standby status
+// GET /api/replica
+func (s *Server) handleReplica(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	replica, ok := s.NetworkServer.(ReplicaController)
+	if !ok || replica.ReplicaInfo() == nil {
+		s.sendError(w, "Node is not running in replica mode", http.StatusNotFound)
+		return
+	}
+
+	s.sendJSON(w, replica.ReplicaInfo(), http.StatusOK)
+}
+
+// handlePromoteReplica promotes a standby replica to take over from its primary
+// POST /api/replica/promote
+func (s *Server) handlePromoteReplica(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	replica, ok := s.NetworkServer.(ReplicaController)
+	if !ok || replica.ReplicaInfo() == nil {
+		s.sendError(w, "Node is not running in replica mode", http.StatusNotFound)
+		return
+	}
+
+	if err := replica.Promote("requested by " + r.RemoteAddr); err != nil {
+		s.sendError(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	log.Printf("🪞 API: Replica promoted on request from %s", r.RemoteAddr)
+	s.sendJSON(w, replica.ReplicaInfo(), http.StatusOK)
+}
@@ -0,0 +1,618 @@
+package api
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// Bitcoin Core compatible JSON-RPC
+//
+// /rpc answers the calls existing Bitcoin tooling makes most, with Bitcoin
+// Core's parameters, results and error codes: getblockcount, getblockhash,
+// getblock, getrawtransaction, sendrawtransaction and getbalance. Requests
+// are JSON-RPC 1.0 (result and error both present, HTTP 500 or 404 on error,
+// as Bitcoin Core answers) or 2.0, single or batched, with positional or
+// named parameters. Amounts are whole coins, as in the rest of the API, and
+// transactions have no scripts: a scriptPubKey carries the address and type
+// only. With API authentication (-api-auth) the API key or token is the
+// rpcpassword (rpcuser is ignored); the chain methods need the read role,
+// sendrawtransaction and getbalance the wallet role.
+
+const (
+	maxRPCRequestSize = 4 << 20 // Bytes of a request, batches included
+	maxRPCBatch       = 100     // Calls per batch
+)
+
+// Bitcoin Core RPC error codes
+const (
+	rpcMiscError            = -1
+	rpcTypeError            = -3
+	rpcInvalidAddressOrKey  = -5
+	rpcInvalidParameter     = -8
+	rpcDeserializationError = -22
+	rpcVerifyRejected       = -26
+	rpcVerifyAlreadyInChain = -27
+	rpcInvalidRequest       = -32600
+	rpcMethodNotFound       = -32601
+	rpcInvalidParams        = -32602
+	rpcParseError           = -32700
+)
+
+type RPCRequest struct {
+	JSONRPC string          `json:"jsonrpc,omitempty"`
+	ID      json.RawMessage `json:"id"` // Absent in JSON-RPC 2.0 notifications, which are not answered
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"` // Array or object
+}
+
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// RPCResponse answers JSON-RPC 1.0 requests: one of result and error is null
+type RPCResponse struct {
+	Result interface{}     `json:"result"`
+	Error  *RPCError       `json:"error"`
+	ID     json.RawMessage `json:"id"`
+}
+
+// RPC2Response answers JSON-RPC 2.0 requests: result or error
+type RPC2Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type RPCBlock struct {
+	Hash              string      `json:"hash"`
+	Confirmations     int         `json:"confirmations"` // -1 = not in the main chain
+	Size              int         `json:"size"`
+	Height            int         `json:"height"`
+	Version           uint32      `json:"version"`
+	VersionHex        string      `json:"versionHex"`
+	MerkleRoot        string      `json:"merkleroot"`
+	Tx                interface{} `json:"tx"` // Txids, or transactions with verbosity 2
+	Time              int64       `json:"time"`
+	Nonce             int         `json:"nonce"`
+	Difficulty        int         `json:"difficulty"` // Leading zero bits of the target
+	NTx               int         `json:"nTx"`
+	PreviousBlockHash string      `json:"previousblockhash,omitempty"`
+	NextBlockHash     string      `json:"nextblockhash,omitempty"`
+}
+
+type RPCTransaction struct {
+	TxID          string   `json:"txid"`
+	Hash          string   `json:"hash"`
+	Size          int      `json:"size"`
+	VSize         int      `json:"vsize"`
+	Vin           []RPCVin `json:"vin"`
+	Vout          []RPCOut `json:"vout"`
+	Hex           string   `json:"hex"`
+	BlockHash     string   `json:"blockhash,omitempty"` // Omitted in the mempool
+	Confirmations int      `json:"confirmations,omitempty"`
+	Time          int64    `json:"time,omitempty"`
+	BlockTime     int64    `json:"blocktime,omitempty"`
+}
+
+// RPCVin spends an output, or carries the coinbase data
+type RPCVin struct {
+	Coinbase string `json:"coinbase,omitempty"` // Hex
+	TxID     string `json:"txid,omitempty"`
+	Vout     *int   `json:"vout,omitempty"`
+	Sequence uint32 `json:"sequence"`
+}
+
+type RPCOut struct {
+	Value        int             `json:"value"`
+	N            int             `json:"n"`
+	ScriptPubKey RPCScriptPubKey `json:"scriptPubKey"`
+}
+
+type RPCScriptPubKey struct {
+	Address string `json:"address,omitempty"`
+	Type    string `json:"type"` // pubkeyhash, multisig or nulldata
+}
+
+// rpcMethod takes its parameters in the order of params, nil when not given
+type rpcMethod struct {
+	role   Role
+	params []string
+	call   func(s *Server, r *http.Request, params []json.RawMessage) (interface{}, *RPCError)
+}
+
+var rpcMethods = map[string]rpcMethod{
+	"getblockcount":      {RoleRead, nil, (*Server).rpcGetBlockCount},
+	"getblockhash":       {RoleRead, []string{"height"}, (*Server).rpcGetBlockHash},
+	"getblock":           {RoleRead, []string{"blockhash", "verbosity"}, (*Server).rpcGetBlock},
+	"getrawtransaction":  {RoleRead, []string{"txid", "verbose", "blockhash"}, (*Server).rpcGetRawTransaction},
+	"sendrawtransaction": {RoleWallet, []string{"hexstring", "maxfeerate"}, (*Server).rpcSendRawTransaction},
+	"getbalance":         {RoleWallet, []string{"dummy", "minconf", "include_watchonly", "avoid_reuse"}, (*Server).rpcGetBalance},
+}
+
+func rpcErrorf(code int, format string, args ...interface{}) *RPCError {
+	return &RPCError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// handleRPC answers Bitcoin Core style JSON-RPC calls, single or batched
+// POST /rpc
+func (s *Server) handleRPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "JSON-RPC server handles only POST requests", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRPCRequestSize+1))
+	if err != nil {
+		return
+	}
+	if len(body) > maxRPCRequestSize {
+		s.sendJSON(w, RPCResponse{Error: rpcErrorf(rpcInvalidRequest, "Request over %d bytes", maxRPCRequestSize)}, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || body[0] != '[' {
+		response, status, ok := s.rpcCall(r, body)
+		if !ok {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		s.sendJSON(w, response, status)
+		return
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(body, &batch); err != nil {
+		s.sendJSON(w, RPCResponse{Error: rpcErrorf(rpcParseError, "Parse error")}, http.StatusInternalServerError)
+		return
+	}
+	if len(batch) > maxRPCBatch {
+		s.sendJSON(w, RPCResponse{Error: rpcErrorf(rpcInvalidRequest, "Batch of %d calls, at most %d", len(batch), maxRPCBatch)}, http.StatusBadRequest)
+		return
+	}
+
+	responses := []interface{}{}
+	for _, call := range batch {
+		if response, _, ok := s.rpcCall(r, call); ok {
+			responses = append(responses, response)
+		}
+	}
+	if len(responses) == 0 && len(batch) > 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	s.sendJSON(w, responses, http.StatusOK)
+}
+
+// rpcCall runs one call and returns its response and the HTTP status of a
+// single call; false for notifications, which are not answered
+func (s *Server) rpcCall(r *http.Request, raw json.RawMessage) (interface{}, int, bool) {
+	var request RPCRequest
+	if err := json.Unmarshal(raw, &request); err != nil {
+		return RPCResponse{Error: rpcErrorf(rpcParseError, "Parse error")}, http.StatusInternalServerError, true
+	}
+
+	result, rpcErr := s.rpcDispatch(r, request)
+
+	if request.JSONRPC == "2.0" {
+		if request.ID == nil {
+			return nil, 0, false
+		}
+		return RPC2Response{JSONRPC: "2.0", Result: result, Error: rpcErr, ID: request.ID}, http.StatusOK, true
+	}
+
+	status := http.StatusOK
+	if rpcErr != nil {
+		result = nil
+		status = http.StatusInternalServerError
+		if rpcErr.Code == rpcMethodNotFound {
+			status = http.StatusNotFound
+		}
+	}
+	return RPCResponse{Result: result, Error: rpcErr, ID: request.ID}, status, true
+}
+
+func (s *Server) rpcDispatch(r *http.Request, request RPCRequest) (interface{}, *RPCError) {
+	if request.Method == "" {
+		return nil, rpcErrorf(rpcInvalidRequest, "Method must be a string")
+	}
+	method, ok := rpcMethods[request.Method]
+	if !ok {
+		return nil, rpcErrorf(rpcMethodNotFound, "Method not found")
+	}
+	if !s.allowed(r, method.role) {
+		return nil, rpcErrorf(rpcMiscError, "Method %s needs the %s role", request.Method, method.role)
+	}
+
+	params, rpcErr := rpcParams(request.Params, method.params)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	return method.call(s, r, params)
+}
+
+// rpcParams returns the parameters of a call in the order of names, named
+// ones included
+func rpcParams(raw json.RawMessage, names []string) ([]json.RawMessage, *RPCError) {
+	params := make([]json.RawMessage, len(names))
+
+	raw = bytes.TrimSpace(raw)
+	switch {
+	case len(raw) == 0 || string(raw) == "null":
+	case raw[0] == '[':
+		var list []json.RawMessage
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return nil, rpcErrorf(rpcInvalidRequest, "Params must be an array or object")
+		}
+		if len(list) > len(names) {
+			return nil, rpcErrorf(rpcInvalidParams, "Too many parameters, at most %d (%s)", len(names), strings.Join(names, ", "))
+		}
+		copy(params, list)
+	case raw[0] == '{':
+		var named map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &named); err != nil {
+			return nil, rpcErrorf(rpcInvalidRequest, "Params must be an array or object")
+		}
+		for name, value := range named {
+			i := slices.Index(names, name)
+			if i < 0 {
+				return nil, rpcErrorf(rpcInvalidParameter, "Unknown named parameter %s", name)
+			}
+			params[i] = value
+		}
+	default:
+		return nil, rpcErrorf(rpcInvalidRequest, "Params must be an array or object")
+	}
+	return params, nil
+}
+
+// rpcGiven reports whether a parameter was passed, null counting as omitted
+func rpcGiven(param json.RawMessage) bool {
+	return len(param) > 0 && string(param) != "null"
+}
+
+func rpcString(param json.RawMessage, name string) (string, *RPCError) {
+	if !rpcGiven(param) {
+		return "", rpcErrorf(rpcInvalidParams, "Missing parameter %s", name)
+	}
+	var value string
+	if err := json.Unmarshal(param, &value); err != nil {
+		return "", rpcErrorf(rpcTypeError, "Expected type string for %s", name)
+	}
+	return value, nil
+}
+
+func rpcInt(param json.RawMessage, name string) (int, *RPCError) {
+	if !rpcGiven(param) {
+		return 0, rpcErrorf(rpcInvalidParams, "Missing parameter %s", name)
+	}
+	var value int
+	if err := json.Unmarshal(param, &value); err != nil {
+		return 0, rpcErrorf(rpcTypeError, "Expected type number for %s", name)
+	}
+	return value, nil
+}
+
+// rpcVerbosity reads a verbosity given as a number or a boolean
+func rpcVerbosity(param json.RawMessage, name string, defaultValue int) (int, *RPCError) {
+	if !rpcGiven(param) {
+		return defaultValue, nil
+	}
+	var verbose bool
+	if err := json.Unmarshal(param, &verbose); err == nil {
+		if verbose {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return rpcInt(param, name)
+}
+
+// rpcHash decodes a block hash or txid parameter
+func rpcHash(param json.RawMessage, name string) ([]byte, *RPCError) {
+	value, rpcErr := rpcString(param, name)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	hash, err := hex.DecodeString(value)
+	if err != nil || len(hash) == 0 {
+		return nil, rpcErrorf(rpcInvalidParameter, "%s must be hexadecimal string (not '%s')", name, value)
+	}
+	return hash, nil
+}
+
+// getblockcount
+func (s *Server) rpcGetBlockCount(r *http.Request, params []json.RawMessage) (interface{}, *RPCError) {
+	return s.Blockchain.GetBestHeight(), nil
+}
+
+// getblockhash height
+func (s *Server) rpcGetBlockHash(r *http.Request, params []json.RawMessage) (interface{}, *RPCError) {
+	height, rpcErr := rpcInt(params[0], "height")
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	s.Blockchain.RLockState()
+	defer s.Blockchain.RUnlockState()
+
+	if height < 0 || height > s.Blockchain.GetBestHeight() {
+		return nil, rpcErrorf(rpcInvalidParameter, "Block height out of range")
+	}
+	hash, err := s.Blockchain.MainChainHashAt(height)
+	if err != nil {
+		return nil, rpcErrorf(rpcMiscError, "%v", err)
+	}
+	return hex.EncodeToString(hash), nil
+}
+
+// getblock "blockhash" ( verbosity )
+// Verbosity 0 returns the serialized block in hex, 1 the block with its
+// txids (the default), 2 the block with its transactions
+func (s *Server) rpcGetBlock(r *http.Request, params []json.RawMessage) (interface{}, *RPCError) {
+	hash, rpcErr := rpcHash(params[0], "blockhash")
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	verbosity, rpcErr := rpcVerbosity(params[1], "verbosity", 1)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	s.Blockchain.RLockState()
+	defer s.Blockchain.RUnlockState()
+
+	block, err := s.Blockchain.GetBlock(hash)
+	if err != nil {
+		return nil, rpcErrorf(rpcInvalidAddressOrKey, "Block not found")
+	}
+	if verbosity <= 0 {
+		return hex.EncodeToString(block.Serialize()), nil
+	}
+
+	mainHash, err := s.Blockchain.MainChainHashAt(block.Height)
+	inMainChain := err == nil && bytes.Equal(mainHash, block.Hash)
+	bestHeight := s.Blockchain.GetBestHeight()
+
+	response := RPCBlock{
+		Hash:          hex.EncodeToString(block.Hash),
+		Confirmations: -1,
+		Size:          block.Size(),
+		Height:        block.Height,
+		Version:       block.Version,
+		VersionHex:    fmt.Sprintf("%08x", block.Version),
+		MerkleRoot:    hex.EncodeToString(block.MerkleRoot),
+		Time:          block.Timestamp,
+		Nonce:         block.Nonce,
+		Difficulty:    block.Difficulty,
+		NTx:           len(block.Transactions),
+	}
+	if block.Height > 0 {
+		response.PreviousBlockHash = hex.EncodeToString(block.PrevHash)
+	}
+	if inMainChain {
+		response.Confirmations = bestHeight - block.Height + 1
+		if next, err := s.Blockchain.MainChainHashAt(block.Height + 1); err == nil && block.Height < bestHeight {
+			response.NextBlockHash = hex.EncodeToString(next)
+		}
+	}
+
+	if verbosity == 1 {
+		txids := make([]string, len(block.Transactions))
+		for i, tx := range block.Transactions {
+			txids[i] = hex.EncodeToString(tx.ID)
+		}
+		response.Tx = txids
+	} else {
+		txs := make([]RPCTransaction, len(block.Transactions))
+		for i, tx := range block.Transactions {
+			txs[i] = rpcTransaction(tx)
+		}
+		response.Tx = txs
+	}
+	return response, nil
+}
+
+// rpcTransaction decodes a transaction the way getrawtransaction shows it
+func rpcTransaction(tx *blockchain.Transaction) RPCTransaction {
+	response := RPCTransaction{
+		TxID:  hex.EncodeToString(tx.ID),
+		Hash:  hex.EncodeToString(tx.ID),
+		Size:  tx.Size(),
+		VSize: tx.Size(),
+		Vin:   []RPCVin{},
+		Vout:  []RPCOut{},
+		Hex:   tx.Hex(),
+	}
+
+	for _, in := range tx.Inputs {
+		if tx.IsCoinbase() {
+			response.Vin = append(response.Vin, RPCVin{Coinbase: hex.EncodeToString(in.PubKey), Sequence: in.Sequence})
+			continue
+		}
+		out := in.Out
+		response.Vin = append(response.Vin, RPCVin{TxID: hex.EncodeToString(in.ID), Vout: &out, Sequence: in.Sequence})
+	}
+
+	for i := range tx.Outputs {
+		out := &tx.Outputs[i]
+		script := RPCScriptPubKey{Type: "nulldata"}
+		if !out.IsDataCarrier() {
+			script.Address = string(blockchain.PubKeyHashToAddress(out.PubKeyHash))
+			script.Type = "pubkeyhash"
+			if blockchain.IsMultisigAddress(script.Address) {
+				script.Type = "multisig"
+			}
+		}
+		response.Vout = append(response.Vout, RPCOut{Value: out.Value, N: i, ScriptPubKey: script})
+	}
+	return response
+}
+
+// getrawtransaction "txid" ( verbose "blockhash" )
+// Looks in the main chain, then the mempool, or in the given block only
+func (s *Server) rpcGetRawTransaction(r *http.Request, params []json.RawMessage) (interface{}, *RPCError) {
+	txID, rpcErr := rpcHash(params[0], "txid")
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	verbosity, rpcErr := rpcVerbosity(params[1], "verbose", 0)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	s.Blockchain.RLockState()
+	defer s.Blockchain.RUnlockState()
+
+	var tx *blockchain.Transaction
+	var block *blockchain.Block
+	if rpcGiven(params[2]) {
+		blockHash, rpcErr := rpcHash(params[2], "blockhash")
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		found, err := s.Blockchain.GetBlock(blockHash)
+		if err != nil {
+			return nil, rpcErrorf(rpcInvalidAddressOrKey, "Block hash not found")
+		}
+		block = &found
+		for _, candidate := range block.Transactions {
+			if bytes.Equal(candidate.ID, txID) {
+				tx = candidate
+			}
+		}
+		if tx == nil {
+			return nil, rpcErrorf(rpcInvalidAddressOrKey, "No such transaction found in the provided block")
+		}
+	} else {
+		found, location, err := s.Blockchain.FindTransactionLocation(txID)
+		switch {
+		case errors.Is(err, blockchain.ErrTxNotFound):
+			if inspector, ok := s.NetworkServer.(MempoolInspector); ok {
+				tx, _ = inspector.MempoolTransaction(hex.EncodeToString(txID))
+			}
+			if tx == nil {
+				return nil, rpcErrorf(rpcInvalidAddressOrKey, "No such mempool or blockchain transaction")
+			}
+		case err != nil:
+			return nil, rpcErrorf(rpcMiscError, "%v", err)
+		default:
+			tx = &found
+			stored, err := s.Blockchain.GetBlock(location.BlockHash)
+			if err != nil {
+				return nil, rpcErrorf(rpcMiscError, "%v", err)
+			}
+			block = &stored
+		}
+	}
+
+	if verbosity <= 0 {
+		return tx.Hex(), nil
+	}
+
+	response := rpcTransaction(tx)
+	if block != nil {
+		response.BlockHash = hex.EncodeToString(block.Hash)
+		response.Time = block.Timestamp
+		response.BlockTime = block.Timestamp
+		if mainHash, err := s.Blockchain.MainChainHashAt(block.Height); err == nil && bytes.Equal(mainHash, block.Hash) {
+			response.Confirmations = s.Blockchain.GetBestHeight() - block.Height + 1
+		}
+	}
+	return response, nil
+}
+
+// sendrawtransaction "hexstring" ( maxfeerate )
+// maxfeerate is accepted and ignored; a transaction already in the mempool
+// is answered its txid
+func (s *Server) rpcSendRawTransaction(r *http.Request, params []json.RawMessage) (interface{}, *RPCError) {
+	rawHex, rpcErr := rpcString(params[0], "hexstring")
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	tx, err := decodeRawTransaction(rawHex)
+	if err != nil {
+		return nil, rpcErrorf(rpcDeserializationError, "TX decode failed: %v", err)
+	}
+	txID := hex.EncodeToString(tx.ID)
+
+	if s.standby() {
+		return nil, rpcErrorf(rpcMiscError, "Node is a standby replica, promote it to serve this request")
+	}
+	tester, ok := s.NetworkServer.(MempoolTester)
+	inspector, _ := s.NetworkServer.(MempoolInspector)
+	if !ok || inspector == nil {
+		return nil, rpcErrorf(rpcMiscError, "Mempool is not available")
+	}
+	if _, found := inspector.MempoolTransaction(txID); found {
+		return txID, nil
+	}
+
+	s.Blockchain.RLockState()
+	_, _, err = s.Blockchain.FindTransactionLocation(tx.ID)
+	if err == nil {
+		s.Blockchain.RUnlockState()
+		return nil, rpcErrorf(rpcVerifyAlreadyInChain, "Transaction already in block chain")
+	}
+	_, err = tester.CheckMempoolAcceptance(tx)
+	s.Blockchain.RUnlockState()
+	if err != nil {
+		var rejectErr *blockchain.TxRejectError
+		if errors.As(err, &rejectErr) {
+			return nil, rpcErrorf(rpcVerifyRejected, "%s: %s", rejectErr.Code, rejectErr.Reason)
+		}
+		return nil, rpcErrorf(rpcVerifyRejected, "%v", err)
+	}
+
+	if err := s.relayTransaction(tx); err != nil {
+		return nil, rpcErrorf(rpcVerifyRejected, "%v", err)
+	}
+	return txID, nil
+}
+
+// getbalance ( "dummy" minconf include_watchonly avoid_reuse )
+// The spendable balance of the wallet addresses: mined, mature and not
+// frozen outputs, so minconf can only be 0 or 1
+func (s *Server) rpcGetBalance(r *http.Request, params []json.RawMessage) (interface{}, *RPCError) {
+	if rpcGiven(params[0]) {
+		if dummy, rpcErr := rpcString(params[0], "dummy"); rpcErr != nil || dummy != "*" {
+			return nil, rpcErrorf(rpcInvalidParameter, "dummy first argument must be excluded or set to \"*\"")
+		}
+	}
+	if rpcGiven(params[1]) {
+		minconf, rpcErr := rpcInt(params[1], "minconf")
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		if minconf > 1 {
+			return nil, rpcErrorf(rpcInvalidParameter, "minconf above 1 is not supported")
+		}
+	}
+
+	pubKeyHashes := [][]byte{}
+	for _, wallet := range s.Wallets.Wallets {
+		pubKeyHashes = append(pubKeyHashes, blockchain.HashPubKey(wallet.PublicKey))
+	}
+	if len(pubKeyHashes) == 0 {
+		return 0, nil
+	}
+
+	s.Blockchain.RLockState()
+	balance, err := s.Blockchain.BalanceContext(r.Context(), pubKeyHashes...)
+	s.Blockchain.RUnlockState()
+	if err != nil {
+		return nil, rpcErrorf(rpcMiscError, "%v", err)
+	}
+	return balance.Spendable, nil
+}
@@ -0,0 +1,303 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/marcocsrachid/blockchain-go/internal/analytics"
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+	"github.com/marcocsrachid/blockchain-go/internal/channel"
+)
+
+// API versioning
+//
+// Every route is served both unversioned (/api/...) and under the version
+// prefix (/api/v1/...). Clients can also select the version with the Accept
+// header (application/vnd.blockchain-go.v1+json). Within a version, field
+// names and types of the documented schemas never change: fields may be
+// added, but renaming, removing or retyping one requires a new version.
+// Unversioned routes always serve the latest version.
+const (
+	APIVersion       = 1
+	apiVersionHeader = "API-Version"
+)
+
+var acceptVersionPattern = regexp.MustCompile(`application/vnd\.blockchain-go\.v(\d+)\+json`)
+
+// SchemaField describes one JSON field of a response or request
+type SchemaField struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"` // string, integer, number, boolean, any, array<T>, map<T> or a schema name
+	Optional bool   `json:"optional"`
+}
+
+// Schema describes a JSON object generated from its Go struct
+type Schema struct {
+	Name   string        `json:"name"`
+	Fields []SchemaField `json:"fields"`
+}
+
+// EndpointSchema documents the request and response schemas of a route
+type EndpointSchema struct {
+	Method   string `json:"method"`
+	Path     string `json:"path"`
+	Request  string `json:"request,omitempty"`
+	Response string `json:"response"`
+}
+
+type SchemaResponse struct {
+	Version    int              `json:"version"`
+	Endpoints  []EndpointSchema `json:"endpoints"`
+	Schemas    []Schema         `json:"schemas"`
+	Error      string           `json:"error"`       // Schema of every error response
+	ErrorCodes []string         `json:"error_codes"` // Values of its code field
+}
+
+// documentedEndpoint binds a route to the Go types it decodes and encodes
+type documentedEndpoint struct {
+	method   string
+	path     string
+	request  interface{}
+	response interface{}
+}
+
+// documentedEndpoints are the routes with a stable v1 schema
+var documentedEndpoints = []documentedEndpoint{
+	{http.MethodGet, "/balance/:address", nil, BalanceResponse{}},
+	{http.MethodGet, "/addresses", nil, AddressesResponse{}},
+	{http.MethodPost, "/addresses/:address", LabelRequest{}, AddressInfo{}},
+	{http.MethodGet, "/address/:address", nil, AddressResponse{}},
+	{http.MethodGet, "/address/:address/history", nil, AddressHistoryResponse{}},
+	{http.MethodPost, "/createwallet", nil, CreateWalletResponse{}},
+	{http.MethodPost, "/send", SendRequest{}, SendResponse{}},
+	{http.MethodPost, "/anchor", AnchorRequest{}, AnchorResponse{}},
+	{http.MethodPost, "/lockunspent", LockUnspentRequest{}, ListLockUnspentResponse{}},
+	{http.MethodGet, "/listlockunspent", nil, ListLockUnspentResponse{}},
+	{http.MethodGet, "/height", nil, HeightResponse{}},
+	{http.MethodGet, "/difficulty", nil, DifficultyResponse{}},
+	{http.MethodGet, "/networkinfo", nil, NetworkInfoResponse{}},
+	{http.MethodGet, "/lastblock", nil, LastBlockResponse{}},
+	{http.MethodGet, "/block/:hash", nil, BlockResponse{}},
+	{http.MethodGet, "/block/height/:n", nil, BlockResponse{}},
+	{http.MethodPost, "/faucet", FaucetRequest{}, FaucetResponse{}},
+	{http.MethodPost, "/cosign/sessions", CreateSessionRequest{}, SessionResponse{}},
+	{http.MethodGet, "/cosign/sessions/:id", nil, SessionResponse{}},
+	{http.MethodPost, "/cosign/sessions/:id/sign", SignSessionRequest{}, SessionResponse{}},
+	{http.MethodGet, "/multisig", nil, MultisigListResponse{}},
+	{http.MethodPost, "/multisig", CreateMultisigRequest{}, MultisigResponse{}},
+	{http.MethodGet, "/attestation", nil, blockchain.Attestation{}},
+	{http.MethodGet, "/tx/:txid", nil, ChainTxResponse{}},
+	{http.MethodPost, "/tx/testaccept", RawTransactionRequest{}, TestAcceptResponse{}},
+	{http.MethodPost, "/tx/create", CreateRawTransactionRequest{}, RawTransactionResponse{}},
+	{http.MethodPost, "/tx/sign", SignRawTransactionRequest{}, RawTransactionResponse{}},
+	{http.MethodPost, "/tx/broadcast", RawTransactionRequest{}, SendResponse{}},
+	{http.MethodPost, "/tx/raw", RawTransactionRequest{}, SendResponse{}},
+	{http.MethodGet, "/mempool", nil, MempoolResponse{}},
+	{http.MethodGet, "/mempool/:txid", nil, MempoolTxResponse{}},
+	{http.MethodGet, "/mempool/conflicts/:txid", nil, MempoolConflictsResponse{}},
+	{http.MethodPost, "/mempool/conflicts", RawTransactionRequest{}, MempoolConflictsResponse{}},
+	{http.MethodGet, "/mining/template", nil, BlockTemplateResponse{}},
+	{http.MethodPost, "/mining/submit", SubmitHeaderRequest{}, SubmitBlockResponse{}},
+	{http.MethodGet, "/mining/hashps", nil, HashRateResponse{}},
+	{http.MethodGet, "/deployments", nil, DeploymentsResponse{}},
+	{http.MethodGet, "/mining/status", nil, MiningStatusResponse{}},
+	{http.MethodGet, "/mining/stats", nil, MiningStatsResponse{}},
+	{http.MethodPost, "/mining/start", MiningStartRequest{}, MiningStatusResponse{}},
+	{http.MethodPost, "/mining/stop", nil, MiningStatusResponse{}},
+	{http.MethodPost, "/block/submit", SubmitBlockRequest{}, SubmitBlockResponse{}},
+	{http.MethodGet, "/peers", nil, PeersResponse{}},
+	{http.MethodGet, "/peers/ban", nil, PeerBansResponse{}},
+	{http.MethodPost, "/peers/ban", PeerBanRequest{}, PeerBansResponse{}},
+	{http.MethodPost, "/peers/unban", PeerBanRequest{}, PeerBansResponse{}},
+	{http.MethodPost, "/confirmations", WatchRequest{}, blockchain.WatchedTx{}},
+	{http.MethodGet, "/confirmations", nil, ConfirmationEventsResponse{}},
+	{http.MethodGet, "/confirmations/:txid", nil, blockchain.WatchedTx{}},
+	{http.MethodGet, "/memory", nil, MemoryResponse{}},
+	{http.MethodGet, "/status", nil, StatusResponse{}},
+	{http.MethodGet, "/estimatefee", nil, FeeEstimateResponse{}},
+	{http.MethodGet, "/jobs", nil, JobsResponse{}},
+	{http.MethodPost, "/jobs", JobRequest{}, Job{}},
+	{http.MethodGet, "/jobs/:id", nil, Job{}},
+	{http.MethodDelete, "/jobs/:id", nil, Job{}},
+	{http.MethodGet, "/cluster/:address", nil, analytics.Cluster{}},
+	{http.MethodPost, "/cluster/:address/tags", TagRequest{}, analytics.Cluster{}},
+	{http.MethodGet, "/admin/blacklist", nil, MinerBlacklistResponse{}},
+	{http.MethodPost, "/admin/blacklist", MinerBlacklistRequest{}, MinerBlacklistResponse{}},
+	{http.MethodGet, "/replica", nil, ReplicaResponse{}},
+	{http.MethodPost, "/replica/promote", nil, ReplicaResponse{}},
+	{http.MethodGet, "/channels", nil, ChannelsResponse{}},
+	{http.MethodPost, "/channels", OpenChannelRequest{}, ChannelResponse{}},
+	{http.MethodGet, "/channels/:id", nil, ChannelResponse{}},
+	{http.MethodPost, "/channels/accept", channel.Proposal{}, AcceptChannelResponse{}},
+	{http.MethodPost, "/channels/:id/fund", FundChannelRequest{}, ChannelResponse{}},
+	{http.MethodPost, "/channels/:id/pay", PayChannelRequest{}, channel.Update{}},
+	{http.MethodPost, "/channels/:id/update", channel.Update{}, ChannelResponse{}},
+	{http.MethodPost, "/channels/:id/close", nil, ChannelResponse{}},
+	{http.MethodGet, "/schema", nil, SchemaResponse{}},
+}
+
+// route registers a handler under both the unversioned and the versioned prefix
+// The public profile skips every route it does not serve
+func (s *Server) route(pattern string, handler http.HandlerFunc) {
+	handler, ok := s.publicRoute(pattern, handler)
+	if !ok {
+		return
+	}
+	handler = s.requireRole(routeRole(pattern), handler)
+
+	http.HandleFunc(pattern, s.versioned(handler))
+	http.HandleFunc(fmt.Sprintf("/api/v%d", APIVersion)+strings.TrimPrefix(pattern, "/api"), s.versioned(handler))
+}
+
+// versioned negotiates the API version, then serves the request as its
+// unversioned route so handlers parse the same path either way
+func (s *Server) versioned(next http.HandlerFunc) http.HandlerFunc {
+	prefix := fmt.Sprintf("/api/v%d/", APIVersion)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if match := acceptVersionPattern.FindStringSubmatch(r.Header.Get("Accept")); match != nil {
+			if version, _ := strconv.Atoi(match[1]); version != APIVersion {
+				s.sendError(w, fmt.Sprintf("API version %s is not supported (supported: %d)", match[1], APIVersion), http.StatusNotAcceptable)
+				return
+			}
+		}
+
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			r.URL.Path = "/api/" + strings.TrimPrefix(r.URL.Path, prefix)
+		}
+
+		w.Header().Set(apiVersionHeader, strconv.Itoa(APIVersion))
+		next(w, r)
+	}
+}
+
+// handleSchema documents the stable JSON schema of the current API version
+// GET /api/schema
+func (s *Server) handleSchema(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.sendJSON(w, buildSchema(s.servesEndpoint), http.StatusOK)
+}
+
+// BuildSchema generates the schema of every documented endpoint from its Go types
+func BuildSchema() SchemaResponse {
+	return buildSchema(func(documentedEndpoint) bool { return true })
+}
+
+// buildSchema generates the schema of the documented endpoints matching include
+func buildSchema(include func(documentedEndpoint) bool) SchemaResponse {
+	builder := &schemaBuilder{seen: make(map[string]bool)}
+	response := SchemaResponse{Version: APIVersion}
+
+	for _, endpoint := range documentedEndpoints {
+		if !include(endpoint) {
+			continue
+		}
+
+		documented := EndpointSchema{
+			Method:   endpoint.method,
+			Path:     fmt.Sprintf("/api/v%d", APIVersion) + endpoint.path,
+			Response: builder.typeName(reflect.TypeOf(endpoint.response)),
+		}
+		if endpoint.request != nil {
+			documented.Request = builder.typeName(reflect.TypeOf(endpoint.request))
+		}
+		response.Endpoints = append(response.Endpoints, documented)
+	}
+
+	response.Error = builder.typeName(reflect.TypeOf(ErrorResponse{}))
+	response.ErrorCodes = ErrorCodes
+	response.Schemas = builder.schemas
+	return response
+}
+
+// schemaBuilder collects the schemas of the structs reachable from the endpoints
+type schemaBuilder struct {
+	schemas []Schema
+	seen    map[string]bool
+}
+
+// typeName returns the schema type of t, collecting the struct schemas it uses
+func (b *schemaBuilder) typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return b.typeName(t.Elem())
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "string" // []byte is base64 encoded
+		}
+		return "array<" + b.typeName(t.Elem()) + ">"
+	case reflect.Map:
+		return "map<" + b.typeName(t.Elem()) + ">"
+	case reflect.Struct:
+		if t.PkgPath() == "time" && t.Name() == "Time" {
+			return "string" // RFC 3339
+		}
+		b.collect(t)
+		return t.Name()
+	default:
+		return "any"
+	}
+}
+
+// collect adds the schema of a struct type once
+func (b *schemaBuilder) collect(t reflect.Type) {
+	if b.seen[t.Name()] {
+		return
+	}
+	b.seen[t.Name()] = true
+
+	schema := Schema{Name: t.Name(), Fields: []SchemaField{}}
+	index := len(b.schemas)
+	b.schemas = append(b.schemas, schema)
+
+	schema.Fields = b.fields(t, schema.Fields)
+	b.schemas[index] = schema
+}
+
+// fields appends the JSON fields of a struct type, inlining embedded structs
+// the way encoding/json does
+func (b *schemaBuilder) fields(t reflect.Type, fields []SchemaField) []SchemaField {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			fields = b.fields(field.Type, fields)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		fields = append(fields, SchemaField{
+			Name:     name,
+			Type:     b.typeName(field.Type),
+			Optional: strings.Contains(options, "omitempty") || field.Type.Kind() == reflect.Ptr,
+		})
+	}
+
+	return fields
+}
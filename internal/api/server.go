@@ -1,14 +1,22 @@
 package api
 
 import (
+	"bytes"
+	"context"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 
+	"github.com/marcocsrachid/blockchain-go/internal/analytics"
 	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+	"github.com/marcocsrachid/blockchain-go/internal/channel"
 )
 
 // Server represents the HTTP API server
@@ -17,41 +25,129 @@ type Server struct {
 	Wallets       *blockchain.Wallets
 	Port          string
 	NetworkServer interface{} // Reference to network server for broadcasting
+	Faucet        *Faucet     // Optional testnet faucet (nil = disabled)
+	Sessions      *SessionStore
+	SpendAuth     *SpendAuth // Per-request spending authorization (nil = disabled)
+	Auth          *APIAuth   // API keys and tokens with role scopes (nil = open API)
+
+	Confirmations   *blockchain.ConfirmationTracker // Reorg-aware confirmation tracking of watched transactions
+	confirmationLog *ConfirmationLog
+
+	Jobs *JobQueue // Background jobs (reindex, rescan, verifychain)
+
+	Analytics *analytics.ClusterIndex // Optional address clustering and tagging (nil = disabled)
+
+	Signers map[string]blockchain.Signer // External signers by address (hardware/offline keys)
+
+	Channels *channel.Store // Optional payment channels (nil = disabled)
+
+	Public bool // Public profile: read-only routes only (see EnablePublicProfile)
+
+	Events *EventHub // WebSocket event subscriptions (/ws)
+
+	identity     *blockchain.Wallet // Node identity key used to sign attestations
+	identityErr  error
+	identityOnce sync.Once
 }
 
 // Response structures
 type BalanceResponse struct {
-	Address string `json:"address"`
-	Balance int    `json:"balance"`
+	Address   string `json:"address"`
+	Balance   int    `json:"balance"`   // Every unspent output
+	Spendable int    `json:"spendable"` // Balance minus immature and frozen outputs
+	Immature  int    `json:"immature"`  // Mining rewards not mature yet (-coinbase-maturity)
+	Frozen    int    `json:"frozen"`    // Outputs frozen with /api/lockunspent
+	Change    int    `json:"change"`    // Part of the balance held by the change addresses of a wallet address
 }
 
 type AddressesResponse struct {
-	Addresses []string `json:"addresses"`
+	Addresses []string      `json:"addresses"`
+	Details   []AddressInfo `json:"details,omitempty"` // With ?verbose=true
+}
+
+type AddressInfo struct {
+	Address   string `json:"address"`
+	Bech32    string `json:"bech32"`
+	Label     string `json:"label,omitempty"`
+	Note      string `json:"note,omitempty"`
+	CreatedAt int64  `json:"created_at,omitempty"`
+	Path      string `json:"path,omitempty"`      // HD derivation path
+	ChangeOf  string `json:"change_of,omitempty"` // Wallet address whose change this address holds
+}
+
+type LabelRequest struct {
+	Label string `json:"label"`
+	Note  string `json:"note"`
+}
+
+type AddressResponse struct {
+	Base58   string `json:"base58"`
+	Bech32   string `json:"bech32"`
+	Multisig bool   `json:"multisig"`
+	IsMine   bool   `json:"is_mine"`
+}
+
+// Directions of an address history entry
+const (
+	DirectionReceived = "received"
+	DirectionSent     = "sent"
+)
+
+type AddressHistoryEntry struct {
+	TxID      string `json:"txid"`
+	Height    int    `json:"height"`
+	Direction string `json:"direction"` // received or sent, net of the change paid back to the address
+	Amount    int    `json:"amount"`
+}
+
+type AddressHistoryResponse struct {
+	Address string                `json:"address"`
+	Indexed bool                  `json:"indexed"` // Answered by the address index (-addrindex) instead of scanning every block
+	History []AddressHistoryEntry `json:"history"` // Newest first
 }
 
 type BlockResponse struct {
-	Hash         string `json:"hash"`
-	PrevHash     string `json:"prev_hash"`
-	Height       int    `json:"height"`
-	Timestamp    int64  `json:"timestamp"`
-	Transactions int    `json:"transactions"`
-	Nonce        int    `json:"nonce"`
+	Hash          string                `json:"hash"`
+	PrevHash      string                `json:"prev_hash"`
+	Height        int                   `json:"height"`
+	Timestamp     int64                 `json:"timestamp"`
+	Transactions  int                   `json:"transactions"`
+	Nonce         int                   `json:"nonce"`
+	UTXORoot      string                `json:"utxo_root,omitempty"`
+	Version       uint32                `json:"version"`       // 0 = legacy block without version bits
+	Confirmations int                   `json:"confirmations"` // 0 = not in the main chain
+	Finalized     bool                  `json:"finalized"`
+	Pruned        bool                  `json:"pruned,omitempty"` // Only the transactions with unspent outputs are left, size and fees cover them
+	Size          int                   `json:"size"`
+	TotalFees     int                   `json:"total_fees"`
+	CoinbaseMsg   string                `json:"coinbase_message,omitempty"` // Embedded by the miner (e.g. a pool name)
+	Txs           []TransactionResponse `json:"tx"`
 }
 
 type SendRequest struct {
-	From   string `json:"from"`
-	To     string `json:"to"`
-	Amount int    `json:"amount"`
+	From    string             `json:"from"`
+	To      string             `json:"to,omitempty"`
+	Amount  int                `json:"amount,omitempty"`
+	Outputs []RecipientRequest `json:"outputs,omitempty"` // Several recipients instead of to/amount (sendmany)
+	Fee     int                `json:"fee,omitempty"`     // Left unspent on top of the payments, see /api/estimatefee
+
+	CoinSelection string `json:"coin_selection,omitempty"` // first, largest, smallest or bnb (default: node setting)
 }
 
 type SendResponse struct {
-	Success bool   `json:"success"`
-	TxID    string `json:"tx_id,omitempty"`
-	Error   string `json:"error,omitempty"`
+	Success       bool                 `json:"success"`
+	TxID          string               `json:"tx_id,omitempty"`
+	Error         string               `json:"error,omitempty"`
+	Transaction   *TransactionResponse `json:"transaction,omitempty"`
+	ChangeAddress string               `json:"change_address,omitempty"` // New address that received the change
 }
 
-type ErrorResponse struct {
-	Error string `json:"error"`
+type HeightResponse struct {
+	Height          int `json:"height"`
+	FinalizedHeight int `json:"finalized_height"`
+	FinalityDepth   int `json:"finality_depth"`
+	PrunedHeight    int `json:"pruned_height"` // -1 when no block is pruned
+	PruneDepth      int `json:"prune_depth"`   // 0 = full blocks are kept
 }
 
 type DifficultyResponse struct {
@@ -62,35 +158,55 @@ type DifficultyResponse struct {
 }
 
 type NetworkInfoResponse struct {
-	Height        int `json:"height"`
-	Difficulty    int `json:"difficulty"`
-	TotalSupply   int `json:"total_supply"`
-	MaxSupply     int `json:"max_supply"`
-	CurrentReward int `json:"current_block_reward"`
-	NextHalving   int `json:"blocks_until_halving"`
+	Height          int `json:"height"`
+	FinalizedHeight int `json:"finalized_height"` // -1 when no block is final yet
+	FinalityDepth   int `json:"finality_depth"`
+	PrunedHeight    int `json:"pruned_height"` // -1 when no block is pruned
+	Difficulty      int `json:"difficulty"`
+	TotalSupply     int `json:"total_supply"`
+	MaxSupply       int `json:"max_supply"`
+	CurrentReward   int `json:"current_block_reward"`
+	NextHalving     int `json:"blocks_until_halving"`
 }
 
 type LastBlockResponse struct {
-	Hash         string `json:"hash"`
-	Height       int    `json:"height"`
-	Timestamp    int64  `json:"timestamp"`
-	Transactions int    `json:"transactions"`
-	Nonce        int    `json:"nonce"`
-	PrevHash     string `json:"prev_hash"`
+	Hash          string                `json:"hash"`
+	Height        int                   `json:"height"`
+	Timestamp     int64                 `json:"timestamp"`
+	Transactions  int                   `json:"transactions"`
+	Nonce         int                   `json:"nonce"`
+	PrevHash      string                `json:"prev_hash"`
+	UTXORoot      string                `json:"utxo_root,omitempty"`
+	Version       uint32                `json:"version"` // 0 = legacy block without version bits
+	Confirmations int                   `json:"confirmations"`
+	Finalized     bool                  `json:"finalized"`
+	Size          int                   `json:"size"`
+	TotalFees     int                   `json:"total_fees"`
+	CoinbaseMsg   string                `json:"coinbase_message,omitempty"` // Embedded by the miner (e.g. a pool name)
+	Txs           []TransactionResponse `json:"tx"`
 }
 
 type CreateWalletResponse struct {
 	Address string `json:"address"`
+	Bech32  string `json:"bech32"`         // Same address in bech32 format
+	Path    string `json:"path,omitempty"` // HD derivation path
 	Message string `json:"message"`
 }
 
 // NewServer creates a new API server
 func NewServer(chain *blockchain.Blockchain, wallets *blockchain.Wallets, port string) *Server {
+	confirmations := blockchain.NewConfirmationTracker()
+
 	return &Server{
-		Blockchain:    chain,
-		Wallets:       wallets,
-		Port:          port,
-		NetworkServer: nil, // Will be set later to avoid circular dependency
+		Blockchain:      chain,
+		Wallets:         wallets,
+		Port:            port,
+		NetworkServer:   nil, // Will be set later to avoid circular dependency
+		Sessions:        NewSessionStore(),
+		Confirmations:   confirmations,
+		confirmationLog: newConfirmationLog(confirmations),
+		Jobs:            NewJobQueue(),
+		Events:          newEventHub(),
 	}
 }
 
@@ -101,16 +217,71 @@ func (s *Server) SetNetworkServer(networkServer interface{}) {
 
 // Start starts the HTTP API server
 func (s *Server) Start() error {
-	http.HandleFunc("/api/balance/", s.handleGetBalance)
-	http.HandleFunc("/api/addresses", s.handleGetAddresses)
-	http.HandleFunc("/api/createwallet", s.handleCreateWallet)
-	http.HandleFunc("/api/send", s.handleSend)
-	http.HandleFunc("/api/height", s.handleGetHeight)
-	http.HandleFunc("/api/difficulty", s.handleGetDifficulty)
-	http.HandleFunc("/api/networkinfo", s.handleGetNetworkInfo)
-	http.HandleFunc("/api/lastblock", s.handleGetLastBlock)
-	http.HandleFunc("/api/block/", s.handleGetBlockByHash)
+	s.route("/api/balance/", s.consistentRead(s.handleGetBalance))
+	s.route("/api/addresses", s.handleGetAddresses)
+	s.route("/api/addresses/", s.handleSetAddressLabel)
+	s.route("/api/address/", s.handleGetAddress)
+	s.route("/api/createwallet", s.handleCreateWallet)
+	s.route("/api/send", s.requireActive(s.requireSpendAuth(s.handleSend)))
+	s.route("/api/anchor", s.requireActive(s.requireSpendAuth(s.handleAnchor)))
+	s.route("/api/lockunspent", s.requireSpendAuth(s.handleLockUnspent))
+	s.route("/api/listlockunspent", s.consistentRead(s.handleListLockUnspent))
+	s.route("/api/height", s.consistentRead(s.handleGetHeight))
+	s.route("/api/difficulty", s.consistentRead(s.handleGetDifficulty))
+	s.route("/api/networkinfo", s.consistentRead(s.handleGetNetworkInfo))
+	s.route("/api/lastblock", s.consistentRead(s.handleGetLastBlock))
+	s.route("/api/block/", s.consistentRead(s.handleGetBlockByHash))
+	s.route("/api/block/height/", s.consistentRead(s.handleGetBlockByHeight))
+	s.route("/api/faucet", s.requireActive(s.handleFaucet))
+	s.route("/api/cosign/sessions", s.handleCosignSessions)
+	s.route("/api/multisig", s.handleMultisig)
+	s.route("/api/cosign/sessions/", s.requireSpendAuth(s.handleCosignSession))
+	s.route("/api/attestation", s.consistentRead(s.handleGetAttestation))
+	s.route("/api/tx/", s.consistentRead(s.handleGetTransaction))
+	s.route("/api/tx/testaccept", s.consistentRead(s.handleTestAccept))
+	s.route("/api/tx/create", s.handleCreateRawTransaction)
+	s.route("/api/tx/sign", s.consistentRead(s.handleSignRawTransaction))
+	s.route("/api/tx/broadcast", s.requireActive(s.handleBroadcastRawTransaction))
+	s.route("/api/tx/raw", s.requireActive(s.handleBroadcastRawTransaction))
+	s.route("/api/mempool", s.handleMempool)
+	s.route("/api/mempool/", s.handleMempoolTransaction)
+	s.route("/api/mempool/conflicts", s.consistentRead(s.handleCheckMempoolConflicts))
+	s.route("/api/mempool/conflicts/", s.handleMempoolConflicts)
+	s.route("/api/mining/template", s.requireActive(s.handleGetBlockTemplate))
+	s.route("/api/mining/submit", s.requireActive(s.handleSubmitHeader))
+	s.route("/api/mining/hashps", s.handleHashRate)
+	s.route("/api/deployments", s.handleDeployments)
+	s.route("/api/mining/status", s.handleMiningStatus)
+	s.route("/api/mining/stats", s.handleMiningStats)
+	s.route("/api/mining/start", s.requireActive(s.requireSpendAuth(s.handleMiningStart)))
+	s.route("/api/mining/stop", s.requireSpendAuth(s.handleMiningStop))
+	s.route("/api/block/submit", s.requireActive(s.handleSubmitBlock))
+	s.route("/api/peers", s.handleGetPeers)
+	s.route("/api/peers/ban", s.requireSpendAuth(s.handlePeerBan))
+	s.route("/api/peers/unban", s.requireSpendAuth(s.handlePeerUnban))
+	s.route("/api/confirmations", s.consistentRead(s.handleConfirmations))
+	s.route("/api/confirmations/", s.handleConfirmation)
+	s.route("/api/memory", s.handleGetMemory)
+	s.route("/api/status", s.handleStatus)
+	s.route("/api/estimatefee", s.handleEstimateFee)
+	s.route("/api/jobs", s.handleJobs)
+	s.route("/api/jobs/", s.handleJob)
+	s.route("/api/cluster/", s.consistentRead(s.handleCluster))
+	s.route("/api/admin/blacklist", s.requireSpendAuth(s.handleMinerBlacklist))
+	s.route("/api/admin/backup", s.requireSpendAuth(s.handleBackup))
+	s.route("/api/replica", s.handleReplica)
+	s.route("/api/replica/promote", s.requireSpendAuth(s.handlePromoteReplica))
+	s.route("/api/channels", s.requireSpendAuth(s.handleChannels))
+	s.route("/api/channels/", s.requireSpendAuth(s.handleChannel))
+	s.route("/api/schema", s.handleSchema)
 	http.HandleFunc("/health", s.handleHealth)
+	http.HandleFunc("/metrics", s.requireRole(fixedRole(RoleRead), s.handleMetrics))
+	http.HandleFunc("/ws", s.requireRole(fixedRole(RoleRead), s.handleWebSocket))
+	http.HandleFunc("/graphql", s.requireRole(fixedRole(RoleRead), s.consistentRead(s.handleGraphQL)))
+	if !s.Public {
+		http.HandleFunc("/rpc", s.requireRole(fixedRole(RoleRead), s.handleRPC)) // Spends and reads the wallet, roles checked per method
+	}
+	go s.eventLoop()
 
 	addr := fmt.Sprintf(":%s", s.Port)
 	log.Printf("API server started on http://0.0.0.0%s", addr)
@@ -134,31 +305,46 @@ func (s *Server) handleGetBalance(w http.ResponseWriter, r *http.Request) {
 
 	// Validate address
 	if !blockchain.ValidateAddress(address) {
-		s.sendError(w, "Invalid address format", http.StatusBadRequest)
+		s.sendErrorCode(w, ErrCodeInvalidAddress, "Invalid address format", nil, http.StatusBadRequest)
 		return
 	}
 
-	// Get balance
-	pubKeyHash := blockchain.Base58Decode([]byte(address))
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
+	// Get balance, including the change addresses of a wallet address
+	pubKeyHash, _ := blockchain.AddressToPubKeyHash(address)
+	base58 := string(blockchain.PubKeyHashToAddress(pubKeyHash))
+
+	var changeKeys [][]byte
+	for _, change := range s.Wallets.ChangeAddresses(base58) {
+		changeKeys = append(changeKeys, blockchain.HashPubKey(s.Wallets.Wallets[change].PublicKey))
+	}
 
-	UTXOSet := blockchain.UTXOSet{Blockchain: s.Blockchain}
-	UTXOs := UTXOSet.FindUTXO(pubKeyHash)
+	balance, err := s.Blockchain.BalanceContext(r.Context(), append([][]byte{pubKeyHash}, changeKeys...)...)
+	if requestAbandoned(r, err) {
+		return
+	}
 
-	balance := 0
-	for _, out := range UTXOs {
-		balance += out.Value
+	var change blockchain.Balance
+	if len(changeKeys) > 0 {
+		change, err = s.Blockchain.BalanceContext(r.Context(), changeKeys...)
+		if requestAbandoned(r, err) {
+			return
+		}
 	}
 
 	response := BalanceResponse{
-		Address: address,
-		Balance: balance,
+		Address:   address,
+		Balance:   balance.Total,
+		Spendable: balance.Spendable,
+		Immature:  balance.Immature,
+		Frozen:    balance.Frozen,
+		Change:    change.Total,
 	}
 
 	s.sendJSON(w, response, http.StatusOK)
 }
 
 // handleGetAddresses returns all wallet addresses
+// With ?verbose=true labels, notes and creation times are included
 // GET /api/addresses
 func (s *Server) handleGetAddresses(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -167,15 +353,142 @@ func (s *Server) handleGetAddresses(w http.ResponseWriter, r *http.Request) {
 	}
 
 	addresses := s.Wallets.GetAllAddresses()
+	sort.Strings(addresses)
 
 	response := AddressesResponse{
 		Addresses: addresses,
 	}
 
+	if r.URL.Query().Get("verbose") == "true" {
+		for _, address := range addresses {
+			response.Details = append(response.Details, addressInfo(address, s.Wallets.Wallets[address]))
+		}
+	}
+
+	s.sendJSON(w, response, http.StatusOK)
+}
+
+// handleSetAddressLabel sets the label and note of a wallet address
+// POST /api/addresses/:address {"label": "...", "note": "..."}
+func (s *Server) handleSetAddressLabel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req LabelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	address, err := blockchain.ToBase58Address(r.URL.Path[len("/api/addresses/"):])
+	if err != nil {
+		s.sendErrorCode(w, ErrCodeInvalidAddress, "Invalid address format", nil, http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Wallets.SetLabel(address, req.Label, req.Note); err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.Wallets.SaveFile()
+
+	s.sendJSON(w, addressInfo(address, s.Wallets.Wallets[address]), http.StatusOK)
+}
+
+// addressInfo builds the API view of a wallet address
+func addressInfo(address string, wallet *blockchain.Wallet) AddressInfo {
+	return AddressInfo{
+		Address:   address,
+		Bech32:    blockchain.PubKeyHashToBech32Address(blockchain.HashPubKey(wallet.PublicKey)),
+		Label:     wallet.Label,
+		Note:      wallet.Note,
+		CreatedAt: wallet.CreatedAt,
+		Path:      wallet.Path,
+		ChangeOf:  wallet.ChangeOf,
+	}
+}
+
+// handleGetAddress validates an address and returns it in both formats
+// GET /api/address/:address
+// GET /api/address/:address/history
+func (s *Server) handleGetAddress(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if address, ok := strings.CutSuffix(r.URL.Path[len("/api/address/"):], "/history"); ok {
+		s.handleAddressHistory(w, r, address)
+		return
+	}
+
+	pubKeyHash, err := blockchain.AddressToPubKeyHash(r.URL.Path[len("/api/address/"):])
+	if err != nil {
+		s.sendErrorCode(w, ErrCodeInvalidAddress, fmt.Sprintf("Invalid address: %v", err), nil, http.StatusBadRequest)
+		return
+	}
+
+	response := AddressResponse{
+		Base58:   string(blockchain.PubKeyHashToAddress(pubKeyHash)),
+		Bech32:   blockchain.PubKeyHashToBech32Address(pubKeyHash),
+		Multisig: blockchain.IsMultisigAddress(string(blockchain.PubKeyHashToAddress(pubKeyHash))),
+	}
+	_, mine := s.Wallets.Wallets[response.Base58]
+	response.IsMine = mine || s.Wallets.Multisig[response.Base58] != nil
+
+	s.sendJSON(w, response, http.StatusOK)
+}
+
+// handleAddressHistory lists the main chain transactions paying or spending
+// from an address
+func (s *Server) handleAddressHistory(w http.ResponseWriter, r *http.Request, address string) {
+	pubKeyHash, err := blockchain.AddressToPubKeyHash(address)
+	if err != nil {
+		s.sendErrorCode(w, ErrCodeInvalidAddress, fmt.Sprintf("Invalid address: %v", err), nil, http.StatusBadRequest)
+		return
+	}
+
+	s.Blockchain.RLockState()
+	history, err := s.Blockchain.AddressHistory(r.Context(), pubKeyHash)
+	s.Blockchain.RUnlockState()
+	if requestAbandoned(r, err) {
+		return
+	}
+	if errors.Is(err, blockchain.ErrPruned) {
+		s.sendError(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := AddressHistoryResponse{
+		Address: address,
+		Indexed: s.Blockchain.AddrIndex,
+		History: make([]AddressHistoryEntry, 0, len(history)),
+	}
+	for _, entry := range history {
+		item := AddressHistoryEntry{
+			TxID:      fmt.Sprintf("%x", entry.TxID),
+			Height:    entry.Height,
+			Direction: DirectionReceived,
+			Amount:    entry.Net(),
+		}
+		if entry.Net() < 0 {
+			item.Direction = DirectionSent
+			item.Amount = -entry.Net()
+		}
+		response.History = append(response.History, item)
+	}
+
 	s.sendJSON(w, response, http.StatusOK)
 }
 
 // handleCreateWallet creates a new wallet and returns the address
+// With ?hd=true the address is derived from the wallet's HD seed
 // POST /api/createwallet
 func (s *Server) handleCreateWallet(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -184,13 +497,29 @@ func (s *Server) handleCreateWallet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create new wallet
-	address := s.Wallets.AddWallet()
+	var address string
+	if r.URL.Query().Get("hd") == "true" {
+		if !s.Wallets.IsHD() {
+			s.sendError(w, "Wallet has no HD seed, initialize it with 'createwallet -hd'", http.StatusBadRequest)
+			return
+		}
+
+		var err error
+		if address, err = s.Wallets.AddHDWallet(); err != nil {
+			s.sendError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		address = s.Wallets.AddWallet()
+	}
 
 	// Save wallets to file
 	s.Wallets.SaveFile()
 
 	response := CreateWalletResponse{
 		Address: address,
+		Bech32:  blockchain.PubKeyHashToBech32Address(blockchain.HashPubKey(s.Wallets.Wallets[address].PublicKey)),
+		Path:    s.Wallets.Wallets[address].Path,
 		Message: "Wallet created successfully",
 	}
 
@@ -227,13 +556,63 @@ func (s *Server) handleGetBlockByHash(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.sendBlock(w, r, &block)
+}
+
+// handleGetBlockByHeight returns the main chain block at a height
+// GET /api/block/height/:n
+func (s *Server) handleGetBlockByHeight(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	height, err := strconv.Atoi(r.URL.Path[len("/api/block/height/"):])
+	if err != nil || height < 0 {
+		s.sendError(w, "Invalid block height", http.StatusBadRequest)
+		return
+	}
+
+	block, err := s.Blockchain.GetBlockByHeight(height)
+	if err != nil {
+		s.sendError(w, "Block not found", http.StatusNotFound)
+		return
+	}
+
+	s.sendBlock(w, r, &block)
+}
+
+// sendBlock writes the API representation of a stored block
+func (s *Server) sendBlock(w http.ResponseWriter, r *http.Request, block *blockchain.Block) {
+	txs, totalFees, err := s.blockTransactions(r.Context(), block)
+	if requestAbandoned(r, err) {
+		return
+	}
+
+	// Only main chain blocks have confirmations
+	mainHash, err := s.Blockchain.MainChainHashAt(block.Height)
+	inMainChain := err == nil && bytes.Equal(mainHash, block.Hash)
+	confirmations := 0
+	if inMainChain {
+		confirmations = s.Blockchain.GetBestHeight() - block.Height + 1
+	}
+
 	response := BlockResponse{
-		Hash:         fmt.Sprintf("%x", block.Hash),
-		PrevHash:     fmt.Sprintf("%x", block.PrevHash),
-		Height:       block.Height,
-		Timestamp:    block.Timestamp,
-		Transactions: len(block.Transactions),
-		Nonce:        block.Nonce,
+		Hash:          fmt.Sprintf("%x", block.Hash),
+		PrevHash:      fmt.Sprintf("%x", block.PrevHash),
+		Height:        block.Height,
+		Timestamp:     block.Timestamp,
+		Transactions:  len(block.Transactions),
+		Nonce:         block.Nonce,
+		UTXORoot:      fmt.Sprintf("%x", block.UTXORoot),
+		Version:       block.Version,
+		Confirmations: confirmations,
+		Finalized:     inMainChain && s.Blockchain.IsFinalized(block.Height),
+		Pruned:        inMainChain && s.Blockchain.IsPruned(block.Height),
+		Size:          block.Size(),
+		TotalFees:     totalFees,
+		CoinbaseMsg:   block.CoinbaseMessage(),
+		Txs:           txs,
 	}
 
 	s.sendJSON(w, response, http.StatusOK)
@@ -256,70 +635,178 @@ func (s *Server) handleSend(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate inputs
-	if req.From == "" || req.To == "" || req.Amount <= 0 {
-		s.sendError(w, "From, To, and Amount are required", http.StatusBadRequest)
+	if req.From == "" {
+		s.sendError(w, "From, To, and Amount (or Outputs) are required", http.StatusBadRequest)
+		return
+	}
+	if req.Fee < 0 {
+		s.sendError(w, "Fee cannot be negative", http.StatusBadRequest)
 		return
 	}
 
 	if !blockchain.ValidateAddress(req.From) {
-		s.sendError(w, "Invalid 'from' address", http.StatusBadRequest)
+		s.sendErrorCode(w, ErrCodeInvalidAddress, "Invalid 'from' address", nil, http.StatusBadRequest)
 		return
 	}
+	req.From, _ = blockchain.ToBase58Address(req.From) // Wallets are keyed by Base58 address
 
-	if !blockchain.ValidateAddress(req.To) {
-		s.sendError(w, "Invalid 'to' address", http.StatusBadRequest)
+	recipients, err := sendRecipients(req)
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Get wallet to verify it exists
-	wallet := s.Wallets.GetWallet(req.From)
-
-	// Check if wallet exists by verifying if public key is empty
-	if len(wallet.PublicKey) == 0 {
-		s.sendError(w, "Wallet not found for 'from' address", http.StatusNotFound)
-		return
+	var selector blockchain.CoinSelector
+	if req.CoinSelection != "" {
+		if selector, err = blockchain.ParseCoinSelector(req.CoinSelection); err != nil {
+			s.sendError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 	}
 
-	log.Printf("🔵 API: Received send request - From: %s, To: %s, Amount: %d", req.From, req.To, req.Amount)
+	log.Printf("🔵 API: Received send request - From: %s, Recipients: %d, Amount: %d", req.From, len(recipients), totalAmount(recipients))
 
-	// Create transaction using addresses
-	tx := blockchain.NewTransaction(req.From, req.To, req.Amount, s.Blockchain)
+	var tx *blockchain.Transaction
+	var changeAddress string
+	if signer, ok := s.Signers[req.From]; ok {
+		if tx, err = s.newExternallySignedTransaction(req.From, recipients, req.Fee, selector, signer); err != nil {
+			log.Printf("❌ API: External signing failed: %v", err)
+			s.sendErr(w, "Failed to create transaction: ", err, http.StatusBadRequest)
+			return
+		}
+	} else {
+		// Verify the wallet exists
+		if wallet, ok := s.Wallets.Wallets[req.From]; !ok || wallet == nil || len(wallet.PublicKey) == 0 {
+			s.sendErrorCode(w, ErrCodeWalletNotFound, "Wallet not found for 'from' address", nil, http.StatusNotFound)
+			return
+		}
+
+		// Create transaction using addresses, also spending the change addresses of the sender
+		s.Blockchain.RLockState()
+		tx, changeAddress, err = s.Wallets.NewTransaction(req.From, recipients, req.Fee, selector, s.Blockchain)
+		s.Blockchain.RUnlockState()
+		if err != nil {
+			log.Printf("❌ API: Transaction creation failed: %v", err)
+			s.sendErr(w, "Failed to create transaction: ", err, http.StatusBadRequest)
+			return
+		}
+		if changeAddress != "" {
+			s.Wallets.SaveFile()
+		}
+	}
 	if tx == nil {
 		log.Printf("❌ API: Transaction creation failed - insufficient funds")
-		s.sendError(w, "Failed to create transaction - insufficient funds", http.StatusBadRequest)
+		s.sendErrorCode(w, ErrCodeInsufficientFunds, "Failed to create transaction - insufficient funds", nil, http.StatusBadRequest)
 		return
 	}
 
 	log.Printf("✅ API: Transaction created successfully: %x", tx.ID)
 
 	// Add transaction to local mempool first
-	if s.NetworkServer != nil {
-		// Type assert to add to local mempool
-		type MempoolManager interface {
-			AddToMempool(tx *blockchain.Transaction)
-			BroadcastTx(tx *blockchain.Transaction)
-		}
-		if manager, ok := s.NetworkServer.(MempoolManager); ok {
-			manager.AddToMempool(tx)
-			log.Printf("📥 API: Added transaction to local mempool")
-			manager.BroadcastTx(tx)
-			log.Printf("📤 API: Transaction broadcasted: %x", tx.ID)
-		} else {
-			log.Printf("⚠️  API: NetworkServer does not implement required methods!")
-		}
-	} else {
-		log.Printf("⚠️  API: NetworkServer is nil - transaction will NOT be broadcasted!")
+	if err := s.relayTransaction(tx); err != nil {
+		s.sendRejected(w, err)
+		return
 	}
 
+	txResponse := s.newTransactionResponse(tx)
+
 	response := SendResponse{
-		Success: true,
-		TxID:    fmt.Sprintf("%x", tx.ID),
+		Success:       true,
+		TxID:          fmt.Sprintf("%x", tx.ID),
+		Transaction:   &txResponse,
+		ChangeAddress: changeAddress,
 	}
 
 	log.Printf("🔵 API: Sending response to client")
 	s.sendJSON(w, response, http.StatusOK)
 }
 
+// sendRecipients returns the payments of a send request: either to/amount
+// or the outputs of a sendmany
+func sendRecipients(req SendRequest) ([]blockchain.Recipient, error) {
+	outputs := req.Outputs
+	if len(outputs) == 0 {
+		if req.To == "" || req.Amount <= 0 {
+			return nil, fmt.Errorf("From, To, and Amount (or Outputs) are required")
+		}
+		outputs = []RecipientRequest{{Address: req.To, Amount: req.Amount}}
+	} else if req.To != "" || req.Amount != 0 {
+		return nil, fmt.Errorf("To/Amount cannot be combined with Outputs")
+	}
+
+	recipients := make([]blockchain.Recipient, 0, len(outputs))
+	for _, output := range outputs {
+		if !blockchain.ValidateAddress(output.Address) {
+			return nil, fmt.Errorf("Invalid recipient address %s", output.Address)
+		}
+		if output.Amount <= 0 {
+			return nil, fmt.Errorf("Invalid amount %d for %s", output.Amount, output.Address)
+		}
+		recipients = append(recipients, blockchain.Recipient{Address: output.Address, Amount: output.Amount})
+	}
+
+	return recipients, nil
+}
+
+// totalAmount returns the sum paid to recipients
+func totalAmount(recipients []blockchain.Recipient) int {
+	total := 0
+	for _, recipient := range recipients {
+		total += recipient.Amount
+	}
+	return total
+}
+
+// consistentRead serves a read-only handler under the chain state read lock,
+// so a response never mixes data from before and after a block connect
+// Handlers that relay to peers or wait (long polls) must lock only their reads
+func (s *Server) consistentRead(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.Blockchain.RLockState()
+		defer s.Blockchain.RUnlockState()
+
+		next(w, r)
+	}
+}
+
+// requestAbandoned reports whether a query failed because the client went
+// away (its request context is done); nobody is left to answer then
+func requestAbandoned(r *http.Request, err error) bool {
+	if err == nil || r.Context().Err() == nil {
+		return false
+	}
+
+	log.Printf("🔌 API: %s %s abandoned by the client", r.Method, r.URL.Path)
+	return true
+}
+
+// relayTransaction adds a transaction to the local mempool and broadcasts it to peers
+// A transaction the mempool refuses (e.g. a double spend) is not broadcast
+func (s *Server) relayTransaction(tx *blockchain.Transaction) error {
+	if s.NetworkServer == nil {
+		log.Printf("⚠️  API: NetworkServer is nil - transaction will NOT be broadcasted!")
+		return nil
+	}
+
+	// Type assert to add to local mempool
+	type MempoolManager interface {
+		AddToMempool(tx *blockchain.Transaction) error
+		BroadcastTx(tx *blockchain.Transaction)
+	}
+	if manager, ok := s.NetworkServer.(MempoolManager); ok {
+		if err := manager.AddToMempool(tx); err != nil {
+			log.Printf("❌ API: Transaction %x refused by the mempool: %v", tx.ID, err)
+			return err
+		}
+		log.Printf("📥 API: Added transaction to local mempool")
+		manager.BroadcastTx(tx)
+		log.Printf("📤 API: Transaction broadcasted: %x", tx.ID)
+	} else {
+		log.Printf("⚠️  API: NetworkServer does not implement required methods!")
+	}
+	return nil
+}
+
 // handleGetHeight returns the current blockchain height
 // GET /api/height
 func (s *Server) handleGetHeight(w http.ResponseWriter, r *http.Request) {
@@ -330,8 +817,12 @@ func (s *Server) handleGetHeight(w http.ResponseWriter, r *http.Request) {
 
 	height := s.Blockchain.GetBestHeight()
 
-	response := map[string]int{
-		"height": height,
+	response := HeightResponse{
+		Height:          height,
+		FinalizedHeight: s.Blockchain.FinalizedHeight(),
+		FinalityDepth:   s.Blockchain.FinalityDepth,
+		PrunedHeight:    s.Blockchain.PrunedHeight(),
+		PruneDepth:      s.Blockchain.PruneDepth,
 	}
 
 	s.sendJSON(w, response, http.StatusOK)
@@ -345,20 +836,40 @@ func (s *Server) handleGetLastBlock(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	lastBlock := s.Blockchain.GetLastBlock()
-
-	response := LastBlockResponse{
-		Hash:         fmt.Sprintf("%x", lastBlock.Hash),
-		Height:       lastBlock.Height,
-		Timestamp:    lastBlock.Timestamp,
-		Transactions: len(lastBlock.Transactions),
-		Nonce:        lastBlock.Nonce,
-		PrevHash:     fmt.Sprintf("%x", lastBlock.PrevHash),
+	response, err := s.blockSummary(r.Context(), s.Blockchain.GetLastBlock())
+	if requestAbandoned(r, err) {
+		return
 	}
 
 	s.sendJSON(w, response, http.StatusOK)
 }
 
+// blockSummary builds the API representation of a main chain block with its
+// transactions, as /api/lastblock and the newblock event show it
+func (s *Server) blockSummary(ctx context.Context, block *blockchain.Block) (LastBlockResponse, error) {
+	txs, totalFees, err := s.blockTransactions(ctx, block)
+	if err != nil {
+		return LastBlockResponse{}, err
+	}
+
+	return LastBlockResponse{
+		Hash:          fmt.Sprintf("%x", block.Hash),
+		Height:        block.Height,
+		Timestamp:     block.Timestamp,
+		Transactions:  len(block.Transactions),
+		Nonce:         block.Nonce,
+		PrevHash:      fmt.Sprintf("%x", block.PrevHash),
+		UTXORoot:      fmt.Sprintf("%x", block.UTXORoot),
+		Version:       block.Version,
+		Confirmations: max(s.Blockchain.GetBestHeight()-block.Height+1, 1),
+		Finalized:     s.Blockchain.IsFinalized(block.Height),
+		Size:          block.Size(),
+		TotalFees:     totalFees,
+		CoinbaseMsg:   block.CoinbaseMessage(),
+		Txs:           txs,
+	}, nil
+}
+
 // handleGetDifficulty returns the current network difficulty
 // GET /api/difficulty
 func (s *Server) handleGetDifficulty(w http.ResponseWriter, r *http.Request) {
@@ -367,9 +878,10 @@ func (s *Server) handleGetDifficulty(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	difficulty := s.Blockchain.Params.Difficulty
 	response := DifficultyResponse{
-		Difficulty:      blockchain.Difficulty,
-		Target:          fmt.Sprintf("2^(256-%d) = %d leading zeros required", blockchain.Difficulty, blockchain.Difficulty),
+		Difficulty:      difficulty,
+		Target:          fmt.Sprintf("2^(256-%d) = %d leading zeros required", difficulty, difficulty),
 		HashRate:        "Higher difficulty = more computational work required",
 		TargetBlockTime: 60, // 1 minute target
 	}
@@ -385,42 +897,49 @@ func (s *Server) handleGetNetworkInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	params := s.Blockchain.Params
 	height := s.Blockchain.GetBestHeight()
-	currentReward := blockchain.GetBlockReward(height)
+	currentReward := params.BlockReward(height)
 
 	// Calculate blocks until next halving
-	blocksUntilHalving := blockchain.HalvingInterval - (height % blockchain.HalvingInterval)
+	blocksUntilHalving := params.HalvingInterval - (height % params.HalvingInterval)
 
 	// Estimate current supply (simplified - doesn't account for lost coins)
 	// This is an approximation
-	totalSupply := calculateTotalSupply(height)
+	totalSupply := calculateTotalSupply(params, height)
 
 	response := NetworkInfoResponse{
-		Height:        height,
-		Difficulty:    blockchain.Difficulty,
-		TotalSupply:   totalSupply,
-		MaxSupply:     blockchain.MaxSupply,
-		CurrentReward: currentReward,
-		NextHalving:   blocksUntilHalving,
+		Height:          height,
+		FinalizedHeight: s.Blockchain.FinalizedHeight(),
+		FinalityDepth:   s.Blockchain.FinalityDepth,
+		PrunedHeight:    s.Blockchain.PrunedHeight(),
+		Difficulty:      params.Difficulty,
+		TotalSupply:     totalSupply,
+		MaxSupply:       params.MaxSupply,
+		CurrentReward:   currentReward,
+		NextHalving:     blocksUntilHalving,
 	}
 
 	s.sendJSON(w, response, http.StatusOK)
 }
 
 // calculateTotalSupply estimates the total supply based on current height
-func calculateTotalSupply(height int) int {
+func calculateTotalSupply(params *blockchain.ChainParams, height int) int {
 	totalSupply := 0
-	currentReward := blockchain.InitialSubsidy
+	for _, alloc := range params.Genesis.Alloc {
+		totalSupply += alloc.Value // Premine of a private network
+	}
+	currentReward := params.InitialSubsidy
 	blocksProcessed := 0
 
 	for blocksProcessed <= height && currentReward > 0 {
-		blocksInThisEra := blockchain.HalvingInterval
+		blocksInThisEra := params.HalvingInterval
 		if blocksProcessed+blocksInThisEra > height {
 			blocksInThisEra = height - blocksProcessed + 1
 		}
 
 		totalSupply += blocksInThisEra * currentReward
-		blocksProcessed += blockchain.HalvingInterval
+		blocksProcessed += params.HalvingInterval
 		currentReward = currentReward / 2
 	}
 
@@ -446,13 +965,6 @@ func (s *Server) sendJSON(w http.ResponseWriter, data interface{}, status int) {
 	}
 }
 
-func (s *Server) sendError(w http.ResponseWriter, message string, status int) {
-	response := ErrorResponse{
-		Error: message,
-	}
-	s.sendJSON(w, response, status)
-}
-
 // ParseIntParam parses an integer parameter from the request
 func ParseIntParam(r *http.Request, param string, defaultValue int) int {
 	value := r.URL.Query().Get(param)
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// EnableExternalSigner lets /api/send spend from address by delegating
+// signatures to signer (a separate process or hardware device)
+func (s *Server) EnableExternalSigner(address string, signer blockchain.Signer) {
+	if s.Signers == nil {
+		s.Signers = make(map[string]blockchain.Signer)
+	}
+	s.Signers[address] = signer
+	log.Printf("✍️  External signer enabled for %s", address)
+}
+
+// newExternallySignedTransaction builds a payment under the chain state lock
+// and signs it afterwards, so a signer waiting for confirmation on a device
+// does not block block processing
+func (s *Server) newExternallySignedTransaction(from string, recipients []blockchain.Recipient, fee int, selector blockchain.CoinSelector, signer blockchain.Signer) (*blockchain.Transaction, error) {
+	s.Blockchain.RLockState()
+	tx, err := blockchain.NewUnsignedTransaction(
+		[]blockchain.Funding{{Address: from, PubKey: signer.PublicKey(), Amount: totalAmount(recipients) + fee, Selector: selector}},
+		recipients,
+		s.Blockchain,
+	)
+	var prevTXs map[string]blockchain.Transaction
+	if err == nil {
+		prevTXs, err = s.Blockchain.PrevTransactions(tx)
+	}
+	s.Blockchain.RUnlockState()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Sign(signer, prevTXs); err != nil {
+		return nil, err
+	}
+	if !tx.Verify(prevTXs) {
+		return nil, fmt.Errorf("external signer produced an invalid signature")
+	}
+
+	return tx, nil
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers carrying the per-request spending authorization
+const (
+	SpendPassphraseHeader = "X-Spend-Passphrase"
+	SpendTokenHeader      = "X-Spend-Token"
+)
+
+// Spend authorization lockout of a client after repeated failures
+const (
+	maxSpendAuthFailures = 5
+	spendAuthLockout     = time.Minute
+	totpStep             = 30 // seconds
+)
+
+// SpendAuth protects spending endpoints with a passphrase and/or a TOTP second factor
+// Each spending request must carry the configured credentials, so a leaked
+// API credential alone is not enough to move funds
+// A TOTP code is accepted once: codes of its time step or an earlier one are
+// refused afterwards. Failures lock out the client IP making them, not every
+// client of the node
+type SpendAuth struct {
+	passphraseHash []byte // SHA-256 of the spending passphrase (nil = not required)
+	totpSecret     []byte // TOTP shared secret (nil = not required)
+
+	lastCounter int64                        // Time step of the last accepted TOTP code
+	clients     map[string]*spendAuthFailure // Failed attempts by client IP
+	mu          sync.Mutex
+}
+
+// spendAuthFailure counts the failed attempts of a client
+type spendAuthFailure struct {
+	failures    int
+	lockedUntil time.Time
+	last        time.Time
+}
+
+// NewSpendAuth creates a spend authorizer
+// passphrase and totpSecret (base32, as shown by authenticator apps) are both optional
+func NewSpendAuth(passphrase, totpSecret string) (*SpendAuth, error) {
+	auth := &SpendAuth{clients: make(map[string]*spendAuthFailure)}
+
+	if passphrase != "" {
+		hash := sha256.Sum256([]byte(passphrase))
+		auth.passphraseHash = hash[:]
+	}
+
+	if totpSecret != "" {
+		secret := strings.ToUpper(strings.ReplaceAll(totpSecret, " ", ""))
+		key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+		if err != nil {
+			return nil, fmt.Errorf("invalid TOTP secret: %v", err)
+		}
+		auth.totpSecret = key
+	}
+
+	if auth.passphraseHash == nil && auth.totpSecret == nil {
+		return nil, nil
+	}
+
+	return auth, nil
+}
+
+// NewSpendAuthFromEnv configures spend authorization from
+// BLOCKCHAIN_SPEND_PASSPHRASE and BLOCKCHAIN_SPEND_TOTP_SECRET
+// Returns nil when neither is set
+func NewSpendAuthFromEnv() (*SpendAuth, error) {
+	return NewSpendAuth(os.Getenv("BLOCKCHAIN_SPEND_PASSPHRASE"), os.Getenv("BLOCKCHAIN_SPEND_TOTP_SECRET"))
+}
+
+// EnableSpendAuth requires spend authorization on all spending endpoints
+func (s *Server) EnableSpendAuth(auth *SpendAuth) {
+	s.SpendAuth = auth
+	log.Printf("🔐 Spending endpoints require per-request authorization (passphrase: %v, TOTP: %v)",
+		auth.passphraseHash != nil, auth.totpSecret != nil)
+}
+
+// authorize checks the spend credentials of a request
+func (a *SpendAuth) authorize(r *http.Request) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	ip := spendAuthClient(r)
+	client := a.clients[ip]
+	if client != nil && now.Before(client.lockedUntil) {
+		return fmt.Errorf("too many failed attempts, spending locked for %s", client.lockedUntil.Sub(now).Round(time.Second))
+	}
+
+	counter, err := a.check(r, now)
+	if err != nil {
+		a.pruneClients(now)
+		if client == nil {
+			client = &spendAuthFailure{}
+			a.clients[ip] = client
+		}
+		client.failures++
+		client.last = now
+		if client.failures >= maxSpendAuthFailures {
+			client.failures = 0
+			client.lockedUntil = now.Add(spendAuthLockout)
+			log.Printf("🔐 Spend authorization locked for %s for %s after repeated failures", ip, spendAuthLockout)
+		}
+		return err
+	}
+
+	if a.totpSecret != nil {
+		a.lastCounter = counter
+	}
+	delete(a.clients, ip)
+	return nil
+}
+
+// check verifies the credentials of a request, returning the time step of
+// its TOTP code
+func (a *SpendAuth) check(r *http.Request, now time.Time) (int64, error) {
+	if a.passphraseHash != nil {
+		hash := sha256.Sum256([]byte(r.Header.Get(SpendPassphraseHeader)))
+		if subtle.ConstantTimeCompare(hash[:], a.passphraseHash) != 1 {
+			return 0, fmt.Errorf("invalid or missing %s header", SpendPassphraseHeader)
+		}
+	}
+
+	var counter int64
+	if a.totpSecret != nil {
+		var ok bool
+		if counter, ok = a.totpCounter(r.Header.Get(SpendTokenHeader), now); !ok {
+			return 0, fmt.Errorf("invalid or missing %s header", SpendTokenHeader)
+		}
+		if counter <= a.lastCounter {
+			return 0, fmt.Errorf("%s code already used, wait for the next one", SpendTokenHeader)
+		}
+	}
+
+	return counter, nil
+}
+
+// totpCounter checks a 6-digit RFC 6238 code, allowing one step of clock
+// drift, and returns the time step it belongs to
+func (a *SpendAuth) totpCounter(code string, now time.Time) (int64, bool) {
+	if len(code) != 6 {
+		return 0, false
+	}
+
+	counter := now.Unix() / totpStep
+	for _, drift := range []int64{-1, 0, 1} {
+		expected := totp(a.totpSecret, uint64(counter+drift))
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter + drift, true
+		}
+	}
+
+	return 0, false
+}
+
+// pruneClients forgets the clients whose failures and lockout are over
+// The caller must hold a.mu
+func (a *SpendAuth) pruneClients(now time.Time) {
+	for ip, client := range a.clients {
+		if now.Sub(client.last) >= spendAuthLockout && !now.Before(client.lockedUntil) {
+			delete(a.clients, ip)
+		}
+	}
+}
+
+// spendAuthClient identifies the client of a request by its IP
+func spendAuthClient(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// totp computes a 6-digit HOTP value (RFC 4226) for a counter
+func totp(secret []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+// requireSpendAuth wraps a spending handler with per-request authorization
+// Read-only (GET) requests on the same route are not affected
+func (s *Server) requireSpendAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.SpendAuth != nil && r.Method != http.MethodGet {
+			if err := s.SpendAuth.authorize(r); err != nil {
+				log.Printf("🔐 API: Spending request from %s refused: %v", r.RemoteAddr, err)
+				s.sendErrorCode(w, ErrCodeWalletLocked, fmt.Sprintf("Spending authorization failed: %v", err), nil, http.StatusUnauthorized)
+				return
+			}
+		}
+
+		next(w, r)
+	}
+}
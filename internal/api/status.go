@@ -0,0 +1,115 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TipStatus is the health of the node's tip as seen by the network server
+type TipStatus struct {
+	LastTipChange   int64    `json:"last_tip_change"`            // Unix time a block was last received or mined
+	TipAge          int64    `json:"tip_age_seconds"`            // Seconds since then
+	StaleAfter      int64    `json:"stale_after_seconds"`        // Tip age after which it is possibly stale
+	StaleTip        bool     `json:"stale_tip"`                  // No new block for stale_after_seconds
+	Rediscoveries   int      `json:"rediscoveries"`              // Peer re-discoveries run while the tip was stale
+	LastRediscovery int64    `json:"last_rediscovery,omitempty"` // Unix time of the last one
+	Peers           int      `json:"peers"`                      // Peers that sent us their version
+	KnownPeers      int      `json:"known_peers"`
+	Outbound        int      `json:"outbound"`
+	Inbound         int      `json:"inbound"`
+	Address         string   `json:"address"`                // Address advertised to peers
+	PortMapping     string   `json:"port_mapping,omitempty"` // Gateway protocol forwarding the P2P port (upnp, natpmp)
+	MempoolTxs      int      `json:"mempool_txs"`
+	Warnings        []string `json:"warnings,omitempty"`
+}
+
+type StatusResponse struct {
+	Height int       `json:"height"`
+	Tip    string    `json:"tip"`
+	Status string    `json:"status"` // "ok" or "warning"
+	Node   TipStatus `json:"node"`
+}
+
+// StatusProvider exposes the tip health of the network server
+type StatusProvider interface {
+	TipStatus() TipStatus
+}
+
+// nodeStatus collects the height, tip and tip health of the node
+func (s *Server) nodeStatus() (StatusResponse, bool) {
+	provider, ok := s.NetworkServer.(StatusProvider)
+	if !ok {
+		return StatusResponse{}, false
+	}
+
+	s.Blockchain.RLockState()
+	response := StatusResponse{
+		Height: s.Blockchain.GetBestHeight(),
+		Tip:    fmt.Sprintf("%x", s.Blockchain.LastHash),
+		Status: "ok",
+		Node:   provider.TipStatus(),
+	}
+	s.Blockchain.RUnlockState()
+
+	if len(response.Node.Warnings) > 0 {
+		response.Status = "warning"
+	}
+
+	return response, true
+}
+
+// handleStatus returns the tip health of the node, warning about a possibly stale tip
+// GET /api/status
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response, ok := s.nodeStatus()
+	if !ok {
+		s.sendError(w, "Node status is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	s.sendJSON(w, response, http.StatusOK)
+}
+
+// handleMetrics serves the node status in the Prometheus text format
+// GET /metrics
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status, ok := s.nodeStatus()
+	if !ok {
+		s.sendError(w, "Node status is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	stale := 0
+	if status.Node.StaleTip {
+		stale = 1
+	}
+
+	var b strings.Builder
+	metric := func(name, kind, help string, value int64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, kind, name, value)
+	}
+	metric("blockchain_height", "gauge", "Height of the best chain.", int64(status.Height))
+	metric("blockchain_tip_age_seconds", "gauge", "Seconds since a block was last received or mined.", status.Node.TipAge)
+	metric("blockchain_stale_tip", "gauge", "1 when no block was received or mined for the stale tip threshold.", int64(stale))
+	metric("blockchain_peer_rediscoveries_total", "counter", "Peer re-discoveries run while the tip was stale.", int64(status.Node.Rediscoveries))
+	metric("blockchain_peers", "gauge", "Peers that sent their version.", int64(status.Node.Peers))
+	metric("blockchain_known_peers", "gauge", "Known peer addresses.", int64(status.Node.KnownPeers))
+	metric("blockchain_outbound_peers", "gauge", "Outbound peers.", int64(status.Node.Outbound))
+	metric("blockchain_inbound_peers", "gauge", "Inbound peers.", int64(status.Node.Inbound))
+	metric("blockchain_mempool_transactions", "gauge", "Transactions in the mempool.", int64(status.Node.MempoolTxs))
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, b.String())
+}
@@ -0,0 +1,297 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+type TxInputResponse struct {
+	TxID     string `json:"txid"`
+	Out      int    `json:"out"`
+	Value    int    `json:"value"`   // Value of the spent output
+	Address  string `json:"address"` // Address that owned the spent output
+	Sequence uint32 `json:"sequence,omitempty"`
+}
+
+type TxOutputResponse struct {
+	Value   int    `json:"value"`
+	Address string `json:"address,omitempty"`
+	Data    string `json:"data,omitempty"` // Hex data of a data-carrier output (no address)
+}
+
+type TransactionResponse struct {
+	TxID        string             `json:"txid"`
+	Coinbase    bool               `json:"coinbase"`
+	CoinbaseMsg string             `json:"coinbase_message,omitempty"` // Embedded by the miner
+	Replaceable bool               `json:"replaceable,omitempty"`      // Signals opt-in replacement
+	Size        int                `json:"size"`
+	Fee         int                `json:"fee"`
+	FeeRate     float64            `json:"fee_rate"` // Fee per byte
+	Inputs      []TxInputResponse  `json:"inputs"`
+	Outputs     []TxOutputResponse `json:"outputs"`
+}
+
+// newTransactionResponse builds the API representation of a transaction
+func (s *Server) newTransactionResponse(tx *blockchain.Transaction) TransactionResponse {
+	return s.transactionResponse(context.Background(), tx)
+}
+
+// transactionResponse is newTransactionResponse, leaving the fee and spent
+// outputs unresolved once ctx is done
+func (s *Server) transactionResponse(ctx context.Context, tx *blockchain.Transaction) TransactionResponse {
+	response := TransactionResponse{
+		TxID:        fmt.Sprintf("%x", tx.ID),
+		Coinbase:    tx.IsCoinbase(),
+		CoinbaseMsg: tx.CoinbaseMessage(),
+		Replaceable: tx.SignalsReplacement(),
+		Size:        tx.Size(),
+		Inputs:      []TxInputResponse{},
+		Outputs:     []TxOutputResponse{},
+	}
+
+	if !tx.IsCoinbase() {
+		// Resolve spent outputs so clients see where the funds came from
+		prevTXs, err := s.Blockchain.PrevTransactionsContext(ctx, tx)
+		if err == nil {
+			response.Fee = tx.Fee(prevTXs)
+			response.FeeRate = float64(response.Fee) / float64(response.Size)
+		}
+
+		for _, in := range tx.Inputs {
+			input := TxInputResponse{
+				TxID:     fmt.Sprintf("%x", in.ID),
+				Out:      in.Out,
+				Sequence: in.Sequence,
+			}
+
+			prevTX, ok := prevTXs[hex.EncodeToString(in.ID)]
+			if ok && in.Out >= 0 && in.Out < len(prevTX.Outputs) {
+				prevOut := prevTX.Outputs[in.Out]
+				input.Value = prevOut.Value
+				input.Address = fmt.Sprintf("%s", blockchain.PubKeyHashToAddress(prevOut.PubKeyHash))
+			}
+
+			response.Inputs = append(response.Inputs, input)
+		}
+	}
+
+	for _, out := range tx.Outputs {
+		if out.IsDataCarrier() {
+			response.Outputs = append(response.Outputs, TxOutputResponse{
+				Value: out.Value,
+				Data:  hex.EncodeToString(out.Data()),
+			})
+			continue
+		}
+
+		response.Outputs = append(response.Outputs, TxOutputResponse{
+			Value:   out.Value,
+			Address: fmt.Sprintf("%s", blockchain.PubKeyHashToAddress(out.PubKeyHash)),
+		})
+	}
+
+	return response
+}
+
+// blockTransactions builds the API representation of a block's transactions
+// and returns the total fees they pay
+// Resolving spent outputs walks the chain, so it stops with ctx.Err() once ctx is done
+func (s *Server) blockTransactions(ctx context.Context, block *blockchain.Block) ([]TransactionResponse, int, error) {
+	txs := make([]TransactionResponse, 0, len(block.Transactions))
+	totalFees := 0
+
+	for _, tx := range block.Transactions {
+		response := s.transactionResponse(ctx, tx)
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		totalFees += response.Fee
+		txs = append(txs, response)
+	}
+
+	return txs, totalFees, nil
+}
+
+type ChainTxResponse struct {
+	InMempool     bool                `json:"in_mempool"`           // Pending: no block, 0 confirmations
+	BlockHash     string              `json:"block_hash,omitempty"` // Omitted while pending
+	Height        int                 `json:"height"`
+	Offset        int                 `json:"offset"`    // Position in the block's transactions
+	Timestamp     int64               `json:"timestamp"` // Of the block, or when it entered the mempool
+	Confirmations int                 `json:"confirmations"`
+	Transaction   TransactionResponse `json:"transaction"`
+}
+
+// handleGetTransaction returns a main chain transaction and the block holding
+// it, or a transaction still in the mempool
+// GET /api/tx/:txid
+func (s *Server) handleGetTransaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	txID, err := hex.DecodeString(strings.TrimPrefix(r.URL.Path, "/api/tx/"))
+	if err != nil || len(txID) == 0 {
+		s.sendError(w, "Invalid transaction ID format", http.StatusBadRequest)
+		return
+	}
+
+	tx, location, err := s.Blockchain.FindTransactionLocation(txID)
+	if errors.Is(err, blockchain.ErrTxNotFound) {
+		s.sendPendingTransaction(w, hex.EncodeToString(txID))
+		return
+	}
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	block, err := s.Blockchain.GetBlock(location.BlockHash)
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := ChainTxResponse{
+		BlockHash:     fmt.Sprintf("%x", location.BlockHash),
+		Height:        location.Height,
+		Offset:        location.Offset,
+		Timestamp:     block.Timestamp,
+		Confirmations: s.Blockchain.GetBestHeight() - location.Height + 1,
+		Transaction:   s.transactionResponse(r.Context(), &tx),
+	}
+	if requestAbandoned(r, r.Context().Err()) {
+		return
+	}
+
+	s.sendJSON(w, response, http.StatusOK)
+}
+
+// sendPendingTransaction answers a transaction lookup from the mempool
+func (s *Server) sendPendingTransaction(w http.ResponseWriter, txID string) {
+	inspector, _ := s.NetworkServer.(MempoolInspector)
+	lister, _ := s.NetworkServer.(MempoolLister)
+	if inspector == nil || lister == nil {
+		s.sendError(w, "Transaction not found in the chain", http.StatusNotFound)
+		return
+	}
+
+	tx, found := inspector.MempoolTransaction(txID)
+	if !found {
+		s.sendError(w, "Transaction not found in the chain nor the mempool", http.StatusNotFound)
+		return
+	}
+
+	response := ChainTxResponse{InMempool: true, Transaction: s.newTransactionResponse(tx)}
+	for _, entry := range lister.MempoolEntries() {
+		if entry.TxID == txID {
+			response.Timestamp = entry.Time
+			break
+		}
+	}
+
+	s.sendJSON(w, response, http.StatusOK)
+}
+
+type RawTransactionRequest struct {
+	Hex    string `json:"hex"`              // Hex encoded serialized transaction
+	Base64 string `json:"base64,omitempty"` // The same, base64 encoded, instead of hex
+}
+
+// empty reports whether the request carries no transaction
+func (req RawTransactionRequest) empty() bool {
+	return req.Hex == "" && req.Base64 == ""
+}
+
+// transaction decodes the transaction of the request
+func (req RawTransactionRequest) transaction() (*blockchain.Transaction, error) {
+	if req.Hex != "" {
+		return decodeRawTransaction(req.Hex)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(req.Base64))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %v", err)
+	}
+	return decodeRawTransaction(hex.EncodeToString(data))
+}
+
+type TestAcceptResponse struct {
+	TxID         string `json:"txid,omitempty"`
+	Allowed      bool   `json:"allowed"`
+	Size         int    `json:"size,omitempty"`
+	Fee          int    `json:"fee"`
+	RejectCode   string `json:"reject_code,omitempty"`
+	RejectReason string `json:"reject_reason,omitempty"`
+}
+
+// MempoolTester runs the mempool acceptance pipeline without side effects
+type MempoolTester interface {
+	CheckMempoolAcceptance(tx *blockchain.Transaction) (int, error)
+}
+
+// decodeRawTransaction decodes a hex encoded serialized transaction
+func decodeRawTransaction(rawHex string) (*blockchain.Transaction, error) {
+	return blockchain.DecodeTransactionHex(rawHex)
+}
+
+// handleTestAccept checks whether a raw transaction would be accepted into the mempool
+// POST /api/tx/testaccept
+func (s *Server) handleTestAccept(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RawTransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.empty() {
+		s.sendError(w, "Invalid request body, expected {\"hex\": \"...\"} or {\"base64\": \"...\"}", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := req.transaction()
+	if err != nil {
+		s.sendJSON(w, TestAcceptResponse{
+			Allowed:      false,
+			RejectCode:   blockchain.RejectMalformed,
+			RejectReason: err.Error(),
+		}, http.StatusOK)
+		return
+	}
+
+	tester, ok := s.NetworkServer.(MempoolTester)
+	if !ok {
+		s.sendError(w, "Mempool is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	response := TestAcceptResponse{
+		TxID: fmt.Sprintf("%x", tx.ID),
+		Size: tx.Size(),
+	}
+
+	fee, err := tester.CheckMempoolAcceptance(tx)
+	if err != nil {
+		response.RejectCode = blockchain.RejectMalformed
+		if rejectErr, ok := err.(*blockchain.TxRejectError); ok {
+			response.RejectCode = rejectErr.Code
+			response.RejectReason = rejectErr.Reason
+		} else {
+			response.RejectReason = err.Error()
+		}
+	} else {
+		response.Allowed = true
+		response.Fee = fee
+	}
+
+	s.sendJSON(w, response, http.StatusOK)
+}
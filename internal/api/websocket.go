@@ -0,0 +1,239 @@
+package api
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocket protocol (RFC 6455), the server side: the opening handshake,
+// unfragmented frames from the node, and frames from clients, which are
+// masked and may be fragmented. Extensions and subprotocols are not offered.
+
+const (
+	wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11" // Mixed into Sec-WebSocket-Accept
+
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+
+	wsCloseNormal      = 1000
+	wsCloseProtocol    = 1002
+	wsCloseUnsupported = 1003
+	wsCloseTooBig      = 1009
+
+	maxWSMessageSize = 64 << 10 // Bytes of a client message
+	wsWriteTimeout   = 10 * time.Second
+)
+
+// errWSClosed is returned once the client closed the connection
+var errWSClosed = errors.New("websocket closed")
+
+// wsProtocolError is a client frame breaking the protocol, closing the
+// connection with code
+type wsProtocolError struct {
+	code   int
+	reason string
+}
+
+func (e *wsProtocolError) Error() string {
+	return e.reason
+}
+
+// wsConn is the server end of a WebSocket connection; writes may come from
+// several goroutines, reads from one only
+type wsConn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	writeMu sync.Mutex
+}
+
+// checkWebSocketUpgrade validates an opening handshake and returns its key
+func checkWebSocketUpgrade(r *http.Request) (string, error) {
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return "", fmt.Errorf("expected a WebSocket upgrade request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return "", fmt.Errorf("unsupported WebSocket version, expected 13")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return "", fmt.Errorf("invalid Sec-WebSocket-Key")
+	}
+	return key, nil
+}
+
+// headerHasToken reports whether a comma separated header lists token
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgradeWebSocket takes over the connection of a validated handshake and
+// accepts it
+func upgradeWebSocket(w http.ResponseWriter, key string) (*wsConn, error) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, fmt.Errorf("connection cannot be upgraded")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha1.Sum([]byte(key + wsGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(hash[:]))
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &wsConn{conn: conn, r: rw.Reader}, nil
+}
+
+// readMessage returns the next text or binary message of the client,
+// answering its pings on the way; errWSClosed once the client closed
+func (c *wsConn) readMessage() (byte, []byte, error) {
+	var opcode byte
+	var message []byte
+
+	for {
+		fin, op, data, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, data); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			c.close(wsCloseNormal)
+			return 0, nil, errWSClosed
+		case wsOpContinuation:
+			if opcode == 0 {
+				return 0, nil, &wsProtocolError{wsCloseProtocol, "continuation frame without a message"}
+			}
+		case wsOpText, wsOpBinary:
+			if opcode != 0 {
+				return 0, nil, &wsProtocolError{wsCloseProtocol, "new message inside a fragmented one"}
+			}
+			opcode = op
+		default:
+			return 0, nil, &wsProtocolError{wsCloseProtocol, fmt.Sprintf("unknown opcode %d", op)}
+		}
+
+		if len(message)+len(data) > maxWSMessageSize {
+			return 0, nil, &wsProtocolError{wsCloseTooBig, fmt.Sprintf("message over %d bytes", maxWSMessageSize)}
+		}
+		message = append(message, data...)
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+// readFrame reads and unmasks a client frame
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0f
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, &wsProtocolError{wsCloseProtocol, "reserved bits set"}
+	}
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, &wsProtocolError{wsCloseProtocol, "unmasked client frame"}
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if opcode >= wsOpClose && (length > 125 || !fin) {
+		return false, 0, nil, &wsProtocolError{wsCloseProtocol, "invalid control frame"}
+	}
+	if length > maxWSMessageSize {
+		return false, 0, nil, &wsProtocolError{wsCloseTooBig, fmt.Sprintf("message over %d bytes", maxWSMessageSize)}
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.r, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// writeFrame sends a whole message in one unmasked frame
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	frame = append(frame, payload...)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// close sends a close frame with code and closes the connection
+func (c *wsConn) close(code int) {
+	c.writeFrame(wsOpClose, binary.BigEndian.AppendUint16(nil, uint16(code)))
+	c.conn.Close()
+}
@@ -0,0 +1,279 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Address history index
+//
+// The optional address index records, for every address a main chain
+// transaction pays or spends from, what the transaction received and sent:
+// "addr-" + pubKeyHash + height + txid. Like the transaction index it is
+// updated with the tip; the index tip key records the block it reflects, so
+// a node that ran without the index rebuilds it once when enabling it again.
+// Entries survive pruning: the history of pruned blocks remains available.
+
+var (
+	// addrIndexPrefix keys the address index, by pubKeyHash, height and txid
+	addrIndexPrefix = []byte("addr-")
+
+	// addrIndexTipKey stores the hash of the block the address index reflects
+	addrIndexTipKey = []byte("addrindextip")
+)
+
+// AddressTx is what a main chain transaction did to an address
+type AddressTx struct {
+	TxID     []byte
+	Height   int
+	Received int // Value of the outputs paying the address
+	Sent     int // Value of the address outputs the transaction spends
+}
+
+// Net returns the change of the address balance, negative when it paid out
+func (a AddressTx) Net() int {
+	return a.Received - a.Sent
+}
+
+func addrIndexKey(pubKeyHash []byte, height int, txID []byte) []byte {
+	key := append(append([]byte{}, addrIndexPrefix...), byte(len(pubKeyHash)))
+	key = append(key, pubKeyHash...)
+	key = binary.BigEndian.AppendUint32(key, uint32(height))
+	return append(key, txID...)
+}
+
+// addrIndexPrefixOf is the key prefix of the history of an address
+func addrIndexPrefixOf(pubKeyHash []byte) []byte {
+	return append(append(append([]byte{}, addrIndexPrefix...), byte(len(pubKeyHash))), pubKeyHash...)
+}
+
+// blockAddressTxs returns what each transaction of a block did to each
+// address, keyed by index key; spent holds the outputs spent by its inputs,
+// in input order (see blockUndo)
+func blockAddressTxs(block *Block, spent []spentOutput) (map[string]AddressTx, error) {
+	entries := make(map[string]AddressTx)
+	add := func(pubKeyHash []byte, tx *Transaction, received, sent int) {
+		key := string(addrIndexKey(pubKeyHash, block.Height, tx.ID))
+		entry, ok := entries[key]
+		if !ok {
+			entry = AddressTx{TxID: tx.ID, Height: block.Height}
+		}
+		entry.Received += received
+		entry.Sent += sent
+		entries[key] = entry
+	}
+
+	for _, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			for range tx.Inputs {
+				if len(spent) == 0 {
+					return nil, fmt.Errorf("missing spent outputs of block %d", block.Height)
+				}
+				add(spent[0].Output.PubKeyHash, tx, 0, spent[0].Output.Value)
+				spent = spent[1:]
+			}
+		}
+		for _, out := range tx.Outputs {
+			if !out.IsDataCarrier() {
+				add(out.PubKeyHash, tx, out.Value, 0)
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+// indexAddresses adds the address history of a block becoming the tip to batch
+// spent may be nil, the spent outputs are then looked up (see blockUndo)
+func (chain *Blockchain) indexAddresses(batch *leveldb.Batch, block *Block, spent []spentOutput) error {
+	if !chain.AddrIndex {
+		return nil
+	}
+
+	entries, err := chain.addressTxs(block, spent)
+	if err != nil {
+		return err
+	}
+	for key, entry := range entries {
+		batch.Put([]byte(key), encodeAddressTx(entry))
+	}
+	batch.Put(addrIndexTipKey, block.Hash)
+	return nil
+}
+
+// unindexAddresses removes the address history of the tip being disconnected in batch
+func (chain *Blockchain) unindexAddresses(batch *leveldb.Batch, block *Block, spent []spentOutput) error {
+	if !chain.AddrIndex {
+		return nil
+	}
+
+	entries, err := chain.addressTxs(block, spent)
+	if err != nil {
+		return err
+	}
+	for key := range entries {
+		batch.Delete([]byte(key))
+	}
+	batch.Put(addrIndexTipKey, block.PrevHash)
+	return nil
+}
+
+func (chain *Blockchain) addressTxs(block *Block, spent []spentOutput) (map[string]AddressTx, error) {
+	if spent == nil {
+		var err error
+		if spent, err = chain.blockUndo(block); err != nil {
+			return nil, err
+		}
+	}
+	return blockAddressTxs(block, spent)
+}
+
+func encodeAddressTx(entry AddressTx) []byte {
+	value := binary.AppendUvarint(nil, uint64(entry.Received))
+	return binary.AppendUvarint(value, uint64(entry.Sent))
+}
+
+// decodeAddressTx reads an index entry, the transaction and height come from its key
+func decodeAddressTx(key, value []byte) (AddressTx, error) {
+	if len(key) < len(addrIndexPrefix)+1 {
+		return AddressTx{}, fmt.Errorf("corrupt address index key %x", key)
+	}
+	rest := key[len(addrIndexPrefix)+1+int(key[len(addrIndexPrefix)]):]
+	if len(rest) <= 4 {
+		return AddressTx{}, fmt.Errorf("corrupt address index key %x", key)
+	}
+
+	received, n := binary.Uvarint(value)
+	sent, m := binary.Uvarint(value[max(n, 0):])
+	if n <= 0 || m <= 0 {
+		return AddressTx{}, fmt.Errorf("corrupt address index entry %x", key)
+	}
+
+	return AddressTx{
+		TxID:     append([]byte{}, rest[4:]...),
+		Height:   int(binary.BigEndian.Uint32(rest[:4])),
+		Received: int(received),
+		Sent:     int(sent),
+	}, nil
+}
+
+// EnableAddrIndex maintains the address index from now on, building it
+// first when it does not reflect the current tip (the node ran without it)
+// Building needs the full blocks, a pruned chain keeps an index only when it
+// was enabled before pruning
+func (chain *Blockchain) EnableAddrIndex() error {
+	chain.state.Lock()
+	defer chain.state.Unlock()
+
+	if tip, err := chain.Database.Get(addrIndexTipKey, nil); err == nil && bytes.Equal(tip, chain.LastHash) {
+		chain.AddrIndex = true
+		return nil
+	}
+	if pruned := chain.PrunedHeight(); pruned >= 0 {
+		return fmt.Errorf("%w: the address index cannot be built, blocks up to height %d are pruned (enable it before pruning)", ErrPruned, pruned)
+	}
+
+	if err := deleteByPrefix(chain.Database, addrIndexPrefix); err != nil {
+		return err
+	}
+
+	hashes := chain.GetBlockHashes()
+	log.Printf("📇 Building the address index of %d blocks", len(hashes))
+
+	chain.AddrIndex = true
+	batch := new(leveldb.Batch)
+	for i := len(hashes) - 1; i >= 0; i-- {
+		block, err := chain.GetBlock(hashes[i])
+		if err != nil {
+			chain.AddrIndex = false
+			return err
+		}
+		if err := chain.indexAddresses(batch, &block, nil); err != nil {
+			chain.AddrIndex = false
+			return err
+		}
+		if batch.Len() >= 10000 || i == 0 {
+			if err := chain.Database.Write(batch, nil); err != nil {
+				chain.AddrIndex = false
+				return err
+			}
+			batch.Reset()
+		}
+	}
+
+	return nil
+}
+
+// AddressHistory returns what the main chain transactions did to an address,
+// newest first
+// Without the address index every block is scanned, stopping with ctx.Err()
+// once ctx is done; a pruned chain can only answer from the index
+func (chain *Blockchain) AddressHistory(ctx context.Context, pubKeyHash []byte) ([]AddressTx, error) {
+	if chain.AddrIndex {
+		return chain.indexedAddressHistory(pubKeyHash)
+	}
+	if pruned := chain.PrunedHeight(); pruned >= 0 {
+		return nil, fmt.Errorf("%w: blocks up to height %d are pruned and the address index is disabled", ErrPruned, pruned)
+	}
+
+	var history []AddressTx
+	for _, hash := range chain.GetBlockHashes() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		block, err := chain.GetBlock(hash)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := chain.addressTxs(&block, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		// Newest first, transactions of a block by descending ID like the index
+		prefix := addrIndexPrefixOf(pubKeyHash)
+		var found []AddressTx
+		for key, entry := range entries {
+			if bytes.HasPrefix([]byte(key), prefix) {
+				found = append(found, entry)
+			}
+		}
+		sort.Slice(found, func(i, j int) bool {
+			return bytes.Compare(found[i].TxID, found[j].TxID) > 0
+		})
+		history = append(history, found...)
+	}
+
+	return history, nil
+}
+
+func (chain *Blockchain) indexedAddressHistory(pubKeyHash []byte) ([]AddressTx, error) {
+	iter := chain.Database.NewIterator(util.BytesPrefix(addrIndexPrefixOf(pubKeyHash)), nil)
+	defer iter.Release()
+
+	var history []AddressTx
+	for iter.Next() {
+		entry, err := decodeAddressTx(iter.Key(), iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, entry)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	// Keys sort oldest first
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+	return history, nil
+}
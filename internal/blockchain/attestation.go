@@ -0,0 +1,133 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Attestation is a signed statement of a node's view of the chain
+// Third parties can compare attestations from independent nodes at the
+// same height to detect divergence
+type Attestation struct {
+	Network        string `json:"network"`
+	Height         int    `json:"height"`
+	TipHash        string `json:"tip_hash"`
+	UTXOCommitment string `json:"utxo_commitment"`
+	Supply         int    `json:"supply"`
+	Timestamp      int64  `json:"timestamp"`
+	NodePubKey     string `json:"node_pubkey"`
+	Signature      string `json:"signature"`
+}
+
+// getNodeKeyFile returns the path of the node identity key (next to the block database)
+func getNodeKeyFile() string {
+	return filepath.Join(DataDir(), "nodekey.dat")
+}
+
+// LoadNodeIdentity loads the node identity key, creating it on first use
+// The identity key only signs attestations, it never holds funds
+func LoadNodeIdentity() (*Wallet, error) {
+	keyFile := getNodeKeyFile()
+
+	if data, err := ioutil.ReadFile(keyFile); err == nil {
+		var identity Wallet
+		if err := identity.UnmarshalBinary(data); err != nil {
+			return nil, fmt.Errorf("corrupted node key %s: %v", keyFile, err)
+		}
+		return &identity, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	identity := NewWallet()
+	data, err := identity.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0755); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(keyFile, data, 0600); err != nil {
+		return nil, err
+	}
+
+	log.Printf("🪪 Created node identity key: %s", keyFile)
+	return identity, nil
+}
+
+// NewAttestation builds and signs an attestation of the current chain state
+func NewAttestation(chain *Blockchain, identity *Wallet) (*Attestation, error) {
+	lastBlock := chain.GetLastBlock()
+	commitment, supply := UTXOSet{chain}.Commitment()
+
+	attestation := &Attestation{
+		Network:        GetNetwork(),
+		Height:         lastBlock.Height,
+		TipHash:        hex.EncodeToString(lastBlock.Hash),
+		UTXOCommitment: hex.EncodeToString(commitment),
+		Supply:         supply,
+		Timestamp:      time.Now().UTC().Unix(),
+		NodePubKey:     hex.EncodeToString(padKey(identity.PrivateKey.PublicKey)),
+	}
+
+	r, s, err := ecdsa.Sign(rand.Reader, &identity.PrivateKey, attestation.Digest())
+	if err != nil {
+		return nil, err
+	}
+	attestation.Signature = hex.EncodeToString(append(padInt(r), padInt(s)...))
+
+	return attestation, nil
+}
+
+// Digest returns the hash covered by the attestation signature
+func (a *Attestation) Digest() []byte {
+	message := fmt.Sprintf("%s|%d|%s|%s|%d|%d|%s",
+		a.Network, a.Height, a.TipHash, a.UTXOCommitment, a.Supply, a.Timestamp, a.NodePubKey)
+	digest := sha256.Sum256([]byte(message))
+	return digest[:]
+}
+
+// Verify checks the attestation signature against the embedded node public key
+func (a *Attestation) Verify() bool {
+	pubKey, err := hex.DecodeString(a.NodePubKey)
+	if err != nil || len(pubKey) != 64 {
+		return false
+	}
+
+	signature, err := hex.DecodeString(a.Signature)
+	if err != nil || len(signature) != 64 {
+		return false
+	}
+
+	key := ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(pubKey[:32]),
+		Y:     new(big.Int).SetBytes(pubKey[32:]),
+	}
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+
+	return ecdsa.Verify(&key, a.Digest(), r, s)
+}
+
+// padKey encodes a P-256 public key as fixed-length X||Y
+func padKey(key ecdsa.PublicKey) []byte {
+	return append(padInt(key.X), padInt(key.Y)...)
+}
+
+// padInt encodes a big integer as 32 big-endian bytes
+func padInt(n *big.Int) []byte {
+	buf := make([]byte, 32)
+	return n.FillBytes(buf)
+}
@@ -0,0 +1,209 @@
+package blockchain
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Database backups
+//
+// A backup is a gzip compressed gob stream: a BackupHeader followed by every
+// key/value pair of the database, read from a LevelDB snapshot so a running
+// node can be backed up. Blocks are connected with their tip, UTXO set
+// changes and index entries in one batch, so any snapshot is a consistent
+// state. Unlike a bootstrap file (see ExportSnapshot), a backup restores the
+// data directory as it was, side chain blocks, indexes and pruned blocks
+// included, without checking the blocks again.
+
+// backupFormat is the version of the backup file format
+const backupFormat = 1
+
+// BackupHeader starts a backup file
+type BackupHeader struct {
+	Format  int
+	Network string
+	Schema  int // Database schema version, older ones are migrated when opened
+	Tip     []byte
+	Height  int
+	Created int64 // Unix seconds
+}
+
+// backupRecord is a key/value pair of the database
+type backupRecord struct {
+	Key   []byte
+	Value []byte
+}
+
+// Backup writes a consistent copy of the whole database to w
+func (chain *Blockchain) Backup(w io.Writer) (BackupHeader, error) {
+	snap, err := chain.Database.GetSnapshot()
+	if err != nil {
+		return BackupHeader{}, err
+	}
+	defer snap.Release()
+
+	tip, err := snap.Get([]byte("lh"), nil)
+	if err != nil {
+		return BackupHeader{}, fmt.Errorf("tip: %v", err)
+	}
+	data, err := snap.Get(tip, nil)
+	if err != nil {
+		return BackupHeader{}, fmt.Errorf("block %x: %v", tip, err)
+	}
+	header := BackupHeader{
+		Format:  backupFormat,
+		Network: chain.Params.Name,
+		Schema:  DBSchemaVersion,
+		Tip:     tip,
+		Height:  Deserialize(data).Height,
+		Created: time.Now().Unix(),
+	}
+
+	zw := gzip.NewWriter(w)
+	enc := gob.NewEncoder(zw)
+	if err := enc.Encode(header); err != nil {
+		return BackupHeader{}, err
+	}
+
+	iter := snap.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		if err := enc.Encode(backupRecord{Key: iter.Key(), Value: iter.Value()}); err != nil {
+			return BackupHeader{}, err
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return BackupHeader{}, err
+	}
+
+	return header, zw.Close()
+}
+
+// BackupFile is a backup being read
+type BackupFile struct {
+	Header BackupHeader
+
+	dec *gob.Decoder
+}
+
+// OpenBackup reads the header of a backup, its records are read by Verify or
+// RestoreBackup
+func OpenBackup(r io.Reader) (*BackupFile, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a backup file: %v", err)
+	}
+
+	backup := &BackupFile{dec: gob.NewDecoder(zr)}
+	if err := backup.dec.Decode(&backup.Header); err != nil {
+		return nil, fmt.Errorf("not a backup file: %v", err)
+	}
+	if backup.Header.Format != backupFormat {
+		return nil, fmt.Errorf("unsupported backup file format %d", backup.Header.Format)
+	}
+
+	return backup, nil
+}
+
+// next reads the next record, ok is false at the end of the backup
+func (b *BackupFile) next() (record backupRecord, ok bool, err error) {
+	err = b.dec.Decode(&record)
+	if errors.Is(err, io.EOF) {
+		return record, false, nil
+	}
+	return record, err == nil, err
+}
+
+// Verify reads the records of the backup to its end and returns their
+// number, checking that the file is complete
+func (b *BackupFile) Verify() (int, error) {
+	count := 0
+	for {
+		_, ok, err := b.next()
+		if err != nil {
+			return 0, fmt.Errorf("backup record %d: %v", count+1, err)
+		}
+		if !ok {
+			return count, nil
+		}
+		count++
+	}
+}
+
+// RestoreBackup creates the database of the current network from a backup
+// and returns the number of records written
+// The records are written to a temporary directory renamed once complete, so
+// a failed restore leaves no partial database behind
+func RestoreBackup(backup *BackupFile) (int, error) {
+	if DBexists() {
+		return 0, fmt.Errorf("a blockchain already exists in %s", dbPath)
+	}
+	if backup.Header.Network != Params().Name {
+		return 0, fmt.Errorf("the backup belongs to network %s, not %s", backup.Header.Network, Params().Name)
+	}
+	if backup.Header.Schema > DBSchemaVersion {
+		return 0, &DBVersionError{Found: backup.Header.Schema, Supported: DBSchemaVersion}
+	}
+
+	tmpPath := dbPath + ".restore"
+	if err := os.RemoveAll(tmpPath); err != nil {
+		return 0, err
+	}
+	count, err := restoreRecords(tmpPath, backup)
+	if err == nil {
+		err = os.RemoveAll(dbPath) // An empty directory left by a node that never created a chain
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, dbPath)
+	}
+	if err != nil {
+		os.RemoveAll(tmpPath)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func restoreRecords(path string, backup *BackupFile) (int, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	count := 0
+	batch := new(leveldb.Batch)
+	for {
+		record, ok, err := backup.next()
+		if err != nil {
+			return 0, fmt.Errorf("backup record %d: %v", count+1, err)
+		}
+		if !ok {
+			break
+		}
+
+		batch.Put(record.Key, record.Value)
+		count++
+		if batch.Len() >= 10000 {
+			if err := db.Write(batch, nil); err != nil {
+				return 0, err
+			}
+			batch.Reset()
+		}
+	}
+	if err := db.Write(batch, nil); err != nil {
+		return 0, err
+	}
+
+	if _, err := db.Get([]byte("lh"), nil); err != nil {
+		return 0, fmt.Errorf("the backup holds no chain tip: %v", err)
+	}
+	return count, nil
+}
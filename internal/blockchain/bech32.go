@@ -0,0 +1,204 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Bech32 addresses (BIP173 encoding) alongside the original Base58 ones
+//
+// A bech32 address is the network's Bech32HRP + "1" + data + checksum, where data is the
+// address version (0) followed by the 20-byte public key hash or the 32-byte
+// multisig script hash in 5-bit groups. Both formats encode the same hash, so
+// outputs locked to either format are identical and interchangeable.
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+var bech32Generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233d4, 0x2a1462b3}
+
+// bech32 address versions
+const bech32Version = 0
+
+func bech32Polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= bech32Generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	return expanded
+}
+
+func bech32Checksum(hrp string, data []byte) []byte {
+	values := append(bech32HRPExpand(hrp), data...)
+	values = append(values, 0, 0, 0, 0, 0, 0)
+	polymod := bech32Polymod(values) ^ 1
+
+	checksum := make([]byte, 6)
+	for i := range checksum {
+		checksum[i] = byte(polymod>>uint(5*(5-i))) & 31
+	}
+	return checksum
+}
+
+// Bech32Encode encodes 5-bit groups with a human-readable part
+func Bech32Encode(hrp string, data []byte) string {
+	combined := append(append([]byte{}, data...), bech32Checksum(hrp, data)...)
+
+	var encoded strings.Builder
+	encoded.WriteString(hrp)
+	encoded.WriteByte('1')
+	for _, value := range combined {
+		encoded.WriteByte(bech32Charset[value])
+	}
+	return encoded.String()
+}
+
+// Bech32Decode decodes a bech32 string into its human-readable part and 5-bit groups
+func Bech32Decode(encoded string) (string, []byte, error) {
+	if len(encoded) > 90 {
+		return "", nil, fmt.Errorf("bech32 string too long")
+	}
+	if strings.ToLower(encoded) != encoded && strings.ToUpper(encoded) != encoded {
+		return "", nil, fmt.Errorf("bech32 string has mixed case")
+	}
+	encoded = strings.ToLower(encoded)
+
+	separator := strings.LastIndexByte(encoded, '1')
+	if separator < 1 || separator+7 > len(encoded) {
+		return "", nil, fmt.Errorf("invalid bech32 separator position")
+	}
+
+	hrp := encoded[:separator]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, fmt.Errorf("invalid bech32 human-readable part")
+		}
+	}
+
+	data := make([]byte, 0, len(encoded)-separator-1)
+	for i := separator + 1; i < len(encoded); i++ {
+		value := strings.IndexByte(bech32Charset, encoded[i])
+		if value < 0 {
+			return "", nil, fmt.Errorf("invalid bech32 character %q", encoded[i])
+		}
+		data = append(data, byte(value))
+	}
+
+	if bech32Polymod(append(bech32HRPExpand(hrp), data...)) != 1 {
+		return "", nil, fmt.Errorf("invalid bech32 checksum")
+	}
+
+	return hrp, data[:len(data)-6], nil
+}
+
+// convertBits regroups bits, e.g. bytes to 5-bit groups (8, 5, true) and back (5, 8, false)
+func convertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var converted []byte
+	acc, bits := uint32(0), uint(0)
+	maxValue := uint32(1)<<toBits - 1
+
+	for _, value := range data {
+		if uint32(value)>>fromBits != 0 {
+			return nil, fmt.Errorf("invalid data range")
+		}
+		acc = acc<<fromBits | uint32(value)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			converted = append(converted, byte(acc>>bits&maxValue))
+		}
+	}
+
+	if pad {
+		if bits > 0 {
+			converted = append(converted, byte(acc<<(toBits-bits)&maxValue))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxValue != 0 {
+		return nil, fmt.Errorf("invalid padding")
+	}
+
+	return converted, nil
+}
+
+// PubKeyHashToBech32Address encodes a public key (or multisig script) hash as a bech32 address
+func PubKeyHashToBech32Address(pubKeyHash []byte) string {
+	program, _ := convertBits(pubKeyHash, 8, 5, true)
+	return Bech32Encode(Params().Bech32HRP, append([]byte{bech32Version}, program...))
+}
+
+// isBech32Address reports whether an address uses the bech32 format (by its prefix)
+func isBech32Address(address string) bool {
+	return strings.HasPrefix(strings.ToLower(address), Params().Bech32HRP+"1")
+}
+
+// AddressToPubKeyHash returns the hash an address locks to, for both
+// Base58 and bech32 addresses
+func AddressToPubKeyHash(address string) ([]byte, error) {
+	if isBech32Address(address) {
+		hrp, data, err := Bech32Decode(address)
+		if err != nil {
+			return nil, err
+		}
+		if hrp != Params().Bech32HRP || len(data) == 0 || data[0] != bech32Version {
+			return nil, fmt.Errorf("unsupported bech32 address %s", address)
+		}
+
+		pubKeyHash, err := convertBits(data[1:], 5, 8, false)
+		if err != nil {
+			return nil, err
+		}
+		if len(pubKeyHash) != 20 && len(pubKeyHash) != multisigHashLength {
+			return nil, fmt.Errorf("invalid bech32 address length %d", len(pubKeyHash))
+		}
+		return pubKeyHash, nil
+	}
+
+	decoded := Base58Decode([]byte(address))
+	if len(decoded) <= 1+checksumLength {
+		return nil, fmt.Errorf("address %q is too short", address)
+	}
+
+	payload := decoded[:len(decoded)-checksumLength]
+	if !bytes.Equal(decoded[len(decoded)-checksumLength:], Checksum(payload)) {
+		return nil, fmt.Errorf("invalid address checksum")
+	}
+
+	return payload[1:], nil
+}
+
+// ToBech32Address converts an address of either format to bech32
+func ToBech32Address(address string) (string, error) {
+	pubKeyHash, err := AddressToPubKeyHash(address)
+	if err != nil {
+		return "", err
+	}
+	return PubKeyHashToBech32Address(pubKeyHash), nil
+}
+
+// ToBase58Address converts an address of either format to Base58
+// Wallets are keyed by their Base58 address
+func ToBase58Address(address string) (string, error) {
+	pubKeyHash, err := AddressToPubKeyHash(address)
+	if err != nil {
+		return "", err
+	}
+	return string(PubKeyHashToAddress(pubKeyHash)), nil
+}
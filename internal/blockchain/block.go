@@ -15,6 +15,8 @@ type Block struct {
 	Height       int
 	Difficulty   int    // Mining difficulty used for this block
 	MerkleRoot   []byte // Merkle root of transactions (calculated once, stored for validation)
+	UTXORoot     []byte // Commitment to the UTXO set after this block (nil in legacy blocks)
+	Version      uint32 // Version bits (0 in legacy blocks, see versionbits.go)
 }
 
 // HashTransactions returns the hash of all transactions using Merkle Tree
@@ -35,6 +37,11 @@ func CreateBlock(txs []*Transaction, prevHash []byte, height int) *Block {
 }
 
 func CreateBlockWithInterrupt(txs []*Transaction, prevHash []byte, height int, interrupt <-chan bool) *Block {
+	return mineCandidate(newCandidateBlock(txs, prevHash, height), interrupt)
+}
+
+// newCandidateBlock builds an unmined block with its Merkle Root
+func newCandidateBlock(txs []*Transaction, prevHash []byte, height int) *Block {
 	// Use UTC timestamp to ensure consistency across different timezones
 	block := &Block{
 		Timestamp:    time.Now().UTC().Unix(),
@@ -43,13 +50,19 @@ func CreateBlockWithInterrupt(txs []*Transaction, prevHash []byte, height int, i
 		PrevHash:     prevHash,
 		Nonce:        0,
 		Height:       height,
-		Difficulty:   Difficulty,
+		Difficulty:   Params().Difficulty,
 		MerkleRoot:   []byte{}, // Will be calculated by HashTransactions
 	}
 
 	// Calculate and store Merkle Root ONCE
 	block.MerkleRoot = block.HashTransactions()
 
+	return block
+}
+
+// mineCandidate runs the proof of work on a candidate block
+// Returns nil if mining was interrupted
+func mineCandidate(block *Block, interrupt <-chan bool) *Block {
 	pow := NewProof(block)
 	nonce, hash := pow.RunWithInterrupt(interrupt)
 
@@ -92,10 +105,9 @@ func CreateBlockWithDifficulty(txs []*Transaction, prevHash []byte, height int,
 	return block
 }
 
-// Genesis creates the genesis block with a coinbase transaction
-// Uses lower difficulty (GenesisDifficulty) for faster initialization
-func Genesis(coinbase *Transaction) *Block {
-	return CreateBlockWithDifficulty([]*Transaction{coinbase}, []byte{}, 0, GenesisDifficulty)
+// Size returns the serialized size of the block in bytes
+func (b *Block) Size() int {
+	return len(b.Serialize())
 }
 
 func (b *Block) Serialize() []byte {
@@ -116,3 +128,16 @@ func Deserialize(data []byte) *Block {
 
 	return &block
 }
+
+// DecodeBlock deserializes a block received from an untrusted source
+// Unlike Deserialize it returns an error instead of panicking
+func DecodeBlock(data []byte) (*Block, error) {
+	var block Block
+
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&block); err != nil {
+		return nil, err
+	}
+
+	return &block, nil
+}
@@ -2,13 +2,14 @@ package blockchain
 
 import (
 	"bytes"
-	"crypto/ecdsa"
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
 	"os"
 	"runtime"
+	"sync"
 
 	"github.com/syndtr/goleveldb/leveldb"
 )
@@ -21,12 +22,38 @@ func getDBPath() string {
 	if path := os.Getenv("BLOCKCHAIN_DATA_DIR"); path != "" {
 		return path + "/blocks"
 	}
-	return DBPath // Use constant from config.go
+	// A private network selected by name, its rules are stored in its database
+	if name := os.Getenv("BLOCKCHAIN_NETWORK"); activeParams.Load() == nil && isPrivateNetwork(name) {
+		return networkDBPath(name)
+	}
+	if params := Params(); params.DBPath != "" {
+		return params.DBPath // Default of the network
+	}
+	return networkDBPath(Params().Name)
 }
 
+// ErrUTXOCommitment is returned for blocks whose UTXO commitment is missing or wrong
+var ErrUTXOCommitment = errors.New("invalid UTXO commitment")
+
 type Blockchain struct {
-	LastHash []byte
-	Database *leveldb.DB
+	LastHash      []byte
+	Database      *leveldb.DB
+	Params        *ChainParams // Network the chain belongs to
+	FinalityDepth int          // Rolling checkpoint depth (0 = no finality)
+
+	Frozen *FrozenOutputs // Wallet outputs FindSpendableOutputs skips (nil = none)
+
+	CoinSelector CoinSelector // Default coin selection strategy (nil = first-fit)
+
+	CoinbaseMaturity int // Blocks before the wallet spends a mining reward (0 = at once), see ImmatureCoinbases
+
+	PruneDepth int // Blocks whose full data is kept (0 = no pruning), see EnablePruning
+
+	AddrIndex bool // Maintain the address history index, see EnableAddrIndex
+
+	// state guards the chain state (tip + UTXO set) so readers never observe
+	// a half-connected block
+	state sync.RWMutex
 }
 
 // BlockchainIterator iterates over blockchain blocks
@@ -35,17 +62,18 @@ type BlockchainIterator struct {
 	Database    *leveldb.DB
 }
 
-// InitBlockchain initializes a new blockchain with genesis block
-func InitBlockchain(address string) *Blockchain {
-	var lastHash []byte
+// InitBlockchain initializes a new blockchain with the fixed genesis block of
+// the network described by params, or opens the existing one
+// params become the network of the process (see UseParams)
+func InitBlockchain(params *ChainParams) *Blockchain {
+	UseParams(params)
 
 	// Create directory if it doesn't exist
 	if err := os.MkdirAll(dbPath, os.ModePerm); err != nil {
 		Handle(err)
 	}
 
-	db, err := leveldb.OpenFile(dbPath, nil)
-	Handle(err)
+	db := openDB()
 
 	// Check if blockchain already exists
 	data, err := db.Get([]byte("lh"), nil)
@@ -53,28 +81,52 @@ func InitBlockchain(address string) *Blockchain {
 		Handle(err)
 	}
 
-	if data == nil {
-		// No existing blockchain, create genesis
-		fmt.Println("No existing blockchain found")
-		cbtx := CoinbaseTX(address, GenesisData, 0) // Genesis block is height 0
-		genesis := Genesis(cbtx)
-		fmt.Println("Genesis created")
+	if data != nil {
+		// Blockchain exists, load last hash and the network it was created for
+		useStoredChainParams(db)
+		return &Blockchain{LastHash: data, Database: db, Params: Params(), FinalityDepth: Params().DefaultFinalityDepth}
+	}
 
-		err = db.Put(genesis.Hash, genesis.Serialize(), nil)
-		Handle(err)
-		err = db.Put([]byte("lh"), genesis.Hash, nil)
-		Handle(err)
+	// No existing blockchain, create genesis
+	fmt.Println("No existing blockchain found")
+	genesis := params.GenesisBlock()
+	fmt.Printf("Genesis created (%s, %x)\n", params.Name, genesis.Hash)
 
-		lastHash = genesis.Hash
-	} else {
-		// Blockchain exists, load last hash
-		lastHash = data
-	}
+	blockchain := Blockchain{Database: db, Params: params, FinalityDepth: params.DefaultFinalityDepth}
+	batch := new(leveldb.Batch)
+	batch.Put(genesis.Hash, genesis.Serialize())
+	Handle(blockchain.applyBlock(batch, genesis))
+	Handle(storeChainParams(db, params))
 
-	blockchain := Blockchain{lastHash, db}
 	return &blockchain
 }
 
+// InitBlockchainWithGenesis creates a new database starting at a given genesis
+// block instead of mining one (e.g. the genesis of a replayed recording)
+func InitBlockchainWithGenesis(genesis *Block) (*Blockchain, error) {
+	if DBexists() {
+		return nil, fmt.Errorf("a blockchain already exists in %s", dbPath)
+	}
+	if genesis.Height != 0 || len(genesis.PrevHash) != 0 {
+		return nil, fmt.Errorf("block %x is not a genesis block", genesis.Hash)
+	}
+
+	if err := os.MkdirAll(dbPath, os.ModePerm); err != nil {
+		return nil, err
+	}
+	db := openDB()
+
+	chain := &Blockchain{Database: db, Params: Params(), FinalityDepth: Params().DefaultFinalityDepth}
+	batch := new(leveldb.Batch)
+	batch.Put(genesis.Hash, genesis.Serialize())
+	if err := chain.applyBlock(batch, genesis); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return chain, nil
+}
+
 // ContinueBlockchain continues an existing blockchain
 func ContinueBlockchain(address string) *Blockchain {
 	if DBexists() == false {
@@ -89,15 +141,15 @@ func ContinueBlockchain(address string) *Blockchain {
 		Handle(err)
 	}
 
-	db, err := leveldb.OpenFile(dbPath, nil)
-	Handle(err)
+	db := openDB()
+	useStoredChainParams(db)
 
 	// Load last hash
 	data, err := db.Get([]byte("lh"), nil)
 	Handle(err)
 	lastHash = data
 
-	blockchain := Blockchain{lastHash, db}
+	blockchain := Blockchain{LastHash: lastHash, Database: db, Params: Params(), FinalityDepth: Params().DefaultFinalityDepth}
 	return &blockchain
 }
 
@@ -128,27 +180,171 @@ func (chain *Blockchain) MineBlockWithInterrupt(transactions []*Transaction, int
 	lastBlock := Deserialize(blockData)
 	lastHeight = lastBlock.Height
 
-	// Create new block with interrupt support
-	newBlock := CreateBlockWithInterrupt(transactions, lastHash, lastHeight+1, interrupt)
+	// Commit to the UTXO set resulting from the new block
+	candidate := newCandidateBlock(transactions, lastHash, lastHeight+1)
+	chain.RLockState()
+	candidate.Version, err = chain.ComputeBlockVersion(lastHash)
+	if err == nil {
+		candidate.UTXORoot, err = UTXOSet{Blockchain: chain}.CommitmentAfter(candidate)
+	}
+	if err == nil {
+		// A clock behind the recent blocks must not produce an invalid timestamp
+		var minTime int64
+		minTime, err = chain.minBlockTime()
+		candidate.Timestamp = max(candidate.Timestamp, minTime)
+	}
+	chain.RUnlockState()
+	Handle(err)
+
+	// Mine with interrupt support
+	newBlock := mineCandidate(candidate, interrupt)
 
 	// If block is nil, mining was interrupted
 	if newBlock == nil {
 		return nil
 	}
 
-	// Save to database
-	err = chain.Database.Put(newBlock.Hash, newBlock.Serialize(), nil)
-	Handle(err)
-	err = chain.Database.Put([]byte("lh"), newBlock.Hash, nil)
-	Handle(err)
-
-	chain.LastHash = newBlock.Hash
+	// The tip may have moved while mining, making the block stale
+	if err := chain.ConnectBlock(newBlock); err != nil {
+		log.Printf("⚠️  Discarding mined block %d: %v", newBlock.Height, err)
+		return nil
+	}
 
 	return newBlock
 }
 
+// RLockState acquires a consistent read view of the chain state
+// Readers must not call RLockState again before RUnlockState
+func (chain *Blockchain) RLockState() {
+	chain.state.RLock()
+}
+
+// RUnlockState releases the read view acquired with RLockState
+func (chain *Blockchain) RUnlockState() {
+	chain.state.RUnlock()
+}
+
+// ConnectBlock stores a block as the new tip and updates the UTXO set
+// atomically with respect to readers holding the state lock
+func (chain *Blockchain) ConnectBlock(block *Block) error {
+	chain.state.Lock()
+	defer chain.state.Unlock()
+
+	if !bytes.Equal(block.PrevHash, chain.LastHash) {
+		return fmt.Errorf("block %d does not extend the current tip", block.Height)
+	}
+
+	return chain.connectTip(block)
+}
+
+// connectTip fully validates a block extending the tip (see ValidateBlock),
+// then stores it as the new tip (see applyBlock)
+// The caller must hold the state lock
+func (chain *Blockchain) connectTip(block *Block) error {
+	if err := chain.validateBlock(block); err != nil {
+		return err
+	}
+
+	for _, tx := range block.Transactions {
+		if err := chain.CheckSequenceLocks(tx, block.Height); err != nil {
+			return fmt.Errorf("block %d: transaction %x: %w", block.Height, tx.ID, err)
+		}
+	}
+
+	if err := chain.checkCoinbaseReward(block); err != nil {
+		return err
+	}
+
+	if err := chain.checkUTXOCommitment(block); err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Put(block.Hash, block.Serialize())
+	return chain.applyBlock(batch, block)
+}
+
+// applyBlock makes a block extending the tip the new tip: its UTXO set
+// changes, undo data, index entries and the tip are added to batch and
+// written atomically, then the blocks leaving the prune window are pruned
+// The caller must hold the state lock
+func (chain *Blockchain) applyBlock(batch *leveldb.Batch, block *Block) error {
+	undo, err := chain.utxoUndo(block)
+	if err != nil {
+		return err
+	}
+	delta, err := chain.blockUTXODelta(block)
+	if err != nil {
+		return err
+	}
+
+	if err := writeUTXODelta(batch, delta); err != nil {
+		return err
+	}
+	data, err := encodeUndo(undo)
+	if err != nil {
+		return err
+	}
+	batch.Put(undoKey(block.Hash), data)
+	indexBlock(batch, block)
+	if err := chain.indexAddresses(batch, block, undo); err != nil {
+		return err
+	}
+	batch.Put([]byte("lh"), block.Hash)
+
+	if err := chain.Database.Write(batch, nil); err != nil {
+		return err
+	}
+	chain.LastHash = block.Hash
+
+	return chain.pruneBlocks()
+}
+
+// checkUTXOCommitment verifies the UTXO commitment of a block extending the tip
+// Legacy blocks carry no commitment; once a block commits to the UTXO set,
+// all of its descendants must as well
+// The caller must hold the state lock
+func (chain *Blockchain) checkUTXOCommitment(block *Block) error {
+	if len(block.UTXORoot) == 0 {
+		parent, err := chain.GetBlock(block.PrevHash)
+		if err == nil && len(parent.UTXORoot) != 0 {
+			return fmt.Errorf("%w: block %d is missing its UTXO commitment", ErrUTXOCommitment, block.Height)
+		}
+		return nil
+	}
+
+	expected, err := UTXOSet{Blockchain: chain}.CommitmentAfter(block)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUTXOCommitment, err)
+	}
+	if !bytes.Equal(expected, block.UTXORoot) {
+		return fmt.Errorf("%w: block %d commits to %x, expected %x", ErrUTXOCommitment, block.Height, block.UTXORoot, expected)
+	}
+
+	return nil
+}
+
+// ReindexUTXO rebuilds the UTXO set under the state lock, to repair it:
+// connected blocks keep it up to date
+// A pruned chain no longer holds the blocks to rebuild it from (ErrPruned)
+func (chain *Blockchain) ReindexUTXO() error {
+	chain.state.Lock()
+	defer chain.state.Unlock()
+
+	if chain.PrunedHeight() >= 0 {
+		return fmt.Errorf("%w: the UTXO set cannot be rebuilt", ErrPruned)
+	}
+
+	UTXOSet := UTXOSet{Blockchain: chain}
+	UTXOSet.Reindex()
+	return nil
+}
+
 // AddBlock adds a block to the blockchain (used when receiving blocks from network)
 func (chain *Blockchain) AddBlock(block *Block) {
+	chain.state.Lock()
+	defer chain.state.Unlock()
+
 	// Check if block already exists
 	_, err := chain.Database.Get(block.Hash, nil)
 	if err == nil {
@@ -240,44 +436,73 @@ func (chain *Blockchain) GetBlockHashes() [][]byte {
 
 // FindTransaction finds a transaction by its ID
 func (chain *Blockchain) FindTransaction(ID []byte) (Transaction, error) {
-	currentHash := chain.LastHash
-
-	for {
-		data, err := chain.Database.Get(currentHash, nil)
-		if err != nil {
-			log.Printf("⚠️  Error getting block in FindTransaction: %v", err)
-			break
-		}
+	tx, _, err := chain.FindTransactionHeight(ID)
+	return tx, err
+}
 
-		block := Deserialize(data)
+// FindTransactionHeight finds a transaction and the height of the block containing it
+func (chain *Blockchain) FindTransactionHeight(ID []byte) (Transaction, int, error) {
+	return chain.FindTransactionContext(context.Background(), ID)
+}
 
-		for _, tx := range block.Transactions {
-			if bytes.Compare(tx.ID, ID) == 0 {
-				return *tx, nil
-			}
-		}
+// FindTransactionContext is FindTransactionHeight, giving up once ctx is done
+// Lookups go through the transaction index, ctx only matters for callers
+// resolving many transactions
+func (chain *Blockchain) FindTransactionContext(ctx context.Context, ID []byte) (Transaction, int, error) {
+	if err := ctx.Err(); err != nil {
+		return Transaction{}, 0, err
+	}
 
-		if len(block.PrevHash) == 0 {
-			break
-		}
+	tx, location, err := chain.FindTransactionLocation(ID)
+	if err != nil {
+		return Transaction{}, 0, err
+	}
+	return tx, location.Height, nil
+}
 
-		currentHash = block.PrevHash
+// SignTransaction signs inputs of a transaction
+func (chain *Blockchain) SignTransaction(tx *Transaction, signer Signer) error {
+	prevTXs, err := chain.PrevTransactions(tx)
+	if err != nil {
+		return err
 	}
 
-	return Transaction{}, errors.New("Transaction not found")
+	return tx.Sign(signer, prevTXs)
 }
 
-// SignTransaction signs inputs of a transaction
-func (chain *Blockchain) SignTransaction(tx *Transaction, privKey ecdsa.PrivateKey) {
+// PrevTransactions returns the transactions referenced by the inputs of tx
+func (chain *Blockchain) PrevTransactions(tx *Transaction) (map[string]Transaction, error) {
+	return chain.PrevTransactionsContext(context.Background(), tx)
+}
+
+// PrevTransactionsContext is PrevTransactions, giving up once ctx is done
+func (chain *Blockchain) PrevTransactionsContext(ctx context.Context, tx *Transaction) (map[string]Transaction, error) {
 	prevTXs := make(map[string]Transaction)
 
 	for _, in := range tx.Inputs {
-		prevTX, err := chain.FindTransaction(in.ID)
-		Handle(err)
+		prevTX, _, err := chain.FindTransactionContext(ctx, in.ID)
+		if err != nil {
+			return nil, err
+		}
 		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
 	}
 
-	tx.Sign(privKey, prevTXs)
+	return prevTXs, nil
+}
+
+// TransactionFee returns the fee paid by a transaction (inputs minus outputs)
+// Coinbase transactions pay no fee
+func (chain *Blockchain) TransactionFee(tx *Transaction) (int, error) {
+	if tx.IsCoinbase() {
+		return 0, nil
+	}
+
+	prevTXs, err := chain.PrevTransactions(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	return tx.Fee(prevTXs), nil
 }
 
 // VerifyTransaction verifies transaction inputs signatures
@@ -397,9 +622,13 @@ func (chain *Blockchain) FindAllUTXO() map[string]TXOutputs {
 						}
 					}
 				}
+				if out.IsDataCarrier() {
+					continue
+				}
 
 				outs := UTXO[txID]
 				outs.Outputs = append(outs.Outputs, out)
+				outs.Indexes = append(outs.Indexes, outIdx)
 				UTXO[txID] = outs
 			}
 
@@ -421,28 +650,78 @@ func (chain *Blockchain) FindAllUTXO() map[string]TXOutputs {
 	return UTXO
 }
 
-// FindSpendableOutputs finds and returns unspent outputs to reference in inputs
-func (chain *Blockchain) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int) {
-	unspentOuts := make(map[string][]int)
-	unspentTxs := chain.FindUnspentTransactions(pubKeyHash)
-	accumulated := 0
+// SpendableOutputs returns the unspent outputs locked to pubKeyHash that
+// coin selection may spend, in chain order (newest first)
+// Frozen outputs and immature mining rewards are excluded
+func (chain *Blockchain) SpendableOutputs(pubKeyHash []byte) []SpendableOutput {
+	var outputs []SpendableOutput
+	utxoSet := UTXOSet{Blockchain: chain}
+	seen := make(map[Outpoint]bool)
+	immature := chain.ImmatureCoinbases()
 
-Work:
-	for _, tx := range unspentTxs {
+	for _, tx := range chain.FindUnspentTransactions(pubKeyHash) {
 		txID := hex.EncodeToString(tx.ID)
+		if _, young := immature[txID]; young {
+			continue
+		}
 
 		for outIdx, out := range tx.Outputs {
-			if out.IsLockedWithKey(pubKeyHash) && accumulated < amount {
-				accumulated += out.Value
-				unspentOuts[txID] = append(unspentOuts[txID], outIdx)
-
-				if accumulated >= amount {
-					break Work
-				}
+			if !out.IsLockedWithKey(pubKeyHash) || chain.Frozen.Contains(txID, outIdx) {
+				continue
+			}
+			// A transaction is listed once per unspent output to the key, and
+			// its other outputs to the key may already be spent
+			op := Outpoint{TxID: txID, Out: outIdx}
+			if seen[op] {
+				continue
 			}
+			if _, unspent := utxoSet.FindOutput(tx.ID, outIdx); !unspent {
+				continue
+			}
+
+			seen[op] = true
+			outputs = append(outputs, SpendableOutput{Outpoint: op, Value: out.Value})
 		}
 	}
 
+	return outputs
+}
+
+// FindSpendableOutputs finds and returns unspent outputs to reference in inputs,
+// chosen by the chain coin selector
+// Frozen outputs are never selected
+func (chain *Blockchain) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int) {
+	return chain.FindSpendableOutputsWith(nil, pubKeyHash, amount)
+}
+
+// FindSpendableOutputsWith finds unspent outputs covering amount chosen by
+// selector (nil = the chain coin selector, first-fit when unset)
+// When the outputs cannot cover amount, all of them are returned
+func (chain *Blockchain) FindSpendableOutputsWith(selector CoinSelector, pubKeyHash []byte, amount int) (int, map[string][]int) {
+	unspentOuts := make(map[string][]int)
+	accumulated := 0
+	if amount <= 0 {
+		return accumulated, unspentOuts
+	}
+
+	if selector == nil {
+		selector = chain.CoinSelector
+	}
+	if selector == nil {
+		selector = FirstFitSelector{}
+	}
+
+	candidates := chain.SpendableOutputs(pubKeyHash)
+	selected := selector.Select(candidates, amount)
+	if selected == nil {
+		selected = candidates
+	}
+
+	for _, out := range selected {
+		accumulated += out.Value
+		unspentOuts[out.TxID] = append(unspentOuts[out.TxID], out.Out)
+	}
+
 	return accumulated, unspentOuts
 }
 
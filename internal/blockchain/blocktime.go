@@ -0,0 +1,70 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrBlockTooNew is returned for blocks timestamped more than
+// MaxFutureBlockTime ahead of the local clock; unlike invalid blocks they
+// may be accepted later
+var ErrBlockTooNew = errors.New("block timestamp too far in the future")
+
+// MedianTimePast returns the median timestamp of a stored block and its
+// MedianTimeBlocks-1 ancestors (fewer near genesis)
+// A block on top of it must be timestamped later than this
+func (chain *Blockchain) MedianTimePast(hash []byte) (int64, error) {
+	timestamps := make([]int64, 0, chain.Params.MedianTimeBlocks)
+	for len(hash) > 0 && len(timestamps) < chain.Params.MedianTimeBlocks {
+		block, err := chain.GetBlock(hash)
+		if err != nil {
+			return 0, fmt.Errorf("block %x: %w", hash, err)
+		}
+		timestamps = append(timestamps, block.Timestamp)
+		hash = block.PrevHash
+	}
+	if len(timestamps) == 0 {
+		return 0, fmt.Errorf("no block to compute the median time past from")
+	}
+
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps[len(timestamps)/2], nil
+}
+
+// minBlockTime returns the earliest timestamp allowed for a block on top of
+// the tip: one second past the tip's median time past
+// The caller must hold the state lock
+func (chain *Blockchain) minBlockTime() (int64, error) {
+	mtp, err := chain.MedianTimePast(chain.LastHash)
+	if err != nil {
+		return 0, err
+	}
+	return mtp + 1, nil
+}
+
+// checkFutureBlockTime refuses blocks timestamped more than MaxFutureBlockTime
+// ahead of the local clock
+func checkFutureBlockTime(block *Block) error {
+	limit := time.Now().UTC().Unix() + Params().MaxFutureBlockTime
+	if block.Timestamp > limit {
+		return fmt.Errorf("%w: block %d is timestamped %s, %ds past the limit", ErrBlockTooNew, block.Height,
+			time.Unix(block.Timestamp, 0).UTC().Format(time.RFC3339), block.Timestamp-limit)
+	}
+	return nil
+}
+
+// checkMedianTimePast refuses blocks not timestamped after the median time
+// past of the tip they extend
+// The caller must hold the state lock
+func (chain *Blockchain) checkMedianTimePast(block *Block) error {
+	minTime, err := chain.minBlockTime()
+	if err != nil {
+		return err
+	}
+	if block.Timestamp < minTime {
+		return invalidBlock(block, "timestamp %d is not after the median time past %d", block.Timestamp, minTime-1)
+	}
+	return nil
+}
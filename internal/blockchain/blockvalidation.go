@@ -0,0 +1,181 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidBlock is returned for blocks failing CheckBlockSanity or ValidateBlock
+var ErrInvalidBlock = errors.New("invalid block")
+
+// invalidBlock creates an ErrInvalidBlock error
+func invalidBlock(block *Block, format string, args ...interface{}) error {
+	return fmt.Errorf("%w: block %d: %s", ErrInvalidBlock, block.Height, fmt.Sprintf(format, args...))
+}
+
+// CheckBlockDifficulty refuses a block not mined at the difficulty the network
+// requires at its height; it must pass before the proof of work of a block
+// received from others is computed, its target only exists within the bounds
+func CheckBlockDifficulty(block *Block) error {
+	if required := Params().RequiredDifficulty(block.Height); block.Difficulty != required {
+		return invalidBlock(block, "difficulty %d, the network requires %d", block.Difficulty, required)
+	}
+	return nil
+}
+
+// CheckBlockSanity runs the context-free checks on a block: the required
+// difficulty, header hash and proof of work, a timestamp at most MaxFutureBlockTime ahead, at most
+// MaxBlockSize bytes, merkle root, exactly one coinbase (our miners append it
+// last, older blocks may carry it anywhere), the sanity of every other transaction and no output spent twice in the block
+func CheckBlockSanity(block *Block) error {
+	if err := CheckBlockDifficulty(block); err != nil {
+		return err
+	}
+
+	pow := NewProofWithDifficulty(block, block.Difficulty)
+	hash := sha256.Sum256(pow.InitData(block.Nonce))
+	if !bytes.Equal(block.Hash, hash[:]) {
+		return invalidBlock(block, "hash %x does not match the header", block.Hash)
+	}
+	if !pow.Validate() {
+		return invalidBlock(block, "proof of work does not meet difficulty %d", block.Difficulty)
+	}
+	if err := checkFutureBlockTime(block); err != nil {
+		return err
+	}
+
+	if len(block.Transactions) == 0 {
+		return invalidBlock(block, "no transactions")
+	}
+	if size, limit := block.Size(), Params().MaxBlockSize; size > limit {
+		return invalidBlock(block, "size %d exceeds the maximum block size %d", size, limit)
+	}
+	if !bytes.Equal(block.MerkleRoot, block.HashTransactions()) {
+		return invalidBlock(block, "merkle root does not match the transactions")
+	}
+
+	seen := make(map[string]bool, len(block.Transactions))
+	spent := make(map[Outpoint]string)
+	coinbases := 0
+	for _, tx := range block.Transactions {
+		txID := hex.EncodeToString(tx.ID)
+		if seen[txID] {
+			return invalidBlock(block, "transaction %s appears twice", txID)
+		}
+		seen[txID] = true
+
+		if tx.IsCoinbase() {
+			coinbases++
+			continue
+		}
+
+		if err := CheckTransactionSanity(tx); err != nil {
+			return invalidBlock(block, "transaction %s: %v", txID, err)
+		}
+		for _, in := range tx.Inputs {
+			op := Outpoint{TxID: hex.EncodeToString(in.ID), Out: in.Out}
+			if other, ok := spent[op]; ok {
+				return invalidBlock(block, "transactions %s and %s both spend %s", other, txID, op)
+			}
+			spent[op] = txID
+		}
+	}
+	if coinbases != 1 {
+		return invalidBlock(block, "%d coinbase transactions", coinbases)
+	}
+
+	return nil
+}
+
+// ValidateBlock fully validates a block extending the tip: CheckBlockSanity,
+// height and previous hash linkage, a timestamp past the median time past, every input spending an unspent output
+// (of the UTXO set or of an earlier transaction of the block) owned by its
+// key with a valid signature, and the coinbase value
+func (chain *Blockchain) ValidateBlock(block *Block) error {
+	chain.state.RLock()
+	defer chain.state.RUnlock()
+
+	return chain.validateBlock(block)
+}
+
+// validateBlock is ValidateBlock
+// The caller must hold the state lock
+func (chain *Blockchain) validateBlock(block *Block) error {
+	if err := CheckBlockSanity(block); err != nil {
+		return err
+	}
+
+	tip, err := chain.GetBlock(chain.LastHash)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(block.PrevHash, tip.Hash) {
+		return invalidBlock(block, "previous hash %x is not the tip %x", block.PrevHash, tip.Hash)
+	}
+	if block.Height != tip.Height+1 {
+		return invalidBlock(block, "height does not follow the tip height %d", tip.Height)
+	}
+	if err := chain.checkMedianTimePast(block); err != nil {
+		return err
+	}
+
+	utxoSet := UTXOSet{chain}
+	created := make(map[string]*Transaction, len(block.Transactions))
+	for _, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			if err := chain.checkBlockInputs(block, tx, utxoSet, created); err != nil {
+				return err
+			}
+		}
+		created[hex.EncodeToString(tx.ID)] = tx
+	}
+
+	return chain.checkCoinbaseReward(block)
+}
+
+// checkBlockInputs checks that every input of a block transaction spends an
+// unspent output owned by the signing key, and verifies the signatures
+// created holds the transactions before tx in the block
+func (chain *Blockchain) checkBlockInputs(block *Block, tx *Transaction, utxoSet UTXOSet, created map[string]*Transaction) error {
+	prevTXs := make(map[string]Transaction)
+
+	for i, in := range tx.Inputs {
+		id := hex.EncodeToString(in.ID)
+
+		var prevOut TXOutput
+		if prevTX, ok := created[id]; ok {
+			if in.Out < 0 || in.Out >= len(prevTX.Outputs) {
+				return invalidBlock(block, "transaction %x input %d spends unknown output %s:%d", tx.ID, i, id, in.Out)
+			}
+			prevOut = prevTX.Outputs[in.Out]
+			prevTXs[id] = *prevTX
+		} else {
+			out, ok := utxoSet.FindOutput(in.ID, in.Out)
+			if !ok {
+				return invalidBlock(block, "transaction %x input %d spends unknown or spent output %s:%d", tx.ID, i, id, in.Out)
+			}
+			prevTX, err := chain.FindTransaction(in.ID)
+			if err != nil {
+				return invalidBlock(block, "transaction %x input %d references unknown transaction %s", tx.ID, i, id)
+			}
+			prevOut = out
+			prevTXs[id] = prevTX
+		}
+
+		if prevOut.IsDataCarrier() {
+			return invalidBlock(block, "transaction %x input %d spends data-carrier output %s:%d", tx.ID, i, id, in.Out)
+		}
+		if !bytes.Equal(in.LockingHash(), prevOut.PubKeyHash) {
+			return invalidBlock(block, "transaction %x input %d public key does not own output %s:%d", tx.ID, i, id, in.Out)
+		}
+	}
+
+	if !tx.Verify(prevTXs) {
+		return invalidBlock(block, "transaction %x has invalid signatures", tx.ID)
+	}
+
+	return nil
+}
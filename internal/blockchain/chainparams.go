@@ -0,0 +1,189 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"os"
+	"sync/atomic"
+)
+
+// ChainParams defines a network: its consensus rules, genesis block and defaults
+// The built-in networks are MainNetParams, TestNetParams and RegTestParams.
+// Embedders can define a private network with their own parameters, solve its
+// genesis block with SolveGenesis and pass them to InitBlockchain.
+type ChainParams struct {
+	Name        string // Network name, recorded in attestations and P2P recordings
+	TestNetwork bool   // Enables the faucet
+
+	// Mining and Reward Configuration
+	InitialSubsidy  int // Initial mining reward
+	HalvingInterval int // Blocks until reward halving
+	MaxSupply       int // Maximum supply of coins
+
+	// Proof of Work Configuration
+	Difficulty        int // Mining difficulty (number of leading zero bits required in hash)
+	GenesisDifficulty int // Difficulty of the genesis block
+
+	// Block Size Configuration
+	MaxBlockSize     int // Consensus limit on the serialized size of a block in bytes
+	BlockSizeReserve int // Room for the header and the coinbase, left free when filling a block
+
+	// Block Time Configuration
+	MedianTimeBlocks   int   // A block's timestamp must exceed the median of this many previous blocks
+	MaxFutureBlockTime int64 // Seconds a block's timestamp may be ahead of the local clock
+
+	// Finality Configuration
+	DefaultFinalityDepth int // Blocks buried this deep are final, reorgs below them are refused (0 = disabled)
+
+	// Soft-fork deployments signaled with version bits
+	Deployments []Deployment
+
+	// Address Configuration
+	Bech32HRP string // Human-readable part of bech32 addresses
+
+	// P2P Configuration
+	Magic [4]byte // Prefix of every P2P message, zero = derived from the genesis hash
+
+	// Genesis Block Configuration
+	Genesis GenesisParams
+
+	// Defaults
+	DBPath      string // Database path, one per network (can be overridden by the BLOCKCHAIN_DATA_DIR env var)
+	DefaultPort int    // Network port
+}
+
+// GenesisParams fixes every field of a network's genesis block, so that
+// independently initialized nodes start from the same chain
+type GenesisParams struct {
+	Timestamp int64
+	Nonce     int
+	Message   string         // Coinbase data
+	Hash      string         // Expected block hash, hex
+	Alloc     []GenesisAlloc // Premine paid by the coinbase (none = the reward, unspendable)
+}
+
+// MainNetParams are the parameters of the main network
+var MainNetParams = ChainParams{
+	Name:                 NetworkMainnet,
+	InitialSubsidy:       50,       // Similar to Bitcoin's initial 50 BTC
+	HalvingInterval:      210000,   // Same as Bitcoin ~4 years
+	MaxSupply:            21000000, // 21 million like Bitcoin
+	Difficulty:           22,
+	GenesisDifficulty:    16, // Lower difficulty for faster initialization
+	MaxBlockSize:         1000000,
+	BlockSizeReserve:     10000,
+	MedianTimeBlocks:     11,
+	MaxFutureBlockTime:   2 * 60 * 60,
+	DefaultFinalityDepth: 100,
+	Bech32HRP:            "bgc",
+	Magic:                [4]byte{'b', 'g', 'c', 'M'},
+	Genesis: GenesisParams{
+		Timestamp: 1735689600,
+		Nonce:     3652,
+		Message:   "First Transaction from Genesis",
+		Hash:      "00008acfbcb2c0b50ea079dcf693a145c9e744a93ba6d08d8e12be7147e1d4fc",
+	},
+	DBPath:      networkDBPath(NetworkMainnet),
+	DefaultPort: 3000,
+}
+
+// TestNetParams are the parameters of the public test network
+var TestNetParams = testParams(NetworkTestnet, 'T', 2016, GenesisParams{
+	Timestamp: 1735689600,
+	Nonce:     57616,
+	Message:   "First Transaction from Genesis (testnet)",
+	Hash:      "0000206b98149e4ebb3e6b0e67dc86d2de7d86c4b732f05e932c7cb87af2ef91",
+})
+
+// RegTestParams are the parameters of the local regression test network
+var RegTestParams = testParams(NetworkRegtest, 'R', 144, GenesisParams{
+	Timestamp: 1735689600,
+	Nonce:     143319,
+	Message:   "First Transaction from Genesis (regtest)",
+	Hash:      "0000134b7a5583e848cb5f19a0d240c181003d8e33bad7720d0888c97df61c30",
+})
+
+// testParams derives a test network from the main network: its own genesis
+// and magic, the faucet, and the testdummy deployment signaled over window blocks
+func testParams(name string, magic byte, window int, genesis GenesisParams) ChainParams {
+	params := MainNetParams
+	params.Name = name
+	params.TestNetwork = true
+	params.Genesis = genesis
+	params.Magic[3] = magic
+	params.DBPath = networkDBPath(name)
+	params.Deployments = []Deployment{{
+		Name:        "testdummy", // Activates nothing, it exercises signaling
+		Bit:         28,
+		StartHeight: 0,
+		Window:      window,
+		Threshold:   75,
+	}}
+	return params
+}
+
+// activeParams are the parameters of the network this process runs on
+var activeParams atomic.Pointer[ChainParams]
+
+// Params returns the parameters of the network this process runs on: the
+// ones passed to UseParams, otherwise the built-in network selected with the
+// BLOCKCHAIN_NETWORK env var (mainnet when not set or naming a private
+// network, whose parameters are read from its database when it is opened)
+func Params() *ChainParams {
+	if params := activeParams.Load(); params != nil {
+		return params
+	}
+
+	switch os.Getenv("BLOCKCHAIN_NETWORK") {
+	case NetworkTestnet:
+		activeParams.CompareAndSwap(nil, &TestNetParams)
+	case NetworkRegtest:
+		activeParams.CompareAndSwap(nil, &RegTestParams)
+	default:
+		activeParams.CompareAndSwap(nil, &MainNetParams)
+	}
+	return activeParams.Load()
+}
+
+// UseParams makes params the network of this process
+// A process runs on one network at a time: call it before opening a chain,
+// the database path follows the network
+func UseParams(params *ChainParams) {
+	activeParams.Store(params)
+	dbPath = getDBPath()
+}
+
+// RequiredDifficulty returns the difficulty every block at height must be
+// mined at: GenesisDifficulty for the genesis block, Difficulty after it
+func (p *ChainParams) RequiredDifficulty(height int) int {
+	if height == 0 {
+		return p.GenesisDifficulty
+	}
+	return p.Difficulty
+}
+
+// NetworkMagic returns the bytes prefixing the P2P messages of the network:
+// Magic, or the last 4 bytes of the genesis hash for a private network
+func (p *ChainParams) NetworkMagic() [4]byte {
+	if p.Magic != [4]byte{} {
+		return p.Magic
+	}
+
+	var magic [4]byte
+	if hash, err := hex.DecodeString(p.Genesis.Hash); err == nil && len(hash) >= len(magic) {
+		copy(magic[:], hash[len(hash)-len(magic):])
+	}
+	return magic
+}
+
+// SolveGenesis searches the nonce of the genesis block described by
+// p.Genesis and stores it with the resulting hash
+func (p *ChainParams) SolveGenesis() {
+	for nonce := 0; ; nonce++ {
+		p.Genesis.Nonce = nonce
+		block := p.buildGenesis()
+		if NewProofWithDifficulty(block, p.GenesisDifficulty).Validate() {
+			p.Genesis.Hash = hex.EncodeToString(block.Hash)
+			return
+		}
+	}
+}
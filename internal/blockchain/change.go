@@ -0,0 +1,164 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DefaultHDChangePath is the parent of derived change addresses
+const DefaultHDChangePath = "m/44'/0'/0'/1"
+
+// NewChangeAddress adds a key receiving the change of a transaction from owner
+// HD wallets derive it under DefaultHDChangePath, others generate a standalone key
+// The change of a change address belongs to the same owner
+func (ws *Wallets) NewChangeAddress(owner string) (string, error) {
+	owner = ws.Owner(owner)
+
+	var wallet *Wallet
+	if ws.IsHD() {
+		master, err := NewMasterKey(ws.HDSeed)
+		if err != nil {
+			return "", err
+		}
+		parent, err := master.Derive(DefaultHDChangePath)
+		if err != nil {
+			return "", err
+		}
+
+		for wallet == nil && ws.HDNextChangeIndex < HardenedOffset {
+			index := ws.HDNextChangeIndex
+			ws.HDNextChangeIndex++
+
+			if child, err := parent.Child(index); err == nil { // Invalid children are skipped like in BIP32
+				wallet = child.Wallet()
+			}
+		}
+		if wallet == nil {
+			return "", fmt.Errorf("HD change address space exhausted")
+		}
+		wallet.CreatedAt = time.Now().Unix()
+	} else {
+		wallet = NewWallet()
+	}
+
+	wallet.ChangeOf = owner
+	address := string(wallet.Address())
+	ws.Wallets[address] = wallet
+
+	return address, nil
+}
+
+// Owner returns the address whose change address receives the change
+// (the address itself if it is not a change address)
+func (ws *Wallets) Owner(address string) string {
+	if wallet, ok := ws.Wallets[address]; ok && wallet.ChangeOf != "" {
+		return wallet.ChangeOf
+	}
+	return address
+}
+
+// ChangeAddresses returns the change addresses of owner, sorted
+func (ws *Wallets) ChangeAddresses(owner string) []string {
+	var addresses []string
+	for address, wallet := range ws.Wallets {
+		if wallet.ChangeOf == owner {
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Strings(addresses)
+
+	return addresses
+}
+
+// NewTransaction creates a transaction paying recipients from a wallet
+// address, signed with the wallet keys
+// The outputs of the change addresses of from are spent after its own ones.
+// With FreshChange the change goes to a new change address, returned with
+// the transaction (empty when the change returns to from or there is none);
+// the caller saves the wallets
+func (ws *Wallets) NewTransaction(from string, recipients []Recipient, fee int, selector CoinSelector, chain *Blockchain) (*Transaction, string, error) {
+	if _, ok := ws.Wallets[from]; !ok {
+		return nil, "", fmt.Errorf("address %s is not in the wallet", from)
+	}
+
+	if len(recipients) == 0 {
+		return nil, "", fmt.Errorf("a transaction needs at least one recipient")
+	}
+	amount := 0
+	for _, recipient := range recipients {
+		if recipient.Amount <= 0 {
+			return nil, "", fmt.Errorf("invalid amount %d for %s", recipient.Amount, recipient.Address)
+		}
+		amount += recipient.Amount
+	}
+
+	var inputs []TXInput
+	var outputs []TXOutput
+	signers := make(map[string]Signer) // Public key hash -> signer of its inputs
+
+	acc := 0
+	for _, address := range append([]string{from}, ws.ChangeAddresses(from)...) {
+		if acc >= amount+fee {
+			break
+		}
+
+		wallet := ws.Wallets[address]
+		pubKeyHash := HashPubKey(wallet.PublicKey)
+		found, validOutputs := chain.FindSpendableOutputsWith(selector, pubKeyHash, amount+fee-acc)
+		if found == 0 {
+			continue
+		}
+		acc += found
+		signers[hex.EncodeToString(pubKeyHash)] = wallet.Signer()
+
+		for txid, outs := range validOutputs {
+			txID, err := hex.DecodeString(txid)
+			if err != nil {
+				return nil, "", err
+			}
+
+			for _, out := range outs {
+				inputs = append(inputs, TXInput{txID, out, nil, wallet.PublicKey, SequenceFinal})
+			}
+		}
+	}
+
+	if acc < amount+fee {
+		return nil, "", fmt.Errorf("%w: have %d, need %d", ErrInsufficientFunds, acc, amount+fee)
+	}
+
+	for _, recipient := range recipients {
+		outputs = append(outputs, *NewTXOutput(recipient.Amount, recipient.Address))
+	}
+
+	changeAddress := ""
+	if acc > amount+fee {
+		change := from
+		if ws.FreshChange {
+			var err error
+			if changeAddress, err = ws.NewChangeAddress(from); err != nil {
+				return nil, "", err
+			}
+			change = changeAddress
+		}
+		outputs = append(outputs, *NewTXOutput(acc-amount-fee, change))
+	}
+
+	tx := Transaction{nil, inputs, outputs}
+	tx.ID = tx.Hash()
+
+	prevTXs, err := chain.PrevTransactions(&tx)
+	if err != nil {
+		return nil, "", err
+	}
+	for inId, in := range tx.Inputs {
+		signer := signers[hex.EncodeToString(HashPubKey(in.PubKey))]
+		if err := tx.SignInput(inId, signer, prevTXs); err != nil {
+			return nil, "", err
+		}
+	}
+
+	return &tx, changeAddress, nil
+}
@@ -0,0 +1,77 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+)
+
+// Payment channel transactions
+//
+// A unidirectional channel locks the payer's funds in a 2-of-2 multisig
+// output of payer and payee (the funding transaction). Before funding is
+// broadcast the payee signs a refund returning everything to the payer, valid
+// only once the funding output has Timeout confirmations (relative lock-time).
+// Payments are commitments spending the funding output to the payee and the
+// payer, signed by the payer only; the payee completes and broadcasts the
+// latest one to close the channel, and must do so before the refund is valid.
+// No HTLC script exists on this chain, so channels cannot route payments.
+
+// MinChannelTimeout is the shortest refund lock-time, in blocks, leaving the
+// payee time to close the channel
+const MinChannelTimeout = 6
+
+// ChannelFundingOutput returns the index of the output of funding paying to script
+func ChannelFundingOutput(funding *Transaction, script []byte) (int, error) {
+	lock := MultisigScriptHash(script)
+	for i, out := range funding.Outputs {
+		if bytes.Equal(out.PubKeyHash, lock) {
+			return i, nil
+		}
+	}
+
+	return -1, fmt.Errorf("funding transaction %x does not pay to the channel script", funding.ID)
+}
+
+// ChannelPrevTXs returns the previous transactions of channel transactions,
+// whose funding transaction may not be confirmed yet
+func ChannelPrevTXs(funding *Transaction) map[string]Transaction {
+	return map[string]Transaction{hex.EncodeToString(funding.ID): *funding}
+}
+
+// NewChannelRefund builds the unsigned refund of a channel: the whole funding
+// output back to payer once it has timeout confirmations
+func NewChannelRefund(funding *Transaction, out int, script []byte, payer string, timeout int) (*Transaction, error) {
+	if timeout < MinChannelTimeout {
+		return nil, fmt.Errorf("channel timeout must be at least %d blocks", MinChannelTimeout)
+	}
+
+	tx := Transaction{nil,
+		[]TXInput{{funding.ID, out, nil, script, SequenceFinal}},
+		[]TXOutput{*NewTXOutput(funding.Outputs[out].Value, payer)},
+	}
+	if err := tx.SetRelativeLockTime(timeout); err != nil {
+		return nil, err
+	}
+
+	return &tx, nil
+}
+
+// NewChannelCommitment builds the unsigned commitment paying paid to payee
+// and the rest of the funding output back to payer
+func NewChannelCommitment(funding *Transaction, out int, script []byte, payer, payee string, paid int) (*Transaction, error) {
+	capacity := funding.Outputs[out].Value
+	if paid <= 0 || paid > capacity {
+		return nil, fmt.Errorf("channel balance %d is not between 1 and the capacity %d", paid, capacity)
+	}
+
+	outputs := []TXOutput{*NewTXOutput(paid, payee)}
+	if paid < capacity {
+		outputs = append(outputs, *NewTXOutput(capacity-paid, payer))
+	}
+
+	tx := Transaction{nil, []TXInput{{funding.ID, out, nil, script, SequenceFinal}}, outputs}
+	tx.ID = tx.Hash()
+
+	return &tx, nil
+}
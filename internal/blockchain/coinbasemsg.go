@@ -0,0 +1,83 @@
+package blockchain
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxCoinbaseMessage is the longest coinbase message in bytes, like the 100
+// bytes of Bitcoin's coinbase script
+const MaxCoinbaseMessage = 100
+
+// coinbaseMessageEnd separates the message from the random data that keeps
+// the coinbase transactions of a miner unique
+const coinbaseMessageEnd = "\x00"
+
+// legacyCoinbaseData is the length of the random hex data of coinbases
+// without a message
+const legacyCoinbaseData = 48
+
+// ValidateCoinbaseMessage checks a message before miners embed it: printable
+// UTF-8 of at most MaxCoinbaseMessage bytes
+func ValidateCoinbaseMessage(message string) error {
+	if len(message) > MaxCoinbaseMessage {
+		return fmt.Errorf("coinbase message is %d bytes, the limit is %d", len(message), MaxCoinbaseMessage)
+	}
+	if !utf8.ValidString(message) {
+		return fmt.Errorf("coinbase message is not valid UTF-8")
+	}
+	for _, r := range message {
+		if !unicode.IsPrint(r) {
+			return fmt.Errorf("coinbase message has a non-printable character %q", r)
+		}
+	}
+	return nil
+}
+
+// CoinbaseData is the coinbase input data embedding message, "" (random data,
+// see CoinbaseTX) without one
+func CoinbaseData(message string) string {
+	if message == "" {
+		return ""
+	}
+
+	randData := make([]byte, 8)
+	_, err := rand.Read(randData)
+	Handle(err)
+	return message + coinbaseMessageEnd + hex.EncodeToString(randData)
+}
+
+// CoinbaseMessage returns the message a miner embedded in a coinbase
+// transaction ("" = none). Data without the separator, like the genesis
+// coinbase, is the message itself unless it is the random hex of CoinbaseTX
+// Messages other miners embedded are only returned if they are valid
+func (tx *Transaction) CoinbaseMessage() string {
+	if !tx.IsCoinbase() {
+		return ""
+	}
+
+	message, _, found := strings.Cut(string(tx.Inputs[0].PubKey), coinbaseMessageEnd)
+	if !found && len(message) == legacyCoinbaseData {
+		if _, err := hex.DecodeString(message); err == nil {
+			return ""
+		}
+	}
+	if ValidateCoinbaseMessage(message) != nil {
+		return ""
+	}
+	return message
+}
+
+// CoinbaseMessage returns the message embedded in the coinbase of the block
+func (b *Block) CoinbaseMessage() string {
+	for _, tx := range b.Transactions {
+		if tx.IsCoinbase() {
+			return tx.CoinbaseMessage()
+		}
+	}
+	return ""
+}
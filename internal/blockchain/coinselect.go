@@ -0,0 +1,173 @@
+package blockchain
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SpendableOutput is an unspent output coin selection may spend
+type SpendableOutput struct {
+	Outpoint
+	Value int
+}
+
+// CoinSelector chooses the outputs funding a payment
+type CoinSelector interface {
+	// Select returns outputs worth at least target, or nil when the
+	// candidates (in chain order, newest first) cannot cover it
+	Select(candidates []SpendableOutput, target int) []SpendableOutput
+}
+
+// Coin selection strategies
+const (
+	CoinSelectFirstFit      = "first"    // Chain order, newest outputs first (default)
+	CoinSelectLargestFirst  = "largest"  // Fewest inputs
+	CoinSelectSmallestFirst = "smallest" // Consolidates small outputs, less UTXO fragmentation
+	CoinSelectBranchBound   = "bnb"      // Least change, exact matches leave none
+
+	defaultBranchBoundTries = 100000
+)
+
+// coinSelectors are the strategies by name
+var coinSelectors = map[string]CoinSelector{
+	CoinSelectFirstFit:      FirstFitSelector{},
+	CoinSelectLargestFirst:  LargestFirstSelector{},
+	CoinSelectSmallestFirst: SmallestFirstSelector{},
+	CoinSelectBranchBound:   BranchAndBoundSelector{MaxTries: defaultBranchBoundTries},
+}
+
+// ParseCoinSelector returns the strategy with the given name
+func ParseCoinSelector(name string) (CoinSelector, error) {
+	selector, ok := coinSelectors[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown coin selection %q (valid: %s)", name, strings.Join(CoinSelectorNames(), ", "))
+	}
+	return selector, nil
+}
+
+// CoinSelectorNames returns the names of the strategies
+func CoinSelectorNames() []string {
+	names := make([]string, 0, len(coinSelectors))
+	for name := range coinSelectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FirstFitSelector takes outputs in chain order until the target is covered
+type FirstFitSelector struct{}
+
+func (FirstFitSelector) Select(candidates []SpendableOutput, target int) []SpendableOutput {
+	return accumulate(candidates, target)
+}
+
+// LargestFirstSelector takes the largest outputs first, minimizing inputs
+type LargestFirstSelector struct{}
+
+func (LargestFirstSelector) Select(candidates []SpendableOutput, target int) []SpendableOutput {
+	return accumulate(sortedByValue(candidates, true), target)
+}
+
+// SmallestFirstSelector takes the smallest outputs first, consolidating them
+type SmallestFirstSelector struct{}
+
+func (SmallestFirstSelector) Select(candidates []SpendableOutput, target int) []SpendableOutput {
+	return accumulate(sortedByValue(candidates, false), target)
+}
+
+// BranchAndBoundSelector searches the subset of outputs with the least
+// change, then the fewest inputs, stopping at an exact match or after
+// MaxTries steps; it falls back to largest-first when no subset was found
+type BranchAndBoundSelector struct {
+	MaxTries int
+}
+
+func (b BranchAndBoundSelector) Select(candidates []SpendableOutput, target int) []SpendableOutput {
+	sorted := sortedByValue(candidates, true)
+
+	// remaining[i] is the value of sorted[i:], to prune branches that cannot reach the target
+	remaining := make([]int, len(sorted)+1)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + sorted[i].Value
+	}
+	if remaining[0] < target {
+		return nil
+	}
+
+	var current, best []int
+	bestExcess := -1
+	tries := 0
+
+	// search explores including, then excluding, sorted[i]; it returns true to stop
+	var search func(i, sum int) bool
+	search = func(i, sum int) bool {
+		tries++
+		if tries > b.MaxTries {
+			return true
+		}
+
+		if sum >= target {
+			excess := sum - target
+			if best == nil || excess < bestExcess || excess == bestExcess && len(current) < len(best) {
+				best = append(best[:0], current...)
+				bestExcess = excess
+			}
+			return excess == 0 // More outputs only add change
+		}
+		if i == len(sorted) || sum+remaining[i] < target {
+			return false
+		}
+
+		current = append(current, i)
+		if search(i+1, sum+sorted[i].Value) {
+			return true
+		}
+		current = current[:len(current)-1]
+
+		return search(i+1, sum)
+	}
+	search(0, 0)
+
+	if best == nil {
+		return accumulate(sorted, target)
+	}
+
+	selected := make([]SpendableOutput, 0, len(best))
+	for _, i := range best {
+		selected = append(selected, sorted[i])
+	}
+	return selected
+}
+
+// accumulate takes outputs in order until the target is covered
+func accumulate(candidates []SpendableOutput, target int) []SpendableOutput {
+	var selected []SpendableOutput
+	accumulated := 0
+
+	for _, candidate := range candidates {
+		if accumulated >= target {
+			break
+		}
+		selected = append(selected, candidate)
+		accumulated += candidate.Value
+	}
+
+	if accumulated < target {
+		return nil
+	}
+	return selected
+}
+
+// sortedByValue returns a copy of outputs sorted by value, keeping chain order on ties
+func sortedByValue(outputs []SpendableOutput, descending bool) []SpendableOutput {
+	sorted := append([]SpendableOutput(nil), outputs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if descending {
+			return sorted[i].Value > sorted[j].Value
+		}
+		return sorted[i].Value < sorted[j].Value
+	})
+	return sorted
+}
@@ -1,36 +1,35 @@
 package blockchain
 
-// Blockchain configuration constants
-// All protocol parameters are centralized here for easy maintenance
+// Protocol configuration shared by every network
+// Consensus parameters are defined per network in ChainParams (chainparams.go)
 
 const (
-	// Mining and Reward Configuration
-	InitialSubsidy  = 50       // Initial mining reward (similar to Bitcoin's initial 50 BTC)
-	HalvingInterval = 210000   // Blocks until reward halving (same as Bitcoin ~4 years)
-	MaxSupply       = 21000000 // Maximum supply of coins (21 million like Bitcoin)
+	// Network Configuration
+	ProtocolVersion = 6 // Protocol version for network communication (2 = input sequence numbers, 3 = block versions, 4 = compressed messages, 5 = timestamped addresses, 6 = network magic)
 
-	// Proof of Work Configuration
-	Difficulty        = 22 // Mining difficulty (number of leading zeros required in hash)
-	GenesisDifficulty = 16 // Lower difficulty for genesis block (faster initialization)
+	// Network names (selected with the BLOCKCHAIN_NETWORK env var)
+	NetworkMainnet = "mainnet"
+	NetworkTestnet = "testnet"
+	NetworkRegtest = "regtest"
+)
 
-	// Genesis Block Configuration
-	GenesisData = "First Transaction from Genesis" // Genesis block coinbase data
+// GetNetwork returns the name of the network this node runs on
+func GetNetwork() string {
+	return Params().Name
+}
 
-	// Database Configuration
-	DBPath = "./tmp/blocks" // Default database path (can be overridden by env var)
+// IsTestNetwork reports whether the node runs on a test network (testnet or regtest)
+func IsTestNetwork() bool {
+	return Params().TestNetwork
+}
 
-	// Network Configuration (for reference)
-	DefaultPort     = 3000 // Default network port
-	ProtocolVersion = 1    // Protocol version for network communication
-)
-
-// GetBlockReward calculates the mining reward based on block height
-// Implements halving every 210,000 blocks like Bitcoin
-func GetBlockReward(height int) int {
-	reward := InitialSubsidy
+// BlockReward calculates the mining reward based on block height
+// Implements halving every HalvingInterval blocks like Bitcoin
+func (p *ChainParams) BlockReward(height int) int {
+	reward := p.InitialSubsidy
 
 	// Calculate number of halvings
-	halvings := height / HalvingInterval
+	halvings := height / p.HalvingInterval
 
 	// Each halving divides reward by 2
 	for i := 0; i < halvings; i++ {
@@ -45,18 +44,24 @@ func GetBlockReward(height int) int {
 	return reward
 }
 
+// GetBlockReward calculates the mining reward of the network this node runs on
+func GetBlockReward(height int) int {
+	return Params().BlockReward(height)
+}
+
 // GetMaxSupply returns the maximum supply
 func GetMaxSupply() int {
-	return MaxSupply
+	return Params().MaxSupply
 }
 
 // GetTotalMinableBlocks returns the approximate number of blocks until max supply
 func GetTotalMinableBlocks() int {
+	params := Params()
 	totalBlocks := 0
-	reward := InitialSubsidy
+	reward := params.InitialSubsidy
 
 	for reward > 0 {
-		totalBlocks += HalvingInterval
+		totalBlocks += params.HalvingInterval
 		reward = reward / 2
 	}
 
@@ -0,0 +1,190 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"errors"
+	"sync"
+)
+
+// Confirmation states of a watched transaction
+const (
+	ConfirmationPending    = "pending"    // Not in the main chain
+	ConfirmationConfirming = "confirming" // In the main chain, below the required depth
+	ConfirmationConfirmed  = "confirmed"  // Reached the required number of confirmations
+)
+
+// Confirmation events emitted by the tracker
+const (
+	EventIncluded  = "included"  // Transaction included in a main chain block
+	EventConfirmed = "confirmed" // Transaction reached the required depth
+	EventReverted  = "reverted"  // Including block was disconnected, the payment is pending again
+)
+
+// WatchedTx is the confirmation status of a watched transaction
+// Inclusion is keyed to the block hash, so a block replaced at the same
+// height is detected as a revert
+type WatchedTx struct {
+	TxID          string `json:"txid"`
+	Required      int    `json:"required_confirmations"`
+	State         string `json:"state"`
+	BlockHash     string `json:"block_hash,omitempty"`
+	Height        int    `json:"height"`
+	Confirmations int    `json:"confirmations"`
+}
+
+// ConfirmationEvent reports a state change of a watched transaction
+type ConfirmationEvent struct {
+	Type string    `json:"type"`
+	Tx   WatchedTx `json:"tx"`
+}
+
+// ConfirmationTracker follows watched transactions across new blocks and reorgs
+type ConfirmationTracker struct {
+	watched     map[string]*WatchedTx
+	subscribers []func(ConfirmationEvent)
+	mu          sync.Mutex
+}
+
+// NewConfirmationTracker creates an empty tracker
+func NewConfirmationTracker() *ConfirmationTracker {
+	return &ConfirmationTracker{
+		watched: make(map[string]*WatchedTx),
+	}
+}
+
+// Subscribe registers fn to receive every confirmation event
+func (t *ConfirmationTracker) Subscribe(fn func(ConfirmationEvent)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.subscribers = append(t.subscribers, fn)
+}
+
+// Watch starts tracking txID until it has the required number of confirmations
+func (t *ConfirmationTracker) Watch(txID []byte, required int) WatchedTx {
+	if required < 1 {
+		required = 1
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id := hex.EncodeToString(txID)
+	watched, ok := t.watched[id]
+	if !ok {
+		watched = &WatchedTx{
+			TxID:  id,
+			State: ConfirmationPending,
+		}
+		t.watched[id] = watched
+	}
+	watched.Required = required
+
+	return *watched
+}
+
+// Unwatch stops tracking a transaction
+func (t *ConfirmationTracker) Unwatch(txID []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.watched, hex.EncodeToString(txID))
+}
+
+// Status returns the confirmation status of a watched transaction
+func (t *ConfirmationTracker) Status(txID []byte) (WatchedTx, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	watched, ok := t.watched[hex.EncodeToString(txID)]
+	if !ok {
+		return WatchedTx{}, false
+	}
+	return *watched, true
+}
+
+// Update re-evaluates all watched transactions against the current main chain
+// Must be called whenever the tip changes (new block, reorg)
+func (t *ConfirmationTracker) Update(chain *Blockchain) {
+	t.mu.Lock()
+
+	if len(t.watched) == 0 {
+		t.mu.Unlock()
+		return
+	}
+
+	// Locate watched transactions through the transaction index, which only
+	// holds main chain entries: one lookup each, whatever the chain length
+	type inclusion struct {
+		hash   []byte
+		height int
+	}
+	found := make(map[string]inclusion)
+	unreadable := make(map[string]bool)
+	tipHeight := chain.GetBestHeight()
+
+	for id := range t.watched {
+		txID, err := hex.DecodeString(id)
+		if err != nil {
+			continue
+		}
+		_, location, err := chain.FindTransactionLocation(txID)
+		if errors.Is(err, ErrTxNotFound) {
+			continue
+		}
+		if err != nil {
+			// Keep the previous status rather than report a revert on a read error
+			unreadable[id] = true
+			continue
+		}
+		found[id] = inclusion{hash: location.BlockHash, height: location.Height}
+	}
+
+	var events []ConfirmationEvent
+	emit := func(kind string, watched *WatchedTx) {
+		events = append(events, ConfirmationEvent{Type: kind, Tx: *watched})
+	}
+
+	for id, watched := range t.watched {
+		if unreadable[id] {
+			continue
+		}
+		inc, inChain := found[id]
+
+		// The including block is no longer in the main chain
+		if watched.BlockHash != "" && (!inChain || watched.BlockHash != hex.EncodeToString(inc.hash)) {
+			watched.State = ConfirmationPending
+			watched.BlockHash = ""
+			watched.Height = 0
+			watched.Confirmations = 0
+			emit(EventReverted, watched)
+		}
+
+		if !inChain {
+			continue
+		}
+
+		watched.Confirmations = tipHeight - inc.height + 1
+		if watched.BlockHash == "" {
+			watched.BlockHash = hex.EncodeToString(inc.hash)
+			watched.Height = inc.height
+			watched.State = ConfirmationConfirming
+			emit(EventIncluded, watched)
+		}
+
+		if watched.Confirmations >= watched.Required && watched.State != ConfirmationConfirmed {
+			watched.State = ConfirmationConfirmed
+			emit(EventConfirmed, watched)
+		}
+	}
+
+	subscribers := append([]func(ConfirmationEvent){}, t.subscribers...)
+	t.mu.Unlock()
+
+	// Deliver outside the lock so subscribers may call back into the tracker
+	for _, event := range events {
+		for _, fn := range subscribers {
+			fn(event)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// newTipOnlyChain stores a single block at a large height whose ancestors are
+// missing, so any walk back from the tip fails on the first parent read
+func newTipOnlyChain(t *testing.T, txs ...*Transaction) *Blockchain {
+	t.Helper()
+
+	db, err := leveldb.OpenFile(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	tip := &Block{
+		Hash:         bytes.Repeat([]byte{0xab}, 32),
+		PrevHash:     bytes.Repeat([]byte{0xcd}, 32), // Not in the database
+		Transactions: txs,
+		Height:       5000,
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Put(tip.Hash, tip.Serialize())
+	indexBlock(batch, tip)
+	if err := db.Write(batch, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	return &Blockchain{LastHash: tip.Hash, Database: db}
+}
+
+func TestConfirmationUpdateMissingTxDoesNotScanChain(t *testing.T) {
+	chain := newTipOnlyChain(t, &Transaction{ID: []byte{0x01}})
+
+	tracker := NewConfirmationTracker()
+	tracker.Watch([]byte{0xff}, 1)
+
+	// A chain walk looking for the missing transaction would read the absent
+	// parent of the tip and panic
+	tracker.Update(chain)
+
+	watched, ok := tracker.Status([]byte{0xff})
+	if !ok {
+		t.Fatal("missing transaction is no longer watched")
+	}
+	if watched.State != ConfirmationPending {
+		t.Errorf("state = %q, want %q", watched.State, ConfirmationPending)
+	}
+}
+
+func TestConfirmationUpdateFindsTxThroughIndex(t *testing.T) {
+	chain := newTipOnlyChain(t, &Transaction{ID: []byte{0x01}})
+
+	tracker := NewConfirmationTracker()
+	tracker.Watch([]byte{0x01}, 1)
+	tracker.Watch([]byte{0xff}, 1)
+
+	var events []ConfirmationEvent
+	tracker.Subscribe(func(event ConfirmationEvent) {
+		events = append(events, event)
+	})
+
+	tracker.Update(chain)
+
+	watched, _ := tracker.Status([]byte{0x01})
+	if watched.State != ConfirmationConfirmed || watched.Height != 5000 || watched.Confirmations != 1 {
+		t.Errorf("watched = %+v, want confirmed at height 5000 with 1 confirmation", watched)
+	}
+	if len(events) != 2 || events[0].Type != EventIncluded || events[1].Type != EventConfirmed {
+		t.Errorf("events = %+v, want included then confirmed", events)
+	}
+}
@@ -0,0 +1,119 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+)
+
+// Data-carrier outputs (OP_RETURN-style)
+//
+// A data-carrier output embeds up to MaxDataCarrierBytes of arbitrary data,
+// such as a document hash, and carries no value. It is provably unspendable:
+// it is never added to the UTXO set, so no input can reference it. The data
+// is stored in the lock as marker || length || data, zero-padded when needed
+// so the lock never has the 20- or 32-byte length of key and multisig hashes.
+// Like multisig, the output encoding is unchanged.
+
+const (
+	// MaxDataCarrierBytes is the maximum data embedded in one output
+	MaxDataCarrierBytes = 80
+
+	dataCarrierMarker = byte(0x6a) // OP_RETURN
+)
+
+// NewDataOutput builds a zero-value output embedding data
+func NewDataOutput(data []byte) (*TXOutput, error) {
+	if len(data) == 0 || len(data) > MaxDataCarrierBytes {
+		return nil, fmt.Errorf("data must be between 1 and %d bytes, got %d", MaxDataCarrierBytes, len(data))
+	}
+
+	lock := make([]byte, dataCarrierLockLength(len(data)))
+	lock[0] = dataCarrierMarker
+	lock[1] = byte(len(data))
+	copy(lock[2:], data)
+
+	return &TXOutput{0, lock}, nil
+}
+
+// dataCarrierLockLength returns the length of the lock embedding n bytes
+func dataCarrierLockLength(n int) int {
+	length := 2 + n
+	if length == 20 || length == multisigHashLength {
+		length++ // Zero padding byte
+	}
+	return length
+}
+
+// IsDataCarrier reports whether the output is a data-carrier output
+func (out *TXOutput) IsDataCarrier() bool {
+	_, ok := dataCarrierPayload(out.PubKeyHash)
+	return ok
+}
+
+// Data returns the data embedded in a data-carrier output (nil otherwise)
+func (out *TXOutput) Data() []byte {
+	data, _ := dataCarrierPayload(out.PubKeyHash)
+	return data
+}
+
+// dataCarrierPayload parses a data-carrier lock
+func dataCarrierPayload(lock []byte) ([]byte, bool) {
+	if len(lock) < 3 || len(lock) == 20 || len(lock) == multisigHashLength || lock[0] != dataCarrierMarker {
+		return nil, false
+	}
+
+	n := int(lock[1])
+	if n == 0 || n > MaxDataCarrierBytes || len(lock) != dataCarrierLockLength(n) || len(lock) > 2+n && lock[2+n] != 0 {
+		return nil, false
+	}
+
+	return lock[2 : 2+n], true
+}
+
+// NewDataTransaction builds an unsigned transaction publishing data in a
+// data-carrier output, funded by funder: funder.Amount is the fee and the
+// rest of the selected outputs is returned as change
+func NewDataTransaction(funder Funding, data []byte, chain *Blockchain) (*Transaction, error) {
+	dataOut, err := NewDataOutput(data)
+	if err != nil {
+		return nil, err
+	}
+
+	pubKeyHash := HashPubKey(funder.PubKey)
+	if !bytes.Equal(pubKeyHash, addressPubKeyHash(funder.Address)) {
+		return nil, fmt.Errorf("public key does not match address %s", funder.Address)
+	}
+
+	// Spend at least one output even without a fee: a transaction needs inputs
+	needed := funder.Amount
+	if needed < 1 {
+		needed = 1
+	}
+	acc, validOutputs := chain.FindSpendableOutputsWith(funder.Selector, pubKeyHash, needed)
+	if acc < needed {
+		return nil, fmt.Errorf("%w in %s: have %d, need %d", ErrInsufficientFunds, funder.Address, acc, needed)
+	}
+
+	var inputs []TXInput
+	for txid, outs := range validOutputs {
+		txID, err := hex.DecodeString(txid)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, out := range outs {
+			inputs = append(inputs, TXInput{txID, out, nil, funder.PubKey, SequenceFinal})
+		}
+	}
+
+	outputs := []TXOutput{*dataOut}
+	if acc > funder.Amount {
+		outputs = append(outputs, *NewTXOutput(acc-funder.Amount, funder.Address))
+	}
+
+	tx := Transaction{nil, inputs, outputs}
+	tx.ID = tx.Hash()
+
+	return &tx, nil
+}
@@ -0,0 +1,170 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Data directories
+//
+// Each network keeps its database and node-local files in its own data
+// directory, ./tmp/<network>, so nodes of several networks run side by side
+// from one working directory. BLOCKCHAIN_DATA_DIR replaces it, e.g. to run
+// several nodes of the same network. The wallet keystore stays in ./tmp,
+// shared by the networks.
+//
+// Older releases shared ./tmp for every network. Its database is moved to the
+// data directory of the network it belongs to the first time that network
+// looks for its chain. Chains created before the genesis blocks were fixed
+// cannot be told apart: they go to the first network looking, which is the
+// one older releases would have opened them with.
+
+// legacyDataDir is the data directory shared by the networks of older releases
+const legacyDataDir = "./tmp"
+
+// networkDBPath returns the default database path of a network
+func networkDBPath(network string) string {
+	return legacyDataDir + "/" + network + "/blocks"
+}
+
+// validNetworkName reports whether a private network name can name its data
+// directory
+func validNetworkName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// isPrivateNetwork reports whether name can be a private network
+func isPrivateNetwork(name string) bool {
+	switch name {
+	case NetworkMainnet, NetworkTestnet, NetworkRegtest:
+		return false
+	}
+	return validNetworkName(name)
+}
+
+// moveLegacyDB moves the database of the shared data directory of older
+// releases, with the node-local files next to it, to the data directory of
+// the current network when it belongs to that network and the network has
+// no chain yet
+func moveLegacyDB() {
+	legacyDBPath := legacyDataDir + "/blocks"
+	if os.Getenv("BLOCKCHAIN_DATA_DIR") != "" || filepath.Clean(dbPath) == filepath.Clean(legacyDBPath) {
+		return
+	}
+	if _, err := os.Stat(filepath.Join(legacyDBPath, "CURRENT")); err != nil {
+		return
+	}
+	if _, err := os.Stat(filepath.Join(dbPath, "CURRENT")); err == nil {
+		return
+	}
+
+	network, err := legacyDBNetwork(legacyDBPath)
+	if err != nil {
+		log.Printf("⚠️  Could not read the network of the blockchain in %s: %v", legacyDBPath, err)
+		return
+	}
+	if network == "" {
+		network = Params().Name
+	}
+	if network != Params().Name && !(isPrivateNetwork(network) && dbPath == networkDBPath(network)) {
+		return
+	}
+
+	if err := moveLegacyDataDir(legacyDBPath); err != nil {
+		log.Printf("⚠️  Could not move the %s blockchain from %s to %s: %v", network, legacyDBPath, dbPath, err)
+		return
+	}
+	log.Printf("🗄️  Moved the %s blockchain from %s to %s", network, legacyDBPath, dbPath)
+}
+
+// moveLegacyDataDir moves the legacy database and the files of the legacy
+// data directory, except the wallet keystore, to the current data directory
+func moveLegacyDataDir(legacyDBPath string) error {
+	if err := os.MkdirAll(DataDir(), os.ModePerm); err != nil {
+		return err
+	}
+	// An empty directory left by a node that never created a chain
+	if err := os.RemoveAll(dbPath); err != nil {
+		return err
+	}
+	if err := os.Rename(legacyDBPath, dbPath); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(legacyDataDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || strings.HasPrefix(name, "wallets.") {
+			continue
+		}
+		target := filepath.Join(DataDir(), name)
+		if _, err := os.Stat(target); err == nil {
+			continue // The network already has its own
+		}
+		if err := os.Rename(filepath.Join(legacyDataDir, name), target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// legacyDBNetwork returns the network of a database: the private network
+// stored in it, otherwise the built-in network whose genesis block it has
+// (none for a genesis block that is not fixed)
+func legacyDBNetwork(path string) (string, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	if data, err := db.Get(chainParamsKey, nil); err == nil {
+		var params ChainParams
+		if err := json.Unmarshal(data, &params); err != nil {
+			return "", fmt.Errorf("stored chain parameters: %v", err)
+		}
+		return params.Name, nil
+	}
+
+	// Databases older than the height index are walked down to their genesis
+	genesis, err := db.Get(heightIndexKey(0), nil)
+	if err != nil {
+		hash, err := db.Get([]byte("lh"), nil)
+		if err != nil {
+			return "", fmt.Errorf("tip: %v", err)
+		}
+		for len(hash) > 0 {
+			data, err := db.Get(hash, nil)
+			if err != nil {
+				return "", fmt.Errorf("block %x: %v", hash, err)
+			}
+			genesis = hash
+			hash = Deserialize(data).PrevHash
+		}
+	}
+
+	for _, params := range []*ChainParams{&MainNetParams, &TestNetParams, &RegTestParams} {
+		if hex.EncodeToString(genesis) == params.Genesis.Hash {
+			return params.Name, nil
+		}
+	}
+	return "", nil
+}
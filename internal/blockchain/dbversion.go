@@ -0,0 +1,224 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Database schema versions
+const (
+	DBSchemaUnversioned = 1 // Databases written before the schema version was recorded
+	DBSchemaVersion     = 4 // Layout written by this release
+)
+
+var dbVersionKey = []byte("dbversion")
+
+// DBVersion is the schema and protocol version of the release that last wrote the database
+type DBVersion struct {
+	Schema   int
+	Protocol int
+}
+
+// DBVersionError reports a database this release cannot open safely
+type DBVersionError struct {
+	Found     int
+	Supported int
+}
+
+func (e *DBVersionError) Error() string {
+	if e.Found > e.Supported {
+		return fmt.Sprintf("database schema v%d was written by a newer release, this binary supports up to v%d; "+
+			"opening it could silently corrupt it. Run the newer release, or convert the database with its "+
+			"'migratedb -to %d' command", e.Found, e.Supported, e.Supported)
+	}
+	return fmt.Sprintf("database schema v%d is older than v%d used by this release; "+
+		"back up the data directory and run 'migratedb' to upgrade it", e.Found, e.Supported)
+}
+
+// dbMigration converts the database between schema From and From+1
+type dbMigration struct {
+	From        int
+	Description string
+	Automatic   bool                       // Applied when the database is opened, without migratedb
+	Up          func(db *leveldb.DB) error // From -> From+1
+	Down        func(db *leveldb.DB) error // From+1 -> From (nil = no way back)
+}
+
+// dbMigrations are the schema conversions, oldest first
+// Converting only changes the data, the recorded version is written afterwards
+var dbMigrations = []dbMigration{
+	{
+		From:        DBSchemaUnversioned,
+		Description: "record the schema version in the database",
+		Automatic:   true,
+		Up:          func(db *leveldb.DB) error { return nil },
+		Down:        func(db *leveldb.DB) error { return nil }, // Older releases ignore the version key
+	},
+	{
+		From:        2,
+		Description: "index transactions by ID",
+		Automatic:   true,
+		Up:          buildTxIndex,
+		Down:        dropTxIndex,
+	},
+	{
+		From:        3,
+		Description: "index main chain blocks by height",
+		Automatic:   true,
+		Up:          buildHeightIndex,
+		Down:        dropHeightIndex,
+	},
+}
+
+// migrationFrom returns the conversion between schema version and version+1
+func migrationFrom(version int) (dbMigration, bool) {
+	for _, m := range dbMigrations {
+		if m.From == version {
+			return m, true
+		}
+	}
+	return dbMigration{}, false
+}
+
+// readDBVersion returns the recorded version of the database
+// A database without chain is new and gets the current version, recorded by
+// checkDBVersion since no protocol wrote it yet
+func readDBVersion(db *leveldb.DB) (DBVersion, error) {
+	data, err := db.Get(dbVersionKey, nil)
+	if err == leveldb.ErrNotFound {
+		if _, err := db.Get([]byte("lh"), nil); err == leveldb.ErrNotFound {
+			return DBVersion{Schema: DBSchemaVersion}, nil
+		}
+		return DBVersion{Schema: DBSchemaUnversioned}, nil
+	}
+	if err != nil {
+		return DBVersion{}, err
+	}
+
+	var version DBVersion
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&version); err != nil {
+		return DBVersion{}, fmt.Errorf("unreadable database version: %v", err)
+	}
+	return version, nil
+}
+
+// writeDBVersion records the schema version the database now has
+func writeDBVersion(db *leveldb.DB, schema int) error {
+	if schema <= DBSchemaUnversioned {
+		return db.Delete(dbVersionKey, nil)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(DBVersion{Schema: schema, Protocol: ProtocolVersion}); err != nil {
+		return err
+	}
+	return db.Put(dbVersionKey, buf.Bytes(), nil)
+}
+
+// checkDBVersion refuses databases of another schema, applying the automatic
+// upgrades, and records the version of this release
+func checkDBVersion(db *leveldb.DB) error {
+	version, err := readDBVersion(db)
+	if err != nil {
+		return err
+	}
+
+	if version.Schema > DBSchemaVersion {
+		return &DBVersionError{Found: version.Schema, Supported: DBSchemaVersion}
+	}
+
+	for schema := version.Schema; schema < DBSchemaVersion; schema++ {
+		m, ok := migrationFrom(schema)
+		if !ok || !m.Automatic {
+			return &DBVersionError{Found: version.Schema, Supported: DBSchemaVersion}
+		}
+		if err := m.Up(db); err != nil {
+			return fmt.Errorf("upgrading database schema v%d: %v", schema, err)
+		}
+		log.Printf("🗄️  Database schema v%d -> v%d: %s", schema, schema+1, m.Description)
+	}
+
+	if version.Schema == DBSchemaVersion && version.Protocol == ProtocolVersion {
+		return nil
+	}
+	return writeDBVersion(db, DBSchemaVersion)
+}
+
+// openDB opens the database, exiting with an explanation when it was
+// written with a schema this release cannot use
+func openDB() *leveldb.DB {
+	moveLegacyDB()
+
+	db, err := leveldb.OpenFile(dbPath, nil)
+	Handle(err)
+
+	if err := checkDBVersion(db); err != nil {
+		db.Close()
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+
+	return db
+}
+
+// MigrateDB converts the database to schema target, up or down, and returns
+// the conversions applied
+// It fails without changes when a conversion on the way is unknown
+func MigrateDB(target int) ([]string, error) {
+	if target < DBSchemaUnversioned || target > DBSchemaVersion {
+		return nil, fmt.Errorf("schema v%d is not supported by this release (v%d to v%d)", target, DBSchemaUnversioned, DBSchemaVersion)
+	}
+	if !DBexists() {
+		return nil, fmt.Errorf("no database found in %s", dbPath)
+	}
+
+	db, err := leveldb.OpenFile(dbPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	version, err := readDBVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	if version.Schema > DBSchemaVersion {
+		return nil, &DBVersionError{Found: version.Schema, Supported: DBSchemaVersion}
+	}
+
+	// Resolve every step first so an impossible conversion changes nothing
+	var steps []func(db *leveldb.DB) error
+	var applied []string
+	for schema := version.Schema; schema != target; {
+		if schema < target {
+			m, ok := migrationFrom(schema)
+			if !ok {
+				return nil, fmt.Errorf("no conversion from schema v%d to v%d", schema, schema+1)
+			}
+			steps = append(steps, m.Up)
+			applied = append(applied, fmt.Sprintf("v%d -> v%d: %s", schema, schema+1, m.Description))
+			schema++
+		} else {
+			m, ok := migrationFrom(schema - 1)
+			if !ok || m.Down == nil {
+				return nil, fmt.Errorf("no conversion from schema v%d back to v%d", schema, schema-1)
+			}
+			steps = append(steps, m.Down)
+			applied = append(applied, fmt.Sprintf("v%d -> v%d: revert %q", schema, schema-1, m.Description))
+			schema--
+		}
+	}
+
+	for i, step := range steps {
+		if err := step(db); err != nil {
+			return applied[:i], fmt.Errorf("%s: %v", applied[i], err)
+		}
+	}
+
+	return applied, writeDBVersion(db, target)
+}
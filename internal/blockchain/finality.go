@@ -0,0 +1,49 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ErrFinalityViolation is returned for blocks that would reorganize finalized blocks
+var ErrFinalityViolation = errors.New("conflicts with a finalized block")
+
+// FinalizedHeight returns the height of the most recent finalized block
+// (-1 when finality is disabled or the chain is shorter than the depth)
+func (chain *Blockchain) FinalizedHeight() int {
+	if chain.FinalityDepth <= 0 {
+		return -1
+	}
+
+	finalized := chain.GetBestHeight() - chain.FinalityDepth
+	if finalized < 0 {
+		return -1
+	}
+	return finalized
+}
+
+// IsFinalized reports whether the main chain block at height is final
+func (chain *Blockchain) IsFinalized(height int) bool {
+	return height <= chain.FinalizedHeight()
+}
+
+// CheckFinality refuses blocks that compete with a finalized main chain block
+// A block at or below the finalized height whose hash differs from the main
+// chain block at that height would fork off below the rolling checkpoint
+func (chain *Blockchain) CheckFinality(block *Block) error {
+	finalized := chain.FinalizedHeight()
+	if block.Height > finalized {
+		return nil
+	}
+
+	mainHash, err := chain.MainChainHashAt(block.Height)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(mainHash, block.Hash) {
+		return fmt.Errorf("%w: block %d (%x) forks below finalized height %d", ErrFinalityViolation, block.Height, block.Hash, finalized)
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// genesisCoinbase pays the premine allocations of a private network or,
+// without any, the genesis reward to an all-zero public key hash: no key
+// hashes to it, so the output can never be spent
+func genesisCoinbase(message string, reward int, alloc []GenesisAlloc) *Transaction {
+	txin := TXInput{[]byte{}, -1, nil, []byte(message), SequenceFinal}
+
+	var outputs []TXOutput
+	for _, a := range alloc {
+		outputs = append(outputs, *NewTXOutput(a.Value, a.Address))
+	}
+	if len(outputs) == 0 {
+		outputs = []TXOutput{{Value: reward, PubKeyHash: make([]byte, 20)}}
+	}
+
+	tx := Transaction{nil, []TXInput{txin}, outputs}
+	tx.ID = tx.Hash()
+
+	return &tx
+}
+
+// buildGenesis assembles the genesis block described by p.Genesis, hashing it with its nonce
+func (p *ChainParams) buildGenesis() *Block {
+	block := &Block{
+		Timestamp:    p.Genesis.Timestamp,
+		Transactions: []*Transaction{genesisCoinbase(p.Genesis.Message, p.BlockReward(0), p.Genesis.Alloc)},
+		PrevHash:     []byte{},
+		Nonce:        p.Genesis.Nonce,
+		Height:       0,
+		Difficulty:   p.GenesisDifficulty,
+	}
+	block.MerkleRoot = block.HashTransactions()
+	hash := sha256.Sum256(NewProofWithDifficulty(block, p.GenesisDifficulty).InitData(p.Genesis.Nonce))
+	block.Hash = hash[:]
+
+	return block
+}
+
+// GenesisBlock returns the fixed genesis block of the network
+func (p *ChainParams) GenesisBlock() *Block {
+	block := p.buildGenesis()
+
+	// A mismatch means the hardcoded parameters or the block format changed
+	if want, _ := hex.DecodeString(p.Genesis.Hash); !bytes.Equal(block.Hash, want) {
+		panic(fmt.Sprintf("genesis block of %s hashes to %x, expected %s", p.Name, block.Hash, p.Genesis.Hash))
+	}
+
+	return block
+}
+
+// GenesisBlock returns the fixed genesis block of the network the node runs on
+func GenesisBlock() *Block {
+	return Params().GenesisBlock()
+}
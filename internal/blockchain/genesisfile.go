@@ -0,0 +1,157 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// chainParamsKey stores the parameters of a private network in its database,
+// so the chain is reopened with the rules it was created with
+var chainParamsKey = []byte("chainparams")
+
+// GenesisFile describes a private network (genesis.json)
+// Omitted values are inherited from the main network
+type GenesisFile struct {
+	Network           string         `json:"network"`                      // Network ID, must not be a built-in network
+	Timestamp         int64          `json:"timestamp"`                    // Genesis block time (Unix seconds)
+	Message           string         `json:"message,omitempty"`            // Genesis coinbase data
+	Difficulty        int            `json:"difficulty,omitempty"`         // Mining difficulty
+	GenesisDifficulty int            `json:"genesis_difficulty,omitempty"` // Difficulty of the genesis block
+	InitialSubsidy    int            `json:"initial_subsidy,omitempty"`    // Block reward before the first halving
+	HalvingInterval   int            `json:"halving_interval,omitempty"`   // Blocks between halvings
+	MaxSupply         int            `json:"max_supply,omitempty"`
+	Alloc             []GenesisAlloc `json:"alloc,omitempty"` // Premine, paid by the genesis coinbase
+	Hash              string         `json:"hash,omitempty"`  // Expected genesis hash, checked when set
+}
+
+// GenesisAlloc is a balance preallocated in the genesis block
+type GenesisAlloc struct {
+	Address string `json:"address"`
+	Value   int    `json:"value"`
+}
+
+// LoadGenesisFile reads a genesis.json and returns the parameters of the
+// private network it describes, with its genesis block solved
+func LoadGenesisFile(path string) (*ChainParams, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file GenesisFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	params, err := file.ChainParams()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return params, nil
+}
+
+// ChainParams validates the file and builds the network parameters
+// The genesis nonce is searched from 0, so a file always yields the same block
+func (f GenesisFile) ChainParams() (*ChainParams, error) {
+	switch f.Network {
+	case "":
+		return nil, fmt.Errorf("network is required")
+	case NetworkMainnet, NetworkTestnet, NetworkRegtest:
+		return nil, fmt.Errorf("network %q is a built-in network", f.Network)
+	}
+	if !validNetworkName(f.Network) {
+		return nil, fmt.Errorf("network %q may only contain letters, digits, '-' and '_'", f.Network)
+	}
+	if f.Timestamp <= 0 {
+		return nil, fmt.Errorf("timestamp is required")
+	}
+
+	params := MainNetParams
+	params.Name = f.Network
+	params.Magic = [4]byte{} // Derived from its own genesis
+	params.DBPath = networkDBPath(f.Network)
+	params.Genesis = GenesisParams{Timestamp: f.Timestamp, Message: f.Message}
+	if params.Genesis.Message == "" {
+		params.Genesis.Message = "Genesis of " + f.Network
+	}
+
+	if f.Difficulty != 0 {
+		params.Difficulty = f.Difficulty
+	}
+	if f.GenesisDifficulty != 0 {
+		params.GenesisDifficulty = f.GenesisDifficulty
+	}
+	if f.InitialSubsidy != 0 {
+		params.InitialSubsidy = f.InitialSubsidy
+	}
+	if f.HalvingInterval != 0 {
+		params.HalvingInterval = f.HalvingInterval
+	}
+	if f.MaxSupply != 0 {
+		params.MaxSupply = f.MaxSupply
+	}
+
+	if params.Difficulty < MinDifficulty || params.Difficulty > MaxDifficulty || params.GenesisDifficulty < MinDifficulty || params.GenesisDifficulty > MaxDifficulty {
+		return nil, fmt.Errorf("difficulties must be between %d and %d", MinDifficulty, MaxDifficulty)
+	}
+	if params.InitialSubsidy < 0 || params.HalvingInterval < 1 || params.MaxSupply < 1 {
+		return nil, fmt.Errorf("initial_subsidy must not be negative, halving_interval and max_supply must be positive")
+	}
+
+	premine := 0
+	for i, alloc := range f.Alloc {
+		if !ValidateAddress(alloc.Address) {
+			return nil, fmt.Errorf("alloc %d: invalid address %q", i, alloc.Address)
+		}
+		if alloc.Value <= 0 {
+			return nil, fmt.Errorf("alloc %d: value must be positive", i)
+		}
+		premine += alloc.Value
+	}
+	if premine > params.MaxSupply {
+		return nil, fmt.Errorf("allocations total %d, over the max supply %d", premine, params.MaxSupply)
+	}
+	params.Genesis.Alloc = f.Alloc
+
+	params.SolveGenesis()
+	if f.Hash != "" && f.Hash != params.Genesis.Hash {
+		return nil, fmt.Errorf("genesis hashes to %s, expected %s", params.Genesis.Hash, f.Hash)
+	}
+
+	return &params, nil
+}
+
+// storeChainParams records the parameters of a private network in its database
+// Built-in networks are not stored: their rules come with the release
+func storeChainParams(db *leveldb.DB, params *ChainParams) error {
+	switch params.Name {
+	case NetworkMainnet, NetworkTestnet, NetworkRegtest:
+		return nil
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return db.Put(chainParamsKey, data, nil)
+}
+
+// useStoredChainParams switches the process to the private network a
+// database was created for, if any
+// The database stays where it was opened, whatever the stored DBPath
+func useStoredChainParams(db *leveldb.DB) {
+	data, err := db.Get(chainParamsKey, nil)
+	if err != nil {
+		return
+	}
+
+	var params ChainParams
+	if err := json.Unmarshal(data, &params); err != nil {
+		log.Panicf("stored chain parameters: %v", err)
+	}
+	activeParams.Store(&params)
+}
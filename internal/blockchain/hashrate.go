@@ -0,0 +1,124 @@
+package blockchain
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// HashRateWindow is how far back the local miner's hashrate is measured
+const HashRateWindow = time.Minute
+
+// hashSample is a run of hashes computed by the local miner
+type hashSample struct {
+	end    time.Time
+	hashes int
+	busy   time.Duration
+}
+
+// hashMeter measures the hashrate of the local proof of work
+type hashMeter struct {
+	samples []hashSample // Oldest first, within HashRateWindow
+	mu      sync.Mutex
+}
+
+var localHashMeter = &hashMeter{}
+
+// add records hashes computed over busy
+func (m *hashMeter) add(hashes int, busy time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.samples = append(m.samples, hashSample{end: now, hashes: hashes, busy: busy})
+	m.prune(now)
+}
+
+// prune forgets the samples older than HashRateWindow
+// The caller must hold m.mu
+func (m *hashMeter) prune(now time.Time) {
+	i := 0
+	for i < len(m.samples) && now.Sub(m.samples[i].end) > HashRateWindow {
+		i++
+	}
+	m.samples = m.samples[i:]
+}
+
+// MinerHashRate returns the hashes per second of the local miner over the last
+// HashRateWindow, counting only the time it spent hashing, and whether it
+// hashed at all in that window
+func MinerHashRate() (float64, bool) {
+	m := localHashMeter
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune(time.Now())
+
+	var hashes int
+	var busy time.Duration
+	for _, sample := range m.samples {
+		hashes += sample.hashes
+		busy += sample.busy
+	}
+	if busy <= 0 {
+		return 0, len(m.samples) > 0
+	}
+
+	return float64(hashes) / busy.Seconds(), true
+}
+
+// BlockWork is the expected number of hashes to mine a block at difficulty:
+// its target is 2^(256-difficulty)
+func BlockWork(difficulty int) float64 {
+	return math.Ldexp(1, difficulty)
+}
+
+// HashRateEstimate is the network hashrate implied by recent blocks
+type HashRateEstimate struct {
+	Blocks          int     // Blocks whose work is counted
+	FromHeight      int     // Block the time span starts at
+	ToHeight        int     // Tip
+	TimeSpan        int64   // Seconds between the oldest and newest timestamps
+	Work            float64 // Expected hashes of the counted blocks
+	HashesPerSecond float64 // 0 when the time span is not positive
+}
+
+// EstimateNetworkHashRate divides the work of the last n blocks by the time
+// they took, like Bitcoin's getnetworkhashps: the timestamps of the n blocks
+// and the one before them bound the span (lowest to highest, as timestamps
+// need not increase). A shorter chain is counted from its genesis
+func (chain *Blockchain) EstimateNetworkHashRate(n int) HashRateEstimate {
+	chain.RLockState()
+	defer chain.RUnlockState()
+
+	var estimate HashRateEstimate
+	var minTime, maxTime int64
+
+	iter := chain.Iterator()
+	for i := 0; i <= n; i++ {
+		block := iter.Next()
+		if i == 0 {
+			estimate.ToHeight = block.Height
+			minTime, maxTime = block.Timestamp, block.Timestamp
+		}
+		minTime = min(minTime, block.Timestamp)
+		maxTime = max(maxTime, block.Timestamp)
+		estimate.FromHeight = block.Height
+
+		if i < n && len(block.PrevHash) > 0 {
+			// The block the span starts at only bounds the time
+			estimate.Blocks++
+			estimate.Work += BlockWork(block.Difficulty)
+		}
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	estimate.TimeSpan = maxTime - minTime
+	if estimate.TimeSpan > 0 {
+		estimate.HashesPerSecond = estimate.Work / float64(estimate.TimeSpan)
+	}
+
+	return estimate
+}
@@ -0,0 +1,264 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Hierarchical deterministic (BIP32-style) key derivation on P-256
+//
+// The scheme follows BIP32 with the curve swapped for P-256:
+//   master:   I = HMAC-SHA512("Blockchain seed", seed), k = IL, chain code = IR
+//   hardened: I = HMAC-SHA512(c, 0x00 || ser256(k) || ser32(i)), i >= 2^31
+//   normal:   I = HMAC-SHA512(c, serP(K) || ser32(i))
+//   child k = (IL + k) mod n
+// Invalid children (IL >= n or k = 0) are skipped like in BIP32.
+
+const (
+	// HardenedOffset is the first hardened child index
+	HardenedOffset uint32 = 0x80000000
+	// HDSeedLength is the length of generated seeds in bytes
+	HDSeedLength = 32
+	// DefaultHDPath is the parent of derived receive addresses
+	DefaultHDPath = "m/44'/0'/0'/0"
+)
+
+var hdMasterKey = []byte("Blockchain seed")
+
+// ExtendedKey is a private key together with its chain code
+type ExtendedKey struct {
+	Key       *big.Int
+	ChainCode []byte
+	Path      string
+}
+
+// NewHDSeed generates a random seed
+func NewHDSeed() ([]byte, error) {
+	seed := make([]byte, HDSeedLength)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	return seed, nil
+}
+
+// NewMasterKey derives the master extended key from a seed
+func NewMasterKey(seed []byte) (*ExtendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, fmt.Errorf("seed must be between 16 and 64 bytes")
+	}
+
+	mac := hmac.New(sha512.New, hdMasterKey)
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	key := new(big.Int).SetBytes(sum[:32])
+	if key.Sign() == 0 || key.Cmp(elliptic.P256().Params().N) >= 0 {
+		return nil, fmt.Errorf("seed produces an invalid master key")
+	}
+
+	return &ExtendedKey{Key: key, ChainCode: sum[32:], Path: "m"}, nil
+}
+
+// Child derives the child key at index (>= HardenedOffset for hardened)
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	curve := elliptic.P256()
+	n := curve.Params().N
+
+	var data []byte
+	if index >= HardenedOffset {
+		data = append([]byte{0x00}, k.Key.FillBytes(make([]byte, 32))...)
+	} else {
+		x, y := curve.ScalarBaseMult(k.Key.FillBytes(make([]byte, 32)))
+		data = elliptic.MarshalCompressed(curve, x, y)
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+
+	mac := hmac.New(sha512.New, k.ChainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	il := new(big.Int).SetBytes(sum[:32])
+	if il.Cmp(n) >= 0 {
+		return nil, fmt.Errorf("invalid child %d", index)
+	}
+
+	child := new(big.Int).Add(il, k.Key)
+	child.Mod(child, n)
+	if child.Sign() == 0 {
+		return nil, fmt.Errorf("invalid child %d", index)
+	}
+
+	return &ExtendedKey{Key: child, ChainCode: sum[32:], Path: k.Path + "/" + formatHDIndex(index)}, nil
+}
+
+// Derive derives the key at a path such as "m/44'/0'/0'/0/5"
+func (k *ExtendedKey) Derive(path string) (*ExtendedKey, error) {
+	indexes, err := ParseHDPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := k
+	for _, index := range indexes {
+		if key, err = key.Child(index); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// Wallet returns the wallet holding the extended key's keypair
+func (k *ExtendedKey) Wallet() *Wallet {
+	curve := elliptic.P256()
+
+	private := ecdsa.PrivateKey{D: new(big.Int).Set(k.Key)}
+	private.PublicKey.Curve = curve
+	private.PublicKey.X, private.PublicKey.Y = curve.ScalarBaseMult(k.Key.FillBytes(make([]byte, 32)))
+
+	pub := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...)
+
+	return &Wallet{PrivateKey: private, PublicKey: pub, Path: k.Path}
+}
+
+// ParseHDPath parses a derivation path ("m/0'/1/2'") into child indexes
+func ParseHDPath(path string) ([]uint32, error) {
+	parts := strings.Split(strings.TrimSpace(path), "/")
+	if len(parts) == 0 || parts[0] != "m" {
+		return nil, fmt.Errorf("derivation path must start with m")
+	}
+
+	var indexes []uint32
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h")
+		part = strings.TrimRight(part, "'h")
+
+		index, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || uint32(index) >= HardenedOffset {
+			return nil, fmt.Errorf("invalid path component %q", part)
+		}
+
+		if hardened {
+			index += uint64(HardenedOffset)
+		}
+		indexes = append(indexes, uint32(index))
+	}
+
+	return indexes, nil
+}
+
+func formatHDIndex(index uint32) string {
+	if index >= HardenedOffset {
+		return fmt.Sprintf("%d'", index-HardenedOffset)
+	}
+	return fmt.Sprintf("%d", index)
+}
+
+// IsHD reports whether the wallet collection has a seed
+func (ws *Wallets) IsHD() bool {
+	return len(ws.HDSeed) > 0
+}
+
+// InitHD sets the seed of the wallet collection
+// A nil seed generates a new random one; an existing seed is never replaced
+func (ws *Wallets) InitHD(seed []byte) error {
+	if ws.IsHD() {
+		return fmt.Errorf("wallet already has an HD seed")
+	}
+
+	if seed == nil {
+		var err error
+		if seed, err = NewHDSeed(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := NewMasterKey(seed); err != nil {
+		return err
+	}
+
+	ws.HDSeed = seed
+	ws.HDNextIndex = 0
+	return nil
+}
+
+// AddHDWallet derives the next address from the seed
+func (ws *Wallets) AddHDWallet() (string, error) {
+	if !ws.IsHD() {
+		return "", fmt.Errorf("wallet has no HD seed")
+	}
+
+	parent, err := ws.hdParent()
+	if err != nil {
+		return "", err
+	}
+
+	for ws.HDNextIndex < HardenedOffset {
+		index := ws.HDNextIndex
+		ws.HDNextIndex++
+
+		child, err := parent.Child(index)
+		if err != nil {
+			continue // Invalid child, BIP32 moves on to the next index
+		}
+
+		wallet := child.Wallet()
+		wallet.CreatedAt = time.Now().Unix()
+		address := string(wallet.Address())
+		ws.Wallets[address] = wallet
+
+		return address, nil
+	}
+
+	return "", fmt.Errorf("HD address space exhausted")
+}
+
+// RestoreHD regenerates the first count derived addresses, and as many
+// change addresses, from a seed
+// Standalone (non-HD) keys already in the collection are kept
+func (ws *Wallets) RestoreHD(seed []byte, count int) ([]string, error) {
+	if ws.IsHD() {
+		return nil, fmt.Errorf("wallet already has an HD seed")
+	}
+	if err := ws.InitHD(seed); err != nil {
+		return nil, err
+	}
+
+	addresses := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		address, err := ws.AddHDWallet()
+		if err != nil {
+			return addresses, err
+		}
+		addresses = append(addresses, address)
+	}
+
+	// The seed does not record which address a change address belonged to,
+	// so change addresses come back as standalone ones
+	for i := 0; i < count; i++ {
+		address, err := ws.NewChangeAddress("")
+		if err != nil {
+			return addresses, err
+		}
+		addresses = append(addresses, address)
+	}
+
+	return addresses, nil
+}
+
+// hdParent derives the parent key of receive addresses
+func (ws *Wallets) hdParent() (*ExtendedKey, error) {
+	master, err := NewMasterKey(ws.HDSeed)
+	if err != nil {
+		return nil, err
+	}
+	return master.Derive(DefaultHDPath)
+}
@@ -0,0 +1,100 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Height index
+//
+// Every main chain block has a "height-" entry mapping its height (4 bytes,
+// big endian, so entries sort by height) to its hash. It is written and
+// deleted with the transaction index (see indexBlock), so it always covers
+// the heights 0 to the tip exactly.
+
+// heightIndexPrefix keys the height index, by height
+var heightIndexPrefix = []byte("height-")
+
+// ErrNoBlockAtHeight is returned for heights above the tip
+var ErrNoBlockAtHeight = errors.New("no main chain block at height")
+
+func heightIndexKey(height int) []byte {
+	return binary.BigEndian.AppendUint32(append([]byte{}, heightIndexPrefix...), uint32(height))
+}
+
+// MainChainHashAt returns the hash of the main chain block at height
+func (chain *Blockchain) MainChainHashAt(height int) ([]byte, error) {
+	if height < 0 {
+		return nil, fmt.Errorf("%w %d", ErrNoBlockAtHeight, height)
+	}
+
+	hash, err := chain.Database.Get(heightIndexKey(height), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, fmt.Errorf("%w %d", ErrNoBlockAtHeight, height)
+	}
+	return hash, err
+}
+
+// GetBlockByHeight retrieves the main chain block at height
+func (chain *Blockchain) GetBlockByHeight(height int) (Block, error) {
+	hash, err := chain.MainChainHashAt(height)
+	if err != nil {
+		return Block{}, err
+	}
+	return chain.GetBlock(hash)
+}
+
+// MainChainHashesFrom returns the hashes of the main chain blocks from height
+// to the tip, tip first like GetBlockHashes
+func (chain *Blockchain) MainChainHashesFrom(height int) ([][]byte, error) {
+	height = max(height, 0)
+	iter := chain.Database.NewIterator(&util.Range{
+		Start: heightIndexKey(height),
+		Limit: util.BytesPrefix(heightIndexPrefix).Limit,
+	}, nil)
+	defer iter.Release()
+
+	var hashes [][]byte
+	for iter.Next() {
+		hashes = append(hashes, append([]byte{}, iter.Value()...))
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(hashes)-1; i < j; i, j = i+1, j-1 {
+		hashes[i], hashes[j] = hashes[j], hashes[i]
+	}
+	return hashes, nil
+}
+
+// buildHeightIndex indexes every main chain block of a database written
+// before the index existed
+func buildHeightIndex(db *leveldb.DB) error {
+	hash, err := db.Get([]byte("lh"), nil)
+	if err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	for len(hash) > 0 {
+		data, err := db.Get(hash, nil)
+		if err != nil {
+			return fmt.Errorf("block %x: %v", hash, err)
+		}
+		block := Deserialize(data)
+		batch.Put(heightIndexKey(block.Height), block.Hash)
+		hash = block.PrevHash
+	}
+
+	return db.Write(batch, nil)
+}
+
+// dropHeightIndex deletes the height index
+func dropHeightIndex(db *leveldb.DB) error {
+	return deleteByPrefix(db, heightIndexPrefix)
+}
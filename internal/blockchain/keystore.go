@@ -0,0 +1,242 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Keystore file format
+//
+// Wallets are stored as a versioned JSON document (wallets.json) instead of
+// the gob-encoded wallets.dat, which could not be decoded anymore whenever the
+// Wallet struct changed. Unknown fields are ignored and missing ones keep their
+// zero value, so fields can be added without a new version; a version bump is
+// only needed when an existing field changes meaning.
+//
+// A legacy wallets.dat is migrated on first load and kept as wallets.dat.bak.
+const (
+	KeystoreVersion  = 1
+	keystoreFile     = "wallets.json"
+	legacyWalletFile = "wallets.dat"
+)
+
+// keystore is the JSON document stored in wallets.json
+type keystore struct {
+	Version           int               `json:"version"`
+	HDSeed            string            `json:"hd_seed,omitempty"` // Hex, empty = standalone keys only
+	HDNextIndex       uint32            `json:"hd_next_index,omitempty"`
+	HDNextChangeIndex uint32            `json:"hd_next_change_index,omitempty"`
+	Keys              []keystoreKey     `json:"keys"`
+	Multisig          map[string]string `json:"multisig,omitempty"` // Address -> hex redeem script
+	Frozen            []string          `json:"frozen,omitempty"`   // Frozen outpoints, "txid:out"
+}
+
+// keystoreKey is one key pair and its metadata
+type keystoreKey struct {
+	Address    string `json:"address"`
+	PrivateKey string `json:"private_key"` // Hex scalar, the public point is derived from it
+	PublicKey  string `json:"public_key"`  // Hex, as hashed into the address
+	Path       string `json:"path,omitempty"`
+	Label      string `json:"label,omitempty"`
+	Note       string `json:"note,omitempty"`
+	CreatedAt  int64  `json:"created_at,omitempty"`
+	ChangeOf   string `json:"change_of,omitempty"`
+}
+
+// encodeKeystore converts the wallets to the keystore document
+func (ws *Wallets) encodeKeystore() *keystore {
+	ks := &keystore{
+		Version:           KeystoreVersion,
+		HDSeed:            hex.EncodeToString(ws.HDSeed),
+		HDNextIndex:       ws.HDNextIndex,
+		HDNextChangeIndex: ws.HDNextChangeIndex,
+		Keys:              make([]keystoreKey, 0, len(ws.Wallets)),
+	}
+
+	for address, wallet := range ws.Wallets {
+		ks.Keys = append(ks.Keys, keystoreKey{
+			Address:    address,
+			PrivateKey: hex.EncodeToString(wallet.PrivateKey.D.Bytes()),
+			PublicKey:  hex.EncodeToString(wallet.PublicKey),
+			Path:       wallet.Path,
+			Label:      wallet.Label,
+			Note:       wallet.Note,
+			CreatedAt:  wallet.CreatedAt,
+			ChangeOf:   wallet.ChangeOf,
+		})
+	}
+	// Stable order keeps the file diffable
+	sort.Slice(ks.Keys, func(i, j int) bool {
+		return ks.Keys[i].Address < ks.Keys[j].Address
+	})
+
+	if len(ws.Multisig) > 0 {
+		ks.Multisig = make(map[string]string, len(ws.Multisig))
+		for address, script := range ws.Multisig {
+			ks.Multisig[address] = hex.EncodeToString(script)
+		}
+	}
+
+	for _, op := range ws.Frozen.List() {
+		ks.Frozen = append(ks.Frozen, op.String())
+	}
+
+	return ks
+}
+
+// decodeKeystore restores the wallets from a keystore document
+func (ws *Wallets) decodeKeystore(ks *keystore) error {
+	if ks.Version < 1 || ks.Version > KeystoreVersion {
+		return fmt.Errorf("unsupported keystore version %d (supported: %d)", ks.Version, KeystoreVersion)
+	}
+
+	seed, err := hex.DecodeString(ks.HDSeed)
+	if err != nil {
+		return fmt.Errorf("invalid HD seed: %w", err)
+	}
+
+	wallets := make(map[string]*Wallet, len(ks.Keys))
+	for _, key := range ks.Keys {
+		wallet, err := key.wallet()
+		if err != nil {
+			return fmt.Errorf("key %s: %w", key.Address, err)
+		}
+		if address := string(wallet.Address()); address != key.Address {
+			return fmt.Errorf("key %s: public key belongs to %s", key.Address, address)
+		}
+		wallets[key.Address] = wallet
+	}
+
+	multisig := make(map[string][]byte, len(ks.Multisig))
+	for address, script := range ks.Multisig {
+		if multisig[address], err = hex.DecodeString(script); err != nil {
+			return fmt.Errorf("multisig %s: %w", address, err)
+		}
+	}
+
+	frozen := NewFrozenOutputs()
+	for _, s := range ks.Frozen {
+		op, err := ParseOutpoint(s)
+		if err != nil {
+			return fmt.Errorf("frozen outputs: %w", err)
+		}
+		frozen.Freeze(op)
+	}
+
+	ws.Wallets = wallets
+	ws.Frozen = frozen
+	ws.HDSeed = seed
+	ws.HDNextIndex = ks.HDNextIndex
+	ws.HDNextChangeIndex = ks.HDNextChangeIndex
+	ws.Multisig = multisig
+	if len(seed) == 0 {
+		ws.HDSeed = nil
+	}
+
+	return nil
+}
+
+// wallet rebuilds the key pair from its private scalar
+func (key keystoreKey) wallet() (*Wallet, error) {
+	d, err := hex.DecodeString(key.PrivateKey)
+	if err != nil || len(d) == 0 || len(d) > 32 {
+		return nil, fmt.Errorf("invalid private key")
+	}
+	publicKey, err := hex.DecodeString(key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key")
+	}
+
+	curve := elliptic.P256()
+	wallet := &Wallet{
+		PublicKey: publicKey,
+		Path:      key.Path,
+		Label:     key.Label,
+		Note:      key.Note,
+		CreatedAt: key.CreatedAt,
+		ChangeOf:  key.ChangeOf,
+	}
+	wallet.PrivateKey.PublicKey.Curve = curve
+	wallet.PrivateKey.D = new(big.Int).SetBytes(d)
+	wallet.PrivateKey.X, wallet.PrivateKey.Y = curve.ScalarBaseMult(wallet.PrivateKey.D.FillBytes(make([]byte, 32)))
+
+	if !bytes.Equal(publicKey, append(wallet.PrivateKey.X.Bytes(), wallet.PrivateKey.Y.Bytes()...)) {
+		return nil, fmt.Errorf("public key does not match the private key")
+	}
+
+	return wallet, nil
+}
+
+// loadKeystore reads wallets.json
+func (ws *Wallets) loadKeystore(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var ks keystore
+	if err := json.Unmarshal(content, &ks); err != nil {
+		return fmt.Errorf("invalid keystore %s: %w", path, err)
+	}
+
+	return ws.decodeKeystore(&ks)
+}
+
+// saveKeystore writes wallets.json atomically, readable by the owner only
+func (ws *Wallets) saveKeystore(path string) error {
+	content, err := json.MarshalIndent(ws.encodeKeystore(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// migrateLegacyWallets loads a gob-encoded wallets.dat, rewrites it as a
+// keystore and keeps the legacy file as a backup
+func (ws *Wallets) migrateLegacyWallets(dir string) error {
+	legacyPath := filepath.Join(dir, legacyWalletFile)
+
+	content, err := os.ReadFile(legacyPath)
+	if err != nil {
+		return err
+	}
+
+	var legacy Wallets
+	if err := gob.NewDecoder(bytes.NewReader(content)).Decode(&legacy); err != nil {
+		return fmt.Errorf("invalid legacy wallet file %s: %w", legacyPath, err)
+	}
+
+	ws.Wallets = legacy.Wallets
+	ws.HDSeed = legacy.HDSeed
+	ws.HDNextIndex = legacy.HDNextIndex
+	ws.Multisig = legacy.Multisig
+	ws.Frozen = NewFrozenOutputs()
+	if ws.Wallets == nil {
+		ws.Wallets = make(map[string]*Wallet)
+	}
+
+	if err := ws.saveKeystore(filepath.Join(dir, keystoreFile)); err != nil {
+		return fmt.Errorf("migrating %s: %w", legacyPath, err)
+	}
+	if err := os.Rename(legacyPath, legacyPath+".bak"); err != nil {
+		log.Printf("⚠️  Could not rename migrated %s: %v", legacyPath, err)
+	}
+
+	log.Printf("🔑 Migrated %d key(s) from %s to the %s keystore (backup kept as %s.bak)", len(ws.Wallets), legacyWalletFile, keystoreFile, legacyWalletFile)
+	return nil
+}
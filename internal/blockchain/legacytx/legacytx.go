@@ -0,0 +1,31 @@
+// Package blockchain (imported as legacytx) holds the original transaction
+// types, used to serialize transactions that predate input sequence numbers
+//
+// Transactions are hashed from their gob encoding, which includes the type
+// and field names. Adding TXInput.Sequence changed that encoding, so
+// transactions without sequence numbers are encoded with these copies of the
+// original types to keep their hashes, signatures and merkle roots unchanged.
+// The package and type names must stay exactly as they are: gob writes them
+// into the encoding.
+package blockchain
+
+// Transaction is the original transaction layout
+type Transaction struct {
+	ID      []byte
+	Inputs  []TXInput
+	Outputs []TXOutput
+}
+
+// TXInput is the original input layout, without Sequence
+type TXInput struct {
+	ID        []byte
+	Out       int
+	Signature []byte
+	PubKey    []byte
+}
+
+// TXOutput is the original output layout
+type TXOutput struct {
+	Value      int
+	PubKeyHash []byte
+}
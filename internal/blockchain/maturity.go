@@ -0,0 +1,106 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"log"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Balance is the breakdown of the unspent outputs of an address
+type Balance struct {
+	Total     int // Every unspent output
+	Spendable int // What the wallet may spend: Total minus Immature and Frozen
+	Immature  int // Mining rewards younger than the coinbase maturity
+	Frozen    int // Outputs frozen with lockunspent
+}
+
+// ImmatureCoinbases returns the coinbase transactions the wallet may not spend
+// yet, by hex ID, with the height of the first block that may spend them
+//
+// A coinbase mined at height h matures at h+CoinbaseMaturity. This is a
+// local wallet policy, not a consensus rule: when a reorg drops the block, its
+// reward vanishes and every transaction spending it becomes invalid, so the
+// wallet waits until the reward is buried deep enough.
+func (chain *Blockchain) ImmatureCoinbases() map[string]int {
+	immature := make(map[string]int)
+	if chain.CoinbaseMaturity <= 0 {
+		return immature
+	}
+
+	nextHeight := chain.GetBestHeight() + 1
+	iter := chain.Iterator()
+	for {
+		block := iter.Next()
+		if block.Height+chain.CoinbaseMaturity <= nextHeight {
+			break
+		}
+
+		for _, tx := range block.Transactions {
+			if tx.IsCoinbase() {
+				immature[hex.EncodeToString(tx.ID)] = block.Height + chain.CoinbaseMaturity
+			}
+		}
+
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	return immature
+}
+
+// BalanceContext returns the combined balance breakdown of public key hashes,
+// giving up once ctx is done
+func (chain *Blockchain) BalanceContext(ctx context.Context, pubKeyHashes ...[]byte) (Balance, error) {
+	var balance Balance
+	immature := chain.ImmatureCoinbases()
+
+	iter := chain.Database.NewIterator(util.BytesPrefix(utxoPrefix), nil)
+	defer iter.Release()
+
+	for entries := 0; iter.Next(); entries++ {
+		if entries%cancelCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return Balance{}, err
+			}
+		}
+
+		txID := hex.EncodeToString(bytes.TrimPrefix(iter.Key(), utxoPrefix))
+		outs := DeserializeOutputs(iter.Value())
+
+		for i, out := range outs.Outputs {
+			if !lockedWithAnyKey(out, pubKeyHashes) {
+				continue
+			}
+
+			balance.Total += out.Value
+			switch _, young := immature[txID]; {
+			case young:
+				balance.Immature += out.Value
+			case chain.Frozen.Contains(txID, outs.Index(i)):
+				balance.Frozen += out.Value
+			default:
+				balance.Spendable += out.Value
+			}
+		}
+	}
+
+	if err := iter.Error(); err != nil {
+		log.Panic(err)
+	}
+
+	return balance, nil
+}
+
+// lockedWithAnyKey reports whether out can be spent by one of the public key hashes
+func lockedWithAnyKey(out TXOutput, pubKeyHashes [][]byte) bool {
+	for _, pubKeyHash := range pubKeyHashes {
+		if out.IsLockedWithKey(pubKeyHash) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,312 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// m-of-n multisignature outputs
+//
+// A multisig output is locked with the SHA-256 of a redeem script listing
+// the threshold m and the n public keys. Its 32-byte lock distinguishes it
+// from the 20-byte hash of single-key outputs. The spending input carries
+// the redeem script in PubKey and at least m signatures in Signature:
+//   script:     marker || m || n || n * (len || pubkey), keys sorted
+//   signatures: k * (key index || len || r||s), ascending key index
+// Transaction and output encodings are unchanged, so legacy transactions
+// keep their hashes and signatures.
+
+const (
+	// MaxMultisigKeys is the maximum number of keys of a multisig script
+	MaxMultisigKeys = 16
+
+	multisigMarker     = byte(0x4d)
+	multisigVersion    = byte(0x05) // Address version of multisig addresses
+	multisigHashLength = sha256.Size
+)
+
+// NewMultisigScript builds the redeem script requiring m signatures of pubKeys
+// Keys are sorted so every participant derives the same script and address
+func NewMultisigScript(m int, pubKeys [][]byte) ([]byte, error) {
+	n := len(pubKeys)
+	if n == 0 || n > MaxMultisigKeys {
+		return nil, fmt.Errorf("multisig needs 1 to %d keys, got %d", MaxMultisigKeys, n)
+	}
+	if m < 1 || m > n {
+		return nil, fmt.Errorf("threshold %d is not between 1 and %d", m, n)
+	}
+
+	sorted := make([][]byte, n)
+	copy(sorted, pubKeys)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i], sorted[j]) < 0
+	})
+
+	script := []byte{multisigMarker, byte(m), byte(n)}
+	for i, pubKey := range sorted {
+		if len(pubKey) == 0 || len(pubKey) > 255 {
+			return nil, fmt.Errorf("invalid public key %d", i)
+		}
+		if i > 0 && bytes.Equal(pubKey, sorted[i-1]) {
+			return nil, fmt.Errorf("duplicate public key %x", pubKey)
+		}
+		script = append(script, byte(len(pubKey)))
+		script = append(script, pubKey...)
+	}
+
+	return script, nil
+}
+
+// ParseMultisigScript returns the threshold and keys of a redeem script
+func ParseMultisigScript(script []byte) (int, [][]byte, error) {
+	if len(script) < 3 || script[0] != multisigMarker {
+		return 0, nil, fmt.Errorf("not a multisig script")
+	}
+
+	m, n := int(script[1]), int(script[2])
+	if n == 0 || n > MaxMultisigKeys || m < 1 || m > n {
+		return 0, nil, fmt.Errorf("invalid multisig threshold %d of %d", m, n)
+	}
+
+	pubKeys := make([][]byte, 0, n)
+	rest := script[3:]
+	for i := 0; i < n; i++ {
+		if len(rest) == 0 || len(rest) < 1+int(rest[0]) || rest[0] == 0 {
+			return 0, nil, fmt.Errorf("truncated multisig script")
+		}
+		pubKeys = append(pubKeys, rest[1:1+int(rest[0])])
+		rest = rest[1+int(rest[0]):]
+	}
+	if len(rest) != 0 {
+		return 0, nil, fmt.Errorf("trailing data in multisig script")
+	}
+
+	return m, pubKeys, nil
+}
+
+// IsMultisigScript reports whether an input PubKey holds a multisig redeem script
+func IsMultisigScript(data []byte) bool {
+	_, _, err := ParseMultisigScript(data)
+	return err == nil
+}
+
+// MultisigScriptHash returns the lock of outputs paying to a redeem script
+func MultisigScriptHash(script []byte) []byte {
+	hash := sha256.Sum256(script)
+	return hash[:]
+}
+
+// MultisigAddress returns the shared address of a redeem script
+func MultisigAddress(script []byte) string {
+	return string(PubKeyHashToAddress(MultisigScriptHash(script)))
+}
+
+// IsMultisigAddress reports whether an address pays to a multisig script
+func IsMultisigAddress(address string) bool {
+	return ValidateAddress(address) && len(addressPubKeyHash(address)) == multisigHashLength
+}
+
+// MultisigKeyIndex returns the position of pubKey in a redeem script (-1 if absent)
+func MultisigKeyIndex(script, pubKey []byte) int {
+	_, pubKeys, err := ParseMultisigScript(script)
+	if err != nil {
+		return -1
+	}
+	for i, key := range pubKeys {
+		if bytes.Equal(key, pubKey) {
+			return i
+		}
+	}
+	return -1
+}
+
+// decodeMultisigSignatures splits an input signature into key index -> signature
+func decodeMultisigSignatures(data []byte) (map[int][]byte, error) {
+	signatures := make(map[int][]byte)
+	last := -1
+
+	for len(data) > 0 {
+		if len(data) < 2 || len(data) < 2+int(data[1]) || data[1] == 0 {
+			return nil, fmt.Errorf("truncated multisig signatures")
+		}
+		index := int(data[0])
+		if index <= last {
+			return nil, fmt.Errorf("multisig signatures out of order")
+		}
+		signatures[index] = data[2 : 2+int(data[1])]
+		last = index
+		data = data[2+int(data[1]):]
+	}
+
+	return signatures, nil
+}
+
+// encodeMultisigSignatures serializes key index -> signature in ascending key order
+func encodeMultisigSignatures(signatures map[int][]byte) []byte {
+	indexes := make([]int, 0, len(signatures))
+	for index := range signatures {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	var data []byte
+	for _, index := range indexes {
+		data = append(data, byte(index), byte(len(signatures[index])))
+		data = append(data, signatures[index]...)
+	}
+	return data
+}
+
+// MultisigSignatureCount returns how many partial signatures an input holds
+func MultisigSignatureCount(signature []byte) int {
+	signatures, err := decodeMultisigSignatures(signature)
+	if err != nil {
+		return 0
+	}
+	return len(signatures)
+}
+
+// AddMultisigSignature adds the partial signature of key keyIndex to a multisig input
+// The signature is checked against the signature hash before it is stored
+func (tx *Transaction) AddMultisigSignature(inId, keyIndex int, signature []byte, prevTXs map[string]Transaction) error {
+	in := tx.Inputs[inId]
+	_, pubKeys, err := ParseMultisigScript(in.PubKey)
+	if err != nil {
+		return fmt.Errorf("input %d: %v", inId, err)
+	}
+	if keyIndex < 0 || keyIndex >= len(pubKeys) {
+		return fmt.Errorf("input %d has no key %d", inId, keyIndex)
+	}
+	if len(signature) == 0 || len(signature) > 255 {
+		return fmt.Errorf("invalid signature length %d", len(signature))
+	}
+	if !tx.VerifyInputSignature(inId, signature, pubKeys[keyIndex], prevTXs) {
+		return fmt.Errorf("invalid signature of key %d for input %d", keyIndex, inId)
+	}
+
+	signatures, err := decodeMultisigSignatures(in.Signature)
+	if err != nil {
+		return fmt.Errorf("input %d: %v", inId, err)
+	}
+	signatures[keyIndex] = signature
+	tx.Inputs[inId].Signature = encodeMultisigSignatures(signatures)
+
+	return nil
+}
+
+// SignMultisigInput adds the partial signature of signer to a multisig input
+func (tx *Transaction) SignMultisigInput(inId int, signer Signer, prevTXs map[string]Transaction) error {
+	keyIndex := MultisigKeyIndex(tx.Inputs[inId].PubKey, signer.PublicKey())
+	if keyIndex < 0 {
+		return fmt.Errorf("key is not part of the multisig script of input %d", inId)
+	}
+
+	signature, err := signer.SignHash(tx.SignatureHash(inId, prevTXs))
+	if err != nil {
+		return err
+	}
+
+	return tx.AddMultisigSignature(inId, keyIndex, signature, prevTXs)
+}
+
+// verifyMultisigInput checks that input inId reveals the script locking the
+// spent output and carries at least m valid signatures from distinct keys
+func (tx *Transaction) verifyMultisigInput(inId int, prevTXs map[string]Transaction) bool {
+	in := tx.Inputs[inId]
+	prevTX := prevTXs[hex.EncodeToString(in.ID)]
+	if in.Out < 0 || in.Out >= len(prevTX.Outputs) {
+		return false
+	}
+	if !bytes.Equal(MultisigScriptHash(in.PubKey), prevTX.Outputs[in.Out].PubKeyHash) {
+		return false
+	}
+
+	m, pubKeys, err := ParseMultisigScript(in.PubKey)
+	if err != nil {
+		return false
+	}
+
+	signatures, err := decodeMultisigSignatures(in.Signature)
+	if err != nil || len(signatures) < m {
+		return false
+	}
+
+	for keyIndex, signature := range signatures {
+		if keyIndex >= len(pubKeys) || !tx.VerifyInputSignature(inId, signature, pubKeys[keyIndex], prevTXs) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// NewMultisigTransaction builds an unsigned transaction spending from a
+// multisig script; change returns to the multisig address
+// Cosigners add their partial signatures with SignMultisigInput or AddMultisigSignature
+func NewMultisigTransaction(script []byte, recipients []Recipient, chain *Blockchain) (*Transaction, error) {
+	if _, _, err := ParseMultisigScript(script); err != nil {
+		return nil, err
+	}
+
+	amount := 0
+	for _, recipient := range recipients {
+		amount += recipient.Amount
+	}
+
+	address := MultisigAddress(script)
+	acc, validOutputs := chain.FindSpendableOutputs(MultisigScriptHash(script), amount)
+	if acc < amount {
+		return nil, fmt.Errorf("%w in %s: have %d, need %d", ErrInsufficientFunds, address, acc, amount)
+	}
+
+	var inputs []TXInput
+	for txid, outs := range validOutputs {
+		txID, err := hex.DecodeString(txid)
+		if err != nil {
+			return nil, err
+		}
+		for _, out := range outs {
+			inputs = append(inputs, TXInput{txID, out, nil, script, SequenceFinal})
+		}
+	}
+
+	var outputs []TXOutput
+	for _, recipient := range recipients {
+		outputs = append(outputs, *NewTXOutput(recipient.Amount, recipient.Address))
+	}
+	if acc > amount {
+		outputs = append(outputs, *NewTXOutput(acc-amount, address))
+	}
+
+	tx := Transaction{nil, inputs, outputs}
+	tx.ID = tx.Hash()
+
+	return &tx, nil
+}
+
+// LockingHash returns the output lock the input claims to spend: the hash of
+// its public key, or the script hash for multisig inputs
+func (in *TXInput) LockingHash() []byte {
+	if IsMultisigScript(in.PubKey) {
+		return MultisigScriptHash(in.PubKey)
+	}
+	return HashPubKey(in.PubKey)
+}
+
+// AddMultisig registers a multisig script with the wallet and returns its address
+func (ws *Wallets) AddMultisig(script []byte) (string, error) {
+	if _, _, err := ParseMultisigScript(script); err != nil {
+		return "", err
+	}
+
+	if ws.Multisig == nil {
+		ws.Multisig = make(map[string][]byte)
+	}
+
+	address := MultisigAddress(script)
+	ws.Multisig[address] = script
+	return address, nil
+}
@@ -0,0 +1,11 @@
+package blockchain
+
+import "syscall"
+
+const lowPrioritySupported = true
+
+// lowerThreadPriority sets the nice value of the calling thread to 19, the
+// lowest priority. Linux applies it to the thread alone
+func lowerThreadPriority() error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, syscall.Gettid(), 19)
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package blockchain
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Other systems set the priority of the whole process, not of one thread
+const lowPrioritySupported = false
+
+func lowerThreadPriority() error {
+	return fmt.Errorf("not supported on %s", runtime.GOOS)
+}
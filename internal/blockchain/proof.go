@@ -10,7 +10,15 @@ import (
 	"time"
 )
 
-// Difficulty is now defined in config.go
+// The difficulty of each network is ChainParams.Difficulty, see
+// RequiredDifficulty in chainparams.go
+
+// Difficulty bounds: the target 2^(256-difficulty) must fit in 256 bits and
+// leave at least one valid hash
+const (
+	MinDifficulty = 1
+	MaxDifficulty = 255
+)
 
 type ProofOfWork struct {
 	Block      *Block
@@ -19,7 +27,7 @@ type ProofOfWork struct {
 }
 
 func NewProof(b *Block) *ProofOfWork {
-	return NewProofWithDifficulty(b, Difficulty)
+	return NewProofWithDifficulty(b, Params().Difficulty)
 }
 
 func NewProofWithDifficulty(b *Block, difficulty int) *ProofOfWork {
@@ -42,10 +50,17 @@ func (pow *ProofOfWork) InitData(nonce int) []byte {
 	diffBytes := toHex(int64(pow.Block.Difficulty))
 	timeBytes := toHex(pow.Block.Timestamp)
 
+	var versionBytes []byte
+	if pow.Block.Version != 0 {
+		versionBytes = toHex(int64(pow.Block.Version)) // Absent in legacy blocks, so their hashes are unchanged
+	}
+
 	data := bytes.Join(
 		[][]byte{
+			versionBytes,
 			pow.Block.PrevHash,
 			pow.Block.MerkleRoot, // Use stored Merkle Root
+			pow.Block.UTXORoot,   // Empty in legacy blocks, so their hashes are unchanged
 			nonceBytes,
 			diffBytes,
 			timeBytes,
@@ -62,8 +77,10 @@ func (pow *ProofOfWork) DebugInitData(nonce int) {
 	timeBytes := toHex(pow.Block.Timestamp)
 
 	log.Printf("🔍 InitData components:")
+	log.Printf("   Version: %#x", pow.Block.Version)
 	log.Printf("   PrevHash: %x", pow.Block.PrevHash)
 	log.Printf("   MerkleRoot (stored): %x", pow.Block.MerkleRoot)
+	log.Printf("   UTXORoot: %x", pow.Block.UTXORoot)
 	log.Printf("   Nonce: %d (%x)", nonce, nonceBytes)
 	log.Printf("   Difficulty: %d (%x)", pow.Block.Difficulty, diffBytes)
 	log.Printf("   Timestamp: %d (%x)", pow.Block.Timestamp, timeBytes)
@@ -73,20 +90,59 @@ func (pow *ProofOfWork) Run() (int, []byte) {
 	return pow.RunWithInterrupt(nil)
 }
 
+// RunWithInterrupt searches a nonce until the target is met or interrupt
+// fires, within the limits of the mining throttle
 func (pow *ProofOfWork) RunWithInterrupt(interrupt <-chan bool) (int, []byte) {
+	throttle := GetMiningThrottle()
+	if throttle.LowPriority {
+		return runLowPriority(func() (int, []byte) { return pow.run(interrupt, throttle) })
+	}
+	return pow.run(interrupt, throttle)
+}
+
+func (pow *ProofOfWork) run(interrupt <-chan bool, throttle MiningThrottle) (int, []byte) {
 	var intHash big.Int
 	var hash [32]byte
 
 	nonce := 0
+	counted := 0 // Nonces already reported to the hash meter
+	started := time.Now()
+	defer func() {
+		localHashMeter.add(nonce-counted, time.Since(started))
+	}()
+
 	checkInterval := 10000    // Check for interrupts every 10k iterations
 	logInterval := 100000     // Log progress every 100k hashes
 	timestampInterval := 1000 // Update timestamp every 1k iterations
+	chunkStarted := time.Now()
 
 	for nonce < math.MaxInt64 {
+		if nonce > 0 && nonce%timestampInterval == 0 {
+			// Rest as long as the throttle requires after every chunk of hashes
+			if rest := throttle.pause(timestampInterval, time.Since(chunkStarted)); rest > 0 {
+				select {
+				case <-interrupt:
+					log.Printf("⛏️  Mining interrupted at nonce %d", nonce)
+					return 0, nil
+				case <-time.After(rest):
+				}
+			}
+			chunkStarted = time.Now()
+
+			// Report progress to the hash meter, so long runs show in the hashrate
+			if time.Since(started) >= time.Second {
+				localHashMeter.add(nonce-counted, time.Since(started))
+				counted, started = nonce, time.Now()
+			}
+		}
+
 		// Update timestamp periodically (every ~1k hashes) to keep it current
+		// It only moves forward: the candidate's timestamp is the earliest
+		// valid one (past the median time past), and the hash always covers
+		// the timestamp the block is stored with
 		// Uses UTC to ensure consistency across different timezones
 		if nonce%timestampInterval == 0 {
-			pow.Block.Timestamp = time.Now().UTC().Unix()
+			pow.Block.Timestamp = max(pow.Block.Timestamp, time.Now().UTC().Unix())
 		}
 
 		// Check for interrupt signal periodically
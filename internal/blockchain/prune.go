@@ -0,0 +1,176 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Block storage pruning
+//
+// A pruning node keeps the full data of the last PruneDepth main chain blocks
+// only. Older blocks are rewritten with their header and the transactions
+// that still have unspent outputs: spending them needs the previous
+// transaction and the height of its block. The undo data of pruned blocks is
+// deleted: reorganizations cannot reach below the finalized height.
+
+// prunedHeightKey stores the height up to which main chain blocks are pruned
+var prunedHeightKey = []byte("prunedheight")
+
+// ErrPruned is returned for operations needing block data a pruning node deleted
+var ErrPruned = errors.New("block data pruned")
+
+// PrunedHeight returns the height up to which main chain blocks are pruned
+// (-1 when no block is)
+func (chain *Blockchain) PrunedHeight() int {
+	data, err := chain.Database.Get(prunedHeightKey, nil)
+	if err != nil {
+		return -1
+	}
+	height, err := strconv.Atoi(string(data))
+	if err != nil {
+		return -1
+	}
+	return height
+}
+
+// IsPruned reports whether the block at height only keeps its header and the
+// transactions with unspent outputs
+func (chain *Blockchain) IsPruned(height int) bool {
+	return height <= chain.PrunedHeight()
+}
+
+// pruning reports whether blocks are pruned or will be
+func (chain *Blockchain) pruning() bool {
+	return chain.PruneDepth > 0 || chain.PrunedHeight() >= 0
+}
+
+// EnablePruning keeps the full data of the last depth blocks only and prunes
+// the older ones
+// Reorganizations down to the finalized height must remain possible, so depth
+// may not be below the finality depth
+func (chain *Blockchain) EnablePruning(depth int) error {
+	if chain.FinalityDepth <= 0 {
+		return fmt.Errorf("pruning requires finality: reorganizations could reach pruned blocks")
+	}
+	if depth < chain.FinalityDepth {
+		return fmt.Errorf("prune depth %d is below the finality depth %d: reorganizations could reach pruned blocks", depth, chain.FinalityDepth)
+	}
+
+	chain.state.Lock()
+	defer chain.state.Unlock()
+
+	// Blocks connected by older versions have no undo data; their spent
+	// outputs are still found in the chain as long as it is not pruned
+	tip, err := chain.GetBlock(chain.LastHash)
+	if err != nil {
+		return err
+	}
+	block := &tip
+	for block.Height > tip.Height-depth && !chain.IsPruned(block.Height) && len(block.PrevHash) > 0 {
+		if _, err := chain.Database.Get(undoKey(block.Hash), nil); err == leveldb.ErrNotFound {
+			undo, err := chain.blockUndo(block)
+			if err != nil {
+				return fmt.Errorf("undo data of block %d: %w", block.Height, err)
+			}
+			data, err := encodeUndo(undo)
+			if err != nil {
+				return err
+			}
+			if err := chain.Database.Put(undoKey(block.Hash), data, nil); err != nil {
+				return err
+			}
+		}
+
+		parent, err := chain.GetBlock(block.PrevHash)
+		if err != nil {
+			return err
+		}
+		block = &parent
+	}
+
+	chain.PruneDepth = depth
+	return chain.pruneBlocks()
+}
+
+// pruneBlocks prunes the main chain blocks below the last PruneDepth blocks
+// The caller must hold the state lock
+func (chain *Blockchain) pruneBlocks() error {
+	if chain.PruneDepth <= 0 {
+		return nil
+	}
+
+	tip, err := chain.GetBlock(chain.LastHash)
+	if err != nil {
+		return err
+	}
+	target := tip.Height - chain.PruneDepth
+	pruned := chain.PrunedHeight()
+	if target <= pruned {
+		return nil
+	}
+
+	// Recorded first: blocks left unpruned by a crash are only not served
+	if err := chain.Database.Put(prunedHeightKey, []byte(strconv.Itoa(target)), nil); err != nil {
+		return err
+	}
+
+	count := 0
+	block := &tip
+	for block.Height > pruned {
+		if block.Height <= target {
+			if err := chain.pruneBlock(block); err != nil {
+				return err
+			}
+			count++
+		}
+
+		if len(block.PrevHash) == 0 {
+			break
+		}
+		parent, err := chain.GetBlock(block.PrevHash)
+		if err != nil {
+			return err
+		}
+		block = &parent
+	}
+
+	// Deleted data only frees disk space once compacted, at once after a bulk prune
+	if count > 1 {
+		log.Printf("✂️  Pruned %d blocks up to height %d", count, target)
+		if err := chain.Database.CompactRange(util.Range{}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pruneBlock rewrites a block with its header and the transactions that still
+// have unspent outputs, and deletes its undo data
+// Index entries of the dropped transactions are deleted, the kept ones move
+// to their new offset
+func (chain *Blockchain) pruneBlock(block *Block) error {
+	batch := new(leveldb.Batch)
+
+	var kept []*Transaction
+	for _, tx := range block.Transactions {
+		if ok, err := chain.Database.Has(append(utxoPrefix, tx.ID...), nil); err == nil && ok {
+			kept = append(kept, tx)
+		} else {
+			batch.Delete(txIndexKey(tx.ID))
+		}
+	}
+
+	pruned := *block
+	pruned.Transactions = kept
+
+	batch.Put(block.Hash, pruned.Serialize())
+	batch.Delete(undoKey(block.Hash))
+	indexTransactions(batch, &pruned)
+	return chain.Database.Write(batch, nil)
+}
@@ -0,0 +1,37 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Hex returns the hex encoded serialization of the transaction
+// The serialization is deterministic: a fresh gob encoder writes the type
+// definitions then the fields in declaration order, and a transaction holds
+// no maps, so equal transactions always encode to the same bytes
+func (tx Transaction) Hex() string {
+	return hex.EncodeToString(tx.Serialize())
+}
+
+// DecodeTransactionHex decodes a transaction from its hex serialization
+// Only the canonical encoding produced by Hex is accepted, so a transaction
+// has a single raw form that external wallets can compare and store
+func DecodeTransactionHex(rawHex string) (*Transaction, error) {
+	rawHex = strings.ToLower(strings.TrimSpace(rawHex))
+
+	data, err := hex.DecodeString(rawHex)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := DecodeTransaction(data)
+	if err != nil {
+		return nil, err
+	}
+	if tx.Hex() != rawHex {
+		return nil, fmt.Errorf("transaction is not canonically encoded")
+	}
+
+	return tx, nil
+}
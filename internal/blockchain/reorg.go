@@ -0,0 +1,336 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// chainWorkPrefix keys the block index: cumulative work of the chain ending at a block
+var chainWorkPrefix = []byte("work-")
+
+var (
+	// ErrKnownBlock is returned for blocks that are already stored
+	ErrKnownBlock = errors.New("block already known")
+
+	// ErrOrphanBlock is returned for blocks whose parent is not stored (yet)
+	ErrOrphanBlock = errors.New("parent block unknown")
+
+	// ErrBadBlockLink is returned for blocks whose height does not follow their parent
+	ErrBadBlockLink = errors.New("block height does not follow its parent")
+
+	// ErrStaleSideChain is returned for side chain blocks whose branch trails
+	// the main chain by more work than it could make up (see sideChainReach)
+	ErrStaleSideChain = errors.New("side chain too far behind the main chain")
+)
+
+// Reorg describes how the main chain changed when a block was accepted
+// Extending the tip connects the block alone and disconnects nothing
+type Reorg struct {
+	Fork         *Block   // Last block common to the old and the new main chain
+	Disconnected []*Block // Old main chain blocks, old tip first
+	Connected    []*Block // New main chain blocks, lowest first
+}
+
+// blockWork is the exact work of a block at difficulty (2^difficulty hashes)
+// A difficulty out of bounds has no valid target and counts no work
+func blockWork(difficulty int) *big.Int {
+	if difficulty < MinDifficulty || difficulty > MaxDifficulty {
+		return new(big.Int)
+	}
+	return new(big.Int).Lsh(big.NewInt(1), uint(difficulty))
+}
+
+// maxSideChainLag is how many blocks of work a side chain block may trail the
+// main chain by and still be stored when finality is disabled
+const maxSideChainLag = 100
+
+// sideChainReach is the work a side chain may trail the main chain by: the
+// finality depth (branches further behind fork below the finalized height),
+// maxSideChainLag blocks without finality
+func (chain *Blockchain) sideChainReach() *big.Int {
+	lag := chain.FinalityDepth
+	if lag <= 0 {
+		lag = maxSideChainLag
+	}
+	return new(big.Int).Mul(big.NewInt(int64(lag)), blockWork(chain.Params.Difficulty))
+}
+
+func chainWorkKey(hash []byte) []byte {
+	return append(append([]byte{}, chainWorkPrefix...), hash...)
+}
+
+// HasBlock reports whether a block is stored, on the main chain or a side chain
+func (chain *Blockchain) HasBlock(hash []byte) bool {
+	ok, err := chain.Database.Has(hash, nil)
+	return err == nil && ok
+}
+
+// chainWork returns the cumulative work of the chain ending at a stored block
+// Blocks missing from the index (stored before it existed) are indexed on the way
+func (chain *Blockchain) chainWork(hash []byte) (*big.Int, error) {
+	var pending []*Block
+	work := new(big.Int)
+
+	for len(hash) > 0 {
+		if data, err := chain.Database.Get(chainWorkKey(hash), nil); err == nil {
+			work.SetBytes(data)
+			break
+		}
+
+		block, err := chain.GetBlock(hash)
+		if err != nil {
+			return nil, fmt.Errorf("block %x: %w", hash, err)
+		}
+		pending = append(pending, &block)
+		hash = block.PrevHash
+	}
+
+	for i := len(pending) - 1; i >= 0; i-- {
+		work.Add(work, blockWork(pending[i].Difficulty))
+		if err := chain.Database.Put(chainWorkKey(pending[i].Hash), work.Bytes(), nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return work, nil
+}
+
+// findFork walks back from two stored blocks to their last common ancestor
+// It returns the ancestor and the blocks above it on each branch, highest first
+func (chain *Blockchain) findFork(a, b []byte) (*Block, []*Block, []*Block, error) {
+	load := func(hash []byte) (*Block, error) {
+		block, err := chain.GetBlock(hash)
+		if err != nil {
+			return nil, fmt.Errorf("block %x: %w", hash, err)
+		}
+		return &block, nil
+	}
+
+	blockA, err := load(a)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	blockB, err := load(b)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var branchA, branchB []*Block
+	for !bytes.Equal(blockA.Hash, blockB.Hash) {
+		if blockA.Height >= blockB.Height {
+			branchA = append(branchA, blockA)
+			if blockA, err = load(blockA.PrevHash); err != nil {
+				return nil, nil, nil, err
+			}
+		} else {
+			branchB = append(branchB, blockB)
+			if blockB, err = load(blockB.PrevHash); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+	}
+
+	return blockA, branchA, branchB, nil
+}
+
+// AcceptBlock stores a block whose proof of work was checked and makes the
+// heaviest chain the main chain
+// A block extending the tip is connected; a block on a side chain is only
+// stored, if its branch is within reach of the tip, unless its chain carries
+// more cumulative work than the main chain: the main chain is then rolled
+// back to the fork and the side chain connected
+// It returns the resulting change of the main chain, nil when there was none
+func (chain *Blockchain) AcceptBlock(block *Block) (*Reorg, error) {
+	chain.state.Lock()
+	defer chain.state.Unlock()
+
+	if chain.HasBlock(block.Hash) {
+		return nil, fmt.Errorf("%w: %x", ErrKnownBlock, block.Hash)
+	}
+
+	// Context-free checks first: side chain blocks and orphans are only fully
+	// validated once their branch is connected
+	if err := CheckBlockSanity(block); err != nil {
+		return nil, err
+	}
+
+	parent, err := chain.GetBlock(block.PrevHash)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %x (block %d)", ErrOrphanBlock, block.PrevHash, block.Height)
+	}
+	if block.Height != parent.Height+1 {
+		return nil, fmt.Errorf("%w: block %d on parent %d", ErrBadBlockLink, block.Height, parent.Height)
+	}
+
+	if bytes.Equal(block.PrevHash, chain.LastHash) {
+		if err := chain.connectTip(block); err != nil {
+			return nil, err
+		}
+		return &Reorg{Fork: &parent, Connected: []*Block{block}}, nil
+	}
+
+	// A side chain may not fork off below the rolling checkpoint
+	oldTip := chain.LastHash
+	fork, disconnect, connect, err := chain.findFork(oldTip, block.PrevHash)
+	if err != nil {
+		return nil, err
+	}
+	if finalized := chain.FinalizedHeight(); fork.Height < finalized {
+		return nil, fmt.Errorf("%w: block %d forks at height %d, below finalized height %d", ErrFinalityViolation, block.Height, fork.Height, finalized)
+	}
+
+	// Stored side chain blocks are never removed: only store the ones whose
+	// branch could still overtake the main chain
+	tipWork, err := chain.chainWork(oldTip)
+	if err != nil {
+		return nil, err
+	}
+	parentWork, err := chain.chainWork(block.PrevHash)
+	if err != nil {
+		return nil, err
+	}
+	lag := new(big.Int).Sub(tipWork, parentWork)
+	lag.Sub(lag, blockWork(block.Difficulty))
+	if lag.Cmp(chain.sideChainReach()) > 0 {
+		lag.Div(lag, blockWork(chain.Params.Difficulty))
+		return nil, fmt.Errorf("%w: block %d (%x) trails the tip by %s blocks of work", ErrStaleSideChain, block.Height, block.Hash, lag)
+	}
+
+	if err := chain.Database.Put(block.Hash, block.Serialize(), nil); err != nil {
+		return nil, err
+	}
+	sideWork, err := chain.chainWork(block.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if sideWork.Cmp(tipWork) <= 0 {
+		log.Printf("🔀 Stored side chain block %d (%x), main chain has more work", block.Height, block.Hash)
+		return nil, nil
+	}
+
+	reverseBlocks(connect)
+	connect = append(connect, block)
+
+	if err := chain.reorganize(fork, connect); err != nil {
+		return nil, err
+	}
+
+	log.Printf("🔀 Reorganized at height %d: %d block(s) disconnected, %d connected", fork.Height, len(disconnect), len(connect))
+	return &Reorg{Fork: fork, Disconnected: disconnect, Connected: connect}, nil
+}
+
+// reorganize rolls the main chain back to fork and connects a branch with
+// full validation; when a branch block is invalid, it and its stored
+// descendants on the branch are discarded and the old main chain restored
+// The caller must hold the state lock
+func (chain *Blockchain) reorganize(fork *Block, connect []*Block) error {
+	oldTip := chain.LastHash
+
+	if err := chain.setTip(fork.Hash); err != nil {
+		return err
+	}
+
+	for i, block := range connect {
+		if err := chain.connectTip(block); err != nil {
+			chain.discardBlocks(connect[i:])
+			if restoreErr := chain.setTip(oldTip); restoreErr != nil {
+				return restoreErr
+			}
+			return fmt.Errorf("side chain block %d (%x) rejected: %w", block.Height, block.Hash, err)
+		}
+	}
+
+	return nil
+}
+
+// setTip makes a stored block the tip, disconnecting the main chain down to
+// the fork and connecting the blocks of the other branch one by one
+// The caller must hold the state lock
+func (chain *Blockchain) setTip(hash []byte) error {
+	fork, disconnect, connect, err := chain.findFork(chain.LastHash, hash)
+	if err != nil {
+		return err
+	}
+	if len(disconnect) > 0 && chain.IsPruned(fork.Height+1) {
+		return fmt.Errorf("%w: cannot roll back to block %d", ErrPruned, fork.Height)
+	}
+
+	for range disconnect {
+		if err := chain.disconnectTip(); err != nil {
+			return err
+		}
+	}
+
+	reverseBlocks(connect)
+	for _, block := range connect {
+		if err := chain.applyBlock(new(leveldb.Batch), block); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// disconnectTip rolls the tip back to its parent: the outputs the tip created
+// leave the UTXO set and the ones it spent return (see blockUndo)
+// The caller must hold the state lock
+func (chain *Blockchain) disconnectTip() error {
+	block, err := chain.GetBlock(chain.LastHash)
+	if err != nil {
+		return err
+	}
+	if chain.IsPruned(block.Height) {
+		return fmt.Errorf("%w: cannot disconnect block %d", ErrPruned, block.Height)
+	}
+
+	undo, err := chain.blockUndo(&block)
+	if err != nil {
+		return err
+	}
+
+	delta, err := chain.undoUTXODelta(&block, undo)
+	if err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	if err := writeUTXODelta(batch, delta); err != nil {
+		return err
+	}
+	batch.Delete(undoKey(block.Hash))
+	unindexBlock(batch, &block)
+	if err := chain.unindexAddresses(batch, &block, undo); err != nil {
+		return err
+	}
+	batch.Put([]byte("lh"), block.PrevHash)
+
+	if err := chain.Database.Write(batch, nil); err != nil {
+		return err
+	}
+	chain.LastHash = block.PrevHash
+
+	return nil
+}
+
+// discardBlocks deletes invalid side chain blocks and their index entries
+func (chain *Blockchain) discardBlocks(blocks []*Block) {
+	for _, block := range blocks {
+		if err := chain.Database.Delete(block.Hash, nil); err != nil {
+			log.Printf("⚠️  Could not discard block %x: %v", block.Hash, err)
+		}
+		if err := chain.Database.Delete(chainWorkKey(block.Hash), nil); err != nil {
+			log.Printf("⚠️  Could not discard chain work of block %x: %v", block.Hash, err)
+		}
+	}
+}
+
+func reverseBlocks(blocks []*Block) {
+	for i, j := 0, len(blocks)-1; i < j; i, j = i+1, j-1 {
+		blocks[i], blocks[j] = blocks[j], blocks[i]
+	}
+}
@@ -0,0 +1,74 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// ErrCoinbaseReward is returned for blocks whose coinbase is missing,
+// duplicated or mints more than the block reward plus the fees
+var ErrCoinbaseReward = errors.New("invalid coinbase reward")
+
+// checkCoinbaseReward verifies a block has exactly one coinbase transaction,
+// paying at most GetBlockReward(height) plus the fees of the block's other
+// transactions. A miner may claim less: what it leaves out is never minted
+// (our miner does not claim the fees)
+// Transactions may spend outputs created earlier in the same block
+func (chain *Blockchain) checkCoinbaseReward(block *Block) error {
+	inBlock := make(map[string]*Transaction, len(block.Transactions))
+	for _, tx := range block.Transactions {
+		inBlock[hex.EncodeToString(tx.ID)] = tx
+	}
+
+	var coinbase *Transaction
+	fees := 0
+	for _, tx := range block.Transactions {
+		if tx.IsCoinbase() {
+			if coinbase != nil {
+				return fmt.Errorf("%w: block %d has more than one coinbase transaction", ErrCoinbaseReward, block.Height)
+			}
+			coinbase = tx
+			continue
+		}
+
+		prevTXs := make(map[string]Transaction)
+		for _, in := range tx.Inputs {
+			id := hex.EncodeToString(in.ID)
+			if prevTX, ok := inBlock[id]; ok {
+				prevTXs[id] = *prevTX
+				continue
+			}
+			prevTX, err := chain.FindTransaction(in.ID)
+			if err != nil {
+				return fmt.Errorf("%w: block %d: transaction %x spends unknown transaction %s", ErrCoinbaseReward, block.Height, tx.ID, id)
+			}
+			prevTXs[id] = prevTX
+		}
+
+		fee := tx.Fee(prevTXs)
+		if fee < 0 {
+			return fmt.Errorf("%w: block %d: transaction %x spends %d more than its inputs", ErrCoinbaseReward, block.Height, tx.ID, -fee)
+		}
+		fees += fee
+	}
+
+	if coinbase == nil {
+		return fmt.Errorf("%w: block %d has no coinbase transaction", ErrCoinbaseReward, block.Height)
+	}
+
+	paid := 0
+	for _, out := range coinbase.Outputs {
+		if out.Value < 0 {
+			return fmt.Errorf("%w: block %d: coinbase output of %d", ErrCoinbaseReward, block.Height, out.Value)
+		}
+		paid += out.Value
+	}
+
+	reward := chain.Params.BlockReward(block.Height)
+	if paid > reward+fees {
+		return fmt.Errorf("%w: block %d coinbase pays %d, the reward is %d plus %d in fees", ErrCoinbaseReward, block.Height, paid, reward, fees)
+	}
+
+	return nil
+}
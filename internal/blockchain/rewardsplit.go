@@ -0,0 +1,108 @@
+package blockchain
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RewardShare is the percentage of the coinbase paid to an address
+type RewardShare struct {
+	Address string `json:"address"`
+	Percent int    `json:"percent"`
+}
+
+// RewardSplit divides the coinbase among addresses, percentages summing to 100
+type RewardSplit []RewardShare
+
+// ParseRewardSplit parses a mining reward destination: a single address
+// ("ADDR", 100%) or percentage shares ("ADDR1:60,ADDR2:40")
+func ParseRewardSplit(spec string) (RewardSplit, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, fmt.Errorf("a mining address is required")
+	}
+
+	if !strings.ContainsAny(spec, ":,") {
+		if !ValidateAddress(spec) {
+			return nil, fmt.Errorf("invalid mining address %s", spec)
+		}
+		return RewardSplit{{Address: spec, Percent: 100}}, nil
+	}
+
+	var split RewardSplit
+	seen := make(map[string]bool)
+	total := 0
+	for _, part := range strings.Split(spec, ",") {
+		address, percent, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			return nil, fmt.Errorf("reward share %q must be ADDRESS:PERCENT", part)
+		}
+		if !ValidateAddress(address) {
+			return nil, fmt.Errorf("invalid mining address %s", address)
+		}
+		if seen[address] {
+			return nil, fmt.Errorf("mining address %s is listed twice", address)
+		}
+		seen[address] = true
+
+		p, err := strconv.Atoi(percent)
+		if err != nil || p < 1 || p > 100 {
+			return nil, fmt.Errorf("reward share of %s must be a percentage between 1 and 100", address)
+		}
+		total += p
+		split = append(split, RewardShare{Address: address, Percent: p})
+	}
+	if total != 100 {
+		return nil, fmt.Errorf("reward shares add up to %d%%, not 100%%", total)
+	}
+
+	return split, nil
+}
+
+// String formats the split like ParseRewardSplit reads it
+func (split RewardSplit) String() string {
+	if len(split) == 1 && split[0].Percent == 100 {
+		return split[0].Address
+	}
+
+	parts := make([]string, len(split))
+	for i, share := range split {
+		parts[i] = fmt.Sprintf("%s:%d", share.Address, share.Percent)
+	}
+	return strings.Join(parts, ",")
+}
+
+// amounts divides value among the shares, rounding down; the first share
+// gets what rounding leaves over
+func (split RewardSplit) amounts(value int) []int {
+	amounts := make([]int, len(split))
+	paid := 0
+	for i, share := range split {
+		amounts[i] = value * share.Percent / 100
+		paid += amounts[i]
+	}
+	amounts[0] += value - paid
+	return amounts
+}
+
+// CoinbaseSplitTX creates a coinbase transaction paying the block reward
+// of height to the shares of split; shares too small to get a coin are left
+// out (the first one is always paid)
+func CoinbaseSplitTX(split RewardSplit, data string, height int) *Transaction {
+	tx := CoinbaseTX(split[0].Address, data, height)
+	if len(split) == 1 {
+		return tx
+	}
+
+	reward := tx.Outputs[0].Value
+	tx.Outputs = nil
+	for i, amount := range split.amounts(reward) {
+		if amount > 0 || i == 0 {
+			tx.Outputs = append(tx.Outputs, *NewTXOutput(amount, split[i].Address))
+		}
+	}
+	tx.ID = tx.Hash()
+
+	return tx
+}
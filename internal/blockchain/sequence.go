@@ -0,0 +1,89 @@
+package blockchain
+
+import (
+	legacytx "github.com/marcocsrachid/blockchain-go/internal/blockchain/legacytx"
+)
+
+// Input sequence numbers
+//
+// TXInput.Sequence is signed and hashed with the transaction. The zero value
+// means final: no replacement signalling and no relative lock-time, and such
+// inputs serialize exactly like transactions created before sequence numbers
+// existed. Non-zero sequences use the flags below; transactions carrying them
+// are only relayed to peers speaking SequenceProtocolVersion or later, since
+// older nodes drop the field when decoding and compute a different hash.
+const (
+	SequenceFinal = uint32(0)
+
+	// SequenceReplaceableFlag signals that the transaction may be replaced
+	// by one paying a higher fee (opt-in RBF)
+	SequenceReplaceableFlag = uint32(1 << 31)
+
+	// SequenceLockTimeFlag enables the relative lock-time of an input: the
+	// spent output must be buried SequenceLockTimeMask & sequence blocks deep
+	SequenceLockTimeFlag = uint32(1 << 30)
+	SequenceLockTimeMask = uint32(0x0000ffff)
+
+	// SequenceProtocolVersion is the first network protocol version that
+	// carries input sequence numbers
+	SequenceProtocolVersion = 2
+)
+
+// Gob writes process-wide type ids into every encoding, assigned in the order
+// types are first encoded. Encoding the transaction types before anything else
+// gives them the same ids in every process, so transaction hashes and merkle
+// roots don't depend on what the process happened to encode first.
+func init() {
+	Transaction{}.Serialize()
+	Transaction{Inputs: []TXInput{{Sequence: SequenceReplaceableFlag}}}.Serialize()
+}
+
+// HasSequences reports whether any input has a non-final sequence number
+func (tx *Transaction) HasSequences() bool {
+	for _, in := range tx.Inputs {
+		if in.Sequence != SequenceFinal {
+			return true
+		}
+	}
+	return false
+}
+
+// SignalsReplacement reports whether the transaction opts in to replacement
+func (tx *Transaction) SignalsReplacement() bool {
+	for _, in := range tx.Inputs {
+		if in.Sequence&SequenceReplaceableFlag != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// RelativeLockTime returns the number of blocks the output spent by the
+// input must be buried before it can be spent (0 = no relative lock-time)
+func (in *TXInput) RelativeLockTime() int {
+	if in.Sequence&SequenceLockTimeFlag == 0 {
+		return 0
+	}
+	return int(in.Sequence & SequenceLockTimeMask)
+}
+
+// legacyTransaction converts a transaction without sequence numbers to the
+// original layout, whose gob encoding is the pre-sequence serialization
+func (tx Transaction) legacyTransaction() legacytx.Transaction {
+	legacy := legacytx.Transaction{ID: tx.ID}
+
+	if tx.Inputs != nil {
+		legacy.Inputs = make([]legacytx.TXInput, len(tx.Inputs))
+		for i, in := range tx.Inputs {
+			legacy.Inputs[i] = legacytx.TXInput{ID: in.ID, Out: in.Out, Signature: in.Signature, PubKey: in.PubKey}
+		}
+	}
+	if tx.Outputs != nil {
+		legacy.Outputs = make([]legacytx.TXOutput, len(tx.Outputs))
+		for i, out := range tx.Outputs {
+			legacy.Outputs[i] = legacytx.TXOutput{Value: out.Value, PubKeyHash: out.PubKeyHash}
+		}
+	}
+
+	return legacy
+}
@@ -0,0 +1,209 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Signer signs transaction inputs without exposing its private key, so
+// signing can happen in another process or on a hardware device
+type Signer interface {
+	// PublicKey returns the raw public key (X || Y) placed in the inputs
+	PublicKey() []byte
+	// SignHash signs a signature hash (see Transaction.SignatureHash) and
+	// returns the signature in the input encoding (r || s)
+	SignHash(hash []byte) ([]byte, error)
+}
+
+// KeySigner signs with an in-memory private key
+type KeySigner struct {
+	key ecdsa.PrivateKey
+}
+
+// NewKeySigner creates a signer for a private key held by this process
+func NewKeySigner(privKey ecdsa.PrivateKey) *KeySigner {
+	return &KeySigner{key: privKey}
+}
+
+// Signer returns a signer for the wallet key
+func (w *Wallet) Signer() Signer {
+	return NewKeySigner(w.PrivateKey)
+}
+
+func (k *KeySigner) PublicKey() []byte {
+	return append(k.key.PublicKey.X.Bytes(), k.key.PublicKey.Y.Bytes()...)
+}
+
+func (k *KeySigner) SignHash(hash []byte) ([]byte, error) {
+	r, s, err := ecdsa.Sign(rand.Reader, &k.key, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(r.Bytes(), s.Bytes()...), nil
+}
+
+// External signer protocol
+//
+// An external signer is a command that reads one JSON SignerRequest from
+// stdin and writes one JSON SignerResponse to stdout, then exits. Keys and
+// hashes are hex encoded. Methods:
+//
+//	{"method":"pubkey"}                           -> {"pubkey":"..."}
+//	{"method":"sign","pubkey":"...","hash":"..."} -> {"signature":"..."}
+//
+// A signer refuses a request by answering {"error":"..."}. ServeSigner
+// implements the command side (see the "signer" CLI command).
+const (
+	SignerMethodPubKey = "pubkey"
+	SignerMethodSign   = "sign"
+
+	DefaultSignerTimeout = 2 * time.Minute // Leaves time to confirm on a device
+)
+
+// SignerRequest is sent to an external signer on stdin
+type SignerRequest struct {
+	Method string `json:"method"`
+	PubKey string `json:"pubkey,omitempty"`
+	Hash   string `json:"hash,omitempty"`
+}
+
+// SignerResponse is read from an external signer on stdout
+type SignerResponse struct {
+	PubKey    string `json:"pubkey,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ExternalSigner delegates signing to a subprocess
+type ExternalSigner struct {
+	Command []string
+	Timeout time.Duration
+
+	pubKey []byte
+}
+
+// NewExternalSigner creates a signer running command (program and arguments
+// separated by spaces) and asks it for its public key
+func NewExternalSigner(command string) (*ExternalSigner, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("external signer command is empty")
+	}
+
+	signer := &ExternalSigner{Command: args, Timeout: DefaultSignerTimeout}
+
+	response, err := signer.call(SignerRequest{Method: SignerMethodPubKey})
+	if err != nil {
+		return nil, err
+	}
+	if signer.pubKey, err = hex.DecodeString(response.PubKey); err != nil || len(signer.pubKey) == 0 {
+		return nil, fmt.Errorf("external signer returned an invalid public key")
+	}
+
+	return signer, nil
+}
+
+// Address returns the address of the external signer key
+func (e *ExternalSigner) Address() string {
+	return string(PubKeyHashToAddress(HashPubKey(e.pubKey)))
+}
+
+func (e *ExternalSigner) PublicKey() []byte {
+	return e.pubKey
+}
+
+func (e *ExternalSigner) SignHash(hash []byte) ([]byte, error) {
+	response, err := e.call(SignerRequest{
+		Method: SignerMethodSign,
+		PubKey: hex.EncodeToString(e.pubKey),
+		Hash:   hex.EncodeToString(hash),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := hex.DecodeString(response.Signature)
+	if err != nil || len(signature) == 0 {
+		return nil, fmt.Errorf("external signer returned an invalid signature")
+	}
+
+	return signature, nil
+}
+
+// call runs the signer command once with request on stdin
+func (e *ExternalSigner) call(request SignerRequest) (*SignerResponse, error) {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.Timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, e.Command[0], e.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("external signer %s: %v (%s)", e.Command[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	var response SignerResponse
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		return nil, fmt.Errorf("external signer %s: invalid response: %v", e.Command[0], err)
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("external signer refused: %s", response.Error)
+	}
+
+	return &response, nil
+}
+
+// ServeSigner answers one external signer request read from in with signer
+func ServeSigner(signer Signer, in io.Reader, out io.Writer) error {
+	var request SignerRequest
+	var response SignerResponse
+
+	if err := json.NewDecoder(in).Decode(&request); err != nil {
+		response.Error = "invalid request: " + err.Error()
+		return json.NewEncoder(out).Encode(response)
+	}
+
+	switch request.Method {
+	case SignerMethodPubKey:
+		response.PubKey = hex.EncodeToString(signer.PublicKey())
+	case SignerMethodSign:
+		hash, err := hex.DecodeString(request.Hash)
+		if err != nil || len(hash) != 32 {
+			response.Error = "invalid hash"
+			break
+		}
+		if request.PubKey != hex.EncodeToString(signer.PublicKey()) {
+			response.Error = "unknown public key"
+			break
+		}
+
+		signature, err := signer.SignHash(hash)
+		if err != nil {
+			response.Error = err.Error()
+			break
+		}
+		response.Signature = hex.EncodeToString(signature)
+	default:
+		response.Error = fmt.Sprintf("unknown method %q", request.Method)
+	}
+
+	return json.NewEncoder(out).Encode(response)
+}
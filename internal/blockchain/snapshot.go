@@ -0,0 +1,214 @@
+package blockchain
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Chain snapshots (bootstrap files)
+//
+// A snapshot is a gzip compressed gob stream: a SnapshotHeader followed by
+// the serialized main chain blocks from the genesis to the tip. Importing one
+// checks every block like a side chain block (header, proof of work, merkle
+// root, linkage) but not its signatures, then connects them, updating the
+// UTXO set block by block, and checks it against the commitment of the tip.
+// Only import snapshots from a trusted source; the verifychain job checks the
+// signatures afterwards.
+
+// snapshotFormat is the version of the bootstrap file format
+const snapshotFormat = 1
+
+// SnapshotHeader starts a bootstrap file
+type SnapshotHeader struct {
+	Format  int
+	Network string
+	Genesis []byte
+	Tip     []byte
+	Height  int   // Height of the tip, the file holds Height+1 blocks
+	Created int64 // Unix seconds
+}
+
+// ImportResult summarizes an imported snapshot
+type ImportResult struct {
+	Imported int  // Blocks stored
+	Known    int  // Blocks the chain already had
+	Switched bool // The snapshot tip became the tip (false: the chain has as much work)
+	Height   int  // Height of the tip after the import
+}
+
+// ExportSnapshot writes the main chain to w as a snapshot
+// progress, if not nil, is called after each block with (written, total)
+func (chain *Blockchain) ExportSnapshot(w io.Writer, progress func(done, total int)) (SnapshotHeader, error) {
+	if pruned := chain.PrunedHeight(); pruned >= 0 {
+		return SnapshotHeader{}, fmt.Errorf("%w: blocks up to height %d only keep their header", ErrPruned, pruned)
+	}
+
+	hashes := chain.GetBlockHashes()
+	if len(hashes) == 0 {
+		return SnapshotHeader{}, fmt.Errorf("no blocks to export")
+	}
+	header := SnapshotHeader{
+		Format:  snapshotFormat,
+		Network: chain.Params.Name,
+		Genesis: hashes[len(hashes)-1],
+		Tip:     hashes[0],
+		Height:  len(hashes) - 1,
+		Created: time.Now().Unix(),
+	}
+
+	zw := gzip.NewWriter(w)
+	enc := gob.NewEncoder(zw)
+	if err := enc.Encode(header); err != nil {
+		return SnapshotHeader{}, err
+	}
+
+	total := len(hashes)
+	for i := total - 1; i >= 0; i-- {
+		data, err := chain.Database.Get(hashes[i], nil)
+		if err != nil {
+			return SnapshotHeader{}, fmt.Errorf("block %x: %v", hashes[i], err)
+		}
+		if err := enc.Encode(data); err != nil {
+			return SnapshotHeader{}, err
+		}
+		if progress != nil {
+			progress(total-i, total)
+		}
+	}
+
+	return header, zw.Close()
+}
+
+// Snapshot is a bootstrap file being read
+type Snapshot struct {
+	Header SnapshotHeader
+
+	dec *gob.Decoder
+}
+
+// OpenSnapshot reads the header of a snapshot, its blocks are read by ImportSnapshot
+func OpenSnapshot(r io.Reader) (*Snapshot, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a bootstrap file: %v", err)
+	}
+
+	snap := &Snapshot{dec: gob.NewDecoder(zr)}
+	if err := snap.dec.Decode(&snap.Header); err != nil {
+		return nil, fmt.Errorf("not a bootstrap file: %v", err)
+	}
+	if snap.Header.Format != snapshotFormat {
+		return nil, fmt.Errorf("unsupported bootstrap file format %d", snap.Header.Format)
+	}
+
+	return snap, nil
+}
+
+// ImportSnapshot stores the blocks of a snapshot and makes its tip the tip
+// of the chain when it carries more work
+// Blocks the chain already has are skipped, so an interrupted import resumes
+// progress, if not nil, is called after each block with (read, total)
+func (chain *Blockchain) ImportSnapshot(snap *Snapshot, progress func(done, total int)) (ImportResult, error) {
+	var result ImportResult
+	if chain.pruning() {
+		return result, fmt.Errorf("%w: a pruning node cannot import a snapshot", ErrPruned)
+	}
+
+	header, dec := snap.Header, snap.dec
+	if header.Network != chain.Params.Name {
+		return result, fmt.Errorf("snapshot of network %s, the chain belongs to %s", header.Network, chain.Params.Name)
+	}
+	genesis, err := chain.MainChainHashAt(0)
+	if err != nil {
+		return result, err
+	}
+	if !bytes.Equal(header.Genesis, genesis) {
+		return result, fmt.Errorf("snapshot starts from genesis %x, the chain from %x", header.Genesis, genesis)
+	}
+
+	total := header.Height + 1
+	var prev *Block
+	for i := 0; i < total; i++ {
+		var data []byte
+		if err := dec.Decode(&data); err != nil {
+			return result, fmt.Errorf("block %d: %v", i, err)
+		}
+		block, err := DecodeBlock(data)
+		if err != nil {
+			return result, fmt.Errorf("block %d: %v", i, err)
+		}
+
+		switch {
+		case prev == nil:
+			if !bytes.Equal(block.Hash, genesis) {
+				return result, fmt.Errorf("snapshot does not start with its genesis block")
+			}
+		case block.Height != prev.Height+1 || !bytes.Equal(block.PrevHash, prev.Hash):
+			return result, fmt.Errorf("block %d (%x) does not follow block %d", block.Height, block.Hash, prev.Height)
+		}
+
+		if chain.HasBlock(block.Hash) {
+			result.Known++
+		} else {
+			if err := CheckBlockSanity(block); err != nil {
+				return result, err
+			}
+			if err := chain.Database.Put(block.Hash, data, nil); err != nil {
+				return result, err
+			}
+			result.Imported++
+		}
+
+		prev = block
+		if progress != nil {
+			progress(i+1, total)
+		}
+	}
+	if !bytes.Equal(prev.Hash, header.Tip) {
+		return result, fmt.Errorf("snapshot ends at %x, its header announces %x", prev.Hash, header.Tip)
+	}
+
+	chain.state.Lock()
+	defer chain.state.Unlock()
+
+	oldTip := chain.LastHash
+	tipWork, err := chain.chainWork(oldTip)
+	if err != nil {
+		return result, err
+	}
+	snapshotWork, err := chain.chainWork(prev.Hash)
+	if err != nil {
+		return result, err
+	}
+	if snapshotWork.Cmp(tipWork) <= 0 {
+		tip, err := chain.GetBlock(oldTip)
+		result.Height = tip.Height
+		return result, err
+	}
+
+	// Blocks spending missing outputs stop the switch halfway
+	if err := chain.setTip(prev.Hash); err != nil {
+		if restoreErr := chain.setTip(oldTip); restoreErr != nil {
+			return result, restoreErr
+		}
+		return result, err
+	}
+
+	// The tip commits to the UTXO set the whole snapshot produces
+	if len(prev.UTXORoot) > 0 {
+		if root, _ := (UTXOSet{Blockchain: chain}).Commitment(); !bytes.Equal(root, prev.UTXORoot) {
+			if err := chain.setTip(oldTip); err != nil {
+				return result, err
+			}
+			return result, fmt.Errorf("%w: snapshot tip %d commits to %x, its blocks produce %x", ErrUTXOCommitment, prev.Height, prev.UTXORoot, root)
+		}
+	}
+
+	result.Switched = true
+	result.Height = prev.Height
+	return result, nil
+}
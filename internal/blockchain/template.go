@@ -0,0 +1,75 @@
+package blockchain
+
+// BlockTemplate is a candidate block handed to external miners
+// A miner only has to find a nonce (and timestamp) for which the PoW hash
+// of the template meets the target
+type BlockTemplate struct {
+	Height        int
+	PrevHash      []byte
+	Difficulty    int
+	Transactions  []*Transaction // Mempool transactions followed by the coinbase (block order)
+	CoinbaseValue int
+	MerkleRoot    []byte
+	UTXORoot      []byte // Commitment to the UTXO set after the block
+	MinTime       int64  // Earliest valid timestamp (past the median time past)
+	Version       uint32 // Block version, signaling the deployments in progress
+}
+
+// NewBlockTemplate builds a block template on top of the current tip
+// paying the coinbase to the shares of split, embedding coinbaseMessage ("" = none)
+func NewBlockTemplate(chain *Blockchain, txs []*Transaction, split RewardSplit, coinbaseMessage string) (*BlockTemplate, error) {
+	chain.RLockState()
+	defer chain.RUnlockState()
+
+	lastBlock := chain.GetLastBlock()
+	height := lastBlock.Height + 1
+
+	coinbase := CoinbaseSplitTX(split, CoinbaseData(coinbaseMessage), height)
+	blockTxs := append(append([]*Transaction{}, txs...), coinbase)
+
+	version, err := chain.ComputeBlockVersion(lastBlock.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &BlockTemplate{
+		Height:       height,
+		PrevHash:     lastBlock.Hash,
+		Difficulty:   chain.Params.Difficulty,
+		Transactions: blockTxs,
+		Version:      version,
+	}
+	for _, out := range coinbase.Outputs {
+		template.CoinbaseValue += out.Value
+	}
+	template.MerkleRoot = template.Block(0, 0).HashTransactions()
+
+	utxoRoot, err := UTXOSet{Blockchain: chain}.CommitmentAfter(template.Block(0, 0))
+	if err != nil {
+		return nil, err
+	}
+	template.UTXORoot = utxoRoot
+
+	if template.MinTime, err = chain.minBlockTime(); err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+// Block builds the block described by the template with the given timestamp and nonce
+func (t *BlockTemplate) Block(timestamp int64, nonce int) *Block {
+	block := &Block{
+		Timestamp:    timestamp,
+		Transactions: t.Transactions,
+		PrevHash:     t.PrevHash,
+		Nonce:        nonce,
+		Height:       t.Height,
+		Difficulty:   t.Difficulty,
+		MerkleRoot:   t.MerkleRoot,
+		UTXORoot:     t.UTXORoot,
+		Version:      t.Version,
+	}
+
+	return block
+}
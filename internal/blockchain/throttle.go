@@ -0,0 +1,93 @@
+package blockchain
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// MiningThrottle limits the CPU the local proof of work takes, so a node can
+// mine on a shared machine without starving other processes
+type MiningThrottle struct {
+	CPUPercent  int     // Share of the time spent hashing, 1-100 (100 = unthrottled)
+	MaxHashRate float64 // Hashes per second, 0 = uncapped
+	LowPriority bool    // Hash on a thread at the lowest scheduling priority
+}
+
+var (
+	miningThrottle    = MiningThrottle{CPUPercent: 100}
+	miningThrottleMux sync.RWMutex
+)
+
+// SetMiningThrottle configures the throttle of the local proof of work
+func SetMiningThrottle(throttle MiningThrottle) error {
+	if throttle.CPUPercent < 1 || throttle.CPUPercent > 100 {
+		return fmt.Errorf("mining CPU percentage must be between 1 and 100, got %d", throttle.CPUPercent)
+	}
+	if throttle.MaxHashRate < 0 {
+		return fmt.Errorf("mining hashrate cap must not be negative")
+	}
+	if throttle.LowPriority && !lowPrioritySupported {
+		return fmt.Errorf("low priority mining is not supported on %s", runtime.GOOS)
+	}
+
+	miningThrottleMux.Lock()
+	miningThrottle = throttle
+	miningThrottleMux.Unlock()
+
+	return nil
+}
+
+// GetMiningThrottle returns the throttle of the local proof of work
+func GetMiningThrottle() MiningThrottle {
+	miningThrottleMux.RLock()
+	defer miningThrottleMux.RUnlock()
+
+	return miningThrottle
+}
+
+// Throttled reports whether the throttle slows the proof of work down
+func (t MiningThrottle) Throttled() bool {
+	return t.CPUPercent < 100 || t.MaxHashRate > 0
+}
+
+// pause is how long to rest after hashing hashes in busy: the rest that brings
+// the time spent hashing down to CPUPercent, or the rate down to MaxHashRate,
+// whichever is longer
+func (t MiningThrottle) pause(hashes int, busy time.Duration) time.Duration {
+	var rest time.Duration
+	if t.CPUPercent < 100 {
+		rest = busy * time.Duration(100-t.CPUPercent) / time.Duration(t.CPUPercent)
+	}
+	if t.MaxHashRate > 0 {
+		minimum := time.Duration(float64(hashes) / t.MaxHashRate * float64(time.Second))
+		rest = max(rest, minimum-busy)
+	}
+	return rest
+}
+
+// runLowPriority runs the proof of work on a thread of its own at the lowest
+// scheduling priority. The goroutine exits with the thread still locked, so
+// the thread is discarded and its priority never leaks to other goroutines
+func runLowPriority(run func() (int, []byte)) (int, []byte) {
+	type result struct {
+		nonce int
+		hash  []byte
+	}
+
+	done := make(chan result)
+	go func() {
+		runtime.LockOSThread()
+		if err := lowerThreadPriority(); err != nil {
+			log.Printf("⚠️  Could not lower the mining thread priority: %v", err)
+		}
+
+		nonce, hash := run()
+		done <- result{nonce, hash}
+	}()
+
+	r := <-done
+	return r.nonce, r.hash
+}
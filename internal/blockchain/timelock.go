@@ -0,0 +1,59 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrSequenceLock marks transactions whose relative lock-time is not satisfied
+var ErrSequenceLock = errors.New("relative lock-time not satisfied")
+
+// MaxRelativeLockTime is the longest relative lock-time an input can carry, in blocks
+const MaxRelativeLockTime = int(SequenceLockTimeMask)
+
+// SetRelativeLockTime requires every input to wait blocks confirmations of
+// the output it spends (0 clears the lock) and updates the transaction ID
+// It must be called before signing: sequence numbers are signed
+func (tx *Transaction) SetRelativeLockTime(blocks int) error {
+	if blocks < 0 || blocks > MaxRelativeLockTime {
+		return fmt.Errorf("relative lock-time must be between 0 and %d blocks", MaxRelativeLockTime)
+	}
+
+	for i := range tx.Inputs {
+		sequence := tx.Inputs[i].Sequence &^ (SequenceLockTimeFlag | SequenceLockTimeMask)
+		if blocks > 0 {
+			sequence |= SequenceLockTimeFlag | uint32(blocks)
+		}
+		tx.Inputs[i].Sequence = sequence
+	}
+	tx.ID = tx.Hash()
+
+	return nil
+}
+
+// CheckSequenceLocks checks that every input with a relative lock-time spends
+// an output confirmed long enough before height, the height of the block
+// that includes tx
+func (chain *Blockchain) CheckSequenceLocks(tx *Transaction, height int) error {
+	if tx.IsCoinbase() {
+		return nil
+	}
+
+	for i, in := range tx.Inputs {
+		lock := in.RelativeLockTime()
+		if lock == 0 {
+			continue
+		}
+
+		_, confirmedAt, err := chain.FindTransactionHeight(in.ID)
+		if err != nil {
+			return fmt.Errorf("%w: input %d spends unconfirmed output %x:%d", ErrSequenceLock, i, in.ID, in.Out)
+		}
+		if height < confirmedAt+lock {
+			return fmt.Errorf("%w: input %d spends an output confirmed at height %d, spendable from height %d",
+				ErrSequenceLock, i, confirmedAt, confirmedAt+lock)
+		}
+	}
+
+	return nil
+}
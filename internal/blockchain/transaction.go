@@ -27,6 +27,7 @@ type TXInput struct {
 	Out       int    // Index of the output in the referenced transaction
 	Signature []byte // Digital signature
 	PubKey    []byte // Public key
+	Sequence  uint32 // Replacement and relative lock-time flags (see sequence.go), 0 = final
 }
 
 // TXOutput represents a transaction output
@@ -38,6 +39,25 @@ type TXOutput struct {
 // TXOutputs is a collection of outputs (used for serialization)
 type TXOutputs struct {
 	Outputs []TXOutput
+	Indexes []int // Original output index of each entry (nil in legacy UTXO data)
+}
+
+// Index returns the original output index of the i-th entry
+func (outs TXOutputs) Index(i int) int {
+	if i < len(outs.Indexes) {
+		return outs.Indexes[i]
+	}
+	return i
+}
+
+// Find returns the output with the given original index
+func (outs TXOutputs) Find(outIdx int) (TXOutput, bool) {
+	for i, out := range outs.Outputs {
+		if outs.Index(i) == outIdx {
+			return out, true
+		}
+	}
+	return TXOutput{}, false
 }
 
 // Mining reward and supply constants are now in config.go
@@ -55,11 +75,17 @@ func (tx *Transaction) Hash() []byte {
 }
 
 // Serialize serializes the transaction
+// Transactions without sequence numbers keep the original encoding
 func (tx Transaction) Serialize() []byte {
 	var encoded bytes.Buffer
 
 	enc := gob.NewEncoder(&encoded)
-	err := enc.Encode(tx)
+	var err error
+	if tx.HasSequences() {
+		err = enc.Encode(tx)
+	} else {
+		err = enc.Encode(tx.legacyTransaction())
+	}
 	if err != nil {
 		log.Panic(err)
 	}
@@ -67,6 +93,31 @@ func (tx Transaction) Serialize() []byte {
 	return encoded.Bytes()
 }
 
+// Size returns the serialized size of the transaction in bytes
+func (tx Transaction) Size() int {
+	return len(tx.Serialize())
+}
+
+// Fee returns inputs minus outputs, resolving inputs from prevTXs
+func (tx *Transaction) Fee(prevTXs map[string]Transaction) int {
+	if tx.IsCoinbase() {
+		return 0
+	}
+
+	fee := 0
+	for _, in := range tx.Inputs {
+		prevTX := prevTXs[hex.EncodeToString(in.ID)]
+		if in.Out >= 0 && in.Out < len(prevTX.Outputs) {
+			fee += prevTX.Outputs[in.Out].Value
+		}
+	}
+	for _, out := range tx.Outputs {
+		fee -= out.Value
+	}
+
+	return fee
+}
+
 // DeserializeTransaction deserializes a transaction
 func DeserializeTransaction(data []byte) Transaction {
 	var transaction Transaction
@@ -78,6 +129,19 @@ func DeserializeTransaction(data []byte) Transaction {
 	return transaction
 }
 
+// DecodeTransaction deserializes a transaction received from an untrusted source
+// Unlike DeserializeTransaction it returns an error instead of panicking
+func DecodeTransaction(data []byte) (*Transaction, error) {
+	var transaction Transaction
+
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&transaction); err != nil {
+		return nil, err
+	}
+
+	return &transaction, nil
+}
+
 // CoinbaseTX creates a coinbase transaction (mining reward)
 // Has no inputs, only outputs
 // The reward is calculated based on block height (halving)
@@ -93,7 +157,7 @@ func CoinbaseTX(to, data string, height int) *Transaction {
 
 	reward := GetBlockReward(height)
 	
-	txin := TXInput{[]byte{}, -1, nil, []byte(data)}
+	txin := TXInput{[]byte{}, -1, nil, []byte(data), SequenceFinal}
 	txout := NewTXOutput(reward, to)
 
 	tx := Transaction{nil, []TXInput{txin}, []TXOutput{*txout}}
@@ -102,50 +166,160 @@ func CoinbaseTX(to, data string, height int) *Transaction {
 	return &tx
 }
 
-// NewTransaction creates a new regular transaction
-func NewTransaction(from, to string, amount int, chain *Blockchain) *Transaction {
-	var inputs []TXInput
-	var outputs []TXOutput
-
+// NewTransaction creates a new regular transaction paying recipients,
+// signed with the local wallet keys
+// The change goes to a new change address, saved in the wallet
+func NewTransaction(from string, recipients []Recipient, chain *Blockchain) *Transaction {
 	wallets, err := NewWallets()
 	if err != nil {
 		log.Panic(err)
 	}
-	wallet := wallets.GetWallet(from)
-	pubKeyHash := HashPubKey(wallet.PublicKey)
 
-	acc, validOutputs := chain.FindSpendableOutputs(pubKeyHash, amount)
+	tx, changeAddress, err := wallets.NewTransaction(from, recipients, 0, nil, chain)
+	if err != nil {
+		log.Panic(err)
+	}
+	if changeAddress != "" {
+		wallets.SaveFile()
+	}
+
+	return tx
+}
+
+// NewSignedTransaction creates a transaction spending the outputs of from
+// to pay recipients, signed by signer (a local key, another process or a
+// hardware device)
+// The change excludes fee, which is left unspent as the transaction fee;
+// selector picks the outputs spent (nil = the chain coin selector)
+func NewSignedTransaction(from string, recipients []Recipient, fee int, selector CoinSelector, signer Signer, chain *Blockchain) (*Transaction, error) {
+	var inputs []TXInput
+	var outputs []TXOutput
 
-	if acc < amount {
-		log.Panic("ERROR: Not enough funds")
+	pubKey := signer.PublicKey()
+	pubKeyHash := HashPubKey(pubKey)
+	if !bytes.Equal(pubKeyHash, addressPubKeyHash(from)) {
+		return nil, fmt.Errorf("signer key does not match address %s", from)
+	}
+
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("a transaction needs at least one recipient")
+	}
+	amount := 0
+	for _, recipient := range recipients {
+		if recipient.Amount <= 0 {
+			return nil, fmt.Errorf("invalid amount %d for %s", recipient.Amount, recipient.Address)
+		}
+		amount += recipient.Amount
+	}
+
+	acc, validOutputs := chain.FindSpendableOutputsWith(selector, pubKeyHash, amount+fee)
+
+	if acc < amount+fee {
+		return nil, fmt.Errorf("%w: have %d, need %d", ErrInsufficientFunds, acc, amount+fee)
 	}
 
 	// Create inputs from unspent outputs
 	for txid, outs := range validOutputs {
 		txID, err := hex.DecodeString(txid)
 		if err != nil {
-			log.Panic(err)
+			return nil, err
 		}
 
 		for _, out := range outs {
-			input := TXInput{txID, out, nil, wallet.PublicKey}
+			input := TXInput{txID, out, nil, pubKey, SequenceFinal}
 			inputs = append(inputs, input)
 		}
 	}
 
-	// Create outputs
-	outputs = append(outputs, *NewTXOutput(amount, to))
+	// Create outputs, in the order of the recipients
+	for _, recipient := range recipients {
+		outputs = append(outputs, *NewTXOutput(recipient.Amount, recipient.Address))
+	}
 
 	// If there's change, create output back to sender
-	if acc > amount {
-		outputs = append(outputs, *NewTXOutput(acc-amount, from))
+	if acc > amount+fee {
+		outputs = append(outputs, *NewTXOutput(acc-amount-fee, from))
 	}
 
 	tx := Transaction{nil, inputs, outputs}
 	tx.ID = tx.Hash()
-	chain.SignTransaction(&tx, wallet.PrivateKey)
+	if err := chain.SignTransaction(&tx, signer); err != nil {
+		return nil, err
+	}
 
-	return &tx
+	return &tx, nil
+}
+
+// Recipient is a single payment (address and amount) of a transaction
+type Recipient struct {
+	Address string
+	Amount  int
+}
+
+// Funding describes how much a party contributes to a multi-party transaction
+type Funding struct {
+	Address string // Address whose outputs are spent (change returns here)
+	PubKey  []byte // Full public key of the address owner (needed in inputs)
+	Amount  int    // Amount contributed by this party
+
+	Selector CoinSelector // Picks the outputs spent (nil = the chain coin selector)
+}
+
+// NewUnsignedTransaction builds a transaction funded by several parties
+// Inputs are left unsigned so each party can sign its own inputs
+// Funding beyond the payments is left unspent as the transaction fee
+func NewUnsignedTransaction(funders []Funding, recipients []Recipient, chain *Blockchain) (*Transaction, error) {
+	var inputs []TXInput
+	var outputs []TXOutput
+
+	funded := 0
+	for _, funder := range funders {
+		if !bytes.Equal(HashPubKey(funder.PubKey), addressPubKeyHash(funder.Address)) {
+			return nil, fmt.Errorf("public key does not match address %s", funder.Address)
+		}
+
+		acc, validOutputs := chain.FindSpendableOutputsWith(funder.Selector, HashPubKey(funder.PubKey), funder.Amount)
+		if acc < funder.Amount {
+			return nil, fmt.Errorf("%w in %s: have %d, need %d", ErrInsufficientFunds, funder.Address, acc, funder.Amount)
+		}
+
+		for txid, outs := range validOutputs {
+			txID, err := hex.DecodeString(txid)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, out := range outs {
+				inputs = append(inputs, TXInput{txID, out, nil, funder.PubKey, SequenceFinal})
+			}
+		}
+
+		if acc > funder.Amount {
+			outputs = append(outputs, *NewTXOutput(acc-funder.Amount, funder.Address))
+		}
+		funded += funder.Amount
+	}
+
+	paid := 0
+	for _, recipient := range recipients {
+		outputs = append(outputs, *NewTXOutput(recipient.Amount, recipient.Address))
+		paid += recipient.Amount
+	}
+
+	if funded < paid {
+		return nil, fmt.Errorf("funding (%d) does not cover payments (%d)", funded, paid)
+	}
+
+	tx := Transaction{nil, inputs, outputs}
+	tx.ID = tx.Hash()
+
+	return &tx, nil
+}
+
+// addressPubKeyHash extracts the public key hash from an address (nil if invalid)
+func addressPubKeyHash(address string) []byte {
+	pubKeyHash, _ := AddressToPubKeyHash(address)
+	return pubKeyHash
 }
 
 // IsCoinbase checks if the transaction is a coinbase transaction
@@ -154,34 +328,69 @@ func (tx *Transaction) IsCoinbase() bool {
 }
 
 // Sign signs each input of the transaction
-func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transaction) {
+func (tx *Transaction) Sign(signer Signer, prevTXs map[string]Transaction) error {
 	if tx.IsCoinbase() {
-		return
+		return nil
 	}
 
 	for _, in := range tx.Inputs {
 		if prevTXs[hex.EncodeToString(in.ID)].ID == nil {
-			log.Panic("ERROR: Previous transaction is not correct")
+			return fmt.Errorf("previous transaction %x is not correct", in.ID)
+		}
+	}
+
+	for inId := range tx.Inputs {
+		if err := tx.SignInput(inId, signer, prevTXs); err != nil {
+			return err
 		}
 	}
 
+	return nil
+}
+
+// SignatureHash returns the hash that the owner of input inId must sign
+func (tx *Transaction) SignatureHash(inId int, prevTXs map[string]Transaction) []byte {
+	in := tx.Inputs[inId]
+	prevTX := prevTXs[hex.EncodeToString(in.ID)]
+
 	txCopy := tx.TrimmedCopy()
+	txCopy.Inputs[inId].PubKey = prevTX.Outputs[in.Out].PubKeyHash
 
-	for inId, in := range txCopy.Inputs {
-		prevTX := prevTXs[hex.EncodeToString(in.ID)]
-		txCopy.Inputs[inId].Signature = nil
-		txCopy.Inputs[inId].PubKey = prevTX.Outputs[in.Out].PubKeyHash
-		txCopy.ID = txCopy.Hash()
-		txCopy.Inputs[inId].PubKey = nil
+	return txCopy.Hash()
+}
 
-		r, s, err := ecdsa.Sign(rand.Reader, &privKey, txCopy.ID)
-		if err != nil {
-			log.Panic(err)
-		}
-		signature := append(r.Bytes(), s.Bytes()...)
+// SignInput signs a single input of the transaction
+// Used when inputs belong to different keys (multi-party transactions)
+func (tx *Transaction) SignInput(inId int, signer Signer, prevTXs map[string]Transaction) error {
+	signature, err := signer.SignHash(tx.SignatureHash(inId, prevTXs))
+	if err != nil {
+		return fmt.Errorf("signing input %d: %w", inId, err)
+	}
+
+	tx.Inputs[inId].Signature = signature
+	return nil
+}
 
-		tx.Inputs[inId].Signature = signature
+// VerifyInputSignature checks a signature for input inId against a raw public key
+func (tx *Transaction) VerifyInputSignature(inId int, signature, pubKey []byte, prevTXs map[string]Transaction) bool {
+	if len(signature) == 0 || len(pubKey) == 0 {
+		return false
 	}
+
+	r := big.Int{}
+	s := big.Int{}
+	sigLen := len(signature)
+	r.SetBytes(signature[:(sigLen / 2)])
+	s.SetBytes(signature[(sigLen / 2):])
+
+	x := big.Int{}
+	y := big.Int{}
+	keyLen := len(pubKey)
+	x.SetBytes(pubKey[:(keyLen / 2)])
+	y.SetBytes(pubKey[(keyLen / 2):])
+
+	rawPubKey := ecdsa.PublicKey{Curve: elliptic.P256(), X: &x, Y: &y}
+	return ecdsa.Verify(&rawPubKey, tx.SignatureHash(inId, prevTXs), &r, &s)
 }
 
 // Verify verifies the signatures of transaction inputs
@@ -200,6 +409,13 @@ func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
 	curve := elliptic.P256()
 
 	for inId, in := range tx.Inputs {
+		if IsMultisigScript(in.PubKey) {
+			if !tx.verifyMultisigInput(inId, prevTXs) {
+				return false
+			}
+			continue
+		}
+
 		prevTX := prevTXs[hex.EncodeToString(in.ID)]
 		txCopy.Inputs[inId].Signature = nil
 		txCopy.Inputs[inId].PubKey = prevTX.Outputs[in.Out].PubKeyHash
@@ -233,7 +449,7 @@ func (tx *Transaction) TrimmedCopy() Transaction {
 	var outputs []TXOutput
 
 	for _, in := range tx.Inputs {
-		inputs = append(inputs, TXInput{in.ID, in.Out, nil, nil})
+		inputs = append(inputs, TXInput{in.ID, in.Out, nil, nil, in.Sequence})
 	}
 
 	for _, out := range tx.Outputs {
@@ -275,10 +491,10 @@ func NewTXOutput(value int, address string) *TXOutput {
 	return txo
 }
 
-// Lock "locks" the output with an address
+// Lock "locks" the output with an address (Base58 or bech32)
 func (out *TXOutput) Lock(address []byte) {
-	pubKeyHash := Base58Decode(address)
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
+	pubKeyHash, err := AddressToPubKeyHash(string(address))
+	Handle(err)
 	out.PubKeyHash = pubKeyHash
 }
 
@@ -287,9 +503,9 @@ func (out *TXOutput) IsLockedWithKey(pubKeyHash []byte) bool {
 	return bytes.Equal(out.PubKeyHash, pubKeyHash)
 }
 
-// UsesKey checks if the input uses the provided public key
+// UsesKey checks if the input uses the provided public key (or multisig script) hash
 func (in *TXInput) UsesKey(pubKeyHash []byte) bool {
-	lockingHash := HashPubKey(in.PubKey)
+	lockingHash := in.LockingHash()
 	return bytes.Equal(lockingHash, pubKeyHash)
 }
 
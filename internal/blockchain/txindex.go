@@ -0,0 +1,141 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Transaction index
+//
+// Every main chain transaction has a "tx-" entry mapping its ID to the hash
+// of its block and its offset in the block's transaction list, so lookups
+// read one block instead of walking the chain. Entries are written with the
+// tip whenever a block is connected and deleted when it is disconnected;
+// side chain blocks are not indexed.
+
+// txIndexPrefix keys the transaction index, by transaction ID
+var txIndexPrefix = []byte("tx-")
+
+// ErrTxNotFound is returned for transactions that are not in the main chain
+var ErrTxNotFound = errors.New("Transaction not found")
+
+// TxLocation is the place of a transaction in the main chain
+type TxLocation struct {
+	BlockHash []byte
+	Height    int
+	Offset    int // Position in the block's transactions
+}
+
+func txIndexKey(ID []byte) []byte {
+	return append(append([]byte{}, txIndexPrefix...), ID...)
+}
+
+// txIndexValue encodes a location as the block hash followed by the offset
+func txIndexValue(blockHash []byte, offset int) []byte {
+	return binary.BigEndian.AppendUint32(append([]byte{}, blockHash...), uint32(offset))
+}
+
+// indexBlock adds a block becoming the tip to the transaction and height indexes in batch
+func indexBlock(batch *leveldb.Batch, block *Block) {
+	indexTransactions(batch, block)
+	batch.Put(heightIndexKey(block.Height), block.Hash)
+}
+
+// unindexBlock removes the tip being disconnected from the transaction and height indexes in batch
+func unindexBlock(batch *leveldb.Batch, block *Block) {
+	for _, tx := range block.Transactions {
+		batch.Delete(txIndexKey(tx.ID))
+	}
+	batch.Delete(heightIndexKey(block.Height))
+}
+
+// indexTransactions adds the transactions of a block to the index in batch
+func indexTransactions(batch *leveldb.Batch, block *Block) {
+	for i, tx := range block.Transactions {
+		batch.Put(txIndexKey(tx.ID), txIndexValue(block.Hash, i))
+	}
+}
+
+// FindTransactionLocation finds a main chain transaction and its place in the chain
+func (chain *Blockchain) FindTransactionLocation(ID []byte) (Transaction, TxLocation, error) {
+	data, err := chain.Database.Get(txIndexKey(ID), nil)
+	if err == leveldb.ErrNotFound {
+		return Transaction{}, TxLocation{}, ErrTxNotFound
+	}
+	if err != nil {
+		return Transaction{}, TxLocation{}, err
+	}
+	if len(data) <= 4 {
+		return Transaction{}, TxLocation{}, fmt.Errorf("corrupt index entry of transaction %x", ID)
+	}
+
+	location := TxLocation{
+		BlockHash: data[:len(data)-4],
+		Offset:    int(binary.BigEndian.Uint32(data[len(data)-4:])),
+	}
+	block, err := chain.GetBlock(location.BlockHash)
+	if err != nil {
+		return Transaction{}, TxLocation{}, fmt.Errorf("block %x of transaction %x: %w", location.BlockHash, ID, err)
+	}
+	if location.Offset >= len(block.Transactions) || !bytes.Equal(block.Transactions[location.Offset].ID, ID) {
+		return Transaction{}, TxLocation{}, fmt.Errorf("index entry of transaction %x does not match block %d", ID, block.Height)
+	}
+	location.Height = block.Height
+
+	return *block.Transactions[location.Offset], location, nil
+}
+
+// buildTxIndex indexes every main chain transaction of a database written
+// before the index existed
+func buildTxIndex(db *leveldb.DB) error {
+	hash, err := db.Get([]byte("lh"), nil)
+	if err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	for len(hash) > 0 {
+		data, err := db.Get(hash, nil)
+		if err != nil {
+			return fmt.Errorf("block %x: %v", hash, err)
+		}
+		block := Deserialize(data)
+		indexTransactions(batch, block)
+
+		if batch.Len() >= 10000 {
+			if err := db.Write(batch, nil); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+		hash = block.PrevHash
+	}
+
+	return db.Write(batch, nil)
+}
+
+// dropTxIndex deletes the transaction index
+func dropTxIndex(db *leveldb.DB) error {
+	return deleteByPrefix(db, txIndexPrefix)
+}
+
+// deleteByPrefix deletes every key starting with prefix
+func deleteByPrefix(db *leveldb.DB, prefix []byte) error {
+	iter := db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	return db.Write(batch, nil)
+}
@@ -0,0 +1,157 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// UTXO undo data
+//
+// Connecting a block records the outputs it spends, in input order, under
+// "undo-" + block hash. Disconnecting it puts them back in the UTXO set and
+// removes the outputs it created, so a reorganization reverts the blocks it
+// rolls back one by one instead of rescanning the chain. Undo data is deleted
+// with its block when the block is disconnected or pruned.
+
+// undoPrefix keys the outputs spent by a block, by block hash
+var undoPrefix = []byte("undo-")
+
+// spentOutput is an output spent by a block, restored when it is disconnected
+type spentOutput struct {
+	TxID   []byte
+	Index  int
+	Output TXOutput
+}
+
+func undoKey(hash []byte) []byte {
+	return append(append([]byte{}, undoPrefix...), hash...)
+}
+
+// utxoUndo collects the outputs a block extending the tip spends from the
+// UTXO set and from its own transactions
+func (chain *Blockchain) utxoUndo(block *Block) ([]spentOutput, error) {
+	utxoSet := UTXOSet{Blockchain: chain}
+
+	var undo []spentOutput
+	created := make(map[string]*Transaction)
+	for _, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			for _, in := range tx.Inputs {
+				if prevTX, ok := created[hex.EncodeToString(in.ID)]; ok && in.Out >= 0 && in.Out < len(prevTX.Outputs) {
+					undo = append(undo, spentOutput{TxID: in.ID, Index: in.Out, Output: prevTX.Outputs[in.Out]})
+					continue
+				}
+				out, ok := utxoSet.FindOutput(in.ID, in.Out)
+				if !ok {
+					return nil, fmt.Errorf("output %x:%d is not in the UTXO set", in.ID, in.Out)
+				}
+				undo = append(undo, spentOutput{TxID: in.ID, Index: in.Out, Output: out})
+			}
+		}
+		created[hex.EncodeToString(tx.ID)] = tx
+	}
+	return undo, nil
+}
+
+func encodeUndo(undo []spentOutput) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(undo); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// blockUndo returns the outputs spent by a stored block: its undo data, or
+// for blocks connected before undo data was recorded, the outputs found in
+// the block itself and the chain below it
+func (chain *Blockchain) blockUndo(block *Block) ([]spentOutput, error) {
+	if data, err := chain.Database.Get(undoKey(block.Hash), nil); err == nil {
+		var undo []spentOutput
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&undo); err != nil {
+			return nil, fmt.Errorf("undo data of block %d: %w", block.Height, err)
+		}
+		return undo, nil
+	}
+
+	var spent []spentOutput
+	created := make(map[string]*Transaction)
+	for _, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			for _, in := range tx.Inputs {
+				prevTX, ok := created[hex.EncodeToString(in.ID)]
+				if !ok {
+					found, err := chain.FindTransaction(in.ID)
+					if err != nil {
+						return nil, fmt.Errorf("input %x:%d of block %d: %w", in.ID, in.Out, block.Height, err)
+					}
+					prevTX = &found
+				}
+				if in.Out < 0 || in.Out >= len(prevTX.Outputs) {
+					return nil, fmt.Errorf("transaction %x has no output %d", in.ID, in.Out)
+				}
+				spent = append(spent, spentOutput{TxID: in.ID, Index: in.Out, Output: prevTX.Outputs[in.Out]})
+			}
+		}
+		created[hex.EncodeToString(tx.ID)] = tx
+	}
+	return spent, nil
+}
+
+// undoUTXODelta returns the change disconnecting a block makes to the UTXO
+// set: the entries of its transactions are removed and the outputs it spent
+// return, except the ones it created itself
+func (chain *Blockchain) undoUTXODelta(block *Block, undo []spentOutput) (UTXODelta, error) {
+	delta := UTXODelta{BlockHash: block.Hash, Entries: make(map[string]TXOutputs)}
+	created := make(map[string]bool)
+	for _, tx := range block.Transactions {
+		delta.Entries[hex.EncodeToString(tx.ID)] = TXOutputs{}
+		created[hex.EncodeToString(tx.ID)] = true
+	}
+
+	for _, spent := range undo {
+		txID := hex.EncodeToString(spent.TxID)
+		if created[txID] {
+			continue
+		}
+		outs, ok := delta.Entries[txID]
+		if !ok {
+			data, err := chain.Database.Get(append(append([]byte{}, utxoPrefix...), spent.TxID...), nil)
+			if err == nil {
+				outs = DeserializeOutputs(data)
+			} else if err != leveldb.ErrNotFound {
+				return UTXODelta{}, err
+			}
+		}
+		delta.Entries[txID] = restoreOutput(outs, spent.Index, spent.Output)
+	}
+
+	return delta, nil
+}
+
+// restoreOutput returns outs with the output at index put back, in index order
+func restoreOutput(outs TXOutputs, index int, out TXOutput) TXOutputs {
+	restored := TXOutputs{}
+	for i, o := range outs.Outputs {
+		restored.Outputs = append(restored.Outputs, o)
+		restored.Indexes = append(restored.Indexes, outs.Index(i))
+	}
+	restored.Outputs = append(restored.Outputs, out)
+	restored.Indexes = append(restored.Indexes, index)
+
+	sort.Sort(byOutputIndex(restored))
+	return restored
+}
+
+type byOutputIndex TXOutputs
+
+func (o byOutputIndex) Len() int           { return len(o.Outputs) }
+func (o byOutputIndex) Less(i, j int) bool { return o.Indexes[i] < o.Indexes[j] }
+func (o byOutputIndex) Swap(i, j int) {
+	o.Outputs[i], o.Outputs[j] = o.Outputs[j], o.Outputs[i]
+	o.Indexes[i], o.Indexes[j] = o.Indexes[j], o.Indexes[i]
+}
@@ -3,6 +3,7 @@ package blockchain
 import (
 	"log"
 	"os"
+	"path/filepath"
 )
 
 func Handle(err error) {
@@ -13,6 +14,8 @@ func Handle(err error) {
 
 // DBexists checks if the database exists
 func DBexists() bool {
+	moveLegacyDB()
+
 	// LevelDB creates a CURRENT file in the database directory
 	if _, err := os.Stat(dbPath + "/CURRENT"); os.IsNotExist(err) {
 		return false
@@ -20,3 +23,10 @@ func DBexists() bool {
 
 	return true
 }
+
+// DataDir returns the node data directory (parent of the block database),
+// ./tmp/<network> unless BLOCKCHAIN_DATA_DIR is set
+// Node-local files such as keys and peer data are stored here
+func DataDir() string {
+	return filepath.Dir(dbPath)
+}
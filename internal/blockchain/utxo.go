@@ -2,8 +2,12 @@ package blockchain
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	"log"
+	"sort"
 
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
@@ -13,6 +17,9 @@ var (
 	prefixLength = len(utxoPrefix)
 )
 
+// cancelCheckInterval is the number of UTXO entries scanned between context checks
+const cancelCheckInterval = 256
+
 // UTXOSet represents the set of UTXOs (Unspent Transaction Outputs)
 // Similar to Bitcoin, maintains a cache of unspent outputs
 type UTXOSet struct {
@@ -37,10 +44,10 @@ func (u UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[s
 		txID := hex.EncodeToString(k)
 		outs := DeserializeOutputs(v)
 
-		for outIdx, out := range outs.Outputs {
+		for i, out := range outs.Outputs {
 			if out.IsLockedWithKey(pubKeyHash) && accumulated < amount {
 				accumulated += out.Value
-				unspentOuts[txID] = append(unspentOuts[txID], outIdx)
+				unspentOuts[txID] = append(unspentOuts[txID], outs.Index(i))
 			}
 		}
 	}
@@ -54,6 +61,12 @@ func (u UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[s
 
 // FindUTXO finds all UTXOs for a public key
 func (u UTXOSet) FindUTXO(pubKeyHash []byte) []TXOutput {
+	UTXOs, _ := u.FindUTXOContext(context.Background(), pubKeyHash)
+	return UTXOs
+}
+
+// FindUTXOContext is FindUTXO, giving up once ctx is done
+func (u UTXOSet) FindUTXOContext(ctx context.Context, pubKeyHash []byte) ([]TXOutput, error) {
 	var UTXOs []TXOutput
 
 	db := u.Blockchain.Database
@@ -61,7 +74,13 @@ func (u UTXOSet) FindUTXO(pubKeyHash []byte) []TXOutput {
 	iter := db.NewIterator(util.BytesPrefix(utxoPrefix), nil)
 	defer iter.Release()
 
-	for iter.Next() {
+	for entries := 0; iter.Next(); entries++ {
+		if entries%cancelCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+
 		v := iter.Value()
 		outs := DeserializeOutputs(v)
 
@@ -76,7 +95,17 @@ func (u UTXOSet) FindUTXO(pubKeyHash []byte) []TXOutput {
 		log.Panic(err)
 	}
 
-	return UTXOs
+	return UTXOs, nil
+}
+
+// FindOutput returns an unspent output by transaction ID and output index
+func (u UTXOSet) FindOutput(txID []byte, outIdx int) (TXOutput, bool) {
+	data, err := u.Blockchain.Database.Get(append(utxoPrefix, txID...), nil)
+	if err != nil {
+		return TXOutput{}, false
+	}
+
+	return DeserializeOutputs(data).Find(outIdx)
 }
 
 // CountTransactions returns the number of transactions in the UTXO set
@@ -98,7 +127,8 @@ func (u UTXOSet) CountTransactions() int {
 	return counter
 }
 
-// Reindex rebuilds the UTXO set
+// Reindex rebuilds the UTXO set from the blocks, to repair it: connecting
+// and disconnecting blocks keeps it up to date (see applyBlock)
 func (u UTXOSet) Reindex() {
 	db := u.Blockchain.Database
 
@@ -120,75 +150,146 @@ func (u UTXOSet) Reindex() {
 	}
 }
 
-// Update updates the UTXO set with the block's transactions
-func (u *UTXOSet) Update(block *Block) {
+// DeleteByPrefix deletes all items with a specific prefix
+func (u *UTXOSet) DeleteByPrefix(prefix []byte) {
+	db := u.Blockchain.Database
+
+	iter := db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+
+	keysToDelete := make([][]byte, 0)
+	for iter.Next() {
+		key := make([]byte, len(iter.Key()))
+		copy(key, iter.Key())
+		keysToDelete = append(keysToDelete, key)
+	}
+
+	if err := iter.Error(); err != nil {
+		log.Panic(err)
+	}
+
+	for _, key := range keysToDelete {
+		if err := db.Delete(key, nil); err != nil {
+			log.Panic(err)
+		}
+	}
+}
+
+// Commitment returns a hash committing to the whole UTXO set and the total
+// value it holds (see UTXOCommitment)
+func (u UTXOSet) Commitment() ([]byte, int) {
+	return UTXOCommitment(u.Entries())
+}
+
+// Entries loads the whole UTXO set indexed by hex transaction ID
+func (u UTXOSet) Entries() map[string]TXOutputs {
 	db := u.Blockchain.Database
+	entries := make(map[string]TXOutputs)
 
+	iter := db.NewIterator(util.BytesPrefix(utxoPrefix), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		txID := hex.EncodeToString(bytes.TrimPrefix(iter.Key(), utxoPrefix))
+		entries[txID] = DeserializeOutputs(iter.Value())
+	}
+
+	if err := iter.Error(); err != nil {
+		log.Panic(err)
+	}
+
+	return entries
+}
+
+// CommitmentAfter returns the UTXO commitment of the set obtained by applying
+// block on top of the current UTXO set, without modifying the database
+func (u UTXOSet) CommitmentAfter(block *Block) ([]byte, error) {
+	entries := u.Entries()
+	if err := applyBlockOutputs(entries, block); err != nil {
+		return nil, err
+	}
+
+	commitment, _ := UTXOCommitment(entries)
+	return commitment, nil
+}
+
+// applyBlockOutputs spends the inputs and adds the outputs of block to entries
+func applyBlockOutputs(entries map[string]TXOutputs, block *Block) error {
 	for _, tx := range block.Transactions {
-		if tx.IsCoinbase() == false {
+		if !tx.IsCoinbase() {
 			for _, in := range tx.Inputs {
-				updatedOuts := TXOutputs{}
-				inID := append(utxoPrefix, in.ID...)
-				
-				v, err := db.Get(inID, nil)
-				if err != nil {
-					log.Panic(err)
-				}
+				inID := hex.EncodeToString(in.ID)
 
-				outs := DeserializeOutputs(v)
+				outs, ok := entries[inID]
+				if !ok {
+					return fmt.Errorf("input %s:%d is not in the UTXO set", inID, in.Out)
+				}
 
-				for outIdx, out := range outs.Outputs {
-					if outIdx != in.Out {
-						updatedOuts.Outputs = append(updatedOuts.Outputs, out)
+				updated := TXOutputs{}
+				spent := false
+				for i, out := range outs.Outputs {
+					if outs.Index(i) == in.Out {
+						spent = true
+						continue
 					}
+					updated.Outputs = append(updated.Outputs, out)
+					updated.Indexes = append(updated.Indexes, outs.Index(i))
+				}
+				if !spent {
+					return fmt.Errorf("input %s:%d is not in the UTXO set", inID, in.Out)
 				}
 
-				if len(updatedOuts.Outputs) == 0 {
-					if err := db.Delete(inID, nil); err != nil {
-						log.Panic(err)
-					}
+				if len(updated.Outputs) == 0 {
+					delete(entries, inID)
 				} else {
-					if err := db.Put(inID, updatedOuts.Serialize(), nil); err != nil {
-						log.Panic(err)
-					}
+					entries[inID] = updated
 				}
 			}
 		}
 
-		newOutputs := TXOutputs{}
-		for _, out := range tx.Outputs {
-			newOutputs.Outputs = append(newOutputs.Outputs, out)
+		outs := TXOutputs{}
+		for outIdx, out := range tx.Outputs {
+			if out.IsDataCarrier() {
+				continue
+			}
+			outs.Outputs = append(outs.Outputs, out)
+			outs.Indexes = append(outs.Indexes, outIdx)
 		}
-
-		txID := append(utxoPrefix, tx.ID...)
-		if err := db.Put(txID, newOutputs.Serialize(), nil); err != nil {
-			log.Panic(err)
+		if len(outs.Outputs) > 0 {
+			entries[hex.EncodeToString(tx.ID)] = outs
 		}
 	}
-}
 
-// DeleteByPrefix deletes all items with a specific prefix
-func (u *UTXOSet) DeleteByPrefix(prefix []byte) {
-	db := u.Blockchain.Database
-
-	iter := db.NewIterator(util.BytesPrefix(prefix), nil)
-	defer iter.Release()
+	return nil
+}
 
-	keysToDelete := make([][]byte, 0)
-	for iter.Next() {
-		key := make([]byte, len(iter.Key()))
-		copy(key, iter.Key())
-		keysToDelete = append(keysToDelete, key)
+// UTXOCommitment hashes a UTXO set and sums the value it holds
+// Entries are hashed in txid order with a canonical encoding (txid, then
+// value and public key hash of each output) so independent nodes, and
+// fast-sync clients checking a snapshot, compute the same commitment
+func UTXOCommitment(entries map[string]TXOutputs) ([]byte, int) {
+	txIDs := make([]string, 0, len(entries))
+	for txID := range entries {
+		txIDs = append(txIDs, txID)
 	}
+	sort.Strings(txIDs)
 
-	if err := iter.Error(); err != nil {
-		log.Panic(err)
-	}
+	hasher := sha256.New()
+	supply := 0
 
-	for _, key := range keysToDelete {
-		if err := db.Delete(key, nil); err != nil {
+	for _, txID := range txIDs {
+		rawID, err := hex.DecodeString(txID)
+		if err != nil {
 			log.Panic(err)
 		}
+		hasher.Write(rawID)
+
+		for _, out := range entries[txID].Outputs {
+			hasher.Write(toHex(int64(out.Value)))
+			hasher.Write(out.PubKeyHash)
+			supply += out.Value
+		}
 	}
-}
 
+	return hasher.Sum(nil), supply
+}
@@ -0,0 +1,170 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// UTXODelta is the change a block makes to the UTXO set: the outputs left in
+// every entry the block touches, keyed by hex transaction ID, with an empty
+// entry when the block removes it
+// Trusted replicas apply deltas instead of computing them from the block
+type UTXODelta struct {
+	BlockHash []byte
+	Entries   map[string]TXOutputs
+}
+
+// touchedUTXOEntries returns the hex transaction IDs whose UTXO entry a block
+// may change: the transactions it spends from and the ones it creates
+func touchedUTXOEntries(block *Block) map[string]bool {
+	touched := make(map[string]bool)
+	for _, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			for _, in := range tx.Inputs {
+				touched[hex.EncodeToString(in.ID)] = true
+			}
+		}
+		touched[hex.EncodeToString(tx.ID)] = true
+	}
+	return touched
+}
+
+// UTXODeltaFor returns the delta of block, which must be the current tip
+// The delta is read from the UTXO set after the block was connected
+func (chain *Blockchain) UTXODeltaFor(block *Block) (UTXODelta, error) {
+	chain.state.RLock()
+	defer chain.state.RUnlock()
+
+	if !bytes.Equal(chain.LastHash, block.Hash) {
+		return UTXODelta{}, fmt.Errorf("block %d is no longer the tip", block.Height)
+	}
+
+	delta := UTXODelta{BlockHash: block.Hash, Entries: make(map[string]TXOutputs)}
+	for txID := range touchedUTXOEntries(block) {
+		rawID, _ := hex.DecodeString(txID)
+
+		data, err := chain.Database.Get(append(utxoPrefix, rawID...), nil)
+		switch {
+		case err == leveldb.ErrNotFound:
+			delta.Entries[txID] = TXOutputs{}
+		case err != nil:
+			return UTXODelta{}, err
+		default:
+			delta.Entries[txID] = DeserializeOutputs(data)
+		}
+	}
+
+	return delta, nil
+}
+
+// blockUTXODelta returns the delta of a block extending the tip, computed
+// from the current UTXO set
+func (chain *Blockchain) blockUTXODelta(block *Block) (UTXODelta, error) {
+	touched := touchedUTXOEntries(block)
+
+	entries := make(map[string]TXOutputs)
+	for txID := range touched {
+		rawID, _ := hex.DecodeString(txID)
+
+		data, err := chain.Database.Get(append(append([]byte{}, utxoPrefix...), rawID...), nil)
+		switch {
+		case err == leveldb.ErrNotFound:
+		case err != nil:
+			return UTXODelta{}, err
+		default:
+			entries[txID] = DeserializeOutputs(data)
+		}
+	}
+	if err := applyBlockOutputs(entries, block); err != nil {
+		return UTXODelta{}, fmt.Errorf("block %d: %w", block.Height, err)
+	}
+
+	delta := UTXODelta{BlockHash: block.Hash, Entries: make(map[string]TXOutputs)}
+	for txID := range touched {
+		delta.Entries[txID] = entries[txID]
+	}
+	return delta, nil
+}
+
+// writeUTXODelta adds the UTXO entries of a delta to batch, deleting the
+// emptied ones
+func writeUTXODelta(batch *leveldb.Batch, delta UTXODelta) error {
+	for txID, outs := range delta.Entries {
+		rawID, err := hex.DecodeString(txID)
+		if err != nil {
+			return fmt.Errorf("invalid UTXO entry %s", txID)
+		}
+
+		key := append(append([]byte{}, utxoPrefix...), rawID...)
+		if len(outs.Outputs) == 0 {
+			batch.Delete(key)
+		} else {
+			batch.Put(key, outs.Serialize())
+		}
+	}
+	return nil
+}
+
+// ConnectBlockWithDelta stores a block as the new tip and applies its UTXO
+// delta instead of computing it
+// Only deltas from a trusted node may be applied: beyond linking to the tip
+// and touching exactly the entries of the block, neither the block nor the
+// delta is validated
+func (chain *Blockchain) ConnectBlockWithDelta(block *Block, delta UTXODelta) error {
+	chain.state.Lock()
+	defer chain.state.Unlock()
+
+	if !bytes.Equal(block.PrevHash, chain.LastHash) {
+		return fmt.Errorf("block %d does not extend the current tip", block.Height)
+	}
+	if !bytes.Equal(delta.BlockHash, block.Hash) {
+		return fmt.Errorf("delta is for block %x, not %x", delta.BlockHash, block.Hash)
+	}
+
+	if err := chain.checkCoinbaseReward(block); err != nil {
+		return err
+	}
+
+	touched := touchedUTXOEntries(block)
+	if len(touched) != len(delta.Entries) {
+		return fmt.Errorf("delta touches %d UTXO entries, block %d touches %d", len(delta.Entries), block.Height, len(touched))
+	}
+
+	undo, err := chain.utxoUndo(block)
+	if err != nil {
+		return err
+	}
+	data, err := encodeUndo(undo)
+	if err != nil {
+		return err
+	}
+
+	// Block, tip, undo data, index and UTXO entries are written atomically
+	batch := new(leveldb.Batch)
+	batch.Put(block.Hash, block.Serialize())
+	batch.Put([]byte("lh"), block.Hash)
+	batch.Put(undoKey(block.Hash), data)
+	indexBlock(batch, block)
+	if err := chain.indexAddresses(batch, block, undo); err != nil {
+		return err
+	}
+
+	for txID := range delta.Entries {
+		if !touched[txID] {
+			return fmt.Errorf("delta touches UTXO entry %s outside block %d", txID, block.Height)
+		}
+	}
+	if err := writeUTXODelta(batch, delta); err != nil {
+		return err
+	}
+
+	if err := chain.Database.Write(batch, nil); err != nil {
+		return err
+	}
+	chain.LastHash = block.Hash
+
+	return nil
+}
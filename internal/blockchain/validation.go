@@ -0,0 +1,130 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Transaction rejection codes
+const (
+	RejectMalformed         = "MALFORMED"
+	RejectCoinbase          = "COINBASE_NOT_ALLOWED"
+	RejectEmpty             = "EMPTY_INPUTS_OR_OUTPUTS"
+	RejectInvalidValue      = "INVALID_OUTPUT_VALUE"
+	RejectDuplicateInput    = "DUPLICATE_INPUT"
+	RejectMissingInputs     = "MISSING_INPUTS"
+	RejectKeyMismatch       = "INPUT_KEY_MISMATCH"
+	RejectInvalidSignature  = "INVALID_SIGNATURE"
+	RejectInsufficientInput = "OUTPUTS_EXCEED_INPUTS"
+	RejectAlreadyKnown      = "ALREADY_IN_MEMPOOL"
+	RejectMempoolFull       = "MEMPOOL_FULL"
+	RejectMempoolConflict   = "MEMPOOL_CONFLICT"
+	RejectNonFinal          = "NON_FINAL"
+)
+
+// ErrInsufficientFunds is wrapped by the errors of transactions the wallet
+// outputs cannot pay for
+var ErrInsufficientFunds = errors.New("not enough funds")
+
+// TxRejectError explains why a transaction was not accepted
+type TxRejectError struct {
+	Code   string
+	Reason string
+}
+
+func (e *TxRejectError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Reason)
+}
+
+// rejectTx creates a TxRejectError
+func rejectTx(code, format string, args ...interface{}) *TxRejectError {
+	return &TxRejectError{Code: code, Reason: fmt.Sprintf(format, args...)}
+}
+
+// CheckTransactionSanity runs the context-free checks on a non-coinbase transaction
+func CheckTransactionSanity(tx *Transaction) error {
+	if tx.IsCoinbase() {
+		return rejectTx(RejectCoinbase, "coinbase transactions are only valid in blocks")
+	}
+
+	if len(tx.Inputs) == 0 || len(tx.Outputs) == 0 {
+		return rejectTx(RejectEmpty, "transaction has %d inputs and %d outputs", len(tx.Inputs), len(tx.Outputs))
+	}
+
+	dataOutputs := 0
+	for i, out := range tx.Outputs {
+		if out.IsDataCarrier() {
+			if out.Value != 0 {
+				return rejectTx(RejectInvalidValue, "data-carrier output %d has value %d", i, out.Value)
+			}
+			if dataOutputs++; dataOutputs > 1 {
+				return rejectTx(RejectMalformed, "more than one data-carrier output")
+			}
+			continue
+		}
+		if out.Value <= 0 {
+			return rejectTx(RejectInvalidValue, "output %d has value %d", i, out.Value)
+		}
+	}
+
+	spent := make(map[string]bool)
+	for i, in := range tx.Inputs {
+		outpoint := fmt.Sprintf("%x:%d", in.ID, in.Out)
+		if spent[outpoint] {
+			return rejectTx(RejectDuplicateInput, "input %d spends %s twice", i, outpoint)
+		}
+		spent[outpoint] = true
+	}
+
+	return nil
+}
+
+// CheckTransactionInputs checks a transaction against the UTXO set:
+// every input must spend an existing unspent output owned by the signing key,
+// signatures must be valid, outputs must not exceed inputs and relative
+// lock-times must allow the transaction in the next block
+// On success it returns the transaction fee
+func (chain *Blockchain) CheckTransactionInputs(tx *Transaction) (int, error) {
+	utxoSet := UTXOSet{chain}
+	prevTXs := make(map[string]Transaction)
+	inputTotal := 0
+
+	for i, in := range tx.Inputs {
+		prevOut, ok := utxoSet.FindOutput(in.ID, in.Out)
+		if !ok {
+			return 0, rejectTx(RejectMissingInputs, "input %d spends unknown or spent output %x:%d", i, in.ID, in.Out)
+		}
+
+		if !bytes.Equal(in.LockingHash(), prevOut.PubKeyHash) {
+			return 0, rejectTx(RejectKeyMismatch, "input %d public key does not own output %x:%d", i, in.ID, in.Out)
+		}
+
+		prevTX, err := chain.FindTransaction(in.ID)
+		if err != nil {
+			return 0, rejectTx(RejectMissingInputs, "input %d references unknown transaction %x", i, in.ID)
+		}
+		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
+		inputTotal += prevOut.Value
+	}
+
+	if err := chain.CheckSequenceLocks(tx, chain.GetBestHeight()+1); err != nil {
+		return 0, rejectTx(RejectNonFinal, "%v", err)
+	}
+
+	if !tx.Verify(prevTXs) {
+		return 0, rejectTx(RejectInvalidSignature, "signature verification failed")
+	}
+
+	outputTotal := 0
+	for _, out := range tx.Outputs {
+		outputTotal += out.Value
+	}
+
+	if outputTotal > inputTotal {
+		return 0, rejectTx(RejectInsufficientInput, "outputs (%d) exceed inputs (%d)", outputTotal, inputTotal)
+	}
+
+	return inputTotal - outputTotal, nil
+}
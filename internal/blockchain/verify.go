@@ -0,0 +1,99 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+)
+
+// VerifyChain checks every block of the main chain from genesis to tip:
+// height sequence, previous hash links, merkle root, block hash, proof of
+// work and input signatures (the header only for pruned blocks)
+// progress, if not nil, is called after each block with (verified, total)
+func (chain *Blockchain) VerifyChain(progress func(done, total int)) error {
+	return chain.VerifyChainContext(context.Background(), progress)
+}
+
+// VerifyChainContext is VerifyChain, stopping with ctx.Err() once ctx is done
+func (chain *Blockchain) VerifyChainContext(ctx context.Context, progress func(done, total int)) error {
+	hashes := chain.GetBlockHashes()
+	total := len(hashes)
+
+	var prev *Block
+	for i := total - 1; i >= 0; i-- {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		block, err := chain.GetBlock(hashes[i])
+		if err != nil {
+			return fmt.Errorf("block %x: %v", hashes[i], err)
+		}
+
+		if err := chain.verifyBlock(&block, prev); err != nil {
+			return fmt.Errorf("block %d (%x): %v", block.Height, block.Hash, err)
+		}
+
+		prev = &block
+		if progress != nil {
+			progress(total-i, total)
+		}
+	}
+
+	return nil
+}
+
+// verifyBlock checks a single stored block against its parent (nil for genesis)
+func (chain *Blockchain) verifyBlock(block, prev *Block) error {
+	if prev == nil {
+		if block.Height != 0 || len(block.PrevHash) != 0 {
+			return fmt.Errorf("chain does not start with a genesis block")
+		}
+	} else {
+		if block.Height != prev.Height+1 {
+			return fmt.Errorf("height %d does not follow %d", block.Height, prev.Height)
+		}
+		if !bytes.Equal(block.PrevHash, prev.Hash) {
+			return fmt.Errorf("previous hash does not match block %d", prev.Height)
+		}
+	}
+
+	// Pruned blocks only keep their header and the transactions with unspent outputs
+	pruned := chain.IsPruned(block.Height)
+
+	if !pruned && !bytes.Equal(block.MerkleRoot, block.HashTransactions()) {
+		return fmt.Errorf("merkle root does not match transactions")
+	}
+
+	if required := chain.Params.RequiredDifficulty(block.Height); block.Difficulty != required {
+		return fmt.Errorf("difficulty %d, the network requires %d", block.Difficulty, required)
+	}
+	pow := NewProofWithDifficulty(block, block.Difficulty)
+	hash := sha256.Sum256(pow.InitData(block.Nonce))
+	if !bytes.Equal(block.Hash, hash[:]) {
+		return fmt.Errorf("stored hash does not match header")
+	}
+	if !pow.Validate() {
+		return fmt.Errorf("proof of work does not meet difficulty %d", block.Difficulty)
+	}
+
+	if pruned {
+		return nil
+	}
+
+	if err := chain.checkCoinbaseReward(block); err != nil {
+		return err
+	}
+
+	for _, tx := range block.Transactions {
+		if !chain.VerifyTransaction(tx) {
+			return fmt.Errorf("transaction %x has invalid signatures", tx.ID)
+		}
+		if err := chain.CheckSequenceLocks(tx, block.Height); err != nil {
+			return fmt.Errorf("transaction %x: %v", tx.ID, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,225 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"sync"
+)
+
+// Block versions and soft-fork signaling
+//
+// Block.Version is hashed in the header. The zero value is a legacy block
+// whose header hashes exactly like before versions existed. Versioned blocks
+// carry VersionBitsTopBits in their top three bits and may set one of the 29
+// low bits to signal readiness for a deployment (a consensus rule change).
+// A deployment signaled by Threshold percent of the blocks of a window locks
+// in, and its rules are active from the following window on. Blocks carrying
+// a version are only relayed to peers speaking VersionBitsProtocolVersion or
+// later, since older nodes drop the field when decoding and compute a
+// different hash.
+const (
+	VersionBitsTopBits = uint32(0x20000000)
+	VersionBitsTopMask = uint32(0xe0000000)
+
+	// VersionBitsProtocolVersion is the first network protocol version that
+	// carries block versions
+	VersionBitsProtocolVersion = 3
+)
+
+// DeploymentState is the activation state of a deployment for a block
+type DeploymentState string
+
+const (
+	DeploymentDefined  DeploymentState = "defined"   // Before StartHeight, bit not signaled
+	DeploymentStarted  DeploymentState = "started"   // Miners signal, the threshold was not met yet
+	DeploymentLockedIn DeploymentState = "locked_in" // Threshold met, active from the next window
+	DeploymentActive   DeploymentState = "active"    // Rules enforced
+)
+
+// Deployment is a consensus rule change activated by version bits signaling
+type Deployment struct {
+	Name        string
+	Bit         uint // Version bit signaling readiness (0-28)
+	StartHeight int  // Signaling starts with the first window at or after it
+	Window      int  // Blocks per signaling window
+	Threshold   int  // Percent of a window's blocks that must signal
+}
+
+// Signals reports whether a block signals readiness for the deployment
+func (d Deployment) Signals(block *Block) bool {
+	return block.Version&VersionBitsTopMask == VersionBitsTopBits && block.Version&(1<<d.Bit) != 0
+}
+
+// deploymentStates caches the state of each deployment for the window
+// following a window's last block, by deployment name and block hash
+var deploymentStates = struct {
+	states map[string]DeploymentState
+	mu     sync.Mutex
+}{states: make(map[string]DeploymentState)}
+
+func deploymentStateKey(d Deployment, hash []byte) string {
+	return d.Name + ":" + hex.EncodeToString(hash)
+}
+
+// DeploymentState returns the state of a deployment for the block following prevHash
+// States only change at window boundaries, they are computed from the last
+// block of each window and cached
+func (chain *Blockchain) DeploymentState(d Deployment, prevHash []byte) (DeploymentState, error) {
+	if len(prevHash) == 0 {
+		return DeploymentDefined, nil
+	}
+
+	prev, err := chain.GetBlock(prevHash)
+	if err != nil {
+		return "", err
+	}
+
+	parent := func(block *Block) (*Block, error) {
+		if len(block.PrevHash) == 0 {
+			return nil, nil
+		}
+		p, err := chain.GetBlock(block.PrevHash)
+		if err != nil {
+			return nil, err
+		}
+		return &p, nil
+	}
+
+	// Walk back to the last block of the previous window
+	block := &prev
+	for block != nil && block.Height%d.Window != d.Window-1 {
+		if block, err = parent(block); err != nil {
+			return "", err
+		}
+	}
+
+	// Collect the window ends without a cached state, counting their signals
+	type windowEnd struct {
+		block   *Block
+		signals int
+	}
+	var pending []windowEnd
+	state := DeploymentDefined
+
+	for block != nil {
+		deploymentStates.mu.Lock()
+		cached, ok := deploymentStates.states[deploymentStateKey(d, block.Hash)]
+		deploymentStates.mu.Unlock()
+		if ok {
+			state = cached
+			break
+		}
+
+		end := windowEnd{block: block}
+		for i := 0; i < d.Window && block != nil; i++ {
+			if d.Signals(block) {
+				end.signals++
+			}
+			if block, err = parent(block); err != nil {
+				return "", err
+			}
+		}
+		pending = append(pending, end)
+	}
+
+	for i := len(pending) - 1; i >= 0; i-- {
+		end := pending[i]
+		switch state {
+		case DeploymentDefined:
+			if end.block.Height+1 >= d.StartHeight {
+				state = DeploymentStarted
+			}
+		case DeploymentStarted:
+			if end.signals*100 >= d.Threshold*d.Window {
+				state = DeploymentLockedIn
+			}
+		case DeploymentLockedIn:
+			state = DeploymentActive
+		}
+
+		deploymentStates.mu.Lock()
+		deploymentStates.states[deploymentStateKey(d, end.block.Hash)] = state
+		deploymentStates.mu.Unlock()
+	}
+
+	return state, nil
+}
+
+// IsDeploymentActive reports whether the rules of a deployment apply to the
+// block following prevHash (false for unknown deployments)
+func (chain *Blockchain) IsDeploymentActive(name string, prevHash []byte) bool {
+	for _, d := range chain.Params.Deployments {
+		if d.Name == name {
+			state, err := chain.DeploymentState(d, prevHash)
+			return err == nil && state == DeploymentActive
+		}
+	}
+	return false
+}
+
+// ComputeBlockVersion returns the version for a block mined on top of
+// prevHash: the version bits prefix and the bits of the deployments that
+// are signaling (started or locked in)
+func (chain *Blockchain) ComputeBlockVersion(prevHash []byte) (uint32, error) {
+	version := VersionBitsTopBits
+	for _, d := range chain.Params.Deployments {
+		state, err := chain.DeploymentState(d, prevHash)
+		if err != nil {
+			return 0, err
+		}
+		if state == DeploymentStarted || state == DeploymentLockedIn {
+			version |= 1 << d.Bit
+		}
+	}
+	return version, nil
+}
+
+// DeploymentStatus describes a deployment for the block following the tip
+type DeploymentStatus struct {
+	Deployment
+	State       DeploymentState
+	WindowStart int // Height of the first block of the current window
+	Signals     int // Blocks of the current window that signaled so far
+}
+
+// DeploymentStatuses returns the status of every deployment at the tip
+func (chain *Blockchain) DeploymentStatuses() ([]DeploymentStatus, error) {
+	chain.state.RLock()
+	tipHash := chain.LastHash
+	chain.state.RUnlock()
+
+	tip, err := chain.GetBlock(tipHash)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []DeploymentStatus
+	for _, d := range chain.Params.Deployments {
+		state, err := chain.DeploymentState(d, tipHash)
+		if err != nil {
+			return nil, err
+		}
+
+		status := DeploymentStatus{Deployment: d, State: state}
+		next := tip.Height + 1
+		status.WindowStart = next - next%d.Window
+
+		block := &tip
+		for block != nil && block.Height >= status.WindowStart {
+			if d.Signals(block) {
+				status.Signals++
+			}
+			if len(block.PrevHash) == 0 {
+				break
+			}
+			parent, err := chain.GetBlock(block.PrevHash)
+			if err != nil {
+				return nil, err
+			}
+			block = &parent
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
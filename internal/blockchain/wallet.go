@@ -8,10 +8,11 @@ import (
 	"crypto/sha256"
 	"encoding/gob"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"math/big"
 	"os"
+	"path/filepath"
+	"time"
 
 	"golang.org/x/crypto/ripemd160"
 )
@@ -21,17 +22,16 @@ const (
 	version        = byte(0x00) // Address version (similar to Bitcoin)
 )
 
-// getWalletFile returns the wallet file path, checking for Docker environment first
-func getWalletFile() string {
+// getWalletDir returns the directory of the wallet keystore, checking for Docker environment first
+func getWalletDir() string {
 	// Check if we're in Docker environment by looking for the data directory
-	dockerPath := "/app/data/tmp/wallets.dat"
 	dockerDir := "/app/data/tmp"
 
 	// Create directory if it doesn't exist (Docker environment)
 	if _, err := os.Stat("/app/data"); err == nil {
 		os.MkdirAll(dockerDir, 0755)
-		log.Printf("🔑 Using Docker wallet path: %s", dockerPath)
-		return dockerPath
+		log.Printf("🔑 Using Docker wallet path: %s", filepath.Join(dockerDir, keystoreFile))
+		return dockerDir
 	}
 
 	// Fallback to local development path
@@ -39,14 +39,19 @@ func getWalletFile() string {
 	if _, err := os.Stat("./tmp"); os.IsNotExist(err) {
 		os.MkdirAll("./tmp", 0755)
 	}
-	log.Printf("🔑 Using local wallet path: ./tmp/wallets.dat")
-	return "./tmp/wallets.dat"
+	log.Printf("🔑 Using local wallet path: ./tmp/%s", keystoreFile)
+	return "./tmp"
 }
 
 // Wallet stores private and public keys (ECDSA cryptography)
 type Wallet struct {
 	PrivateKey ecdsa.PrivateKey
 	PublicKey  []byte
+	Path       string // HD derivation path (empty for standalone keys)
+	Label      string
+	Note       string
+	CreatedAt  int64  // Unix time, 0 for wallets created before it was recorded
+	ChangeOf   string // Address whose change this key receives (empty = not a change address)
 }
 
 // serializableWallet is a serializable version of Wallet
@@ -55,20 +60,41 @@ type serializableWallet struct {
 	X         []byte
 	Y         []byte
 	PublicKey []byte
+	Path      string
+	Label     string
+	Note      string
+	CreatedAt int64
 }
 
+// MaxLabelLength and MaxNoteLength bound the metadata stored per address
+const (
+	MaxLabelLength = 64
+	MaxNoteLength  = 1024
+)
+
 // Wallets stores a collection of wallets
 type Wallets struct {
-	Wallets map[string]*Wallet
+	Wallets           map[string]*Wallet
+	HDSeed            []byte            // Seed of derived addresses (nil = standalone keys only)
+	HDNextIndex       uint32            // Next child index under DefaultHDPath
+	HDNextChangeIndex uint32            // Next child index under DefaultHDChangePath
+	Multisig          map[string][]byte // Multisig address -> redeem script
+	Frozen            *FrozenOutputs    // Outputs coin selection never spends (lockunspent)
+
+	FreshChange bool // Send change to a new change address (not stored, set by NewWallets)
 }
 
-// MarshalBinary implements encoding.BinaryMarshaler
+// MarshalBinary implements encoding.BinaryMarshaler (legacy wallets.dat format)
 func (w *Wallet) MarshalBinary() ([]byte, error) {
 	sw := serializableWallet{
 		D:         w.PrivateKey.D.Bytes(),
 		X:         w.PrivateKey.X.Bytes(),
 		Y:         w.PrivateKey.Y.Bytes(),
 		PublicKey: w.PublicKey,
+		Path:      w.Path,
+		Label:     w.Label,
+		Note:      w.Note,
+		CreatedAt: w.CreatedAt,
 	}
 
 	var buf bytes.Buffer
@@ -77,7 +103,7 @@ func (w *Wallet) MarshalBinary() ([]byte, error) {
 	return buf.Bytes(), err
 }
 
-// UnmarshalBinary implements encoding.BinaryUnmarshaler
+// UnmarshalBinary implements encoding.BinaryUnmarshaler (legacy wallets.dat format)
 func (w *Wallet) UnmarshalBinary(data []byte) error {
 	var sw serializableWallet
 	buf := bytes.NewReader(data)
@@ -92,6 +118,10 @@ func (w *Wallet) UnmarshalBinary(data []byte) error {
 	w.PrivateKey.X = new(big.Int).SetBytes(sw.X)
 	w.PrivateKey.Y = new(big.Int).SetBytes(sw.Y)
 	w.PublicKey = sw.PublicKey
+	w.Path = sw.Path
+	w.Label = sw.Label
+	w.Note = sw.Note
+	w.CreatedAt = sw.CreatedAt
 
 	return nil
 }
@@ -99,16 +129,25 @@ func (w *Wallet) UnmarshalBinary(data []byte) error {
 // NewWallet creates a new wallet
 func NewWallet() *Wallet {
 	private, public := newKeyPair()
-	wallet := Wallet{private, public}
+	wallet := Wallet{PrivateKey: private, PublicKey: public, CreatedAt: time.Now().Unix()}
 
 	return &wallet
 }
 
 // Address returns the wallet address (similar to Bitcoin addresses)
 func (w Wallet) Address() []byte {
-	pubHash := HashPubKey(w.PublicKey)
+	return PubKeyHashToAddress(HashPubKey(w.PublicKey))
+}
 
-	versionedHash := append([]byte{version}, pubHash...)
+// PubKeyHashToAddress encodes a public key hash as a Base58 address
+// Multisig script hashes get the multisig address version
+func PubKeyHashToAddress(pubHash []byte) []byte {
+	addressVersion := version
+	if len(pubHash) == multisigHashLength {
+		addressVersion = multisigVersion
+	}
+
+	versionedHash := append([]byte{addressVersion}, pubHash...)
 	checksum := Checksum(versionedHash)
 
 	fullHash := append(versionedHash, checksum...)
@@ -152,21 +191,18 @@ func Checksum(payload []byte) []byte {
 	return secondSHA[:checksumLength]
 }
 
-// ValidateAddress validates a Bitcoin-like address
+// ValidateAddress validates a Bitcoin-like address, in Base58 or bech32 format
 func ValidateAddress(address string) bool {
-	pubKeyHash := Base58Decode([]byte(address))
-	actualChecksum := pubKeyHash[len(pubKeyHash)-checksumLength:]
-	version := pubKeyHash[0]
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-checksumLength]
-	targetChecksum := Checksum(append([]byte{version}, pubKeyHash...))
-
-	return bytes.Equal(actualChecksum, targetChecksum)
+	_, err := AddressToPubKeyHash(address)
+	return err == nil
 }
 
 // NewWallets creates a new collection of wallets
 func NewWallets() (*Wallets, error) {
 	wallets := Wallets{}
 	wallets.Wallets = make(map[string]*Wallet)
+	wallets.Frozen = NewFrozenOutputs()
+	wallets.FreshChange = true
 
 	err := wallets.LoadFile()
 
@@ -188,6 +224,29 @@ func (ws Wallets) GetWallet(address string) Wallet {
 	return *ws.Wallets[address]
 }
 
+// SetLabel sets the label and note of a wallet address (Base58 or bech32)
+func (ws *Wallets) SetLabel(address, label, note string) error {
+	if len(label) > MaxLabelLength {
+		return fmt.Errorf("label is longer than %d characters", MaxLabelLength)
+	}
+	if len(note) > MaxNoteLength {
+		return fmt.Errorf("note is longer than %d characters", MaxNoteLength)
+	}
+
+	base58, err := ToBase58Address(address)
+	if err != nil {
+		return err
+	}
+	wallet, ok := ws.Wallets[base58]
+	if !ok {
+		return fmt.Errorf("address %s is not in the wallet", address)
+	}
+
+	wallet.Label = label
+	wallet.Note = note
+	return nil
+}
+
 // GetAllAddresses returns all wallet addresses
 func (ws *Wallets) GetAllAddresses() []string {
 	var addresses []string
@@ -199,44 +258,24 @@ func (ws *Wallets) GetAllAddresses() []string {
 	return addresses
 }
 
-// LoadFile loads wallets from file
+// LoadFile loads wallets from the keystore, migrating a legacy wallets.dat on first load
 func (ws *Wallets) LoadFile() error {
-	walletFilePath := getWalletFile()
-	if _, err := os.Stat(walletFilePath); os.IsNotExist(err) {
-		return err
-	}
+	dir := getWalletDir()
 
-	var wallets Wallets
-
-	fileContent, err := ioutil.ReadFile(walletFilePath)
-	if err != nil {
-		return err
-	}
-
-	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
-	err = decoder.Decode(&wallets)
-	if err != nil {
+	path := filepath.Join(dir, keystoreFile)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if _, legacyErr := os.Stat(filepath.Join(dir, legacyWalletFile)); legacyErr == nil {
+			return ws.migrateLegacyWallets(dir)
+		}
 		return err
 	}
 
-	ws.Wallets = wallets.Wallets
-
-	return nil
+	return ws.loadKeystore(path)
 }
 
-// SaveFile saves wallets to file
+// SaveFile saves wallets to the keystore
 func (ws *Wallets) SaveFile() {
-	var content bytes.Buffer
-
-	encoder := gob.NewEncoder(&content)
-	err := encoder.Encode(ws)
-	if err != nil {
-		log.Panic(err)
-	}
-
-	walletFilePath := getWalletFile()
-	err = ioutil.WriteFile(walletFilePath, content.Bytes(), 0644)
-	if err != nil {
+	if err := ws.saveKeystore(filepath.Join(getWalletDir(), keystoreFile)); err != nil {
 		log.Panic(err)
 	}
 }
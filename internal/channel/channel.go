@@ -0,0 +1,420 @@
+// Package channel implements unidirectional payment channels
+//
+// The payer opens a channel by locking funds in a 2-of-2 multisig output of
+// payer and payee, pays by signing balance updates off-chain and the payee
+// closes it by broadcasting the latest balance. If the payee disappears the
+// payer reclaims the funds with a refund that only becomes valid after a
+// relative timeout (see blockchain/channel.go for the transactions).
+//
+// Nodes do not talk to each other about channels: the parties relay the
+// messages (Proposal, refund signature, Update) between the APIs of their
+// nodes, as with co-signing sessions.
+package channel
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// Role is the side of the channel the local node is on
+type Role string
+
+const (
+	RolePayer Role = "payer"
+	RolePayee Role = "payee"
+)
+
+// Status is the lifecycle state of a channel
+type Status string
+
+const (
+	StatusOpening Status = "opening" // Payer waiting for the payee to sign the refund
+	StatusOpen    Status = "open"
+	StatusClosed  Status = "closed" // Closing transaction broadcast or funding output spent
+)
+
+// CloseMargin is how many blocks before the refund becomes valid the payee
+// closes a channel on its own
+const CloseMargin = 3
+
+// Channel is the state of a payment channel kept by one party
+type Channel struct {
+	ID             string `json:"id"` // Funding transaction ID (hex)
+	Role           Role   `json:"role"`
+	Status         Status `json:"status"`
+	Payer          string `json:"payer"`
+	Payee          string `json:"payee"`
+	Capacity       int    `json:"capacity"`
+	Timeout        int    `json:"timeout"` // Refund lock-time in blocks
+	Script         []byte `json:"script"`  // 2-of-2 redeem script
+	Funding        []byte `json:"funding"` // Serialized funding transaction
+	FundingOutput  int    `json:"funding_output"`
+	Refund         []byte `json:"refund,omitempty"` // Serialized refund (payer only, fully signed once open)
+	Paid           int    `json:"paid"`             // Balance of the payee in the latest update
+	Sequence       int    `json:"sequence"`         // Number of the latest update
+	PayerSignature []byte `json:"payer_signature,omitempty"`
+	CloseTxID      string `json:"close_txid,omitempty"`
+	CreatedAt      int64  `json:"created_at"`
+	UpdatedAt      int64  `json:"updated_at"`
+}
+
+// Proposal is sent by the payer to the payee to open a channel
+type Proposal struct {
+	Payer       string `json:"payer"`
+	PayerPubKey string `json:"payer_pubkey"` // Hex
+	Payee       string `json:"payee"`
+	Timeout     int    `json:"timeout"`
+	Funding     string `json:"funding"` // Hex serialized funding transaction, signed by the payer
+}
+
+// Update is a payment sent by the payer to the payee
+type Update struct {
+	Channel   string `json:"channel"`
+	Sequence  int    `json:"sequence"`
+	Paid      int    `json:"paid"`      // Total paid to the payee so far
+	Signature string `json:"signature"` // Hex payer signature of the commitment
+}
+
+// Open creates a channel of capacity from payer to payee
+// The funding transaction is signed but must only be broadcast once the
+// payee has signed the refund (see AddRefundSignature)
+// Chain reads take the state read lock, signing happens outside of it
+func Open(chain *blockchain.Blockchain, payer blockchain.Signer, payerAddress, payee string, payeePubKey []byte, capacity, timeout int) (*Channel, error) {
+	if !bytes.Equal(blockchain.HashPubKey(payeePubKey), addressHash(payee)) {
+		return nil, fmt.Errorf("public key does not match payee %s", payee)
+	}
+
+	script, err := blockchain.NewMultisigScript(2, [][]byte{payer.PublicKey(), payeePubKey})
+	if err != nil {
+		return nil, err
+	}
+
+	chain.RLockState()
+	funding, err := blockchain.NewUnsignedTransaction(
+		[]blockchain.Funding{{Address: payerAddress, PubKey: payer.PublicKey(), Amount: capacity}},
+		[]blockchain.Recipient{{Address: blockchain.MultisigAddress(script), Amount: capacity}},
+		chain)
+	var prevTXs map[string]blockchain.Transaction
+	if err == nil {
+		prevTXs, err = chain.PrevTransactions(funding)
+	}
+	chain.RUnlockState()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := funding.Sign(payer, prevTXs); err != nil {
+		return nil, err
+	}
+	out, err := blockchain.ChannelFundingOutput(funding, script)
+	if err != nil {
+		return nil, err
+	}
+
+	refund, err := blockchain.NewChannelRefund(funding, out, script, payerAddress, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if err := refund.SignMultisigInput(0, payer, blockchain.ChannelPrevTXs(funding)); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	return &Channel{
+		ID:            hex.EncodeToString(funding.ID),
+		Role:          RolePayer,
+		Status:        StatusOpening,
+		Payer:         payerAddress,
+		Payee:         payee,
+		Capacity:      capacity,
+		Timeout:       timeout,
+		Script:        script,
+		Funding:       funding.Serialize(),
+		FundingOutput: out,
+		Refund:        refund.Serialize(),
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}, nil
+}
+
+// Proposal returns the message the payer sends to the payee
+func (ch *Channel) Proposal() *Proposal {
+	return &Proposal{
+		Payer:       ch.Payer,
+		PayerPubKey: hex.EncodeToString(ch.partyKey(ch.Payer)),
+		Payee:       ch.Payee,
+		Timeout:     ch.Timeout,
+		Funding:     hex.EncodeToString(ch.Funding),
+	}
+}
+
+// Accept checks a proposal on the payee side and signs its refund
+// It returns the channel and the refund signature for the payer
+// Chain reads take the state read lock, signing happens outside of it
+func Accept(chain *blockchain.Blockchain, payee blockchain.Signer, proposal *Proposal) (*Channel, []byte, error) {
+	if !bytes.Equal(blockchain.HashPubKey(payee.PublicKey()), addressHash(proposal.Payee)) {
+		return nil, nil, fmt.Errorf("payee %s is not the local key", proposal.Payee)
+	}
+
+	payerPubKey, err := hex.DecodeString(proposal.PayerPubKey)
+	if err != nil || !bytes.Equal(blockchain.HashPubKey(payerPubKey), addressHash(proposal.Payer)) {
+		return nil, nil, fmt.Errorf("public key does not match payer %s", proposal.Payer)
+	}
+	script, err := blockchain.NewMultisigScript(2, [][]byte{payerPubKey, payee.PublicKey()})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	funding, err := decodeTransaction(proposal.Funding)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid funding transaction: %v", err)
+	}
+	out, err := blockchain.ChannelFundingOutput(funding, script)
+	if err != nil {
+		return nil, nil, err
+	}
+	chain.RLockState()
+	_, err = chain.CheckTransactionInputs(funding)
+	chain.RUnlockState()
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid funding transaction: %v", err)
+	}
+
+	// The payee signs the refund it builds itself, so a proposal cannot
+	// sneak in other terms
+	refund, err := blockchain.NewChannelRefund(funding, out, script, proposal.Payer, proposal.Timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	signature, err := payee.SignHash(refund.SignatureHash(0, blockchain.ChannelPrevTXs(funding)))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now().Unix()
+	return &Channel{
+		ID:            hex.EncodeToString(funding.ID),
+		Role:          RolePayee,
+		Status:        StatusOpen,
+		Payer:         proposal.Payer,
+		Payee:         proposal.Payee,
+		Capacity:      funding.Outputs[out].Value,
+		Timeout:       proposal.Timeout,
+		Script:        script,
+		Funding:       funding.Serialize(),
+		FundingOutput: out,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}, signature, nil
+}
+
+// AddRefundSignature completes the refund with the payee signature and opens
+// the channel; the returned funding transaction can then be broadcast
+func (ch *Channel) AddRefundSignature(signature []byte) (*blockchain.Transaction, error) {
+	if ch.Role != RolePayer || ch.Status != StatusOpening {
+		return nil, fmt.Errorf("channel %s is not waiting for a refund signature", ch.ID)
+	}
+
+	funding, refund, err := ch.transactions()
+	if err != nil {
+		return nil, err
+	}
+
+	prevTXs := blockchain.ChannelPrevTXs(funding)
+	keyIndex := blockchain.MultisigKeyIndex(ch.Script, ch.partyKey(ch.Payee))
+	if err := refund.AddMultisigSignature(0, keyIndex, signature, prevTXs); err != nil {
+		return nil, err
+	}
+	if !refund.Verify(prevTXs) {
+		return nil, fmt.Errorf("refund failed verification")
+	}
+
+	ch.Refund = refund.Serialize()
+	ch.Status = StatusOpen
+	ch.UpdatedAt = time.Now().Unix()
+
+	return funding, nil
+}
+
+// Pay signs a balance update moving amount more to the payee
+func (ch *Channel) Pay(payer blockchain.Signer, amount int) (*Update, error) {
+	if ch.Role != RolePayer || ch.Status != StatusOpen {
+		return nil, fmt.Errorf("channel %s is not open for payments from this node", ch.ID)
+	}
+	if amount <= 0 || ch.Paid+amount > ch.Capacity {
+		return nil, fmt.Errorf("amount must be between 1 and the remaining balance %d", ch.Capacity-ch.Paid)
+	}
+
+	funding, commitment, err := ch.commitment(ch.Paid + amount)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := payer.SignHash(commitment.SignatureHash(0, blockchain.ChannelPrevTXs(funding)))
+	if err != nil {
+		return nil, err
+	}
+
+	ch.Paid += amount
+	ch.Sequence++
+	ch.PayerSignature = signature
+	ch.UpdatedAt = time.Now().Unix()
+
+	return ch.LatestUpdate(), nil
+}
+
+// LatestUpdate returns the latest balance update (nil before the first payment)
+func (ch *Channel) LatestUpdate() *Update {
+	if ch.Sequence == 0 {
+		return nil
+	}
+
+	return &Update{
+		Channel:   ch.ID,
+		Sequence:  ch.Sequence,
+		Paid:      ch.Paid,
+		Signature: hex.EncodeToString(ch.PayerSignature),
+	}
+}
+
+// Receive checks and stores a balance update on the payee side
+func (ch *Channel) Receive(update *Update) error {
+	if ch.Role != RolePayee || ch.Status != StatusOpen {
+		return fmt.Errorf("channel %s is not open for payments to this node", ch.ID)
+	}
+	if update.Sequence <= ch.Sequence || update.Paid <= ch.Paid {
+		return fmt.Errorf("update %d does not supersede update %d (paid %d)", update.Sequence, ch.Sequence, ch.Paid)
+	}
+
+	signature, err := hex.DecodeString(update.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding")
+	}
+
+	funding, commitment, err := ch.commitment(update.Paid)
+	if err != nil {
+		return err
+	}
+	keyIndex := blockchain.MultisigKeyIndex(ch.Script, ch.partyKey(ch.Payer))
+	if err := commitment.AddMultisigSignature(0, keyIndex, signature, blockchain.ChannelPrevTXs(funding)); err != nil {
+		return err
+	}
+
+	ch.Paid = update.Paid
+	ch.Sequence = update.Sequence
+	ch.PayerSignature = signature
+	ch.UpdatedAt = time.Now().Unix()
+
+	return nil
+}
+
+// CloseTx returns the transaction closing the channel from the local side:
+// the latest balance signed by both parties for the payee, the refund for
+// the payer (only valid once the funding output has Timeout confirmations)
+// signer is the payee key and is unused on the payer side
+func (ch *Channel) CloseTx(signer blockchain.Signer) (*blockchain.Transaction, error) {
+	if ch.Status != StatusOpen {
+		return nil, fmt.Errorf("channel %s is %s", ch.ID, ch.Status)
+	}
+
+	if ch.Role == RolePayer {
+		_, refund, err := ch.transactions()
+		return refund, err
+	}
+
+	if ch.Sequence == 0 {
+		return nil, fmt.Errorf("nothing was paid in channel %s, the payer reclaims it with the refund", ch.ID)
+	}
+
+	funding, commitment, err := ch.commitment(ch.Paid)
+	if err != nil {
+		return nil, err
+	}
+
+	prevTXs := blockchain.ChannelPrevTXs(funding)
+	keyIndex := blockchain.MultisigKeyIndex(ch.Script, ch.partyKey(ch.Payer))
+	if err := commitment.AddMultisigSignature(0, keyIndex, ch.PayerSignature, prevTXs); err != nil {
+		return nil, err
+	}
+	if err := commitment.SignMultisigInput(0, signer, prevTXs); err != nil {
+		return nil, err
+	}
+	if !commitment.Verify(prevTXs) {
+		return nil, fmt.Errorf("closing transaction failed verification")
+	}
+
+	return commitment, nil
+}
+
+// Closed records the transaction that closed the channel
+func (ch *Channel) Closed(txID []byte) {
+	ch.Status = StatusClosed
+	ch.CloseTxID = hex.EncodeToString(txID)
+	ch.UpdatedAt = time.Now().Unix()
+}
+
+// FundingTx returns the funding transaction
+func (ch *Channel) FundingTx() (*blockchain.Transaction, error) {
+	return blockchain.DecodeTransaction(ch.Funding)
+}
+
+// transactions decodes the funding transaction and the refund
+func (ch *Channel) transactions() (*blockchain.Transaction, *blockchain.Transaction, error) {
+	funding, err := ch.FundingTx()
+	if err != nil {
+		return nil, nil, err
+	}
+	refund, err := blockchain.DecodeTransaction(ch.Refund)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return funding, refund, nil
+}
+
+// commitment builds the unsigned commitment paying paid to the payee
+func (ch *Channel) commitment(paid int) (*blockchain.Transaction, *blockchain.Transaction, error) {
+	funding, err := ch.FundingTx()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	commitment, err := blockchain.NewChannelCommitment(funding, ch.FundingOutput, ch.Script, ch.Payer, ch.Payee, paid)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return funding, commitment, nil
+}
+
+// partyKey returns the public key of a party from the channel script
+func (ch *Channel) partyKey(address string) []byte {
+	_, pubKeys, err := blockchain.ParseMultisigScript(ch.Script)
+	if err != nil {
+		return nil
+	}
+
+	for _, pubKey := range pubKeys {
+		if bytes.Equal(blockchain.HashPubKey(pubKey), addressHash(address)) {
+			return pubKey
+		}
+	}
+	return nil
+}
+
+func addressHash(address string) []byte {
+	pubKeyHash, _ := blockchain.AddressToPubKeyHash(address)
+	return pubKeyHash
+}
+
+func decodeTransaction(hexTx string) (*blockchain.Transaction, error) {
+	data, err := hex.DecodeString(hexTx)
+	if err != nil {
+		return nil, err
+	}
+
+	return blockchain.DecodeTransaction(data)
+}
@@ -0,0 +1,202 @@
+package channel
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// ErrNotFound is returned for unknown channel IDs
+var ErrNotFound = errors.New("channel not found")
+
+// Store keeps the channels of the node, persisted after every change:
+// losing the latest update would lose the payments it carries
+type Store struct {
+	channels map[string]*Channel
+	path     string
+
+	mu sync.Mutex
+}
+
+// getChannelsFile returns the path of the persisted channels
+func getChannelsFile() string {
+	return filepath.Join(blockchain.DataDir(), "channels.json")
+}
+
+// NewStore loads the persisted channels
+func NewStore() *Store {
+	st := &Store{
+		channels: make(map[string]*Channel),
+		path:     getChannelsFile(),
+	}
+
+	data, err := os.ReadFile(st.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("⚠️  Could not read channels %s: %v", st.path, err)
+		}
+		return st
+	}
+
+	var channels []*Channel
+	if err := json.Unmarshal(data, &channels); err != nil {
+		log.Printf("⚠️  Ignoring corrupted channels %s: %v", st.path, err)
+		return st
+	}
+	for _, ch := range channels {
+		st.channels[ch.ID] = ch
+	}
+
+	return st
+}
+
+// Add stores a new channel
+func (st *Store) Add(ch *Channel) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if _, ok := st.channels[ch.ID]; ok {
+		return fmt.Errorf("channel %s already exists", ch.ID)
+	}
+
+	st.channels[ch.ID] = ch
+	if err := st.save(); err != nil {
+		delete(st.channels, ch.ID)
+		return err
+	}
+
+	return nil
+}
+
+// Get returns a copy of a channel
+func (st *Store) Get(id string) (Channel, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	ch, ok := st.channels[id]
+	if !ok {
+		return Channel{}, false
+	}
+	return *ch, true
+}
+
+// List returns copies of all channels, oldest first
+func (st *Store) List() []Channel {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	channels := make([]Channel, 0, len(st.channels))
+	for _, ch := range st.channels {
+		channels = append(channels, *ch)
+	}
+	sort.Slice(channels, func(i, j int) bool {
+		if channels[i].CreatedAt != channels[j].CreatedAt {
+			return channels[i].CreatedAt < channels[j].CreatedAt
+		}
+		return channels[i].ID < channels[j].ID
+	})
+
+	return channels
+}
+
+// Update applies fn to a copy of a channel and stores the result if fn
+// succeeds and it could be persisted
+func (st *Store) Update(id string, fn func(ch *Channel) error) (Channel, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	current, ok := st.channels[id]
+	if !ok {
+		return Channel{}, ErrNotFound
+	}
+
+	updated := *current
+	if err := fn(&updated); err != nil {
+		return *current, err
+	}
+
+	st.channels[id] = &updated
+	if err := st.save(); err != nil {
+		st.channels[id] = current
+		return *current, err
+	}
+
+	return updated, nil
+}
+
+// save writes the channels atomically, readable by the owner only
+// The caller must hold st.mu
+func (st *Store) save() error {
+	channels := make([]*Channel, 0, len(st.channels))
+	for _, ch := range st.channels {
+		channels = append(channels, ch)
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].ID < channels[j].ID })
+
+	data, err := json.MarshalIndent(channels, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(st.path), 0755); err != nil {
+		return err
+	}
+
+	tmp := st.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, st.path)
+}
+
+// Expiring returns the open channels the local party must close before the
+// next block at height: payee channels whose refund becomes valid within
+// CloseMargin blocks and payer channels whose refund is valid
+// Channels whose funding output was spent by the other party are marked closed
+// The caller must hold the chain state read lock (taken before the store lock)
+func (st *Store) Expiring(chain *blockchain.Blockchain, height int) []Channel {
+	var expiring []Channel
+	utxoSet := blockchain.UTXOSet{Blockchain: chain}
+
+	for _, ch := range st.List() {
+		if ch.Status != StatusOpen {
+			continue
+		}
+
+		fundingID, err := hex.DecodeString(ch.ID)
+		if err != nil {
+			continue
+		}
+		_, confirmedAt, err := chain.FindTransactionHeight(fundingID)
+		if err != nil {
+			continue // Funding not confirmed yet
+		}
+
+		if _, unspent := utxoSet.FindOutput(fundingID, ch.FundingOutput); !unspent {
+			log.Printf("💸 Channel %s: funding output spent on chain, channel closed", ch.ID)
+			st.Update(ch.ID, func(ch *Channel) error {
+				ch.Status = StatusClosed
+				return nil
+			})
+			continue
+		}
+
+		refundValidAt := confirmedAt + ch.Timeout
+		switch {
+		case ch.Role == RolePayee && ch.Sequence > 0 && height >= refundValidAt-CloseMargin:
+			expiring = append(expiring, ch)
+		case ch.Role == RolePayer && height >= refundValidAt:
+			expiring = append(expiring, ch)
+		}
+	}
+
+	return expiring
+}
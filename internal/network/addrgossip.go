@@ -0,0 +1,371 @@
+package network
+
+import (
+	"bytes"
+	"encoding/gob"
+	"log"
+	"math/rand"
+	"net"
+	"slices"
+	"time"
+)
+
+// Address gossip
+//
+// Peers exchange addresses as NetAddress records: the address, when the peer
+// was last seen alive and the services it offers. A node asks the peers it
+// meets for the addresses they know with getaddr, answered with at most
+// maxAddrPerMessage of them, and advertises its own address to them. Small
+// addr messages of fresh addresses are relayed to addrRelayPeers random
+// connected peers, so a new node becomes known across the network without
+// flooding it. Addresses not seen alive for addrHorizon are forgotten, the
+// seeds excepted. Peers older than AddrTimeProtocolVersion get the plain
+// address list, pushed when they send their version.
+
+// AddrTimeProtocolVersion is the first network protocol version that
+// exchanges timestamped addresses and getaddr
+const AddrTimeProtocolVersion = 5
+
+// Services offered by a node, advertised in its version and address
+const (
+	ServiceNetwork        = uint64(1 << 0)  // Serves every block
+	ServiceNetworkLimited = uint64(1 << 10) // Serves recent blocks only (pruned)
+)
+
+const (
+	maxAddrPerMessage     = 1000
+	addrRelayMax          = 10 // Larger addr messages answer a getaddr and are not relayed
+	addrRelayPeers        = 2
+	addrRelayFresh        = 10 * time.Minute    // Addresses seen longer ago are not relayed
+	addrHorizon           = 30 * 24 * time.Hour // Addresses not seen since are forgotten
+	addrUnknownAge        = 5 * 24 * time.Hour  // Age given to addresses without a valid time
+	addrMaxFuture         = 10 * time.Minute
+	addrLoopInterval      = 10 * time.Minute
+	addrAdvertiseInterval = 24 * time.Hour
+)
+
+// services returns the services this node offers
+func (s *Server) services() uint64 {
+	if s.Blockchain.PrunedHeight() >= 0 {
+		return ServiceNetworkLimited
+	}
+	return ServiceNetwork
+}
+
+// serviceNames returns the names of a services bitfield
+func serviceNames(services uint64) []string {
+	var names []string
+	if services&ServiceNetwork != 0 {
+		names = append(names, "network")
+	}
+	if services&ServiceNetworkLimited != 0 {
+		names = append(names, "network_limited")
+	}
+	return names
+}
+
+// checkLastSeen replaces a missing or future last seen time by an old one
+func checkLastSeen(lastSeen int64) int64 {
+	now := time.Now()
+	if lastSeen <= 0 || lastSeen > now.Add(addrMaxFuture).Unix() {
+		return now.Add(-addrUnknownAge).Unix()
+	}
+	return lastSeen
+}
+
+// recordAddress stores a gossip record, keeping the latest last seen time,
+// and reports whether it changed
+func (s *Server) recordAddress(record NetAddress) bool {
+	record.LastSeen = checkLastSeen(record.LastSeen)
+
+	s.knownAddrsMux.Lock()
+	defer s.knownAddrsMux.Unlock()
+
+	known, ok := s.knownAddrs[record.Addr]
+	if ok && known.LastSeen >= record.LastSeen {
+		return false
+	}
+	if record.Services == 0 {
+		record.Services = known.Services
+	}
+	s.knownAddrs[record.Addr] = record
+	return true
+}
+
+// forgetAddress drops the gossip record of an address
+func (s *Server) forgetAddress(addr string) {
+	s.knownAddrsMux.Lock()
+	delete(s.knownAddrs, addr)
+	s.knownAddrsMux.Unlock()
+}
+
+// addressRecord returns the gossip record of a known address
+func (s *Server) addressRecord(addr string) (NetAddress, bool) {
+	s.knownAddrsMux.Lock()
+	defer s.knownAddrsMux.Unlock()
+
+	record, ok := s.knownAddrs[addr]
+	return record, ok
+}
+
+// addrSeen records a peer seen alive now, offering services
+func (s *Server) addrSeen(addr string, services uint64) {
+	if s.nodeIsKnown(addr) {
+		s.recordAddress(NetAddress{Addr: addr, LastSeen: time.Now().Unix(), Services: services})
+	}
+}
+
+// learnAddress adds a gossiped address to the known nodes, or refreshes it,
+// and reports whether it was new and whether its record changed
+func (s *Server) learnAddress(record NetAddress) (added, updated bool) {
+	record.LastSeen = checkLastSeen(record.LastSeen)
+	if time.Since(time.Unix(record.LastSeen, 0)) > addrHorizon {
+		return false, false
+	}
+
+	added = s.learnNode(record.Addr)
+	if added || s.nodeIsKnown(record.Addr) {
+		updated = s.recordAddress(record)
+	}
+	return added, updated
+}
+
+// addressesFor returns the known addresses to send to a peer, at most
+// maxAddrPerMessage picked at random
+func (s *Server) addressesFor(peer string) []NetAddress {
+	now := time.Now().Unix()
+	var records []NetAddress
+	for _, addr := range s.KnownNodes() {
+		if addr == peer || s.Bans.Banned(addr) {
+			continue
+		}
+		record, ok := s.addressRecord(addr)
+		if !ok {
+			record = NetAddress{Addr: addr, LastSeen: checkLastSeen(0)}
+		}
+		// Connected peers are alive
+		if _, connected := s.Peers.Get(addr); connected {
+			record.LastSeen = now
+		}
+		if time.Since(time.Unix(record.LastSeen, 0)) > addrHorizon {
+			continue
+		}
+		records = append(records, record)
+	}
+
+	rand.Shuffle(len(records), func(i, j int) {
+		records[i], records[j] = records[j], records[i]
+	})
+	if len(records) > maxAddrPerMessage {
+		records = records[:maxAddrPerMessage]
+	}
+	return records
+}
+
+// sendAddr sends known peer addresses to a node
+func (s *Server) sendAddr(addr string) {
+	s.sendAddresses(addr, s.addressesFor(addr))
+}
+
+// sendAddresses sends address records to a peer, as a plain list to peers
+// older than AddrTimeProtocolVersion
+func (s *Server) sendAddresses(addr string, records []NetAddress) {
+	data := Addr{AddrFrom: s.nodeAddress}
+	if s.Peers.Version(addr) >= AddrTimeProtocolVersion {
+		data.Addresses = records
+	} else {
+		for _, record := range records {
+			data.AddrList = append(data.AddrList, record.Addr)
+		}
+	}
+
+	payload := GobEncode(data)
+	request := append(CmdToBytes(CmdAddr), payload...)
+	s.sendData(addr, request)
+}
+
+// sendGetAddr asks a peer for the addresses it knows
+func (s *Server) sendGetAddr(addr string) {
+	payload := GobEncode(GetAddr{AddrFrom: s.nodeAddress})
+	request := append(CmdToBytes(CmdGetAddr), payload...)
+	s.sendData(addr, request)
+}
+
+// advertiseAddress sends the address of this node to a peer, which relays it
+// further; an unspecified listen address is not worth advertising, and a node
+// behind a proxy keeps its address to itself
+func (s *Server) advertiseAddress(addr string) {
+	if s.Proxy != "" {
+		return
+	}
+	host, _, err := net.SplitHostPort(s.nodeAddress)
+	if err != nil || host == "" || net.ParseIP(host).IsUnspecified() {
+		return
+	}
+	s.sendAddresses(addr, []NetAddress{{Addr: s.nodeAddress, LastSeen: time.Now().Unix(), Services: s.services()}})
+}
+
+// shareAddresses exchanges addresses with a peer that sent its version:
+// newer peers are asked with getaddr and learn this node's address the
+// first time, older ones get the address list pushed
+func (s *Server) shareAddresses(addr string, peerVersion int, known bool) {
+	if peerVersion < AddrTimeProtocolVersion {
+		s.sendAddr(addr)
+		return
+	}
+	if !known {
+		s.sendGetAddr(addr)
+		s.advertiseAddress(addr)
+	}
+}
+
+// handleGetAddr answers a getaddr with the known addresses
+func (s *Server) handleGetAddr(request []byte, conn net.Conn) {
+	var buff bytes.Buffer
+	var payload GetAddr
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Printf("Error decoding getaddr: %v", err)
+		s.malformed(request, conn)
+		return
+	}
+
+	// A standby replica only talks to its primary
+	if s.Standby() {
+		return
+	}
+
+	s.sendAddr(payload.AddrFrom)
+}
+
+// handleAddr handles addr message
+func (s *Server) handleAddr(request []byte, conn net.Conn) {
+	var buff bytes.Buffer
+	var payload Addr
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Printf("Error decoding addr: %v", err)
+		s.malformed(request, conn)
+		return
+	}
+
+	sender := messageSender(request, conn)
+	records := payload.Addresses
+	for _, addr := range payload.AddrList {
+		records = append(records, NetAddress{Addr: addr})
+	}
+	if len(records) > maxAddrPerMessage {
+		log.Printf("⚠️  Dropped addr message of %d addresses from %s (at most %d)", len(records), sender, maxAddrPerMessage)
+		s.misbehaving(conn, PenaltyMalformed, "oversized addr message")
+		return
+	}
+
+	// A standby replica only talks to its primary
+	if s.Standby() {
+		return
+	}
+
+	var relay []NetAddress
+	for _, record := range records {
+		added, updated := s.learnAddress(record)
+		if added {
+			log.Printf("🌐 Discovered new peer: %s (total: %d)", record.Addr, len(s.KnownNodes()))
+		}
+		// Only advertisements are relayed, not answers to getaddr, and only
+		// once: a record seen again does not change
+		fresh := time.Since(time.Unix(checkLastSeen(record.LastSeen), 0)) <= addrRelayFresh
+		if updated && fresh && len(payload.Addresses) <= addrRelayMax {
+			relay = append(relay, record)
+		}
+	}
+	if len(relay) > 0 {
+		s.relayAddresses(sender, relay)
+	}
+
+	// Connect to new peers only while outbound slots are free
+	for _, addr := range s.fillOutbound() {
+		go func(peerAddr string) {
+			s.sendVersion(peerAddr)
+		}(addr)
+	}
+}
+
+// relayAddresses forwards fresh addresses to a few random connected peers,
+// other than the sender and the addresses themselves
+func (s *Server) relayAddresses(from string, records []NetAddress) {
+	var peers []string
+	for _, peer := range s.relayPeers() {
+		if peer == from || slices.ContainsFunc(records, func(r NetAddress) bool { return r.Addr == peer }) {
+			continue
+		}
+		peers = append(peers, peer)
+	}
+
+	rand.Shuffle(len(peers), func(i, j int) {
+		peers[i], peers[j] = peers[j], peers[i]
+	})
+	if len(peers) > addrRelayPeers {
+		peers = peers[:addrRelayPeers]
+	}
+	for _, peer := range peers {
+		go s.sendAddresses(peer, records)
+	}
+}
+
+// expireAddresses forgets the addresses not seen alive for addrHorizon,
+// except the seeds, the pinned peers and the peers in use
+func (s *Server) expireAddresses() int {
+	var stale []string
+	for _, addr := range s.KnownNodes() {
+		if slices.Contains(s.seeds, addr) || s.Policy.IsPinned(addr) || s.Outbound.Contains(addr) {
+			continue
+		}
+		if _, connected := s.Peers.Get(addr); connected {
+			continue
+		}
+		record, ok := s.addressRecord(addr)
+		if ok && time.Since(time.Unix(record.LastSeen, 0)) > addrHorizon {
+			stale = append(stale, addr)
+		}
+	}
+
+	for _, addr := range stale {
+		s.removeNode(addr)
+	}
+	return len(stale)
+}
+
+// addrLoop periodically forgets stale addresses, saves the known peers and
+// advertises this node's address to the connected peers once a day
+func (s *Server) addrLoop() {
+	ticker := time.NewTicker(addrLoopInterval)
+	defer ticker.Stop()
+
+	lastAdvertised := time.Now()
+	for range ticker.C {
+		// A standby replica only talks to its primary
+		if s.Standby() {
+			continue
+		}
+
+		if expired := s.expireAddresses(); expired > 0 {
+			log.Printf("🌐 Forgot %d addresses not seen for %s (total: %d)", expired, addrHorizon, len(s.KnownNodes()))
+		}
+		if _, err := s.saveKnownPeers(getKnownPeersFile()); err != nil {
+			log.Printf("⚠️  Error saving known peers: %v", err)
+		}
+
+		if time.Since(lastAdvertised) >= addrAdvertiseInterval {
+			lastAdvertised = time.Now()
+			for _, peer := range s.relayPeers() {
+				go s.advertiseAddress(peer)
+			}
+		}
+	}
+}
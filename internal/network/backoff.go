@@ -0,0 +1,182 @@
+package network
+
+import (
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/marcocsrachid/blockchain-go/internal/api"
+)
+
+// Reconnection defaults
+const (
+	DefaultRetryDelay    = 2 * time.Second // Delay before the first reconnection attempt
+	DefaultMaxRetryDelay = 5 * time.Minute
+	DefaultMaxDialFails  = 8   // Consecutive failed dials before a peer is dropped
+	retryJitter          = 0.2 // Delays are randomized by ±20% so peers don't retry in lockstep
+)
+
+// dialState tracks the failed dials of a temporarily unreachable peer
+type dialState struct {
+	failures    int
+	firstFailed time.Time
+	nextAttempt time.Time
+	lastError   string
+	probing     bool // A reconnection attempt is scheduled
+}
+
+// DialBackoff keeps peers that failed to dial out of rotation with
+// exponential backoff instead of dropping them on the first failure
+type DialBackoff struct {
+	peers map[string]*dialState
+
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	MaxFailures   int
+
+	mu sync.Mutex
+}
+
+// NewDialBackoff creates a backoff table with the default delays
+func NewDialBackoff() *DialBackoff {
+	return &DialBackoff{
+		peers:         make(map[string]*dialState),
+		RetryDelay:    DefaultRetryDelay,
+		MaxRetryDelay: DefaultMaxRetryDelay,
+		MaxFailures:   DefaultMaxDialFails,
+	}
+}
+
+// Ready reports whether addr may be dialed now
+func (b *DialBackoff) Ready(addr string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, ok := b.peers[addr]
+	return !ok || !time.Now().Before(state.nextAttempt)
+}
+
+// Unreachable reports whether addr is backing off after failed dials
+func (b *DialBackoff) Unreachable(addr string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	_, ok := b.peers[addr]
+	return ok
+}
+
+// Failed records a failed dial; it returns the delay until the next attempt,
+// whether a reconnection attempt should be scheduled, and whether the peer
+// has failed too many times and must be dropped
+func (b *DialBackoff) Failed(addr string, err error) (delay time.Duration, probe, drop bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, ok := b.peers[addr]
+	if !ok {
+		state = &dialState{firstFailed: time.Now()}
+		b.peers[addr] = state
+	}
+
+	state.failures++
+	state.lastError = err.Error()
+	if state.failures >= b.MaxFailures {
+		delete(b.peers, addr)
+		return 0, false, true
+	}
+
+	delay = b.RetryDelay << uint(state.failures-1)
+	if delay > b.MaxRetryDelay || delay <= 0 {
+		delay = b.MaxRetryDelay
+	}
+	delay = time.Duration(float64(delay) * (1 + retryJitter*(2*rand.Float64()-1)))
+
+	state.nextAttempt = time.Now().Add(delay)
+	probe = !state.probing
+	state.probing = true
+
+	return delay, probe, false
+}
+
+// Succeeded clears the backoff of addr; it reports whether the peer was unreachable
+func (b *DialBackoff) Succeeded(addr string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	_, ok := b.peers[addr]
+	delete(b.peers, addr)
+	return ok
+}
+
+// probed marks the scheduled reconnection attempt of addr as done
+func (b *DialBackoff) probed(addr string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if state, ok := b.peers[addr]; ok {
+		state.probing = false
+	}
+}
+
+// Info returns the temporarily unreachable peers
+func (b *DialBackoff) Info() []api.UnreachablePeer {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	peers := make([]api.UnreachablePeer, 0, len(b.peers))
+	for addr, state := range b.peers {
+		peers = append(peers, api.UnreachablePeer{
+			Address:     addr,
+			Failures:    state.failures,
+			FirstFailed: state.firstFailed.Unix(),
+			NextAttempt: state.nextAttempt.Unix(),
+			LastError:   state.lastError,
+		})
+	}
+
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].Address < peers[j].Address
+	})
+
+	return peers
+}
+
+// dialFailed handles a failed dial: the peer is retried with backoff and only
+// removed from the known nodes after too many consecutive failures, pinned
+// peers never are
+func (s *Server) dialFailed(addr string, err error) {
+	delay, probe, drop := s.Backoff.Failed(addr, err)
+	if drop && s.Policy.IsPinned(addr) {
+		// Backing off starts over, the dial loop keeps trying
+		log.Printf("🔌 Pinned peer %s unreachable after %d attempts, keeping it", addr, s.Backoff.MaxFailures)
+		s.Outbound.remove(addr)
+		s.Peers.Remove(addr)
+		return
+	}
+	if drop {
+		log.Printf("🔌 Peer %s unreachable after %d attempts, removing it", addr, s.Backoff.MaxFailures)
+		s.removeNode(addr)
+		return
+	}
+
+	log.Printf("🔌 Error connecting to %s: %v (retrying in %s)", addr, err, delay.Round(time.Second))
+
+	// The slot goes to a reachable peer meanwhile
+	s.Outbound.remove(addr)
+	s.Peers.Remove(addr)
+	if probe {
+		time.AfterFunc(delay, func() {
+			s.Backoff.probed(addr)
+			if s.nodeIsKnown(addr) {
+				s.sendVersion(addr)
+			}
+		})
+	}
+}
+
+// UnreachablePeers returns the peers currently backing off after failed dials
+func (s *Server) UnreachablePeers() []api.UnreachablePeer {
+	return s.Backoff.Info()
+}
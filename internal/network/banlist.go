@@ -0,0 +1,367 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/marcocsrachid/blockchain-go/internal/api"
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// Misbehavior scoring
+//
+// Peers earn ban score points for invalid blocks, messages that cannot be
+// decoded and invalid transactions. Scores decay over time so an occasional
+// fault is forgiven; a peer whose score reaches the threshold is banned for a
+// while: its messages are dropped, it is never dialed and it leaves the known
+// nodes. Bans are persisted in the data directory and survive restarts.
+// Peers are scored and banned by the IP they connect from: the address a
+// message advertises is not authenticated, so scoring it would let anyone
+// get another node banned, and a misbehaving peer escape by changing it. A
+// ban on an IP covers every address at that IP; the operator may also ban a
+// single address.
+
+// Ban defaults
+const (
+	DefaultBanThreshold = 100
+	DefaultBanDuration  = 24 * time.Hour
+	banScoreDecay       = 1 // Points forgiven per minute
+)
+
+// Misbehavior penalties, in ban score points
+const (
+	PenaltyInvalidBlock = 100 // Banned at once with the default threshold
+	PenaltyMalformed    = 20
+	PenaltyInvalidTx    = 10
+)
+
+// banScore is the misbehavior score of a peer
+type banScore struct {
+	points  float64
+	updated time.Time
+}
+
+// BanList keeps the ban scores of peers and the peers banned, persisted as JSON
+type BanList struct {
+	bans   map[string]api.BannedPeer
+	scores map[string]*banScore
+	path   string
+
+	Threshold int           // Score at which a peer is banned
+	Duration  time.Duration // Length of automatic bans
+
+	mu sync.Mutex
+}
+
+// getBanListFile returns the path of the persisted ban list
+func getBanListFile() string {
+	return filepath.Join(blockchain.DataDir(), "bans.json")
+}
+
+// LoadBanList loads the bans from disk (an empty list if none saved yet)
+func LoadBanList(path string) *BanList {
+	list := &BanList{
+		bans:      make(map[string]api.BannedPeer),
+		scores:    make(map[string]*banScore),
+		path:      path,
+		Threshold: DefaultBanThreshold,
+		Duration:  DefaultBanDuration,
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("⚠️  Could not read ban list %s: %v", path, err)
+		}
+		return list
+	}
+
+	var saved []api.BannedPeer
+	if err := json.Unmarshal(data, &saved); err != nil {
+		log.Printf("⚠️  Ignoring corrupted ban list %s: %v", path, err)
+		return list
+	}
+
+	now := time.Now().Unix()
+	for _, ban := range saved {
+		if ban.Until > now {
+			list.bans[ban.Address] = ban
+		}
+	}
+	if len(list.bans) > 0 {
+		log.Printf("⛔ Loaded %d banned peers", len(list.bans))
+	}
+
+	return list
+}
+
+// Misbehaving adds points to the ban score of a peer and bans it once the
+// score reaches the threshold; it reports whether the peer was just banned
+func (b *BanList) Misbehaving(addr string, points int, reason string) (bool, error) {
+	if addr == "" || points <= 0 {
+		return false, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.banned(addr) {
+		return false, nil
+	}
+
+	score := b.score(addr)
+	score.points += float64(points)
+	if b.Threshold <= 0 || score.points < float64(b.Threshold) {
+		return false, nil
+	}
+
+	delete(b.scores, addr)
+	return true, b.ban(addr, b.Duration, reason)
+}
+
+// Ban bans a peer for duration (the automatic ban duration when 0)
+func (b *BanList) Ban(addr string, duration time.Duration, reason string) error {
+	if addr == "" {
+		return fmt.Errorf("address is required")
+	}
+	if duration < 0 {
+		return fmt.Errorf("ban duration must not be negative")
+	}
+	if duration == 0 {
+		duration = b.Duration
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.scores, addr)
+	return b.ban(addr, duration, reason)
+}
+
+// ban records a ban and persists the list; the caller must hold b.mu
+func (b *BanList) ban(addr string, duration time.Duration, reason string) error {
+	now := time.Now()
+	b.bans[addr] = api.BannedPeer{
+		Address: addr,
+		Reason:  reason,
+		Created: now.Unix(),
+		Until:   now.Add(duration).Unix(),
+	}
+	return b.save()
+}
+
+// Unban lifts the ban of a peer and clears its score
+func (b *BanList) Unban(addr string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.banned(addr) {
+		return fmt.Errorf("peer %s is not banned", addr)
+	}
+	delete(b.bans, addr)
+	delete(b.scores, addr)
+
+	return b.save()
+}
+
+// Banned reports whether a peer is banned, by its address or its IP
+func (b *BanList) Banned(addr string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.banned(addr) {
+		return true
+	}
+	host, _, err := net.SplitHostPort(addr)
+	return err == nil && b.banned(host)
+}
+
+// banned reports whether a peer is banned, forgetting an expired ban; the
+// caller must hold b.mu
+func (b *BanList) banned(addr string) bool {
+	ban, ok := b.bans[addr]
+	if !ok {
+		return false
+	}
+	if ban.Until <= time.Now().Unix() {
+		delete(b.bans, addr)
+		return false
+	}
+	return true
+}
+
+// Score returns the current ban score of a peer, kept by its IP
+func (b *BanList) Score(addr string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+
+	if _, ok := b.scores[addr]; !ok {
+		return 0
+	}
+	return int(b.score(addr).points)
+}
+
+// score returns the score of a peer with its decay applied, creating it if
+// needed; the caller must hold b.mu
+func (b *BanList) score(addr string) *banScore {
+	now := time.Now()
+
+	score, ok := b.scores[addr]
+	if !ok {
+		score = &banScore{updated: now}
+		b.scores[addr] = score
+	}
+
+	score.points -= now.Sub(score.updated).Minutes() * banScoreDecay
+	if score.points < 0 {
+		score.points = 0
+	}
+	score.updated = now
+	return score
+}
+
+// Info returns the current bans, sorted by address
+func (b *BanList) Info() []api.BannedPeer {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bans := make([]api.BannedPeer, 0, len(b.bans))
+	for addr := range b.bans {
+		if b.banned(addr) {
+			bans = append(bans, b.bans[addr])
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Address < bans[j].Address
+	})
+	return bans
+}
+
+// save writes the bans atomically; the caller must hold b.mu
+func (b *BanList) save() error {
+	bans := make([]api.BannedPeer, 0, len(b.bans))
+	for _, ban := range b.bans {
+		bans = append(bans, ban)
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Address < bans[j].Address
+	})
+
+	data, err := json.MarshalIndent(bans, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(b.path), 0755); err != nil {
+		return err
+	}
+
+	tmp := b.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.path)
+}
+
+// penalizedReject reports whether a transaction rejected with code is
+// invalid, as opposed to rejected for reasons the peer may not know about
+// (missing parents, conflicts, a full mempool)
+func penalizedReject(code string) bool {
+	switch code {
+	case blockchain.RejectMalformed, blockchain.RejectCoinbase, blockchain.RejectEmpty,
+		blockchain.RejectInvalidValue, blockchain.RejectDuplicateInput, blockchain.RejectKeyMismatch,
+		blockchain.RejectInvalidSignature, blockchain.RejectInsufficientInput:
+		return true
+	}
+	return false
+}
+
+// retryableReject reports whether a rejected transaction may be accepted
+// later, once a block or room in the mempool makes it valid
+func retryableReject(code string) bool {
+	switch code {
+	case blockchain.RejectMissingInputs, blockchain.RejectMempoolFull, blockchain.RejectNonFinal,
+		blockchain.RejectMempoolConflict:
+		return true
+	}
+	return false
+}
+
+// misbehaving adds points to the ban score of the IP a message came from,
+// dropping the nodes at it when it gets banned; pinned peers are trusted and
+// only banned by the operator
+func (s *Server) misbehaving(conn net.Conn, points int, reason string) {
+	ip := remoteIP(conn)
+	if s.Policy.pinnedIP(ip) {
+		log.Printf("⚠️  Pinned peer %s misbehaved: %s", ip, reason)
+		return
+	}
+	banned, err := s.Bans.Misbehaving(ip, points, reason)
+	if err != nil {
+		log.Printf("⚠️  Error saving ban list: %v", err)
+	}
+	if banned {
+		log.Printf("⛔ Banned peer %s for %s: %s", ip, s.Bans.Duration, reason)
+		s.dropBanned(ip)
+	}
+}
+
+// malformed penalizes the sender of a message that could not be decoded
+func (s *Server) malformed(request []byte, conn net.Conn) {
+	s.PeerStats.RecordMalformed(messageSender(request, conn))
+	s.misbehaving(conn, PenaltyMalformed, "malformed message")
+}
+
+// dropBanned forgets a banned peer: an address, or every known node at an IP
+func (s *Server) dropBanned(addr string) {
+	for _, node := range s.KnownNodes() {
+		if host, _, err := net.SplitHostPort(node); err == nil && host == addr {
+			s.removeNode(node)
+		}
+	}
+	s.removeNode(addr)
+}
+
+// BannedPeers returns the peers currently banned
+func (s *Server) BannedPeers() []api.BannedPeer {
+	return s.Bans.Info()
+}
+
+// BanPeer bans a peer for duration (the automatic ban duration when 0)
+func (s *Server) BanPeer(addr string, duration time.Duration, reason string) error {
+	if addr == s.nodeAddress {
+		return fmt.Errorf("cannot ban this node")
+	}
+	if reason == "" {
+		reason = "banned by the operator"
+	}
+	if err := s.Bans.Ban(addr, duration, reason); err != nil {
+		return err
+	}
+
+	log.Printf("⛔ Banned peer %s: %s", addr, reason)
+	s.dropBanned(addr)
+	return nil
+}
+
+// UnbanPeer lifts the ban of a peer, it can be discovered again
+func (s *Server) UnbanPeer(addr string) error {
+	if err := s.Bans.Unban(addr); err != nil {
+		return err
+	}
+
+	log.Printf("⛔ Unbanned peer %s", addr)
+	return nil
+}
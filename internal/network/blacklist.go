@@ -0,0 +1,233 @@
+package network
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/marcocsrachid/blockchain-go/internal/api"
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// Blacklist entry kinds
+const (
+	BlacklistTxID    = "txid"
+	BlacklistAddress = "address"
+)
+
+// MinerBlacklist is the local mining policy of transactions and addresses
+// the node will not include in the blocks and templates it builds
+// It is not a consensus rule: blocks from peers containing them are accepted
+type MinerBlacklist struct {
+	txids     map[string]bool
+	addresses map[string]bool
+	path      string
+	mu        sync.RWMutex
+}
+
+type minerBlacklistFile struct {
+	TxIDs     []string `json:"txids"`
+	Addresses []string `json:"addresses"`
+}
+
+// getMinerBlacklistFile returns the path of the persisted miner blacklist
+func getMinerBlacklistFile() string {
+	return filepath.Join(blockchain.DataDir(), "miner_blacklist.json")
+}
+
+// LoadMinerBlacklist loads the blacklist from disk (an empty list if none saved yet)
+func LoadMinerBlacklist(path string) *MinerBlacklist {
+	list := &MinerBlacklist{
+		txids:     make(map[string]bool),
+		addresses: make(map[string]bool),
+		path:      path,
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("⚠️  Could not read miner blacklist %s: %v", path, err)
+		}
+		return list
+	}
+
+	var saved minerBlacklistFile
+	if err := json.Unmarshal(data, &saved); err != nil {
+		log.Printf("⚠️  Ignoring corrupted miner blacklist %s: %v", path, err)
+		return list
+	}
+
+	for _, txid := range saved.TxIDs {
+		list.txids[txid] = true
+	}
+	for _, address := range saved.Addresses {
+		list.addresses[address] = true
+	}
+	if len(list.txids)+len(list.addresses) > 0 {
+		log.Printf("🚫 Loaded miner blacklist (%d txids, %d addresses)", len(list.txids), len(list.addresses))
+	}
+
+	return list
+}
+
+// Add blacklists a txid or address and persists the list
+func (b *MinerBlacklist) Add(kind, value string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entries, err := b.entries(kind, value)
+	if err != nil {
+		return err
+	}
+	entries[value] = true
+
+	return b.save()
+}
+
+// Remove drops a txid or address from the blacklist and persists the list
+func (b *MinerBlacklist) Remove(kind, value string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entries, err := b.entries(kind, value)
+	if err != nil {
+		return err
+	}
+	if !entries[value] {
+		return fmt.Errorf("%s %s is not blacklisted", kind, value)
+	}
+	delete(entries, value)
+
+	return b.save()
+}
+
+// entries validates an entry and returns the set it belongs to; the caller must hold b.mu
+func (b *MinerBlacklist) entries(kind, value string) (map[string]bool, error) {
+	switch kind {
+	case BlacklistTxID:
+		if id, err := hex.DecodeString(value); err != nil || len(id) != 32 {
+			return nil, fmt.Errorf("invalid txid %q", value)
+		}
+		return b.txids, nil
+
+	case BlacklistAddress:
+		if !blockchain.ValidateAddress(value) {
+			return nil, fmt.Errorf("invalid address %q", value)
+		}
+		return b.addresses, nil
+	}
+
+	return nil, fmt.Errorf("unknown blacklist type %q (expected %s or %s)", kind, BlacklistTxID, BlacklistAddress)
+}
+
+// Excludes reports why a transaction must be left out of locally built blocks
+// A transaction is excluded if its txid is listed or if it spends from or
+// pays to a listed address; the reason is empty if it may be included
+func (b *MinerBlacklist) Excludes(tx *blockchain.Transaction) string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if len(b.txids) == 0 && len(b.addresses) == 0 {
+		return ""
+	}
+
+	if b.txids[hex.EncodeToString(tx.ID)] {
+		return "blacklisted txid"
+	}
+
+	if len(b.addresses) == 0 {
+		return ""
+	}
+
+	if !tx.IsCoinbase() {
+		for _, in := range tx.Inputs {
+			address := string(blockchain.PubKeyHashToAddress(in.LockingHash()))
+			if b.addresses[address] {
+				return "spends from blacklisted address " + address
+			}
+		}
+	}
+
+	for _, out := range tx.Outputs {
+		address := string(blockchain.PubKeyHashToAddress(out.PubKeyHash))
+		if b.addresses[address] {
+			return "pays to blacklisted address " + address
+		}
+	}
+
+	return ""
+}
+
+// Info returns the blacklist entries in sorted order
+func (b *MinerBlacklist) Info() api.MinerBlacklistResponse {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return api.MinerBlacklistResponse{
+		TxIDs:     sortedKeys(b.txids),
+		Addresses: sortedKeys(b.addresses),
+	}
+}
+
+// save writes the blacklist atomically; the caller must hold b.mu
+func (b *MinerBlacklist) save() error {
+	data, err := json.MarshalIndent(minerBlacklistFile{
+		TxIDs:     sortedKeys(b.txids),
+		Addresses: sortedKeys(b.addresses),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(b.path), 0755); err != nil {
+		return err
+	}
+
+	tmp := b.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.path)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// MinerBlacklistInfo returns the local mining blacklist
+func (s *Server) MinerBlacklistInfo() api.MinerBlacklistResponse {
+	return s.Blacklist.Info()
+}
+
+// AddToMinerBlacklist blacklists a txid or address for local block building
+func (s *Server) AddToMinerBlacklist(kind, value string) error {
+	if err := s.Blacklist.Add(kind, value); err != nil {
+		return err
+	}
+
+	log.Printf("🚫 Miner blacklist: added %s %s", kind, value)
+	s.templates.notify(true)
+	return nil
+}
+
+// RemoveFromMinerBlacklist removes a txid or address from the mining blacklist
+func (s *Server) RemoveFromMinerBlacklist(kind, value string) error {
+	if err := s.Blacklist.Remove(kind, value); err != nil {
+		return err
+	}
+
+	log.Printf("🚫 Miner blacklist: removed %s %s", kind, value)
+	s.templates.notify(true)
+	return nil
+}
@@ -0,0 +1,83 @@
+package network
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Message compression
+//
+// Messages of at least compressThreshold bytes sent to peers speaking
+// CompressionProtocolVersion or later travel gzip compressed: a gzip command
+// whose payload is the compressed message, command included. The gob
+// encoding of blocks, the bulk of a sync, carries type descriptors, field
+// names and repeated keys that compress well; hashes and signatures do not.
+// Older peers, and peers whose version is not known yet, get the raw message.
+
+const (
+	// CompressionProtocolVersion is the first network protocol version that
+	// accepts compressed messages
+	CompressionProtocolVersion = 4
+
+	compressThreshold = 512 // Smaller messages are sent raw
+)
+
+// compressFor returns the message to send to a peer, compressed when the
+// peer accepts it and it gets smaller
+func (s *Server) compressFor(addr string, request []byte) []byte {
+	if len(request) < compressThreshold || s.Peers.Version(addr) < CompressionProtocolVersion {
+		return request
+	}
+
+	compressed, err := compressMessage(request)
+	if err != nil || len(compressed) >= len(request) {
+		return request
+	}
+	return compressed
+}
+
+// compressMessage wraps a message in a gzip message
+func compressMessage(request []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(CmdToBytes(CmdGzip))
+
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(request); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressMessage unwraps the message of a gzip message, of at most
+// maxSize bytes (0 = unlimited)
+func decompressMessage(request []byte, maxSize int) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(request[commandLength:]))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var r io.Reader = zr
+	if maxSize > 0 {
+		r = io.LimitReader(zr, int64(maxSize)+1)
+	}
+	message, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize > 0 && len(message) > maxSize {
+		return nil, fmt.Errorf("decompressed message over %d bytes", maxSize)
+	}
+	if len(message) < commandLength {
+		return nil, fmt.Errorf("decompressed message too short: %d bytes", len(message))
+	}
+	if BytesToCmd(message[:commandLength]) == CmdGzip {
+		return nil, fmt.Errorf("nested gzip message")
+	}
+	return message, nil
+}
@@ -0,0 +1,242 @@
+package network
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// Delta feed settings
+const (
+	MinDeltaFeedKeyLength = 16
+	deltaSubscriptionTTL  = 3 * DefaultReplicaSyncInterval // Replicas renew on every sync
+	deltaSubscribeWindow  = 5 * time.Minute                // Maximum clock skew of a subscription
+)
+
+// DeltaSubscribe asks a trusted node to stream UTXO deltas of the blocks it connects
+type DeltaSubscribe struct {
+	AddrFrom  string
+	Timestamp int64
+	MAC       []byte
+}
+
+// UTXODeltaMsg carries a connected block and the UTXO delta it produced
+type UTXODeltaMsg struct {
+	AddrFrom string
+	Block    []byte
+	Delta    []byte
+	MAC      []byte
+}
+
+// DeltaFeed streams UTXO deltas between nodes sharing a secret key
+//
+// After connecting a block, a node sends the block and the UTXO entries it
+// changed to every subscribed replica. A standby replica applies them with
+// ConnectBlockWithDelta instead of rebuilding its UTXO set, so read-only API
+// nodes stay current cheaply. Messages are authenticated with HMAC-SHA256
+// under the shared key; the replica trusts the content, which is why the key
+// must only be shared between nodes of the same operator.
+type DeltaFeed struct {
+	key         []byte
+	subscribers map[string]time.Time // Address -> subscription expiry
+	applied     int                  // Deltas applied as a replica
+
+	mu sync.Mutex
+}
+
+// EnableDeltaFeed lets trusted nodes holding key subscribe to this node's UTXO
+// deltas and, on a standby replica, subscribes to the primary
+// Must be called before Start
+func (s *Server) EnableDeltaFeed(key []byte) error {
+	if len(key) < MinDeltaFeedKeyLength {
+		return fmt.Errorf("delta feed key must be at least %d bytes", MinDeltaFeedKeyLength)
+	}
+
+	s.DeltaFeed = &DeltaFeed{
+		key:         key,
+		subscribers: make(map[string]time.Time),
+	}
+
+	log.Printf("🔁 UTXO delta feed enabled for trusted nodes")
+	return nil
+}
+
+func (f *DeltaFeed) mac(parts ...[]byte) []byte {
+	h := hmac.New(sha256.New, f.key)
+	for _, part := range parts {
+		h.Write([]byte(strconv.Itoa(len(part)))) // Length prefix keeps parts unambiguous
+		h.Write(part)
+	}
+	return h.Sum(nil)
+}
+
+func subscribeMACParts(addr string, timestamp int64) [][]byte {
+	return [][]byte{[]byte(CmdDeltaSub), []byte(addr), []byte(strconv.FormatInt(timestamp, 10))}
+}
+
+// activeSubscribers returns the unexpired subscribers, dropping the others
+func (f *DeltaFeed) activeSubscribers() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var addrs []string
+	for addr, expiry := range f.subscribers {
+		if time.Now().After(expiry) {
+			delete(f.subscribers, addr)
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// DeltasApplied returns the number of deltas applied as a replica
+func (f *DeltaFeed) DeltasApplied() int {
+	if f == nil {
+		return 0
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.applied
+}
+
+// sendDeltaSubscribe subscribes to (or renews the subscription with) the primary
+func (s *Server) sendDeltaSubscribe(addr string) {
+	timestamp := time.Now().Unix()
+	payload := GobEncode(DeltaSubscribe{
+		AddrFrom:  s.nodeAddress,
+		Timestamp: timestamp,
+		MAC:       s.DeltaFeed.mac(subscribeMACParts(s.nodeAddress, timestamp)...),
+	})
+	s.sendData(addr, append(CmdToBytes(CmdDeltaSub), payload...))
+}
+
+// handleDeltaSubscribe registers an authenticated replica
+func (s *Server) handleDeltaSubscribe(request []byte) {
+	if s.DeltaFeed == nil {
+		return
+	}
+
+	var payload DeltaSubscribe
+	dec := gob.NewDecoder(bytes.NewReader(request[commandLength:]))
+	if err := dec.Decode(&payload); err != nil {
+		log.Printf("Error decoding delta subscription: %v", err)
+		return
+	}
+
+	skew := time.Since(time.Unix(payload.Timestamp, 0))
+	if skew < -deltaSubscribeWindow || skew > deltaSubscribeWindow {
+		log.Printf("⚠️  Refusing delta subscription from %s: stale timestamp", payload.AddrFrom)
+		return
+	}
+	if !hmac.Equal(payload.MAC, s.DeltaFeed.mac(subscribeMACParts(payload.AddrFrom, payload.Timestamp)...)) {
+		log.Printf("⚠️  Refusing delta subscription from %s: bad authentication", payload.AddrFrom)
+		return
+	}
+
+	s.DeltaFeed.mu.Lock()
+	_, renewed := s.DeltaFeed.subscribers[payload.AddrFrom]
+	s.DeltaFeed.subscribers[payload.AddrFrom] = time.Now().Add(deltaSubscriptionTTL)
+	s.DeltaFeed.mu.Unlock()
+
+	if !renewed {
+		log.Printf("🔁 %s subscribed to UTXO deltas", payload.AddrFrom)
+	}
+}
+
+// publishDelta sends the UTXO delta of a newly connected block to the subscribers
+func (s *Server) publishDelta(block *blockchain.Block) {
+	if s.DeltaFeed == nil {
+		return
+	}
+
+	subscribers := s.DeltaFeed.activeSubscribers()
+	if len(subscribers) == 0 {
+		return
+	}
+
+	delta, err := s.Blockchain.UTXODeltaFor(block)
+	if err != nil {
+		log.Printf("⚠️  Not publishing UTXO delta: %v", err) // Replicas catch up through block sync
+		return
+	}
+
+	blockData := block.Serialize()
+	deltaData := GobEncode(delta)
+	payload := GobEncode(UTXODeltaMsg{
+		AddrFrom: s.nodeAddress,
+		Block:    blockData,
+		Delta:    deltaData,
+		MAC:      s.DeltaFeed.mac([]byte(CmdUTXODelta), []byte(s.nodeAddress), blockData, deltaData),
+	})
+	request := append(CmdToBytes(CmdUTXODelta), payload...)
+
+	for _, addr := range subscribers {
+		s.sendData(addr, request)
+	}
+}
+
+// handleUTXODelta applies a delta from the primary of a standby replica
+func (s *Server) handleUTXODelta(request []byte) {
+	if s.DeltaFeed == nil || !s.Standby() {
+		return
+	}
+
+	var payload UTXODeltaMsg
+	dec := gob.NewDecoder(bytes.NewReader(request[commandLength:]))
+	if err := dec.Decode(&payload); err != nil {
+		log.Printf("Error decoding UTXO delta: %v", err)
+		return
+	}
+
+	primary := s.Replica.Primary
+	if payload.AddrFrom != primary {
+		log.Printf("⚠️  Ignoring UTXO delta from %s, only the primary %s is trusted", payload.AddrFrom, primary)
+		return
+	}
+	if !hmac.Equal(payload.MAC, s.DeltaFeed.mac([]byte(CmdUTXODelta), []byte(payload.AddrFrom), payload.Block, payload.Delta)) {
+		log.Printf("⚠️  Ignoring UTXO delta from %s: bad authentication", payload.AddrFrom)
+		return
+	}
+
+	block, err := blockchain.DecodeBlock(payload.Block)
+	if err != nil {
+		log.Printf("Error decoding UTXO delta block: %v", err)
+		return
+	}
+	var delta blockchain.UTXODelta
+	if err := gob.NewDecoder(bytes.NewReader(payload.Delta)).Decode(&delta); err != nil {
+		log.Printf("Error decoding UTXO delta: %v", err)
+		return
+	}
+
+	// Behind or diverged replicas catch up through the regular block sync of replicaLoop
+	if height := s.getBestHeight(); block.Height != height+1 {
+		if block.Height > height+1 {
+			log.Printf("🔁 UTXO delta for block %d skipped, our height is %d", block.Height, height)
+		}
+		return
+	}
+
+	if err := s.Blockchain.ConnectBlockWithDelta(block, delta); err != nil {
+		log.Printf("⚠️  UTXO delta for block %d not applied: %v", block.Height, err)
+		return
+	}
+
+	s.DeltaFeed.mu.Lock()
+	s.DeltaFeed.applied++
+	s.DeltaFeed.mu.Unlock()
+
+	log.Printf("🔁 Applied UTXO delta of block %d (%d entries)", block.Height, len(delta.Entries))
+	s.blockConnected(block)
+}
@@ -0,0 +1,156 @@
+package network
+
+import (
+	"encoding/hex"
+	"sort"
+	"sync"
+
+	"github.com/marcocsrachid/blockchain-go/internal/api"
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// Fee estimation configuration
+const (
+	DefaultMaxBlockTxBytes = 100000 // Serialized transaction bytes our blocks include (mining policy)
+
+	feeHistoryBlocks = 100 // Connected blocks remembered by the fee estimator
+	feeRecentBlocks  = 20  // Blocks considered for the recent fill
+	feeFullBlock     = 0.9 // Fill at which a block is considered full
+)
+
+// blockFeeStats summarizes the fee rates of the transactions of a connected block
+// Transactions whose fee is unknown (not seen in our mempool) count towards
+// the size only
+type blockFeeStats struct {
+	height     int
+	size       int     // Serialized bytes of the non-coinbase transactions
+	minFeeRate float64 // Lowest fee rate of the transactions with known fee
+	known      int     // Transactions with known fee
+}
+
+// feeEstimator remembers the fill and fee rates of the last connected blocks
+type feeEstimator struct {
+	blocks []blockFeeStats // Oldest first
+	mu     sync.Mutex
+}
+
+func newFeeEstimator() *feeEstimator {
+	return &feeEstimator{}
+}
+
+// record adds the stats of a connected block
+func (f *feeEstimator) record(stats blockFeeStats) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.blocks = append(f.blocks, stats)
+	if len(f.blocks) > feeHistoryBlocks {
+		f.blocks = f.blocks[len(f.blocks)-feeHistoryBlocks:]
+	}
+}
+
+// recent returns copies of the stats of the last n blocks
+func (f *feeEstimator) recent(n int) []blockFeeStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if n > len(f.blocks) {
+		n = len(f.blocks)
+	}
+	return append([]blockFeeStats(nil), f.blocks[len(f.blocks)-n:]...)
+}
+
+// recordBlockFees records the fee stats of a block about to be removed from the mempool
+// The caller must hold mempoolMux
+func (s *Server) recordBlockFees(block *blockchain.Block) {
+	stats := blockFeeStats{height: block.Height}
+
+	for _, tx := range block.Transactions {
+		if tx.IsCoinbase() {
+			continue
+		}
+		stats.size += tx.Size()
+
+		entry, ok := s.mempoolEntries[hex.EncodeToString(tx.ID)]
+		if !ok {
+			continue
+		}
+		if stats.known == 0 || entry.feeRate() < stats.minFeeRate {
+			stats.minFeeRate = entry.feeRate()
+		}
+		stats.known++
+	}
+
+	s.fees.record(stats)
+}
+
+// sortedMempoolIDs returns the mempool txids by fee rate, highest first
+// The caller must hold mempoolMux
+func (s *Server) sortedMempoolIDs() []string {
+	ids := make([]string, 0, len(s.memoryPool))
+	for id := range s.memoryPool {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		ri, rj := s.mempoolEntries[ids[i]].feeRate(), s.mempoolEntries[ids[j]].feeRate()
+		if ri != rj {
+			return ri > rj
+		}
+		return ids[i] < ids[j]
+	})
+
+	return ids
+}
+
+// EstimateFee suggests the fee per byte for a transaction to be mined
+// within blocks blocks: the rate needed to beat the mempool transactions
+// that fill those blocks ahead of it, or the median lowest rate mined in
+// recent blocks when they were mostly full, whichever is higher
+func (s *Server) EstimateFee(blocks int) api.FeeEstimateResponse {
+	resp := api.FeeEstimateResponse{
+		Blocks:       blocks,
+		MaxBlockSize: DefaultMaxBlockTxBytes,
+	}
+
+	// Mempool: the rate of the transaction crossing the space of the next blocks
+	s.mempoolMux.RLock()
+	space := blocks * DefaultMaxBlockTxBytes
+	var mempoolRate float64
+	for _, id := range s.sortedMempoolIDs() {
+		entry := s.mempoolEntries[id]
+		resp.MempoolTxs++
+		resp.MempoolBytes += entry.size
+		if mempoolRate == 0 && resp.MempoolBytes > space {
+			mempoolRate = entry.feeRate()
+		}
+	}
+	s.mempoolMux.RUnlock()
+
+	// Recent blocks: what it took to get into them when they were full
+	recent := s.fees.recent(feeRecentBlocks)
+	var fullRates []float64
+	var filled int
+	for _, stats := range recent {
+		filled += stats.size
+		if float64(stats.size) >= feeFullBlock*DefaultMaxBlockTxBytes && stats.known > 0 {
+			fullRates = append(fullRates, stats.minFeeRate)
+		}
+	}
+
+	var recentRate float64
+	if len(recent) > 0 {
+		resp.RecentBlocks = len(recent)
+		resp.RecentFill = float64(filled) / float64(len(recent)*DefaultMaxBlockTxBytes)
+		if len(fullRates)*2 > len(recent) {
+			sort.Float64s(fullRates)
+			recentRate = fullRates[len(fullRates)/2]
+		}
+	}
+
+	resp.FeeRate = mempoolRate
+	if recentRate > resp.FeeRate {
+		resp.FeeRate = recentRate
+	}
+
+	return resp
+}
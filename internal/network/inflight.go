@@ -0,0 +1,240 @@
+package network
+
+import (
+	"encoding/hex"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+// In-flight requests
+//
+// Every block and transaction a peer announces in an inv, and that this node
+// lacks, is fetched with a getdata. The announced items wait in a queue per
+// peer, in announcement order, and at most maxRequestsInFlight of them are
+// requested from a peer at once; each answer frees a slot for the next one.
+// An item announced by several peers is fetched once, from the first. A
+// request unanswered for requestTimeout is sent again, to another peer that
+// announced the item when there is one, at most maxRequestAttempts times. The
+// queued items of a peer that timed out go to other peers that announced them,
+// and the rest of its queue is dropped once it is no longer connected.
+
+const (
+	maxRequestsInFlight  = 16 // Per peer
+	maxRequestAttempts   = 3
+	requestTimeout       = 30 * time.Second
+	requestCheckInterval = 5 * time.Second
+)
+
+// getDataRequest is an announced item, queued or requested
+type getDataRequest struct {
+	kind       string
+	id         []byte
+	peer       string    // Requested from, or queued for
+	sent       time.Time // Zero while queued
+	attempts   int
+	announcers []string
+}
+
+// requestTracker tracks the announced items until they arrive
+type requestTracker struct {
+	items    map[string]*getDataRequest // By requestKey
+	queues   map[string][]string        // Peer -> keys of the items not requested yet
+	inFlight map[string]int             // Peer -> items requested
+	mu       sync.Mutex
+}
+
+func newRequestTracker() *requestTracker {
+	return &requestTracker{
+		items:    make(map[string]*getDataRequest),
+		queues:   make(map[string][]string),
+		inFlight: make(map[string]int),
+	}
+}
+
+func requestKey(kind string, id []byte) string {
+	return kind + ":" + hex.EncodeToString(id)
+}
+
+// announce queues the items a peer announced, those tracked already only
+// gain the peer as an announcer
+func (t *requestTracker) announce(peer, kind string, ids [][]byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, id := range ids {
+		key := requestKey(kind, id)
+		if item, ok := t.items[key]; ok {
+			if !slices.Contains(item.announcers, peer) {
+				item.announcers = append(item.announcers, peer)
+			}
+			continue
+		}
+
+		t.items[key] = &getDataRequest{kind: kind, id: id, peer: peer, announcers: []string{peer}}
+		t.queues[peer] = append(t.queues[peer], key)
+	}
+}
+
+// next takes the queued items of a peer to request now, up to its free
+// in-flight slots
+func (t *requestTracker) next(peer string) []getDataRequest {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var requests []getDataRequest
+	queue := t.queues[peer]
+	for len(queue) > 0 && t.inFlight[peer] < maxRequestsInFlight {
+		item, ok := t.items[queue[0]]
+		queue = queue[1:]
+		if !ok {
+			continue // Arrived meanwhile
+		}
+
+		item.sent = time.Now()
+		item.attempts++
+		t.inFlight[peer]++
+		requests = append(requests, *item)
+	}
+
+	if len(queue) == 0 {
+		delete(t.queues, peer)
+	} else {
+		t.queues[peer] = queue
+	}
+	return requests
+}
+
+// received forgets an item that arrived
+func (t *requestTracker) received(kind string, id []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := requestKey(kind, id)
+	item, ok := t.items[key]
+	if !ok {
+		return
+	}
+	delete(t.items, key)
+	if !item.sent.IsZero() {
+		t.release(item.peer)
+	}
+}
+
+// release frees an in-flight slot of a peer; the caller must hold t.mu
+func (t *requestTracker) release(peer string) {
+	if t.inFlight[peer] <= 1 {
+		delete(t.inFlight, peer)
+		return
+	}
+	t.inFlight[peer]--
+}
+
+// pending returns how many items of a peer are queued or in flight
+func (t *requestTracker) pending(peer string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.queues[peer]) + t.inFlight[peer]
+}
+
+// expired moves the requests unanswered for requestTimeout to another
+// announcer, and returns the requests to send again and the peers that
+// timed out; items requested maxRequestAttempts times are given up
+func (t *requestTracker) expired(now time.Time) (retry []getDataRequest, timedOut []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, item := range t.items {
+		if item.sent.IsZero() || now.Sub(item.sent) < requestTimeout {
+			continue
+		}
+
+		t.release(item.peer)
+		if !slices.Contains(timedOut, item.peer) {
+			timedOut = append(timedOut, item.peer)
+		}
+		if item.attempts >= maxRequestAttempts {
+			delete(t.items, key)
+			continue
+		}
+
+		// The next announcer in turn
+		i := slices.Index(item.announcers, item.peer)
+		item.peer = item.announcers[(i+1)%len(item.announcers)]
+		item.sent = now
+		item.attempts++
+		t.inFlight[item.peer]++
+		retry = append(retry, *item)
+	}
+	return retry, timedOut
+}
+
+// reassign moves the queued items of a stalling peer to the queue of another
+// announcer; the items only it announced stay, or are dropped with drop. It
+// returns the peers that got items
+func (t *requestTracker) reassign(peer string, drop bool) (heirs []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var kept []string
+	for _, key := range t.queues[peer] {
+		item, ok := t.items[key]
+		if !ok || !item.sent.IsZero() {
+			continue
+		}
+
+		item.announcers = slices.DeleteFunc(item.announcers, func(a string) bool { return a == peer })
+		if len(item.announcers) == 0 {
+			if drop {
+				delete(t.items, key)
+			} else {
+				item.announcers = []string{peer}
+				kept = append(kept, key)
+			}
+			continue
+		}
+		item.peer = item.announcers[0]
+		t.queues[item.peer] = append(t.queues[item.peer], key)
+		if !slices.Contains(heirs, item.peer) {
+			heirs = append(heirs, item.peer)
+		}
+	}
+
+	if len(kept) == 0 {
+		delete(t.queues, peer)
+	} else {
+		t.queues[peer] = kept
+	}
+	return heirs
+}
+
+// requestItems requests the next announced items of a peer
+func (s *Server) requestItems(peer string) {
+	for _, item := range s.requests.next(peer) {
+		s.sendGetData(peer, item.kind, item.id)
+	}
+}
+
+// requestLoop periodically sends the timed out requests again
+func (s *Server) requestLoop() {
+	ticker := time.NewTicker(requestCheckInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		retry, timedOut := s.requests.expired(now)
+		for _, item := range retry {
+			log.Printf("⏳ No answer for %s %x, requesting it from %s (attempt %d/%d)", item.kind, item.id, item.peer, item.attempts, maxRequestAttempts)
+			go s.sendGetData(item.peer, item.kind, item.id)
+		}
+
+		for _, peer := range timedOut {
+			_, connected := s.Peers.Get(peer)
+			for _, heir := range s.requests.reassign(peer, !connected && !s.Outbound.Contains(peer)) {
+				go s.requestItems(heir)
+			}
+			go s.requestItems(peer)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package network
+
+import (
+	"bytes"
+	"encoding/hex"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// Inventory cache
+//
+// The node remembers the block and transaction hashes it saw recently: the
+// items it received, whatever became of them, and the items it announced. An
+// inv only announcing such items is ignored, so an item is not fetched again
+// each time another peer announces it. The node also remembers which peer
+// knows which item, having announced it or been sent it, and relays a new
+// block or transaction to the connected peers that do not know it only, never
+// back to the peer it came from. Both caches are rolling: when full, they
+// forget the oldest half of their hashes.
+
+const (
+	seenInventorySize = 50000
+	peerInventorySize = 5000
+	peerInventoryIdle = 30 * time.Minute // Peers idle this long are forgotten
+
+	// Blocks older than this are synced, not relayed
+	blockRelayMaxAge = time.Hour
+)
+
+// rollingSet is a set of at most size keys, forgetting the oldest half when full
+type rollingSet struct {
+	current  map[string]struct{}
+	previous map[string]struct{}
+	size     int
+}
+
+func newRollingSet(size int) *rollingSet {
+	return &rollingSet{current: make(map[string]struct{}), size: size}
+}
+
+func (r *rollingSet) add(key string) {
+	if _, ok := r.current[key]; ok {
+		return
+	}
+	if len(r.current) >= r.size/2 {
+		r.previous, r.current = r.current, make(map[string]struct{})
+	}
+	r.current[key] = struct{}{}
+}
+
+func (r *rollingSet) contains(key string) bool {
+	if _, ok := r.current[key]; ok {
+		return true
+	}
+	_, ok := r.previous[key]
+	return ok
+}
+
+// peerInventory is the inventory a peer is known to have
+type peerInventory struct {
+	items *rollingSet
+	used  time.Time
+}
+
+// inventoryCache remembers the inventory seen by this node and known by each peer
+type inventoryCache struct {
+	seen   *rollingSet
+	peers  map[string]*peerInventory
+	pruned time.Time
+	mu     sync.Mutex
+}
+
+func newInventoryCache() *inventoryCache {
+	return &inventoryCache{
+		seen:   newRollingSet(seenInventorySize),
+		peers:  make(map[string]*peerInventory),
+		pruned: time.Now(),
+	}
+}
+
+func inventoryKey(kind string, id []byte) string {
+	return kind + ":" + hex.EncodeToString(id)
+}
+
+// markSeen remembers an item this node received or announced
+func (c *inventoryCache) markSeen(kind string, id []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seen.add(inventoryKey(kind, id))
+}
+
+// hasSeen reports whether this node recently received or announced an item
+func (c *inventoryCache) hasSeen(kind string, id []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.seen.contains(inventoryKey(kind, id))
+}
+
+// peerHas remembers that a peer knows an item
+func (c *inventoryCache) peerHas(peer, kind string, id []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.prune(now)
+
+	inventory, ok := c.peers[peer]
+	if !ok {
+		inventory = &peerInventory{items: newRollingSet(peerInventorySize)}
+		c.peers[peer] = inventory
+	}
+	inventory.items.add(inventoryKey(kind, id))
+	inventory.used = now
+}
+
+// peerKnows reports whether a peer is known to have an item
+func (c *inventoryCache) peerKnows(peer, kind string, id []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	inventory, ok := c.peers[peer]
+	return ok && inventory.items.contains(inventoryKey(kind, id))
+}
+
+// prune forgets the peers idle for peerInventoryIdle; the caller must hold c.mu
+func (c *inventoryCache) prune(now time.Time) {
+	if now.Sub(c.pruned) < peerInventoryIdle {
+		return
+	}
+	c.pruned = now
+
+	for peer, inventory := range c.peers {
+		if now.Sub(inventory.used) >= peerInventoryIdle {
+			delete(c.peers, peer)
+		}
+	}
+}
+
+// relayPeersWithout returns the relay peers not known to have an item, other
+// than from, and remembers that they are about to
+func (s *Server) relayPeersWithout(kind string, id []byte, from string) []string {
+	var peers []string
+	for _, peer := range s.relayPeers() {
+		if peer == from || s.inventory.peerKnows(peer, kind, id) {
+			continue
+		}
+		s.inventory.peerHas(peer, kind, id)
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+// relayInventory announces a block or transaction received from a peer to
+// the other peers that do not know it
+func (s *Server) relayInventory(kind string, id []byte, from string) {
+	peers := s.relayPeersWithout(kind, id, from)
+	if len(peers) == 0 {
+		return
+	}
+
+	log.Printf("📡 Relaying %s %x to %d peers", kind, id, len(peers))
+	for _, peer := range peers {
+		go s.sendInv(peer, kind, [][]byte{id})
+	}
+}
+
+// relayBlock relays a block received from a peer when it became our tip and
+// is recent; the blocks of a sync are not relayed one by one
+func (s *Server) relayBlock(block *blockchain.Block, from string) {
+	if !bytes.Equal(s.Blockchain.LastHash, block.Hash) || time.Since(time.Unix(block.Timestamp, 0)) > blockRelayMaxAge {
+		return
+	}
+	s.relayInventory(InvTypeBlock, block.Hash, from)
+}
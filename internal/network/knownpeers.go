@@ -0,0 +1,100 @@
+package network
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// Known peers persistence
+//
+// The known nodes and their gossip records are saved to peers.json in the
+// data directory every addrLoopInterval and when the node shuts down, and
+// loaded when it starts, so a restarted node reconnects to the network even
+// when its seeds are down. Bans are kept apart, in bans.json (see BanList),
+// and banned addresses are not loaded.
+
+// savedPeer is a known node in peers.json
+type savedPeer struct {
+	Address  string `json:"address"`
+	LastSeen int64  `json:"last_seen"`
+	Services uint64 `json:"services,omitempty"`
+}
+
+// getKnownPeersFile returns the path of the persisted known peers
+func getKnownPeersFile() string {
+	return filepath.Join(blockchain.DataDir(), "peers.json")
+}
+
+// loadKnownPeers adds the saved known peers to the known nodes and returns
+// how many were added; stale ones are skipped
+func (s *Server) loadKnownPeers(path string) int {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("⚠️  Could not read known peers %s: %v", path, err)
+		}
+		return 0
+	}
+
+	var saved []savedPeer
+	if err := json.Unmarshal(data, &saved); err != nil {
+		log.Printf("⚠️  Ignoring corrupted known peers %s: %v", path, err)
+		return 0
+	}
+
+	loaded := 0
+	for _, peer := range saved {
+		if added, _ := s.learnAddress(NetAddress{Addr: peer.Address, LastSeen: peer.LastSeen, Services: peer.Services}); added {
+			loaded++
+		}
+	}
+	return loaded
+}
+
+// saveKnownPeers writes the known nodes atomically and returns how many
+func (s *Server) saveKnownPeers(path string) (int, error) {
+	records := s.addressesFor(s.nodeAddress)
+	saved := make([]savedPeer, 0, len(records))
+	for _, record := range records {
+		saved = append(saved, savedPeer{Address: record.Addr, LastSeen: record.LastSeen, Services: record.Services})
+	}
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return 0, err
+	}
+	return len(saved), os.Rename(tmp, path)
+}
+
+// Shutdown saves the known peers and the peer statistics and stops the
+// recording before the node exits
+func (s *Server) Shutdown() {
+	// A standby replica only knows its primary
+	if !s.Standby() {
+		if saved, err := s.saveKnownPeers(getKnownPeersFile()); err != nil {
+			log.Printf("⚠️  Error saving known peers: %v", err)
+		} else {
+			log.Printf("🌐 Saved %d known peers", saved)
+		}
+	}
+	if err := s.PeerStats.Save(); err != nil {
+		log.Printf("⚠️  Error saving peer stats: %v", err)
+	}
+	if s.Recorder != nil {
+		s.Recorder.Close()
+	}
+}
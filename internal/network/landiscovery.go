@@ -0,0 +1,130 @@
+package network
+
+import (
+	"log"
+	"net"
+	"os"
+	"time"
+)
+
+// LAN discovery
+//
+// With -discover-lan, nodes on the same local network find each other without
+// seeds: every lanAnnounceInterval a node multicasts its P2P address to
+// lanDiscoveryGroup, after the network magic, and learns the addresses its
+// neighbours announce like gossiped ones, dialing them while outbound slots
+// are free. A node listening on all interfaces without NODE_ADDR identifies
+// as its LAN IP, which its neighbours can reach. The group is
+// organization-local: routers do not forward it off the network.
+
+const (
+	lanDiscoveryGroup   = "239.255.42.42:3999"
+	lanAnnounceInterval = 30 * time.Second
+	maxLANAnnouncement  = magicLength + 255
+)
+
+// useLANAddress makes the LAN IP the identity of a node that has no routable
+// one, so its neighbours can answer it
+func (s *Server) useLANAddress() {
+	host, port, err := net.SplitHostPort(s.nodeAddress)
+	if err != nil || os.Getenv("NODE_ADDR") != "" {
+		return
+	}
+	if ip := net.ParseIP(host); host != "" && (ip == nil || !ip.IsUnspecified()) {
+		return
+	}
+
+	ip, err := lanIP()
+	if err != nil {
+		log.Printf("⚠️  LAN discovery: no LAN address: %v", err)
+		return
+	}
+	s.nodeAddress = net.JoinHostPort(ip.String(), port)
+}
+
+// lanIP returns the local IP the discovery multicast leaves from; dialing
+// UDP sends nothing
+func lanIP() (net.IP, error) {
+	conn, err := net.Dial("udp4", lanDiscoveryGroup)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
+
+// lanDiscoveryLoop announces this node on the local network and learns the
+// nodes announced there
+func (s *Server) lanDiscoveryLoop() {
+	group, err := net.ResolveUDPAddr("udp4", lanDiscoveryGroup)
+	if err != nil {
+		log.Printf("⚠️  LAN discovery disabled: %v", err)
+		return
+	}
+	listener, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		log.Printf("⚠️  LAN discovery disabled: %v", err)
+		return
+	}
+	defer listener.Close()
+	sender, err := net.DialUDP("udp4", nil, group)
+	if err != nil {
+		log.Printf("⚠️  LAN discovery disabled: %v", err)
+		return
+	}
+	defer sender.Close()
+
+	log.Printf("🏠 LAN discovery: announcing %s on %s", s.nodeAddress, lanDiscoveryGroup)
+	go s.lanAnnounceLoop(sender)
+
+	buf := make([]byte, maxLANAnnouncement)
+	for {
+		n, from, err := listener.ReadFromUDP(buf)
+		if err != nil {
+			log.Printf("⚠️  LAN discovery stopped: %v", err)
+			return
+		}
+		// Announcements of other networks, or other applications
+		message, ok := stripMagic(buf[:n])
+		if !ok {
+			continue
+		}
+		s.lanAnnounced(string(message), from)
+	}
+}
+
+// lanAnnounceLoop multicasts the address of this node every lanAnnounceInterval
+func (s *Server) lanAnnounceLoop(conn *net.UDPConn) {
+	ticker := time.NewTicker(lanAnnounceInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := conn.Write(withMagic([]byte(s.nodeAddress))); err != nil {
+			log.Printf("⚠️  LAN discovery: announcement failed: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+// lanAnnounced learns a node announced on the local network, and dials the
+// new ones while outbound slots are free
+func (s *Server) lanAnnounced(addr string, from *net.UDPAddr) {
+	// A standby replica only talks to its primary
+	if addr == s.nodeAddress || s.Standby() {
+		return
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return
+	}
+
+	added, _ := s.learnAddress(NetAddress{Addr: addr, LastSeen: time.Now().Unix()})
+	if !added {
+		return
+	}
+	log.Printf("🏠 Discovered LAN peer %s (from %s)", addr, from.IP)
+
+	for _, peer := range s.fillOutbound() {
+		go s.sendVersion(peer)
+	}
+}
@@ -0,0 +1,33 @@
+package network
+
+import (
+	"bytes"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// Network magic
+//
+// Every P2P message starts with the magic bytes of the network the node runs
+// on (ChainParams.Magic), ahead of its command. A message with other magic
+// bytes comes from a node of another network that dialed this one by mistake:
+// it is dropped unread, so mainnet, testnet and private nodes never act on
+// each other's blocks, transactions or addresses.
+
+const magicLength = 4
+
+// withMagic prefixes a message with the network magic
+func withMagic(message []byte) []byte {
+	magic := blockchain.Params().NetworkMagic()
+	return append(magic[:], message...)
+}
+
+// stripMagic returns a message without its network magic, false when it is
+// not prefixed with the magic of this network
+func stripMagic(request []byte) ([]byte, bool) {
+	magic := blockchain.Params().NetworkMagic()
+	if !bytes.HasPrefix(request, magic[:]) {
+		return nil, false
+	}
+	return request[magicLength:], true
+}
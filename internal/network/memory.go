@@ -0,0 +1,248 @@
+package network
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/marcocsrachid/blockchain-go/internal/api"
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// DefaultMaxMemory is the default global limit for accounted memory (300 MB)
+const DefaultMaxMemory = 300 << 20
+
+// DefaultMaxMempool is the default limit for the serialized size of the pending transactions (100 MB)
+const DefaultMaxMempool = 100 << 20
+
+// Accounted memory pools
+const (
+	PoolMempool = "mempool"
+	PoolOrphans = "orphans"
+)
+
+// Fixed per-entry overhead of a mempool entry: map bucket slot, hex txid key
+// (string header + 64 bytes) and the bookkeeping entry
+const mempoolEntryOverhead = int64(unsafe.Sizeof("")) + 64 + int64(unsafe.Sizeof(&blockchain.Transaction{})) +
+	int64(unsafe.Sizeof(mempoolEntry{})) + 16
+
+// Per-input overhead of the spent outputs index: map slot, outpoint key and txid value
+const mempoolSpendOverhead = int64(unsafe.Sizeof(blockchain.Outpoint{})) + 64 + int64(unsafe.Sizeof("")) + 16
+
+// MemoryAccountant tracks memory used by the node's pools against a global limit
+type MemoryAccountant struct {
+	limit int64
+	usage map[string]int64
+	mu    sync.Mutex
+}
+
+// NewMemoryAccountant creates an accountant with the given limit in bytes (0 = unlimited)
+func NewMemoryAccountant(limit int64) *MemoryAccountant {
+	return &MemoryAccountant{
+		limit: limit,
+		usage: make(map[string]int64),
+	}
+}
+
+// Add accounts n bytes to pool
+func (m *MemoryAccountant) Add(pool string, n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.usage[pool] += n
+}
+
+// Release returns n bytes of pool
+func (m *MemoryAccountant) Release(pool string, n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.usage[pool] -= n
+	if m.usage[pool] < 0 {
+		m.usage[pool] = 0
+	}
+}
+
+// Limit returns the global limit in bytes (0 = unlimited)
+func (m *MemoryAccountant) Limit() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.limit
+}
+
+// SetLimit changes the global limit in bytes (0 = unlimited)
+func (m *MemoryAccountant) SetLimit(limit int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.limit = limit
+}
+
+// Total returns the memory used by all pools
+func (m *MemoryAccountant) Total() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.total()
+}
+
+func (m *MemoryAccountant) total() int64 {
+	var total int64
+	for _, n := range m.usage {
+		total += n
+	}
+	return total
+}
+
+// Exceeded reports whether the accounted memory is over the limit
+func (m *MemoryAccountant) Exceeded() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.limit > 0 && m.total() > m.limit
+}
+
+// Usage returns a copy of the per-pool usage
+func (m *MemoryAccountant) Usage() map[string]int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage := make(map[string]int64, len(m.usage))
+	for pool, n := range m.usage {
+		usage[pool] = n
+	}
+	return usage
+}
+
+// MemoryInfo reports the accounted memory usage
+func (s *Server) MemoryInfo() api.MemoryResponse {
+	s.mempoolMux.RLock()
+	mempoolTxs, size := len(s.memoryPool), s.mempoolBytes
+	s.mempoolMux.RUnlock()
+
+	return api.MemoryResponse{
+		Limit:        s.Memory.Limit(),
+		Total:        s.Memory.Total(),
+		Pools:        s.Memory.Usage(),
+		MempoolTxs:   mempoolTxs,
+		MempoolBytes: size,
+		MempoolLimit: s.MaxMempool,
+	}
+}
+
+// txMemoryUsage estimates the heap memory held by a decoded transaction
+func txMemoryUsage(tx *blockchain.Transaction) int64 {
+	size := int64(unsafe.Sizeof(*tx)) + int64(cap(tx.ID))
+
+	for _, in := range tx.Inputs {
+		size += int64(unsafe.Sizeof(in)) + int64(cap(in.ID)+cap(in.Signature)+cap(in.PubKey))
+	}
+	for _, out := range tx.Outputs {
+		size += int64(unsafe.Sizeof(out)) + int64(cap(out.PubKeyHash))
+	}
+
+	return size
+}
+
+// mempoolEntry is the bookkeeping kept for each mempool transaction
+type mempoolEntry struct {
+	fee    int
+	size   int   // Serialized size in bytes
+	memory int64 // Accounted memory in bytes
+	added  time.Time
+}
+
+// feeRate returns the fee per serialized byte of the entry
+func (e mempoolEntry) feeRate() float64 {
+	if e.size == 0 {
+		return 0
+	}
+	return float64(e.fee) / float64(e.size)
+}
+
+// addMempoolEntry adds a transaction to the mempool and accounts its memory
+// The caller must hold mempoolMux
+func (s *Server) addMempoolEntry(txID string, tx *blockchain.Transaction, fee int) {
+	if _, exists := s.memoryPool[txID]; exists {
+		s.removeMempoolEntry(txID)
+	}
+
+	entry := mempoolEntry{
+		fee:    fee,
+		size:   tx.Size(),
+		memory: txMemoryUsage(tx) + mempoolEntryOverhead + int64(len(tx.Inputs))*mempoolSpendOverhead,
+		added:  time.Now(),
+	}
+
+	s.memoryPool[txID] = tx
+	s.mempoolEntries[txID] = entry
+	for _, op := range spentOutpoints(tx) {
+		s.mempoolSpends[op] = txID
+	}
+	s.mempoolBytes += int64(entry.size)
+	s.Memory.Add(PoolMempool, entry.memory)
+}
+
+// removeMempoolEntry removes a transaction from the mempool and releases its memory
+// The caller must hold mempoolMux
+func (s *Server) removeMempoolEntry(txID string) bool {
+	if _, exists := s.memoryPool[txID]; !exists {
+		return false
+	}
+
+	for _, op := range spentOutpoints(s.memoryPool[txID]) {
+		if s.mempoolSpends[op] == txID {
+			delete(s.mempoolSpends, op)
+		}
+	}
+	s.Memory.Release(PoolMempool, s.mempoolEntries[txID].memory)
+	s.mempoolBytes -= int64(s.mempoolEntries[txID].size)
+	delete(s.memoryPool, txID)
+	delete(s.mempoolEntries, txID)
+
+	return true
+}
+
+// mempoolFull reports whether the pending transactions exceed the mempool size limit
+// The caller must hold mempoolMux
+func (s *Server) mempoolFull() bool {
+	return s.MaxMempool > 0 && s.mempoolBytes > s.MaxMempool
+}
+
+// enforceMempoolLimits evicts the lowest fee-rate mempool transactions until
+// the mempool fits its size limit and the accounted memory the global limit,
+// so a flood of low-fee transactions cannot exhaust memory; it returns the
+// evicted txids
+// The caller must hold mempoolMux
+func (s *Server) enforceMempoolLimits() []string {
+	if !s.Memory.Exceeded() && !s.mempoolFull() {
+		return nil
+	}
+
+	ids := make([]string, 0, len(s.memoryPool))
+	for id := range s.memoryPool {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return s.mempoolEntries[ids[i]].feeRate() < s.mempoolEntries[ids[j]].feeRate()
+	})
+
+	var evicted []string
+	for _, id := range ids {
+		if !s.Memory.Exceeded() && !s.mempoolFull() {
+			break
+		}
+		s.removeMempoolEntry(id)
+		evicted = append(evicted, id)
+	}
+
+	if len(evicted) > 0 {
+		log.Printf("🧹 Mempool limit reached: evicted %d lowest fee-rate transactions (mempool: %d / %d bytes, memory: %d / %d bytes)",
+			len(evicted), s.mempoolBytes, s.MaxMempool, s.Memory.Total(), s.Memory.Limit())
+	}
+
+	return evicted
+}
@@ -0,0 +1,290 @@
+package network
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+
+	"github.com/marcocsrachid/blockchain-go/internal/api"
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// CheckMempoolAcceptance runs the full mempool acceptance pipeline on a
+// transaction without adding it to the mempool or relaying it
+// On success it returns the fee the transaction pays
+func (s *Server) CheckMempoolAcceptance(tx *blockchain.Transaction) (int, error) {
+	if err := blockchain.CheckTransactionSanity(tx); err != nil {
+		return 0, err
+	}
+
+	s.mempoolMux.RLock()
+	_, known := s.memoryPool[hex.EncodeToString(tx.ID)]
+	s.mempoolMux.RUnlock()
+
+	if known {
+		return 0, &blockchain.TxRejectError{
+			Code:   blockchain.RejectAlreadyKnown,
+			Reason: "transaction is already in the mempool",
+		}
+	}
+
+	fee, err := s.Blockchain.CheckTransactionInputs(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mempoolMux.RLock()
+	_, err = s.mempoolReplacements(tx, fee)
+	s.mempoolMux.RUnlock()
+	if err != nil {
+		return 0, err
+	}
+
+	return fee, nil
+}
+
+// AcceptToMempool validates a transaction and adds it to the mempool
+func (s *Server) AcceptToMempool(tx *blockchain.Transaction) error {
+	fee, err := s.CheckMempoolAcceptance(tx)
+	if err != nil {
+		return err
+	}
+
+	return s.addToMempool(tx, fee)
+}
+
+// addToMempool stores a transaction paying fee and enforces the mempool limits
+// It fails when the transaction itself had to be evicted
+func (s *Server) addToMempool(tx *blockchain.Transaction, fee int) error {
+	s.mempoolMux.Lock()
+	defer s.mempoolMux.Unlock()
+
+	// Checked again under the write lock: a conflicting transaction may have
+	// been added since the acceptance checks
+	replaced, err := s.mempoolReplacements(tx, fee)
+	if err != nil {
+		return err
+	}
+	for _, id := range replaced {
+		s.removeMempoolEntry(id)
+		log.Printf("♻️  Transaction %s replaced in mempool by %x", id, tx.ID)
+	}
+
+	txID := hex.EncodeToString(tx.ID)
+	s.addMempoolEntry(txID, tx, fee)
+	evicted := s.enforceMempoolLimits()
+
+	if len(evicted) > 0 || len(replaced) > 0 {
+		s.templates.notify(true)
+	}
+
+	if _, kept := s.memoryPool[txID]; !kept {
+		return &blockchain.TxRejectError{
+			Code:   blockchain.RejectMempoolFull,
+			Reason: "fee rate too low to fit the mempool size or memory limit",
+		}
+	}
+
+	log.Printf("📥 Added transaction %x to local mempool (size: %d)", tx.ID, len(s.memoryPool))
+	s.templates.notify(true)
+	s.APIServer.PublishTx(tx)
+
+	return nil
+}
+
+// mempoolReplacements returns the pending transactions tx double spends
+// A transaction spending an output a pending one already spends is refused
+// (first seen wins), unless every conflicting transaction signals replacement
+// and tx pays a higher fee and fee rate than each of them: it then replaces them
+// The caller must hold mempoolMux
+func (s *Server) mempoolReplacements(tx *blockchain.Transaction, fee int) ([]string, error) {
+	txID := hex.EncodeToString(tx.ID)
+
+	var conflicts []string
+	seen := make(map[string]bool)
+	for _, op := range spentOutpoints(tx) {
+		other, ok := s.mempoolSpends[op]
+		if !ok || other == txID || seen[other] {
+			continue
+		}
+		seen[other] = true
+		conflicts = append(conflicts, other)
+
+		if !s.memoryPool[other].SignalsReplacement() {
+			return nil, &blockchain.TxRejectError{
+				Code:   blockchain.RejectMempoolConflict,
+				Reason: fmt.Sprintf("output %s is already spent by pending transaction %s", op, other),
+			}
+		}
+	}
+
+	rate := mempoolEntry{fee: fee, size: tx.Size()}.feeRate()
+	for _, other := range conflicts {
+		entry := s.mempoolEntries[other]
+		if fee <= entry.fee || rate <= entry.feeRate() {
+			return nil, &blockchain.TxRejectError{
+				Code: blockchain.RejectMempoolConflict,
+				Reason: fmt.Sprintf("replacement of pending transaction %s must pay a higher fee and fee rate (%d > %d, %.4f > %.4f)",
+					other, fee, entry.fee, rate, entry.feeRate()),
+			}
+		}
+	}
+
+	return conflicts, nil
+}
+
+// spentOutpoints returns the outputs a transaction spends
+func spentOutpoints(tx *blockchain.Transaction) []blockchain.Outpoint {
+	if tx.IsCoinbase() {
+		return nil
+	}
+
+	outpoints := make([]blockchain.Outpoint, 0, len(tx.Inputs))
+	for _, in := range tx.Inputs {
+		outpoints = append(outpoints, blockchain.Outpoint{TxID: hex.EncodeToString(in.ID), Out: in.Out})
+	}
+	return outpoints
+}
+
+// conflictingSpend returns the transaction in spent (outpoint -> txid) that
+// spends an output tx spends as well ("" = none)
+func conflictingSpend(tx *blockchain.Transaction, spent map[blockchain.Outpoint]string) string {
+	for _, op := range spentOutpoints(tx) {
+		if txID, ok := spent[op]; ok {
+			return txID
+		}
+	}
+	return ""
+}
+
+// MempoolTransaction returns a pending transaction by hex ID
+func (s *Server) MempoolTransaction(txID string) (*blockchain.Transaction, bool) {
+	s.mempoolMux.RLock()
+	defer s.mempoolMux.RUnlock()
+
+	tx, ok := s.memoryPool[txID]
+	return tx, ok
+}
+
+// MempoolEntries returns the pending transactions in the order block
+// selection considers them: highest fee rate first, then lowest txid
+func (s *Server) MempoolEntries() []api.MempoolEntry {
+	s.mempoolMux.RLock()
+	defer s.mempoolMux.RUnlock()
+
+	ids := s.sortedMempoolIDs()
+	entries := make([]api.MempoolEntry, len(ids))
+	for i, id := range ids {
+		entry := s.mempoolEntries[id]
+		entries[i] = api.MempoolEntry{
+			TxID:    id,
+			Fee:     entry.fee,
+			Size:    entry.size,
+			FeeRate: entry.feeRate(),
+			Time:    entry.added.Unix(),
+		}
+	}
+
+	return entries
+}
+
+// MempoolConflicts lists the mempool transactions spending an output tx
+// spends, and which of them, tx included, block selection would take: the
+// highest fee rate, then the lowest txid (see selectMempoolTransactions)
+// tx may be pending or not; in the latter case its inputs must be valid
+func (s *Server) MempoolConflicts(tx *blockchain.Transaction) (api.MempoolConflictsResponse, error) {
+	txID := hex.EncodeToString(tx.ID)
+
+	s.mempoolMux.RLock()
+	entry, pending := s.mempoolEntries[txID]
+	s.mempoolMux.RUnlock()
+
+	if !pending {
+		if err := blockchain.CheckTransactionSanity(tx); err != nil {
+			return api.MempoolConflictsResponse{}, err
+		}
+		fee, err := s.Blockchain.CheckTransactionInputs(tx)
+		if err != nil {
+			return api.MempoolConflictsResponse{}, err
+		}
+		entry = mempoolEntry{fee: fee, size: tx.Size()}
+	}
+
+	response := api.MempoolConflictsResponse{
+		TxID:        txID,
+		InMempool:   pending,
+		Fee:         entry.fee,
+		Size:        entry.size,
+		FeeRate:     entry.feeRate(),
+		Replaceable: tx.SignalsReplacement(),
+		Winner:      txID,
+		Conflicts:   []api.MempoolConflict{},
+	}
+
+	spends := make(map[blockchain.Outpoint]bool)
+	for _, op := range spentOutpoints(tx) {
+		spends[op] = true
+	}
+
+	s.mempoolMux.RLock()
+	defer s.mempoolMux.RUnlock()
+
+	winnerRate := entry.feeRate()
+	for _, id := range s.sortedMempoolIDs() {
+		if id == txID {
+			continue
+		}
+
+		other := s.memoryPool[id]
+		var shared []string
+		for _, op := range spentOutpoints(other) {
+			if spends[op] {
+				shared = append(shared, op.String())
+			}
+		}
+		if len(shared) == 0 {
+			continue
+		}
+
+		otherEntry := s.mempoolEntries[id]
+		response.Conflicts = append(response.Conflicts, api.MempoolConflict{
+			TxID:        id,
+			Fee:         otherEntry.fee,
+			Size:        otherEntry.size,
+			FeeRate:     otherEntry.feeRate(),
+			Replaceable: other.SignalsReplacement(),
+			Shared:      shared,
+		})
+
+		rate := otherEntry.feeRate()
+		if rate > winnerRate || rate == winnerRate && id < response.Winner {
+			response.Winner = id
+			winnerRate = rate
+		}
+	}
+
+	return response, nil
+}
+
+// removeBlockConflicts evicts the pending transactions that spend an output
+// already spent by a block, losers of a conflict can never be mined
+// The caller must hold mempoolMux
+func (s *Server) removeBlockConflicts(block *blockchain.Block) int {
+	spent := make(map[blockchain.Outpoint]string)
+	for _, tx := range block.Transactions {
+		for _, op := range spentOutpoints(tx) {
+			spent[op] = hex.EncodeToString(tx.ID)
+		}
+	}
+
+	removed := 0
+	for id, tx := range s.memoryPool {
+		if winner := conflictingSpend(tx, spent); winner != "" && winner != id {
+			log.Printf("⚔️  Evicting transaction %s from mempool (conflicts with mined %s)", id, winner)
+			if s.removeMempoolEntry(id) {
+				removed++
+			}
+		}
+	}
+	return removed
+}
@@ -0,0 +1,75 @@
+package network
+
+import (
+	"github.com/marcocsrachid/blockchain-go/internal/api"
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// minerAddress returns the address mining rewards go to ("" = never mined)
+func (s *Server) minerAddress() string {
+	s.miningMux.Lock()
+	defer s.miningMux.Unlock()
+
+	return s.miningAddress
+}
+
+// StopMining stops the mining loop, abandoning the block being mined
+// It reports whether the node was mining
+func (s *Server) StopMining() bool {
+	s.miningCtl.Lock()
+	defer s.miningCtl.Unlock()
+
+	s.miningMux.Lock()
+	mining := s.IsMining
+	s.IsMining = false
+	s.miningMux.Unlock()
+
+	if !mining {
+		return false
+	}
+
+	// Abort the proof of work in progress, then wait for the loop to exit
+	select {
+	case s.miningInterrupt <- true:
+	default:
+	}
+	s.stopMining <- true
+	s.Mining.stopped()
+
+	return true
+}
+
+// MiningStatus reports whether the node mines, where the rewards go and how
+// fast it hashes
+func (s *Server) MiningStatus() api.MiningStatusResponse {
+	s.miningMux.Lock()
+	status := api.MiningStatusResponse{
+		Mining:          s.IsMining,
+		Address:         s.miningAddress,
+		CoinbaseMessage: s.CoinbaseMessage,
+	}
+	s.miningMux.Unlock()
+	status.BlocksMined = s.Mining.blocks()
+	if since := s.Mining.session(); !since.IsZero() {
+		status.Since = since.Unix()
+	}
+
+	if s.Standby() {
+		s.Replica.mu.Lock()
+		status.Address = s.Replica.minerAddress
+		s.Replica.mu.Unlock()
+		status.Deferred = status.Address != ""
+	}
+
+	if split, err := blockchain.ParseRewardSplit(status.Address); err == nil {
+		status.Shares = split
+	}
+
+	status.LocalHashPS, _ = blockchain.MinerHashRate()
+	throttle := blockchain.GetMiningThrottle()
+	status.CPUPercent = throttle.CPUPercent
+	status.MaxHashRate = throttle.MaxHashRate
+	status.LowPriority = throttle.LowPriority
+
+	return status
+}
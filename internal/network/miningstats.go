@@ -0,0 +1,197 @@
+package network
+
+import (
+	"bytes"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/marcocsrachid/blockchain-go/internal/api"
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+const (
+	miningStatsLogInterval = 10 * time.Minute // Between mining summaries in the log
+	maxTrackedMinedBlocks  = 1000             // Older mined blocks are settled into the totals
+)
+
+// minedBlock is a block mined by this node
+type minedBlock struct {
+	height int
+	hash   []byte
+	reward int // Coinbase outputs
+}
+
+// MiningStats tracks what the local miner achieved since the node started
+type MiningStats struct {
+	mined       []minedBlock  // Recent mined blocks, oldest first, checked against the main chain
+	settled     int           // Mined blocks dropped from mined, still in the main chain when dropped
+	settledLost int           // Mined blocks dropped from mined, orphaned when dropped
+	settledPay  int           // Reward of the settled main chain blocks
+	interrupted int           // Rounds abandoned for a block from a peer
+	active      time.Duration // Time spent mining in finished sessions
+	since       time.Time     // Start of the current session (zero = not mining)
+	mu          sync.Mutex
+}
+
+// NewMiningStats creates empty mining statistics
+func NewMiningStats() *MiningStats {
+	return &MiningStats{}
+}
+
+// started marks the start of a mining session
+func (m *MiningStats) started() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.since = time.Now()
+}
+
+// stopped marks the end of a mining session
+func (m *MiningStats) stopped() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.since.IsZero() {
+		m.active += time.Since(m.since)
+		m.since = time.Time{}
+	}
+}
+
+// session returns when the current mining session started (zero = not mining)
+func (m *MiningStats) session() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.since
+}
+
+// blocks returns the number of blocks mined, orphaned ones included
+func (m *MiningStats) blocks() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.settled + m.settledLost + len(m.mined)
+}
+
+// blockMined records a block found by the local miner
+// chain settles the oldest tracked blocks against the main chain
+func (m *MiningStats) blockMined(block *blockchain.Block, chain *blockchain.Blockchain) {
+	reward := 0
+	for _, tx := range block.Transactions {
+		if tx.IsCoinbase() {
+			for _, out := range tx.Outputs {
+				reward += out.Value
+			}
+		}
+	}
+
+	m.mu.Lock()
+	m.mined = append(m.mined, minedBlock{height: block.Height, hash: block.Hash, reward: reward})
+	var settle []minedBlock
+	if len(m.mined) > maxTrackedMinedBlocks {
+		settle = append(settle, m.mined[:len(m.mined)-maxTrackedMinedBlocks]...)
+		m.mined = m.mined[len(settle):]
+	}
+	m.mu.Unlock()
+
+	if len(settle) == 0 {
+		return
+	}
+
+	mainChain := mainChainHashes(chain, settle[0].height)
+	m.mu.Lock()
+	for _, b := range settle {
+		if bytes.Equal(mainChain[b.height], b.hash) {
+			m.settled++
+			m.settledPay += b.reward
+		} else {
+			m.settledLost++
+		}
+	}
+	m.mu.Unlock()
+}
+
+// roundInterrupted records a block abandoned because a peer's block came first
+func (m *MiningStats) roundInterrupted() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.interrupted++
+}
+
+// mainChainHashes maps the heights from the tip down to height to the hashes
+// of the main chain blocks
+func mainChainHashes(chain *blockchain.Blockchain, height int) map[int][]byte {
+	hashes := make(map[int][]byte)
+
+	chain.RLockState()
+	defer chain.RUnlockState()
+
+	iter := chain.Iterator()
+	for {
+		block := iter.Next()
+		hashes[block.Height] = block.Hash
+		if block.Height <= height || len(block.PrevHash) == 0 {
+			return hashes
+		}
+	}
+}
+
+// Snapshot summarizes the statistics; mined blocks no longer in the main
+// chain are orphaned and earned nothing
+func (m *MiningStats) Snapshot(chain *blockchain.Blockchain) api.MiningStatsResponse {
+	m.mu.Lock()
+	mined := append([]minedBlock{}, m.mined...)
+	stats := api.MiningStatsResponse{
+		BlocksMined:   m.settled + m.settledLost + len(mined),
+		Orphaned:      m.settledLost,
+		RewardEarned:  m.settledPay,
+		Interrupted:   m.interrupted,
+		MiningSeconds: m.active.Seconds(),
+	}
+	if !m.since.IsZero() {
+		stats.MiningSeconds += time.Since(m.since).Seconds()
+	}
+	m.mu.Unlock()
+
+	if len(mined) > 0 {
+		mainChain := mainChainHashes(chain, mined[0].height)
+		for _, b := range mined {
+			if bytes.Equal(mainChain[b.height], b.hash) {
+				stats.RewardEarned += b.reward
+			} else {
+				stats.Orphaned++
+			}
+		}
+		stats.LastBlockHeight = mined[len(mined)-1].height
+	}
+
+	if stats.BlocksMined > 0 {
+		stats.AvgTimeToBlock = stats.MiningSeconds / float64(stats.BlocksMined)
+	}
+	stats.HashPS, _ = blockchain.MinerHashRate()
+
+	return stats
+}
+
+// MiningStats returns the statistics of the local miner
+func (s *Server) MiningStats() api.MiningStatsResponse {
+	return s.Mining.Snapshot(s.Blockchain)
+}
+
+// miningStatsLoop periodically logs a summary of the local miner's statistics
+func (s *Server) miningStatsLoop() {
+	ticker := time.NewTicker(miningStatsLogInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if s.Mining.session().IsZero() {
+			continue
+		}
+
+		stats := s.MiningStats()
+		log.Printf("📊 Mining: %d blocks mined (%d orphaned, %d rounds interrupted), %d coins earned, %.0fs per block, %.0f H/s",
+			stats.BlocksMined, stats.Orphaned, stats.Interrupted, stats.RewardEarned, stats.AvgTimeToBlock, stats.HashPS)
+	}
+}
@@ -0,0 +1,106 @@
+package network
+
+import (
+	"encoding/hex"
+	"sync"
+	"unsafe"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// maxOrphanBlocks is the number of blocks kept while their parent is missing
+// Block sync fetches the missing blocks highest first, so a fork or a gap up to
+// this depth is connected as soon as its lowest block arrives
+const maxOrphanBlocks = 500
+
+// orphanPool keeps blocks whose parent is not known yet, by parent hash
+type orphanPool struct {
+	blocks map[string]*blockchain.Block // By hash
+	byPrev map[string][]string          // Parent hash -> orphan hashes
+	order  []string                     // Oldest first
+	memory *MemoryAccountant
+	mu     sync.Mutex
+}
+
+func newOrphanPool(memory *MemoryAccountant) *orphanPool {
+	return &orphanPool{
+		blocks: make(map[string]*blockchain.Block),
+		byPrev: make(map[string][]string),
+		memory: memory,
+	}
+}
+
+// blockMemoryUsage estimates the heap memory held by a decoded block
+func blockMemoryUsage(block *blockchain.Block) int64 {
+	usage := int64(unsafe.Sizeof(*block)) + int64(len(block.Hash)+len(block.PrevHash)+len(block.UTXORoot))
+	for _, tx := range block.Transactions {
+		usage += txMemoryUsage(tx)
+	}
+	return usage
+}
+
+// add keeps an orphan, forgetting the oldest beyond maxOrphanBlocks
+func (p *orphanPool) add(block *blockchain.Block) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	hash := hex.EncodeToString(block.Hash)
+	if _, ok := p.blocks[hash]; ok {
+		return
+	}
+
+	prev := hex.EncodeToString(block.PrevHash)
+	p.blocks[hash] = block
+	p.byPrev[prev] = append(p.byPrev[prev], hash)
+	p.order = append(p.order, hash)
+	p.memory.Add(PoolOrphans, blockMemoryUsage(block))
+
+	for len(p.order) > maxOrphanBlocks {
+		p.remove(p.order[0])
+	}
+}
+
+// remove forgets an orphan
+// The caller must hold mu
+func (p *orphanPool) remove(hash string) {
+	block, ok := p.blocks[hash]
+	if !ok {
+		return
+	}
+	delete(p.blocks, hash)
+	p.memory.Release(PoolOrphans, blockMemoryUsage(block))
+
+	prev := hex.EncodeToString(block.PrevHash)
+	siblings := p.byPrev[prev]
+	for i, sibling := range siblings {
+		if sibling == hash {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+	if len(siblings) == 0 {
+		delete(p.byPrev, prev)
+	} else {
+		p.byPrev[prev] = siblings
+	}
+
+	for i, id := range p.order {
+		if id == hash {
+			p.order = append(p.order[:i], p.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// children takes the orphans waiting for parent out of the pool
+func (p *orphanPool) children(parent []byte) []*blockchain.Block {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var blocks []*blockchain.Block
+	for _, hash := range append([]string(nil), p.byPrev[hex.EncodeToString(parent)]...) {
+		blocks = append(blocks, p.blocks[hash])
+		p.remove(hash)
+	}
+	return blocks
+}
@@ -0,0 +1,194 @@
+package network
+
+import (
+	"log"
+	"math"
+	"math/rand"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Outbound peer defaults
+const (
+	DefaultMaxOutbound      = 8
+	DefaultRotationInterval = 10 * time.Minute
+	DefaultRotationFraction = 0.25 // Fraction of outbound peers replaced on each rotation
+)
+
+// OutboundSet tracks the peers this node actively syncs from
+// Peers are spread across network groups so a single /16 can't fill every slot
+type OutboundSet struct {
+	peers map[string]time.Time // address -> selected at
+	mu    sync.RWMutex
+}
+
+// NewOutboundSet creates an empty outbound set
+func NewOutboundSet() *OutboundSet {
+	return &OutboundSet{
+		peers: make(map[string]time.Time),
+	}
+}
+
+// Addresses returns the addresses of the outbound peers
+func (o *OutboundSet) Addresses() []string {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	addresses := make([]string, 0, len(o.peers))
+	for addr := range o.peers {
+		addresses = append(addresses, addr)
+	}
+
+	return addresses
+}
+
+// Contains reports whether addr is an outbound peer
+func (o *OutboundSet) Contains(addr string) bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	_, exists := o.peers[addr]
+	return exists
+}
+
+// Count returns the number of outbound peers
+func (o *OutboundSet) Count() int {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	return len(o.peers)
+}
+
+func (o *OutboundSet) add(addr string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.peers[addr] = time.Now()
+}
+
+func (o *OutboundSet) remove(addr string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	delete(o.peers, addr)
+}
+
+// netGroup returns the network group of an address (/16 for IPv4, /32 for IPv6)
+// Hostnames are resolved unless resolve is false; unresolved hosts form their
+// own group
+func netGroup(addr string, resolve bool) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		if !resolve {
+			return "host:" + host
+		}
+		ips, err := net.LookupIP(host)
+		if err != nil || len(ips) == 0 {
+			return "host:" + host
+		}
+		ip = ips[0]
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(16, 32)).String() + "/16"
+	}
+	return ip.Mask(net.CIDRMask(32, 128)).String() + "/32"
+}
+
+// fillOutbound selects new outbound peers from the known nodes until all slots are used
+// Pinned peers come first; then candidates from network groups not yet
+// represented are always preferred, so the outbound slots only share a group
+// when no other group is available
+func (s *Server) fillOutbound() []string {
+	groups := make(map[string]int)
+	for _, addr := range s.Outbound.Addresses() {
+		groups[netGroup(addr, s.Proxy == "")]++
+	}
+
+	var candidates []string
+	candidateGroups := make(map[string]string)
+	for _, addr := range s.KnownNodes() {
+		if addr != s.nodeAddress && !s.Outbound.Contains(addr) && !s.Backoff.Unreachable(addr) && !s.Bans.Banned(addr) && s.Policy.AllowAddr(addr) {
+			candidates = append(candidates, addr)
+			candidateGroups[addr] = netGroup(addr, s.Proxy == "")
+		}
+	}
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+
+	var added []string
+	for s.Outbound.Count() < s.MaxOutbound && len(candidates) > 0 {
+		// Pick a pinned candidate, or the candidate whose group is least represented
+		best := slices.IndexFunc(candidates, s.Policy.IsPinned)
+		if best < 0 {
+			best = 0
+			for i, addr := range candidates {
+				if groups[candidateGroups[addr]] < groups[candidateGroups[candidates[best]]] {
+					best = i
+				}
+			}
+		}
+
+		addr := candidates[best]
+		candidates = append(candidates[:best], candidates[best+1:]...)
+
+		s.Outbound.add(addr)
+		groups[candidateGroups[addr]]++
+		added = append(added, addr)
+	}
+
+	return added
+}
+
+// rotateOutbound replaces a fraction of the outbound peers with fresh ones,
+// pinned peers stay
+func (s *Server) rotateOutbound() {
+	current := slices.DeleteFunc(s.Outbound.Addresses(), s.Policy.IsPinned)
+	evict := int(math.Ceil(float64(len(current)) * s.RotationFraction))
+
+	// Only rotate when there are spare candidates to rotate in
+	spare := 0
+	for _, addr := range s.KnownNodes() {
+		if addr != s.nodeAddress && !s.Outbound.Contains(addr) {
+			spare++
+		}
+	}
+	if spare < evict {
+		evict = spare
+	}
+
+	rand.Shuffle(len(current), func(i, j int) {
+		current[i], current[j] = current[j], current[i]
+	})
+	for _, addr := range current[:evict] {
+		s.Outbound.remove(addr)
+		s.Peers.Remove(addr)
+	}
+
+	added := s.fillOutbound()
+	if evict > 0 || len(added) > 0 {
+		log.Printf("🔄 Rotated outbound peers: %d evicted, %d added (%d/%d slots)", evict, len(added), s.Outbound.Count(), s.MaxOutbound)
+	}
+
+	for _, addr := range added {
+		go s.sendVersion(addr)
+	}
+}
+
+// rotationLoop periodically rotates outbound peers
+func (s *Server) rotationLoop() {
+	ticker := time.NewTicker(s.RotationInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.rotateOutbound()
+	}
+}
@@ -63,6 +63,17 @@ func (pl *PeerList) Get(address string) (*Peer, bool) {
 	return peer, exists
 }
 
+// Version returns the protocol version announced by a peer (0 if unknown)
+func (pl *PeerList) Version(address string) int {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+
+	if peer, exists := pl.peers[address]; exists {
+		return peer.Version
+	}
+	return 0
+}
+
 // GetAll returns all peers
 func (pl *PeerList) GetAll() []*Peer {
 	pl.mu.RLock()
@@ -0,0 +1,146 @@
+package network
+
+import (
+	"log"
+	"slices"
+	"time"
+)
+
+// Peer limits
+//
+// Blocks and transactions are relayed to the connected peers only: the
+// outbound peers this node selected and the inbound peers that sent it their
+// version, at most MaxOutbound and MaxInbound of them. The known nodes are an
+// address book of at most MaxKnownNodes candidates for the outbound slots.
+// When the inbound slots or the address book are full, the least useful peer
+// makes room: the one that contributed the fewest blocks and transactions,
+// the least recently seen first. A dialer keeps the outbound slots filled;
+// peers that fail to dial give up their slot and back off.
+
+// Peer limit defaults
+const (
+	DefaultMaxInbound    = 32
+	DefaultMaxKnownNodes = 1000
+	outboundDialInterval = 30 * time.Second // How often free outbound slots are filled
+)
+
+// inboundPeers returns the connected peers that were not selected as outbound
+func (s *Server) inboundPeers() []string {
+	var inbound []string
+	for _, addr := range s.Peers.GetAddresses() {
+		if !s.Outbound.Contains(addr) {
+			inbound = append(inbound, addr)
+		}
+	}
+	return inbound
+}
+
+// admitInbound makes room for a peer sending its version when the inbound
+// slots are full, evicting the least useful inbound peer
+// An evicted peer is no longer relayed to until it sends its version again
+func (s *Server) admitInbound(addr string) {
+	if s.MaxInbound <= 0 || s.Outbound.Contains(addr) {
+		return
+	}
+	if _, connected := s.Peers.Get(addr); connected {
+		return
+	}
+
+	inbound := s.inboundPeers()
+	if len(inbound) < s.MaxInbound {
+		return
+	}
+
+	// Pinned peers are never evicted
+	inbound = slices.DeleteFunc(inbound, s.Policy.IsPinned)
+	if len(inbound) == 0 {
+		return
+	}
+
+	evicted := s.PeerStats.leastUseful(inbound)
+	s.Peers.Remove(evicted)
+	log.Printf("🚪 Inbound slots full (%d/%d): evicted %s for %s", len(inbound), s.MaxInbound, evicted, addr)
+}
+
+// learnNode adds an address to the known nodes and reports whether it was
+// added
+// When the address book is full, the least useful node that is neither
+// connected, a seed nor pinned is forgotten, unreachable nodes first
+// Addresses the peer policy does not allow are never added
+func (s *Server) learnNode(addr string) bool {
+	if addr == s.nodeAddress || s.Bans.Banned(addr) || !s.Policy.AllowAddr(addr) {
+		return false
+	}
+
+	s.knownMux.Lock()
+	if slices.Contains(s.knownNodes, addr) {
+		s.knownMux.Unlock()
+		return false
+	}
+
+	evicted := ""
+	if s.MaxKnownNodes > 0 && len(s.knownNodes) >= s.MaxKnownNodes {
+		var candidates, unreachable []string
+		for _, known := range s.knownNodes {
+			if _, connected := s.Peers.Get(known); connected || s.Outbound.Contains(known) || slices.Contains(s.seeds, known) || s.Policy.IsPinned(known) {
+				continue
+			}
+			candidates = append(candidates, known)
+			if s.Backoff.Unreachable(known) {
+				unreachable = append(unreachable, known)
+			}
+		}
+		if len(unreachable) > 0 {
+			candidates = unreachable
+		}
+		if len(candidates) == 0 {
+			s.knownMux.Unlock()
+			return false
+		}
+
+		evicted = s.PeerStats.leastUseful(candidates)
+		s.knownNodes = slices.DeleteFunc(s.knownNodes, func(node string) bool { return node == evicted })
+	}
+	s.knownNodes = append(s.knownNodes, addr)
+	s.knownMux.Unlock()
+
+	if evicted != "" {
+		s.forgetNode(evicted)
+	}
+	s.recordAddress(NetAddress{Addr: addr})
+	return true
+}
+
+// relayPeers returns the connected peers blocks and transactions are relayed to
+func (s *Server) relayPeers() []string {
+	seen := map[string]bool{s.nodeAddress: true}
+	var peers []string
+	for _, addr := range append(s.Outbound.Addresses(), s.Peers.GetAddresses()...) {
+		if !seen[addr] && !s.Bans.Banned(addr) {
+			seen[addr] = true
+			peers = append(peers, addr)
+		}
+	}
+	return peers
+}
+
+// dialLoop periodically fills the free outbound slots from the known nodes
+func (s *Server) dialLoop() {
+	ticker := time.NewTicker(outboundDialInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// A standby replica only talks to its primary
+		if s.Standby() {
+			continue
+		}
+
+		added := s.fillOutbound()
+		if len(added) > 0 {
+			log.Printf("🔌 Dialing %d new outbound peers (%d/%d slots)", len(added), s.Outbound.Count(), s.MaxOutbound)
+		}
+		for _, addr := range added {
+			go s.sendVersion(addr)
+		}
+	}
+}
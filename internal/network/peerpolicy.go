@@ -0,0 +1,151 @@
+package network
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"strings"
+)
+
+// Peer policy
+//
+// Operators pin trusted peers with -addpeer: they are dialed first, never
+// rotated out, evicted or forgotten, and never banned automatically. With
+// -connect-only the node talks to its pinned peers only, like a replica to
+// its primary: it neither contacts the seeds nor learns other addresses, and
+// it accepts connections from the IPs of the pinned peers only, which makes
+// private topologies possible. -banip denies IPs and IP ranges for good: their
+// connections are closed before anything is read and they are never dialed.
+
+// PeerPolicy is the operator's peer configuration
+type PeerPolicy struct {
+	Pinned      []string     // Trusted peers, HOST:PORT
+	ConnectOnly bool         // Talk to the pinned peers only
+	Denied      []*net.IPNet // Never connected to
+
+	noResolve bool // Host names are not resolved (behind a proxy)
+}
+
+// ParseIPRange parses an IP or a CIDR range
+func ParseIPRange(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, ipnet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP range %q", s)
+		}
+		return ipnet, nil
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP %q", s)
+	}
+	bits := 128
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// ValidatePinnedPeer checks a -addpeer address
+func ValidatePinnedPeer(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host == "" || port == "" {
+		return fmt.Errorf("invalid peer address %q (HOST:PORT)", addr)
+	}
+	return nil
+}
+
+// IsPinned reports whether addr is a pinned peer
+func (p *PeerPolicy) IsPinned(addr string) bool {
+	return slices.Contains(p.Pinned, addr)
+}
+
+// pinnedIP reports whether a pinned peer is at ip
+func (p *PeerPolicy) pinnedIP(ip string) bool {
+	for _, addr := range p.Pinned {
+		for _, pinned := range p.hostIPs(addr) {
+			if pinned.String() == ip {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hostIPs returns the IPs of the host of an address, resolving host names
+// unless behind a proxy
+func (p *PeerPolicy) hostIPs(addr string) []net.IP {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}
+	}
+	if p.noResolve {
+		return nil
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil
+	}
+	return ips
+}
+
+// denied reports whether ip is in a denied range
+func (p *PeerPolicy) denied(ip net.IP) bool {
+	for _, ipnet := range p.Denied {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowIP reports whether a connection from ip is accepted
+func (p *PeerPolicy) AllowIP(ip net.IP) bool {
+	if ip == nil || p.denied(ip) {
+		return false
+	}
+	if !p.ConnectOnly {
+		return true
+	}
+	for _, pinned := range p.Pinned {
+		if slices.ContainsFunc(p.hostIPs(pinned), ip.Equal) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowAddr reports whether a peer address may be learned and dialed
+func (p *PeerPolicy) AllowAddr(addr string) bool {
+	if p.IsPinned(addr) {
+		return true
+	}
+	if p.ConnectOnly {
+		return false
+	}
+	if len(p.Denied) == 0 {
+		return true
+	}
+	return !slices.ContainsFunc(p.hostIPs(addr), p.denied)
+}
+
+// applyPeerPolicy adds the pinned peers to the known nodes, in place of the
+// seeds with -connect-only
+func (s *Server) applyPeerPolicy() {
+	if s.Policy.ConnectOnly && len(s.Policy.Pinned) > 0 {
+		s.setKnownNodes(s.Policy.Pinned)
+		log.Printf("📌 Connect-only: talking to %d pinned peers only", len(s.Policy.Pinned))
+		return
+	}
+	for _, addr := range s.Policy.Pinned {
+		s.learnNode(addr)
+	}
+	if len(s.Policy.Pinned) > 0 {
+		log.Printf("📌 Pinned %d trusted peers", len(s.Policy.Pinned))
+	}
+}
@@ -0,0 +1,344 @@
+package network
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/marcocsrachid/blockchain-go/internal/api"
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// peerStatsSaveInterval is how often peer statistics are flushed to disk
+const peerStatsSaveInterval = time.Minute
+
+// PeerStats holds protocol statistics collected for a single peer
+type PeerStats struct {
+	Address           string            `json:"address"`
+	BytesSent         uint64            `json:"bytes_sent"`
+	BytesReceived     uint64            `json:"bytes_received"`
+	MessagesSent      map[string]uint64 `json:"messages_sent"`
+	MessagesReceived  map[string]uint64 `json:"messages_received"`
+	BlocksContributed uint64            `json:"blocks_contributed"`
+	TxsContributed    uint64            `json:"txs_contributed"`
+	InvalidBlocks     uint64            `json:"invalid_blocks"`
+	InvalidTxs        uint64            `json:"invalid_txs"`
+	MalformedMessages uint64            `json:"malformed_messages"`
+	RateLimited       uint64            `json:"rate_limited"`
+	FirstSeen         int64             `json:"first_seen"`
+	LastSeen          int64             `json:"last_seen"`
+}
+
+// PeerStatsTable keeps statistics for every peer, persisted as JSON
+type PeerStatsTable struct {
+	stats map[string]*PeerStats
+	path  string
+	dirty bool
+	mu    sync.Mutex
+}
+
+// getPeerStatsFile returns the path of the peer statistics file
+func getPeerStatsFile() string {
+	return filepath.Join(blockchain.DataDir(), "peerstats.json")
+}
+
+// LoadPeerStats loads peer statistics from disk (an empty table if none saved yet)
+func LoadPeerStats(path string) *PeerStatsTable {
+	table := &PeerStatsTable{
+		stats: make(map[string]*PeerStats),
+		path:  path,
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("⚠️  Could not read peer stats %s: %v", path, err)
+		}
+		return table
+	}
+
+	var stats []*PeerStats
+	if err := json.Unmarshal(data, &stats); err != nil {
+		log.Printf("⚠️  Ignoring corrupted peer stats %s: %v", path, err)
+		return table
+	}
+
+	for _, peer := range stats {
+		table.stats[peer.Address] = peer
+	}
+	log.Printf("📊 Loaded statistics for %d peers", len(table.stats))
+
+	return table
+}
+
+// Save writes the statistics to disk if they changed
+func (t *PeerStatsTable) Save() error {
+	t.mu.Lock()
+	if !t.dirty {
+		t.mu.Unlock()
+		return nil
+	}
+	data, err := json.MarshalIndent(t.snapshot(), "", "  ")
+	t.dirty = false
+	t.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated file
+	tmp := t.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.path)
+}
+
+// Get returns a copy of the statistics of every peer
+func (t *PeerStatsTable) Get() []PeerStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := make([]PeerStats, 0, len(t.stats))
+	for _, peer := range t.snapshot() {
+		stats = append(stats, *peer)
+	}
+	return stats
+}
+
+// Lookup returns a copy of the statistics of one peer
+func (t *PeerStatsTable) Lookup(addr string) (PeerStats, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	peer, ok := t.stats[addr]
+	if !ok {
+		return PeerStats{}, false
+	}
+	return copyPeerStats(peer), true
+}
+
+// snapshot copies all entries; the caller must hold t.mu
+func (t *PeerStatsTable) snapshot() []*PeerStats {
+	stats := make([]*PeerStats, 0, len(t.stats))
+	for _, peer := range t.stats {
+		copied := copyPeerStats(peer)
+		stats = append(stats, &copied)
+	}
+	return stats
+}
+
+func copyPeerStats(peer *PeerStats) PeerStats {
+	copied := *peer
+	copied.MessagesSent = make(map[string]uint64, len(peer.MessagesSent))
+	for k, v := range peer.MessagesSent {
+		copied.MessagesSent[k] = v
+	}
+	copied.MessagesReceived = make(map[string]uint64, len(peer.MessagesReceived))
+	for k, v := range peer.MessagesReceived {
+		copied.MessagesReceived[k] = v
+	}
+	return copied
+}
+
+// update applies fn to the statistics of addr, creating the entry if needed
+func (t *PeerStatsTable) update(addr string, fn func(*PeerStats)) {
+	if addr == "" {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	peer, ok := t.stats[addr]
+	if !ok {
+		peer = &PeerStats{
+			Address:          addr,
+			MessagesSent:     make(map[string]uint64),
+			MessagesReceived: make(map[string]uint64),
+			FirstSeen:        time.Now().Unix(),
+		}
+		t.stats[addr] = peer
+	}
+
+	fn(peer)
+	t.dirty = true
+}
+
+// RecordReceived records an inbound message from a peer
+func (t *PeerStatsTable) RecordReceived(addr, command string, size int) {
+	t.update(addr, func(p *PeerStats) {
+		p.BytesReceived += uint64(size)
+		p.MessagesReceived[command]++
+		p.LastSeen = time.Now().Unix()
+	})
+}
+
+// RecordSent records an outbound message to a peer
+func (t *PeerStatsTable) RecordSent(addr, command string, size int) {
+	t.update(addr, func(p *PeerStats) {
+		p.BytesSent += uint64(size)
+		p.MessagesSent[command]++
+	})
+}
+
+// RecordBlock records a block received from a peer
+func (t *PeerStatsTable) RecordBlock(addr string, valid bool) {
+	t.update(addr, func(p *PeerStats) {
+		if valid {
+			p.BlocksContributed++
+		} else {
+			p.InvalidBlocks++
+		}
+	})
+}
+
+// RecordTx records a transaction received from a peer
+func (t *PeerStatsTable) RecordTx(addr string, valid bool) {
+	t.update(addr, func(p *PeerStats) {
+		if valid {
+			p.TxsContributed++
+		} else {
+			p.InvalidTxs++
+		}
+	})
+}
+
+// RecordMalformed records a message from a peer that could not be decoded
+func (t *PeerStatsTable) RecordMalformed(addr string) {
+	t.update(addr, func(p *PeerStats) {
+		p.MalformedMessages++
+	})
+}
+
+// RecordRateLimited records a message from a peer dropped over its rate
+func (t *PeerStatsTable) RecordRateLimited(addr string) {
+	t.update(addr, func(p *PeerStats) {
+		p.RateLimited++
+	})
+}
+
+// leastUseful returns the peer of addrs that contributed the fewest blocks
+// and transactions, the least recently seen of them
+// A block counts as much as ten transactions
+func (t *PeerStatsTable) leastUseful(addrs []string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	usefulness := func(addr string) (uint64, int64) {
+		peer, ok := t.stats[addr]
+		if !ok {
+			return 0, 0
+		}
+		return peer.BlocksContributed*10 + peer.TxsContributed, peer.LastSeen
+	}
+
+	least := ""
+	for _, addr := range addrs {
+		if least == "" {
+			least = addr
+			continue
+		}
+		useful, seen := usefulness(addr)
+		leastUseful, leastSeen := usefulness(least)
+		if useful < leastUseful || useful == leastUseful && seen < leastSeen {
+			least = addr
+		}
+	}
+	return least
+}
+
+// messageSender returns the advertised address of the peer that sent a request
+// Messages without an AddrFrom field are attributed to the remote IP
+func messageSender(request []byte, conn net.Conn) string {
+	var payload struct{ AddrFrom string }
+
+	dec := gob.NewDecoder(bytes.NewReader(request[commandLength:]))
+	if err := dec.Decode(&payload); err == nil && payload.AddrFrom != "" {
+		return payload.AddrFrom
+	}
+
+	return remoteIP(conn)
+}
+
+// PeersInfo returns every known peer together with its protocol statistics
+func (s *Server) PeersInfo() []api.PeerInfo {
+	stats := make(map[string]PeerStats)
+	for _, peer := range s.PeerStats.Get() {
+		stats[peer.Address] = peer
+	}
+
+	addresses := make(map[string]bool)
+	for addr := range stats {
+		addresses[addr] = true
+	}
+	for _, addr := range s.KnownNodes() {
+		if addr != s.nodeAddress {
+			addresses[addr] = true
+		}
+	}
+
+	inbound := make(map[string]bool)
+	for _, addr := range s.inboundPeers() {
+		inbound[addr] = true
+	}
+
+	peers := make([]api.PeerInfo, 0, len(addresses))
+	for addr := range addresses {
+		peer := stats[addr]
+		record, _ := s.addressRecord(addr)
+		peers = append(peers, api.PeerInfo{
+			Address:           addr,
+			Known:             s.nodeIsKnown(addr),
+			Outbound:          s.Outbound.Contains(addr),
+			Inbound:           inbound[addr],
+			Unreachable:       s.Backoff.Unreachable(addr),
+			Banned:            s.Bans.Banned(addr),
+			BanScore:          s.Bans.Score(addr),
+			BytesSent:         peer.BytesSent,
+			BytesReceived:     peer.BytesReceived,
+			MessagesSent:      peer.MessagesSent,
+			MessagesReceived:  peer.MessagesReceived,
+			BlocksContributed: peer.BlocksContributed,
+			TxsContributed:    peer.TxsContributed,
+			InvalidBlocks:     peer.InvalidBlocks,
+			InvalidTxs:        peer.InvalidTxs,
+			MalformedMessages: peer.MalformedMessages,
+			RateLimited:       peer.RateLimited,
+			FirstSeen:         peer.FirstSeen,
+			LastSeen:          peer.LastSeen,
+			AddrLastSeen:      record.LastSeen,
+			Services:          serviceNames(record.Services),
+		})
+	}
+
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].Address < peers[j].Address
+	})
+
+	return peers
+}
+
+// peerStatsLoop periodically flushes peer statistics to disk
+func (s *Server) peerStatsLoop() {
+	ticker := time.NewTicker(peerStatsSaveInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.PeerStats.Save(); err != nil {
+			log.Printf("⚠️  Error saving peer stats: %v", err)
+		}
+	}
+}
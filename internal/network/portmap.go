@@ -0,0 +1,561 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Port mapping
+//
+// A node behind a home router cannot be dialed by its peers unless the router
+// forwards the P2P port to it. With startnode -nat the node asks its gateway
+// to forward the port, over UPnP IGD or NAT-PMP, renews the lease while it
+// runs and advertises the external address of the gateway as its address in
+// version and addr messages. The mapping of a node that stops expires with
+// its lease. NODE_ADDR, when set, is advertised instead.
+
+// Port mapping methods
+const (
+	NATUPnP = "upnp"
+	NATPMP  = "natpmp"
+	NATAny  = "any" // UPnP, then NAT-PMP
+)
+
+const (
+	natLease   = time.Hour
+	natRenew   = natLease / 2 // Renewed halfway through the lease
+	natDesc    = "blockchain-go"
+	natTimeout = 3 * time.Second // UPnP HTTP requests
+)
+
+// NATMethods returns the port mapping methods
+func NATMethods() []string {
+	return []string{NATAny, NATPMP, NATUPnP}
+}
+
+// ValidateNATMethod checks a startnode -nat method ("" disables port mapping)
+func ValidateNATMethod(method string) error {
+	switch method {
+	case "", NATUPnP, NATPMP, NATAny:
+		return nil
+	}
+	return fmt.Errorf("unknown port mapping method %q (valid: %s)", method, strings.Join(NATMethods(), ", "))
+}
+
+// portMapper forwards a TCP port of the gateway to this host
+type portMapper interface {
+	Name() string
+	ExternalIP() (net.IP, error)
+	// AddMapping forwards externalPort to internalPort for lifetime and returns
+	// the external port the gateway chose
+	AddMapping(internalPort, externalPort int, lifetime time.Duration) (int, error)
+}
+
+// discoverPortMapper finds a gateway speaking method
+func discoverPortMapper(method string) (portMapper, error) {
+	switch method {
+	case NATUPnP:
+		return discoverUPnP()
+	case NATPMP:
+		return discoverNATPMP()
+	}
+
+	mapper, err := discoverUPnP()
+	if err == nil {
+		return mapper, nil
+	}
+	mapper, pmpErr := discoverNATPMP()
+	if pmpErr == nil {
+		return mapper, nil
+	}
+	return nil, fmt.Errorf("%v; %v", err, pmpErr)
+}
+
+// mapPort forwards the P2P port on the gateway and advertises the external
+// address, keeping the lease renewed; failures leave the node unreachable
+// from outside but running
+func (s *Server) mapPort() {
+	_, portStr, err := net.SplitHostPort(s.Address)
+	if err != nil {
+		log.Printf("⚠️  Port mapping: invalid listen address %s: %v", s.Address, err)
+		return
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		log.Printf("⚠️  Port mapping: invalid port %s", portStr)
+		return
+	}
+
+	mapper, err := discoverPortMapper(s.NAT)
+	if err != nil {
+		log.Printf("⚠️  Port mapping: no gateway found: %v", err)
+		return
+	}
+	external, err := addPortMapping(mapper, port, port)
+	if err != nil {
+		log.Printf("⚠️  Port mapping: %s gateway refused to forward port %d: %v", mapper.Name(), port, err)
+		return
+	}
+
+	s.portMapper = mapper
+	log.Printf("🌐 Port mapping: %s gateway forwards %s to port %d", mapper.Name(), external, port)
+	if os.Getenv("NODE_ADDR") == "" {
+		s.nodeAddress = external
+	}
+
+	go s.portMapLoop(mapper, port, external)
+}
+
+// addPortMapping forwards a port and returns the external address
+func addPortMapping(mapper portMapper, internalPort, externalPort int) (string, error) {
+	mapped, err := mapper.AddMapping(internalPort, externalPort, natLease)
+	if err != nil {
+		return "", err
+	}
+	ip, err := mapper.ExternalIP()
+	if err != nil {
+		return "", fmt.Errorf("external address: %v", err)
+	}
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsUnspecified() {
+		log.Printf("⚠️  Port mapping: the external address of the gateway, %s, is not public: another NAT is probably in front of it", ip)
+	}
+	return net.JoinHostPort(ip.String(), strconv.Itoa(mapped)), nil
+}
+
+// portMapLoop renews the port mapping before its lease expires
+func (s *Server) portMapLoop(mapper portMapper, port int, advertised string) {
+	ticker := time.NewTicker(natRenew)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		_, externalPort, _ := net.SplitHostPort(advertised)
+		requested, _ := strconv.Atoi(externalPort)
+
+		external, err := addPortMapping(mapper, port, requested)
+		if err != nil {
+			log.Printf("⚠️  Port mapping: renewing the %s mapping of port %d failed: %v", mapper.Name(), port, err)
+			continue
+		}
+		// nodeAddress is read by every connection, it only changes on restart
+		if external != advertised {
+			log.Printf("⚠️  Port mapping: the external address changed from %s to %s, restart the node to advertise it", advertised, external)
+		}
+	}
+}
+
+// PortMapping returns the method forwarding the P2P port, "" when none
+func (s *Server) PortMapping() string {
+	if s.portMapper == nil {
+		return ""
+	}
+	return s.portMapper.Name()
+}
+
+// NAT-PMP (RFC 6886)
+
+const (
+	natPMPPort       = 5351
+	natPMPOpExternal = 0
+	natPMPOpMapTCP   = 2
+	natPMPTries      = 4 // 250ms, doubled each try
+)
+
+type natPMP struct {
+	gateway net.IP
+}
+
+// discoverNATPMP asks the default gateway for its external address
+func discoverNATPMP() (portMapper, error) {
+	gateway, err := defaultGateway()
+	if err != nil {
+		return nil, fmt.Errorf("NAT-PMP: %v", err)
+	}
+	mapper := &natPMP{gateway: gateway}
+	if _, err := mapper.ExternalIP(); err != nil {
+		return nil, err
+	}
+	return mapper, nil
+}
+
+func (n *natPMP) Name() string { return NATPMP }
+
+func (n *natPMP) ExternalIP() (net.IP, error) {
+	resp, err := n.request([]byte{0, natPMPOpExternal}, 12)
+	if err != nil {
+		return nil, err
+	}
+	return net.IPv4(resp[8], resp[9], resp[10], resp[11]), nil
+}
+
+func (n *natPMP) AddMapping(internalPort, externalPort int, lifetime time.Duration) (int, error) {
+	msg := make([]byte, 12)
+	msg[1] = natPMPOpMapTCP
+	binary.BigEndian.PutUint16(msg[4:6], uint16(internalPort))
+	binary.BigEndian.PutUint16(msg[6:8], uint16(externalPort))
+	binary.BigEndian.PutUint32(msg[8:12], uint32(lifetime/time.Second))
+
+	resp, err := n.request(msg, 16)
+	if err != nil {
+		return 0, err
+	}
+	return int(binary.BigEndian.Uint16(resp[10:12])), nil
+}
+
+// request sends a NAT-PMP request, retrying with a doubling timeout, and
+// returns a successful response of at least size bytes
+func (n *natPMP) request(msg []byte, size int) ([]byte, error) {
+	conn, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: n.gateway, Port: natPMPPort})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 16)
+	timeout := 250 * time.Millisecond
+	for try := 0; try < natPMPTries; try, timeout = try+1, timeout*2 {
+		if _, err := conn.Write(msg); err != nil {
+			return nil, err
+		}
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		read, err := conn.Read(buf)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("NAT-PMP: %v", err)
+		}
+
+		if read < size || buf[0] != 0 || buf[1] != msg[1]+128 {
+			return nil, fmt.Errorf("NAT-PMP: unexpected response from %s", n.gateway)
+		}
+		if result := binary.BigEndian.Uint16(buf[2:4]); result != 0 {
+			return nil, fmt.Errorf("NAT-PMP: gateway %s returned result code %d", n.gateway, result)
+		}
+		return buf[:read], nil
+	}
+	return nil, fmt.Errorf("NAT-PMP: no response from gateway %s", n.gateway)
+}
+
+// defaultGateway reads the IPv4 default gateway from the routing table (Linux)
+func defaultGateway() (net.IP, error) {
+	data, err := os.ReadFile("/proc/net/route")
+	if err != nil {
+		return nil, fmt.Errorf("could not read the routing table: %v", err)
+	}
+
+	for _, line := range strings.Split(string(data), "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		gateway, err := strconv.ParseUint(fields[2], 16, 32)
+		if err != nil || gateway == 0 {
+			continue
+		}
+		// Stored in host (little endian) byte order
+		ip := make(net.IP, 4)
+		binary.LittleEndian.PutUint32(ip, uint32(gateway))
+		return ip, nil
+	}
+	return nil, fmt.Errorf("no default gateway")
+}
+
+// UPnP Internet Gateway Device
+
+const (
+	ssdpAddr    = "239.255.255.250:1900"
+	ssdpTimeout = 3 * time.Second
+	upnpIGD     = "urn:schemas-upnp-org:device:InternetGatewayDevice:1"
+
+	upnpErrOnlyPermanentLeases = "725"
+)
+
+// upnpServices are the WAN connection services that forward ports
+var upnpServices = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:2",
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+}
+
+type upnp struct {
+	controlURL  string
+	serviceType string
+	localIP     net.IP // Address of this host on the gateway's network
+	client      *http.Client
+}
+
+// upnpDevice is a device of a UPnP device description
+type upnpDevice struct {
+	Services []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+// discoverUPnP searches the local network for an Internet Gateway Device
+func discoverUPnP() (portMapper, error) {
+	locations, err := ssdpSearch(upnpIGD)
+	if err != nil {
+		return nil, fmt.Errorf("UPnP: %v", err)
+	}
+	if len(locations) == 0 {
+		return nil, fmt.Errorf("UPnP: no gateway answered")
+	}
+
+	client := &http.Client{Timeout: natTimeout}
+	for _, location := range locations {
+		mapper, err := newUPnP(client, location)
+		if err != nil {
+			log.Printf("⚠️  Port mapping: UPnP gateway %s: %v", location, err)
+			continue
+		}
+		return mapper, nil
+	}
+	return nil, fmt.Errorf("UPnP: no gateway with a WAN connection service")
+}
+
+// ssdpSearch multicasts an SSDP search and returns the description URLs of
+// the devices answering
+func ssdpSearch(target string) ([]string, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	addr, err := net.ResolveUDPAddr("udp4", ssdpAddr)
+	if err != nil {
+		return nil, err
+	}
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + ssdpAddr + "\r\n" +
+		"ST: " + target + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n\r\n"
+	if _, err := conn.WriteTo([]byte(search), addr); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var locations []string
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(ssdpTimeout))
+	for {
+		read, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			break // The deadline ends the search
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:read])), nil)
+		if err != nil {
+			continue
+		}
+		location := resp.Header.Get("Location")
+		if location != "" && !seen[location] {
+			seen[location] = true
+			locations = append(locations, location)
+		}
+	}
+	return locations, nil
+}
+
+// newUPnP reads the description of a gateway and finds its WAN connection
+// service
+func newUPnP(client *http.Client, location string) (*upnp, error) {
+	resp, err := client.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("description: %s", resp.Status)
+	}
+
+	var desc struct {
+		URLBase string     `xml:"URLBase"`
+		Device  upnpDevice `xml:"device"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&desc); err != nil {
+		return nil, fmt.Errorf("description: %v", err)
+	}
+
+	base, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	if desc.URLBase != "" {
+		if base, err = url.Parse(desc.URLBase); err != nil {
+			return nil, err
+		}
+	}
+
+	serviceType, controlPath := findUPnPService(desc.Device)
+	if controlPath == "" {
+		return nil, fmt.Errorf("no WAN connection service")
+	}
+	control, err := base.Parse(controlPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// The local address the gateway routes to is the one it forwards to
+	conn, err := net.DialTimeout("udp4", control.Host, natTimeout)
+	if err != nil {
+		return nil, err
+	}
+	localIP := conn.LocalAddr().(*net.UDPAddr).IP
+	conn.Close()
+
+	return &upnp{controlURL: control.String(), serviceType: serviceType, localIP: localIP, client: client}, nil
+}
+
+// findUPnPService returns the preferred WAN connection service of a device
+// tree
+func findUPnPService(root upnpDevice) (serviceType, controlURL string) {
+	for _, wanted := range upnpServices {
+		devices := []upnpDevice{root}
+		for len(devices) > 0 {
+			device := devices[0]
+			devices = append(devices[1:], device.Devices...)
+			for _, service := range device.Services {
+				if service.ServiceType == wanted {
+					return service.ServiceType, service.ControlURL
+				}
+			}
+		}
+	}
+	return "", ""
+}
+
+func (u *upnp) Name() string { return NATUPnP }
+
+func (u *upnp) ExternalIP() (net.IP, error) {
+	values, err := u.call("GetExternalIPAddress", nil)
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(values["NewExternalIPAddress"])
+	if ip == nil {
+		return nil, fmt.Errorf("UPnP: invalid external address %q", values["NewExternalIPAddress"])
+	}
+	return ip, nil
+}
+
+func (u *upnp) AddMapping(internalPort, externalPort int, lifetime time.Duration) (int, error) {
+	args := func(lease time.Duration) [][2]string {
+		return [][2]string{
+			{"NewRemoteHost", ""},
+			{"NewExternalPort", strconv.Itoa(externalPort)},
+			{"NewProtocol", "TCP"},
+			{"NewInternalPort", strconv.Itoa(internalPort)},
+			{"NewInternalClient", u.localIP.String()},
+			{"NewEnabled", "1"},
+			{"NewPortMappingDescription", natDesc},
+			{"NewLeaseDuration", strconv.Itoa(int(lease / time.Second))},
+		}
+	}
+
+	_, err := u.call("AddPortMapping", args(lifetime))
+	var soapErr *upnpError
+	if errors.As(err, &soapErr) && soapErr.Code == upnpErrOnlyPermanentLeases {
+		// Renewing a permanent mapping is harmless, it is only re-added
+		_, err = u.call("AddPortMapping", args(0))
+	}
+	if err != nil {
+		return 0, err
+	}
+	return externalPort, nil
+}
+
+// upnpError is a UPnP error returned by a gateway
+type upnpError struct {
+	Code        string
+	Description string
+}
+
+func (e *upnpError) Error() string {
+	return fmt.Sprintf("UPnP error %s: %s", e.Code, e.Description)
+}
+
+// call invokes a SOAP action of the WAN connection service and returns the
+// values of the response
+func (u *upnp) call(action string, args [][2]string) (map[string]string, error) {
+	var body strings.Builder
+	body.WriteString(`<?xml version="1.0"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">` +
+		`<s:Body><u:` + action + ` xmlns:u="` + u.serviceType + `">`)
+	for _, arg := range args {
+		body.WriteString("<" + arg[0] + ">")
+		xml.EscapeText(&body, []byte(arg[1]))
+		body.WriteString("</" + arg[0] + ">")
+	}
+	body.WriteString(`</u:` + action + `></s:Body></s:Envelope>`)
+
+	req, err := http.NewRequest(http.MethodPost, u.controlURL, strings.NewReader(body.String()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+u.serviceType+"#"+action+`"`)
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("UPnP %s: %v", action, err)
+	}
+	defer resp.Body.Close()
+
+	values, err := soapValues(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("UPnP %s: %v", action, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if code := values["errorCode"]; code != "" {
+			return nil, &upnpError{Code: code, Description: values["errorDescription"]}
+		}
+		return nil, fmt.Errorf("UPnP %s: %s", action, resp.Status)
+	}
+	return values, nil
+}
+
+// soapValues returns the text of the leaf elements of a SOAP response by
+// local name
+func soapValues(r io.Reader) (map[string]string, error) {
+	values := make(map[string]string)
+	dec := xml.NewDecoder(r)
+	var name string
+	var text []byte
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			name, text = t.Name.Local, nil
+		case xml.CharData:
+			text = append(text, t...)
+		case xml.EndElement:
+			if t.Name.Local == name {
+				values[name] = strings.TrimSpace(string(text))
+			}
+			name = ""
+		}
+	}
+}
@@ -19,8 +19,13 @@ const (
 	CmdBlock       = "block"
 	CmdTx          = "tx"
 	CmdAddr        = "addr"
+	CmdGetAddr     = "getaddr"
 	CmdPing        = "ping"
 	CmdPong        = "pong"
+	CmdMempool     = "mempool"
+	CmdDeltaSub    = "deltasub"
+	CmdUTXODelta   = "utxodelta"
+	CmdGzip        = "gzip"
 )
 
 // Inventory types
@@ -34,11 +39,14 @@ type Version struct {
 	Version    int
 	BestHeight int
 	AddrFrom   string
+	Services   uint64 // ServiceNetwork or ServiceNetworkLimited (0 from older peers)
 }
 
 // GetBlocks requests blocks from a peer
+// Older peers ignore FromHeight and announce the whole chain
 type GetBlocks struct {
-	AddrFrom string
+	AddrFrom   string
+	FromHeight int // Lowest main chain height to announce (0 = the whole chain)
 }
 
 // Inv inventory message
@@ -68,8 +76,24 @@ type TxMsg struct {
 }
 
 // Addr peer address message
+// Peers older than AddrTimeProtocolVersion only read AddrList, newer ones
+// get Addresses instead
 type Addr struct {
-	AddrList []string
+	AddrList  []string
+	AddrFrom  string
+	Addresses []NetAddress
+}
+
+// NetAddress is a gossiped peer address
+type NetAddress struct {
+	Addr     string
+	LastSeen int64  // Unix time the peer was last seen alive
+	Services uint64 // Services the peer offers
+}
+
+// GetAddr asks a peer for the addresses it knows
+type GetAddr struct {
+	AddrFrom string
 }
 
 // Ping message
@@ -0,0 +1,163 @@
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// SOCKS5 proxy
+//
+// With a proxy every outbound P2P connection goes through it (RFC 1928): host
+// names are handed to the proxy unresolved, so a Tor proxy resolves them and
+// reaches .onion addresses, and no DNS lookup leaves the node. The node then
+// does not gossip its own address, and the address book groups peers by host
+// name instead of resolving them. Peers answer a message on a new connection to
+// the address the sender identifies as, so a proxied node must still be
+// reachable there: behind Tor, through an onion service set as NODE_ADDR.
+
+// proxyDialTimeout bounds a connection through the proxy, handshake included;
+// Tor circuits take a few seconds to build
+const proxyDialTimeout = 30 * time.Second
+
+// SOCKS5 protocol values
+const (
+	socksVersion = 0x05
+	socksNoAuth  = 0x00
+	socksConnect = 0x01
+	socksIPv4    = 0x01
+	socksDomain  = 0x03
+	socksIPv6    = 0x04
+)
+
+// socksReplies are the SOCKS5 reply codes
+var socksReplies = map[byte]string{
+	0x01: "general SOCKS server failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+// ValidateProxy checks a -proxy address
+func ValidateProxy(proxy string) error {
+	if proxy == "" {
+		return nil
+	}
+	host, port, err := net.SplitHostPort(proxy)
+	if err != nil || host == "" || port == "" {
+		return fmt.Errorf("invalid proxy address %q (HOST:PORT)", proxy)
+	}
+	return nil
+}
+
+// dial connects to a peer, through the proxy when there is one; timeout 0
+// waits as long as the system does on a direct connection
+func (s *Server) dial(addr string, timeout time.Duration) (net.Conn, error) {
+	if s.Proxy == "" {
+		return net.DialTimeout(protocol, addr, timeout)
+	}
+	if timeout == 0 {
+		timeout = proxyDialTimeout
+	}
+	return dialSOCKS5(s.Proxy, addr, timeout)
+}
+
+// dialSOCKS5 connects to addr through a SOCKS5 proxy without authentication
+func dialSOCKS5(proxy, addr string, timeout time.Duration) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port in %q", addr)
+	}
+
+	request := []byte{socksVersion, socksConnect, 0x00}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return nil, fmt.Errorf("host name %q too long for SOCKS5", host)
+		}
+		request = append(request, socksDomain, byte(len(host)))
+		request = append(request, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		request = append(request, socksIPv4)
+		request = append(request, ip4...)
+	} else {
+		request = append(request, socksIPv6)
+		request = append(request, ip.To16()...)
+	}
+	request = binary.BigEndian.AppendUint16(request, uint16(port))
+
+	conn, err := net.DialTimeout("tcp", proxy, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("proxy %s: %w", proxy, err)
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if err := socksHandshake(conn, request); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %w", proxy, err)
+	}
+
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// socksHandshake negotiates no authentication and sends a CONNECT request
+func socksHandshake(conn net.Conn, request []byte) error {
+	if _, err := conn.Write([]byte{socksVersion, 1, socksNoAuth}); err != nil {
+		return err
+	}
+	method := make([]byte, 2)
+	if _, err := io.ReadFull(conn, method); err != nil {
+		return err
+	}
+	if method[0] != socksVersion {
+		return fmt.Errorf("not a SOCKS5 proxy")
+	}
+	if method[1] != socksNoAuth {
+		return fmt.Errorf("the proxy requires authentication")
+	}
+
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	// VER REP RSV ATYP, then the bound address, which is of no use here
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[1] != 0x00 {
+		if reason, ok := socksReplies[reply[1]]; ok {
+			return fmt.Errorf("%s", reason)
+		}
+		return fmt.Errorf("SOCKS5 error %d", reply[1])
+	}
+
+	var skip int
+	switch reply[3] {
+	case socksIPv4:
+		skip = net.IPv4len
+	case socksIPv6:
+		skip = net.IPv6len
+	case socksDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return err
+		}
+		skip = int(length[0])
+	default:
+		return fmt.Errorf("unknown SOCKS5 address type %d", reply[3])
+	}
+	_, err := io.ReadFull(conn, make([]byte, skip+2)) // Address and port
+	return err
+}
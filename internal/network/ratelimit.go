@@ -0,0 +1,186 @@
+package network
+
+import (
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// Connection and message limits
+//
+// Every message arrives on its own connection. A remote IP may keep at most
+// MaxConnsPerIP of them open at once, further connections are closed before
+// anything is read. A message is read for at most messageReadTimeout and may
+// not exceed MaxMessageSize bytes, compressed or not; an oversized message
+// counts as malformed. Each IP may send MessageRate messages per second on
+// average, in bursts of up to messageBurst seconds' worth, and the messages
+// over that are dropped unhandled. The budget is the connection's IP, not the
+// address a message claims, which a flooder could rotate or borrow. Syncing
+// peers send well below the default rate, which only stops floods.
+
+// Limit defaults
+const (
+	DefaultMaxConnsPerIP  = 16
+	DefaultMaxMessageSize = 8 << 20 // Bytes, about the inventory of a 250000 block chain
+	DefaultMessageRate    = 200     // Messages per second per IP
+
+	messageBurst       = 5 // Seconds of messages an IP may send at once
+	messageReadTimeout = time.Minute
+	rateLimitIdle      = 10 * time.Minute // Idle IPs are forgotten
+	rateLimitLogEvery  = time.Minute      // Drops are logged at most this often per IP
+)
+
+// tokenBucket allows rate events per second on average, up to burst at once
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// RateLimiter limits the open connections and the messages per IP
+type RateLimiter struct {
+	conns   map[string]int // Open connections per remote IP
+	buckets map[string]*tokenBucket
+	logged  map[string]time.Time // Last drop logged per IP
+	pruned  time.Time
+
+	MaxConnsPerIP int     // 0 = unlimited
+	MessageRate   float64 // Messages per second per IP, 0 = unlimited
+
+	mu sync.Mutex
+}
+
+// NewRateLimiter creates a limiter with the default limits
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		conns:         make(map[string]int),
+		buckets:       make(map[string]*tokenBucket),
+		logged:        make(map[string]time.Time),
+		pruned:        time.Now(),
+		MaxConnsPerIP: DefaultMaxConnsPerIP,
+		MessageRate:   DefaultMessageRate,
+	}
+}
+
+// OpenConn reserves a connection slot for an IP, false when it has too many
+// open; a reserved slot is released with CloseConn
+func (l *RateLimiter) OpenConn(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.MaxConnsPerIP > 0 && l.conns[ip] >= l.MaxConnsPerIP {
+		return false
+	}
+	l.conns[ip]++
+	return true
+}
+
+// CloseConn releases a connection slot of an IP
+func (l *RateLimiter) CloseConn(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conns[ip] <= 1 {
+		delete(l.conns, ip)
+		return
+	}
+	l.conns[ip]--
+}
+
+// AllowMessage takes a message from the budget of an IP, false when the IP
+// is over its rate
+func (l *RateLimiter) AllowMessage(ip string) bool {
+	if l.MessageRate <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.prune(now)
+
+	burst := l.MessageRate * messageBurst
+	bucket, ok := l.buckets[ip]
+	if !ok {
+		bucket = &tokenBucket{tokens: burst, updated: now}
+		l.buckets[ip] = bucket
+	}
+
+	bucket.tokens += now.Sub(bucket.updated).Seconds() * l.MessageRate
+	if bucket.tokens > burst {
+		bucket.tokens = burst
+	}
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// prune forgets the IPs idle for rateLimitIdle; the caller must hold l.mu
+func (l *RateLimiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < rateLimitIdle {
+		return
+	}
+	l.pruned = now
+
+	for ip, bucket := range l.buckets {
+		if now.Sub(bucket.updated) >= rateLimitIdle {
+			delete(l.buckets, ip)
+		}
+	}
+	for key, logged := range l.logged {
+		if now.Sub(logged) >= rateLimitIdle {
+			delete(l.logged, key)
+		}
+	}
+}
+
+// shouldLog reports whether a drop for key is to be logged, at most once per
+// rateLimitLogEvery
+func (l *RateLimiter) shouldLog(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.logged[key]) < rateLimitLogEvery {
+		return false
+	}
+	l.logged[key] = now
+	return true
+}
+
+// remoteIP returns the IP of the remote end of a connection
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
+
+// acceptConn handles an accepted connection unless its IP is not allowed by
+// the peer policy or has too many open
+func (s *Server) acceptConn(conn net.Conn) {
+	ip := remoteIP(conn)
+	if !s.Policy.AllowIP(net.ParseIP(ip)) {
+		if s.Limits.shouldLog("deny " + ip) {
+			log.Printf("🚫 Connection from %s not allowed by the peer policy, closing it", ip)
+		}
+		conn.Close()
+		return
+	}
+	if !s.Limits.OpenConn(ip) {
+		if s.Limits.shouldLog("conn " + ip) {
+			log.Printf("🚦 Too many connections from %s (%d), closing new ones", ip, s.Limits.MaxConnsPerIP)
+		}
+		conn.Close()
+		return
+	}
+	defer s.Limits.CloseConn(ip)
+
+	s.handleConnection(conn)
+}
@@ -0,0 +1,324 @@
+package network
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// recordingFormat is the version of the recording file format
+const recordingFormat = 1
+
+// RecordingHeader starts a recording: the node and the chain it had when the
+// recording started, so the messages can be replayed into a fresh node
+type RecordingHeader struct {
+	Format  int
+	Network string
+	Node    string   // Address the node identified as
+	Started int64    // Unix nanoseconds
+	Blocks  [][]byte // Serialized blocks from the genesis to the tip, oldest first
+}
+
+// RecordedMessage is a P2P message as the node handled it
+// Local messages are the blocks the node mined and the transactions submitted
+// through its API, which change its state like messages from peers do
+type RecordedMessage struct {
+	Time  int64  // Unix nanoseconds of arrival
+	From  string // Remote address of the connection ("" for local messages)
+	Local bool
+	Data  []byte // Command and payload, as received
+}
+
+// MessageRecorder appends every message handled by the node to a file
+// Messages are written as they arrive, so a recording survives a crash
+type MessageRecorder struct {
+	path string
+	file *os.File
+	enc  *gob.Encoder
+	mu   sync.Mutex
+}
+
+// EnableRecording starts recording the messages handled by the node to path,
+// after the chain it has now
+func (s *Server) EnableRecording(path string) error {
+	header := RecordingHeader{
+		Format:  recordingFormat,
+		Network: blockchain.GetNetwork(),
+		Node:    s.identity(),
+		Started: time.Now().UnixNano(),
+	}
+
+	if pruned := s.Blockchain.PrunedHeight(); pruned >= 0 {
+		return fmt.Errorf("recording needs the full chain, blocks up to height %d are pruned", pruned)
+	}
+
+	s.Blockchain.RLockState()
+	iter := s.Blockchain.Iterator()
+	for {
+		block := iter.Next()
+		header.Blocks = append(header.Blocks, block.Serialize())
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+	s.Blockchain.RUnlockState()
+	for i, j := 0, len(header.Blocks)-1; i < j; i, j = i+1, j-1 {
+		header.Blocks[i], header.Blocks[j] = header.Blocks[j], header.Blocks[i]
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	enc := gob.NewEncoder(file)
+	if err := enc.Encode(header); err != nil {
+		file.Close()
+		return err
+	}
+
+	s.Recorder = &MessageRecorder{path: path, file: file, enc: enc}
+	log.Printf("⏺️  Recording P2P messages to %s (starting at height %d)", path, len(header.Blocks)-1)
+
+	return nil
+}
+
+// record appends a message to the recording
+func (r *MessageRecorder) record(from string, local bool, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.enc == nil {
+		return
+	}
+	msg := RecordedMessage{Time: time.Now().UnixNano(), From: from, Local: local, Data: data}
+	if err := r.enc.Encode(msg); err != nil {
+		log.Printf("⚠️  Recording to %s stopped: %v", r.path, err)
+		r.file.Close()
+		r.enc = nil
+	}
+}
+
+// Close stops the recording
+func (r *MessageRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.enc == nil {
+		return nil
+	}
+	r.enc = nil
+	return r.file.Close()
+}
+
+// recordLocal records a message originating from the node itself
+func (s *Server) recordLocal(command string, payload interface{}) {
+	if s.Recorder != nil {
+		s.Recorder.record("", true, append(CmdToBytes(command), GobEncode(payload)...))
+	}
+}
+
+// Recording is an open recording file
+type Recording struct {
+	Header RecordingHeader
+
+	file *os.File
+	dec  *gob.Decoder
+}
+
+// OpenRecording opens a recording and reads its header
+func OpenRecording(path string) (*Recording, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &Recording{file: file, dec: gob.NewDecoder(file)}
+	if err := rec.dec.Decode(&rec.Header); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("not a recording: %v", err)
+	}
+	if rec.Header.Format != recordingFormat {
+		file.Close()
+		return nil, fmt.Errorf("unsupported recording format %d", rec.Header.Format)
+	}
+	if len(rec.Header.Blocks) == 0 {
+		file.Close()
+		return nil, fmt.Errorf("recording has no genesis block")
+	}
+
+	return rec, nil
+}
+
+// Next returns the next message, io.EOF at the end of the recording
+// A message cut off by a crash of the recording node ends the recording
+func (r *Recording) Next() (*RecordedMessage, error) {
+	var msg RecordedMessage
+	if err := r.dec.Decode(&msg); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			log.Printf("⚠️  Recording ends with a truncated message")
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// Close closes the recording file
+func (r *Recording) Close() error {
+	return r.file.Close()
+}
+
+// InitBlockchain creates a fresh chain holding the blocks the recording node
+// had when the recording started
+func (r *Recording) InitBlockchain() (*blockchain.Blockchain, error) {
+	if network := blockchain.GetNetwork(); network != r.Header.Network {
+		return nil, fmt.Errorf("recording was made on %s, this node runs on %s (set BLOCKCHAIN_NETWORK)", r.Header.Network, network)
+	}
+
+	genesis, err := blockchain.DecodeBlock(r.Header.Blocks[0])
+	if err != nil {
+		return nil, err
+	}
+	chain, err := blockchain.InitBlockchainWithGenesis(genesis)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, data := range r.Header.Blocks[1:] {
+		block, err := blockchain.DecodeBlock(data)
+		if err == nil {
+			err = chain.ConnectBlock(block)
+		}
+		if err != nil {
+			chain.Database.Close()
+			return nil, fmt.Errorf("recorded chain: %v", err)
+		}
+	}
+
+	return chain, nil
+}
+
+// ReplayResult summarizes a replay
+type ReplayResult struct {
+	Messages    int
+	Commands    map[string]int
+	StartHeight int
+	Height      int
+	Tip         string
+	MempoolTxs  int
+}
+
+// Replay handles the messages of a recording one at a time, in their recorded
+// order, as if they had just arrived
+// The node sends nothing while replaying: the answers of its peers are part of
+// the recording. With realtime the recorded delays between messages are kept
+func (s *Server) Replay(rec *Recording, realtime bool) (ReplayResult, error) {
+	s.replaying = true
+	s.nodeAddress = rec.Header.Node
+
+	result := ReplayResult{Commands: make(map[string]int), StartHeight: s.getBestHeight()}
+	log.Printf("▶️  Replaying messages recorded by %s from height %d", rec.Header.Node, result.StartHeight)
+
+	var last int64
+	for {
+		msg, err := rec.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, err
+		}
+
+		if realtime && last != 0 && msg.Time > last {
+			time.Sleep(time.Duration(msg.Time - last))
+		}
+		last = msg.Time
+
+		if len(msg.Data) < commandLength {
+			continue
+		}
+		command := BytesToCmd(msg.Data[:commandLength])
+		result.Messages++
+		result.Commands[command]++
+
+		if msg.Local {
+			s.replayLocal(command, msg.Data)
+			continue
+		}
+
+		log.Printf("Received %s command", command)
+		conn := replayConn{remote: replayAddr(msg.From)}
+		s.PeerStats.RecordReceived(messageSender(msg.Data, conn), command, len(msg.Data))
+		s.handleMessage(command, msg.Data, conn)
+	}
+
+	result.Height = s.getBestHeight()
+	result.Tip = fmt.Sprintf("%x", s.Blockchain.LastHash)
+	s.mempoolMux.RLock()
+	result.MempoolTxs = len(s.memoryPool)
+	s.mempoolMux.RUnlock()
+
+	return result, nil
+}
+
+// replayLocal applies a block mined or a transaction submitted by the recording node
+func (s *Server) replayLocal(command string, data []byte) {
+	switch command {
+	case CmdBlock:
+		var payload BlockMsg
+		if err := gob.NewDecoder(bytes.NewReader(data[commandLength:])).Decode(&payload); err != nil {
+			log.Printf("Error decoding local block: %v", err)
+			return
+		}
+		block, err := blockchain.DecodeBlock(payload.Block)
+		if err != nil {
+			log.Printf("Error decoding local block: %v", err)
+			return
+		}
+		log.Printf("⛏️  Local block %d", block.Height)
+		if err := s.addBlock(block); err != nil {
+			log.Printf("❌ Local block %d not connected: %v", block.Height, err)
+		}
+
+	case CmdTx:
+		var payload TxMsg
+		if err := gob.NewDecoder(bytes.NewReader(data[commandLength:])).Decode(&payload); err != nil {
+			log.Printf("Error decoding local tx: %v", err)
+			return
+		}
+		tx, err := blockchain.DecodeTransaction(payload.Transaction)
+		if err != nil {
+			log.Printf("Error decoding local tx: %v", err)
+			return
+		}
+		log.Printf("📥 Local transaction %x", tx.ID)
+		s.AddToMempool(tx)
+	}
+}
+
+// replayConn stands for the connection a recorded message arrived on
+// Anything written to it is dropped
+type replayConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c replayConn) Read(b []byte) (int, error)  { return 0, io.EOF }
+func (c replayConn) Write(b []byte) (int, error) { return len(b), nil }
+func (c replayConn) Close() error                { return nil }
+func (c replayConn) RemoteAddr() net.Addr        { return c.remote }
+
+// replayAddr is the recorded remote address of a connection
+type replayAddr string
+
+func (a replayAddr) Network() string { return protocol }
+func (a replayAddr) String() string  { return string(a) }
@@ -0,0 +1,253 @@
+package network
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/marcocsrachid/blockchain-go/internal/api"
+)
+
+// Replica defaults
+const (
+	DefaultReplicaSyncInterval = 10 * time.Second
+	replicaPingTimeout         = 5 * time.Second
+)
+
+// GetMempool asks a peer to send every transaction of its mempool
+type GetMempool struct {
+	AddrFrom string
+}
+
+// ReplicaState is the hot standby state of a node following a primary
+// While in standby the node only syncs blocks and mempool from the primary
+// and refuses wallet and mining duties; once promoted it acts as a regular node
+type ReplicaState struct {
+	Primary       string
+	FailoverAfter time.Duration // Promote automatically after the primary is down this long (0 = manual only)
+
+	promoted       bool
+	promotedAt     time.Time
+	lastContact    time.Time
+	minerAddress   string        // Mining deferred until promotion
+	rotateInterval time.Duration // Outbound rotation restored on promotion
+
+	mu sync.Mutex
+}
+
+// EnableReplica makes the node a hot standby of primary
+// Must be called before Start
+func (s *Server) EnableReplica(primary string, failoverAfter time.Duration) {
+	s.Replica = &ReplicaState{
+		Primary:        primary,
+		FailoverAfter:  failoverAfter,
+		lastContact:    time.Now(),
+		rotateInterval: s.RotationInterval,
+	}
+
+	// Follow only the primary until promoted
+	s.setKnownNodes([]string{primary})
+	s.RotationInterval = 0
+
+	log.Printf("🪞 Replica mode: following primary %s (automatic failover: %s)", primary, formatFailover(failoverAfter))
+}
+
+func formatFailover(after time.Duration) string {
+	if after <= 0 {
+		return "disabled"
+	}
+	return "after " + after.String()
+}
+
+// Standby reports whether the node is a replica that has not been promoted
+func (s *Server) Standby() bool {
+	if s.Replica == nil {
+		return false
+	}
+
+	s.Replica.mu.Lock()
+	defer s.Replica.mu.Unlock()
+
+	return !s.Replica.promoted
+}
+
+// deferMining remembers the mining address of a standby node; it reports
+// whether mining was deferred
+func (s *Server) deferMining(address string) bool {
+	if !s.Standby() {
+		return false
+	}
+
+	s.Replica.mu.Lock()
+	s.Replica.minerAddress = address
+	s.Replica.mu.Unlock()
+
+	log.Printf("🪞 Replica in standby: mining to %s starts on promotion", address)
+	return true
+}
+
+// Promote turns a standby replica into a regular node: it starts serving
+// wallet and mining duties and connects to the rest of the network
+func (s *Server) Promote(reason string) error {
+	if s.Replica == nil {
+		return fmt.Errorf("node is not a replica")
+	}
+
+	s.Replica.mu.Lock()
+	if s.Replica.promoted {
+		s.Replica.mu.Unlock()
+		return fmt.Errorf("replica is already promoted")
+	}
+	s.Replica.promoted = true
+	s.Replica.promotedAt = time.Now()
+	minerAddress := s.Replica.minerAddress
+	rotateInterval := s.Replica.rotateInterval
+	s.Replica.mu.Unlock()
+
+	log.Printf("🪞 Replica promoted (%s), taking over from %s", reason, s.Replica.Primary)
+
+	if rotateInterval > 0 {
+		s.RotationInterval = rotateInterval
+		go s.rotationLoop()
+	}
+	for _, addr := range s.fillOutbound() {
+		go s.sendVersion(addr)
+	}
+
+	if minerAddress != "" {
+		s.StartMining(minerAddress)
+	}
+
+	return nil
+}
+
+// ReplicaInfo returns the replica status (nil if the node is not a replica)
+func (s *Server) ReplicaInfo() *api.ReplicaResponse {
+	if s.Replica == nil {
+		return nil
+	}
+
+	s.Replica.mu.Lock()
+	defer s.Replica.mu.Unlock()
+
+	info := &api.ReplicaResponse{
+		Primary:         s.Replica.Primary,
+		Promoted:        s.Replica.promoted,
+		LastContact:     s.Replica.lastContact.Unix(),
+		FailoverSeconds: int(s.Replica.FailoverAfter / time.Second),
+		Height:          s.getBestHeight(),
+		DeltaSync:       s.DeltaFeed != nil,
+		DeltasApplied:   s.DeltaFeed.DeltasApplied(),
+	}
+	if s.Replica.promoted {
+		info.PromotedAt = s.Replica.promotedAt.Unix()
+	}
+
+	return info
+}
+
+// replicaLoop follows the primary until the replica is promoted
+func (s *Server) replicaLoop() {
+	ticker := time.NewTicker(DefaultReplicaSyncInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !s.Standby() {
+			return
+		}
+
+		primary := s.Replica.Primary
+		if err := s.pingPeer(primary); err != nil {
+			s.Replica.mu.Lock()
+			down := time.Since(s.Replica.lastContact)
+			failover := s.Replica.FailoverAfter > 0 && down >= s.Replica.FailoverAfter
+			s.Replica.mu.Unlock()
+
+			log.Printf("🪞 Primary %s unreachable for %s: %v", primary, down.Round(time.Second), err)
+			if failover {
+				if err := s.Promote(fmt.Sprintf("primary down for %s", down.Round(time.Second))); err != nil {
+					log.Printf("⚠️  Failover failed: %v", err)
+				}
+				return
+			}
+			continue
+		}
+
+		s.Replica.mu.Lock()
+		s.Replica.lastContact = time.Now()
+		s.Replica.mu.Unlock()
+
+		// Version triggers block sync when the primary is ahead
+		s.sendVersion(primary)
+		s.sendGetMempool(primary)
+		if s.DeltaFeed != nil {
+			s.sendDeltaSubscribe(primary)
+		}
+	}
+}
+
+// pingPeer checks that a peer answers a ping with a pong
+func (s *Server) pingPeer(addr string) error {
+	conn, err := s.dial(addr, replicaPingTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(replicaPingTimeout))
+
+	if _, err := conn.Write(withMagic(append(CmdToBytes(CmdPing), GobEncode(Ping{})...))); err != nil {
+		return err
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.CloseWrite() // The peer reads the request until EOF
+	}
+
+	response, err := io.ReadAll(conn)
+	if err != nil {
+		return err
+	}
+	response, ok := stripMagic(response)
+	if !ok {
+		return fmt.Errorf("the peer is on another network")
+	}
+	if len(response) < commandLength || BytesToCmd(response[:commandLength]) != CmdPong {
+		return fmt.Errorf("no pong received")
+	}
+
+	return nil
+}
+
+// sendGetMempool asks a peer for its mempool transactions
+func (s *Server) sendGetMempool(addr string) {
+	payload := GobEncode(GetMempool{AddrFrom: s.nodeAddress})
+	request := append(CmdToBytes(CmdMempool), payload...)
+	s.sendData(addr, request)
+}
+
+// handleGetMempool sends every mempool transaction to the requesting peer
+func (s *Server) handleGetMempool(request []byte) {
+	var payload GetMempool
+
+	dec := gob.NewDecoder(bytes.NewReader(request[commandLength:]))
+	if err := dec.Decode(&payload); err != nil {
+		log.Printf("Error decoding mempool request: %v", err)
+		return
+	}
+
+	s.mempoolMux.RLock()
+	txs := make([][]byte, 0, len(s.memoryPool))
+	for _, tx := range s.memoryPool {
+		txs = append(txs, tx.ID)
+	}
+	s.mempoolMux.RUnlock()
+
+	// One inv per transaction, peers request the ones they miss
+	for _, txID := range txs {
+		s.sendInv(payload.AddrFrom, InvTypeTx, [][]byte{txID})
+	}
+}
@@ -5,11 +5,13 @@ import (
 	"crypto/sha256"
 	"encoding/gob"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"os"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -20,23 +22,19 @@ import (
 
 const (
 	protocol      = "tcp"
-	version       = 1
+	version       = blockchain.ProtocolVersion
 	commandLength = 12
 	// Target block time for difficulty adjustment (not used as a timer!)
 	targetBlockTime = 60 * time.Second // 1 minute target (Bitcoin = 10 min)
 )
 
-var (
-	nodeAddress     string
-	miningAddress   string
-	knownNodes      = initKnownNodes()
-	blocksInTransit = [][]byte{}
-	memoryPool      = make(map[string]*blockchain.Transaction)
-	mempoolMux      sync.RWMutex
-)
+// errInvalidBlock marks blocks rejected by validation (as opposed to stale or out-of-order blocks)
+// It is the chain's own sentinel, so validation errors are not wrapped twice
+var errInvalidBlock = blockchain.ErrInvalidBlock
 
-// initKnownNodes initializes known nodes from environment or default
-func initKnownNodes() []string {
+// SeedNodes returns the seed nodes: SEED_NODE from the environment, or the
+// default seed
+func SeedNodes() []string {
 	if seedNode := os.Getenv("SEED_NODE"); seedNode != "" {
 		return []string{seedNode}
 	}
@@ -51,12 +49,84 @@ type Server struct {
 	IsMining        bool
 	stopMining      chan bool
 	miningInterrupt chan bool
+	Mining          *MiningStats
+	miningMux       sync.Mutex // Guards the mining state and miningAddress
+	miningCtl       sync.Mutex // Serializes starting and stopping the mining loop
 	APIServer       *api.Server
 	Wallets         *blockchain.Wallets
+
+	nodeAddress   string // Address this node identifies as to its peers, set by Start
+	miningAddress string // Guarded by miningMux
+
+	seeds         []string              // Dialed first and never forgotten
+	knownNodes    []string              // Address book of the peers
+	knownMux      sync.RWMutex          // Guards knownNodes
+	knownAddrs    map[string]NetAddress // Gossip records of knownNodes
+	knownAddrsMux sync.Mutex
+
+	memoryPool     map[string]*blockchain.Transaction
+	mempoolEntries map[string]mempoolEntry        // Fee and memory bookkeeping of memoryPool
+	mempoolBytes   int64                          // Serialized size of memoryPool
+	mempoolSpends  map[blockchain.Outpoint]string // Outputs spent by memoryPool -> spending txid
+	mempoolMux     sync.RWMutex
+
+	// Outbound peer selection (eclipse-attack mitigation)
+	Outbound         *OutboundSet
+	MaxOutbound      int
+	MaxInbound       int           // Inbound peers relayed to, 0 = unlimited
+	MaxKnownNodes    int           // Size of the address book, 0 = unlimited
+	RotationInterval time.Duration // 0 disables rotation
+	RotationFraction float64
+
+	Limits         *RateLimiter // Connections per IP and messages per peer
+	MaxMessageSize int          // Bytes, 0 = unlimited
+
+	Policy *PeerPolicy // Pinned peers, connect-only mode and denied IPs
+
+	CoinbaseMessage string // Embedded in the coinbase of the blocks we mine (e.g. a pool name)
+
+	templates     *templateNotifier // Wakes up long-polling block template requests
+	templateCache *templateCache    // Templates handed out, for header submissions
+
+	orphans *orphanPool // Blocks waiting for their parent
+
+	requests  *requestTracker // Announced blocks and transactions being fetched
+	inventory *inventoryCache // Blocks and transactions seen recently and known by each peer
+
+	PeerStats *PeerStatsTable // Per-peer protocol statistics, persisted in the data dir
+
+	Memory *MemoryAccountant // Memory accounting of the mempool and caches against a global limit
+
+	MaxMempool int64 // Serialized bytes of pending transactions, 0 = unlimited
+
+	Blacklist *MinerBlacklist // Local policy: txids/addresses never included in our blocks
+
+	Backoff *DialBackoff // Reconnection backoff of peers that failed to dial
+
+	Bans *BanList // Misbehavior scores and banned peers, bans persisted in the data dir
+
+	Replica *ReplicaState // Hot standby state (nil = regular node)
+
+	DeltaFeed *DeltaFeed // UTXO delta stream between trusted nodes (nil = disabled)
+
+	fees *feeEstimator // Fill and fee rates of recent blocks
+
+	Tip *TipMonitor // Stale tip detection
+
+	NAT        string     // Port mapping method (see NATMethods), "" = disabled
+	portMapper portMapper // Gateway forwarding the P2P port, nil when none
+
+	Proxy string // SOCKS5 proxy HOST:PORT of the outbound connections, "" = direct
+
+	DiscoverLAN bool // Announce and discover nodes on the local network by multicast
+
+	Recorder  *MessageRecorder // Records the handled messages for replay (nil = disabled)
+	replaying bool             // Replaying a recording: nothing is sent to peers
 }
 
-// NewServer creates a new network server
-func NewServer(address string, bc *blockchain.Blockchain, wallets *blockchain.Wallets) *Server {
+// NewServer creates a new network server listening on address, which knows
+// the seed nodes to start with
+func NewServer(address string, seeds []string, bc *blockchain.Blockchain, wallets *blockchain.Wallets) *Server {
 	// Extract port from address for API
 	parts := strings.Split(address, ":")
 	apiPort := "8080" // Default API port
@@ -87,10 +157,54 @@ func NewServer(address string, bc *blockchain.Blockchain, wallets *blockchain.Wa
 		IsMining:        false,
 		stopMining:      make(chan bool),
 		miningInterrupt: make(chan bool, 10), // Buffered to not block
+		Mining:          NewMiningStats(),
 		APIServer:       apiServer,
 		Wallets:         wallets,
+
+		seeds:      seeds,
+		knownNodes: slices.Clone(seeds),
+		knownAddrs: make(map[string]NetAddress),
+
+		memoryPool:     make(map[string]*blockchain.Transaction),
+		mempoolEntries: make(map[string]mempoolEntry),
+		mempoolSpends:  make(map[blockchain.Outpoint]string),
+
+		Outbound:         NewOutboundSet(),
+		MaxOutbound:      DefaultMaxOutbound,
+		MaxInbound:       DefaultMaxInbound,
+		MaxKnownNodes:    DefaultMaxKnownNodes,
+		RotationInterval: DefaultRotationInterval,
+		RotationFraction: DefaultRotationFraction,
+
+		Limits:         NewRateLimiter(),
+		MaxMessageSize: DefaultMaxMessageSize,
+
+		Policy: &PeerPolicy{},
+
+		templates:     newTemplateNotifier(),
+		templateCache: newTemplateCache(),
+
+		PeerStats: LoadPeerStats(getPeerStatsFile()),
+
+		Memory: NewMemoryAccountant(DefaultMaxMemory),
+
+		MaxMempool: DefaultMaxMempool,
+
+		Blacklist: LoadMinerBlacklist(getMinerBlacklistFile()),
+
+		Backoff: NewDialBackoff(),
+
+		Bans: LoadBanList(getBanListFile()),
+
+		fees: newFeeEstimator(),
+
+		Tip: NewTipMonitor(),
 	}
 
+	server.orphans = newOrphanPool(server.Memory)
+	server.requests = newRequestTracker()
+	server.inventory = newInventoryCache()
+
 	// Set network server reference in API for broadcasting transactions
 	apiServer.SetNetworkServer(server)
 
@@ -99,13 +213,20 @@ func NewServer(address string, bc *blockchain.Blockchain, wallets *blockchain.Wa
 
 // Start starts the network server
 func (s *Server) Start() error {
-	// Use environment variable NODE_ADDR for P2P identification (Docker)
-	// Fall back to s.Address for standalone mode
-	if envAddr := os.Getenv("NODE_ADDR"); envAddr != "" {
-		nodeAddress = envAddr
-		log.Printf("Using P2P address from env: %s", nodeAddress)
-	} else {
-		nodeAddress = s.Address
+	s.nodeAddress = s.identity()
+	if os.Getenv("NODE_ADDR") != "" {
+		log.Printf("Using P2P address from env: %s", s.nodeAddress)
+	}
+	// Before the API starts, nodeAddress does not change afterwards
+	if s.NAT != "" {
+		s.mapPort()
+	}
+	if s.Proxy != "" {
+		s.Policy.noResolve = true
+		log.Printf("🧅 Outbound connections go through the SOCKS5 proxy %s, our address is not advertised", s.Proxy)
+	}
+	if s.DiscoverLAN {
+		s.useLANAddress()
 	}
 
 	// Start API server in background
@@ -123,14 +244,47 @@ func (s *Server) Start() error {
 	defer ln.Close()
 
 	log.Printf("Node server started on %s", s.Address)
-	log.Printf("Node identifies as: %s", nodeAddress)
+	log.Printf("Node identifies as: %s", s.nodeAddress)
+
+	// Pinned and known before the restart, a standby replica only knows its primary
+	if !s.Standby() {
+		s.applyPeerPolicy()
+		if loaded := s.loadKnownPeers(getKnownPeersFile()); loaded > 0 {
+			log.Printf("🌐 Loaded %d known peers", loaded)
+		}
+	}
 
 	// Connect to seed nodes if not seed
-	seedNode := knownNodes[0]
-	if nodeAddress != seedNode {
+	seedNode := s.KnownNodes()[0]
+	if s.nodeAddress != seedNode && s.Policy.AllowAddr(seedNode) {
 		log.Printf("Connecting to seed node: %s", seedNode)
+		s.Outbound.add(seedNode)
 		s.sendVersion(seedNode)
 	}
+	if !s.Standby() {
+		for _, addr := range s.fillOutbound() {
+			go s.sendVersion(addr)
+		}
+	}
+
+	// Periodically rotate outbound peers across network groups
+	if s.RotationInterval > 0 {
+		go s.rotationLoop()
+	}
+
+	go s.dialLoop()
+	go s.requestLoop()
+	go s.addrLoop()
+	go s.peerStatsLoop()
+	go s.miningStatsLoop()
+	go s.staleTipLoop()
+
+	if s.Replica != nil {
+		go s.replicaLoop()
+	}
+	if s.DiscoverLAN {
+		go s.lanDiscoveryLoop()
+	}
 
 	for {
 		conn, err := ln.Accept()
@@ -139,15 +293,48 @@ func (s *Server) Start() error {
 			continue
 		}
 
-		go s.handleConnection(conn)
+		go s.acceptConn(conn)
+	}
+}
+
+// identity returns the address the node identifies as to its peers: the
+// NODE_ADDR environment variable (Docker), or s.Address in standalone mode
+func (s *Server) identity() string {
+	if envAddr := os.Getenv("NODE_ADDR"); envAddr != "" {
+		return envAddr
 	}
+	return s.Address
 }
 
-// StartMining enables mining on this node
+// StartMining enables mining on this node, paying address: a single address or
+// percentage shares ("ADDR1:60,ADDR2:40", see blockchain.ParseRewardSplit)
+// A standby replica defers mining until it is promoted
+// While mining already, only the address of the next blocks changes
 func (s *Server) StartMining(address string) {
+	if s.deferMining(address) {
+		return
+	}
+
+	s.miningCtl.Lock()
+	defer s.miningCtl.Unlock()
+
+	s.miningMux.Lock()
+	mining := s.IsMining
+	s.miningAddress = address
 	s.IsMining = true
-	miningAddress = address
+	s.miningMux.Unlock()
+
+	if mining {
+		log.Printf("Mining rewards now go to %s", address)
+		return
+	}
 	log.Printf("Mining enabled. Rewards will go to %s", address)
+	s.Mining.started()
+
+	// Interrupts signaled while not mining must not abort the first block
+	for len(s.miningInterrupt) > 0 {
+		<-s.miningInterrupt
+	}
 
 	// Start continuous mining loop
 	go s.miningLoop()
@@ -165,9 +352,9 @@ func (s *Server) miningLoop() {
 			return
 		default:
 			// Check if we have transactions to mine (or just mine empty block with coinbase)
-			mempoolMux.RLock()
-			hasTxs := len(memoryPool) > 0
-			mempoolMux.RUnlock()
+			s.mempoolMux.RLock()
+			hasTxs := len(s.memoryPool) > 0
+			s.mempoolMux.RUnlock()
 
 			if hasTxs || true { // Always mine (even empty blocks with coinbase)
 				s.mineTransactions()
@@ -181,12 +368,31 @@ func (s *Server) miningLoop() {
 
 // handleConnection handles incoming connections
 func (s *Server) handleConnection(conn net.Conn) {
-	request, err := io.ReadAll(conn)
+	var r io.Reader = conn
+	if s.MaxMessageSize > 0 {
+		r = io.LimitReader(conn, int64(magicLength+s.MaxMessageSize)+1)
+	}
+	conn.SetReadDeadline(time.Now().Add(messageReadTimeout))
+	request, err := io.ReadAll(r)
 	if err != nil {
 		log.Printf("Error reading request: %v", err)
 		conn.Close()
 		return
 	}
+	request, ok := stripMagic(request)
+	if !ok {
+		if ip := remoteIP(conn); s.Limits.shouldLog("magic " + ip) {
+			log.Printf("🪄 Dropped a message from %s: not a %s node", ip, blockchain.Params().Name)
+		}
+		conn.Close()
+		return
+	}
+	if s.MaxMessageSize > 0 && len(request) > s.MaxMessageSize {
+		log.Printf("⚠️  Dropped a message over %d bytes from %s", s.MaxMessageSize, conn.RemoteAddr())
+		s.malformed(request, conn)
+		conn.Close()
+		return
+	}
 
 	// Validate request length
 	if len(request) < commandLength {
@@ -195,9 +401,46 @@ func (s *Server) handleConnection(conn net.Conn) {
 		return
 	}
 
+	wireSize := len(request)
 	command := BytesToCmd(request[:commandLength])
+	if command == CmdGzip {
+		message, err := decompressMessage(request, s.MaxMessageSize)
+		if err != nil {
+			log.Printf("Error decompressing message: %v", err)
+			s.malformed(request, conn)
+			conn.Close()
+			return
+		}
+		request = message
+		command = BytesToCmd(request[:commandLength])
+	}
+	sender, ip := messageSender(request, conn), remoteIP(conn)
+	if s.Bans.Banned(ip) || s.Bans.Banned(sender) {
+		log.Printf("⛔ Dropped %s command from banned peer %s (%s)", command, sender, ip)
+		conn.Close()
+		return
+	}
+	if !s.Limits.AllowMessage(ip) {
+		if s.Limits.shouldLog("msg " + ip) {
+			log.Printf("🚦 %s is over %.0f messages per second, dropping its messages", ip, s.Limits.MessageRate)
+		}
+		s.PeerStats.RecordRateLimited(sender)
+		conn.Close()
+		return
+	}
 	log.Printf("Received %s command", command)
 
+	s.PeerStats.RecordReceived(sender, command, wireSize)
+	if s.Recorder != nil {
+		s.Recorder.record(conn.RemoteAddr().String(), false, request)
+	}
+
+	s.handleMessage(command, request, conn)
+	conn.Close()
+}
+
+// handleMessage dispatches a message to its handler
+func (s *Server) handleMessage(command string, request []byte, conn net.Conn) {
 	switch command {
 	case CmdVersion:
 		s.handleVersion(request, conn)
@@ -213,13 +456,19 @@ func (s *Server) handleConnection(conn net.Conn) {
 		s.handleTx(request, conn)
 	case CmdAddr:
 		s.handleAddr(request, conn)
+	case CmdGetAddr:
+		s.handleGetAddr(request, conn)
 	case CmdPing:
 		s.handlePing(conn)
+	case CmdMempool:
+		s.handleGetMempool(request)
+	case CmdDeltaSub:
+		s.handleDeltaSubscribe(request)
+	case CmdUTXODelta:
+		s.handleUTXODelta(request)
 	default:
 		log.Printf("Unknown command: %s", command)
 	}
-
-	conn.Close()
 }
 
 // sendVersion sends version message to peer
@@ -229,7 +478,8 @@ func (s *Server) sendVersion(addr string) {
 	payload := GobEncode(Version{
 		Version:    version,
 		BestHeight: bestHeight,
-		AddrFrom:   nodeAddress,
+		AddrFrom:   s.nodeAddress,
+		Services:   s.services(),
 	})
 
 	request := append(CmdToBytes(CmdVersion), payload...)
@@ -246,41 +496,51 @@ func (s *Server) handleVersion(request []byte, conn net.Conn) {
 	err := dec.Decode(&payload)
 	if err != nil {
 		log.Printf("Error decoding version: %v", err)
+		s.malformed(request, conn)
 		return
 	}
 
 	bestHeight := s.getBestHeight()
 	otherHeight := payload.BestHeight
 
-	// Add peer
-	s.Peers.Add(payload.AddrFrom, conn)
+	// Add peer, remembering its protocol version
+	_, known := s.Peers.Get(payload.AddrFrom)
+	s.admitInbound(payload.AddrFrom)
+	s.Peers.Add(payload.AddrFrom, conn).UpdateInfo(payload.Version, otherHeight)
 
 	log.Printf("Received version from %s: height %d (ours: %d)",
 		payload.AddrFrom, otherHeight, bestHeight)
 
 	if bestHeight < otherHeight {
 		log.Printf("Peer has longer chain, requesting blocks...")
-		s.sendGetBlocks(payload.AddrFrom)
-	} else if bestHeight > otherHeight {
+		s.sendGetBlocks(payload.AddrFrom, s.syncFromHeight())
+	} else if bestHeight > otherHeight || !known {
+		// New peers also learn our protocol version
 		s.sendVersion(payload.AddrFrom)
 	}
 
-	if !s.nodeIsKnown(payload.AddrFrom) {
-		knownNodes = append(knownNodes, payload.AddrFrom)
-		log.Printf("Added new peer: %s (total peers: %d)", payload.AddrFrom, len(knownNodes))
+	if s.learnNode(payload.AddrFrom) {
+		log.Printf("Added new peer: %s (total peers: %d)", payload.AddrFrom, len(s.KnownNodes()))
 	}
+	s.addrSeen(payload.AddrFrom, payload.Services)
 
-	// Share our peer list with the new node
-	s.sendAddr(payload.AddrFrom)
+	s.shareAddresses(payload.AddrFrom, payload.Version, known)
 }
 
-// sendGetBlocks sends getblocks request
-func (s *Server) sendGetBlocks(addr string) {
-	payload := GobEncode(GetBlocks{AddrFrom: nodeAddress})
+// sendGetBlocks asks a peer for the hashes of its main chain from fromHeight
+func (s *Server) sendGetBlocks(addr string, fromHeight int) {
+	payload := GobEncode(GetBlocks{AddrFrom: s.nodeAddress, FromHeight: fromHeight})
 	request := append(CmdToBytes(CmdGetBlocks), payload...)
 	s.sendData(addr, request)
 }
 
+// syncFromHeight is the lowest height to request when syncing: blocks up to
+// the finalized height are never reorganized, so a peer's branch we could
+// accept forks above it
+func (s *Server) syncFromHeight() int {
+	return s.Blockchain.FinalizedHeight() + 1
+}
+
 // handleGetBlocks handles getblocks request
 func (s *Server) handleGetBlocks(request []byte, conn net.Conn) {
 	var buff bytes.Buffer
@@ -291,17 +551,18 @@ func (s *Server) handleGetBlocks(request []byte, conn net.Conn) {
 	err := dec.Decode(&payload)
 	if err != nil {
 		log.Printf("Error decoding getblocks: %v", err)
+		s.malformed(request, conn)
 		return
 	}
 
-	blocks := s.getBlocks()
+	blocks := s.getBlocks(payload.FromHeight)
 	s.sendInv(payload.AddrFrom, InvTypeBlock, blocks)
 }
 
 // sendInv sends inventory message
 func (s *Server) sendInv(addr, kind string, items [][]byte) {
 	inventory := Inv{
-		AddrFrom: nodeAddress,
+		AddrFrom: s.nodeAddress,
 		Type:     kind,
 		Items:    items,
 	}
@@ -321,39 +582,46 @@ func (s *Server) handleInv(request []byte, conn net.Conn) {
 	err := dec.Decode(&payload)
 	if err != nil {
 		log.Printf("Error decoding inv: %v", err)
+		s.malformed(request, conn)
 		return
 	}
 
 	log.Printf("Received inventory with %d %s", len(payload.Items), payload.Type)
 
-	if payload.Type == InvTypeBlock {
-		blocksInTransit = payload.Items
-
-		blockHash := payload.Items[0]
-		s.sendGetData(payload.AddrFrom, InvTypeBlock, blockHash)
-
-		var newInTransit [][]byte
-		for _, b := range blocksInTransit {
-			if !bytes.Equal(b, blockHash) {
-				newInTransit = append(newInTransit, b)
+	// The peer is not relayed what it announced; items we already have or
+	// saw recently are not fetched again: blocks of the main or a side chain,
+	// transactions of the mempool
+	var missing [][]byte
+	switch payload.Type {
+	case InvTypeBlock:
+		for _, b := range payload.Items {
+			s.inventory.peerHas(payload.AddrFrom, InvTypeBlock, b)
+			if !s.Blockchain.HasBlock(b) && !s.inventory.hasSeen(InvTypeBlock, b) {
+				missing = append(missing, b)
 			}
 		}
-		blocksInTransit = newInTransit
-	}
-
-	if payload.Type == InvTypeTx {
-		txID := payload.Items[0]
-
-		if memoryPool[hex.EncodeToString(txID)].ID == nil {
-			s.sendGetData(payload.AddrFrom, InvTypeTx, txID)
+	case InvTypeTx:
+		s.mempoolMux.RLock()
+		for _, txID := range payload.Items {
+			s.inventory.peerHas(payload.AddrFrom, InvTypeTx, txID)
+			if _, known := s.memoryPool[hex.EncodeToString(txID)]; !known && !s.inventory.hasSeen(InvTypeTx, txID) {
+				missing = append(missing, txID)
+			}
 		}
+		s.mempoolMux.RUnlock()
 	}
+	if len(missing) == 0 {
+		return
+	}
+
+	s.requests.announce(payload.AddrFrom, payload.Type, missing)
+	s.requestItems(payload.AddrFrom)
 }
 
 // sendGetData sends getdata request
 func (s *Server) sendGetData(addr, kind string, id []byte) {
 	payload := GobEncode(GetData{
-		AddrFrom: nodeAddress,
+		AddrFrom: s.nodeAddress,
 		Type:     kind,
 		ID:       id,
 	})
@@ -372,6 +640,7 @@ func (s *Server) handleGetData(request []byte, conn net.Conn) {
 	err := dec.Decode(&payload)
 	if err != nil {
 		log.Printf("Error decoding getdata: %v", err)
+		s.malformed(request, conn)
 		return
 	}
 
@@ -381,13 +650,26 @@ func (s *Server) handleGetData(request []byte, conn net.Conn) {
 			log.Printf("Error getting block: %v", err)
 			return
 		}
+		// Only the header of pruned blocks is left, the peer would reject it
+		if s.Blockchain.IsPruned(block.Height) {
+			log.Printf("✂️  Block %d (%x) requested by %s is pruned", block.Height, block.Hash, payload.AddrFrom)
+			return
+		}
 
 		s.sendBlock(payload.AddrFrom, block)
 	}
 
 	if payload.Type == InvTypeTx {
 		txID := hex.EncodeToString(payload.ID)
-		tx := memoryPool[txID]
+
+		s.mempoolMux.RLock()
+		tx, exists := s.memoryPool[txID]
+		s.mempoolMux.RUnlock()
+
+		// The transaction may have been mined or evicted since it was announced
+		if !exists {
+			return
+		}
 
 		s.sendTx(payload.AddrFrom, tx)
 	}
@@ -395,8 +677,13 @@ func (s *Server) handleGetData(request []byte, conn net.Conn) {
 
 // sendBlock sends block to peer
 func (s *Server) sendBlock(addr string, block *blockchain.Block) {
+	// Older peers drop the block version when decoding and would see an invalid hash
+	if block.Version != 0 && s.Peers.Version(addr) < blockchain.VersionBitsProtocolVersion {
+		return
+	}
+
 	data := BlockMsg{
-		AddrFrom: nodeAddress,
+		AddrFrom: s.nodeAddress,
 		Block:    block.Serialize(),
 	}
 	payload := GobEncode(data)
@@ -405,15 +692,6 @@ func (s *Server) sendBlock(addr string, block *blockchain.Block) {
 	s.sendData(addr, request)
 }
 
-// sendAddr sends known peer addresses to a node
-func (s *Server) sendAddr(addr string) {
-	data := Addr{AddrList: knownNodes}
-	payload := GobEncode(data)
-	request := append(CmdToBytes(CmdAddr), payload...)
-
-	s.sendData(addr, request)
-}
-
 // handleBlock handles block message
 func (s *Server) handleBlock(request []byte, conn net.Conn) {
 	var buff bytes.Buffer
@@ -424,32 +702,59 @@ func (s *Server) handleBlock(request []byte, conn net.Conn) {
 	err := dec.Decode(&payload)
 	if err != nil {
 		log.Printf("Error decoding block: %v", err)
+		s.malformed(request, conn)
 		return
 	}
 
-	blockData := payload.Block
-	block := blockchain.Deserialize(blockData)
+	block, err := blockchain.DecodeBlock(payload.Block)
+	if err != nil {
+		log.Printf("Error decoding block: %v", err)
+		s.malformed(request, conn)
+		return
+	}
 
 	log.Printf("Received a new block height %d", block.Height)
 
 	// Add block to blockchain (validation should be done here)
-	s.addBlock(block)
-
-	if len(blocksInTransit) > 0 {
-		blockHash := blocksInTransit[0]
-		s.sendGetData(payload.AddrFrom, InvTypeBlock, blockHash)
+	s.inventory.peerHas(payload.AddrFrom, InvTypeBlock, block.Hash)
+	err = s.addBlock(block)
+	// Orphans are fetched again when their ancestors are synced
+	if !errors.Is(err, blockchain.ErrOrphanBlock) {
+		s.inventory.markSeen(InvTypeBlock, block.Hash)
+	}
+	if err == nil {
+		s.PeerStats.RecordBlock(payload.AddrFrom, true)
+		s.relayBlock(block, payload.AddrFrom)
+	} else if errors.Is(err, errInvalidBlock) {
+		log.Printf("🚫 Peer %s sent invalid block %d (%x): %v", payload.AddrFrom, block.Height, block.Hash, err)
+		s.PeerStats.RecordBlock(payload.AddrFrom, false)
+		s.misbehaving(conn, PenaltyInvalidBlock, fmt.Sprintf("invalid block %d", block.Height))
+	}
 
-		blocksInTransit = blocksInTransit[1:]
-	} else {
-		UTXOSet := blockchain.UTXOSet{Blockchain: s.Blockchain}
-		UTXOSet.Reindex()
+	s.requests.received(InvTypeBlock, block.Hash)
+	if s.requests.pending(payload.AddrFrom) > 0 {
+		s.requestItems(payload.AddrFrom)
+	} else if errors.Is(err, blockchain.ErrOrphanBlock) {
+		// The peer is on a branch we do not fully have: fetch its missing
+		// blocks, from genesis when they fork below the requested range
+		from := s.syncFromHeight()
+		if block.Height <= from {
+			from = 0
+		}
+		log.Printf("🧩 Requesting the missing ancestors of block %d from %s", block.Height, payload.AddrFrom)
+		s.sendGetBlocks(payload.AddrFrom, from)
 	}
 }
 
 // sendTx sends transaction to peer
 func (s *Server) sendTx(addr string, tx *blockchain.Transaction) {
+	// Older peers drop sequence numbers when decoding and would see an invalid transaction
+	if tx.HasSequences() && s.Peers.Version(addr) < blockchain.SequenceProtocolVersion {
+		return
+	}
+
 	data := TxMsg{
-		AddrFrom:    nodeAddress,
+		AddrFrom:    s.nodeAddress,
 		Transaction: tx.Serialize(),
 	}
 	payload := GobEncode(data)
@@ -468,98 +773,126 @@ func (s *Server) handleTx(request []byte, conn net.Conn) {
 	err := dec.Decode(&payload)
 	if err != nil {
 		log.Printf("Error decoding tx: %v", err)
+		s.malformed(request, conn)
 		return
 	}
 
 	txData := payload.Transaction
-	tx := blockchain.DeserializeTransaction(txData)
-
-	mempoolMux.Lock()
-	memoryPool[hex.EncodeToString(tx.ID)] = &tx
-	mempoolMux.Unlock()
-
-	log.Printf("📥 Received transaction %x (mempool size: %d)", tx.ID, len(memoryPool))
-
-	// Mining happens automatically every 60 seconds via miningLoop
-}
-
-// handleAddr handles addr message
-func (s *Server) handleAddr(request []byte, conn net.Conn) {
-	var buff bytes.Buffer
-	var payload Addr
-
-	buff.Write(request[commandLength:])
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
+	tx, err := blockchain.DecodeTransaction(txData)
 	if err != nil {
-		log.Printf("Error decoding addr: %v", err)
+		log.Printf("Error decoding transaction: %v", err)
+		s.malformed(request, conn)
 		return
 	}
 
-	for _, addr := range payload.AddrList {
-		if !s.nodeIsKnown(addr) && addr != nodeAddress {
-			knownNodes = append(knownNodes, addr)
-			log.Printf("🌐 Discovered new peer: %s (total: %d)", addr, len(knownNodes))
+	s.requests.received(InvTypeTx, tx.ID)
+	s.requestItems(payload.AddrFrom)
+	s.inventory.peerHas(payload.AddrFrom, InvTypeTx, tx.ID)
 
-			// Try to connect to the new peer
-			go func(peerAddr string) {
-				s.sendVersion(peerAddr)
-			}(addr)
+	if err := s.AcceptToMempool(tx); err != nil {
+		log.Printf("❌ Rejected transaction %x from %s: %v", tx.ID, payload.AddrFrom, err)
+		var reject *blockchain.TxRejectError
+		if !errors.As(err, &reject) || (reject.Code != blockchain.RejectAlreadyKnown && reject.Code != blockchain.RejectMempoolFull) {
+			s.PeerStats.RecordTx(payload.AddrFrom, false)
+		}
+		if reject != nil && penalizedReject(reject.Code) {
+			s.misbehaving(conn, PenaltyInvalidTx, "invalid transaction: "+reject.Code)
 		}
+		// Until a block or room in the mempool may make it valid
+		if reject == nil || !retryableReject(reject.Code) {
+			s.inventory.markSeen(InvTypeTx, tx.ID)
+		}
+		return
 	}
+
+	s.inventory.markSeen(InvTypeTx, tx.ID)
+	s.PeerStats.RecordTx(payload.AddrFrom, true)
+	s.relayInventory(InvTypeTx, tx.ID, payload.AddrFrom)
+
+	log.Printf("📥 Received transaction %x (mempool size: %d)", tx.ID, len(s.memoryPool))
+
+	// Mining happens automatically every 60 seconds via miningLoop
 }
 
 // handlePing handles ping message
 func (s *Server) handlePing(conn net.Conn) {
 	payload := GobEncode(Pong{})
 	request := append(CmdToBytes(CmdPong), payload...)
-	conn.Write(request)
+	conn.Write(withMagic(request))
 }
 
-// AddToMempool adds a transaction to the local mempool
-func (s *Server) AddToMempool(tx *blockchain.Transaction) {
-	mempoolMux.Lock()
-	defer mempoolMux.Unlock()
+// AddToMempool adds a transaction created by the node to the local mempool
+// It fails when the transaction double spends a pending one or does not fit
+func (s *Server) AddToMempool(tx *blockchain.Transaction) error {
+	if !s.replaying {
+		s.recordLocal(CmdTx, TxMsg{AddrFrom: s.nodeAddress, Transaction: tx.Serialize()})
+	}
 
-	txID := hex.EncodeToString(tx.ID)
-	memoryPool[txID] = tx
-	log.Printf("📥 Added transaction %x to local mempool (size: %d)", tx.ID, len(memoryPool))
+	fee, err := s.Blockchain.TransactionFee(tx)
+	if err != nil {
+		log.Printf("⚠️  Could not compute fee of transaction %x: %v", tx.ID, err)
+	}
+
+	if err := s.addToMempool(tx, fee); err != nil {
+		log.Printf("⚠️  Transaction %x not kept in mempool: %v", tx.ID, err)
+		return err
+	}
+	return nil
 }
 
-// BroadcastTx broadcasts transaction to all known peers
+// BroadcastTx broadcasts transaction to the connected peers that do not know it
 func (s *Server) BroadcastTx(tx *blockchain.Transaction) {
-	log.Printf("📤 Broadcasting transaction %x to %d peers", tx.ID, len(knownNodes)-1)
-	for _, node := range knownNodes {
-		if node != nodeAddress {
-			s.sendTx(node, tx)
-		}
+	s.inventory.markSeen(InvTypeTx, tx.ID)
+	peers := s.relayPeersWithout(InvTypeTx, tx.ID, "")
+	log.Printf("📤 Broadcasting transaction %x to %d peers", tx.ID, len(peers))
+	for _, node := range peers {
+		s.sendTx(node, tx)
 	}
 }
 
-// BroadcastBlock broadcasts block to all known peers
+// BroadcastBlock broadcasts block to the connected peers that do not know it
 func (s *Server) BroadcastBlock(block *blockchain.Block) {
-	log.Printf("📡 Broadcasting block %d to %d peers", block.Height, len(knownNodes)-1)
-	for _, node := range knownNodes {
-		if node != nodeAddress {
-			log.Printf("   → Sending to %s", node)
-			s.sendInv(node, InvTypeBlock, [][]byte{block.Hash})
-		}
+	s.inventory.markSeen(InvTypeBlock, block.Hash)
+	peers := s.relayPeersWithout(InvTypeBlock, block.Hash, "")
+	log.Printf("📡 Broadcasting block %d to %d peers", block.Height, len(peers))
+	for _, node := range peers {
+		log.Printf("   → Sending to %s", node)
+		s.sendInv(node, InvTypeBlock, [][]byte{block.Hash})
 	}
 }
 
 // sendData sends data to address
 func (s *Server) sendData(addr string, data []byte) {
-	conn, err := net.Dial(protocol, addr)
+	// The answers of the peers to a replayed node are part of the recording
+	if s.replaying {
+		return
+	}
+
+	// Unreachable peers are not dialed again until their backoff expires
+	if !s.Backoff.Ready(addr) || s.Bans.Banned(addr) {
+		return
+	}
+
+	conn, err := s.dial(addr, 0)
 	if err != nil {
-		log.Printf("Error connecting to %s: %v", addr, err)
-		s.removeNode(addr)
+		s.dialFailed(addr, err)
 		return
 	}
 	defer conn.Close()
 
-	_, err = io.Copy(conn, bytes.NewReader(data))
+	if s.Backoff.Succeeded(addr) {
+		log.Printf("🔌 Reconnected to %s", addr)
+	}
+
+	wire := withMagic(s.compressFor(addr, data))
+	_, err = io.Copy(conn, bytes.NewReader(wire))
 	if err != nil {
 		log.Printf("Error sending data to %s: %v", addr, err)
+		return
+	}
+
+	if len(data) >= commandLength {
+		s.PeerStats.RecordSent(addr, BytesToCmd(data[:commandLength]), len(wire))
 	}
 }
 
@@ -577,29 +910,11 @@ func (s *Server) getBestHeight() int {
 	return lastBlock.Height
 }
 
-func (s *Server) getBlocks() [][]byte {
-	var blocks [][]byte
-
-	// Use a safer iteration method
-	currentHash := s.Blockchain.LastHash
-
-	for {
-		// Try to get the block, but don't panic on error
-		data, err := s.Blockchain.Database.Get(currentHash, nil)
-		if err != nil {
-			log.Printf("⚠️  Error getting block %x: %v", currentHash, err)
-			break
-		}
-
-		block := blockchain.Deserialize(data)
-		blocks = append(blocks, block.Hash)
-
-		// Stop at genesis block
-		if len(block.PrevHash) == 0 {
-			break
-		}
-
-		currentHash = block.PrevHash
+// getBlocks returns the hashes of the main chain blocks from height to the tip, tip first
+func (s *Server) getBlocks(height int) [][]byte {
+	blocks, err := s.Blockchain.MainChainHashesFrom(height)
+	if err != nil {
+		log.Printf("⚠️  Error listing blocks from height %d: %v", height, err)
 	}
 
 	return blocks
@@ -638,127 +953,238 @@ func (s *Server) getBlock(hash []byte) (*blockchain.Block, error) {
 	return nil, fmt.Errorf("block not found")
 }
 
-func (s *Server) addBlock(block *blockchain.Block) {
-	// Get current best height
-	currentHeight := s.Blockchain.GetBestHeight()
-
-	// Check if block is next in sequence
-	if block.Height == currentHeight+1 {
-		// Validate block using the difficulty stored in the block
-		pow := blockchain.NewProofWithDifficulty(block, block.Difficulty)
-
-		// Debug: print all InitData components
-		pow.DebugInitData(block.Nonce)
-
-		// Recalculate hash
-		data := pow.InitData(block.Nonce)
-		log.Printf("🔍 Raw InitData (len=%d): %x", len(data), data)
-		hash := sha256.Sum256(data)
-
-		if !pow.Validate() {
-			txHash := block.HashTransactions()
-			log.Printf("❌ Invalid block received (PoW failed)")
-			log.Printf("   Block Height: %d, Hash: %x", block.Height, block.Hash)
-			log.Printf("   Recalculated Hash: %x", hash)
-			log.Printf("   Hashes match: %v", bytes.Equal(block.Hash, hash[:]))
-			log.Printf("   TxHash: %x", txHash)
-			log.Printf("   PrevHash: %x", block.PrevHash)
-			log.Printf("   Nonce: %d, Difficulty: %d, Timestamp: %d", block.Nonce, block.Difficulty, block.Timestamp)
-			log.Printf("   pow.Difficulty: %d, pow.Block.Difficulty: %d", pow.Difficulty, pow.Block.Difficulty)
-			log.Printf("   Num Transactions: %d", len(block.Transactions))
-			log.Printf("   ❌ Block rejected!")
-			return
-		}
-		log.Printf("✅ Block PoW validated successfully (difficulty: %d)", block.Difficulty)
+// addBlock validates a block and connects it to the chain, or stores it on a
+// side chain and reorganizes when that chain has more work
+// Orphans waiting for the block are accepted after it
+// Both network blocks and API submitted blocks go through this path
+func (s *Server) addBlock(block *blockchain.Block) error {
+	if err := s.acceptBlock(block); err != nil {
+		return err
+	}
 
-		// Add block to blockchain
-		err := s.Blockchain.Database.Put(block.Hash, block.Serialize(), nil)
-		if err != nil {
-			log.Printf("Error storing block: %v", err)
-			return
+	for _, orphan := range s.orphans.children(block.Hash) {
+		log.Printf("🧩 Processing orphan block %d (%x)", orphan.Height, orphan.Hash)
+		if err := s.addBlock(orphan); err != nil {
+			log.Printf("⚠️  Orphan block %d (%x) not accepted: %v", orphan.Height, orphan.Hash, err)
 		}
+	}
 
-		err = s.Blockchain.Database.Put([]byte("lh"), block.Hash, nil)
-		if err != nil {
-			log.Printf("Error updating last hash: %v", err)
-			return
+	return nil
+}
+
+// acceptBlock checks the proof of work of a block and hands it to the chain
+func (s *Server) acceptBlock(block *blockchain.Block) error {
+	if s.Blockchain.HasBlock(block.Hash) {
+		if err := s.Blockchain.CheckFinality(block); err != nil {
+			log.Printf("❌ Refusing block below the finality checkpoint: %v", err)
+			return fmt.Errorf("%w: %v", errInvalidBlock, err)
 		}
 
-		s.Blockchain.LastHash = block.Hash
-		log.Printf("✅ Block accepted! Height: %d, Hash: %x", block.Height, block.Hash)
+		log.Printf("ℹ️  Block %d already known", block.Height)
+		return fmt.Errorf("block %d already known", block.Height)
+	}
 
-		// Update UTXO set
-		UTXOSet := blockchain.UTXOSet{Blockchain: s.Blockchain}
-		UTXOSet.Reindex()
-
-		// Remove mined transactions from mempool
-		mempoolMux.Lock()
-		removedCount := 0
-		for _, tx := range block.Transactions {
-			if !tx.IsCoinbase() {
-				txID := hex.EncodeToString(tx.ID)
-				if _, exists := memoryPool[txID]; exists {
-					delete(memoryPool, txID)
-					removedCount++
-				}
-			}
-		}
-		mempoolMux.Unlock()
+	// The difficulty stored in the block must be the required one before its
+	// target is built: any other lets cheap blocks in, or has no target
+	if err := blockchain.CheckBlockDifficulty(block); err != nil {
+		log.Printf("❌ Invalid block received: %v", err)
+		return fmt.Errorf("%w: %v", errInvalidBlock, err)
+	}
 
-		if removedCount > 0 {
-			log.Printf("🧹 Cleaned %d transactions from mempool (size now: %d)", removedCount, len(memoryPool))
+	// Validate block using the difficulty stored in the block
+	pow := blockchain.NewProofWithDifficulty(block, block.Difficulty)
+
+	// Debug: print all InitData components
+	pow.DebugInitData(block.Nonce)
+
+	// Recalculate hash
+	data := pow.InitData(block.Nonce)
+	log.Printf("🔍 Raw InitData (len=%d): %x", len(data), data)
+	hash := sha256.Sum256(data)
+
+	if !pow.Validate() {
+		txHash := block.HashTransactions()
+		log.Printf("❌ Invalid block received (PoW failed)")
+		log.Printf("   Block Height: %d, Hash: %x", block.Height, block.Hash)
+		log.Printf("   Recalculated Hash: %x", hash)
+		log.Printf("   Hashes match: %v", bytes.Equal(block.Hash, hash[:]))
+		log.Printf("   TxHash: %x", txHash)
+		log.Printf("   PrevHash: %x", block.PrevHash)
+		log.Printf("   Nonce: %d, Difficulty: %d, Timestamp: %d", block.Nonce, block.Difficulty, block.Timestamp)
+		log.Printf("   pow.Difficulty: %d, pow.Block.Difficulty: %d", pow.Difficulty, pow.Block.Difficulty)
+		log.Printf("   Num Transactions: %d", len(block.Transactions))
+		log.Printf("   ❌ Block rejected!")
+		return fmt.Errorf("%w: block %x failed proof of work validation", errInvalidBlock, block.Hash)
+	}
+	log.Printf("✅ Block PoW validated successfully (difficulty: %d)", block.Difficulty)
+
+	// Connect the block, store it on a side chain or reorganize
+	reorg, err := s.Blockchain.AcceptBlock(block)
+	if err != nil {
+		if errors.Is(err, blockchain.ErrOrphanBlock) {
+			// Kept until the missing ancestors arrive
+			log.Printf("🧩 Orphan block %d (%x): %v", block.Height, block.Hash, err)
+			s.orphans.add(block)
+			return err
 		}
 
-		// Interrupt any ongoing mining (non-blocking)
-		select {
-		case s.miningInterrupt <- true:
-			log.Println("🛑 Signaled mining interrupt - new block accepted")
-		default:
-			// Channel full or no miner active, ignore
+		log.Printf("❌ Block rejected: %v", err)
+		if errors.Is(err, errInvalidBlock) {
+			return err
 		}
+		if errors.Is(err, blockchain.ErrUTXOCommitment) || errors.Is(err, blockchain.ErrSequenceLock) ||
+			errors.Is(err, blockchain.ErrCoinbaseReward) || errors.Is(err, blockchain.ErrBadBlockLink) ||
+			errors.Is(err, blockchain.ErrFinalityViolation) {
+			return fmt.Errorf("%w: %v", errInvalidBlock, err)
+		}
+		return err
+	}
 
-	} else if block.Height > currentHeight+1 {
-		// We're missing blocks, request them
-		log.Printf("⚠️  Missing blocks! Our height: %d, received: %d", currentHeight, block.Height)
-		// This should trigger a full sync, but for now just log
-	} else {
-		log.Printf("ℹ️  Block %d already known or outdated", block.Height)
+	switch {
+	case reorg == nil:
+		// Side chain block, the main chain is unchanged
+	case len(reorg.Disconnected) == 0:
+		log.Printf("✅ Block accepted! Height: %d, Hash: %x", block.Height, block.Hash)
+		s.blockConnected(block)
+		s.publishDelta(block)
+	default:
+		log.Printf("✅ Block accepted with a reorganization! Height: %d, Hash: %x", block.Height, block.Hash)
+		s.chainReorganized(reorg)
 	}
+
+	return nil
 }
 
-func (s *Server) nodeIsKnown(addr string) bool {
-	for _, node := range knownNodes {
-		if node == addr {
-			return true
+// blockConnected updates the mempool and dependent state after a block
+// received from the network became the new tip
+func (s *Server) blockConnected(block *blockchain.Block) {
+	// Remove mined transactions from mempool
+	s.mempoolMux.Lock()
+	s.recordBlockFees(block)
+	removedCount := 0
+	for _, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			txID := hex.EncodeToString(tx.ID)
+			if s.removeMempoolEntry(txID) {
+				removedCount++
+			}
 		}
 	}
-	return false
+	removedCount += s.removeBlockConflicts(block)
+	s.mempoolMux.Unlock()
+
+	if removedCount > 0 {
+		log.Printf("🧹 Cleaned %d transactions from mempool (size now: %d)", removedCount, len(s.memoryPool))
+	}
+
+	// New tip: outstanding block templates are stale
+	s.templates.notify(removedCount > 0)
+	s.Tip.tipChanged(block.Height)
+	s.APIServer.Confirmations.Update(s.Blockchain)
+	s.APIServer.PublishBlock(block)
+	go s.APIServer.EnforceChannelTimeouts()
+
+	// Interrupt any ongoing mining (non-blocking)
+	select {
+	case s.miningInterrupt <- true:
+		log.Println("🛑 Signaled mining interrupt - new block accepted")
+	default:
+		// Channel full or no miner active, ignore
+	}
 }
 
-func (s *Server) removeNode(addr string) {
-	var newNodes []string
-	for _, node := range knownNodes {
-		if node != addr {
-			newNodes = append(newNodes, node)
+// chainReorganized updates the mempool and dependent state after the main
+// chain switched to a heavier branch
+// Transactions of the disconnected blocks go back to the mempool unless the
+// new branch mined them or spent their inputs
+func (s *Server) chainReorganized(reorg *blockchain.Reorg) {
+	for _, block := range reorg.Connected {
+		s.blockConnected(block)
+	}
+
+	// Oldest block first, so parents are back before their children
+	restored, dropped := 0, 0
+	for i := len(reorg.Disconnected) - 1; i >= 0; i-- {
+		for _, tx := range reorg.Disconnected[i].Transactions {
+			if tx.IsCoinbase() {
+				continue
+			}
+			if err := s.AcceptToMempool(tx); err != nil {
+				dropped++
+				continue
+			}
+			restored++
 		}
 	}
-	knownNodes = newNodes
+
+	log.Printf("🔀 Reorganization: %d block(s) disconnected, %d connected, %d transaction(s) back in the mempool, %d dropped",
+		len(reorg.Disconnected), len(reorg.Connected), restored, dropped)
 }
 
-func (s *Server) mineTransactions() {
-	mempoolMux.Lock()
+func (s *Server) nodeIsKnown(addr string) bool {
+	s.knownMux.RLock()
+	defer s.knownMux.RUnlock()
+
+	return slices.Contains(s.knownNodes, addr)
+}
+
+func (s *Server) removeNode(addr string) {
+	s.knownMux.Lock()
+	s.knownNodes = slices.DeleteFunc(s.knownNodes, func(node string) bool { return node == addr })
+	s.knownMux.Unlock()
 
+	s.forgetNode(addr)
+}
+
+// forgetNode drops the state kept about a node no longer known
+func (s *Server) forgetNode(addr string) {
+	s.forgetAddress(addr)
+	s.Outbound.remove(addr)
+	s.Peers.Remove(addr)
+}
+
+// selectMempoolTransactions collects the valid mempool transactions for a new block,
+// highest fee rate first, up to DefaultMaxBlockTxBytes (and never beyond what
+// fits the consensus MaxBlockSize next to the header and the coinbase)
+// Of conflicting transactions (spending the same output) only the first is taken
+// The caller must hold mempoolMux
+func (s *Server) selectMempoolTransactions() []*blockchain.Transaction {
 	var txs []*blockchain.Transaction
+	nextHeight := s.Blockchain.GetBestHeight() + 1
+	params := s.Blockchain.Params
+	space := min(DefaultMaxBlockTxBytes, params.MaxBlockSize-params.BlockSizeReserve)
+	spent := make(map[blockchain.Outpoint]string)
 
-	log.Printf("🔵 MINING: Checking mempool (size: %d)", len(memoryPool))
+	log.Printf("🔵 MINING: Checking mempool (size: %d)", len(s.memoryPool))
 
 	// Collect valid transactions from mempool
-	for id := range memoryPool {
-		tx := memoryPool[id]
+	for _, id := range s.sortedMempoolIDs() {
+		tx := s.memoryPool[id]
+		if size := s.mempoolEntries[id].size; size > space {
+			log.Printf("📦 MINING: Skipping transaction %s (%d bytes, %d left in block)", id, size, space)
+			continue
+		}
+		if winner := conflictingSpend(tx, spent); winner != "" {
+			log.Printf("⚔️  MINING: Skipping transaction %s (conflicts with %s)", id, winner)
+			continue
+		}
+		if reason := s.Blacklist.Excludes(tx); reason != "" {
+			log.Printf("🚫 MINING: Skipping transaction %s (%s)", id, reason)
+			continue
+		}
+		if err := s.Blockchain.CheckSequenceLocks(tx, nextHeight); err != nil {
+			log.Printf("⏳ MINING: Skipping transaction %s (%v)", id, err)
+			continue
+		}
+
 		log.Printf("🔵 MINING: Verifying transaction %s", id)
 		if s.Blockchain.VerifyTransaction(tx) {
 			log.Printf("✅ MINING: Transaction %s is valid, adding to block", id)
 			txs = append(txs, tx)
+			space -= s.mempoolEntries[id].size
+			for _, op := range spentOutpoints(tx) {
+				spent[op] = id
+			}
 		} else {
 			log.Printf("❌ MINING: Transaction %s verification FAILED", id)
 		}
@@ -766,9 +1192,24 @@ func (s *Server) mineTransactions() {
 
 	log.Printf("🔵 MINING: Collected %d valid transactions from mempool", len(txs))
 
+	return txs
+}
+
+func (s *Server) mineTransactions() {
+	s.mempoolMux.Lock()
+
+	txs := s.selectMempoolTransactions()
+
 	// Get current height for coinbase reward calculation
 	newHeight := s.Blockchain.GetBestHeight() + 1
-	cbTx := blockchain.CoinbaseTX(miningAddress, "", newHeight)
+	split, err := blockchain.ParseRewardSplit(s.minerAddress())
+	if err != nil {
+		s.mempoolMux.Unlock()
+		log.Printf("❌ Cannot mine: %v", err)
+		time.Sleep(time.Second)
+		return
+	}
+	cbTx := blockchain.CoinbaseSplitTX(split, blockchain.CoinbaseData(s.CoinbaseMessage), newHeight)
 	txs = append(txs, cbTx)
 
 	// Always mine, even if only coinbase transaction exists
@@ -779,49 +1220,77 @@ func (s *Server) mineTransactions() {
 	}
 
 	// Unlock during mining (long operation)
-	mempoolMux.Unlock()
+	s.mempoolMux.Unlock()
 
 	// Mine with interrupt support
 	newBlock := s.Blockchain.MineBlockWithInterrupt(txs, s.miningInterrupt)
 
 	// If block is nil, mining was interrupted by a new block from network
 	if newBlock == nil {
+		s.miningMux.Lock()
+		stopping := !s.IsMining
+		s.miningMux.Unlock()
+
+		if stopping {
+			log.Println("⏸️  Mining interrupted - mining stopped")
+			return
+		}
 		log.Println("⚠️  Mining interrupted - new block received from network")
+		s.Mining.roundInterrupted()
 		return
 	}
 
 	// Lock again for mempool cleanup
-	mempoolMux.Lock()
-	defer mempoolMux.Unlock()
-
-	UTXOSet := blockchain.UTXOSet{Blockchain: s.Blockchain}
-	UTXOSet.Reindex()
+	s.mempoolMux.Lock()
+	defer s.mempoolMux.Unlock()
 
 	log.Printf("✅ New block mined! Height: %d, Hash: %x", newBlock.Height, newBlock.Hash)
+	s.Mining.blockMined(newBlock, s.Blockchain)
+	s.recordLocal(CmdBlock, BlockMsg{AddrFrom: s.nodeAddress, Block: newBlock.Serialize()})
 
 	// Clear mined transactions from mempool
+	s.recordBlockFees(newBlock)
 	for _, tx := range txs {
 		if !tx.IsCoinbase() { // Don't try to delete coinbase from mempool
 			txID := hex.EncodeToString(tx.ID)
-			delete(memoryPool, txID)
+			s.removeMempoolEntry(txID)
 		}
 	}
+	s.removeBlockConflicts(newBlock)
+
+	s.templates.notify(true)
+	s.Tip.tipChanged(newBlock.Height)
+	s.APIServer.Confirmations.Update(s.Blockchain)
+	s.APIServer.PublishBlock(newBlock)
+	go s.APIServer.EnforceChannelTimeouts()
 
 	// Broadcast new block
 	s.BroadcastBlock(newBlock)
+	s.publishDelta(newBlock)
 }
 
-// GetKnownNodes returns list of known nodes
-func GetKnownNodes() []string {
-	return knownNodes
+// KnownNodes returns the known nodes
+func (s *Server) KnownNodes() []string {
+	s.knownMux.RLock()
+	defer s.knownMux.RUnlock()
+
+	return slices.Clone(s.knownNodes)
 }
 
-// AddKnownNode adds a node to known nodes
-func AddKnownNode(addr string) {
-	for _, node := range knownNodes {
-		if node == addr {
-			return
-		}
+// addKnownNode adds a node to the known nodes
+func (s *Server) addKnownNode(addr string) {
+	s.knownMux.Lock()
+	defer s.knownMux.Unlock()
+
+	if !slices.Contains(s.knownNodes, addr) {
+		s.knownNodes = append(s.knownNodes, addr)
 	}
-	knownNodes = append(knownNodes, addr)
+}
+
+// setKnownNodes replaces the known nodes
+func (s *Server) setKnownNodes(nodes []string) {
+	s.knownMux.Lock()
+	defer s.knownMux.Unlock()
+
+	s.knownNodes = slices.Clone(nodes)
 }
@@ -0,0 +1,163 @@
+package network
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/marcocsrachid/blockchain-go/internal/api"
+)
+
+// Stale tip defaults
+const (
+	DefaultStaleTipFactor = 3               // Target block times without a new block before the tip is suspect
+	staleTipCheckInterval = targetBlockTime // Between checks, and between recovery attempts while stale
+)
+
+// TipMonitor tracks when the tip last changed to notice a node cut off from
+// the network: no block received or mined for StaleAfter
+type TipMonitor struct {
+	StaleAfter time.Duration
+
+	lastChange    time.Time // Local time the tip last changed (or the node started)
+	height        int
+	stale         bool
+	rediscoveries int
+	lastRecovery  time.Time
+
+	mu sync.Mutex
+}
+
+// NewTipMonitor creates a monitor with the default threshold, starting now
+func NewTipMonitor() *TipMonitor {
+	return &TipMonitor{
+		StaleAfter: DefaultStaleTipFactor * targetBlockTime,
+		lastChange: time.Now(),
+		height:     -1,
+	}
+}
+
+// tipChanged records a new tip, clearing the stale warning
+func (t *TipMonitor) tipChanged(height int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.stale {
+		log.Printf("✅ Tip is moving again at height %d after %s", height, time.Since(t.lastChange).Round(time.Second))
+	}
+	t.lastChange = time.Now()
+	t.height = height
+	t.stale = false
+}
+
+// check reports whether the tip is stale, and whether it just became so
+func (t *TipMonitor) check() (stale, becameStale bool, age time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	age = time.Since(t.lastChange)
+	if t.StaleAfter <= 0 || age < t.StaleAfter {
+		return false, false, age
+	}
+
+	becameStale = !t.stale
+	t.stale = true
+	return true, becameStale, age
+}
+
+// recovered counts a recovery attempt
+func (t *TipMonitor) recovered() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.rediscoveries++
+	t.lastRecovery = time.Now()
+}
+
+// Status returns the tip health reported by /api/status
+func (t *TipMonitor) Status() api.TipStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status := api.TipStatus{
+		LastTipChange: t.lastChange.Unix(),
+		TipAge:        int64(time.Since(t.lastChange).Seconds()),
+		StaleAfter:    int64(t.StaleAfter.Seconds()),
+		StaleTip:      t.stale,
+		Rediscoveries: t.rediscoveries,
+	}
+	if !t.lastRecovery.IsZero() {
+		status.LastRediscovery = t.lastRecovery.Unix()
+	}
+	if t.stale {
+		status.Warnings = append(status.Warnings, fmt.Sprintf("possibly stale tip: no new block for %s (expected every %s)",
+			time.Since(t.lastChange).Round(time.Second), targetBlockTime))
+	}
+
+	return status
+}
+
+// TipStatus implements api.StatusProvider
+func (s *Server) TipStatus() api.TipStatus {
+	status := s.Tip.Status()
+	status.Peers = s.Peers.Count()
+	status.KnownPeers = len(s.KnownNodes())
+	status.Outbound = s.Outbound.Count()
+	status.Inbound = len(s.inboundPeers())
+	status.Address = s.nodeAddress
+	status.PortMapping = s.PortMapping()
+
+	s.mempoolMux.RLock()
+	status.MempoolTxs = len(s.memoryPool)
+	s.mempoolMux.RUnlock()
+
+	return status
+}
+
+// staleTipLoop periodically checks the tip, looking for peers while it is stale
+func (s *Server) staleTipLoop() {
+	ticker := time.NewTicker(staleTipCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		stale, becameStale, age := s.Tip.check()
+		if !stale {
+			continue
+		}
+		if becameStale {
+			log.Printf("⏰ Possibly stale tip: no new block for %s at height %d, looking for peers",
+				age.Round(time.Second), s.getBestHeight())
+		}
+		s.rediscoverPeers()
+	}
+}
+
+// rediscoverPeers looks for a better chain: the seed nodes are known and
+// dialable again (re-resolved, as addresses are resolved on every dial),
+// free outbound slots are filled and every known peer is asked for its height
+// A peer with a longer chain answers with its version and the node syncs from it
+func (s *Server) rediscoverPeers() {
+	for _, seed := range s.seeds {
+		if seed == s.nodeAddress || !s.Policy.AllowAddr(seed) {
+			continue
+		}
+		s.addKnownNode(seed)
+		s.Backoff.Succeeded(seed) // Give a seed that was backing off another chance
+	}
+
+	added := s.fillOutbound()
+
+	known := s.KnownNodes()
+	queried := 0
+	for _, addr := range known {
+		if addr != s.nodeAddress {
+			go s.sendVersion(addr)
+			queried++
+		}
+	}
+	s.Tip.recovered()
+
+	log.Printf("🔭 Stale tip recovery: queried %d peers for their height, %d new outbound (%d/%d slots)",
+		queried, len(added), s.Outbound.Count(), s.MaxOutbound)
+}
@@ -0,0 +1,189 @@
+package network
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// maxCachedTemplates is the number of templates remembered for header submissions
+const maxCachedTemplates = 32
+
+// templateCache remembers the templates handed out to external miners, so a
+// solved header (template ID, timestamp and nonce) is enough to rebuild the block
+type templateCache struct {
+	templates map[string]*blockchain.BlockTemplate
+	order     []string // Oldest first
+	mu        sync.Mutex
+}
+
+func newTemplateCache() *templateCache {
+	return &templateCache{templates: make(map[string]*blockchain.BlockTemplate)}
+}
+
+// add remembers a template, forgetting the oldest beyond maxCachedTemplates
+func (c *templateCache) add(id string, template *blockchain.BlockTemplate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.templates[id]; !ok {
+		c.order = append(c.order, id)
+	}
+	c.templates[id] = template
+
+	for len(c.order) > maxCachedTemplates {
+		delete(c.templates, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// get returns a remembered template
+func (c *templateCache) get(id string) (*blockchain.BlockTemplate, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	template, ok := c.templates[id]
+	return template, ok
+}
+
+// templateID identifies a template by its merkle root, unique thanks to the
+// random coinbase data (the API hands it out as template_id)
+func templateID(template *blockchain.BlockTemplate) string {
+	return hex.EncodeToString(template.MerkleRoot)
+}
+
+// templateNotifier wakes up long-polling template requests whenever the
+// template changes (new tip or mempool change)
+type templateNotifier struct {
+	mempoolVersion uint64
+	changed        chan struct{}
+	mu             sync.Mutex
+}
+
+func newTemplateNotifier() *templateNotifier {
+	return &templateNotifier{
+		changed: make(chan struct{}),
+	}
+}
+
+// notify signals a template change to all waiters
+func (n *templateNotifier) notify(mempoolChanged bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if mempoolChanged {
+		n.mempoolVersion++
+	}
+
+	close(n.changed)
+	n.changed = make(chan struct{})
+}
+
+// wait returns a channel closed on the next template change
+func (n *templateNotifier) wait() <-chan struct{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.changed
+}
+
+// version returns the current mempool version
+func (n *templateNotifier) version() uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.mempoolVersion
+}
+
+// LongPollID identifies the current template state (tip hash + mempool version)
+func (s *Server) LongPollID() string {
+	return fmt.Sprintf("%s:%d", hex.EncodeToString(s.Blockchain.LastHash), s.templates.version())
+}
+
+// GetBlockTemplate builds a block template from the mempool paying the coinbase to address,
+// a single address or percentage shares ("ADDR1:60,ADDR2:40")
+// An empty address pays the node's mining address
+func (s *Server) GetBlockTemplate(address string) (*blockchain.BlockTemplate, error) {
+	if address == "" {
+		address = s.minerAddress()
+	}
+	split, err := blockchain.ParseRewardSplit(address)
+	if err != nil {
+		return nil, fmt.Errorf("a valid coinbase address is required: %v", err)
+	}
+
+	s.mempoolMux.RLock()
+	txs := s.selectMempoolTransactions()
+	s.mempoolMux.RUnlock()
+
+	template, err := blockchain.NewBlockTemplate(s.Blockchain, txs, split, s.CoinbaseMessage)
+	if err != nil {
+		return nil, err
+	}
+	s.templateCache.add(templateID(template), template)
+
+	return template, nil
+}
+
+// SubmitHeader rebuilds the block of a template handed out by GetBlockTemplate
+// from the solved header fields, then submits it like SubmitBlock
+func (s *Server) SubmitHeader(templateID string, timestamp int64, nonce int) (*blockchain.Block, error) {
+	template, ok := s.templateCache.get(templateID)
+	if !ok {
+		return nil, fmt.Errorf("unknown template %s (expired or from another node)", templateID)
+	}
+
+	block := template.Block(timestamp, nonce)
+	return block, s.SubmitBlock(block)
+}
+
+// WaitForTemplateChange blocks until the template differs from longPollID
+// or the timeout expires; it returns the current long poll ID
+func (s *Server) WaitForTemplateChange(longPollID string, timeout time.Duration) string {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		changed := s.templates.wait()
+
+		current := s.LongPollID()
+		if current != longPollID {
+			return current
+		}
+
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return current
+		}
+	}
+}
+
+// SubmitBlock validates and connects an externally mined block, then broadcasts it
+// The block goes through the same path as blocks received from peers
+func (s *Server) SubmitBlock(block *blockchain.Block) error {
+	if err := blockchain.CheckBlockDifficulty(block); err != nil {
+		return err
+	}
+	if len(block.Hash) == 0 {
+		// Miners may omit the hash, it is fully determined by the header
+		pow := blockchain.NewProofWithDifficulty(block, block.Difficulty)
+		hash := sha256.Sum256(pow.InitData(block.Nonce))
+		block.Hash = hash[:]
+	}
+
+	if err := s.addBlock(block); err != nil {
+		return err
+	}
+	s.recordLocal(CmdBlock, BlockMsg{AddrFrom: s.nodeAddress, Block: block.Serialize()})
+
+	log.Printf("📨 Accepted submitted block %d (%x)", block.Height, block.Hash)
+	s.BroadcastBlock(block)
+
+	return nil
+}
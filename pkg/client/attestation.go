@@ -0,0 +1,60 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// Attestation is a signed statement of a node's chain state
+type Attestation = blockchain.Attestation
+
+// VerifyAttestation checks the signature of an attestation
+// If expectedPubKey is not empty the attestation must also come from that node key
+func VerifyAttestation(a *Attestation, expectedPubKey string) error {
+	if expectedPubKey != "" && a.NodePubKey != expectedPubKey {
+		return fmt.Errorf("attestation signed by %s, expected %s", a.NodePubKey, expectedPubKey)
+	}
+
+	if !a.Verify() {
+		return fmt.Errorf("invalid attestation signature from %s", a.NodePubKey)
+	}
+
+	return nil
+}
+
+// Divergence describes a mismatch between two attestations at the same height
+type Divergence struct {
+	Height int
+	Field  string
+	A      string
+	B      string
+}
+
+func (d Divergence) String() string {
+	return fmt.Sprintf("height %d: %s differs (%s vs %s)", d.Height, d.Field, d.A, d.B)
+}
+
+// CompareAttestations compares two verified attestations
+// Attestations at different heights cannot be compared and return an error
+func CompareAttestations(a, b *Attestation) ([]Divergence, error) {
+	if a.Network != b.Network {
+		return nil, fmt.Errorf("attestations are for different networks (%s vs %s)", a.Network, b.Network)
+	}
+	if a.Height != b.Height {
+		return nil, fmt.Errorf("attestations are at different heights (%d vs %d)", a.Height, b.Height)
+	}
+
+	var divergences []Divergence
+	if a.TipHash != b.TipHash {
+		divergences = append(divergences, Divergence{a.Height, "tip_hash", a.TipHash, b.TipHash})
+	}
+	if a.UTXOCommitment != b.UTXOCommitment {
+		divergences = append(divergences, Divergence{a.Height, "utxo_commitment", a.UTXOCommitment, b.UTXOCommitment})
+	}
+	if a.Supply != b.Supply {
+		divergences = append(divergences, Divergence{a.Height, "supply", fmt.Sprint(a.Supply), fmt.Sprint(b.Supply)})
+	}
+
+	return divergences, nil
+}
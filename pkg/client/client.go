@@ -0,0 +1,169 @@
+// Package client provides a small Go client for the node HTTP API
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/marcocsrachid/blockchain-go/internal/api"
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+)
+
+// Client talks to a single node HTTP API
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	Header     http.Header // Sent with every request (e.g. spend authorization)
+}
+
+// New creates a client for the node API at baseURL (e.g. http://localhost:4000)
+// The API key or token in BLOCKCHAIN_API_KEY, if any, is sent with every request
+func New(baseURL string) *Client {
+	c := &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		Header:     make(http.Header),
+	}
+	if key := os.Getenv("BLOCKCHAIN_API_KEY"); key != "" {
+		c.Header.Set("Authorization", "Bearer "+key)
+	}
+	return c
+}
+
+// APIError is returned when the node answers with an error status
+type APIError struct {
+	Path       string
+	StatusCode int
+	Status     string
+	Code       string                 // Error code of the API response (e.g. INSUFFICIENT_FUNDS)
+	Message    string                 // Error message of the API response
+	Details    map[string]interface{} // Optional details, like the reject_code of a refused transaction
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: %s (%s)", e.Path, e.Status, e.Message)
+}
+
+// getJSON performs a GET request and decodes the JSON response into out
+func (c *Client) getJSON(path string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, c.BaseURL+path, nil)
+	if err != nil {
+		return err
+	}
+
+	return c.do(req, path, out)
+}
+
+// postJSON performs a POST request with in as JSON body and decodes the JSON response into out
+func (c *Client) postJSON(path string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return c.do(req, path, out)
+}
+
+// do sends req with the client headers and decodes the JSON response into out
+func (c *Client) do(req *http.Request, path string, out interface{}) error {
+	resp, err := c.send(req, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// send sends req with the client headers, the caller closes the body of the
+// response (an *APIError unless the status is OK)
+func (c *Client) send(req *http.Request, path string) (*http.Response, error) {
+	for name, values := range c.Header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var apiErr api.ErrorResponse
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return nil, &APIError{Path: path, StatusCode: resp.StatusCode, Status: resp.Status,
+			Code: apiErr.Code, Message: apiErr.Error, Details: apiErr.Details}
+	}
+
+	return resp, nil
+}
+
+// GetAttestation fetches a signed chain state attestation from the node
+func (c *Client) GetAttestation() (*blockchain.Attestation, error) {
+	var attestation blockchain.Attestation
+	if err := c.getJSON("/api/attestation", &attestation); err != nil {
+		return nil, err
+	}
+	return &attestation, nil
+}
+
+// GetLastBlock fetches the tip of the node's main chain
+func (c *Client) GetLastBlock() (*api.LastBlockResponse, error) {
+	var block api.LastBlockResponse
+	if err := c.getJSON("/api/lastblock", &block); err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
+// GetBlock fetches a block by hex hash
+// Blocks known to the node but off its main chain have 0 confirmations
+func (c *Client) GetBlock(hash string) (*api.BlockResponse, error) {
+	var block api.BlockResponse
+	if err := c.getJSON("/api/block/"+hash, &block); err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
+// Backup asks the node for a backup of its chain database and copies it to w
+// (see blockchain.Backup), returning the number of bytes written
+// Large databases take longer than the default HTTPClient timeout
+func (c *Client) Backup(w io.Writer) (int64, error) {
+	const path = "/api/admin/backup"
+	req, err := http.NewRequest(http.MethodPost, c.BaseURL+path, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := c.send(req, path)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	return io.Copy(w, resp.Body)
+}
+
+// Send asks the node to build, sign and broadcast a payment from one of its wallets
+func (c *Client) Send(req api.SendRequest) (*api.SendResponse, error) {
+	var resp api.SendResponse
+	if err := c.postJSON("/api/send", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,330 @@
+// Package monitor watches several nodes from the outside, like a watchtower,
+// and raises alerts when their chains fork, stall or fall behind
+//
+// Every interval the monitor fetches the tip of each node. The node with the
+// highest tip leads; a node whose tip is not in the leader's main chain has
+// forked (split brain), a node too far below the leader is lagging and a node
+// whose tip has not moved for a while has stalled. Alerts are raised once
+// when a condition appears and resolved when it clears.
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/marcocsrachid/blockchain-go/pkg/client"
+)
+
+// Monitoring defaults
+const (
+	DefaultInterval   = 30 * time.Second
+	DefaultStallAfter = 10 * time.Minute
+	DefaultMaxLag     = 3 // Blocks
+)
+
+// Alert kinds
+const (
+	AlertFork        = "fork"
+	AlertStalled     = "stalled"
+	AlertLagging     = "lagging"
+	AlertUnreachable = "unreachable"
+)
+
+// Alert is raised when a condition appears on a node and resolved when it clears
+type Alert struct {
+	Kind     string    `json:"kind"`
+	Node     string    `json:"node"`
+	Message  string    `json:"message"`
+	Resolved bool      `json:"resolved"`
+	Time     time.Time `json:"time"`
+}
+
+func (a Alert) String() string {
+	if a.Resolved {
+		return fmt.Sprintf("resolved %s on %s: %s", a.Kind, a.Node, a.Message)
+	}
+	return fmt.Sprintf("%s on %s: %s", a.Kind, a.Node, a.Message)
+}
+
+// Config configures a monitor
+type Config struct {
+	Nodes      []string      // Base URLs of the node HTTP APIs
+	Interval   time.Duration // Between checks
+	StallAfter time.Duration // Tip age after which a node is stalled
+	MaxLag     int           // Blocks a node may trail the leader
+	WebhookURL string        // Receives each alert as a JSON POST (empty = log only)
+}
+
+// NodeStatus is the last known tip of a node
+type NodeStatus struct {
+	URL          string    `json:"url"`
+	Reachable    bool      `json:"reachable"`
+	Height       int       `json:"height"`
+	TipHash      string    `json:"tip_hash"`
+	TipChangedAt time.Time `json:"tip_changed_at"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// Monitor checks a set of nodes and raises alerts
+type Monitor struct {
+	cfg     Config
+	clients map[string]*client.Client
+	nodes   map[string]*NodeStatus
+	active  map[string]Alert // Raised alerts by kind and node
+
+	// Notify receives every raised or resolved alert; it defaults to
+	// logging it and posting it to the webhook
+	Notify func(Alert)
+
+	webhook *http.Client
+	mu      sync.Mutex
+}
+
+// New creates a monitor of cfg.Nodes, applying defaults to unset settings
+func New(cfg Config) (*Monitor, error) {
+	if len(cfg.Nodes) < 1 {
+		return nil, fmt.Errorf("at least one node is required")
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	if cfg.StallAfter <= 0 {
+		cfg.StallAfter = DefaultStallAfter
+	}
+	if cfg.MaxLag <= 0 {
+		cfg.MaxLag = DefaultMaxLag
+	}
+
+	m := &Monitor{
+		cfg:     cfg,
+		clients: make(map[string]*client.Client),
+		nodes:   make(map[string]*NodeStatus),
+		active:  make(map[string]Alert),
+		webhook: &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, url := range cfg.Nodes {
+		if _, ok := m.clients[url]; ok {
+			return nil, fmt.Errorf("node %s is listed twice", url)
+		}
+		m.clients[url] = client.New(url)
+		m.nodes[url] = &NodeStatus{URL: url}
+	}
+	m.Notify = m.notify
+
+	return m, nil
+}
+
+// Run checks the nodes every interval until stop is closed (nil runs forever)
+func (m *Monitor) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		m.Check()
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Check polls every node once and returns the alerts raised or resolved
+func (m *Monitor) Check() []Alert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.fetchTips(now)
+
+	conditions := make(map[string]Alert)
+	raise := func(kind, node, format string, args ...interface{}) {
+		conditions[alertKey(kind, node)] = Alert{Kind: kind, Node: node, Message: fmt.Sprintf(format, args...), Time: now}
+	}
+
+	leader := m.leader()
+	for _, url := range m.cfg.Nodes {
+		node := m.nodes[url]
+		if !node.Reachable {
+			raise(AlertUnreachable, url, "%s", node.Error)
+			continue
+		}
+
+		if age := now.Sub(node.TipChangedAt); age >= m.cfg.StallAfter {
+			raise(AlertStalled, url, "tip %s at height %d unchanged for %s", short(node.TipHash), node.Height, age.Round(time.Second))
+		}
+
+		if leader == nil || node == leader {
+			continue
+		}
+
+		if lag := leader.Height - node.Height; lag > m.cfg.MaxLag {
+			raise(AlertLagging, url, "height %d is %d blocks behind %s (height %d)", node.Height, lag, leader.URL, leader.Height)
+		}
+
+		if forked, reason := m.diverges(node, leader); forked {
+			raise(AlertFork, url, "tip %s at height %d %s", short(node.TipHash), node.Height, reason)
+		}
+	}
+
+	// Raise new conditions and resolve the ones that cleared
+	var alerts []Alert
+	for key, alert := range conditions {
+		if _, ok := m.active[key]; !ok {
+			m.active[key] = alert
+			alerts = append(alerts, alert)
+		}
+	}
+	for key, alert := range m.active {
+		if _, ok := conditions[key]; !ok {
+			delete(m.active, key)
+			alert.Resolved = true
+			alert.Time = now
+			alerts = append(alerts, alert)
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alertKey(alerts[i].Kind, alerts[i].Node) < alertKey(alerts[j].Kind, alerts[j].Node)
+	})
+
+	for _, alert := range alerts {
+		m.Notify(alert)
+	}
+
+	return alerts
+}
+
+// Status returns the last known tip of every node
+func (m *Monitor) Status() []NodeStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := make([]NodeStatus, 0, len(m.cfg.Nodes))
+	for _, url := range m.cfg.Nodes {
+		statuses = append(statuses, *m.nodes[url])
+	}
+	return statuses
+}
+
+// fetchTips updates the tip of every node, querying them in parallel
+// The caller must hold m.mu
+func (m *Monitor) fetchTips(now time.Time) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	for url, c := range m.clients {
+		wg.Add(1)
+		go func(url string, c *client.Client) {
+			defer wg.Done()
+
+			tip, err := c.GetLastBlock()
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			node := m.nodes[url]
+			if err != nil {
+				node.Reachable = false
+				node.Error = err.Error()
+				return
+			}
+
+			node.Reachable = true
+			node.Error = ""
+			if tip.Hash != node.TipHash {
+				node.TipHash = tip.Hash
+				node.TipChangedAt = now
+			}
+			node.Height = tip.Height
+		}(url, c)
+	}
+
+	wg.Wait()
+}
+
+// leader returns the reachable node with the highest tip (first listed on ties)
+// The caller must hold m.mu
+func (m *Monitor) leader() *NodeStatus {
+	var leader *NodeStatus
+	for _, url := range m.cfg.Nodes {
+		node := m.nodes[url]
+		if node.Reachable && (leader == nil || node.Height > leader.Height) {
+			leader = node
+		}
+	}
+	return leader
+}
+
+// diverges reports whether the tip of node is off the main chain of leader
+// The caller must hold m.mu
+func (m *Monitor) diverges(node, leader *NodeStatus) (bool, string) {
+	if node.Height == leader.Height {
+		if node.TipHash != leader.TipHash {
+			return true, fmt.Sprintf("differs from the tip %s of %s", short(leader.TipHash), leader.URL)
+		}
+		return false, ""
+	}
+
+	block, err := m.clients[leader.URL].GetBlock(node.TipHash)
+	var apiErr *client.APIError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound:
+		return true, fmt.Sprintf("is unknown to %s", leader.URL)
+	case err != nil:
+		return false, "" // Leader unreachable, it is reported on the next check
+	case block.Confirmations == 0:
+		return true, fmt.Sprintf("is off the main chain of %s", leader.URL)
+	}
+
+	return false, ""
+}
+
+// notify logs an alert and posts it to the webhook
+func (m *Monitor) notify(alert Alert) {
+	if alert.Resolved {
+		log.Printf("✅ MONITOR: %s", alert)
+	} else {
+		log.Printf("🚨 MONITOR: %s", alert)
+	}
+
+	if m.cfg.WebhookURL == "" {
+		return
+	}
+
+	body, err := json.Marshal(alert)
+	if err != nil {
+		log.Printf("⚠️  MONITOR: could not encode alert: %v", err)
+		return
+	}
+
+	resp, err := m.webhook.Post(m.cfg.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("⚠️  MONITOR: webhook failed: %v", err)
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		log.Printf("⚠️  MONITOR: webhook answered %s", resp.Status)
+	}
+}
+
+func alertKey(kind, node string) string {
+	return kind + " " + node
+}
+
+// short abbreviates a block hash for messages
+func short(hash string) string {
+	if len(hash) > 16 {
+		return hash[:16]
+	}
+	return hash
+}
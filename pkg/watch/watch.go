@@ -0,0 +1,220 @@
+// Package watch follows payments to an address on a running node
+//
+// The watcher polls the tip through the HTTP API and reads every new main
+// chain block. A payment is reported when a block pays the address, again
+// when it reaches the required confirmations, and as reverted when a reorg
+// drops its block (the transaction is reported anew if it is mined again).
+package watch
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/marcocsrachid/blockchain-go/internal/api"
+	"github.com/marcocsrachid/blockchain-go/internal/blockchain"
+	"github.com/marcocsrachid/blockchain-go/pkg/client"
+)
+
+// Watching defaults
+const (
+	DefaultInterval = 10 * time.Second
+	DefaultMinConf  = 6
+	maxReorgDepth   = 100 // Blocks remembered to follow reorgs
+)
+
+// Event kinds
+const (
+	EventReceived  = "received"
+	EventConfirmed = "confirmed"
+	EventReverted  = "reverted"
+)
+
+// Event is a change in the state of a payment to the watched address
+type Event struct {
+	Kind          string    `json:"kind"`
+	TxID          string    `json:"txid"`
+	Amount        int       `json:"amount"`
+	Height        int       `json:"height"`
+	Confirmations int       `json:"confirmations"`
+	Time          time.Time `json:"time"`
+}
+
+func (e Event) String() string {
+	switch e.Kind {
+	case EventReceived:
+		return fmt.Sprintf("received %d in %s at height %d (%d confirmations)", e.Amount, e.TxID, e.Height, e.Confirmations)
+	case EventConfirmed:
+		return fmt.Sprintf("confirmed %d in %s (%d confirmations)", e.Amount, e.TxID, e.Confirmations)
+	default:
+		return fmt.Sprintf("reverted %d in %s, its block at height %d left the main chain", e.Amount, e.TxID, e.Height)
+	}
+}
+
+// Config configures a watcher
+type Config struct {
+	Node     string        // Base URL of the node HTTP API
+	Address  string        // Watched address (Base58 or bech32)
+	MinConf  int           // Confirmations after which a payment is confirmed
+	Interval time.Duration // Between polls
+}
+
+// payment is a payment waiting for its confirmations
+type payment struct {
+	txID   string
+	amount int
+	height int
+}
+
+// Watcher reports the payments to an address
+type Watcher struct {
+	cfg    Config
+	client *client.Client
+
+	mainChain map[int]string // Recent main chain hashes by height
+	tip       int            // Height of the last block read (-1 = not started)
+	pending   []payment
+
+	// Notify receives every event; it defaults to logging it
+	Notify func(Event)
+}
+
+// New creates a watcher, applying defaults to unset settings
+func New(cfg Config) (*Watcher, error) {
+	address, err := blockchain.ToBase58Address(cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %s: %v", cfg.Address, err)
+	}
+	cfg.Address = address // Block outputs carry Base58 addresses
+
+	if cfg.MinConf <= 0 {
+		cfg.MinConf = DefaultMinConf
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+
+	w := &Watcher{
+		cfg:       cfg,
+		client:    client.New(cfg.Node),
+		mainChain: make(map[int]string),
+		tip:       -1,
+	}
+	w.Notify = func(e Event) { log.Printf("👀 WATCH %s: %s", cfg.Address, e) }
+
+	return w, nil
+}
+
+// Run polls the node every interval until stop is closed (nil runs forever)
+// Payments already confirmed when it starts are not reported
+func (w *Watcher) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.Check(); err != nil {
+			log.Printf("⚠️  WATCH: %v", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Check reads the blocks connected since the last call and returns the events they caused
+func (w *Watcher) Check() ([]Event, error) {
+	last, err := w.client.GetLastBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if w.tip < 0 {
+		w.tip = last.Height
+		w.mainChain[last.Height] = last.Hash
+		return nil, nil
+	}
+
+	// Walk back from the tip to a block we know is in the main chain
+	blocks := []*api.BlockResponse{}
+	hash, height := last.Hash, last.Height
+	for height > w.tip-maxReorgDepth && height >= 0 && w.mainChain[height] != hash {
+		block, err := w.client.GetBlock(hash)
+		if err != nil {
+			return nil, fmt.Errorf("reading block %s: %v", hash, err)
+		}
+		blocks = append(blocks, block)
+		hash, height = block.PrevHash, block.Height-1
+	}
+
+	now := time.Now()
+	var events []Event
+
+	// Blocks above the fork point were replaced (or are gone if the chain got shorter)
+	fork := height
+	for h := range w.mainChain {
+		if h > fork {
+			delete(w.mainChain, h)
+		}
+	}
+
+	kept := w.pending[:0]
+	for _, p := range w.pending {
+		if p.height > fork {
+			events = append(events, Event{Kind: EventReverted, TxID: p.txID, Amount: p.amount, Height: p.height, Time: now})
+			continue
+		}
+		kept = append(kept, p)
+	}
+	w.pending = kept
+
+	// New main chain blocks, oldest first
+	for i := len(blocks) - 1; i >= 0; i-- {
+		block := blocks[i]
+		w.mainChain[block.Height] = block.Hash
+
+		for _, tx := range block.Txs {
+			amount := 0
+			for _, out := range tx.Outputs {
+				if out.Address == w.cfg.Address {
+					amount += out.Value
+				}
+			}
+			if amount == 0 {
+				continue
+			}
+
+			p := payment{txID: tx.TxID, amount: amount, height: block.Height}
+			events = append(events, Event{Kind: EventReceived, TxID: p.txID, Amount: amount, Height: p.height,
+				Confirmations: last.Height - p.height + 1, Time: now})
+			w.pending = append(w.pending, p)
+		}
+	}
+	w.tip = last.Height
+
+	// Payments buried deep enough
+	kept = w.pending[:0]
+	for _, p := range w.pending {
+		if confirmations := last.Height - p.height + 1; confirmations >= w.cfg.MinConf {
+			events = append(events, Event{Kind: EventConfirmed, TxID: p.txID, Amount: p.amount, Height: p.height,
+				Confirmations: confirmations, Time: now})
+			continue
+		}
+		kept = append(kept, p)
+	}
+	w.pending = kept
+
+	for h := range w.mainChain {
+		if h <= last.Height-maxReorgDepth {
+			delete(w.mainChain, h)
+		}
+	}
+
+	for _, event := range events {
+		w.Notify(event)
+	}
+
+	return events, nil
+}